@@ -0,0 +1,237 @@
+// Package analytics aggregates captured query events into per-template statistics.
+package analytics
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// Row holds aggregated statistics for a single normalized query template,
+// or for another key events are recorded under, such as a table name.
+type Row struct {
+	Query     string
+	Templates int // distinct templates recorded under the key
+	Count     int
+	Errors    int
+	Total     time.Duration
+	Avg       time.Duration
+	P95       time.Duration
+	Max       time.Duration
+}
+
+// ErrorRate returns the fraction of executions that failed, in [0, 1].
+func (r Row) ErrorRate() float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Count)
+}
+
+// Snapshot is the aggregated state of an Aggregator at a point in time.
+type Snapshot struct {
+	Start  time.Time // start of the aggregation window
+	End    time.Time // time the snapshot was taken
+	Events int       // number of aggregated events
+	Errors int       // number of aggregated events with an error
+	Rows   []Row     // sorted by total duration, descending
+}
+
+// Sort selects the order of rows. Every order is descending, with ties broken
+// by query.
+type Sort int
+
+const (
+	SortTotal  Sort = iota // total duration
+	SortCount              // executions
+	SortAvg                // average duration
+	SortP95                // 95th percentile duration
+	SortMax                // maximum duration
+	SortErrors             // failed executions, then error rate
+)
+
+func (s Sort) String() string {
+	switch s {
+	case SortTotal:
+		return "total"
+	case SortCount:
+		return "count"
+	case SortAvg:
+		return "avg"
+	case SortP95:
+		return "p95"
+	case SortMax:
+		return "max"
+	case SortErrors:
+		return "errors"
+	}
+	return "total"
+}
+
+// ParseSort parses the name of a sort order as returned by Sort.String.
+func ParseSort(name string) (Sort, error) {
+	for s := SortTotal; s <= SortErrors; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return SortTotal, fmt.Errorf("analytics: unknown sort %q", name)
+}
+
+// SortRows sorts rows in the order by.
+func SortRows(rows []Row, by Sort) {
+	slices.SortFunc(rows, func(x, y Row) int {
+		var c int
+		switch by {
+		case SortTotal:
+			c = cmp.Compare(y.Total, x.Total)
+		case SortCount:
+			c = cmp.Compare(y.Count, x.Count)
+		case SortAvg:
+			c = cmp.Compare(y.Avg, x.Avg)
+		case SortP95:
+			c = cmp.Compare(y.P95, x.P95)
+		case SortMax:
+			c = cmp.Compare(y.Max, x.Max)
+		case SortErrors:
+			c = cmp.Or(cmp.Compare(y.Errors, x.Errors), cmp.Compare(y.ErrorRate(), x.ErrorRate()))
+		}
+		return cmp.Or(c, cmp.Compare(x.Query, y.Query))
+	})
+}
+
+// reservoirSize is the number of durations a group samples to estimate
+// percentiles, which bounds its memory however long the window.
+const reservoirSize = 1024
+
+type group struct {
+	count     int
+	errors    int
+	total     time.Duration
+	max       time.Duration
+	durations []time.Duration // uniform sample of at most reservoirSize durations
+	templates map[string]struct{}
+}
+
+// add records dur, keeping durations a uniform sample of all of them
+// (reservoir sampling): exact below reservoirSize executions.
+func (g *group) add(dur time.Duration) {
+	g.count++
+	g.total += dur
+	g.max = max(g.max, dur)
+	if len(g.durations) < reservoirSize {
+		g.durations = append(g.durations, dur)
+		return
+	}
+	if i := rand.IntN(g.count); i < reservoirSize {
+		g.durations[i] = dur
+	}
+}
+
+// Aggregator incrementally collects query events. It is safe for concurrent use.
+type Aggregator struct {
+	mu     sync.Mutex
+	start  time.Time
+	events int
+	errors int
+	groups map[string]*group
+}
+
+// New creates an empty Aggregator whose window starts now.
+func New() *Aggregator {
+	return &Aggregator{
+		start:  time.Now(),
+		groups: make(map[string]*group),
+	}
+}
+
+// Add records ev. Transaction lifecycle and protocol-only events, and events
+// without a normalized query, are ignored.
+func (a *Aggregator) Add(ev proxy.Event) {
+	switch ev.Op {
+	case proxy.OpBegin, proxy.OpCommit, proxy.OpRollback, proxy.OpBind, proxy.OpPrepare:
+		return
+	case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
+	}
+	if ev.NormalizedQuery == "" {
+		return
+	}
+	a.Record(ev.NormalizedQuery, []string{ev.NormalizedQuery}, ev.Duration, ev.Error != "")
+}
+
+// Record records one execution of template under each of keys, e.g. the
+// tables it refers to. Unlike Add, it does not filter: callers decide which
+// executions count.
+func (a *Aggregator) Record(template string, keys []string, dur time.Duration, failed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.events++
+	if failed {
+		a.errors++
+	}
+	for _, key := range keys {
+		g, ok := a.groups[key]
+		if !ok {
+			g = &group{templates: make(map[string]struct{})}
+			a.groups[key] = g
+		}
+		g.add(dur)
+		g.templates[template] = struct{}{}
+		if failed {
+			g.errors++
+		}
+	}
+}
+
+// Snapshot returns the current statistics. If reset is true, the aggregator
+// is cleared and a new window starts.
+func (a *Aggregator) Snapshot(reset bool) Snapshot {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	s := Snapshot{
+		Start:  a.start,
+		End:    now,
+		Events: a.events,
+		Errors: a.errors,
+		Rows:   make([]Row, 0, len(a.groups)),
+	}
+	for q, g := range a.groups {
+		durs := slices.Clone(g.durations)
+		slices.SortFunc(durs, cmp.Compare)
+		s.Rows = append(s.Rows, Row{
+			Query:     q,
+			Templates: len(g.templates),
+			Count:     g.count,
+			Errors:    g.errors,
+			Total:     g.total,
+			Avg:       g.total / time.Duration(g.count),
+			P95:       percentile(durs, 0.95),
+			Max:       g.max,
+		})
+	}
+	SortRows(s.Rows, SortTotal)
+
+	if reset {
+		a.start = now
+		a.events = 0
+		a.errors = 0
+		a.groups = make(map[string]*group)
+	}
+	return s
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
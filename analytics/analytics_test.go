@@ -0,0 +1,184 @@
+package analytics_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/analytics"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func event(op proxy.Op, nq string, dur time.Duration, errMsg string) proxy.Event {
+	return proxy.Event{Op: op, Query: nq, NormalizedQuery: nq, Duration: dur, Error: errMsg}
+}
+
+func TestAggregator_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	a := analytics.New()
+	a.Add(event(proxy.OpBegin, "BEGIN", time.Millisecond, ""))
+	a.Add(event(proxy.OpQuery, "SELECT * FROM users WHERE id = ?", 10*time.Millisecond, ""))
+	a.Add(event(proxy.OpQuery, "SELECT * FROM users WHERE id = ?", 30*time.Millisecond, ""))
+	a.Add(event(proxy.OpExecute, "UPDATE carts SET total = ?", 100*time.Millisecond, "deadlock detected"))
+	a.Add(event(proxy.OpExecute, "", 5*time.Millisecond, ""))
+	a.Add(event(proxy.OpCommit, "COMMIT", time.Millisecond, ""))
+
+	s := a.Snapshot(false)
+	if s.Events != 3 {
+		t.Errorf("Events = %d, want 3", s.Events)
+	}
+	if s.Errors != 1 {
+		t.Errorf("Errors = %d, want 1", s.Errors)
+	}
+	if len(s.Rows) != 2 {
+		t.Fatalf("len(Rows) = %d, want 2", len(s.Rows))
+	}
+
+	// Sorted by total duration, descending.
+	upd, sel := s.Rows[0], s.Rows[1]
+	if upd.Query != "UPDATE carts SET total = ?" || upd.Errors != 1 || upd.ErrorRate() != 1 {
+		t.Errorf("Rows[0] = %+v", upd)
+	}
+	if sel.Count != 2 || sel.Total != 40*time.Millisecond || sel.Avg != 20*time.Millisecond ||
+		sel.Max != 30*time.Millisecond || sel.ErrorRate() != 0 {
+		t.Errorf("Rows[1] = %+v", sel)
+	}
+}
+
+func TestAggregator_Reset(t *testing.T) {
+	t.Parallel()
+
+	a := analytics.New()
+	a.Add(event(proxy.OpQuery, "SELECT 1", time.Millisecond, ""))
+
+	if s := a.Snapshot(false); s.Events != 1 {
+		t.Fatalf("cumulative Events = %d, want 1", s.Events)
+	}
+	if s := a.Snapshot(true); s.Events != 1 {
+		t.Fatalf("Events before reset = %d, want 1", s.Events)
+	}
+	s := a.Snapshot(false)
+	if s.Events != 0 || len(s.Rows) != 0 {
+		t.Errorf("after reset: Events = %d, Rows = %d, want 0, 0", s.Events, len(s.Rows))
+	}
+
+	a.Add(event(proxy.OpQuery, "SELECT 2", time.Millisecond, ""))
+	if s := a.Snapshot(false); s.Events != 1 || s.Rows[0].Query != "SELECT 2" {
+		t.Errorf("after reset and add: %+v", s)
+	}
+}
+
+func TestAggregator_Record(t *testing.T) {
+	t.Parallel()
+
+	a := analytics.New()
+	a.Record("SELECT * FROM orders o JOIN users u ON u.id = o.user_id", []string{"orders", "users"},
+		10*time.Millisecond, false)
+	a.Record("SELECT * FROM users WHERE id = ?", []string{"users"}, 20*time.Millisecond, true)
+
+	s := a.Snapshot(false)
+	if s.Events != 2 || s.Errors != 1 {
+		t.Errorf("Events, Errors = %d, %d, want 2, 1", s.Events, s.Errors)
+	}
+	if len(s.Rows) != 2 {
+		t.Fatalf("len(Rows) = %d, want 2", len(s.Rows))
+	}
+	users, orders := s.Rows[0], s.Rows[1]
+	if users.Query != "users" || users.Count != 2 || users.Templates != 2 || users.Errors != 1 ||
+		users.Total != 30*time.Millisecond {
+		t.Errorf("Rows[0] = %+v", users)
+	}
+	if orders.Query != "orders" || orders.Count != 1 || orders.Templates != 1 || orders.Errors != 0 {
+		t.Errorf("Rows[1] = %+v", orders)
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	t.Parallel()
+
+	rows := []analytics.Row{
+		{Query: "a", Count: 1, Errors: 1, Total: 30 * time.Millisecond, Avg: 30 * time.Millisecond,
+			P95: 30 * time.Millisecond, Max: 30 * time.Millisecond},
+		{Query: "b", Count: 4, Errors: 1, Total: 20 * time.Millisecond, Avg: 5 * time.Millisecond,
+			P95: 8 * time.Millisecond, Max: 40 * time.Millisecond},
+		{Query: "c", Count: 4, Total: 40 * time.Millisecond, Avg: 10 * time.Millisecond,
+			P95: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+	}
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"total", "cab"},
+		{"count", "bca"},
+		{"avg", "acb"},
+		{"p95", "acb"},
+		{"max", "bac"},
+		{"errors", "abc"}, // a and b both failed once; a has the higher rate
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			t.Parallel()
+			by, err := analytics.ParseSort(tt.sort)
+			if err != nil {
+				t.Fatalf("ParseSort(%q): %v", tt.sort, err)
+			}
+			if by.String() != tt.sort {
+				t.Errorf("String() = %q, want %q", by.String(), tt.sort)
+			}
+			sorted := slices.Clone(rows)
+			analytics.SortRows(sorted, by)
+			var got strings.Builder
+			for _, r := range sorted {
+				got.WriteString(r.Query)
+			}
+			if got.String() != tt.want {
+				t.Errorf("order = %s, want %s", got.String(), tt.want)
+			}
+		})
+	}
+
+	if _, err := analytics.ParseSort("fastest"); err == nil {
+		t.Error("ParseSort of an unknown order should fail")
+	}
+}
+
+func TestAggregator_ManyExecutions(t *testing.T) {
+	t.Parallel()
+
+	// Far more executions than are sampled: counts, totals and the maximum
+	// stay exact, and the p95 estimate stays close.
+	a := analytics.New()
+	const n = 20000
+	for i := range n {
+		a.Add(event(proxy.OpQuery, "SELECT 1", time.Duration(i+1)*time.Microsecond, ""))
+	}
+	r := a.Snapshot(false).Rows[0]
+	if r.Count != n || r.Max != n*time.Microsecond || r.Total != time.Duration(n*(n+1)/2)*time.Microsecond {
+		t.Errorf("row = %+v", r)
+	}
+	if want := 19000 * time.Microsecond; r.P95 < want-time.Millisecond || r.P95 > want+time.Millisecond {
+		t.Errorf("P95 = %s, want about %s", r.P95, want)
+	}
+}
+
+func TestAggregator_WindowSampling(t *testing.T) {
+	t.Parallel()
+
+	// Interval snapshots sample each window afresh: a reset drops the
+	// samples of the previous window along with its counts.
+	a := analytics.New()
+	for range 5000 {
+		a.Add(event(proxy.OpQuery, "SELECT 1", time.Second, ""))
+	}
+	a.Snapshot(true)
+	for range 3000 {
+		a.Add(event(proxy.OpQuery, "SELECT 1", time.Millisecond, ""))
+	}
+	r := a.Snapshot(true).Rows[0]
+	if r.Count != 3000 || r.P95 != time.Millisecond || r.Max != time.Millisecond {
+		t.Errorf("second window = %+v, want 3000 runs of 1ms", r)
+	}
+}
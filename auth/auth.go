@@ -0,0 +1,109 @@
+// Package auth implements the optional bearer-token authentication between
+// sql-tapd and its clients.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TokenEnv is the environment variable clients read the token from.
+const TokenEnv = "SQLTAP_TOKEN"
+
+// header is the gRPC metadata key and HTTP header carrying the token.
+const header = "authorization"
+
+// queryParam carries the token in the URL where a header cannot be set,
+// e.g. for the browser's EventSource.
+const queryParam = "access_token"
+
+// Valid reports whether value, an "authorization" header value, is
+// "Bearer <token>".
+func Valid(value, token string) bool {
+	got, ok := strings.CutPrefix(value, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// ServerOptions returns the gRPC server options that require token on every
+// call. An empty token requires nothing.
+func ServerOptions(token string) []grpc.ServerOption {
+	if token == "" {
+		return nil
+	}
+	check := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get(header) {
+			if Valid(v, token) {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "auth: missing or invalid token")
+	}
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(
+			ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+		) (any, error) {
+			if err := check(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(
+			srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler,
+		) error {
+			if err := check(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// Middleware requires token on the requests to paths under /api/, either as
+// an "Authorization: Bearer" header or an access_token query parameter.
+// Other paths serve static assets and stay public. An empty token requires
+// nothing.
+func Middleware(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") &&
+			!Valid(r.Header.Get(header), token) &&
+			!Valid("Bearer "+r.URL.Query().Get(queryParam), token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DialOptions returns the gRPC dial options that send token with every call.
+// An empty token sends nothing.
+func DialOptions(token string) []grpc.DialOption {
+	if token == "" {
+		return nil
+	}
+	return []grpc.DialOption{grpc.WithPerRPCCredentials(bearer(token))}
+}
+
+// bearer implements credentials.PerRPCCredentials.
+type bearer string
+
+func (b bearer) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{header: "Bearer " + string(b)}, nil
+}
+
+// RequireTransportSecurity reports false: sql-tapd is usually reached over
+// plaintext on a local or private network.
+func (b bearer) RequireTransportSecurity() bool {
+	return false
+}
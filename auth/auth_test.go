@@ -0,0 +1,46 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/auth"
+)
+
+func TestValid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		value string
+		token string
+		want  bool
+	}{
+		{name: "match", value: "Bearer secret", token: "secret", want: true},
+		{name: "wrong token", value: "Bearer guess", token: "secret", want: false},
+		{name: "prefix of token", value: "Bearer sec", token: "secret", want: false},
+		{name: "missing scheme", value: "secret", token: "secret", want: false},
+		{name: "other scheme", value: "Basic secret", token: "secret", want: false},
+		{name: "empty", value: "", token: "secret", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := auth.Valid(tt.value, tt.token); got != tt.want {
+				t.Errorf("Valid(%q, %q) = %v, want %v", tt.value, tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptions_EmptyToken(t *testing.T) {
+	t.Parallel()
+
+	if opts := auth.ServerOptions(""); opts != nil {
+		t.Errorf("ServerOptions(\"\") = %v, want nil", opts)
+	}
+	if opts := auth.DialOptions(""); opts != nil {
+		t.Errorf("DialOptions(\"\") = %v, want nil", opts)
+	}
+}
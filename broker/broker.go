@@ -1,63 +1,220 @@
 package broker
 
 import (
+	"maps"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/mickamy/sql-tap/proxy"
 )
 
-// Broker implements a non-blocking fan-out pub/sub for proxy events.
-// Slow subscribers silently drop events to avoid blocking the publisher.
+// Entry is a published event with its sequence number. Sequence numbers
+// start at 1 and grow by one per published event, so they order events and
+// serve as resume cursors.
+type Entry struct {
+	Seq   uint64
+	Event proxy.Event
+}
+
+// Broker implements a fan-out pub/sub for proxy events. By default it never
+// blocks the publisher: slow subscribers drop the events that don't fit in
+// their buffer (see SetOverflow).
 type Broker struct {
+	// pubMu serializes Publish, so subscribers get events in sequence order.
+	// It is held while delivering; mu is not, so a Publish waiting on a slow
+	// subscriber does not hold up Subscribe, History and the like.
+	pubMu sync.Mutex
+
 	mu          sync.RWMutex
-	subscribers map[int]chan proxy.Event
+	subscribers map[int]*subscription[proxy.Event]
 	nextID      int
 	bufSize     int
+	overflow    proxy.Overflow
+
+	entrySubs map[int]*subscription[Entry] // subscribers that also want sequence numbers
+	seq       uint64                       // sequence number of the last published event
+
+	// history is a ring buffer of the last len(history) published events,
+	// starting at histStart once full.
+	history   []Entry
+	histSize  int
+	histStart int
+
+	dropped atomic.Uint64 // events dropped for slow subscribers
 }
 
 func New(bufSize int) *Broker {
+	return NewWithHistory(bufSize, 0)
+}
+
+// NewWithHistory creates a Broker that also keeps the last historySize
+// published events for History and SubscribeAfter.
+func NewWithHistory(bufSize, historySize int) *Broker {
 	return &Broker{
-		subscribers: make(map[int]chan proxy.Event),
+		subscribers: make(map[int]*subscription[proxy.Event]),
 		bufSize:     bufSize,
+		entrySubs:   make(map[int]*subscription[Entry]),
+		histSize:    historySize,
+	}
+}
+
+// SetOverflow sets how Publish handles a subscriber whose buffer is full;
+// the default is proxy.DropNewest. With proxy.Block, Publish waits for the
+// slowest subscriber, which in turn stalls whatever publishes. It must be
+// called before the first Publish.
+func (b *Broker) SetOverflow(o proxy.Overflow) {
+	b.overflow = o
+}
+
+// subscription is a subscriber's buffer. done is closed on unsubscribe,
+// before mu is taken, so that a Publish blocked on ch gives up.
+type subscription[T any] struct {
+	ch      chan T
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex    // held while sending on ch, so that close waits for the send
+	closed  bool          // ch is closed; guarded by mu
+	dropped atomic.Uint64 // events dropped for this subscriber
+}
+
+func newSubscription[T any](bufSize int) *subscription[T] {
+	return &subscription[T]{ch: make(chan T, bufSize), done: make(chan struct{})}
+}
+
+// close ends the subscription: it stops a blocked send and closes ch once
+// no send is in progress. It is idempotent.
+func (s *subscription[T]) close() {
+	s.once.Do(func() { close(s.done) })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
 	}
 }
 
+// send delivers v to the subscription, handling a full buffer as overflow
+// says, and returns the number of events dropped.
+func (s *subscription[T]) send(v T, overflow proxy.Overflow) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0
+	}
+	n := proxy.Send(s.ch, v, overflow, s.done)
+	s.dropped.Add(n)
+	return n
+}
+
 // Subscribe returns a channel that receives published events
 // and an unsubscribe function. The unsubscribe function is idempotent.
 func (b *Broker) Subscribe() (<-chan proxy.Event, func()) {
+	ch, _, unsub := b.SubscribeCounted()
+	return ch, unsub
+}
+
+// SubscribeCounted is like Subscribe but also returns a function reporting
+// the number of events dropped, or evicted under proxy.DropOldest, because
+// this subscriber's buffer was full.
+func (b *Broker) SubscribeCounted() (<-chan proxy.Event, func() uint64, func()) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	id := b.nextID
 	b.nextID++
 
-	ch := make(chan proxy.Event, b.bufSize)
-	b.subscribers[id] = ch
+	sub := newSubscription[proxy.Event](b.bufSize)
+	b.subscribers[id] = sub
 
-	return ch, func() {
+	return sub.ch, sub.dropped.Load, func() {
 		b.mu.Lock()
-		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+		b.mu.Unlock()
+		sub.close()
+	}
+}
 
-		if _, ok := b.subscribers[id]; ok {
-			delete(b.subscribers, id)
-			close(ch)
+// SubscribeAfter is like Subscribe but delivers entries, and first returns
+// the history entries published after sequence number after. The backlog and
+// the channel together hold every event after the cursor exactly once, as
+// far as the history reaches back and the subscriber keeps up.
+func (b *Broker) SubscribeAfter(after uint64) ([]Entry, <-chan Entry, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Entry
+	for _, e := range b.historyLocked() {
+		if e.Seq > after {
+			backlog = append(backlog, e)
 		}
 	}
+
+	id := b.nextID
+	b.nextID++
+
+	sub := newSubscription[Entry](b.bufSize)
+	b.entrySubs[id] = sub
+
+	return backlog, sub.ch, func() {
+		b.mu.Lock()
+		delete(b.entrySubs, id)
+		b.mu.Unlock()
+		sub.close()
+	}
 }
 
-// Publish sends an event to all subscribers.
-// If a subscriber's buffer is full, the event is dropped for that subscriber.
+// Publish sends an event to all subscribers. A subscriber whose buffer is
+// full is handled according to the overflow policy (see SetOverflow).
 func (b *Broker) Publish(ev proxy.Event) {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
 
-	for _, ch := range b.subscribers {
-		select {
-		case ch <- ev:
-		default:
-			// buffer full; drop event for this subscriber
+	b.mu.Lock()
+	b.seq++
+	entry := Entry{Seq: b.seq, Event: ev}
+	if b.histSize > 0 {
+		if len(b.history) < b.histSize {
+			b.history = append(b.history, entry)
+		} else {
+			b.history[b.histStart] = entry
+			b.histStart = (b.histStart + 1) % b.histSize
 		}
 	}
+
+	subs := slices.Collect(maps.Values(b.subscribers))
+	entrySubs := slices.Collect(maps.Values(b.entrySubs))
+	overflow := b.overflow
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		b.dropped.Add(sub.send(ev, overflow))
+	}
+	for _, sub := range entrySubs {
+		b.dropped.Add(sub.send(entry, overflow))
+	}
+}
+
+// Dropped returns the number of events dropped, or evicted under
+// proxy.DropOldest, because a subscriber's buffer was full. An event dropped
+// for two subscribers counts twice.
+func (b *Broker) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// History returns the kept events, oldest first.
+func (b *Broker) History() []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.historyLocked()
+}
+
+func (b *Broker) historyLocked() []Entry {
+	out := make([]Entry, 0, len(b.history))
+	out = append(out, b.history[b.histStart:]...)
+	return append(out, b.history[:b.histStart]...)
 }
 
 // SubscriberCount returns the number of active subscribers.
@@ -65,5 +222,5 @@ func (b *Broker) SubscriberCount() int {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	return len(b.subscribers)
+	return len(b.subscribers) + len(b.entrySubs)
 }
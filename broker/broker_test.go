@@ -1,6 +1,8 @@
 package broker_test
 
 import (
+	"slices"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -109,6 +111,182 @@ func TestBroker_SlowSubscriberDropsEvents(t *testing.T) {
 	}
 }
 
+func TestBroker_Dropped(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(2)
+	_, unsub := b.Subscribe()
+	defer unsub()
+	_, _, unsubAfter := b.SubscribeAfter(0)
+	defer unsubAfter()
+
+	// Fill both buffers.
+	b.Publish(proxy.Event{ID: "1"})
+	b.Publish(proxy.Event{ID: "2"})
+	if got := b.Dropped(); got != 0 {
+		t.Fatalf("Dropped() = %d before the buffers are full, want 0", got)
+	}
+
+	// Each further event is dropped for both subscribers.
+	b.Publish(proxy.Event{ID: "3"})
+	b.Publish(proxy.Event{ID: "4"})
+	if got := b.Dropped(); got != 4 {
+		t.Errorf("Dropped() = %d, want 4", got)
+	}
+}
+
+func TestBroker_SubscribeCounted(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(1)
+	_, slowDropped, unsubSlow := b.SubscribeCounted()
+	defer unsubSlow()
+	fast, fastDropped, unsubFast := b.SubscribeCounted()
+	defer unsubFast()
+
+	for i := range 3 {
+		b.Publish(proxy.Event{ID: strconv.Itoa(i)})
+		<-fast
+	}
+	if got := slowDropped(); got != 2 {
+		t.Errorf("slow subscriber dropped %d, want 2", got)
+	}
+	if got := fastDropped(); got != 0 {
+		t.Errorf("fast subscriber dropped %d, want 0", got)
+	}
+	if got := b.Dropped(); got != 2 {
+		t.Errorf("Dropped() = %d, want 2", got)
+	}
+}
+
+func TestBroker_Overflow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		overflow proxy.Overflow
+		want     []string
+	}{
+		{overflow: proxy.DropNewest, want: []string{"1", "2"}},
+		{overflow: proxy.DropOldest, want: []string{"4", "5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow.String(), func(t *testing.T) {
+			t.Parallel()
+
+			b := broker.New(2)
+			b.SetOverflow(tt.overflow)
+			ch, unsub := b.Subscribe()
+			_, entries, unsubEntries := b.SubscribeAfter(0)
+			for i := 1; i <= 5; i++ {
+				b.Publish(proxy.Event{ID: strconv.Itoa(i)})
+			}
+			unsub()
+			unsubEntries()
+
+			var got, gotEntries []string
+			for ev := range ch {
+				got = append(got, ev.ID)
+			}
+			for e := range entries {
+				gotEntries = append(gotEntries, e.Event.ID)
+			}
+			if !slices.Equal(got, tt.want) || !slices.Equal(gotEntries, tt.want) {
+				t.Errorf("received %v and %v, want %v", got, gotEntries, tt.want)
+			}
+			if d := b.Dropped(); d != 6 {
+				t.Errorf("Dropped() = %d, want 6", d)
+			}
+		})
+	}
+}
+
+func TestBroker_OverflowBlock(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(1)
+	b.SetOverflow(proxy.Block)
+	ch, unsub := b.Subscribe()
+	defer unsub()
+
+	b.Publish(proxy.Event{ID: "1"})
+	published := make(chan struct{})
+	go func() {
+		b.Publish(proxy.Event{ID: "2"})
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("Publish returned while the buffer was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, want := range []string{"1", "2"} {
+		select {
+		case ev := <-ch:
+			if ev.ID != want {
+				t.Errorf("received %q, want %q", ev.ID, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for event %s", want)
+		}
+	}
+	<-published
+	if d := b.Dropped(); d != 0 {
+		t.Errorf("Dropped() = %d, want 0", d)
+	}
+}
+
+func TestBroker_OverflowBlockUnsubscribe(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(1)
+	b.SetOverflow(proxy.Block)
+	_, unsub := b.Subscribe()
+
+	b.Publish(proxy.Event{ID: "1"})
+	published := make(chan struct{})
+	go func() {
+		b.Publish(proxy.Event{ID: "2"})
+		close(published)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// A subscriber that goes away must release the blocked publisher.
+	unsub()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish still blocked after unsubscribe")
+	}
+}
+
+func TestBroker_OverflowBlockDoesNotHoldLock(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(1)
+	b.SetOverflow(proxy.Block)
+	_, unsub := b.Subscribe()
+	defer unsub()
+
+	b.Publish(proxy.Event{ID: "1"})
+	go b.Publish(proxy.Event{ID: "2"})
+	time.Sleep(50 * time.Millisecond)
+
+	// A publisher waiting on a slow subscriber must not stall other callers.
+	done := make(chan struct{})
+	go func() {
+		_, unsub2 := b.Subscribe()
+		unsub2()
+		b.SubscriberCount()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe blocked behind a waiting Publish")
+	}
+}
+
 func TestBroker_ConcurrentPublish(t *testing.T) {
 	t.Parallel()
 
@@ -140,3 +318,64 @@ func TestBroker_ConcurrentPublish(t *testing.T) {
 		}
 	}
 }
+
+func TestBroker_History(t *testing.T) {
+	t.Parallel()
+
+	b := broker.NewWithHistory(8, 3)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		b.Publish(proxy.Event{ID: id})
+	}
+
+	got := b.History()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 history entries, got %d", len(got))
+	}
+	for i, want := range []struct {
+		seq uint64
+		id  string
+	}{{3, "3"}, {4, "4"}, {5, "5"}} {
+		if got[i].Seq != want.seq || got[i].Event.ID != want.id {
+			t.Errorf("history[%d] = seq %d id %q, want seq %d id %q",
+				i, got[i].Seq, got[i].Event.ID, want.seq, want.id)
+		}
+	}
+
+	if h := broker.New(8); len(h.History()) != 0 {
+		t.Error("broker without history should keep no events")
+	}
+}
+
+func TestBroker_SubscribeAfter(t *testing.T) {
+	t.Parallel()
+
+	b := broker.NewWithHistory(8, 10)
+	for _, id := range []string{"1", "2", "3"} {
+		b.Publish(proxy.Event{ID: id})
+	}
+
+	backlog, ch, unsub := b.SubscribeAfter(2)
+	defer unsub()
+	if len(backlog) != 1 || backlog[0].Seq != 3 || backlog[0].Event.ID != "3" {
+		t.Fatalf("backlog = %+v, want only seq 3", backlog)
+	}
+	if b.SubscriberCount() != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", b.SubscriberCount())
+	}
+
+	b.Publish(proxy.Event{ID: "4"})
+	select {
+	case got := <-ch:
+		if got.Seq != 4 || got.Event.ID != "4" {
+			t.Fatalf("unexpected entry: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for entry")
+	}
+
+	unsub()
+	unsub()
+	if b.SubscriberCount() != 0 {
+		t.Fatalf("expected 0 subscribers, got %d", b.SubscriberCount())
+	}
+}
@@ -11,9 +11,9 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 
+	"github.com/mickamy/sql-tap/dial"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 )
 
@@ -76,10 +76,11 @@ func (r Result) Report() string {
 
 // Run connects to the gRPC server at addr, collects query events until ctx is
 // cancelled or the server closes the stream, and returns the aggregated result.
-func Run(ctx context.Context, addr string) (Result, error) {
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// opts configure the connection; none means dial.Default.
+func Run(ctx context.Context, addr string, opts ...grpc.DialOption) (Result, error) {
+	conn, err := dial.Client(addr, opts...)
 	if err != nil {
-		return Result{}, fmt.Errorf("dial %s: %w", addr, err)
+		return Result{}, fmt.Errorf("ci: %w", err)
 	}
 	defer func() { _ = conn.Close() }()
 
@@ -136,6 +137,9 @@ func newAggregator() *aggregator {
 }
 
 func (a *aggregator) add(e *tapv1.QueryEvent) {
+	if e.GetInFlight() || e.GetUpdate() {
+		return // the completed event follows, or was counted already
+	}
 	a.total++
 	if !e.GetNPlus_1() && !e.GetSlowQuery() {
 		return
@@ -2,40 +2,82 @@ package clipboard
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
 )
 
+// Env selects the clipboard backend. Setting it to "osc52" always copies
+// through the terminal, e.g. when a local tool exists on a remote host but
+// has no display to talk to.
+const Env = "SQLTAP_CLIPBOARD"
+
 // Copy writes text to the system clipboard.
 // It uses pbcopy on macOS, xclip/xsel on Linux, and clip.exe on Windows.
+// Without such a tool, as on a headless host reached over SSH, or when Env
+// is "osc52", it asks the terminal to set its clipboard with an OSC 52
+// escape sequence instead.
 func Copy(ctx context.Context, text string) error {
-	var cmd *exec.Cmd
+	if os.Getenv(Env) == "osc52" {
+		return copyOSC52(text)
+	}
+
+	cmd, err := localCommand(ctx)
+	if err != nil {
+		if oscErr := copyOSC52(text); oscErr != nil {
+			return errors.Join(err, oscErr)
+		}
+		return nil
+	}
+
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("clipboard copy: %w", err)
+	}
+	return nil
+}
 
+// localCommand returns the command that copies its stdin to the clipboard.
+func localCommand(ctx context.Context) (*exec.Cmd, error) {
 	switch runtime.GOOS {
 	case "darwin":
-		cmd = exec.CommandContext(ctx, "pbcopy")
+		return exec.CommandContext(ctx, "pbcopy"), nil
 	case "linux":
 		if _, err := exec.LookPath("xclip"); err == nil {
-			cmd = exec.CommandContext(ctx, "xclip", "-selection", "clipboard")
-		} else if _, err := exec.LookPath("xsel"); err == nil {
-			cmd = exec.CommandContext(ctx, "xsel", "--clipboard", "--input")
-		} else {
-			return errors.New("xclip or xsel is required on Linux")
+			return exec.CommandContext(ctx, "xclip", "-selection", "clipboard"), nil
 		}
+		if _, err := exec.LookPath("xsel"); err == nil {
+			return exec.CommandContext(ctx, "xsel", "--clipboard", "--input"), nil
+		}
+		return nil, errors.New("xclip or xsel is required on Linux")
 	case "windows":
-		cmd = exec.CommandContext(ctx, "clip.exe")
+		return exec.CommandContext(ctx, "clip.exe"), nil
 	}
+	return nil, fmt.Errorf("clipboard not supported on %s", runtime.GOOS)
+}
 
-	if cmd == nil {
-		return fmt.Errorf("clipboard not supported on %s", runtime.GOOS)
+// copyOSC52 writes the OSC 52 sequence for text to the controlling terminal,
+// bypassing the TUI's output.
+func copyOSC52(text string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("clipboard osc52: open tty: %w", err)
 	}
+	defer func() { _ = tty.Close() }()
+	return writeOSC52(tty, text)
+}
 
-	cmd.Stdin = strings.NewReader(text)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("clipboard copy: %w", err)
+// writeOSC52 writes the OSC 52 sequence that sets the clipboard ("c") to
+// text: ESC ] 52 ; c ; <base64> BEL.
+func writeOSC52(w io.Writer, text string) error {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if _, err := io.WriteString(w, seq); err != nil {
+		return fmt.Errorf("clipboard osc52: %w", err)
 	}
 	return nil
 }
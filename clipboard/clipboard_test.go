@@ -1,8 +1,11 @@
 package clipboard_test
 
 import (
+	"bytes"
+	"encoding/base64"
 	"os/exec"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/mickamy/sql-tap/clipboard"
@@ -32,3 +35,46 @@ func TestCopy(t *testing.T) {
 		t.Fatalf("Copy returned error: %v", err)
 	}
 }
+
+func TestWriteOSC52(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "ascii", text: "SELECT * FROM users WHERE id = 1"},
+		{name: "multi-line", text: "SELECT 1;\nSELECT 2;"},
+		{name: "utf-8", text: "SELECT 'héllo 世界'"},
+		{name: "escape bytes", text: "a\x1b]0;title\x07b"},
+		{name: "empty", text: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if err := clipboard.WriteOSC52(&buf, tt.text); err != nil {
+				t.Fatal(err)
+			}
+
+			got := buf.String()
+			const prefix, suffix = "\x1b]52;c;", "\a"
+			payload, ok := strings.CutPrefix(got, prefix)
+			if ok {
+				payload, ok = strings.CutSuffix(payload, suffix)
+			}
+			if !ok {
+				t.Fatalf("sequence = %q, want %q<base64>%q", got, prefix, suffix)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(payload)
+			if err != nil {
+				t.Fatalf("payload %q is not base64: %v", payload, err)
+			}
+			if string(decoded) != tt.text {
+				t.Errorf("decoded = %q, want %q", decoded, tt.text)
+			}
+		})
+	}
+}
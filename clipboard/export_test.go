@@ -0,0 +1,4 @@
+package clipboard
+
+// WriteOSC52 exposes writeOSC52 for testing.
+var WriteOSC52 = writeOSC52
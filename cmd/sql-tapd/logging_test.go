@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/broker"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		format  string
+		level   string
+		want    []string // substrings of the output
+		wantErr string
+	}{
+		{name: "text", format: "text", level: "info", want: []string{`level=INFO msg="slow query" template="SELECT ?"`}},
+		{name: "json", format: "json", level: "INFO", want: []string{`"level":"INFO","msg":"slow query","template":"SELECT ?"`}},
+		{name: "debug shows debug", format: "text", level: "debug", want: []string{"level=DEBUG", "level=INFO"}},
+		{name: "warn hides info", format: "json", level: "warn", want: nil},
+		{name: "unknown format", format: "xml", level: "info", wantErr: "-log-format"},
+		{name: "unknown level", format: "text", level: "verbose", wantErr: "-log-level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			logger, err := newLogger(&buf, tt.format, tt.level)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newLogger error = %v, want it to mention %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newLogger: %v", err)
+			}
+			logger.Debug("parsed", "bytes", 8)
+			logger.Info("slow query", "template", "SELECT ?")
+
+			out := buf.String()
+			if tt.want == nil && out != "" {
+				t.Errorf("output = %q, want none", out)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("output = %q, want it to contain %q", out, w)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessorLogsSlowQuery(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+	proc := &processor{
+		broker:        broker.New(4),
+		slowThreshold: 100 * time.Millisecond,
+		log:           slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+	proc.handle(proxy.Event{Op: proxy.OpQuery, Query: "SELECT * FROM users WHERE id = 1", Duration: time.Millisecond})
+	proc.handle(proxy.Event{Op: proxy.OpQuery, Query: "SELECT * FROM users WHERE id = 2", Duration: 250 * time.Millisecond})
+
+	records := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(records) != 1 {
+		t.Fatalf("logs = %q, want one slow query record", records)
+	}
+	var rec struct {
+		Level     string        `json:"level"`
+		Msg       string        `json:"msg"`
+		Template  string        `json:"template"`
+		Op        string        `json:"op"`
+		Duration  time.Duration `json:"duration"`
+		Threshold time.Duration `json:"threshold"`
+	}
+	if err := json.Unmarshal([]byte(records[0]), &rec); err != nil {
+		t.Fatalf("decode log record: %v", err)
+	}
+	want := "SELECT * FROM users WHERE id = ?"
+	if rec.Level != "DEBUG" || rec.Msg != "slow query" || rec.Template != want || rec.Op != "Query" ||
+		rec.Duration != 250*time.Millisecond || rec.Threshold != 100*time.Millisecond {
+		t.Errorf("record = %+v, want a slow query record for %q taking 250ms over 100ms", rec, want)
+	}
+}
@@ -2,20 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"net"
 	"os"
 	"os/signal"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/mickamy/sql-tap/analytics"
+	"github.com/mickamy/sql-tap/auth"
 	"github.com/mickamy/sql-tap/broker"
 	"github.com/mickamy/sql-tap/config"
 	"github.com/mickamy/sql-tap/detect"
@@ -26,6 +35,7 @@ import (
 	"github.com/mickamy/sql-tap/proxy/postgres"
 	"github.com/mickamy/sql-tap/query"
 	"github.com/mickamy/sql-tap/server"
+	"github.com/mickamy/sql-tap/tracing"
 	"github.com/mickamy/sql-tap/web"
 )
 
@@ -38,20 +48,58 @@ func main() {
 			"sql-tapd — SQL proxy daemon for sql-tap\n\nUsage:\n  sql-tapd [flags]\n\nFlags:\n")
 		fs.PrintDefaults()
 		fmt.Fprintf(os.Stderr,
-			"\nEnvironment:\n  DATABASE_URL    DSN for EXPLAIN queries (read by default via -dsn-env)\n")
+			"\nEnvironment:\n  DATABASE_URL    DSN for EXPLAIN queries (read by default via -dsn-env)\n"+
+				"  SQLTAP_TOKEN    token clients must present (used when -auth-token is not set)\n")
 	}
 
 	configPath := fs.String("config", "", "path to config file (default: .sql-tap.yaml)")
 	driver := fs.String("driver", "", "database driver: postgres, mysql, tidb (required)")
 	listen := fs.String("listen", "", "client listen address (required)")
-	upstream := fs.String("upstream", "", "upstream database address (required)")
+	upstream := fs.String("upstream", "",
+		"upstream database address, or comma-separated addresses picked per connection by -routing (required)")
+	routing := fs.String("routing", "round-robin",
+		"how to pick among several upstreams: round-robin, or by-db with database=host:port entries (postgres only)")
 	grpcAddr := fs.String("grpc", ":9091", "gRPC server address for TUI")
 	dsnEnv := fs.String("dsn-env", "DATABASE_URL", "environment variable holding DSN for EXPLAIN")
+	analyzeCommit := fs.Bool("analyze-commit", false,
+		"let EXPLAIN ANALYZE keep the changes of the statements it runs instead of rolling them back")
 	httpAddr := fs.String("http", "", "HTTP server address for web UI (e.g. :8080)")
+	authToken := fs.String("auth-token", "", "require this bearer token on the gRPC and HTTP APIs")
+	tlsCert := fs.String("tls-cert", "", "serve gRPC over TLS with this PEM certificate (requires -tls-key)")
+	tlsKey := fs.String("tls-key", "", "PEM private key for -tls-cert")
 	nplus1Threshold := fs.Int("nplus1-threshold", 5, "N+1 detection threshold (0 to disable)")
 	nplus1Window := fs.Duration("nplus1-window", time.Second, "N+1 detection time window")
 	nplus1Cooldown := fs.Duration("nplus1-cooldown", 10*time.Second, "N+1 alert cooldown per query template")
+	nplus1Override := make(nplus1Overrides)
+	fs.Var(nplus1Override, "nplus1-override",
+		"N+1 threshold for a table or query template, as table:N or 'template:N' (repeatable; 0 disables)")
 	slowThreshold := fs.Duration("slow-threshold", 100*time.Millisecond, "slow query threshold (0 to disable)")
+	buffer := fs.Int("buffer", 256, "events buffered per proxy and per subscriber before overflow")
+	overflow := fs.String("overflow", "drop-newest",
+		"what to do when a buffer is full: drop-newest, drop-oldest, or block (backpressures the database connections)")
+	sample := fs.String("sample", "",
+		"publish only this share of unflagged events, as a fraction (1/10) or rate (0.1); errors, slow and N+1 queries are always kept")
+	resultColumns := fs.Bool("result-columns", false, "capture the number of columns in each result set")
+	analyticsInterval := fs.Duration("analytics-interval", 0,
+		"log an analytics snapshot of top query templates at this interval (0 to disable)")
+	analyticsCumulative := fs.Bool("analytics-cumulative", false,
+		"keep analytics snapshots cumulative instead of resetting every interval")
+	autoExplainSlow := fs.Bool("auto-explain-slow", false,
+		"attach a plan-only EXPLAIN to slow queries (requires EXPLAIN to be configured)")
+	autoExplainCooldown := fs.Duration("auto-explain-cooldown", time.Minute,
+		"minimum time between auto-explains of the same query template")
+	autoExplainFullScanRows := fs.Int64("auto-explain-full-scan-rows", 10000,
+		"flag auto-explained queries that scan a whole table of at least this many rows (0 to disable)")
+	otelEndpoint := fs.String("otel-endpoint", "",
+		"export a span per query to this OTLP/gRPC collector (host:port, or https://host:port for TLS)")
+	otelBoundArgs := fs.Bool("otel-bound-args", false,
+		"export statements with their arguments inlined instead of normalized")
+	logFormat := fs.String("log-format", "text", "log output format: text or json")
+	logLevel := fs.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	drainTimeout := fs.Duration("drain-timeout", 10*time.Second,
+		"on shutdown, how long to let client connections finish in-flight queries and transactions")
+	replayPath := fs.String("replay", "", "publish the events of a .tapdump file instead of proxying a database")
+	replaySpeed := fs.Float64("speed", 1, "replay speed factor (2 plays twice as fast)")
 	showVersion := fs.Bool("version", false, "show version and exit")
 
 	_ = fs.Parse(os.Args[1:])
@@ -77,15 +125,33 @@ func main() {
 	if set["upstream"] && *upstream != "" {
 		cfg.Upstream = *upstream
 	}
+	if set["routing"] {
+		cfg.Routing = *routing
+	}
 	if set["grpc"] && *grpcAddr != "" {
 		cfg.GRPC = *grpcAddr
 	}
 	if set["dsn-env"] && *dsnEnv != "" {
 		cfg.DSNEnv = *dsnEnv
 	}
+	if set["analyze-commit"] {
+		cfg.AnalyzeCommit = *analyzeCommit
+	}
 	if set["http"] {
 		cfg.HTTP = *httpAddr
 	}
+	if set["auth-token"] {
+		cfg.AuthToken = *authToken
+	}
+	if set["tls-cert"] {
+		cfg.TLSCert = *tlsCert
+	}
+	if set["tls-key"] {
+		cfg.TLSKey = *tlsKey
+	}
+	if cfg.AuthToken == "" {
+		cfg.AuthToken = os.Getenv(auth.TokenEnv)
+	}
 	if set["nplus1-threshold"] {
 		cfg.NPlus1.Threshold = *nplus1Threshold
 	}
@@ -95,17 +161,79 @@ func main() {
 	if set["nplus1-cooldown"] {
 		cfg.NPlus1.Cooldown = *nplus1Cooldown
 	}
+	if len(nplus1Override) > 0 && cfg.NPlus1.Overrides == nil {
+		cfg.NPlus1.Overrides = make(map[string]int)
+	}
+	for key, n := range nplus1Override {
+		cfg.NPlus1.Overrides[key] = n
+	}
 	if set["slow-threshold"] {
 		cfg.SlowThreshold = *slowThreshold
 	}
+	if set["buffer"] {
+		cfg.Buffer = *buffer
+	}
+	if set["overflow"] {
+		cfg.Overflow = *overflow
+	}
+	if set["sample"] {
+		cfg.Sample = *sample
+	}
+	if set["result-columns"] {
+		cfg.ResultColumns = *resultColumns
+	}
+	if set["analytics-interval"] {
+		cfg.Analytics.Interval = *analyticsInterval
+	}
+	if set["analytics-cumulative"] {
+		cfg.Analytics.Cumulative = *analyticsCumulative
+	}
+	if set["auto-explain-slow"] {
+		cfg.AutoExplain.Slow = *autoExplainSlow
+	}
+	if set["auto-explain-cooldown"] {
+		cfg.AutoExplain.Cooldown = *autoExplainCooldown
+	}
+	if set["auto-explain-full-scan-rows"] {
+		cfg.AutoExplain.FullScanRows = *autoExplainFullScanRows
+	}
+	if set["otel-endpoint"] {
+		cfg.OTel.Endpoint = *otelEndpoint
+	}
+	if set["otel-bound-args"] {
+		cfg.OTel.BoundArgs = *otelBoundArgs
+	}
+	if set["log-format"] {
+		cfg.LogFormat = *logFormat
+	}
+	if set["log-level"] {
+		cfg.LogLevel = *logLevel
+	}
+	if set["drain-timeout"] {
+		cfg.DrainTimeout = *drainTimeout
+	}
+
+	logger, err := newLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Also routes the log package, used by library code, through logger.
+	slog.SetDefault(logger)
+
+	rp := replayOptions{path: *replayPath, speed: *replaySpeed}
+	if rp.path != "" && rp.speed <= 0 {
+		fatal(errors.New("-speed must be greater than 0"))
+	}
 
-	if cfg.Driver == "" || cfg.Listen == "" || cfg.Upstream == "" {
+	// Without any connection settings, show how to pass them. Partial settings
+	// are reported by run.
+	if rp.path == "" && cfg.Driver == "" && cfg.Listen == "" && cfg.Upstream == "" {
 		fs.Usage()
 		os.Exit(1)
 	}
 
-	if err := run(cfg); err != nil {
-		log.Fatal(err)
+	if err := run(cfg, rp); err != nil {
+		fatal(err)
 	}
 }
 
@@ -116,12 +244,31 @@ func flagsSet(fs *flag.FlagSet) map[string]bool {
 	return m
 }
 
-func run(cfg config.Config) error {
+func run(cfg config.Config, rp replayOptions) error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// A replay needs no database; only proxying requires the connection settings.
+	if rp.path == "" {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.Buffer < 1 {
+		return errors.New("-buffer must be at least 1")
+	}
+	overflow, err := proxy.ParseOverflow(cfg.Overflow)
+	if err != nil {
+		return fmt.Errorf("-overflow: %w", err)
+	}
+	sampleRate, err := parseSample(cfg.Sample)
+	if err != nil {
+		return fmt.Errorf("-sample: %w", err)
+	}
+
 	// Broker
-	b := broker.New(256)
+	b := broker.NewWithHistory(cfg.Buffer, historySize)
+	b.SetOverflow(overflow)
 
 	// EXPLAIN client (optional)
 	var explainClient *explain.Client
@@ -140,11 +287,55 @@ func run(cfg config.Config) error {
 			explainDriver = explain.Postgres
 		}
 		explainClient = explain.NewClient(db, explainDriver)
+		explainClient.SetAnalyzeCommit(cfg.AnalyzeCommit)
 		defer func() { _ = explainClient.Close() }()
-		log.Printf("EXPLAIN enabled")
+		if cfg.AnalyzeCommit {
+			slog.Warn("EXPLAIN enabled; EXPLAIN ANALYZE keeps the changes of the statements it runs")
+		} else {
+			slog.Info("EXPLAIN enabled")
+		}
 	} else {
-		log.Printf("EXPLAIN disabled (%s not set)", cfg.DSNEnv)
+		slog.Info("EXPLAIN disabled, DSN variable not set", "env", cfg.DSNEnv)
+	}
+
+	// Proxy (not used when replaying)
+	var (
+		p         proxy.Proxy
+		upstreams *proxy.Upstreams
+	)
+	if rp.path == "" {
+		routing, err := proxy.ParseRouting(cfg.Routing)
+		if err != nil {
+			return fmt.Errorf("-routing: %w", err)
+		}
+		upstreams, err = proxy.ParseUpstreams(cfg.Upstream, routing)
+		if err != nil {
+			return fmt.Errorf("-upstream: %w", err)
+		}
+		switch cfg.Driver {
+		case "postgres":
+			p = postgres.NewWithUpstreams(cfg.Listen, upstreams, cfg.Buffer, overflow)
+		case "mysql", "tidb":
+			if routing == proxy.ByDatabase {
+				return errors.New("-routing by-db needs -driver postgres: " +
+					"MySQL servers greet the client before it names a database")
+			}
+			p = mysql.NewWithUpstreams(cfg.Listen, upstreams, cfg.Buffer, overflow)
+		default:
+			return fmt.Errorf("unsupported driver: %s", cfg.Driver)
+		}
+	}
+
+	var (
+		serverInfo   func() (proxy.ServerInfo, bool)
+		proxyDropped func() uint64
+	)
+	if p != nil {
+		p.SetResultColumns(cfg.ResultColumns)
+		serverInfo = p.ServerInfo
+		proxyDropped = p.Dropped
 	}
+	go logDrops(ctx, b, proxyDropped, dropLogInterval)
 
 	// gRPC server
 	var lc net.ListenConfig
@@ -152,25 +343,48 @@ func run(cfg config.Config) error {
 	if err != nil {
 		return fmt.Errorf("listen grpc %s: %w", cfg.GRPC, err)
 	}
-	srv := server.New(b, explainClient)
+	grpcOpts := auth.ServerOptions(cfg.AuthToken)
+	grpcScheme := "plaintext"
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return errors.New("-tls-cert and -tls-key must be set together")
+		}
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return fmt.Errorf("load TLS key pair: %w", err)
+		}
+		grpcOpts = append(grpcOpts, grpc.Creds(creds))
+		grpcScheme = "TLS"
+	}
+	srv := server.New(b, explainClient, grpcOpts...)
+	srv.SetServerInfo(cfg.Driver, serverInfo)
+	srv.SetProxyDropped(proxyDropped)
+	if cfg.NPlus1.Threshold > 0 || len(cfg.NPlus1.Overrides) > 0 {
+		srv.SetNPlus1Window(cfg.NPlus1.Window)
+	}
 	go func() {
-		log.Printf("gRPC server listening on %s", cfg.GRPC)
+		slog.Info("gRPC server listening", "addr", cfg.GRPC, "transport", grpcScheme)
 		if err := srv.Serve(grpcLis); err != nil {
-			log.Printf("grpc serve: %v", err)
+			slog.Error("gRPC serve", "err", err)
 		}
 	}()
 
 	// HTTP server (optional)
+	var stats *analytics.Aggregator
 	if cfg.HTTP != "" {
 		httpLis, err := lc.Listen(ctx, "tcp", cfg.HTTP)
 		if err != nil {
 			return fmt.Errorf("listen http %s: %w", cfg.HTTP, err)
 		}
-		webSrv := web.New(b, explainClient)
+		stats = analytics.New()
+		webSrv := web.New(b, explainClient, stats)
+		webSrv.RequireToken(cfg.AuthToken)
+		webSrv.SetServerInfo(cfg.Driver, serverInfo)
+		webSrv.SetProxyDropped(proxyDropped)
 		go func() {
-			log.Printf("HTTP server listening on %s", cfg.HTTP)
+			slog.Info("HTTP server listening", "addr", cfg.HTTP)
 			if err := webSrv.Serve(httpLis); err != nil {
-				log.Printf("http serve: %v", err)
+				slog.Error("HTTP serve", "err", err)
 			}
 		}()
 		defer func() {
@@ -180,84 +394,388 @@ func run(cfg config.Config) error {
 		}()
 	}
 
-	// Proxy
-	var p proxy.Proxy
-	switch cfg.Driver {
-	case "postgres":
-		p = postgres.New(cfg.Listen, cfg.Upstream)
-	case "mysql", "tidb":
-		p = mysql.New(cfg.Listen, cfg.Upstream)
-	default:
-		return fmt.Errorf("unsupported driver: %s", cfg.Driver)
-	}
-
 	// N+1 detector (optional)
 	var det *detect.Detector
-	if cfg.NPlus1.Threshold > 0 {
+	if cfg.NPlus1.Threshold > 0 || len(cfg.NPlus1.Overrides) > 0 {
 		det = detect.New(cfg.NPlus1.Threshold, cfg.NPlus1.Window, cfg.NPlus1.Cooldown)
-		log.Printf("N+1 detection enabled (threshold=%d, window=%s, cooldown=%s)",
-			cfg.NPlus1.Threshold, cfg.NPlus1.Window, cfg.NPlus1.Cooldown)
+		for key, n := range cfg.NPlus1.Overrides {
+			det.Override(key, n)
+		}
+		slog.Info("N+1 detection enabled", "threshold", cfg.NPlus1.Threshold, "window", cfg.NPlus1.Window,
+			"cooldown", cfg.NPlus1.Cooldown, "overrides", len(cfg.NPlus1.Overrides))
 	}
 
 	if cfg.SlowThreshold > 0 {
-		log.Printf("slow query detection enabled (threshold=%s)", cfg.SlowThreshold)
+		slog.Info("slow query detection enabled", "threshold", cfg.SlowThreshold)
 	}
 
-	go func() {
-		for ev := range p.Events() {
-			if ev.Query != "" {
-				ev.NormalizedQuery = query.Normalize(ev.Query)
-			}
-			if det != nil && isSelectQuery(ev.Op, ev.Query) {
-				r := det.Record(ev.Query, ev.StartTime)
-				ev.NPlus1 = r.Matched
-				if r.Alert != nil {
-					log.Printf("N+1 detected: %q (%d times in %s)",
-						r.Alert.Query, r.Alert.Count, cfg.NPlus1.Window)
-				}
-			}
-			if cfg.SlowThreshold > 0 && ev.Duration >= cfg.SlowThreshold {
-				ev.SlowQuery = true
-			}
-			b.Publish(ev)
+	// Periodic analytics snapshots (optional)
+	var agg *analytics.Aggregator
+	if cfg.Analytics.Interval > 0 {
+		agg = analytics.New()
+		slog.Info("analytics snapshots enabled", "interval", cfg.Analytics.Interval,
+			"cumulative", cfg.Analytics.Cumulative)
+		go logAnalytics(ctx, agg, cfg.Analytics.Interval, cfg.Analytics.Cumulative)
+	}
+
+	// Auto-explain of slow queries (optional)
+	var explainer planner
+	if cfg.AutoExplain.Slow {
+		switch {
+		case explainClient == nil:
+			slog.Warn("auto-explain disabled", "reason", "EXPLAIN not configured")
+		case cfg.SlowThreshold <= 0:
+			slog.Warn("auto-explain disabled", "reason", "slow query detection is off")
+		default:
+			explainer = explain.NewAuto(explainClient, cfg.AutoExplain.Cooldown)
+			slog.Info("auto-explain enabled for slow queries", "cooldown", cfg.AutoExplain.Cooldown)
+		}
+	}
+
+	// OpenTelemetry span export (optional)
+	var spans *tracing.Exporter
+	if cfg.OTel.Endpoint != "" {
+		spans, err = tracing.Dial(ctx, cfg.OTel.Endpoint, tracing.Options{
+			System:    tracing.System(cfg.Driver),
+			BoundArgs: cfg.OTel.BoundArgs,
+		})
+		if err != nil {
+			return err
 		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := spans.Shutdown(shutdownCtx); err != nil {
+				slog.Error("OpenTelemetry shutdown", "err", err)
+			}
+		}()
+		slog.Info("OpenTelemetry span export enabled", "endpoint", cfg.OTel.Endpoint)
+	}
+
+	if sampleRate < 1 {
+		slog.Info("sampling enabled for unflagged events", "share", cfg.Sample)
+	}
+
+	proc := &processor{
+		broker:        b,
+		det:           det,
+		nplus1Window:  cfg.NPlus1.Window,
+		slowThreshold: cfg.SlowThreshold,
+		explainer:     explainer,
+		fullScanRows:  cfg.AutoExplain.FullScanRows,
+		sampleRate:    sampleRate,
+		spans:         spans,
+		agg:           agg,
+		stats:         stats,
+		log:           slog.Default(),
+	}
+
+	if rp.path != "" {
+		return runReplay(ctx, rp, proc, srv)
+	}
+
+	processed := make(chan struct{})
+	go func() {
+		proc.run(p.Events())
+		close(processed)
 	}()
 
-	log.Printf("proxying %s -> %s (driver=%s)", cfg.Listen, cfg.Upstream, cfg.Driver)
+	attrs := []any{"listen", cfg.Listen, "upstream", upstreams.String(), "driver", cfg.Driver}
+	if _, ok := upstreams.Single(); !ok {
+		attrs = append(attrs, "routing", upstreams.Routing().String())
+	}
+	slog.Info("proxying", attrs...)
 	if err := p.ListenAndServe(ctx); err != nil {
 		return fmt.Errorf("proxy: %w", err)
 	}
 
-	srv.GracefulStop()
+	// Stop accepting clients but let the connected ones finish what they
+	// are running, then flush what is still being processed before the
+	// deferred shutdowns of the exporters and the HTTP server.
+	slog.Info("shutting down; draining client connections", "timeout", cfg.DrainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+	defer cancel()
+	if err := p.Shutdown(drainCtx); err != nil {
+		slog.Warn("closed client connections still in use", "err", err)
+	}
+	<-processed
+	proc.wait()
+	if agg != nil {
+		logSnapshot(slog.Default(), agg.Snapshot(!cfg.Analytics.Cumulative), analyticsTopN)
+	}
+
+	stopServer(srv, grpcStopTimeout)
+	return nil
+}
+
+// grpcStopTimeout bounds how long shutdown waits for gRPC clients, which
+// keep Watch streams open until they disconnect.
+const grpcStopTimeout = 5 * time.Second
+
+// stopServer stops srv gracefully, or forcibly once timeout has passed.
+func stopServer(srv *server.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		srv.Stop()
+		<-stopped
+	}
+}
+
+// processor enriches captured events (normalization, N+1 and slow flags,
+// auto-explain plans), feeds periodic analytics and publishes them to the
+// broker.
+type processor struct {
+	broker        *broker.Broker
+	det           *detect.Detector // nil when N+1 detection is disabled
+	nplus1Window  time.Duration
+	slowThreshold time.Duration
+	explainer     planner               // nil when auto-explain is disabled
+	fullScanRows  int64                 // 0 disables full scan detection
+	sampleRate    float64               // share of unflagged events to publish; 0 or 1 publishes all
+	rand          func() float64        // source for sampling; nil uses math/rand/v2
+	spans         *tracing.Exporter     // nil when span export is disabled
+	agg           *analytics.Aggregator // nil when snapshots are disabled
+	stats         *analytics.Aggregator // cumulative, for the web API; nil without --http
+	log           *slog.Logger
+}
+
+// planner attaches plans to slow queries; see explain.Auto.
+type planner interface {
+	Explain(
+		template, query string, args []string, types []proxy.ArgType, now time.Time, done func(plan string, err error),
+	) (string, bool)
+	// Wait blocks until the plans being fetched have been passed to done.
+	Wait()
+}
+
+// run processes events until the channel is closed.
+func (p *processor) run(events <-chan proxy.Event) {
+	for ev := range events {
+		p.handle(ev)
+	}
+}
+
+// wait blocks until the plans being fetched for processed events have been
+// attached and published.
+func (p *processor) wait() {
+	if p.explainer != nil {
+		p.explainer.Wait()
+	}
+}
+
+func (p *processor) handle(ev proxy.Event) {
+	if ev.Query != "" {
+		ev.NormalizedQuery = query.Normalize(ev.Query)
+		ev.BatchSize = query.BatchSize(ev.Query)
+		ev.Kind = query.Classify(ev.Query)
+		ev.Verb = query.Verb(ev.Query)
+	}
+	if ev.InFlight {
+		// Provisional events are only shown to clients; the
+		// completed event is the one that gets analyzed.
+		p.broker.Publish(ev)
+		return
+	}
+	if p.det != nil && detect.IsSelectQuery(ev.Op, ev.Query) {
+		r := p.det.Record(ev.Query, ev.StartTime)
+		ev.NPlus1 = r.Matched
+		if r.Alert != nil {
+			p.log.Warn("N+1 detected", "template", r.Alert.Query, "count", r.Alert.Count, "window", p.nplus1Window)
+		}
+	}
+	if p.slowThreshold > 0 && ev.Duration >= p.slowThreshold {
+		ev.SlowQuery = true
+		p.log.Debug("slow query", "template", ev.NormalizedQuery, "op", ev.Op.String(),
+			"duration", ev.Duration, "threshold", p.slowThreshold)
+	}
+	if p.stats != nil {
+		p.stats.Add(ev)
+	}
+	if p.agg != nil {
+		p.agg.Add(ev)
+	}
+	if !p.sampled(ev) {
+		return
+	}
+	if p.spans != nil {
+		p.spans.Record(ev)
+	}
+	if p.explainer != nil && ev.SlowQuery && ev.Error == "" {
+		// ev is published right away and republished once its plan is in.
+		published := make(chan struct{})
+		defer close(published)
+		plan, async := p.explainer.Explain(ev.NormalizedQuery, ev.Query, ev.Args, ev.ArgTypes, ev.StartTime,
+			func(plan string, err error) {
+				if err != nil {
+					p.log.Warn("auto-explain failed", "template", ev.NormalizedQuery, "err", err)
+					return
+				}
+				update := ev
+				p.attachPlan(&update, plan)
+				update.Update = true
+				<-published
+				p.broker.Publish(update)
+			})
+		if !async {
+			p.attachPlan(&ev, plan)
+		}
+	}
+	p.broker.Publish(ev)
+}
+
+// sampled reports whether ev is published under sampling. Analytics still
+// see every event. Flagged events are always kept, as are transaction
+// boundaries, which group the events between them, and statements that ran
+// long enough to have been published as in-flight, which would otherwise
+// never complete in clients.
+func (p *processor) sampled(ev proxy.Event) bool {
+	if p.sampleRate <= 0 || p.sampleRate >= 1 {
+		return true
+	}
+	if ev.Error != "" || ev.SlowQuery || ev.NPlus1 || ev.Duration >= proxy.InFlightDelay {
+		return true
+	}
+	switch ev.Op {
+	case proxy.OpBegin, proxy.OpCommit, proxy.OpRollback:
+		return true
+	}
+	random := p.rand
+	if random == nil {
+		random = rand.Float64
+	}
+	return random() < p.sampleRate
+}
+
+// parseSample parses a -sample value, a fraction such as "1/10" or a rate
+// such as "0.1", into the share of events to keep. An empty value keeps all.
+func parseSample(s string) (float64, error) {
+	if s == "" {
+		return 1, nil
+	}
+	var rate float64
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := strconv.ParseFloat(strings.TrimSpace(num), 64)
+		d, err2 := strconv.ParseFloat(strings.TrimSpace(den), 64)
+		if err := errors.Join(err1, err2); err != nil || d == 0 {
+			return 0, fmt.Errorf("invalid fraction %q", s)
+		}
+		rate = n / d
+	} else {
+		r, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid rate %q", s)
+		}
+		rate = r
+	}
+	if rate <= 0 || rate > 1 {
+		return 0, fmt.Errorf("%q is not between 0 (exclusive) and 1", s)
+	}
+	return rate, nil
+}
+
+// nplus1Overrides collects -nplus1-override flags, each a table name or query
+// template and the N+1 threshold for it.
+type nplus1Overrides map[string]int
+
+func (o nplus1Overrides) String() string {
+	keys := slices.Sorted(maps.Keys(o))
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + ":" + strconv.Itoa(o[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set parses key:N. The threshold follows the last colon, so templates may
+// contain colons themselves, as in PostgreSQL casts.
+func (o nplus1Overrides) Set(s string) error {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return fmt.Errorf("invalid override %q: want table:N or template:N", s)
+	}
+	key := strings.TrimSpace(s[:i])
+	n, err := strconv.Atoi(strings.TrimSpace(s[i+1:]))
+	if key == "" || err != nil || n < 0 {
+		return fmt.Errorf("invalid override %q: want table:N or template:N", s)
+	}
+	o[key] = n
 	return nil
 }
 
-func isSelectQuery(op proxy.Op, q string) bool {
-	switch op {
-	case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
-		trimmed := strings.TrimSpace(q)
-		if len(trimmed) < 6 || !strings.EqualFold(trimmed[:6], "SELECT") {
-			return false
+// attachPlan sets ev's plan and flags it when the plan scans a large table.
+func (p *processor) attachPlan(ev *proxy.Event, plan string) {
+	ev.Plan = plan
+	ev.FullScan = p.fullScanRows > 0 && explain.FullScan(plan, float64(p.fullScanRows))
+}
+
+// historySize is the number of recent events kept for the web UI's initial
+// page load.
+const historySize = 1000
+
+// analyticsTopN is the number of templates included in each analytics snapshot.
+const analyticsTopN = 10
+
+// logAnalytics logs an analytics snapshot every interval until ctx is done.
+func logAnalytics(ctx context.Context, agg *analytics.Aggregator, interval time.Duration, cumulative bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logSnapshot(slog.Default(), agg.Snapshot(!cumulative), analyticsTopN)
 		}
-		return !isMetadataQuery(trimmed)
-	case proxy.OpPrepare, proxy.OpBind, proxy.OpBegin, proxy.OpCommit, proxy.OpRollback:
-		return false
 	}
-	return false
 }
 
-// reFromClause matches the SQL FROM keyword as a whole word, used to detect
-// whether a SELECT query references any table.
-// NOTE: This is a simple keyword check; it cannot distinguish a FROM clause
-// from FROM inside expressions (e.g. EXTRACT(EPOCH FROM NOW()) in Postgres).
-// Such queries will not be classified as metadata, which is a safe default
-// (they stay in N+1 detection rather than being silently dropped).
-var reFromClause = regexp.MustCompile(`(?i)\bFROM\b`)
-
-// isMetadataQuery reports whether q is a system/metadata SELECT that should be
-// excluded from N+1 detection. These are selects that do not reference any
-// table (i.e. have no FROM clause), such as SELECT database(), SELECT @@version,
-// or SELECT 1.
-func isMetadataQuery(q string) bool {
-	return !reFromClause.MatchString(q)
+// logSnapshot logs a summary of s, then one record per template among the
+// top n by total duration.
+func logSnapshot(logger *slog.Logger, s analytics.Snapshot, n int) {
+	logger.Info("analytics snapshot", "window", s.End.Sub(s.Start).Round(time.Second),
+		"queries", s.Events, "errors", s.Errors, "templates", len(s.Rows))
+	rows := s.Rows
+	if n > 0 && len(rows) > n {
+		rows = rows[:n]
+	}
+	for i, r := range rows {
+		logger.Info("analytics template", "rank", i+1, "template", r.Query, "count", r.Count,
+			"errors", r.Errors, "total", r.Total, "avg", r.Avg, "p95", r.P95, "max", r.Max)
+	}
+}
+
+// dropLogInterval is how often logDrops checks for newly dropped events.
+const dropLogInterval = 10 * time.Second
+
+// logDrops logs, every interval until ctx is done, how many events the
+// proxy, counting with proxyDropped (nil if not proxying), and the broker
+// dropped since the last check, if any.
+func logDrops(ctx context.Context, b *broker.Broker, proxyDropped func() uint64, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastProxy, lastBroker uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var p uint64
+			if proxyDropped != nil {
+				p = proxyDropped()
+			}
+			br := b.Dropped()
+			if p == lastProxy && br == lastBroker {
+				continue
+			}
+			slog.Warn("events dropped", "proxy", p-lastProxy, "broker", br-lastBroker,
+				"interval", interval, "total", p+br)
+			lastProxy, lastBroker = p, br
+		}
+	}
 }
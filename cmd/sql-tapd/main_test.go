@@ -1,134 +1,184 @@
 package main
 
 import (
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/mickamy/sql-tap/broker"
+	"github.com/mickamy/sql-tap/detect"
 	"github.com/mickamy/sql-tap/proxy"
 )
 
-func TestIsSelectQuery(t *testing.T) {
+// fakePlanner answers asynchronously with a full scan plan for the first call
+// of a template and from its cache afterwards.
+type fakePlanner struct {
+	seen map[string]bool
+	wg   sync.WaitGroup
+}
+
+func (f *fakePlanner) Explain(
+	template, _ string, _ []string, _ []proxy.ArgType, _ time.Time, done func(string, error),
+) (string, bool) {
+	if f.seen[template] {
+		return "cached plan", false
+	}
+	f.seen[template] = true
+	f.wg.Go(func() { done("Seq Scan on users  (cost=0.00..2084.00 rows=1 width=44)\n  Filter: (email = 'a')", nil) })
+	return "", true
+}
+
+func (f *fakePlanner) Wait() {
+	f.wg.Wait()
+}
+
+func TestProcessorAutoExplain(t *testing.T) {
 	t.Parallel()
 
-	tests := []struct {
-		name string
-		op   proxy.Op
-		q    string
-		want bool
-	}{
-		{
-			name: "regular select",
-			op:   proxy.OpQuery,
-			q:    "SELECT id FROM users WHERE id = 1",
-			want: true,
-		},
-		{
-			name: "metadata: SELECT database()",
-			op:   proxy.OpQuery,
-			q:    "SELECT database()",
-			want: false,
-		},
-		{
-			name: "metadata: SELECT @@version",
-			op:   proxy.OpQuery,
-			q:    "SELECT @@version",
-			want: false,
-		},
-		{
-			name: "metadata: SELECT 1",
-			op:   proxy.OpQuery,
-			q:    "SELECT 1",
-			want: false,
-		},
-		{
-			name: "metadata: SELECT NOW()",
-			op:   proxy.OpQuery,
-			q:    "SELECT NOW()",
-			want: false,
-		},
-		{
-			name: "metadata: SELECT current_database()",
-			op:   proxy.OpQuery,
-			q:    "SELECT current_database()",
-			want: false,
-		},
-		{
-			name: "select with FROM (not metadata)",
-			op:   proxy.OpQuery,
-			q:    "SELECT 1 FROM dual",
-			want: true,
-		},
-		{
-			name: "insert not select",
-			op:   proxy.OpQuery,
-			q:    "INSERT INTO users VALUES (1)",
-			want: false,
-		},
-		{
-			name: "begin op",
-			op:   proxy.OpBegin,
-			q:    "",
-			want: false,
-		},
+	b := broker.New(16)
+	sub, unsub := b.Subscribe()
+	defer unsub()
+
+	proc := &processor{
+		broker:        b,
+		det:           detect.New(0, time.Second, time.Second),
+		slowThreshold: 100 * time.Millisecond,
+		explainer:     &fakePlanner{seen: map[string]bool{}},
+		fullScanRows:  10000,
+		log:           slog.New(slog.NewTextHandler(t.Output(), nil)),
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			got := isSelectQuery(tt.op, tt.q)
-			if got != tt.want {
-				t.Errorf("isSelectQuery(%v, %q) = %v, want %v", tt.op, tt.q, got, tt.want)
-			}
-		})
+	now := time.Now()
+	slow := proxy.Event{Op: proxy.OpQuery, Query: "SELECT * FROM users WHERE id = 1", StartTime: now, Duration: time.Second}
+	fast := proxy.Event{Op: proxy.OpQuery, Query: "SELECT * FROM users WHERE id = 2", StartTime: now, Duration: time.Millisecond}
+	failed := slow
+	failed.Error = "boom"
+
+	proc.handle(slow)
+	first := <-sub
+	if first.Plan != "" || first.Update {
+		t.Errorf("first slow event: Plan = %q, Update = %v, want it published before its plan", first.Plan, first.Update)
+	}
+	if ev := <-sub; ev.ID != first.ID || !ev.Update || !strings.HasPrefix(ev.Plan, "Seq Scan") || !ev.FullScan {
+		t.Errorf("plan update: ID = %q, Update = %v, Plan = %q, FullScan = %v, want the fresh full scan plan for %q",
+			ev.ID, ev.Update, ev.Plan, ev.FullScan, first.ID)
+	}
+	proc.handle(slow)
+	if ev := <-sub; ev.Plan != "cached plan" || ev.FullScan {
+		t.Errorf("repeated slow event: Plan = %q, FullScan = %v, want %q", ev.Plan, ev.FullScan, "cached plan")
+	}
+	proc.handle(fast)
+	if ev := <-sub; ev.Plan != "" {
+		t.Errorf("fast event: Plan = %q, want empty", ev.Plan)
+	}
+	proc.handle(failed)
+	if ev := <-sub; ev.Plan != "" {
+		t.Errorf("failed event: Plan = %q, want empty", ev.Plan)
+	}
+}
+
+func TestProcessorSampling(t *testing.T) {
+	t.Parallel()
+
+	const n = 10000
+	b := broker.New(4 * n)
+	sub, unsub := b.Subscribe()
+	defer unsub()
+
+	rng := rand.New(rand.NewPCG(1, 2)) //nolint:gosec // deterministic test source
+	proc := &processor{
+		broker:        b,
+		slowThreshold: 100 * time.Millisecond,
+		sampleRate:    0.1,
+		rand:          rng.Float64,
+		log:           slog.New(slog.NewTextHandler(t.Output(), nil)),
+	}
+
+	now := time.Now()
+	plain := proxy.Event{ID: "plain", Op: proxy.OpQuery, Query: "SELECT 1", StartTime: now, Duration: time.Millisecond}
+	failed := plain
+	failed.ID, failed.Error = "failed", "boom"
+	slow := plain
+	slow.ID, slow.Duration = "slow", time.Second
+	begin := proxy.Event{ID: "begin", Op: proxy.OpBegin, Query: "BEGIN", StartTime: now}
+	for range n {
+		for _, ev := range []proxy.Event{plain, failed, slow, begin} {
+			proc.handle(ev)
+		}
+	}
+	unsub()
+
+	got := map[string]int{}
+	for ev := range sub {
+		got[ev.ID]++
+	}
+	for _, id := range []string{"failed", "slow", "begin"} {
+		if got[id] != n {
+			t.Errorf("%s events published = %d, want all %d", id, got[id], n)
+		}
+	}
+	if got["plain"] < n/10*9/10 || got["plain"] > n/10*11/10 {
+		t.Errorf("plain events published = %d, want about %d", got["plain"], n/10)
 	}
 }
 
-func TestIsMetadataQuery(t *testing.T) {
+func TestParseSample(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		name string
-		q    string
-		want bool
+		in      string
+		want    float64
+		wantErr bool
 	}{
-		{
-			name: "no FROM clause",
-			q:    "SELECT database()",
-			want: true,
-		},
-		{
-			name: "system variable",
-			q:    "SELECT @@session.transaction_read_only",
-			want: true,
-		},
-		{
-			name: "constant",
-			q:    "SELECT 1",
-			want: true,
-		},
-		{
-			name: "has FROM clause",
-			q:    "SELECT id FROM users",
-			want: false,
-		},
-		{
-			name: "subquery with FROM",
-			q:    "SELECT (SELECT COUNT(*) FROM orders)",
-			want: false,
-		},
-		{
-			name: "expression-level FROM (Postgres EXTRACT)",
-			q:    "SELECT EXTRACT(EPOCH FROM NOW())",
-			want: false, // false negative: no table, but FROM in expression
-		},
+		{in: "", want: 1},
+		{in: "1/10", want: 0.1},
+		{in: " 1 / 4 ", want: 0.25},
+		{in: "0.5", want: 0.5},
+		{in: "1", want: 1},
+		{in: "0", wantErr: true},
+		{in: "2", wantErr: true},
+		{in: "1/0", wantErr: true},
+		{in: "a/10", wantErr: true},
+		{in: "ten", wantErr: true},
 	}
-
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
+		t.Run(tt.in, func(t *testing.T) {
 			t.Parallel()
-			got := isMetadataQuery(tt.q)
-			if got != tt.want {
-				t.Errorf("isMetadataQuery(%q) = %v, want %v", tt.q, got, tt.want)
+			got, err := parseSample(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSample(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseSample(%q) = %v, want %v", tt.in, got, tt.want)
 			}
 		})
 	}
 }
+
+func TestNPlus1Overrides(t *testing.T) {
+	t.Parallel()
+
+	o := make(nplus1Overrides)
+	for _, s := range []string{"users:20", " orders : 0 ", "SELECT $1::int FROM t WHERE id = $2:3", "users:25"} {
+		if err := o.Set(s); err != nil {
+			t.Fatalf("Set(%q) error: %v", s, err)
+		}
+	}
+	want := map[string]int{"users": 25, "orders": 0, "SELECT $1::int FROM t WHERE id = $2": 3}
+	if !maps.Equal(o, want) {
+		t.Errorf("overrides = %v, want %v", o, want)
+	}
+	if got, want := o.String(), "SELECT $1::int FROM t WHERE id = $2:3,orders:0,users:25"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	for _, s := range []string{"users", "users:", ":5", "users:-1", "users:many"} {
+		if err := o.Set(s); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/mickamy/sql-tap/dump"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/server"
+)
+
+// replayOptions configures -replay mode.
+type replayOptions struct {
+	path  string  // .tapdump file; empty means proxy a live database
+	speed float64 // playback speed factor, > 0
+}
+
+// runReplay publishes the events of a dump file through proc, then keeps the
+// gRPC and HTTP servers up so clients can browse the result until ctx is done.
+func runReplay(ctx context.Context, rp replayOptions, proc *processor, srv *server.Server) error {
+	events, err := loadReplay(rp.path)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("replaying", "events", len(events), "path", rp.path, "speed", rp.speed)
+	ch := make(chan proxy.Event)
+	done := make(chan struct{})
+	go func() {
+		proc.run(ch)
+		close(done)
+	}()
+	// replay only fails when interrupted, which ends the run like Ctrl+C
+	// after the replay would.
+	interrupted := replay(ctx, events, rp.speed, ch) != nil
+	close(ch)
+	<-done
+	if !interrupted {
+		slog.Info("replay finished; press Ctrl+C to exit")
+		<-ctx.Done()
+	}
+
+	proc.wait()
+	stopServer(srv, grpcStopTimeout)
+	return nil
+}
+
+// loadReplay reads the events of a .tapdump file.
+func loadReplay(path string) ([]proxy.Event, error) {
+	f, err := os.Open(path) //nolint:gosec // path is given by the user
+	if err != nil {
+		return nil, fmt.Errorf("open replay: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	records, err := dump.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	events := make([]proxy.Event, 0, len(records))
+	for _, r := range records {
+		ev, err := r.ProxyEvent()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// replay sends events to out, reproducing the gaps between their recorded
+// start times divided by speed. Start times are rebased onto the replay clock
+// so time-window detectors see the (scaled) original spacing, and the flags
+// computed at capture time are cleared so they are detected again.
+func replay(ctx context.Context, events []proxy.Event, speed float64, out chan<- proxy.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	origin := events[0].StartTime
+	begin := time.Now()
+
+	for _, ev := range events {
+		offset := time.Duration(float64(max(ev.StartTime.Sub(origin), 0)) / speed)
+		at := begin.Add(offset)
+		if wait := time.Until(at); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("replay: %w", ctx.Err())
+			case <-time.After(wait):
+			}
+		}
+
+		ev.StartTime = at
+		ev.InFlight = false
+		ev.NPlus1 = false
+		ev.SlowQuery = false
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("replay: %w", ctx.Err())
+		case out <- ev:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/broker"
+	"github.com/mickamy/sql-tap/detect"
+	"github.com/mickamy/sql-tap/dump"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// writeDump writes events to a .tapdump file and returns its path.
+func writeDump(t *testing.T, events []proxy.Event) string {
+	t.Helper()
+	records := make([]dump.Event, len(events))
+	for i, ev := range events {
+		records[i] = dump.FromProxy(ev)
+	}
+	path := filepath.Join(t.TempDir(), "capture."+dump.Ext)
+	f, err := os.Create(path) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if err := dump.Write(f, records); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayDetectsNPlus1(t *testing.T) {
+	t.Parallel()
+
+	// Six identical lookups 100ms apart, recorded an hour ago. The stored
+	// flags are stale and must be recomputed.
+	recorded := time.Now().Add(-time.Hour)
+	var events []proxy.Event
+	for i := range 6 {
+		events = append(events, proxy.Event{
+			ID:        fmt.Sprint(i + 1),
+			Op:        proxy.OpExecute,
+			Query:     "SELECT * FROM users WHERE id = $1",
+			Args:      []string{fmt.Sprint(i + 1)},
+			StartTime: recorded.Add(time.Duration(i) * 100 * time.Millisecond),
+			Duration:  time.Millisecond,
+			SlowQuery: true,
+		})
+	}
+
+	loaded, err := loadReplay(writeDump(t, events))
+	if err != nil {
+		t.Fatalf("loadReplay: %v", err)
+	}
+
+	b := broker.New(16)
+	sub, unsub := b.Subscribe()
+	defer unsub()
+
+	var logs bytes.Buffer
+	proc := &processor{
+		broker:        b,
+		det:           detect.New(5, time.Second, 10*time.Second),
+		nplus1Window:  time.Second,
+		slowThreshold: 100 * time.Millisecond,
+		log:           slog.New(slog.NewJSONHandler(&logs, nil)),
+	}
+
+	ch := make(chan proxy.Event)
+	done := make(chan struct{})
+	go func() {
+		proc.run(ch)
+		close(done)
+	}()
+	begin := time.Now()
+	if err := replay(context.Background(), loaded, 10, ch); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	close(ch)
+	<-done
+
+	// 500ms of recorded gaps at 10x speed.
+	if elapsed := time.Since(begin); elapsed < 45*time.Millisecond {
+		t.Errorf("replay took %s, want gaps honored (~50ms)", elapsed)
+	}
+
+	records := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(records) != 1 {
+		t.Fatalf("logs = %q, want one N+1 alert", records)
+	}
+	var alert struct {
+		Msg      string `json:"msg"`
+		Template string `json:"template"`
+		Count    int    `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(records[0]), &alert); err != nil {
+		t.Fatalf("decode log record: %v", err)
+	}
+	if alert.Msg != "N+1 detected" || alert.Template != events[0].Query || alert.Count != 5 {
+		t.Errorf("alert = %+v, want an N+1 alert for %q after 5 runs", alert, events[0].Query)
+	}
+
+	var prev time.Time
+	for i := range events {
+		ev := <-sub
+		if ev.StartTime.Before(begin) {
+			t.Errorf("event %d: StartTime %v not rebased onto the replay clock", i, ev.StartTime)
+		}
+		if i > 0 {
+			if gap := ev.StartTime.Sub(prev); gap != 10*time.Millisecond {
+				t.Errorf("event %d: gap = %s, want 10ms", i, gap)
+			}
+		}
+		prev = ev.StartTime
+		if ev.SlowQuery {
+			t.Errorf("event %d: stale slow flag kept", i)
+		}
+		if want := i >= 4; ev.NPlus1 != want {
+			t.Errorf("event %d: NPlus1 = %v, want %v", i, ev.NPlus1, want)
+		}
+	}
+}
+
+func TestReplayCanceled(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	events := []proxy.Event{
+		{ID: "1", Op: proxy.OpQuery, Query: "SELECT 1", StartTime: start},
+		{ID: "2", Op: proxy.OpQuery, Query: "SELECT 2", StartTime: start.Add(time.Hour)},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan proxy.Event, len(events))
+	errCh := make(chan error, 1)
+	go func() { errCh <- replay(ctx, events, 1, ch) }()
+
+	<-ch
+	cancel()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("replay returned nil after cancel, want error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not stop after cancel")
+	}
+}
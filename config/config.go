@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -12,14 +14,31 @@ import (
 
 // Config holds the sql-tapd configuration.
 type Config struct {
-	Driver        string        `yaml:"driver"`
-	Listen        string        `yaml:"listen"`
-	Upstream      string        `yaml:"upstream"`
-	GRPC          string        `yaml:"grpc"`
-	HTTP          string        `yaml:"http"`
-	DSNEnv        string        `yaml:"dsn_env"`
-	SlowThreshold time.Duration `yaml:"slow_threshold"`
-	NPlus1        NPlus1Config  `yaml:"nplus1"`
+	Driver        string            `yaml:"driver"`
+	Listen        string            `yaml:"listen"`
+	Upstream      string            `yaml:"upstream"`
+	Routing       string            `yaml:"routing"`
+	GRPC          string            `yaml:"grpc"`
+	HTTP          string            `yaml:"http"`
+	DSNEnv        string            `yaml:"dsn_env"`
+	AnalyzeCommit bool              `yaml:"analyze_commit"`
+	AuthToken     string            `yaml:"auth_token"`
+	TLSCert       string            `yaml:"tls_cert"`
+	TLSKey        string            `yaml:"tls_key"`
+	SlowThreshold time.Duration     `yaml:"slow_threshold"`
+	Buffer        int               `yaml:"buffer"`
+	Overflow      string            `yaml:"overflow"`
+	Sample        string            `yaml:"sample"`
+	ResultColumns bool              `yaml:"result_columns"`
+	NPlus1        NPlus1Config      `yaml:"nplus1"`
+	Analytics     AnalyticsConfig   `yaml:"analytics"`
+	AutoExplain   AutoExplainConfig `yaml:"auto_explain"`
+	OTel          OTelConfig        `yaml:"otel"`
+	LogFormat     string            `yaml:"log_format"`
+	LogLevel      string            `yaml:"log_level"`
+	// DrainTimeout bounds how long shutdown waits for client connections
+	// to finish their in-flight queries and transactions.
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
 }
 
 // NPlus1Config holds N+1 detection settings.
@@ -27,19 +46,62 @@ type NPlus1Config struct {
 	Threshold int           `yaml:"threshold"`
 	Window    time.Duration `yaml:"window"`
 	Cooldown  time.Duration `yaml:"cooldown"`
+	// Overrides replace Threshold for some queries, keyed by table name or,
+	// for keys containing a space, by query template. 0 disables detection
+	// for the matching queries.
+	Overrides map[string]int `yaml:"overrides"`
+}
+
+// AnalyticsConfig holds periodic analytics snapshot settings.
+type AnalyticsConfig struct {
+	// Interval between snapshots written to the log. Zero disables snapshots.
+	Interval time.Duration `yaml:"interval"`
+	// Cumulative keeps aggregating across snapshots instead of resetting each window.
+	Cumulative bool `yaml:"cumulative"`
+}
+
+// AutoExplainConfig holds settings for explaining slow queries automatically.
+type AutoExplainConfig struct {
+	// Slow runs plan-only EXPLAIN for queries over the slow threshold.
+	Slow bool `yaml:"slow"`
+	// Cooldown is the minimum time between EXPLAINs of the same template;
+	// slow runs in between reuse the last plan.
+	Cooldown time.Duration `yaml:"cooldown"`
+	// FullScanRows flags slow queries whose plan scans a whole table of at
+	// least this many estimated rows. 0 disables the check.
+	FullScanRows int64 `yaml:"full_scan_rows"`
+}
+
+// OTelConfig holds OpenTelemetry span export settings.
+type OTelConfig struct {
+	// Endpoint is the OTLP/gRPC collector address. Empty disables export.
+	Endpoint string `yaml:"endpoint"`
+	// BoundArgs exports statements with their arguments inlined instead of
+	// normalized.
+	BoundArgs bool `yaml:"bound_args"`
 }
 
 // Default returns a Config with default values.
 func Default() Config {
 	return Config{
 		GRPC:          ":9091",
+		Routing:       "round-robin",
 		DSNEnv:        "DATABASE_URL",
 		SlowThreshold: 100 * time.Millisecond,
+		Buffer:        256,
+		Overflow:      "drop-newest",
+		LogFormat:     "text",
+		LogLevel:      "info",
+		DrainTimeout:  10 * time.Second,
 		NPlus1: NPlus1Config{
 			Threshold: 5,
 			Window:    time.Second,
 			Cooldown:  10 * time.Second,
 		},
+		AutoExplain: AutoExplainConfig{
+			Cooldown:     time.Minute,
+			FullScanRows: 10000,
+		},
 	}
 }
 
@@ -64,6 +126,10 @@ func Load(path string) (Config, error) {
 		return Config{}, fmt.Errorf("read config %s: %w", path, err)
 	}
 
+	if ext := strings.ToLower(filepath.Ext(path)); ext != ".yaml" && ext != ".yml" && ext != "" {
+		return Config{}, fmt.Errorf("read config %s: unsupported format %q, use YAML (.yaml or .yml)", path, ext)
+	}
+
 	dec := yaml.NewDecoder(bytes.NewReader(data))
 	dec.KnownFields(true)
 	if err := dec.Decode(&cfg); err != nil {
@@ -72,3 +138,25 @@ func Load(path string) (Config, error) {
 
 	return cfg, nil
 }
+
+// Validate reports missing or invalid proxy settings: driver, listen and
+// upstream are required, and driver must be postgres, mysql or tidb. Each
+// error names both the config key and the flag that sets it.
+func (c Config) Validate() error {
+	var errs []error
+	for _, f := range []struct{ key, value string }{
+		{"driver", c.Driver},
+		{"listen", c.Listen},
+		{"upstream", c.Upstream},
+	} {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("config: %s is required (set %q in the config file or -%s)", f.key, f.key, f.key))
+		}
+	}
+	switch c.Driver {
+	case "", "postgres", "mysql", "tidb":
+	default:
+		errs = append(errs, fmt.Errorf("config: unsupported driver %q (want postgres, mysql or tidb)", c.Driver))
+	}
+	return errors.Join(errs...)
+}
@@ -3,6 +3,7 @@ package config_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +18,9 @@ func TestDefault(t *testing.T) {
 	if cfg.GRPC != ":9091" {
 		t.Errorf("GRPC = %q, want %q", cfg.GRPC, ":9091")
 	}
+	if cfg.Routing != "round-robin" {
+		t.Errorf("Routing = %q, want %q", cfg.Routing, "round-robin")
+	}
 	if cfg.DSNEnv != "DATABASE_URL" {
 		t.Errorf("DSNEnv = %q, want %q", cfg.DSNEnv, "DATABASE_URL")
 	}
@@ -32,6 +36,12 @@ func TestDefault(t *testing.T) {
 	if cfg.NPlus1.Cooldown != 10*time.Second {
 		t.Errorf("NPlus1.Cooldown = %s, want 10s", cfg.NPlus1.Cooldown)
 	}
+	if cfg.Buffer != 256 || cfg.Overflow != "drop-newest" {
+		t.Errorf("Buffer, Overflow = %d, %q, want 256, drop-newest", cfg.Buffer, cfg.Overflow)
+	}
+	if cfg.AutoExplain.Slow || cfg.AutoExplain.Cooldown != time.Minute || cfg.AutoExplain.FullScanRows != 10000 {
+		t.Errorf("AutoExplain = %+v, want disabled with a 1m cooldown and 10000 full scan rows", cfg.AutoExplain)
+	}
 }
 
 func TestLoad_ExplicitPath(t *testing.T) {
@@ -41,14 +51,39 @@ func TestLoad_ExplicitPath(t *testing.T) {
 driver: postgres
 listen: ":5433"
 upstream: "localhost:5432"
+routing: by-db
 grpc: ":9999"
 http: ":8080"
 dsn_env: MY_DSN
+analyze_commit: true
+auth_token: secret
+tls_cert: server.crt
+tls_key: server.key
 slow_threshold: 200ms
+buffer: 4096
+overflow: block
+sample: 1/10
+result_columns: true
 nplus1:
   threshold: 10
   window: 2s
   cooldown: 30s
+  overrides:
+    users: 20
+    "SELECT * FROM settings WHERE key = $1": 0
+analytics:
+  interval: 1m
+  cumulative: true
+auto_explain:
+  slow: true
+  cooldown: 5m
+  full_scan_rows: 500
+otel:
+  endpoint: localhost:4317
+  bound_args: true
+log_format: json
+log_level: debug
+drain_timeout: 30s
 `
 	path := writeTemp(t, content)
 
@@ -66,6 +101,9 @@ nplus1:
 	if cfg.Upstream != "localhost:5432" {
 		t.Errorf("Upstream = %q, want %q", cfg.Upstream, "localhost:5432")
 	}
+	if cfg.Routing != "by-db" {
+		t.Errorf("Routing = %q, want %q", cfg.Routing, "by-db")
+	}
 	if cfg.GRPC != ":9999" {
 		t.Errorf("GRPC = %q, want %q", cfg.GRPC, ":9999")
 	}
@@ -75,18 +113,57 @@ nplus1:
 	if cfg.DSNEnv != "MY_DSN" {
 		t.Errorf("DSNEnv = %q, want %q", cfg.DSNEnv, "MY_DSN")
 	}
+	if !cfg.AnalyzeCommit {
+		t.Error("AnalyzeCommit = false, want true")
+	}
+	if cfg.AuthToken != "secret" {
+		t.Errorf("AuthToken = %q, want %q", cfg.AuthToken, "secret")
+	}
+	if cfg.TLSCert != "server.crt" || cfg.TLSKey != "server.key" {
+		t.Errorf("TLSCert, TLSKey = %q, %q, want server.crt, server.key", cfg.TLSCert, cfg.TLSKey)
+	}
 	if cfg.SlowThreshold != 200*time.Millisecond {
 		t.Errorf("SlowThreshold = %s, want 200ms", cfg.SlowThreshold)
 	}
+	if cfg.Buffer != 4096 || cfg.Overflow != "block" {
+		t.Errorf("Buffer, Overflow = %d, %q, want 4096, block", cfg.Buffer, cfg.Overflow)
+	}
+	if cfg.Sample != "1/10" {
+		t.Errorf("Sample = %q, want %q", cfg.Sample, "1/10")
+	}
+	if !cfg.ResultColumns {
+		t.Error("ResultColumns = false, want true")
+	}
 	if cfg.NPlus1.Threshold != 10 {
 		t.Errorf("NPlus1.Threshold = %d, want 10", cfg.NPlus1.Threshold)
 	}
 	if cfg.NPlus1.Window != 2*time.Second {
 		t.Errorf("NPlus1.Window = %s, want 2s", cfg.NPlus1.Window)
 	}
+	if !cfg.AutoExplain.Slow || cfg.AutoExplain.Cooldown != 5*time.Minute || cfg.AutoExplain.FullScanRows != 500 {
+		t.Errorf("AutoExplain = %+v, want enabled with a 5m cooldown and 500 full scan rows", cfg.AutoExplain)
+	}
+	if cfg.OTel.Endpoint != "localhost:4317" || !cfg.OTel.BoundArgs {
+		t.Errorf("OTel = %+v, want localhost:4317 with bound args", cfg.OTel)
+	}
 	if cfg.NPlus1.Cooldown != 30*time.Second {
 		t.Errorf("NPlus1.Cooldown = %s, want 30s", cfg.NPlus1.Cooldown)
 	}
+	if o := cfg.NPlus1.Overrides; len(o) != 2 || o["users"] != 20 || o["SELECT * FROM settings WHERE key = $1"] != 0 {
+		t.Errorf("NPlus1.Overrides = %v, want users: 20 and the settings template: 0", o)
+	}
+	if cfg.LogFormat != "json" || cfg.LogLevel != "debug" {
+		t.Errorf("LogFormat, LogLevel = %q, %q, want json, debug", cfg.LogFormat, cfg.LogLevel)
+	}
+	if cfg.DrainTimeout != 30*time.Second {
+		t.Errorf("DrainTimeout = %s, want 30s", cfg.DrainTimeout)
+	}
+	if cfg.Analytics.Interval != time.Minute {
+		t.Errorf("Analytics.Interval = %s, want 1m", cfg.Analytics.Interval)
+	}
+	if !cfg.Analytics.Cumulative {
+		t.Error("Analytics.Cumulative = false, want true")
+	}
 }
 
 func TestLoad_PartialOverride(t *testing.T) {
@@ -164,6 +241,78 @@ grcp: ":9999"
 	if err == nil {
 		t.Fatal("expected error for unknown field 'grcp'")
 	}
+	if !strings.Contains(err.Error(), "grcp") {
+		t.Errorf("error %q does not name the unknown field", err)
+	}
+}
+
+func TestLoad_UnsupportedFormat(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(`driver = "postgres"`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := config.Load(path)
+	if err == nil || !strings.Contains(err.Error(), "YAML") {
+		t.Errorf("Load(%s) error = %v, want an unsupported format error", path, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := config.Default()
+	valid.Driver = "postgres"
+	valid.Listen = ":5433"
+	valid.Upstream = "localhost:5432"
+
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+		want   []string
+	}{
+		{name: "valid", modify: func(*config.Config) {}},
+		{name: "tidb", modify: func(c *config.Config) { c.Driver = "tidb" }},
+		{
+			name:   "missing upstream",
+			modify: func(c *config.Config) { c.Upstream = "" },
+			want:   []string{"upstream is required"},
+		},
+		{
+			name:   "missing all",
+			modify: func(c *config.Config) { c.Driver, c.Listen, c.Upstream = "", "", "" },
+			want:   []string{"driver is required", "listen is required", "upstream is required"},
+		},
+		{
+			name:   "unsupported driver",
+			modify: func(c *config.Config) { c.Driver = "sqlite" },
+			want:   []string{`unsupported driver "sqlite"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := valid
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want errors %q", tt.want)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("Validate() = %q, want it to contain %q", err, w)
+				}
+			}
+		})
+	}
 }
 
 func writeTemp(t *testing.T, content string) string {
@@ -1,8 +1,13 @@
 package detect
 
 import (
+	"regexp"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 // Alert represents a detected N+1 query pattern.
@@ -19,6 +24,10 @@ type Detector struct {
 	cooldown  time.Duration
 	queries   map[string][]time.Time
 	lastAlert map[string]time.Time
+
+	templates map[string]int // normalized query -> threshold override
+	tables    map[string]int // table name -> threshold override
+	limits    map[string]int // normalized query -> resolved threshold, when overrides are set
 }
 
 // New creates a Detector.
@@ -32,7 +41,56 @@ func New(threshold int, window, cooldown time.Duration) *Detector {
 		cooldown:  cooldown,
 		queries:   make(map[string][]time.Time),
 		lastAlert: make(map[string]time.Time),
+		templates: make(map[string]int),
+		tables:    make(map[string]int),
+		limits:    make(map[string]int),
+	}
+}
+
+// Override replaces the threshold for the queries matching key, which is a
+// normalized query template if it contains a space and a table name
+// otherwise. Table names match with or without their schema qualifier. A
+// template override wins over table overrides; of several matching table
+// overrides, the highest applies. A threshold of 0 disables detection for
+// the matching queries.
+func (d *Detector) Override(key string, threshold int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if strings.Contains(key, " ") {
+		d.templates[query.Normalize(key)] = threshold
+	} else {
+		d.tables[strings.ToLower(key)] = threshold
 	}
+	clear(d.limits)
+}
+
+// thresholdFor returns the threshold that applies to q. d.mu must be held.
+func (d *Detector) thresholdFor(q string) int {
+	if len(d.templates) == 0 && len(d.tables) == 0 {
+		return d.threshold
+	}
+	// Keyed by template, so that queries with inlined literals share an entry.
+	nq := query.Normalize(q)
+	if n, ok := d.limits[nq]; ok {
+		return n
+	}
+
+	n, ok := d.templates[nq]
+	if !ok {
+		n = d.threshold
+		found := false
+		for _, table := range query.Tables(nq) {
+			bare := table[strings.LastIndex(table, ".")+1:]
+			for _, name := range []string{table, bare} {
+				if v, ok := d.tables[name]; ok && (!found || v > n) {
+					n, found = v, true
+				}
+			}
+		}
+	}
+	d.limits[nq] = n
+	return n
 }
 
 // Result holds the outcome of a Record call.
@@ -46,36 +104,73 @@ type Result struct {
 }
 
 // Record registers a query occurrence and returns a Result.
-func (d *Detector) Record(query string, t time.Time) Result {
-	if query == "" {
+func (d *Detector) Record(q string, t time.Time) Result {
+	if q == "" {
 		return Result{}
 	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
+	threshold := d.thresholdFor(q)
+	if threshold <= 0 {
+		return Result{}
+	}
+
 	cutoff := t.Add(-d.window)
 
 	// Evict old entries and append new timestamp.
-	times := d.queries[query]
+	times := d.queries[q]
 	start := 0
 	for start < len(times) && times[start].Before(cutoff) {
 		start++
 	}
 	times = append(times[start:], t)
-	d.queries[query] = times
+	d.queries[q] = times
 
-	if len(times) < d.threshold {
+	if len(times) < threshold {
 		return Result{}
 	}
 
 	res := Result{Matched: true}
 
 	// Only fire alert notification respecting cooldown.
-	if last, ok := d.lastAlert[query]; !ok || t.Sub(last) >= d.cooldown {
-		d.lastAlert[query] = t
-		res.Alert = &Alert{Query: query, Count: len(times)}
+	if last, ok := d.lastAlert[q]; !ok || t.Sub(last) >= d.cooldown {
+		d.lastAlert[q] = t
+		res.Alert = &Alert{Query: q, Count: len(times)}
 	}
 
 	return res
 }
+
+// IsSelectQuery reports whether a statement is subject to N+1 detection: a
+// SELECT that reads a table, run as a query or execute.
+func IsSelectQuery(op proxy.Op, q string) bool {
+	switch op {
+	case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
+		trimmed := strings.TrimSpace(q)
+		if len(trimmed) < 6 || !strings.EqualFold(trimmed[:6], "SELECT") {
+			return false
+		}
+		return !isMetadataQuery(trimmed)
+	case proxy.OpPrepare, proxy.OpBind, proxy.OpBegin, proxy.OpCommit, proxy.OpRollback:
+		return false
+	}
+	return false
+}
+
+// reFromClause matches the SQL FROM keyword as a whole word, used to detect
+// whether a SELECT query references any table.
+// NOTE: This is a simple keyword check; it cannot distinguish a FROM clause
+// from FROM inside expressions (e.g. EXTRACT(EPOCH FROM NOW()) in Postgres).
+// Such queries will not be classified as metadata, which is a safe default
+// (they stay in N+1 detection rather than being silently dropped).
+var reFromClause = regexp.MustCompile(`(?i)\bFROM\b`)
+
+// isMetadataQuery reports whether q is a system/metadata SELECT that should be
+// excluded from N+1 detection. These are selects that do not reference any
+// table (i.e. have no FROM clause), such as SELECT database(), SELECT @@version,
+// or SELECT 1.
+func isMetadataQuery(q string) bool {
+	return !reFromClause.MatchString(q)
+}
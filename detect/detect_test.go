@@ -1,10 +1,12 @@
 package detect_test
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/mickamy/sql-tap/detect"
+	"github.com/mickamy/sql-tap/proxy"
 )
 
 func TestBelowThreshold(t *testing.T) {
@@ -155,3 +157,218 @@ func TestEmptyQuery(t *testing.T) {
 		t.Fatal("expected no match for empty query")
 	}
 }
+
+func TestOverride(t *testing.T) {
+	t.Parallel()
+
+	const (
+		users    = "SELECT id, name FROM users WHERE id = $1"
+		orders   = "SELECT * FROM orders WHERE user_id = $1"
+		settings = "SELECT * FROM public.settings WHERE key = $1"
+		join     = "SELECT * FROM users u JOIN accounts a ON a.id = u.account_id WHERE u.id = $1"
+	)
+
+	tests := []struct {
+		name      string
+		overrides map[string]int
+		query     string
+		matchAt   int // 1-based occurrence that first matches; 0 for never within 10
+	}{
+		{name: "no override uses the global threshold", query: orders, matchAt: 3},
+		{name: "table raises the threshold", overrides: map[string]int{"users": 5}, query: users, matchAt: 5},
+		{name: "table lowers the threshold", overrides: map[string]int{"users": 2}, query: users, matchAt: 2},
+		{name: "other tables keep the global threshold", overrides: map[string]int{"users": 5}, query: orders, matchAt: 3},
+		{name: "table matches without its schema", overrides: map[string]int{"settings": 6}, query: settings, matchAt: 6},
+		{name: "table matches with its schema", overrides: map[string]int{"public.settings": 6}, query: settings, matchAt: 6},
+		{name: "table name is case-insensitive", overrides: map[string]int{"USERS": 4}, query: users, matchAt: 4},
+		{name: "highest table override wins", overrides: map[string]int{"users": 4, "accounts": 7}, query: join, matchAt: 7},
+		{
+			name:      "template wins over table",
+			overrides: map[string]int{"users": 8, "SELECT id, name FROM users WHERE id = $1": 4},
+			query:     users,
+			matchAt:   4,
+		},
+		{name: "zero disables", overrides: map[string]int{"users": 0}, query: users, matchAt: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			d := detect.New(3, time.Second, 10*time.Second)
+			for k, n := range tt.overrides {
+				d.Override(k, n)
+			}
+			now := time.Now()
+			got := 0
+			for i := range 10 {
+				if d.Record(tt.query, now.Add(time.Duration(i)*10*time.Millisecond)).Matched {
+					got = i + 1
+					break
+				}
+			}
+			if got != tt.matchAt {
+				t.Errorf("first match at occurrence %d, want %d", got, tt.matchAt)
+			}
+		})
+	}
+}
+
+func TestOverride_GlobalUnaffected(t *testing.T) {
+	t.Parallel()
+	d := detect.New(3, time.Second, 10*time.Second)
+	d.Override("users", 20)
+	now := time.Now()
+
+	users := "SELECT * FROM users WHERE id = $1"
+	orders := "SELECT * FROM orders WHERE id = $1"
+	for i := range 3 {
+		at := now.Add(time.Duration(i) * 10 * time.Millisecond)
+		if d.Record(users, at).Matched {
+			t.Fatalf("users matched at occurrence %d under its override of 20", i+1)
+		}
+		r := d.Record(orders, at)
+		if i == 2 && (!r.Matched || r.Alert == nil) {
+			t.Fatal("orders did not alert at the global threshold")
+		}
+	}
+}
+
+func TestOverride_CachePerTemplate(t *testing.T) {
+	t.Parallel()
+	d := detect.New(3, time.Second, 10*time.Second)
+	d.Override("users", 20)
+	now := time.Now()
+
+	for i := range 100 {
+		d.Record("SELECT * FROM users WHERE id = "+strconv.Itoa(i), now)
+	}
+	if got := d.Limits(); got != 1 {
+		t.Errorf("cached thresholds = %d for one template, want 1", got)
+	}
+}
+
+func TestIsSelectQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		op   proxy.Op
+		q    string
+		want bool
+	}{
+		{
+			name: "regular select",
+			op:   proxy.OpQuery,
+			q:    "SELECT id FROM users WHERE id = 1",
+			want: true,
+		},
+		{
+			name: "metadata: SELECT database()",
+			op:   proxy.OpQuery,
+			q:    "SELECT database()",
+			want: false,
+		},
+		{
+			name: "metadata: SELECT @@version",
+			op:   proxy.OpQuery,
+			q:    "SELECT @@version",
+			want: false,
+		},
+		{
+			name: "metadata: SELECT 1",
+			op:   proxy.OpQuery,
+			q:    "SELECT 1",
+			want: false,
+		},
+		{
+			name: "metadata: SELECT NOW()",
+			op:   proxy.OpQuery,
+			q:    "SELECT NOW()",
+			want: false,
+		},
+		{
+			name: "metadata: SELECT current_database()",
+			op:   proxy.OpQuery,
+			q:    "SELECT current_database()",
+			want: false,
+		},
+		{
+			name: "select with FROM (not metadata)",
+			op:   proxy.OpQuery,
+			q:    "SELECT 1 FROM dual",
+			want: true,
+		},
+		{
+			name: "insert not select",
+			op:   proxy.OpQuery,
+			q:    "INSERT INTO users VALUES (1)",
+			want: false,
+		},
+		{
+			name: "begin op",
+			op:   proxy.OpBegin,
+			q:    "",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := detect.IsSelectQuery(tt.op, tt.q)
+			if got != tt.want {
+				t.Errorf("isSelectQuery(%v, %q) = %v, want %v", tt.op, tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMetadataQuery(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		q    string
+		want bool
+	}{
+		{
+			name: "no FROM clause",
+			q:    "SELECT database()",
+			want: true,
+		},
+		{
+			name: "system variable",
+			q:    "SELECT @@session.transaction_read_only",
+			want: true,
+		},
+		{
+			name: "constant",
+			q:    "SELECT 1",
+			want: true,
+		},
+		{
+			name: "has FROM clause",
+			q:    "SELECT id FROM users",
+			want: false,
+		},
+		{
+			name: "subquery with FROM",
+			q:    "SELECT (SELECT COUNT(*) FROM orders)",
+			want: false,
+		},
+		{
+			name: "expression-level FROM (Postgres EXTRACT)",
+			q:    "SELECT EXTRACT(EPOCH FROM NOW())",
+			want: false, // false negative: no table, but FROM in expression
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := detect.IsMetadataQuery(tt.q)
+			if got != tt.want {
+				t.Errorf("isMetadataQuery(%q) = %v, want %v", tt.q, got, tt.want)
+			}
+		})
+	}
+}
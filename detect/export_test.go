@@ -0,0 +1,11 @@
+package detect
+
+// IsMetadataQuery exposes isMetadataQuery for testing.
+var IsMetadataQuery = isMetadataQuery
+
+// Limits returns the number of resolved thresholds d has cached.
+func (d *Detector) Limits() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.limits)
+}
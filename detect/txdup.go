@@ -0,0 +1,77 @@
+package detect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TxDuplicates finds queries repeated verbatim, with the same arguments,
+// within a single transaction. Unlike Detector it is scoped to one
+// transaction and reports a result only once that transaction ends.
+//
+// TxDuplicates is not safe for concurrent use.
+type TxDuplicates struct {
+	open map[string]*txQueries // txID -> queries run so far
+}
+
+type txQueries struct {
+	order []string         // keys in order of first run
+	refs  map[string][]int // key -> refs of the runs
+}
+
+// NewTxDuplicates creates an empty TxDuplicates.
+func NewTxDuplicates() *TxDuplicates {
+	return &TxDuplicates{open: make(map[string]*txQueries)}
+}
+
+// Add records that the query with args ran in transaction txID. ref
+// identifies the run to the caller, e.g. an event index, and is returned by
+// End if the query turns out to be repeated.
+func (d *TxDuplicates) Add(txID string, ref int, query string, args []string) {
+	if txID == "" || query == "" {
+		return
+	}
+	tx, ok := d.open[txID]
+	if !ok {
+		tx = &txQueries{refs: make(map[string][]int)}
+		d.open[txID] = tx
+	}
+	key := runKey(query, args)
+	if _, ok := tx.refs[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.refs[key] = append(tx.refs[key], ref)
+}
+
+// runKey identifies a query run by its text and arguments. Arguments are
+// length-prefixed since they may contain any byte.
+func runKey(query string, args []string) string {
+	var b strings.Builder
+	b.WriteString(query)
+	for _, a := range args {
+		b.WriteByte(0)
+		b.WriteString(strconv.Itoa(len(a)))
+		b.WriteByte(':')
+		b.WriteString(a)
+	}
+	return b.String()
+}
+
+// End closes transaction txID, on COMMIT or ROLLBACK, and returns the refs
+// of every query that ran more than once in it, grouped per query in order
+// of first run. It returns nil if nothing was repeated.
+func (d *TxDuplicates) End(txID string) [][]int {
+	tx, ok := d.open[txID]
+	if !ok {
+		return nil
+	}
+	delete(d.open, txID)
+
+	var groups [][]int
+	for _, key := range tx.order {
+		if refs := tx.refs[key]; len(refs) > 1 {
+			groups = append(groups, refs)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,69 @@
+package detect_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mickamy/sql-tap/detect"
+)
+
+func TestTxDuplicates(t *testing.T) {
+	t.Parallel()
+	d := detect.NewTxDuplicates()
+
+	// Two interleaved transactions, as sql-tapd emits them for two connections.
+	d.Add("tx1", 1, "SELECT * FROM users WHERE id = $1", []string{"1"})
+	d.Add("tx2", 2, "SELECT * FROM users WHERE id = $1", []string{"1"})
+	d.Add("tx1", 3, "SELECT * FROM users WHERE id = $1", []string{"2"})
+	d.Add("tx1", 4, "SELECT * FROM settings", nil)
+	d.Add("tx1", 5, "SELECT * FROM users WHERE id = $1", []string{"1"})
+	d.Add("tx1", 6, "SELECT * FROM settings", nil)
+	d.Add("tx1", 7, "SELECT * FROM users WHERE id = $1", []string{"1"})
+
+	got := d.End("tx1")
+	want := [][]int{{1, 5, 7}, {4, 6}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("End(tx1) = %v, want %v", got, want)
+	}
+
+	if got := d.End("tx2"); got != nil {
+		t.Errorf("End(tx2) = %v, want nil", got)
+	}
+	if got := d.End("tx1"); got != nil {
+		t.Errorf("End(tx1) again = %v, want nil", got)
+	}
+}
+
+func TestTxDuplicates_ArgsAreExact(t *testing.T) {
+	t.Parallel()
+	d := detect.NewTxDuplicates()
+
+	// Joining args must not make different argument lists collide.
+	d.Add("tx", 1, "SELECT $1, $2", []string{"a", "b"})
+	d.Add("tx", 2, "SELECT $1, $2", []string{"a\x00b"})
+	d.Add("tx", 3, "SELECT $1, $2", []string{"a", "b", ""})
+	d.Add("tx", 4, "SELECT $1, $2", []string{"a", "b"})
+
+	got := d.End("tx")
+	want := [][]int{{1, 4}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("End(tx) = %v, want %v", got, want)
+	}
+}
+
+func TestTxDuplicates_IgnoresEmpty(t *testing.T) {
+	t.Parallel()
+	d := detect.NewTxDuplicates()
+
+	d.Add("", 1, "SELECT 1", nil)
+	d.Add("", 2, "SELECT 1", nil)
+	d.Add("tx", 3, "", nil)
+	d.Add("tx", 4, "", nil)
+
+	if got := d.End(""); got != nil {
+		t.Errorf("End(\"\") = %v, want nil", got)
+	}
+	if got := d.End("tx"); got != nil {
+		t.Errorf("End(tx) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,60 @@
+// Package dial builds the gRPC dial options clients use to reach sql-tapd.
+package dial
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/mickamy/sql-tap/auth"
+)
+
+// Config selects how to connect to sql-tapd.
+type Config struct {
+	// TLS connects over TLS instead of plaintext.
+	TLS bool
+	// CA is a PEM file with the certificate authority that signed the
+	// server's certificate. Empty uses the system roots. Setting it implies TLS.
+	CA string
+}
+
+// Options returns the dial options for cfg. They also send the token from
+// the auth.TokenEnv environment variable if set.
+func Options(cfg Config) ([]grpc.DialOption, error) {
+	creds := insecure.NewCredentials()
+	switch {
+	case cfg.CA != "":
+		c, err := credentials.NewClientTLSFromFile(cfg.CA, "")
+		if err != nil {
+			return nil, fmt.Errorf("dial: load CA: %w", err)
+		}
+		creds = c
+	case cfg.TLS:
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	return append([]grpc.DialOption{grpc.WithTransportCredentials(creds)},
+		auth.DialOptions(os.Getenv(auth.TokenEnv))...), nil
+}
+
+// Default returns the dial options for a plaintext connection.
+func Default() []grpc.DialOption {
+	opts, _ := Options(Config{}) // plaintext cannot fail
+	return opts
+}
+
+// Client creates a client connection to sql-tapd at target. No opts means
+// Default.
+func Client(target string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	if len(opts) == 0 {
+		opts = Default()
+	}
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", target, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,55 @@
+package dial_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+
+	"github.com/mickamy/sql-tap/dial"
+)
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cfg     dial.Config
+		wantErr bool
+	}{
+		{name: "plaintext", cfg: dial.Config{}},
+		{name: "system roots", cfg: dial.Config{TLS: true}},
+		{name: "missing CA file", cfg: dial.Config{CA: filepath.Join(t.TempDir(), "missing.pem")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts, err := dial.Options(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Options() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && len(opts) == 0 {
+				t.Error("Options() returned no options")
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	conn, err := dial.Client("localhost:9091")
+	if err != nil {
+		t.Fatalf("Client() with default options: %v", err)
+	}
+	_ = conn.Close()
+
+	// Options without transport credentials are rejected by grpc.NewClient.
+	if _, err := dial.Client("localhost:9091", grpc.WithUserAgent("test")); err == nil ||
+		!strings.HasPrefix(err.Error(), "dial localhost:9091: ") {
+		t.Errorf("Client() error = %v, want one naming the target", err)
+	}
+}
@@ -0,0 +1,248 @@
+// Package dump reads and writes .tapdump files: captured events stored as JSON
+// lines so they can be investigated offline (sql-tap -load) or replayed. The
+// line format is the same event JSON the web API streams.
+package dump
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
+)
+
+// Ext is the file extension of dump files, without the leading dot.
+const Ext = "tapdump"
+
+// maxLineSize bounds a single JSON line, which holds the full query text.
+const maxLineSize = 16 << 20
+
+// Event is the JSON form of a captured event.
+type Event struct {
+	ID              string            `json:"id"`
+	Op              string            `json:"op"`
+	Query           string            `json:"query"`
+	Args            []string          `json:"args"`
+	ArgTypes        []string          `json:"arg_types,omitempty"`
+	StartTime       string            `json:"start_time"`
+	DurationMs      float64           `json:"duration_ms"`
+	RowsAffected    int64             `json:"rows_affected"`
+	Error           string            `json:"error,omitempty"`
+	TxID            string            `json:"tx_id,omitempty"`
+	NPlus1          bool              `json:"n_plus_1,omitempty"`
+	SlowQuery       bool              `json:"slow_query,omitempty"`
+	NormalizedQuery string            `json:"normalized_query,omitempty"`
+	ReadOnly        bool              `json:"read_only,omitempty"`
+	StmtName        string            `json:"stmt_name,omitempty"`
+	BatchSize       int               `json:"batch_size,omitempty"`
+	ResultColumns   int               `json:"result_columns,omitempty"`
+	Session         map[string]string `json:"session,omitempty"`
+	Plan            string            `json:"plan,omitempty"`
+	FullScan        bool              `json:"full_scan,omitempty"`
+	Warnings        int               `json:"warnings,omitempty"`
+	CopyBytes       int64             `json:"copy_bytes,omitempty"`
+	Kind            string            `json:"kind,omitempty"`
+	TxFailed        bool              `json:"tx_failed,omitempty"`
+	Update          bool              `json:"update,omitempty"`
+	Verb            string            `json:"verb,omitempty"`
+}
+
+// FromProxy converts a proxy event.
+func FromProxy(ev proxy.Event) Event {
+	args := make([]string, len(ev.Args))
+	copy(args, ev.Args)
+	return Event{
+		ID:              ev.ID,
+		Op:              ev.Op.String(),
+		Query:           ev.Query,
+		Args:            args,
+		ArgTypes:        proxy.ArgTypeNames(ev.ArgTypes),
+		StartTime:       ev.StartTime.Format(time.RFC3339Nano),
+		DurationMs:      durationMs(ev.Duration),
+		RowsAffected:    ev.RowsAffected,
+		Error:           ev.Error,
+		TxID:            ev.TxID,
+		NPlus1:          ev.NPlus1,
+		SlowQuery:       ev.SlowQuery,
+		NormalizedQuery: ev.NormalizedQuery,
+		ReadOnly:        ev.ReadOnly,
+		StmtName:        ev.StmtName,
+		BatchSize:       ev.BatchSize,
+		ResultColumns:   ev.ResultColumns,
+		Session:         maps.Clone(ev.Session),
+		Plan:            ev.Plan,
+		FullScan:        ev.FullScan,
+		Warnings:        ev.Warnings,
+		CopyBytes:       ev.CopyBytes,
+		Kind:            ev.Kind.String(),
+		TxFailed:        ev.TxFailed,
+		Update:          ev.Update,
+		Verb:            ev.Verb,
+	}
+}
+
+// FromProto converts an event received over gRPC.
+func FromProto(ev *tapv1.QueryEvent) Event {
+	args := make([]string, len(ev.GetArgs()))
+	copy(args, ev.GetArgs())
+	return Event{
+		ID:              ev.GetId(),
+		Op:              proxy.Op(ev.GetOp()).String(),
+		Query:           ev.GetQuery(),
+		Args:            args,
+		ArgTypes:        slices.Clone(ev.GetArgTypes()),
+		StartTime:       ev.GetStartTime().AsTime().Format(time.RFC3339Nano),
+		DurationMs:      durationMs(ev.GetDuration().AsDuration()),
+		RowsAffected:    ev.GetRowsAffected(),
+		Error:           ev.GetError(),
+		TxID:            ev.GetTxId(),
+		NPlus1:          ev.GetNPlus_1(),
+		SlowQuery:       ev.GetSlowQuery(),
+		NormalizedQuery: ev.GetNormalizedQuery(),
+		ReadOnly:        ev.GetReadOnly(),
+		StmtName:        ev.GetStmtName(),
+		BatchSize:       int(ev.GetBatchSize()),
+		ResultColumns:   int(ev.GetResultColumns()),
+		Session:         maps.Clone(ev.GetSession()),
+		Plan:            ev.GetPlan(),
+		FullScan:        ev.GetFullScan(),
+		Warnings:        int(ev.GetWarnings()),
+		CopyBytes:       ev.GetCopyBytes(),
+		Kind:            query.Kind(ev.GetKind()).String(),
+		TxFailed:        ev.GetTxFailed(),
+		Update:          ev.GetUpdate(),
+		Verb:            ev.GetVerb(),
+	}
+}
+
+// ProxyEvent converts e back into a proxy event.
+func (e Event) ProxyEvent() (proxy.Event, error) {
+	op, ok := proxy.ParseOp(e.Op)
+	if !ok {
+		return proxy.Event{}, fmt.Errorf("dump: unknown op %q", e.Op)
+	}
+	start, err := time.Parse(time.RFC3339Nano, e.StartTime)
+	if err != nil {
+		return proxy.Event{}, fmt.Errorf("dump: parse start time: %w", err)
+	}
+	// Dumps written before kinds and verbs were recorded have none; derive them.
+	kind, ok := query.ParseKind(e.Kind)
+	if !ok {
+		kind = query.Classify(e.Query)
+	}
+	verb := e.Verb
+	if verb == "" {
+		verb = query.Verb(e.Query)
+	}
+	return proxy.Event{
+		ID:              e.ID,
+		Op:              op,
+		Query:           e.Query,
+		Args:            e.Args,
+		ArgTypes:        proxy.ParseArgTypes(e.ArgTypes),
+		StartTime:       start,
+		Duration:        time.Duration(math.Round(e.DurationMs*1000)) * time.Microsecond,
+		RowsAffected:    e.RowsAffected,
+		Error:           e.Error,
+		TxID:            e.TxID,
+		NPlus1:          e.NPlus1,
+		SlowQuery:       e.SlowQuery,
+		NormalizedQuery: e.NormalizedQuery,
+		ReadOnly:        e.ReadOnly,
+		StmtName:        e.StmtName,
+		BatchSize:       e.BatchSize,
+		ResultColumns:   e.ResultColumns,
+		Session:         e.Session,
+		Plan:            e.Plan,
+		FullScan:        e.FullScan,
+		Warnings:        e.Warnings,
+		CopyBytes:       e.CopyBytes,
+		Kind:            kind,
+		TxFailed:        e.TxFailed,
+		Update:          e.Update,
+		Verb:            verb,
+	}, nil
+}
+
+// Proto converts e into the gRPC event type.
+func (e Event) Proto() (*tapv1.QueryEvent, error) {
+	ev, err := e.ProxyEvent()
+	if err != nil {
+		return nil, err
+	}
+	return &tapv1.QueryEvent{
+		Id:              ev.ID,
+		Op:              int32(ev.Op),
+		Query:           ev.Query,
+		Args:            ev.Args,
+		ArgTypes:        proxy.ArgTypeNames(ev.ArgTypes),
+		StartTime:       timestamppb.New(ev.StartTime),
+		Duration:        durationpb.New(ev.Duration),
+		RowsAffected:    ev.RowsAffected,
+		Error:           ev.Error,
+		TxId:            ev.TxID,
+		NPlus_1:         ev.NPlus1,
+		SlowQuery:       ev.SlowQuery,
+		NormalizedQuery: ev.NormalizedQuery,
+		ReadOnly:        ev.ReadOnly,
+		StmtName:        ev.StmtName,
+		BatchSize:       int32(min(ev.BatchSize, math.MaxInt32)),     //nolint:gosec // clamped to int32
+		ResultColumns:   int32(min(ev.ResultColumns, math.MaxInt32)), //nolint:gosec // clamped to int32
+		Session:         ev.Session,
+		Plan:            ev.Plan,
+		FullScan:        ev.FullScan,
+		Warnings:        int32(min(ev.Warnings, math.MaxInt32)), //nolint:gosec // clamped to int32
+		CopyBytes:       ev.CopyBytes,
+		Kind:            int32(ev.Kind),
+		TxFailed:        ev.TxFailed,
+		Update:          ev.Update,
+		Verb:            ev.Verb,
+	}, nil
+}
+
+// Write writes events to w, one JSON object per line.
+func Write(w io.Writer, events []Event) error {
+	enc := json.NewEncoder(w)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return fmt.Errorf("dump: encode: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read reads all events from r. Blank lines are skipped.
+func Read(r io.Reader) ([]Event, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	var events []Event
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("dump: line %d: %w", line, err)
+		}
+		events = append(events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("dump: read: %w", err)
+	}
+	return events, nil
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
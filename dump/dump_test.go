@@ -0,0 +1,185 @@
+package dump_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mickamy/sql-tap/dump"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
+)
+
+func sampleEvents() []proxy.Event {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 123456000, time.UTC)
+	return []proxy.Event{
+		{
+			ID:              "1",
+			Op:              proxy.OpBegin,
+			Args:            []string{},
+			StartTime:       start,
+			Duration:        50 * time.Microsecond,
+			TxID:            "tx-1",
+			NormalizedQuery: "",
+		},
+		{
+			ID:              "2",
+			Op:              proxy.OpExecute,
+			Query:           "INSERT INTO t (a) VALUES ($1), ($2)",
+			Args:            []string{"x", "7"},
+			ArgTypes:        []proxy.ArgType{proxy.ArgText, proxy.ArgInt},
+			StartTime:       start.Add(time.Millisecond),
+			Duration:        12345 * time.Microsecond,
+			RowsAffected:    2,
+			TxID:            "tx-1",
+			NPlus1:          true,
+			SlowQuery:       true,
+			NormalizedQuery: "INSERT INTO t (a) VALUES (?), (?)",
+			StmtName:        "s1",
+			BatchSize:       2,
+			Plan:            "Insert on t  (cost=0.00..0.03 rows=0 width=0)",
+			FullScan:        true,
+			Warnings:        2,
+			CopyBytes:       1 << 33,
+			Kind:            query.KindWrite,
+			TxFailed:        true,
+			Verb:            "insert",
+		},
+		{
+			ID:            "3",
+			Op:            proxy.OpQuery,
+			Query:         "SELECT 1",
+			Args:          []string{},
+			StartTime:     start.Add(2 * time.Millisecond),
+			Duration:      3 * time.Second,
+			Error:         "canceled",
+			ReadOnly:      true,
+			ResultColumns: 1,
+			Session:       map[string]string{"search_path": "app, public"},
+			Kind:          query.KindRead,
+			Verb:          "select",
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	want := sampleEvents()
+	events := make([]dump.Event, len(want))
+	for i, ev := range want {
+		events[i] = dump.FromProxy(ev)
+	}
+
+	var buf bytes.Buffer
+	if err := dump.Write(&buf, events); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != len(want) {
+		t.Fatalf("wrote %d lines, want %d", n, len(want))
+	}
+
+	got, err := dump.Read(&buf)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d events, want %d", len(got), len(want))
+	}
+	for i, e := range got {
+		ev, err := e.ProxyEvent()
+		if err != nil {
+			t.Fatalf("event %d: ProxyEvent: %v", i, err)
+		}
+		if !ev.StartTime.Equal(want[i].StartTime) {
+			t.Errorf("event %d: StartTime = %v, want %v", i, ev.StartTime, want[i].StartTime)
+		}
+		ev.StartTime = want[i].StartTime
+		if !reflect.DeepEqual(ev, want[i]) {
+			t.Errorf("event %d:\n got %+v\nwant %+v", i, ev, want[i])
+		}
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, ev := range sampleEvents() {
+		pb, err := dump.FromProxy(ev).Proto()
+		if err != nil {
+			t.Fatalf("Proto: %v", err)
+		}
+		again, err := dump.FromProto(pb).Proto()
+		if err != nil {
+			t.Fatalf("Proto: %v", err)
+		}
+		if !proto.Equal(pb, again) {
+			t.Errorf("proto round trip:\n got %v\nwant %v", again, pb)
+		}
+	}
+}
+
+func TestKindAndVerbDerivedForOldDumps(t *testing.T) {
+	t.Parallel()
+
+	line := `{"op":"Exec","query":"DELETE FROM t","start_time":"2026-03-01T12:00:00Z"}` + "\n"
+	events, err := dump.Read(strings.NewReader(line))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	ev, err := events[0].ProxyEvent()
+	if err != nil {
+		t.Fatalf("ProxyEvent: %v", err)
+	}
+	if ev.Kind != query.KindWrite || ev.Verb != "delete" {
+		t.Errorf("Kind, Verb = %v, %q, want %v, %q", ev.Kind, ev.Verb, query.KindWrite, "delete")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"invalid json", "{\"id\":\"1\"}\n{oops\n", "line 2"},
+		{"unknown op", `{"op":"Nope","start_time":"2026-03-01T12:00:00Z"}` + "\n", "unknown op"},
+		{"bad time", `{"op":"Query","start_time":"yesterday"}` + "\n", "start time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			events, err := dump.Read(strings.NewReader(tt.input))
+			if err == nil {
+				for _, e := range events {
+					if _, err = e.ProxyEvent(); err != nil {
+						break
+					}
+				}
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSkipsBlankLines(t *testing.T) {
+	t.Parallel()
+
+	in := "\n" + `{"id":"1","op":"Query","start_time":"2026-03-01T12:00:00Z"}` + "\n\n"
+	events, err := dump.Read(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(events) != 1 || events[0].ID != "1" {
+		t.Errorf("events = %+v, want one event with ID 1", events)
+	}
+}
@@ -0,0 +1,150 @@
+// Package eventfmt provides the formatting and classification helpers shared by
+// the sql-tap TUI and the line-oriented tail output, so both render events the same way.
+package eventfmt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// Duration formats d as µs below 1ms, ms with one decimal below 1s, and seconds otherwise.
+func Duration(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		us := float64(d.Microseconds())
+		return fmt.Sprintf("%.0fµs", us)
+	case d < time.Second:
+		ms := float64(d.Microseconds()) / 1000
+		return fmt.Sprintf("%.1fms", ms)
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+var reSpaces = regexp.MustCompile(`\s+`)
+
+// Collapse replaces each run of whitespace in s with a single space and trims
+// the ends, putting a multi-line query on one line.
+func Collapse(s string) string {
+	return strings.TrimSpace(reSpaces.ReplaceAllString(s, " "))
+}
+
+// Truncate collapses s onto a single line and cuts it to maxLen runes, marking
+// the cut with "…".
+func Truncate(s string, maxLen int) string {
+	s = Collapse(s)
+	r := []rune(s)
+	if len(r) <= maxLen {
+		return s
+	}
+	if maxLen <= 1 {
+		return string(r[:maxLen])
+	}
+	return string(r[:maxLen-1]) + "…"
+}
+
+// sqlVerbs are the leading SQL keywords reported by Verb.
+var sqlVerbs = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true,
+	"WITH": true, "CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true,
+	"SET": true, "SHOW": true, "EXPLAIN": true, "CALL": true, "COPY": true,
+	"REPLACE": true, "MERGE": true, "GRANT": true, "REVOKE": true,
+}
+
+// Verb returns the leading SQL keyword of a query event (SELECT, INSERT, ...).
+// Transaction and protocol-level events, and queries with an unrecognized
+// keyword, fall back to the op name (Begin, Commit, Prepare, ...).
+func Verb(ev *tapv1.QueryEvent) string {
+	op := proxy.Op(ev.GetOp())
+	if op != proxy.OpQuery && op != proxy.OpExec && op != proxy.OpExecute {
+		return op.String()
+	}
+	if fields := strings.Fields(ev.GetQuery()); len(fields) > 0 {
+		kw := strings.ToUpper(strings.TrimRight(fields[0], ";("))
+		if sqlVerbs[kw] {
+			return kw
+		}
+	}
+	return op.String()
+}
+
+// VerbColor returns the color used for a verb returned by Verb.
+func VerbColor(verb string) lipgloss.Color {
+	switch verb {
+	case "SELECT", "WITH", "SHOW", "EXPLAIN":
+		return lipgloss.Color("4")
+	case "INSERT", "REPLACE", "COPY":
+		return lipgloss.Color("2")
+	case "UPDATE", "MERGE":
+		return lipgloss.Color("3")
+	case "DELETE", "TRUNCATE", "DROP":
+		return lipgloss.Color("1")
+	case "Begin", "Commit", "Rollback":
+		return lipgloss.Color("6")
+	}
+	return lipgloss.Color("5")
+}
+
+// Heat thresholds for duration coloring.
+const (
+	HeatWarm = 10 * time.Millisecond
+	HeatHot  = 100 * time.Millisecond
+)
+
+// HeatColor returns green, yellow or red depending on how long d took.
+func HeatColor(d time.Duration) lipgloss.Color {
+	switch {
+	case d >= HeatHot:
+		return lipgloss.Color("1")
+	case d >= HeatWarm:
+		return lipgloss.Color("3")
+	}
+	return lipgloss.Color("2")
+}
+
+// Badge is a status marker attached to an event.
+type Badge struct {
+	Label string
+	Color lipgloss.Color
+}
+
+var (
+	BadgeError  = Badge{Label: "E", Color: lipgloss.Color("1")}
+	BadgeNPlus1 = Badge{Label: "N+1", Color: lipgloss.Color("3")}
+	BadgeScan   = Badge{Label: "SCAN", Color: lipgloss.Color("6")}
+	BadgeSlow   = Badge{Label: "SLOW", Color: lipgloss.Color("5")}
+
+	// BadgeDup marks a query repeated within a transaction. Clients that
+	// group transactions set it; it is not part of Badges.
+	BadgeDup = Badge{Label: "DUP", Color: lipgloss.Color("3")}
+
+	// BadgeTxFailed marks a transaction the server reported as failed, whose
+	// changes were rolled back. Like BadgeDup, it is not part of Badges.
+	BadgeTxFailed = Badge{Label: "FAIL", Color: lipgloss.Color("1")}
+)
+
+// Badges returns the status badges of ev in priority order: error, N+1, full
+// scan, slow. A full scan is only detected on slow queries and is the more
+// specific of the two.
+func Badges(ev *tapv1.QueryEvent) []Badge {
+	var badges []Badge
+	if ev.GetError() != "" {
+		badges = append(badges, BadgeError)
+	}
+	if ev.GetNPlus_1() {
+		badges = append(badges, BadgeNPlus1)
+	}
+	if ev.GetFullScan() {
+		badges = append(badges, BadgeScan)
+	}
+	if ev.GetSlowQuery() {
+		badges = append(badges, BadgeSlow)
+	}
+	return badges
+}
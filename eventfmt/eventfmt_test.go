@@ -0,0 +1,97 @@
+package eventfmt_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/eventfmt"
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{500 * time.Microsecond, "500µs"},
+		{1500 * time.Microsecond, "1.5ms"},
+		{250 * time.Millisecond, "250.0ms"},
+		{1234 * time.Millisecond, "1.23s"},
+	}
+	for _, tt := range tests {
+		if got := eventfmt.Duration(tt.d); got != tt.want {
+			t.Errorf("Duration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"SELECT  1\n FROM t", 100, "SELECT 1 FROM t"},
+		{"SELECT id FROM users", 10, "SELECT id…"},
+		{"SELECT", 1, "S"},
+		{"SELECT 'ünïcödé'", 12, "SELECT 'ünï…"},
+	}
+	for _, tt := range tests {
+		if got := eventfmt.Truncate(tt.in, tt.max); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestVerb(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		op    proxy.Op
+		query string
+		want  string
+	}{
+		{"select", proxy.OpQuery, "select id from users", "SELECT"},
+		{"execute insert", proxy.OpExecute, "  INSERT INTO t VALUES ($1)", "INSERT"},
+		{"cte", proxy.OpQuery, "WITH x AS (SELECT 1) SELECT * FROM x", "WITH"},
+		{"unknown keyword", proxy.OpExec, "VACUUM", "Exec"},
+		{"empty query", proxy.OpQuery, "", "Query"},
+		{"begin", proxy.OpBegin, "BEGIN", "Begin"},
+		{"prepare", proxy.OpPrepare, "SELECT 1", "Prepare"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ev := &tapv1.QueryEvent{Op: int32(tt.op), Query: tt.query}
+			if got := eventfmt.Verb(ev); got != tt.want {
+				t.Errorf("Verb() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBadges(t *testing.T) {
+	t.Parallel()
+
+	ev := &tapv1.QueryEvent{Error: "boom", NPlus_1: true, SlowQuery: true, FullScan: true}
+	got := eventfmt.Badges(ev)
+	want := []eventfmt.Badge{eventfmt.BadgeError, eventfmt.BadgeNPlus1, eventfmt.BadgeScan, eventfmt.BadgeSlow}
+	if len(got) != len(want) {
+		t.Fatalf("Badges() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Badges()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	if got := eventfmt.Badges(&tapv1.QueryEvent{}); len(got) != 0 {
+		t.Errorf("Badges() on clean event = %v, want none", got)
+	}
+}
@@ -0,0 +1,131 @@
+package explain
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// autoTimeout bounds a single automatic EXPLAIN.
+const autoTimeout = 5 * time.Second
+
+// autoConcurrency caps the automatic EXPLAINs running at once so that a burst
+// of slow queries cannot pile load onto an already slow database.
+const autoConcurrency = 2
+
+// explainableRe matches statements that plan-only EXPLAIN describes without
+// executing them.
+var explainableRe = regexp.MustCompile(`(?i)^\s*(SELECT|WITH|INSERT|UPDATE|DELETE|REPLACE)\b`)
+
+// Explainable reports whether query is a statement EXPLAIN can describe.
+func Explainable(query string) bool {
+	return explainableRe.MatchString(query)
+}
+
+// Auto runs plan-only EXPLAIN for slow queries in the background. Each query
+// template is explained at most once per cooldown; in between, its last plan
+// is reused. Templates whose cooldown has passed are forgotten.
+type Auto struct {
+	run      func(ctx context.Context, mode Mode, query string, args []string, types []proxy.ArgType) (*Result, error)
+	cooldown time.Duration
+	sem      chan struct{}
+	wg       sync.WaitGroup // one per running EXPLAIN
+
+	mu      sync.Mutex
+	plans   map[string]string    // last plan per template
+	started map[string]time.Time // when each template was last explained
+	pruned  time.Time            // when expired templates were last removed
+}
+
+// NewAuto creates an Auto running EXPLAIN through client.
+func NewAuto(client *Client, cooldown time.Duration) *Auto {
+	return newAuto(client.Run, cooldown)
+}
+
+func newAuto(
+	run func(ctx context.Context, mode Mode, query string, args []string, types []proxy.ArgType) (*Result, error),
+	cooldown time.Duration,
+) *Auto {
+	return &Auto{
+		run:      run,
+		cooldown: cooldown,
+		sem:      make(chan struct{}, autoConcurrency),
+		plans:    make(map[string]string),
+		started:  make(map[string]time.Time),
+	}
+}
+
+// Explain looks up a plan for query, whose normalized form is template, at
+// time now. args and types are passed to Client.Run. If the template was
+// explained within the cooldown, it returns that plan, which is empty while
+// the EXPLAIN is still running or if it failed. Otherwise it starts EXPLAIN in
+// the background, returns async true and later calls done with the result.
+// Queries EXPLAIN cannot describe, and calls while too many EXPLAINs are
+// running, return an empty plan.
+func (a *Auto) Explain(
+	template, query string, args []string, types []proxy.ArgType, now time.Time, done func(plan string, err error),
+) (plan string, async bool) {
+	if template == "" || !Explainable(query) {
+		return "", false
+	}
+
+	a.mu.Lock()
+	a.prune(now)
+	if last, ok := a.started[template]; ok && now.Sub(last) < a.cooldown {
+		plan = a.plans[template]
+		a.mu.Unlock()
+		return plan, false
+	}
+	select {
+	case a.sem <- struct{}{}:
+	default:
+		a.mu.Unlock()
+		return "", false
+	}
+	a.started[template] = now
+	delete(a.plans, template)
+	a.mu.Unlock()
+
+	a.wg.Go(func() {
+		defer func() { <-a.sem }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), autoTimeout)
+		defer cancel()
+		res, err := a.run(ctx, Explain, query, args, types)
+		if err != nil {
+			done("", err)
+			return
+		}
+		a.mu.Lock()
+		if a.started[template].Equal(now) {
+			a.plans[template] = res.Plan
+		}
+		a.mu.Unlock()
+		done(res.Plan, nil)
+	})
+	return "", true
+}
+
+// prune removes the templates whose cooldown has passed at now, at most once
+// per cooldown. a.mu must be held.
+func (a *Auto) prune(now time.Time) {
+	if now.Sub(a.pruned) < a.cooldown {
+		return
+	}
+	a.pruned = now
+	for template, last := range a.started {
+		if now.Sub(last) >= a.cooldown {
+			delete(a.started, template)
+			delete(a.plans, template)
+		}
+	}
+}
+
+// Wait blocks until every EXPLAIN started so far has called done. Each one is
+// bounded by a timeout, so Wait returns within that time.
+func (a *Auto) Wait() {
+	a.wg.Wait()
+}
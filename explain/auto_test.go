@@ -0,0 +1,206 @@
+package explain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/explain"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestExplainable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM users", true},
+		{"  select 1", true},
+		{"WITH t AS (SELECT 1) SELECT * FROM t", true},
+		{"INSERT INTO users (id) VALUES (1)", true},
+		{"UPDATE users SET name = 'a'", true},
+		{"DELETE FROM users", true},
+		{"REPLACE INTO users VALUES (1)", true},
+		{"BEGIN", false},
+		{"SET search_path TO app", false},
+		{"CREATE TABLE t (id int)", false},
+		{"SELECTED", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			t.Parallel()
+
+			if got := explain.Explainable(tt.query); got != tt.want {
+				t.Errorf("Explainable(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+type autoResult struct {
+	plan string
+	err  error
+}
+
+func TestAuto_Cooldown(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	run := func(_ context.Context, mode explain.Mode, query string, _ []string, _ []proxy.ArgType) (*explain.Result, error) {
+		calls++
+		if mode != explain.Explain {
+			t.Errorf("mode = %v, want plan-only EXPLAIN", mode)
+		}
+		return &explain.Result{Plan: "plan of " + query}, nil
+	}
+	a := explain.NewAutoFunc(run, time.Minute)
+	now := time.Now()
+
+	done := make(chan autoResult, 1)
+	report := func(plan string, err error) { done <- autoResult{plan, err} }
+
+	if plan, async := a.Explain("SELECT ?", "SELECT 1", nil, nil, now, report); plan != "" || !async {
+		t.Fatalf("first Explain = %q, %v, want an async run", plan, async)
+	}
+	if r := <-done; r.err != nil || r.plan != "plan of SELECT 1" {
+		t.Fatalf("done got %q, %v", r.plan, r.err)
+	}
+
+	// Within the cooldown the cached plan is reused without running EXPLAIN.
+	plan, async := a.Explain("SELECT ?", "SELECT 2", nil, nil, now.Add(30*time.Second), report)
+	if plan != "plan of SELECT 1" || async {
+		t.Errorf("Explain within cooldown = %q, %v, want the cached plan", plan, async)
+	}
+
+	// After the cooldown the template is explained again.
+	if _, async := a.Explain("SELECT ?", "SELECT 3", nil, nil, now.Add(2*time.Minute), report); !async {
+		t.Fatal("Explain after cooldown did not run EXPLAIN")
+	}
+	if r := <-done; r.plan != "plan of SELECT 3" {
+		t.Errorf("done got %q, want the new plan", r.plan)
+	}
+	if calls != 2 {
+		t.Errorf("EXPLAIN ran %d times, want 2", calls)
+	}
+}
+
+func TestAuto_Skips(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	failed := errors.New("syntax error")
+	run := func(_ context.Context, _ explain.Mode, query string, _ []string, _ []proxy.ArgType) (*explain.Result, error) {
+		if query == "SELECT bad" {
+			return nil, failed
+		}
+		<-release
+		return &explain.Result{Plan: "plan"}, nil
+	}
+	a := explain.NewAutoFunc(run, time.Minute)
+	now := time.Now()
+
+	done := make(chan autoResult, 4)
+	report := func(plan string, err error) { done <- autoResult{plan, err} }
+
+	if _, async := a.Explain("BEGIN", "BEGIN", nil, nil, now, report); async {
+		t.Error("Explain ran EXPLAIN for BEGIN")
+	}
+
+	// A failed EXPLAIN is reported, and leaves no plan to reuse.
+	if _, async := a.Explain("SELECT bad", "SELECT bad", nil, nil, now, report); !async {
+		t.Fatal("Explain did not run EXPLAIN")
+	}
+	if r := <-done; !errors.Is(r.err, failed) {
+		t.Errorf("done got err %v, want %v", r.err, failed)
+	}
+	if plan, async := a.Explain("SELECT bad", "SELECT bad", nil, nil, now, report); plan != "" || async {
+		t.Errorf("Explain after failure = %q, %v, want no plan", plan, async)
+	}
+
+	// Two EXPLAINs may run at once; a third is skipped.
+	for _, tmpl := range []string{"SELECT a", "SELECT b"} {
+		if _, async := a.Explain(tmpl, tmpl, nil, nil, now, report); !async {
+			t.Fatalf("Explain(%q) did not run EXPLAIN", tmpl)
+		}
+	}
+	if _, async := a.Explain("SELECT c", "SELECT c", nil, nil, now, report); async {
+		t.Error("Explain ran a third concurrent EXPLAIN")
+	}
+	close(release)
+	<-done
+	<-done
+}
+
+func TestAuto_Wait(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	run := func(context.Context, explain.Mode, string, []string, []proxy.ArgType) (*explain.Result, error) {
+		<-release
+		return &explain.Result{Plan: "plan"}, nil
+	}
+	a := explain.NewAutoFunc(run, time.Minute)
+
+	var got string
+	if _, async := a.Explain("SELECT ?", "SELECT 1", nil, nil, time.Now(), func(plan string, _ error) { got = plan }); !async {
+		t.Fatal("Explain did not run EXPLAIN")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		a.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while EXPLAIN was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after EXPLAIN finished")
+	}
+	if got != "plan" {
+		t.Errorf("done got %q before Wait returned, want %q", got, "plan")
+	}
+}
+
+func TestAuto_Prune(t *testing.T) {
+	t.Parallel()
+
+	run := func(_ context.Context, _ explain.Mode, query string, _ []string, _ []proxy.ArgType) (*explain.Result, error) {
+		return &explain.Result{Plan: "plan of " + query}, nil
+	}
+	a := explain.NewAutoFunc(run, time.Minute)
+	done := func(string, error) {}
+
+	now := time.Now()
+	for _, q := range []string{"SELECT 1", "SELECT 2", "SELECT 3"} {
+		a.Explain(q, q, nil, nil, now, done)
+		a.Wait()
+	}
+	if got := a.Templates(); got != 3 {
+		t.Fatalf("Templates = %d, want 3", got)
+	}
+
+	// Past the cooldown, the earlier templates are forgotten.
+	later := now.Add(2 * time.Minute)
+	if _, async := a.Explain("SELECT 4", "SELECT 4", nil, nil, later, done); !async {
+		t.Error("Explain did not run EXPLAIN for a new template")
+	}
+	a.Wait()
+	if got := a.Templates(); got != 1 {
+		t.Errorf("Templates after the cooldown = %d, want 1", got)
+	}
+	if plan, async := a.Explain("SELECT 4", "SELECT 4", nil, nil, later, done); async || plan != "plan of SELECT 4" {
+		t.Errorf("Explain = %q, %v, want the cached plan", plan, async)
+	}
+}
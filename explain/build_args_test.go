@@ -1,10 +1,12 @@
 package explain_test
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/mickamy/sql-tap/explain"
+	"github.com/mickamy/sql-tap/proxy"
 )
 
 func TestParseTimestampParams(t *testing.T) {
@@ -229,8 +231,74 @@ func TestBuildAnyArgs(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			got := explain.BuildAnyArgs(tt.query, tt.args)
+			got := explain.BuildAnyArgs(tt.query, tt.args, nil)
 			tt.check(t, got)
 		})
 	}
 }
+
+func TestBuildAnyArgsTyped(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		query string
+		args  []string
+		types []proxy.ArgType
+		want  []any
+	}{
+		{
+			name:  "numbers and booleans",
+			query: "SELECT * FROM t WHERE id = ? AND big = ? AND score > ? AND active = ?",
+			args:  []string{"-42", "18446744073709551615", "0.5", "t"},
+			types: []proxy.ArgType{proxy.ArgInt, proxy.ArgUint, proxy.ArgFloat, proxy.ArgBool},
+			want:  []any{int64(-42), uint64(18446744073709551615), 0.5, true},
+		},
+		{
+			name:  "null",
+			query: "SELECT * FROM t WHERE id = $1 AND name = $2",
+			args:  []string{"NULL", ""},
+			types: []proxy.ArgType{proxy.ArgNull, proxy.ArgNull},
+			want:  []any{nil, nil},
+		},
+		{
+			name:  "text stays a string",
+			query: "SELECT * FROM t WHERE code = ?",
+			args:  []string{"0042"},
+			types: []proxy.ArgType{proxy.ArgText},
+			want:  []any{"0042"},
+		},
+		{
+			name:  "unparsable value falls back to a string",
+			query: "SELECT * FROM t WHERE id = ?",
+			args:  []string{"?"},
+			types: []proxy.ArgType{proxy.ArgInt},
+			want:  []any{"?"},
+		},
+		{
+			name:  "fewer types than args",
+			query: "SELECT * FROM t WHERE id = $1 AND name = $2",
+			args:  []string{"1", "bob"},
+			types: []proxy.ArgType{proxy.ArgInt},
+			want:  []any{int64(1), "bob"},
+		},
+		{
+			name:  "untyped timestamp still converted",
+			query: "SELECT * FROM t WHERE id = $1 AND ts > $2::TIMESTAMP",
+			args:  []string{"1", "0"},
+			types: []proxy.ArgType{proxy.ArgInt, proxy.ArgText},
+			want:  []any{int64(1), time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := explain.BuildAnyArgs(tt.query, tt.args, tt.types)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BuildAnyArgs = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package explain_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/mysql"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/mickamy/sql-tap/explain"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+const (
+	testUser     = "test"
+	testPassword = "test"
+	testDB       = "test"
+)
+
+// openPostgres launches a PostgreSQL container and returns a connection to it.
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+
+	ctx := t.Context()
+	ctr, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image: "postgres:17-alpine",
+			Env: map[string]string{
+				"POSTGRES_USER":     testUser,
+				"POSTGRES_PASSWORD": testPassword,
+				"POSTGRES_DB":       testDB,
+			},
+			ExposedPorts: []string{"5432/tcp"},
+			WaitingFor: wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30 * time.Second),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("start postgres container: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := ctr.Terminate(context.Background()); err != nil {
+			t.Logf("terminate postgres container: %v", err)
+		}
+	})
+
+	host, err := ctr.Host(ctx)
+	if err != nil {
+		t.Fatalf("get host: %v", err)
+	}
+	port, err := ctr.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatalf("get port: %v", err)
+	}
+	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", testUser, testPassword, host, port.Port(), testDB)
+	return openDB(t, "pgx", dsn)
+}
+
+// openMySQL launches a MySQL container and returns a connection to it.
+func openMySQL(t *testing.T) *sql.DB {
+	t.Helper()
+
+	ctx := t.Context()
+	ctr, err := mysql.Run(ctx, "mysql:8",
+		mysql.WithDatabase(testDB),
+		mysql.WithUsername(testUser),
+		mysql.WithPassword(testPassword),
+	)
+	if err != nil {
+		t.Fatalf("start mysql container: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := ctr.Terminate(context.Background()); err != nil {
+			t.Logf("terminate mysql container: %v", err)
+		}
+	})
+
+	dsn, err := ctr.ConnectionString(ctx)
+	if err != nil {
+		t.Fatalf("get dsn: %v", err)
+	}
+	return openDB(t, "mysql", dsn)
+}
+
+func openDB(t *testing.T, driver, dsn string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func mustExec(t *testing.T, db *sql.DB, stmts ...string) {
+	t.Helper()
+	for _, s := range stmts {
+		if _, err := db.ExecContext(t.Context(), s); err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+	}
+}
+
+func TestRunTypedArgsMySQL(t *testing.T) {
+	t.Parallel()
+
+	db := openMySQL(t)
+	mustExec(t, db,
+		"CREATE TABLE orders (id INT PRIMARY KEY AUTO_INCREMENT, code VARCHAR(16), note TEXT, KEY idx_code (code))",
+		"INSERT INTO orders (code, note) WITH RECURSIVE n (i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 500) "+
+			"SELECT CONCAT('A', i), 'x' FROM n",
+		"ANALYZE TABLE orders",
+	)
+	client := explain.NewClient(db, explain.MySQL)
+	const q = "SELECT * FROM orders WHERE code = ?"
+
+	// The application bound a number: comparing a VARCHAR column with a
+	// number converts every row, so the index cannot be used. Bound as text,
+	// EXPLAIN would show an index lookup the application never gets.
+	asText, err := client.Run(t.Context(), explain.Explain, q, []string{"42"}, nil)
+	if err != nil {
+		t.Fatalf("Run with text args: %v", err)
+	}
+	if !strings.Contains(asText.Plan, "Index lookup") {
+		t.Errorf("plan with a text arg = %q, want an index lookup", asText.Plan)
+	}
+	typed, err := client.Run(t.Context(), explain.Explain, q, []string{"42"}, []proxy.ArgType{proxy.ArgInt})
+	if err != nil {
+		t.Fatalf("Run with typed args: %v", err)
+	}
+	if strings.Contains(typed.Plan, "Index lookup") || !strings.Contains(typed.Plan, "Table scan") {
+		t.Errorf("plan with an int arg = %q, want a table scan", typed.Plan)
+	}
+}
+
+func TestRunTypedArgsPostgres(t *testing.T) {
+	t.Parallel()
+
+	db := openPostgres(t)
+	mustExec(t, db,
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT, active BOOLEAN)",
+		"INSERT INTO users SELECT i, 'user' || i, i % 2 = 0 FROM generate_series(1, 500) AS i",
+		"ANALYZE users",
+	)
+	client := explain.NewClient(db, explain.Postgres)
+	const q = "SELECT * FROM users WHERE id = $1 AND active = $2"
+
+	// The server infers the parameter types, so numbers bound as text and
+	// as numbers get the same plan.
+	asText, err := client.Run(t.Context(), explain.Explain, q, []string{"42", "1"}, nil)
+	if err != nil {
+		t.Fatalf("Run with text args: %v", err)
+	}
+	typed, err := client.Run(t.Context(), explain.Explain, q, []string{"42", "1"},
+		[]proxy.ArgType{proxy.ArgInt, proxy.ArgBool})
+	if err != nil {
+		t.Fatalf("Run with typed args: %v", err)
+	}
+	if typed.Plan != asText.Plan || !strings.Contains(typed.Plan, "Index Scan") {
+		t.Errorf("typed plan = %q, text plan = %q, want the same index scan", typed.Plan, asText.Plan)
+	}
+
+	// A NULL is captured as an empty value, which is no integer as text.
+	if _, err := client.Run(t.Context(), explain.Explain, q, []string{"", "1"}, nil); err == nil {
+		t.Error("Run with an empty text arg for an INT parameter succeeded, want a conversion error")
+	}
+	if _, err := client.Run(t.Context(), explain.Explain, q, []string{"", "1"},
+		[]proxy.ArgType{proxy.ArgNull, proxy.ArgBool}); err != nil {
+		t.Errorf("Run with a NULL arg: %v", err)
+	}
+}
+
+func TestRunAnalyzeRollsBackPostgres(t *testing.T) {
+	t.Parallel()
+
+	db := openPostgres(t)
+	mustExec(t, db, "CREATE TABLE audit (id INT PRIMARY KEY, note TEXT)")
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRowContext(t.Context(), "SELECT count(*) FROM audit").Scan(&n); err != nil {
+			t.Fatalf("count: %v", err)
+		}
+		return n
+	}
+
+	client := explain.NewClient(db, explain.Postgres)
+	res, err := client.Run(t.Context(), explain.Analyze, "INSERT INTO audit (id, note) VALUES ($1, $2)",
+		[]string{"1", "analyzed"}, []proxy.ArgType{proxy.ArgInt, proxy.ArgText})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(res.Plan, "actual time") {
+		t.Errorf("plan = %q, want actual execution statistics", res.Plan)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("%d rows after EXPLAIN ANALYZE, want the insert rolled back", n)
+	}
+
+	client.SetAnalyzeCommit(true)
+	if _, err := client.Run(t.Context(), explain.Analyze, "INSERT INTO audit (id, note) VALUES (2, 'kept')", nil, nil); err != nil {
+		t.Fatalf("Run with commit: %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("%d rows after EXPLAIN ANALYZE with SetAnalyzeCommit, want 1", n)
+	}
+}
+
+func TestRunAnalyzeRollsBackMySQL(t *testing.T) {
+	t.Parallel()
+
+	db := openMySQL(t)
+	mustExec(t, db,
+		"CREATE TABLE accounts (id INT PRIMARY KEY, balance INT)",
+		"CREATE TABLE payouts (account_id INT PRIMARY KEY, amount INT)",
+		"INSERT INTO accounts VALUES (1, 100)",
+		"INSERT INTO payouts VALUES (1, 30)",
+	)
+
+	// MySQL analyzes multi-table UPDATE and DELETE, not INSERT.
+	client := explain.NewClient(db, explain.MySQL)
+	if _, err := client.Run(t.Context(), explain.Analyze,
+		"UPDATE accounts a JOIN payouts p ON p.account_id = a.id SET a.balance = a.balance - p.amount WHERE a.id = ?",
+		[]string{"1"}, []proxy.ArgType{proxy.ArgInt}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var balance int
+	if err := db.QueryRowContext(t.Context(), "SELECT balance FROM accounts WHERE id = 1").Scan(&balance); err != nil {
+		t.Fatalf("select balance: %v", err)
+	}
+	if balance != 100 {
+		t.Errorf("balance = %d after EXPLAIN ANALYZE, want the update rolled back to 100", balance)
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 // Mode selects between EXPLAIN and EXPLAIN ANALYZE.
@@ -65,8 +68,14 @@ const (
 
 // Client wraps a database connection for running EXPLAIN queries.
 type Client struct {
-	db     *sql.DB
-	driver Driver
+	db            *sql.DB
+	driver        Driver
+	analyzeCommit bool // keep the changes of analyzed statements
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 }
 
 // NewClient creates a new Client from an existing *sql.DB.
@@ -74,18 +83,40 @@ func NewClient(db *sql.DB, driver Driver) *Client {
 	return &Client{db: db, driver: driver}
 }
 
-// Run executes EXPLAIN or EXPLAIN ANALYZE for the given query with optional args.
-func (c *Client) Run(ctx context.Context, mode Mode, query string, args []string) (*Result, error) {
-	anyArgs := buildAnyArgs(query, args)
+// SetAnalyzeCommit makes EXPLAIN ANALYZE keep the changes of the statements
+// it runs instead of rolling them back. It must be called before Run.
+func (c *Client) SetAnalyzeCommit(commit bool) {
+	c.analyzeCommit = commit
+}
+
+// Run executes EXPLAIN or EXPLAIN ANALYZE for the given query with optional
+// args. types, parallel to args, are the types the client bound the args as
+// (see buildAnyArgs); args without one are bound as text.
+//
+// EXPLAIN ANALYZE executes the statement, so unless SetAnalyzeCommit was
+// called, statements other than reads run in a transaction that is rolled
+// back, which discards their changes.
+func (c *Client) Run(ctx context.Context, mode Mode, stmt string, args []string, types []proxy.ArgType) (*Result, error) {
+	anyArgs := buildAnyArgs(stmt, args, types)
 
 	// MySQL/TiDB cannot parse placeholder ? without args; replace with NULL for plan-only EXPLAIN.
-	q := query
+	q := stmt
 	if (c.driver == MySQL || c.driver == TiDB) && len(anyArgs) == 0 {
 		q = strings.ReplaceAll(q, "?", "NULL")
 	}
 
+	var db queryer = c.db
+	if mode == Analyze && !c.analyzeCommit && query.Classify(stmt) != query.KindRead {
+		tx, err := c.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("explain: begin: %w", err)
+		}
+		defer func() { _ = tx.Rollback() }()
+		db = tx
+	}
+
 	start := time.Now()
-	rows, err := c.db.QueryContext(ctx, mode.prefix(c.driver)+q, anyArgs...)
+	rows, err := db.QueryContext(ctx, mode.prefix(c.driver)+q, anyArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("explain: query: %w", err)
 	}
@@ -135,16 +166,30 @@ var timestampCastRe = regexp.MustCompile(`(?i)\$(\d+)\s*::\s*TIMESTAMP`)
 const pgEpochUnix int64 = 946684800
 
 // buildAnyArgs converts string args to []any for use in QueryContext.
+//
+// Args typed as numbers, booleans or NULL in types are bound as such, as the
+// client bound them: bound as text, a number compared with a string column
+// can get a different plan in MySQL, or fail to convert. PostgreSQL infers
+// the parameter types from the statement when it is prepared, so typed values
+// bind to the same types as the client's did and no casts are needed. Values
+// that do not parse as their type are bound as text.
+//
 // For args whose corresponding query placeholder is cast to a timestamp type
 // (e.g. $2::TIMESTAMP WITH TIME ZONE), it tries to interpret the value as a
 // PostgreSQL binary-encoded timestamp (int64 microseconds since 2000-01-01 UTC)
 // and converts it to time.Time. This prevents the "date/time field value out of
 // range" error that occurs when a captured binary timestamp is re-used as a plain
 // string in a parameterized EXPLAIN query.
-func buildAnyArgs(query string, args []string) []any {
+func buildAnyArgs(query string, args []string, types []proxy.ArgType) []any {
 	tsParams := parseTimestampParams(query)
 	anyArgs := make([]any, len(args))
 	for i, a := range args {
+		if i < len(types) {
+			if v, ok := typedArg(a, types[i]); ok {
+				anyArgs[i] = v
+				continue
+			}
+		}
 		if tsParams[i+1] {
 			if t, ok := parsePGTimestamp(a); ok {
 				anyArgs[i] = t
@@ -156,6 +201,30 @@ func buildAnyArgs(query string, args []string) []any {
 	return anyArgs
 }
 
+// typedArg parses arg as a value of type t. It reports false for ArgText and
+// for values that do not parse.
+func typedArg(arg string, t proxy.ArgType) (any, bool) {
+	var (
+		v   any
+		err error
+	)
+	switch t {
+	case proxy.ArgNull:
+		return nil, true
+	case proxy.ArgInt:
+		v, err = strconv.ParseInt(arg, 10, 64)
+	case proxy.ArgUint:
+		v, err = strconv.ParseUint(arg, 10, 64)
+	case proxy.ArgFloat:
+		v, err = strconv.ParseFloat(arg, 64)
+	case proxy.ArgBool:
+		v, err = strconv.ParseBool(arg)
+	default:
+		return nil, false
+	}
+	return v, err == nil
+}
+
 // parseTimestampParams returns the set of 1-indexed parameter numbers that are
 // cast to a timestamp type in the query.
 func parseTimestampParams(query string) map[int]bool {
@@ -3,9 +3,17 @@ package explain
 // Exported wrappers for internal symbols used in package-external tests.
 
 var (
+	NewAutoFunc          = newAuto
 	BuildAnyArgs         = buildAnyArgs
 	ParseTimestampParams = parseTimestampParams
 	ParsePGTimestamp     = parsePGTimestamp
 )
 
 const PgEpochUnix = pgEpochUnix
+
+// Templates returns the number of templates a remembers.
+func (a *Auto) Templates() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.started)
+}
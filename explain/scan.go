@@ -0,0 +1,164 @@
+package explain
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cpuTupleCost is PostgreSQL's default planner cost of reading one row.
+const cpuTupleCost = 0.01
+
+var (
+	// pgSeqScanRe matches a Postgres "Seq Scan" node and captures its total
+	// cost and estimated rows.
+	pgSeqScanRe = regexp.MustCompile(`(?:^|-> {1,2})(?:Parallel )?Seq Scan on .*\(cost=[\d.]+\.\.([\d.]+) rows=(\d+)`)
+
+	// mysqlTableScanRe matches a MySQL FORMAT=TREE "Table scan" node and
+	// captures its estimated rows.
+	mysqlTableScanRe = regexp.MustCompile(`-> Table scan on .*\(.*rows=([\d.e+]+)`)
+)
+
+// FullScan reports whether plan, as returned by Client.Run, reads a whole
+// table estimated to hold at least minRows rows and filters them. It
+// recognizes Postgres "Seq Scan" nodes, MySQL "Table scan" nodes
+// (FORMAT=TREE) and "type: ALL" rows (tabular format), and TiDB
+// "TableFullScan" operators.
+//
+// Only filtered scans are reported, since an index on the filtered columns
+// could avoid them. A scan that keeps every row, such as an unqualified
+// SELECT or a count(*), reads the whole table by design.
+//
+// Postgres estimates the rows a scan returns rather than reads, so a
+// filtered scan of a large table is also caught by its cost, which grows by
+// cpu_tuple_cost for every row read.
+func FullScan(plan string, minRows float64) bool {
+	lines := strings.Split(plan, "\n")
+	if len(lines) > 1 && strings.Contains(lines[0], "\t") {
+		return tabularFullScan(lines, minRows)
+	}
+	for i, line := range lines {
+		if m := pgSeqScanRe.FindStringSubmatch(line); m != nil {
+			cost, _ := strconv.ParseFloat(m[1], 64)
+			rows, _ := strconv.ParseFloat(m[2], 64)
+			if (rows >= minRows || cost >= minRows*cpuTupleCost) && pgFiltered(lines, i) {
+				return true
+			}
+			continue
+		}
+		if m := mysqlTableScanRe.FindStringSubmatch(line); m != nil {
+			rows, err := strconv.ParseFloat(m[1], 64)
+			if err == nil && rows >= minRows && mysqlFiltered(lines, i) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pgFiltered reports whether the Postgres scan node at lines[i] has a
+// "Filter:" property. A scan is a leaf, so its properties are the lines
+// indented below it up to the next node.
+func pgFiltered(lines []string, i int) bool {
+	n := indent(lines[i])
+	for _, line := range lines[i+1:] {
+		trimmed := strings.TrimSpace(line)
+		if indent(line) <= n || strings.HasPrefix(trimmed, "->") {
+			break
+		}
+		if strings.HasPrefix(trimmed, "Filter:") {
+			return true
+		}
+	}
+	return false
+}
+
+// mysqlFiltered reports whether the MySQL FORMAT=TREE scan node at lines[i]
+// feeds a "Filter" node, which MySQL prints as the scan's parent.
+func mysqlFiltered(lines []string, i int) bool {
+	n := indent(lines[i])
+	for j := i - 1; j >= 0; j-- {
+		if indent(lines[j]) < n {
+			return strings.HasPrefix(strings.TrimSpace(lines[j]), "-> Filter:")
+		}
+	}
+	return false
+}
+
+// indent returns the number of leading spaces in line.
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// tabularFullScan checks a plan whose first line holds column headers: the
+// traditional MySQL format (type, rows, Extra) or TiDB's (id, estRows).
+// MySQL marks a filtered scan with "Using where"; TiDB places a Selection
+// operator above it.
+func tabularFullScan(lines []string, minRows float64) bool {
+	cols := strings.Split(lines[0], "\t")
+	typeCol, idCol, rowsCol, extraCol := -1, -1, -1, -1
+	for i, c := range cols {
+		switch strings.ToLower(c) {
+		case "type":
+			typeCol = i
+		case "id":
+			idCol = i
+		case "rows", "estrows":
+			rowsCol = i
+		case "extra":
+			extraCol = i
+		}
+	}
+	if rowsCol < 0 {
+		return false
+	}
+	for i, line := range lines[1:] {
+		vals := strings.Split(line, "\t")
+		if len(vals) != len(cols) {
+			continue
+		}
+		var filtered bool
+		switch {
+		case typeCol >= 0 && vals[typeCol] == "ALL":
+			filtered = extraCol >= 0 && strings.Contains(vals[extraCol], "Using where")
+		case idCol >= 0 && strings.Contains(vals[idCol], "TableFullScan"):
+			filtered = tidbSelected(lines[1:i+1], idCol, vals[idCol])
+		}
+		if !filtered {
+			continue
+		}
+		if rows, err := strconv.ParseFloat(vals[rowsCol], 64); err == nil && rows >= minRows {
+			return true
+		}
+	}
+	return false
+}
+
+// tidbSelected reports whether the TiDB operator id is a child of a
+// Selection operator. above holds the plan rows preceding it; the parent is
+// the nearest one with a shallower tree prefix.
+func tidbSelected(above []string, idCol int, id string) bool {
+	n := tidbDepth(id)
+	for j := len(above) - 1; j >= 0; j-- {
+		vals := strings.Split(above[j], "\t")
+		if idCol >= len(vals) {
+			continue
+		}
+		if tidbDepth(vals[idCol]) < n {
+			return strings.HasPrefix(strings.TrimLeftFunc(vals[idCol], isTreeRune), "Selection")
+		}
+	}
+	return false
+}
+
+// tidbDepth returns the width, in runes, of the tree prefix ("│ ", "└─")
+// before a TiDB operator id.
+func tidbDepth(id string) int {
+	return utf8.RuneCountInString(id) - utf8.RuneCountInString(strings.TrimLeftFunc(id, isTreeRune))
+}
+
+func isTreeRune(r rune) bool {
+	return !unicode.IsLetter(r)
+}
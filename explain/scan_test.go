@@ -0,0 +1,144 @@
+package explain_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/explain"
+)
+
+func TestFullScan(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		plan string
+		want bool
+	}{
+		{
+			name: "postgres unfiltered seq scan",
+			plan: "Seq Scan on users  (cost=0.00..1834.00 rows=100000 width=44)",
+			want: false,
+		},
+		{
+			name: "postgres filtered seq scan on a large table",
+			plan: "Seq Scan on users  (cost=0.00..2084.00 rows=1 width=44)\n" +
+				"  Filter: ((email)::text = 'a@example.com'::text)",
+			want: true,
+		},
+		{
+			name: "postgres nested parallel seq scan",
+			plan: "Gather  (cost=1000.00..12578.43 rows=1 width=44)\n" +
+				"  Workers Planned: 2\n" +
+				"  ->  Parallel Seq Scan on orders  (cost=0.00..11578.33 rows=1 width=44)\n" +
+				"        Filter: (customer_id = 42)",
+			want: true,
+		},
+		{
+			name: "postgres seq scan on a small table",
+			plan: "Seq Scan on settings  (cost=0.00..1.06 rows=1 width=36)\n" +
+				"  Filter: (key = 'theme'::text)",
+			want: false,
+		},
+		{
+			name: "postgres filter belongs to a sibling node",
+			plan: "Hash Join  (cost=3084.00..5168.00 rows=100 width=88)\n" +
+				"  Hash Cond: (o.user_id = u.id)\n" +
+				"  ->  Seq Scan on orders o  (cost=0.00..1834.00 rows=100000 width=44)\n" +
+				"  ->  Hash  (cost=2084.00..2084.00 rows=1 width=44)\n" +
+				"        ->  Index Scan using users_pkey on users u  (cost=0.29..8.31 rows=1 width=44)\n" +
+				"              Filter: (active)",
+			want: false,
+		},
+		{
+			name: "postgres index scan",
+			plan: "Index Scan using users_pkey on users  (cost=0.29..8.31 rows=1 width=44)\n" +
+				"  Index Cond: (id = 1)",
+			want: false,
+		},
+		{
+			name: "mysql tree table scan",
+			plan: "-> Filter: (users.email = 'a@example.com')  (cost=10087 rows=9970)\n" +
+				"    -> Table scan on users  (cost=10087 rows=99696)",
+			want: true,
+		},
+		{
+			name: "mysql tree table scan in exponent notation",
+			plan: "-> Filter: (events.kind = 'click')  (cost=201612 rows=199000)\n" +
+				"    -> Table scan on events  (cost=201612 rows=1.99e+6)",
+			want: true,
+		},
+		{
+			name: "mysql tree unfiltered table scan",
+			plan: "-> Table scan on events  (cost=201612 rows=1.99e+6)",
+			want: false,
+		},
+		{
+			name: "mysql tree table scan on a small table",
+			plan: "-> Filter: (settings.k = 'theme')  (cost=0.75 rows=1)\n" +
+				"    -> Table scan on settings  (cost=0.75 rows=5)",
+			want: false,
+		},
+		{
+			name: "mysql tree index lookup",
+			plan: "-> Index lookup on users using idx_email (email='a@example.com')  (cost=0.35 rows=1)",
+			want: false,
+		},
+		{
+			name: "mysql tabular type ALL",
+			plan: "id\tselect_type\ttable\tpartitions\ttype\tpossible_keys\tkey\tkey_len\tref\trows\tfiltered\tExtra\n" +
+				"1\tSIMPLE\tusers\t\tALL\t\t\t\t\t99696\t10.00\tUsing where",
+			want: true,
+		},
+		{
+			name: "mysql tabular type ALL without a where clause",
+			plan: "id\tselect_type\ttable\tpartitions\ttype\tpossible_keys\tkey\tkey_len\tref\trows\tfiltered\tExtra\n" +
+				"1\tSIMPLE\tusers\t\tALL\t\t\t\t\t99696\t100.00\t",
+			want: false,
+		},
+		{
+			name: "mysql tabular ref",
+			plan: "id\tselect_type\ttable\tpartitions\ttype\tpossible_keys\tkey\tkey_len\tref\trows\tfiltered\tExtra\n" +
+				"1\tSIMPLE\tusers\t\tref\tidx_email\tidx_email\t1022\tconst\t1\t100.00\t",
+			want: false,
+		},
+		{
+			name: "tidb table full scan",
+			plan: "id\testRows\ttask\taccess object\toperator info\n" +
+				"TableReader_7\t10.00\troot\t\tdata:Selection_6\n" +
+				"└─Selection_6\t10.00\tcop[tikv]\t\teq(test.users.email, \"a@example.com\")\n" +
+				"  └─TableFullScan_5\t10000.00\tcop[tikv]\ttable:users\tkeep order:false",
+			want: true,
+		},
+		{
+			name: "tidb unfiltered table full scan",
+			plan: "id\testRows\ttask\taccess object\toperator info\n" +
+				"TableReader_5\t10000.00\troot\t\tdata:TableFullScan_4\n" +
+				"└─TableFullScan_4\t10000.00\tcop[tikv]\ttable:users\tkeep order:false",
+			want: false,
+		},
+		{
+			name: "tidb selection over a sibling",
+			plan: "id\testRows\ttask\taccess object\toperator info\n" +
+				"HashJoin_8\t10000.00\troot\t\tinner join, equal:[eq(test.o.user_id, test.u.id)]\n" +
+				"├─TableReader_11(Build)\t10.00\troot\t\tdata:Selection_10\n" +
+				"│ └─Selection_10\t10.00\tcop[tikv]\t\teq(test.u.active, 1)\n" +
+				"│   └─TableFullScan_9\t100.00\tcop[tikv]\ttable:u\tkeep order:false\n" +
+				"└─TableReader_13(Probe)\t10000.00\troot\t\tdata:TableFullScan_12\n" +
+				"  └─TableFullScan_12\t10000.00\tcop[tikv]\ttable:o\tkeep order:false",
+			want: false,
+		},
+		{
+			name: "empty plan",
+			plan: "",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := explain.FullScan(tt.plan, 1000); got != tt.want {
+				t.Errorf("FullScan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -37,8 +37,27 @@ type QueryEvent struct {
 	NPlus_1         bool                   `protobuf:"varint,10,opt,name=n_plus_1,json=nPlus1,proto3" json:"n_plus_1,omitempty"`
 	NormalizedQuery string                 `protobuf:"bytes,11,opt,name=normalized_query,json=normalizedQuery,proto3" json:"normalized_query,omitempty"`
 	SlowQuery       bool                   `protobuf:"varint,12,opt,name=slow_query,json=slowQuery,proto3" json:"slow_query,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	ReadOnly        bool                   `protobuf:"varint,13,opt,name=read_only,json=readOnly,proto3" json:"read_only,omitempty"`
+	StmtName        string                 `protobuf:"bytes,14,opt,name=stmt_name,json=stmtName,proto3" json:"stmt_name,omitempty"`
+	InFlight        bool                   `protobuf:"varint,15,opt,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`
+	BatchSize       int32                  `protobuf:"varint,16,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	ResultColumns   int32                  `protobuf:"varint,17,opt,name=result_columns,json=resultColumns,proto3" json:"result_columns,omitempty"`
+	Session         map[string]string      `protobuf:"bytes,18,rep,name=session,proto3" json:"session,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Plan            string                 `protobuf:"bytes,19,opt,name=plan,proto3" json:"plan,omitempty"`
+	FullScan        bool                   `protobuf:"varint,20,opt,name=full_scan,json=fullScan,proto3" json:"full_scan,omitempty"`
+	Warnings        int32                  `protobuf:"varint,21,opt,name=warnings,proto3" json:"warnings,omitempty"`
+	CopyBytes       int64                  `protobuf:"varint,22,opt,name=copy_bytes,json=copyBytes,proto3" json:"copy_bytes,omitempty"`
+	Kind            int32                  `protobuf:"varint,23,opt,name=kind,proto3" json:"kind,omitempty"`
+	TxFailed        bool                   `protobuf:"varint,24,opt,name=tx_failed,json=txFailed,proto3" json:"tx_failed,omitempty"`
+	// Types of args as bound by the client (see proxy.ArgType), empty if unknown.
+	ArgTypes []string `protobuf:"bytes,25,rep,name=arg_types,json=argTypes,proto3" json:"arg_types,omitempty"`
+	// Republishes the event with the same id, with more detail such as its
+	// plan. Clients replace that event rather than add this one.
+	Update bool `protobuf:"varint,26,opt,name=update,proto3" json:"update,omitempty"`
+	// Lowercased keyword that starts the statement (see query.Verb).
+	Verb          string `protobuf:"bytes,27,opt,name=verb,proto3" json:"verb,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *QueryEvent) Reset() {
@@ -155,6 +174,111 @@ func (x *QueryEvent) GetSlowQuery() bool {
 	return false
 }
 
+func (x *QueryEvent) GetReadOnly() bool {
+	if x != nil {
+		return x.ReadOnly
+	}
+	return false
+}
+
+func (x *QueryEvent) GetStmtName() string {
+	if x != nil {
+		return x.StmtName
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetInFlight() bool {
+	if x != nil {
+		return x.InFlight
+	}
+	return false
+}
+
+func (x *QueryEvent) GetBatchSize() int32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+func (x *QueryEvent) GetResultColumns() int32 {
+	if x != nil {
+		return x.ResultColumns
+	}
+	return 0
+}
+
+func (x *QueryEvent) GetSession() map[string]string {
+	if x != nil {
+		return x.Session
+	}
+	return nil
+}
+
+func (x *QueryEvent) GetPlan() string {
+	if x != nil {
+		return x.Plan
+	}
+	return ""
+}
+
+func (x *QueryEvent) GetFullScan() bool {
+	if x != nil {
+		return x.FullScan
+	}
+	return false
+}
+
+func (x *QueryEvent) GetWarnings() int32 {
+	if x != nil {
+		return x.Warnings
+	}
+	return 0
+}
+
+func (x *QueryEvent) GetCopyBytes() int64 {
+	if x != nil {
+		return x.CopyBytes
+	}
+	return 0
+}
+
+func (x *QueryEvent) GetKind() int32 {
+	if x != nil {
+		return x.Kind
+	}
+	return 0
+}
+
+func (x *QueryEvent) GetTxFailed() bool {
+	if x != nil {
+		return x.TxFailed
+	}
+	return false
+}
+
+func (x *QueryEvent) GetArgTypes() []string {
+	if x != nil {
+		return x.ArgTypes
+	}
+	return nil
+}
+
+func (x *QueryEvent) GetUpdate() bool {
+	if x != nil {
+		return x.Update
+	}
+	return false
+}
+
+func (x *QueryEvent) GetVerb() string {
+	if x != nil {
+		return x.Verb
+	}
+	return ""
+}
+
 type WatchRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -192,8 +316,11 @@ func (*WatchRequest) Descriptor() ([]byte, []int) {
 }
 
 type WatchResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Event         *QueryEvent            `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Event *QueryEvent            `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+	// Number of events this stream has missed so far because the proxy's
+	// buffer or the stream's own subscriber buffer was full.
+	Dropped       uint64 `protobuf:"varint,2,opt,name=dropped,proto3" json:"dropped,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -235,11 +362,20 @@ func (x *WatchResponse) GetEvent() *QueryEvent {
 	return nil
 }
 
+func (x *WatchResponse) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
 type ExplainRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Query         string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
-	Args          []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
-	Analyze       bool                   `protobuf:"varint,3,opt,name=analyze,proto3" json:"analyze,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Query   string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Args    []string               `protobuf:"bytes,2,rep,name=args,proto3" json:"args,omitempty"`
+	Analyze bool                   `protobuf:"varint,3,opt,name=analyze,proto3" json:"analyze,omitempty"`
+	// Types to bind args as (see proxy.ArgType); args are bound as text without.
+	ArgTypes      []string `protobuf:"bytes,4,rep,name=arg_types,json=argTypes,proto3" json:"arg_types,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -295,6 +431,13 @@ func (x *ExplainRequest) GetAnalyze() bool {
 	return false
 }
 
+func (x *ExplainRequest) GetArgTypes() []string {
+	if x != nil {
+		return x.ArgTypes
+	}
+	return nil
+}
+
 type ExplainResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Plan          string                 `protobuf:"bytes,1,opt,name=plan,proto3" json:"plan,omitempty"`
@@ -339,11 +482,128 @@ func (x *ExplainResponse) GetPlan() string {
 	return ""
 }
 
+type ServerInfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerInfoRequest) Reset() {
+	*x = ServerInfoRequest{}
+	mi := &file_tap_v1_tap_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerInfoRequest) ProtoMessage() {}
+
+func (x *ServerInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tap_v1_tap_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerInfoRequest.ProtoReflect.Descriptor instead.
+func (*ServerInfoRequest) Descriptor() ([]byte, []int) {
+	return file_tap_v1_tap_proto_rawDescGZIP(), []int{5}
+}
+
+type ServerInfoResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Database driver sql-tapd proxies: "postgres", "mysql" or "tidb".
+	Driver string `protobuf:"bytes,1,opt,name=driver,proto3" json:"driver,omitempty"`
+	// Server version from the handshake of the latest proxied connection;
+	// empty until a client has connected.
+	Version string `protobuf:"bytes,2,opt,name=version,proto3" json:"version,omitempty"`
+	// Whether the latest connection negotiated TLS or protocol compression.
+	Tls         bool `protobuf:"varint,3,opt,name=tls,proto3" json:"tls,omitempty"`
+	Compression bool `protobuf:"varint,4,opt,name=compression,proto3" json:"compression,omitempty"`
+	// Window of sql-tapd's N+1 detection; unset if detection is off.
+	Nplus1Window  *durationpb.Duration `protobuf:"bytes,5,opt,name=nplus1_window,json=nplus1Window,proto3" json:"nplus1_window,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerInfoResponse) Reset() {
+	*x = ServerInfoResponse{}
+	mi := &file_tap_v1_tap_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerInfoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerInfoResponse) ProtoMessage() {}
+
+func (x *ServerInfoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tap_v1_tap_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerInfoResponse.ProtoReflect.Descriptor instead.
+func (*ServerInfoResponse) Descriptor() ([]byte, []int) {
+	return file_tap_v1_tap_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ServerInfoResponse) GetDriver() string {
+	if x != nil {
+		return x.Driver
+	}
+	return ""
+}
+
+func (x *ServerInfoResponse) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *ServerInfoResponse) GetTls() bool {
+	if x != nil {
+		return x.Tls
+	}
+	return false
+}
+
+func (x *ServerInfoResponse) GetCompression() bool {
+	if x != nil {
+		return x.Compression
+	}
+	return false
+}
+
+func (x *ServerInfoResponse) GetNplus1Window() *durationpb.Duration {
+	if x != nil {
+		return x.Nplus1Window
+	}
+	return nil
+}
+
 var File_tap_v1_tap_proto protoreflect.FileDescriptor
 
 const file_tap_v1_tap_proto_rawDesc = "" +
 	"\n" +
-	"\x10tap/v1/tap.proto\x12\x06tap.v1\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/duration.proto\"\xfc\x02\n" +
+	"\x10tap/v1/tap.proto\x12\x06tap.v1\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/duration.proto\"\xf6\x06\n" +
 	"\n" +
 	"QueryEvent\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x0e\n" +
@@ -360,20 +620,51 @@ const file_tap_v1_tap_proto_rawDesc = "" +
 	" \x01(\bR\x06nPlus1\x12)\n" +
 	"\x10normalized_query\x18\v \x01(\tR\x0fnormalizedQuery\x12\x1d\n" +
 	"\n" +
-	"slow_query\x18\f \x01(\bR\tslowQuery\"\x0e\n" +
-	"\fWatchRequest\"9\n" +
+	"slow_query\x18\f \x01(\bR\tslowQuery\x12\x1b\n" +
+	"\tread_only\x18\r \x01(\bR\breadOnly\x12\x1b\n" +
+	"\tstmt_name\x18\x0e \x01(\tR\bstmtName\x12\x1b\n" +
+	"\tin_flight\x18\x0f \x01(\bR\binFlight\x12\x1d\n" +
+	"\n" +
+	"batch_size\x18\x10 \x01(\x05R\tbatchSize\x12%\n" +
+	"\x0eresult_columns\x18\x11 \x01(\x05R\rresultColumns\x129\n" +
+	"\asession\x18\x12 \x03(\v2\x1f.tap.v1.QueryEvent.SessionEntryR\asession\x12\x12\n" +
+	"\x04plan\x18\x13 \x01(\tR\x04plan\x12\x1b\n" +
+	"\tfull_scan\x18\x14 \x01(\bR\bfullScan\x12\x1a\n" +
+	"\bwarnings\x18\x15 \x01(\x05R\bwarnings\x12\x1d\n" +
+	"\n" +
+	"copy_bytes\x18\x16 \x01(\x03R\tcopyBytes\x12\x12\n" +
+	"\x04kind\x18\x17 \x01(\x05R\x04kind\x12\x1b\n" +
+	"\ttx_failed\x18\x18 \x01(\bR\btxFailed\x12\x1b\n" +
+	"\targ_types\x18\x19 \x03(\tR\bargTypes\x12\x16\n" +
+	"\x06update\x18\x1a \x01(\bR\x06update\x12\x12\n" +
+	"\x04verb\x18\x1b \x01(\tR\x04verb\x1a:\n" +
+	"\fSessionEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x0e\n" +
+	"\fWatchRequest\"S\n" +
 	"\rWatchResponse\x12(\n" +
-	"\x05event\x18\x01 \x01(\v2\x12.tap.v1.QueryEventR\x05event\"T\n" +
+	"\x05event\x18\x01 \x01(\v2\x12.tap.v1.QueryEventR\x05event\x12\x18\n" +
+	"\adropped\x18\x02 \x01(\x04R\adropped\"q\n" +
 	"\x0eExplainRequest\x12\x14\n" +
 	"\x05query\x18\x01 \x01(\tR\x05query\x12\x12\n" +
 	"\x04args\x18\x02 \x03(\tR\x04args\x12\x18\n" +
-	"\aanalyze\x18\x03 \x01(\bR\aanalyze\"%\n" +
+	"\aanalyze\x18\x03 \x01(\bR\aanalyze\x12\x1b\n" +
+	"\targ_types\x18\x04 \x03(\tR\bargTypes\"%\n" +
 	"\x0fExplainResponse\x12\x12\n" +
-	"\x04plan\x18\x01 \x01(\tR\x04plan2\x80\x01\n" +
+	"\x04plan\x18\x01 \x01(\tR\x04plan\"\x13\n" +
+	"\x11ServerInfoRequest\"\xba\x01\n" +
+	"\x12ServerInfoResponse\x12\x16\n" +
+	"\x06driver\x18\x01 \x01(\tR\x06driver\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\tR\aversion\x12\x10\n" +
+	"\x03tls\x18\x03 \x01(\bR\x03tls\x12 \n" +
+	"\vcompression\x18\x04 \x01(\bR\vcompression\x12>\n" +
+	"\rnplus1_window\x18\x05 \x01(\v2\x19.google.protobuf.DurationR\fnplus1Window2\xc5\x01\n" +
 	"\n" +
 	"TapService\x126\n" +
 	"\x05Watch\x12\x14.tap.v1.WatchRequest\x1a\x15.tap.v1.WatchResponse0\x01\x12:\n" +
-	"\aExplain\x12\x16.tap.v1.ExplainRequest\x1a\x17.tap.v1.ExplainResponseB|\n" +
+	"\aExplain\x12\x16.tap.v1.ExplainRequest\x1a\x17.tap.v1.ExplainResponse\x12C\n" +
+	"\n" +
+	"ServerInfo\x12\x19.tap.v1.ServerInfoRequest\x1a\x1a.tap.v1.ServerInfoResponseB|\n" +
 	"\n" +
 	"com.tap.v1B\bTapProtoP\x01Z+github.com/mickamy/sql-tap/gen/tap/v1;tapv1\xa2\x02\x03TXX\xaa\x02\x06Tap.V1\xca\x02\x06Tap\\V1\xe2\x02\x12Tap\\V1\\GPBMetadata\xea\x02\aTap::V1b\x06proto3"
 
@@ -389,29 +680,36 @@ func file_tap_v1_tap_proto_rawDescGZIP() []byte {
 	return file_tap_v1_tap_proto_rawDescData
 }
 
-var file_tap_v1_tap_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_tap_v1_tap_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_tap_v1_tap_proto_goTypes = []any{
 	(*QueryEvent)(nil),            // 0: tap.v1.QueryEvent
 	(*WatchRequest)(nil),          // 1: tap.v1.WatchRequest
 	(*WatchResponse)(nil),         // 2: tap.v1.WatchResponse
 	(*ExplainRequest)(nil),        // 3: tap.v1.ExplainRequest
 	(*ExplainResponse)(nil),       // 4: tap.v1.ExplainResponse
-	(*timestamppb.Timestamp)(nil), // 5: google.protobuf.Timestamp
-	(*durationpb.Duration)(nil),   // 6: google.protobuf.Duration
+	(*ServerInfoRequest)(nil),     // 5: tap.v1.ServerInfoRequest
+	(*ServerInfoResponse)(nil),    // 6: tap.v1.ServerInfoResponse
+	nil,                           // 7: tap.v1.QueryEvent.SessionEntry
+	(*timestamppb.Timestamp)(nil), // 8: google.protobuf.Timestamp
+	(*durationpb.Duration)(nil),   // 9: google.protobuf.Duration
 }
 var file_tap_v1_tap_proto_depIdxs = []int32{
-	5, // 0: tap.v1.QueryEvent.start_time:type_name -> google.protobuf.Timestamp
-	6, // 1: tap.v1.QueryEvent.duration:type_name -> google.protobuf.Duration
-	0, // 2: tap.v1.WatchResponse.event:type_name -> tap.v1.QueryEvent
-	1, // 3: tap.v1.TapService.Watch:input_type -> tap.v1.WatchRequest
-	3, // 4: tap.v1.TapService.Explain:input_type -> tap.v1.ExplainRequest
-	2, // 5: tap.v1.TapService.Watch:output_type -> tap.v1.WatchResponse
-	4, // 6: tap.v1.TapService.Explain:output_type -> tap.v1.ExplainResponse
-	5, // [5:7] is the sub-list for method output_type
-	3, // [3:5] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	8, // 0: tap.v1.QueryEvent.start_time:type_name -> google.protobuf.Timestamp
+	9, // 1: tap.v1.QueryEvent.duration:type_name -> google.protobuf.Duration
+	7, // 2: tap.v1.QueryEvent.session:type_name -> tap.v1.QueryEvent.SessionEntry
+	0, // 3: tap.v1.WatchResponse.event:type_name -> tap.v1.QueryEvent
+	9, // 4: tap.v1.ServerInfoResponse.nplus1_window:type_name -> google.protobuf.Duration
+	1, // 5: tap.v1.TapService.Watch:input_type -> tap.v1.WatchRequest
+	3, // 6: tap.v1.TapService.Explain:input_type -> tap.v1.ExplainRequest
+	5, // 7: tap.v1.TapService.ServerInfo:input_type -> tap.v1.ServerInfoRequest
+	2, // 8: tap.v1.TapService.Watch:output_type -> tap.v1.WatchResponse
+	4, // 9: tap.v1.TapService.Explain:output_type -> tap.v1.ExplainResponse
+	6, // 10: tap.v1.TapService.ServerInfo:output_type -> tap.v1.ServerInfoResponse
+	8, // [8:11] is the sub-list for method output_type
+	5, // [5:8] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
 }
 
 func init() { file_tap_v1_tap_proto_init() }
@@ -425,7 +723,7 @@ func file_tap_v1_tap_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tap_v1_tap_proto_rawDesc), len(file_tap_v1_tap_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
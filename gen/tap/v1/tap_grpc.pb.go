@@ -19,8 +19,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TapService_Watch_FullMethodName   = "/tap.v1.TapService/Watch"
-	TapService_Explain_FullMethodName = "/tap.v1.TapService/Explain"
+	TapService_Watch_FullMethodName      = "/tap.v1.TapService/Watch"
+	TapService_Explain_FullMethodName    = "/tap.v1.TapService/Explain"
+	TapService_ServerInfo_FullMethodName = "/tap.v1.TapService/ServerInfo"
 )
 
 // TapServiceClient is the client API for TapService service.
@@ -29,6 +30,7 @@ const (
 type TapServiceClient interface {
 	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchResponse], error)
 	Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainResponse, error)
+	ServerInfo(ctx context.Context, in *ServerInfoRequest, opts ...grpc.CallOption) (*ServerInfoResponse, error)
 }
 
 type tapServiceClient struct {
@@ -68,12 +70,23 @@ func (c *tapServiceClient) Explain(ctx context.Context, in *ExplainRequest, opts
 	return out, nil
 }
 
+func (c *tapServiceClient) ServerInfo(ctx context.Context, in *ServerInfoRequest, opts ...grpc.CallOption) (*ServerInfoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ServerInfoResponse)
+	err := c.cc.Invoke(ctx, TapService_ServerInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TapServiceServer is the server API for TapService service.
 // All implementations must embed UnimplementedTapServiceServer
 // for forward compatibility.
 type TapServiceServer interface {
 	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchResponse]) error
 	Explain(context.Context, *ExplainRequest) (*ExplainResponse, error)
+	ServerInfo(context.Context, *ServerInfoRequest) (*ServerInfoResponse, error)
 	mustEmbedUnimplementedTapServiceServer()
 }
 
@@ -90,6 +103,9 @@ func (UnimplementedTapServiceServer) Watch(*WatchRequest, grpc.ServerStreamingSe
 func (UnimplementedTapServiceServer) Explain(context.Context, *ExplainRequest) (*ExplainResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Explain not implemented")
 }
+func (UnimplementedTapServiceServer) ServerInfo(context.Context, *ServerInfoRequest) (*ServerInfoResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ServerInfo not implemented")
+}
 func (UnimplementedTapServiceServer) mustEmbedUnimplementedTapServiceServer() {}
 func (UnimplementedTapServiceServer) testEmbeddedByValue()                    {}
 
@@ -140,6 +156,24 @@ func _TapService_Explain_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TapService_ServerInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ServerInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TapServiceServer).ServerInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TapService_ServerInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TapServiceServer).ServerInfo(ctx, req.(*ServerInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TapService_ServiceDesc is the grpc.ServiceDesc for TapService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -151,6 +185,10 @@ var TapService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Explain",
 			Handler:    _TapService_Explain_Handler,
 		},
+		{
+			MethodName: "ServerInfo",
+			Handler:    _TapService_ServerInfo_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -2,8 +2,10 @@ package highlight
 
 import (
 	"bytes"
+	"os"
 	"regexp"
 	"strings"
+	"sync/atomic"
 
 	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters"
@@ -15,19 +17,75 @@ import (
 var (
 	lexer     chroma.Lexer
 	formatter chroma.Formatter
-	style     *chroma.Style
 )
 
+// DefaultStyle is the chroma style used unless SetStyle picks another.
+const DefaultStyle = "monokai"
+
+// NoStyle is the SetStyle name that turns highlighting off.
+const NoStyle = "none"
+
+// style is the chroma style SQL uses; nil after SetStyle(NoStyle).
+var style atomic.Pointer[chroma.Style]
+
+// enabled reports whether SQL and Plan emit ANSI sequences. It starts out
+// disabled when the NO_COLOR environment variable is set (https://no-color.org).
+var enabled atomic.Bool
+
 func init() {
 	lexer = lexers.Get("sql")
 	formatter = formatters.Get("terminal256")
-	style = styles.Get("monokai")
+	style.Store(styles.Get(DefaultStyle))
+	enabled.Store(envEnabled())
+}
+
+// envEnabled reports whether the environment allows color.
+func envEnabled() bool {
+	return os.Getenv("NO_COLOR") == ""
+}
+
+// SetEnabled turns highlighting on or off. While off, SQL and Plan return
+// their input unchanged.
+func SetEnabled(on bool) {
+	enabled.Store(on)
+}
+
+// Enabled reports whether highlighting is on.
+func Enabled() bool {
+	return enabled.Load() && style.Load() != nil
+}
+
+// SetStyle selects the chroma style SQL is highlighted with by name, e.g.
+// "github" or "solarized-light" for light terminals. NoStyle turns
+// highlighting off; an unknown name falls back to DefaultStyle. It reports
+// whether name was known.
+func SetStyle(name string) bool {
+	name = strings.TrimSpace(name)
+	if strings.EqualFold(name, NoStyle) {
+		style.Store(nil)
+		return true
+	}
+	for n, st := range styles.Registry {
+		if strings.EqualFold(n, name) {
+			style.Store(st)
+			return true
+		}
+	}
+	style.Store(styles.Get(DefaultStyle))
+	return false
+}
+
+// StyleNames returns the names SetStyle accepts besides NoStyle.
+func StyleNames() []string {
+	return styles.Names()
 }
 
 // SQL returns the input with ANSI terminal syntax highlighting applied.
-// On error or empty input, the original string is returned unchanged.
+// On error, empty input or with highlighting off, the original string is
+// returned unchanged.
 func SQL(s string) string {
-	if s == "" {
+	st := style.Load()
+	if s == "" || !enabled.Load() || st == nil {
 		return s
 	}
 
@@ -37,7 +95,7 @@ func SQL(s string) string {
 	}
 
 	var buf bytes.Buffer
-	if err := formatter.Format(&buf, style, iterator); err != nil {
+	if err := formatter.Format(&buf, st, iterator); err != nil {
 		return s
 	}
 
@@ -54,9 +112,14 @@ var (
 			`LockRows|SetOp|ModifyTable|` +
 			`Table scan|Index lookup|Covering index|Full scan|ref|range|ALL|index|const)\b`,
 	)
-	metricsRe = regexp.MustCompile(`\((?:cost|actual time|loops|width|never executed)[^)]*\)`)
+	metricsRe = regexp.MustCompile(`\((?:cost=|actual |rows=|loops=|width=|never executed)[^)]*\)`)
 	arrowRe   = regexp.MustCompile(`->`)
-	summaryRe = regexp.MustCompile(`(?i)^\s*(Planning Time|Execution Time|Query time):`)
+	// mysqlNodeRe matches a MySQL EXPLAIN FORMAT=TREE node line, "-> " and a
+	// label ended by " on ", " using ", ":" or an opening parenthesis, e.g.
+	// "-> Index lookup on o using idx_user (user_id=u.id)  (cost=0.35 rows=1)".
+	// Postgres puts two spaces after its arrows, so its lines do not match.
+	mysqlNodeRe = regexp.MustCompile(`^(\s*)-> (\S.*?)((?:\s+on\s|\s+using\s|:|\s*\().*)?$`)
+	summaryRe   = regexp.MustCompile(`(?i)^\s*(Planning Time|Execution Time|Query time):`)
 
 	boldStyle = lipgloss.NewStyle().Bold(true)
 	dimStyle  = lipgloss.NewStyle().Faint(true)
@@ -64,8 +127,10 @@ var (
 
 // Plan returns the EXPLAIN output with ANSI highlighting applied.
 // Node names are bold, metrics are dim, arrows are dim, and summary lines are bold.
+// With highlighting off, including by SetStyle(NoStyle), the original string is
+// returned unchanged.
 func Plan(s string) string {
-	if s == "" {
+	if s == "" || !Enabled() {
 		return s
 	}
 
@@ -76,6 +141,14 @@ func Plan(s string) string {
 			continue
 		}
 
+		if m := mysqlNodeRe.FindStringSubmatch(line); m != nil {
+			rest := metricsRe.ReplaceAllStringFunc(m[3], func(m string) string {
+				return dimStyle.Render(m)
+			})
+			lines[i] = m[1] + dimStyle.Render("->") + " " + boldStyle.Render(m[2]) + rest
+			continue
+		}
+
 		line = arrowRe.ReplaceAllStringFunc(line, func(m string) string {
 			return dimStyle.Render(m)
 		})
@@ -0,0 +1,204 @@
+package highlight
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+const samplePlan = `Seq Scan on users  (cost=0.00..35.50 rows=2550 width=4)
+  ->  Index Scan using users_pkey on users  (cost=0.15..8.17 rows=1 width=4)
+Planning Time: 0.050 ms`
+
+func TestSQL_Enabled(t *testing.T) { //nolint:paralleltest // toggles package-level state
+	SetEnabled(true)
+	t.Cleanup(func() { SetEnabled(envEnabled()) })
+
+	if got := SQL("SELECT 1"); !strings.Contains(got, "\x1b[") {
+		t.Errorf("SQL() = %q, want ANSI sequences", got)
+	}
+}
+
+func TestDisabled(t *testing.T) { //nolint:paralleltest // toggles package-level state
+	SetEnabled(false)
+	t.Cleanup(func() { SetEnabled(envEnabled()) })
+
+	tests := []struct {
+		name string
+		fn   func(string) string
+		in   string
+	}{
+		{name: "SQL", fn: SQL, in: "SELECT id, name FROM users WHERE id = $1 -- comment"},
+		{name: "Plan", fn: Plan, in: samplePlan},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { //nolint:paralleltest // see above
+			got := tt.fn(tt.in)
+			if strings.ContainsRune(got, '\x1b') {
+				t.Errorf("%s() = %q, want no ANSI sequences", tt.name, got)
+			}
+			if got != tt.in {
+				t.Errorf("%s() = %q, want input unchanged", tt.name, got)
+			}
+		})
+	}
+}
+
+func TestEnvEnabled(t *testing.T) { //nolint:paralleltest // t.Setenv is incompatible with t.Parallel
+	tests := []struct {
+		name    string
+		noColor string
+		want    bool
+	}{
+		{name: "unset", noColor: "", want: true},
+		{name: "set", noColor: "1", want: false},
+		{name: "any value", noColor: "false", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			if got := envEnabled(); got != tt.want {
+				t.Errorf("envEnabled() with NO_COLOR=%q = %v, want %v", tt.noColor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetStyle(t *testing.T) { //nolint:paralleltest // toggles package-level state
+	SetEnabled(true)
+	t.Cleanup(func() {
+		SetStyle(DefaultStyle)
+		SetEnabled(envEnabled())
+	})
+
+	const q = "SELECT id FROM users WHERE name = 'a'"
+	SetStyle(DefaultStyle)
+	monokai := SQL(q)
+
+	tests := []struct {
+		name      string
+		style     string
+		wantKnown bool
+		check     func(t *testing.T, got string)
+	}{
+		{
+			name:      "known style",
+			style:     "github",
+			wantKnown: true,
+			check: func(t *testing.T, got string) {
+				if !strings.Contains(got, "\x1b[") || got == monokai {
+					t.Errorf("SQL() = %q, want ANSI sequences other than monokai's", got)
+				}
+			},
+		},
+		{
+			name:      "case and spaces are ignored",
+			style:     " GitHub ",
+			wantKnown: true,
+			check: func(t *testing.T, got string) {
+				if got == monokai {
+					t.Errorf("SQL() = %q, want the github style", got)
+				}
+			},
+		},
+		{
+			name:      "unknown style falls back to monokai",
+			style:     "no-such-style",
+			wantKnown: false,
+			check: func(t *testing.T, got string) {
+				if got != monokai {
+					t.Errorf("SQL() = %q, want monokai output %q", got, monokai)
+				}
+			},
+		},
+		{
+			name:      "none disables highlighting",
+			style:     NoStyle,
+			wantKnown: true,
+			check: func(t *testing.T, got string) {
+				if got != q {
+					t.Errorf("SQL() = %q, want input unchanged", got)
+				}
+				if plan := Plan(samplePlan); plan != samplePlan {
+					t.Errorf("Plan() = %q, want input unchanged", plan)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { //nolint:paralleltest // see above
+			if got := SetStyle(tt.style); got != tt.wantKnown {
+				t.Errorf("SetStyle(%q) = %v, want %v", tt.style, got, tt.wantKnown)
+			}
+			tt.check(t, SQL(q))
+		})
+	}
+}
+
+func TestPlan_MySQLTree(t *testing.T) { //nolint:paralleltest // toggles package-level state
+	SetEnabled(true)
+	profile := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI)
+	t.Cleanup(func() {
+		lipgloss.SetColorProfile(profile)
+		SetEnabled(envEnabled())
+	})
+
+	const (
+		arrow = "\x1b[2m->\x1b[0m"
+		bold  = "\x1b[1m%s\x1b[0m"
+		dim   = "\x1b[2m%s\x1b[0m"
+	)
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "join with cost and actual time",
+			line: "-> Nested loop inner join  (cost=4.70 rows=10) (actual time=0.05..0.08 rows=10 loops=1)",
+			want: arrow + " " + fmt.Sprintf(bold, "Nested loop inner join") + "  " +
+				fmt.Sprintf(dim, "(cost=4.70 rows=10)") + " " +
+				fmt.Sprintf(dim, "(actual time=0.05..0.08 rows=10 loops=1)"),
+		},
+		{
+			name: "table scan",
+			line: "    -> Table scan on u  (cost=1.25 rows=10)",
+			want: "    " + arrow + " " + fmt.Sprintf(bold, "Table scan") + " on u  " +
+				fmt.Sprintf(dim, "(cost=1.25 rows=10)"),
+		},
+		{
+			name: "index range scan",
+			line: "-> Index range scan on o using PRIMARY over (10 < id)  (cost=2.01 rows=9)",
+			want: arrow + " " + fmt.Sprintf(bold, "Index range scan") + " on o using PRIMARY over (10 < id)  " +
+				fmt.Sprintf(dim, "(cost=2.01 rows=9)"),
+		},
+		{
+			name: "filter condition is not an annotation",
+			line: "-> Filter: (u.rows > 5)  (cost=1.25 rows=3)",
+			want: arrow + " " + fmt.Sprintf(bold, "Filter") + ": (u.rows > 5)  " +
+				fmt.Sprintf(dim, "(cost=1.25 rows=3)"),
+		},
+		{
+			name: "bare label",
+			line: "        -> Hash",
+			want: "        " + arrow + " " + fmt.Sprintf(bold, "Hash"),
+		},
+		{
+			name: "postgres node keeps its own highlighting",
+			line: "  ->  Hash Join  (cost=1.00..2.00 rows=1 width=4)",
+			want: "  " + arrow + "  " + fmt.Sprintf(bold, "Hash Join") + "  " +
+				fmt.Sprintf(dim, "(cost=1.00..2.00 rows=1 width=4)"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { //nolint:paralleltest // see above
+			if got := Plan(tt.line); got != tt.want {
+				t.Errorf("Plan(%q)\n got %q\nwant %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -6,11 +6,21 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+	"github.com/muesli/termenv"
+	"google.golang.org/grpc"
 
 	"github.com/mickamy/sql-tap/ci"
+	"github.com/mickamy/sql-tap/dial"
+	"github.com/mickamy/sql-tap/dump"
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/highlight"
+	"github.com/mickamy/sql-tap/tail"
 	"github.com/mickamy/sql-tap/tui"
 )
 
@@ -19,13 +29,28 @@ var version = "dev"
 func main() {
 	fs := flag.NewFlagSet("sql-tap", flag.ExitOnError)
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "sql-tap — Watch SQL traffic in real-time\n\nUsage:\n  sql-tap [flags] <addr>\n\nFlags:\n")
+		fmt.Fprintf(os.Stderr, "sql-tap — Watch SQL traffic in real-time\n\nUsage:\n  sql-tap [flags] <addr>\n  sql-tap -load <file>\n\nFlags:\n")
 		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr,
+			"\nEnvironment:\n  SQLTAP_TOKEN      token to send to a sql-tapd started with -auth-token\n"+
+				"  SQLTAP_CLIPBOARD  set to osc52 to copy through the terminal (e.g. over SSH)\n"+
+				"  SQLTAP_THEME      syntax highlighting theme when -theme is not set\n"+
+				"  NO_COLOR          disable colored output, like -no-color\n")
 	}
 
 	showVersion := fs.Bool("version", false, "show version and exit")
 	ciMode := fs.Bool("ci", false,
 		"run in CI mode: collect events until SIGTERM/SIGINT or stream ends, then report and exit")
+	tailMode := fs.Bool("tail", false, "print events as one-line log entries instead of starting the TUI")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	noMouse := fs.Bool("no-mouse", false, "leave the mouse to the terminal, e.g. to select text, instead of scrolling and clicking")
+	theme := fs.String("theme", "", `syntax highlighting theme, a chroma style name or "none" (default: monokai)`)
+	exportDir := fs.String("export-dir", "", "directory to write exports to (default: current directory)")
+	exportName := fs.String("export-name", "sql-tap", "base filename for exports, followed by a timestamp")
+	loadFile := fs.String("load", "", "open a .tapdump file in the TUI instead of connecting to sql-tapd")
+	showRows := fs.Bool("rows", false, "show rows affected by writes in the list (toggle with R)")
+	useTLS := fs.Bool("tls", false, "connect to sql-tapd over TLS, verifying its certificate against the system roots")
+	caFile := fs.String("ca", "", "connect over TLS, verifying sql-tapd's certificate against this PEM file")
 
 	_ = fs.Parse(os.Args[1:])
 
@@ -34,37 +59,117 @@ func main() {
 		return
 	}
 
+	if *noColor {
+		highlight.SetEnabled(false)
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	if *theme == "" {
+		*theme = os.Getenv("SQLTAP_THEME")
+	}
+	if *theme != "" && !highlight.SetStyle(*theme) {
+		fmt.Fprintf(os.Stderr, "unknown theme %q, using %s (available: %s)\n",
+			*theme, highlight.DefaultStyle, strings.Join(highlight.StyleNames(), ", "))
+	}
+
+	opts := tui.Options{ExportDir: *exportDir, ExportName: *exportName, ShowRows: *showRows}
+
+	if *loadFile != "" {
+		events, err := loadDump(*loadFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		opts.Events = events
+		monitor("", opts, !*noMouse)
+		return
+	}
+
 	if fs.NArg() < 1 {
 		fs.Usage()
 		os.Exit(1)
 	}
 
+	dialOpts, err := dial.Options(dial.Config{TLS: *useTLS, CA: *caFile})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.DialOptions = dialOpts
+
 	addr := fs.Arg(0)
-	if *ciMode {
-		runCI(addr)
-	} else {
-		monitor(addr)
+	switch {
+	case *ciMode:
+		runCI(addr, dialOpts)
+	case *tailMode:
+		runTail(addr, *noColor, dialOpts)
+	default:
+		monitor(addr, opts, !*noMouse)
 	}
 }
 
-func monitor(addr string) {
-	m := tui.New(addr)
-	p := tea.NewProgram(m, tea.WithAltScreen())
+// monitor runs the TUI, capturing the mouse if mouse is set.
+func monitor(addr string, opts tui.Options, mouse bool) {
+	m := tui.New(addr, opts)
+	progOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if mouse {
+		progOpts = append(progOpts, tea.WithMouseCellMotion())
+	}
+	p := tea.NewProgram(m, progOpts...)
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func runCI(addr string) {
-	os.Exit(runCIExitCode(addr))
+// loadDump reads the events of a .tapdump file written by the TUI.
+func loadDump(path string) ([]*tapv1.QueryEvent, error) {
+	f, err := os.Open(path) //nolint:gosec // path is given by the user
+	if err != nil {
+		return nil, fmt.Errorf("open dump: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	records, err := dump.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	events := make([]*tapv1.QueryEvent, 0, len(records))
+	for _, r := range records {
+		ev, err := r.Proto()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func runTail(addr string, noColor bool, dialOpts []grpc.DialOption) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	opts := tail.Options{NoColor: noColor, DialOptions: dialOpts}
+	if term.IsTerminal(os.Stdout.Fd()) {
+		if w, _, err := term.GetSize(os.Stdout.Fd()); err == nil {
+			opts.Width = w
+		}
+	}
+
+	if err := tail.Run(ctx, addr, os.Stdout, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runCI(addr string, dialOpts []grpc.DialOption) {
+	os.Exit(runCIExitCode(addr, dialOpts))
 }
 
-func runCIExitCode(addr string) int {
+func runCIExitCode(addr string, dialOpts []grpc.DialOption) int {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	result, err := ci.Run(ctx, addr)
+	result, err := ci.Run(ctx, addr, dialOpts...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
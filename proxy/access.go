@@ -0,0 +1,56 @@
+package proxy
+
+import "github.com/mickamy/sql-tap/query"
+
+// AccessTracker follows the transaction access mode (READ ONLY / READ WRITE)
+// of a single connection so that events can be stamped as read-only.
+// It is not safe for concurrent use; each connection owns its own tracker.
+type AccessTracker struct {
+	session bool  // session default set via SET SESSION ... READ ONLY
+	tx      bool  // access mode of the active transaction
+	next    *bool // SET TRANSACTION issued outside a transaction; applies to the next one
+}
+
+// Begin records the start of a transaction by the given statement and
+// reports whether the new transaction is read-only.
+func (t *AccessTracker) Begin(sql string) bool {
+	t.tx = t.session
+	if t.next != nil {
+		t.tx = *t.next
+		t.next = nil
+	}
+	if a, ok := query.ParseAccess(sql); ok {
+		t.tx = a.ReadOnly
+	}
+	return t.tx
+}
+
+// End records the end of the active transaction and reports whether it was read-only.
+func (t *AccessTracker) End() bool {
+	ro := t.tx
+	t.tx = false
+	return ro
+}
+
+// Observe inspects a statement executed inside (inTx) or outside a transaction,
+// applies any access-mode change it requests, and reports whether the
+// statement runs read-only.
+func (t *AccessTracker) Observe(sql string, inTx bool) bool {
+	if a, ok := query.ParseAccess(sql); ok {
+		switch a.Scope {
+		case query.AccessScopeTx:
+			if inTx {
+				t.tx = a.ReadOnly
+			} else {
+				ro := a.ReadOnly
+				t.next = &ro
+			}
+		case query.AccessScopeSession:
+			t.session = a.ReadOnly
+		}
+	}
+	if inTx {
+		return t.tx
+	}
+	return t.session
+}
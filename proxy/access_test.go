@@ -0,0 +1,75 @@
+package proxy_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestAccessTracker(t *testing.T) {
+	t.Parallel()
+
+	t.Run("begin read only marks tx events", func(t *testing.T) {
+		t.Parallel()
+
+		var tr proxy.AccessTracker
+		if !tr.Begin("START TRANSACTION READ ONLY") {
+			t.Fatal("Begin() = false, want true")
+		}
+		if !tr.Observe("SELECT 1", true) {
+			t.Error("statement in read-only tx not marked")
+		}
+		if !tr.End() {
+			t.Error("End() = false, want true")
+		}
+		if tr.Observe("SELECT 1", false) {
+			t.Error("statement after tx end still marked read-only")
+		}
+	})
+
+	t.Run("session characteristics apply to later transactions", func(t *testing.T) {
+		t.Parallel()
+
+		var tr proxy.AccessTracker
+		tr.Observe("SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY", false)
+		if !tr.Begin("BEGIN") {
+			t.Error("tx after session read-only not marked")
+		}
+		tr.End()
+		if tr.Begin("BEGIN READ WRITE") {
+			t.Error("explicit READ WRITE should override session default")
+		}
+		tr.End()
+		tr.Observe("SET transaction_read_only = 0", false)
+		if tr.Begin("BEGIN") {
+			t.Error("tx after session reset still marked read-only")
+		}
+	})
+
+	t.Run("set transaction outside tx applies to next tx only", func(t *testing.T) {
+		t.Parallel()
+
+		var tr proxy.AccessTracker
+		tr.Observe("SET TRANSACTION READ ONLY", false)
+		if !tr.Begin("BEGIN") {
+			t.Error("next tx not marked read-only")
+		}
+		tr.End()
+		if tr.Begin("BEGIN") {
+			t.Error("SET TRANSACTION leaked into a later tx")
+		}
+	})
+
+	t.Run("set transaction inside tx", func(t *testing.T) {
+		t.Parallel()
+
+		var tr proxy.AccessTracker
+		tr.Begin("BEGIN")
+		if !tr.Observe("SET TRANSACTION READ ONLY", true) {
+			t.Error("SET TRANSACTION inside tx not applied")
+		}
+		if !tr.Observe("SELECT 1", true) {
+			t.Error("subsequent statement not marked read-only")
+		}
+	})
+}
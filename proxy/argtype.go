@@ -0,0 +1,44 @@
+package proxy
+
+// ArgType is the kind of value a client bound a statement argument as. Args
+// are captured as text; the type lets them be bound again as the client sent
+// them, e.g. for EXPLAIN, where a number bound as text can be planned
+// differently or fail to cast.
+type ArgType string
+
+const (
+	ArgText  ArgType = ""      // text, or a type bound as its text form
+	ArgInt   ArgType = "int"   // signed integer
+	ArgUint  ArgType = "uint"  // unsigned integer (MySQL)
+	ArgFloat ArgType = "float" // floating-point number
+	ArgBool  ArgType = "bool"
+	ArgNull  ArgType = "null" // NULL, whatever the parameter type
+)
+
+// ParseArgTypes converts the names of types received over the API or read
+// from a dump to ArgTypes. Names it does not know are treated as ArgText.
+func ParseArgTypes(names []string) []ArgType {
+	if len(names) == 0 {
+		return nil
+	}
+	types := make([]ArgType, len(names))
+	for i, n := range names {
+		switch t := ArgType(n); t {
+		case ArgInt, ArgUint, ArgFloat, ArgBool, ArgNull:
+			types[i] = t
+		}
+	}
+	return types
+}
+
+// ArgTypeNames returns the names of types, the inverse of ParseArgTypes.
+func ArgTypeNames(types []ArgType) []string {
+	if len(types) == 0 {
+		return nil
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return names
+}
@@ -9,18 +9,22 @@ import (
 	"io"
 	"math"
 	"net"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 // MySQL binary protocol field types.
 const (
+	mysqlTypeDecimal    byte = 0x00
 	mysqlTypeTiny       byte = 0x01
 	mysqlTypeShort      byte = 0x02
 	mysqlTypeLong       byte = 0x03
@@ -31,24 +35,77 @@ const (
 	mysqlTypeInt24      byte = 0x09
 	mysqlTypeYear       byte = 0x0d
 	mysqlTypeVarchar    byte = 0x0f
+	mysqlTypeBit        byte = 0x10
+	mysqlTypeJSON       byte = 0xf5
 	mysqlTypeBlob       byte = 0xfc
 	mysqlTypeVarString  byte = 0xfd
 	mysqlTypeString     byte = 0xfe
 	mysqlTypeNewDecimal byte = 0xf6
 )
 
+// paramUnsigned is set in the flags byte of a parameter type descriptor
+// bound as an unsigned integer.
+const paramUnsigned byte = 0x80
+
 // preparedStmt holds the query and parameter count for a prepared statement.
 type preparedStmt struct {
 	query     string
 	numParams int
+	// paramTypes holds the parameter type descriptors (type and flags byte
+	// per parameter) last sent with COM_STMT_EXECUTE. Clients send them only
+	// when rebinding, so later executions reuse these.
+	paramTypes []byte
+	// longData holds the values sent with COM_STMT_SEND_LONG_DATA since the
+	// last execution, by parameter index. Such values are left out of the
+	// COM_STMT_EXECUTE packet.
+	longData map[int]longValue
+}
+
+// maxLongDataArg is the size up to which a value sent with
+// COM_STMT_SEND_LONG_DATA is kept as an arg. Larger values, typically
+// BLOB uploads, are summarized so that events stay small.
+const maxLongDataArg = 4 << 10
+
+// longValue is a value sent with COM_STMT_SEND_LONG_DATA: its size, and its
+// bytes as long as it fits in maxLongDataArg.
+type longValue struct {
+	data []byte
+	size int
+}
+
+// add appends a chunk of the value, dropping the bytes once it outgrows
+// maxLongDataArg.
+func (v longValue) add(chunk []byte) longValue {
+	v.size += len(chunk)
+	if v.size > maxLongDataArg {
+		v.data = nil
+	} else {
+		v.data = append(v.data, chunk...)
+	}
+	return v
+}
+
+// arg returns the value as an arg: its text, or a summary such as
+// "<blob 1048576 bytes>" past maxLongDataArg.
+func (v longValue) arg() string {
+	if v.size > maxLongDataArg {
+		return fmt.Sprintf("<blob %d bytes>", v.size)
+	}
+	return string(v.data)
 }
 
 // MySQL command bytes.
 const (
-	comQuery       byte = 0x03
-	comStmtPrepare byte = 0x16
-	comStmtExecute byte = 0x17
-	comStmtClose   byte = 0x19
+	comQuit             byte = 0x01
+	comInitDB           byte = 0x02
+	comQuery            byte = 0x03
+	comPing             byte = 0x0e
+	comChangeUser       byte = 0x11
+	comStmtPrepare      byte = 0x16
+	comStmtExecute      byte = 0x17
+	comStmtSendLongData byte = 0x18
+	comStmtClose        byte = 0x19
+	comStmtReset        byte = 0x1a
 )
 
 // MySQL response packet type indicators (first byte of payload).
@@ -56,12 +113,32 @@ const (
 	iOK  byte = 0x00
 	iERR byte = 0xFF
 	iEOF byte = 0xFE
+
+	iAuthMoreData byte = 0x01
+)
+
+// sha2FastAuthSuccess follows iAuthMoreData when caching_sha2_password
+// accepts a cached password.
+const sha2FastAuthSuccess byte = 0x03
+
+// MySQL server status flags, reported in OK and EOF packets.
+const (
+	serverStatusInTrans    uint16 = 0x0001
+	serverStatusAutocommit uint16 = 0x0002
+	// serverSessionStateChanged marks an OK packet carrying session state
+	// changes, sent to clients with clientSessionTrack.
+	serverSessionStateChanged uint16 = 0x4000
 )
 
+// sessionTrackSchema is the type of a session state change reporting a new
+// default schema, e.g. after USE.
+const sessionTrackSchema byte = 0x01
+
 // MySQL capability flags.
 const (
 	clientCompress            uint32 = 1 << 5
 	clientSSL                 uint32 = 1 << 11
+	clientSessionTrack        uint32 = 1 << 23
 	clientDeprecateEOF        uint32 = 1 << 24
 	clientZstdCompressionAlgo uint32 = 1 << 26
 	clientQueryAttributes     uint32 = 1 << 27
@@ -76,41 +153,60 @@ const (
 	stateColumnDefs                // reading column definitions
 	stateRowData                   // reading result set rows
 	stateSkipPrepare               // skipping param/column def packets after StmtPrepareOK
+	stateChangeUser                // relaying re-authentication after COM_CHANGE_USER
 )
 
 // conn manages bidirectional relay and protocol parsing for a single MySQL connection.
 type conn struct {
 	clientConn   net.Conn
 	upstreamConn net.Conn
-	events       chan<- proxy.Event
+	events       chan proxy.Event
+	overflow     proxy.Overflow
+	dropped      *atomic.Uint64 // the proxy's count of events dropped by emitEvent
+	// resultColumns enables recording the column count of result sets.
+	resultColumns bool
 
 	preparedStmts map[uint32]preparedStmt
 	lastCommand   byte
 	lastQuery     string
 	lastStmtID    uint32
 
-	activeTxID string
-	nextID     uint64
+	// activeTxID, access and autocommitOff are guarded by mu: they are set
+	// from the client's statements and corrected from the server's status flags.
+	activeTxID    string
+	access        proxy.AccessTracker
+	autocommitOff bool // SET autocommit=0: statements open implicit transactions
+
+	// sessionTrack is set when the client negotiated clientSessionTrack: OK
+	// packets may then end with session state changes.
+	sessionTrack bool
 
-	state       responseState
-	skipPackets int // remaining param/column def packets to skip after StmtPrepareOK
+	state       responseState // written through setState
+	skipPackets int           // remaining param/column def packets to skip after StmtPrepareOK
+	// responding mirrors state != stateIdle for other goroutines.
+	responding atomic.Bool
+	// draining is set by drain: the conn closes as soon as it is idle.
+	draining atomic.Bool
+
+	// onHandshake, if set, receives the server info once authentication
+	// succeeds.
+	onHandshake func(proxy.ServerInfo)
 
 	mu      sync.Mutex
-	pending *proxy.Event
+	pending *proxy.Pending // statement awaiting its response, guarded by mu
+	session query.Session  // session variables changed by SET statements
 }
 
-func newConn(clientConn, upstreamConn net.Conn, events chan<- proxy.Event) *conn {
-	return &conn{
+func newConn(clientConn, upstreamConn net.Conn, events chan proxy.Event) *conn {
+	c := &conn{
 		clientConn:    clientConn,
 		upstreamConn:  upstreamConn,
 		events:        events,
+		dropped:       new(atomic.Uint64),
 		preparedStmts: make(map[uint32]preparedStmt),
 	}
-}
-
-func (c *conn) generateID() string {
-	c.nextID++
-	return strconv.FormatUint(c.nextID, 10)
+	c.pending = proxy.NewPending(&c.mu, c.emitEvent)
+	return c
 }
 
 // ---------------- packet I/O ----------------
@@ -221,6 +317,19 @@ func clearCapabilityBits(pkt []byte, bits uint32) {
 	binary.LittleEndian.PutUint16(payload[upperOff:upperOff+2], upper)
 }
 
+// greetingVersion returns the server version of a server greeting
+// (HandshakeV10) payload, or "" if it is malformed.
+func greetingVersion(payload []byte) string {
+	if len(payload) < 2 {
+		return ""
+	}
+	version, _, ok := bytes.Cut(payload[1:], []byte{0x00})
+	if !ok {
+		return ""
+	}
+	return string(version)
+}
+
 // clearClientCapabilityBits clears the given capability bits in a client handshake response.
 // The capability flags are the first 4 bytes of the payload.
 func clearClientCapabilityBits(pkt []byte, bits uint32) {
@@ -249,6 +358,12 @@ func (c *conn) relayStartup() error {
 	if err != nil {
 		return fmt.Errorf("mysql: read greeting: %w", err)
 	}
+	if payloadByte(greeting) == iERR {
+		// The server refused the connection outright, e.g. host not allowed.
+		_ = writePacket(c.clientConn, greeting)
+		return fmt.Errorf("mysql: upstream refused connection: %s", parseErrPacket(greeting[4:]))
+	}
+	info := proxy.ServerInfo{Version: greetingVersion(greeting[4:])}
 	clearCapabilityBits(greeting, stripCaps)
 	if err := writePacket(c.clientConn, greeting); err != nil {
 		return fmt.Errorf("mysql: send greeting: %w", err)
@@ -259,7 +374,16 @@ func (c *conn) relayStartup() error {
 	if err != nil {
 		return fmt.Errorf("mysql: read handshake response: %w", err)
 	}
+	// What the client asked for, before the proxy turns it down.
+	if len(resp) >= 8 {
+		caps := binary.LittleEndian.Uint32(resp[4:8])
+		info.TLS = caps&clientSSL != 0
+		info.Compression = caps&(clientCompress|clientZstdCompressionAlgo) != 0
+	}
 	clearClientCapabilityBits(resp, stripCaps)
+	if len(resp) >= 8 {
+		c.sessionTrack = binary.LittleEndian.Uint32(resp[4:8])&clientSessionTrack != 0
+	}
 	if err := writePacket(c.upstreamConn, resp); err != nil {
 		return fmt.Errorf("mysql: send handshake response: %w", err)
 	}
@@ -276,17 +400,26 @@ func (c *conn) relayStartup() error {
 
 		switch payloadByte(pkt) {
 		case iOK:
+			if c.onHandshake != nil {
+				c.onHandshake(info)
+			}
 			return nil
 		case iERR:
-			return errors.New("mysql: auth error from upstream")
-		case 0x01: // AuthMoreData
-			// caching_sha2_password fast auth success: server sends [0x01, 0x03],
-			// then follows with OK. No client response needed.
-			payload := pkt[4:]
-			if len(payload) >= 2 && payload[1] == 0x03 {
+			return fmt.Errorf("mysql: auth error from upstream: %s", parseErrPacket(pkt[4:]))
+		case iAuthMoreData:
+			// caching_sha2_password fast auth success: the server follows with
+			// OK, and the client sends nothing.
+			if bytes.Equal(pkt[4:], []byte{iAuthMoreData, sha2FastAuthSuccess}) {
 				continue
 			}
-			// Full auth needed (e.g. 0x04): fall through to read client response.
+			// Any other AuthMoreData awaits a client response. Without TLS
+			// (CLIENT_SSL is stripped above), full authentication (0x04) makes
+			// the client either send its password RSA-encrypted with a public
+			// key it already has, or request the server's key with 0x02; the
+			// key then arrives as another AuthMoreData, answered with the
+			// encrypted password. sha256_password exchanges its key the same
+			// way. Each step is relayed unchanged, since the password is
+			// encrypted for the server, not the proxy.
 		}
 
 		// Auth switch or other auth continuation: read client response and forward.
@@ -316,6 +449,7 @@ func (c *conn) relay(ctx context.Context) error {
 	_ = c.upstreamConn.Close()
 	<-errCh
 
+	c.pending.Abort()
 	return err
 }
 
@@ -366,6 +500,35 @@ func (c *conn) relayUpstreamToClient(ctx context.Context) error {
 			}
 			return fmt.Errorf("mysql: send to client: %w", err)
 		}
+		if c.draining.Load() && c.idle() {
+			return nil
+		}
+	}
+}
+
+// setState moves the response parser to s.
+func (c *conn) setState(s responseState) {
+	c.state = s
+	c.responding.Store(s != stateIdle)
+}
+
+// idle reports whether no command awaits a response and no transaction is
+// open, so that closing the connection loses nothing.
+func (c *conn) idle() bool {
+	if c.responding.Load() {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending.Event() == nil && c.activeTxID == ""
+}
+
+// drain makes the conn close once it is idle: right away if it is, or else
+// after relaying the response that makes it so.
+func (c *conn) drain() {
+	c.draining.Store(true)
+	if c.idle() {
+		_ = c.clientConn.Close()
 	}
 }
 
@@ -375,6 +538,11 @@ func (c *conn) captureClientPacket(pkt []byte) {
 	if payloadLen(pkt) < 1 {
 		return
 	}
+	// Auth responses during COM_CHANGE_USER are opaque and must not be
+	// mistaken for commands.
+	if c.state == stateChangeUser {
+		return
+	}
 	cmd := payloadByte(pkt)
 	payload := pkt[4:]
 
@@ -383,50 +551,86 @@ func (c *conn) captureClientPacket(pkt []byte) {
 		q := string(payload[1:])
 		c.lastCommand = comQuery
 		c.lastQuery = q
-		c.state = stateFirstResp
+		c.setState(stateFirstResp)
 
+		c.mu.Lock()
 		r := c.detectTx(q, proxy.OpQuery)
+		c.mu.Unlock()
 		ev := proxy.Event{
-			ID:        c.generateID(),
+			ID:        proxy.NewEventID(),
 			Op:        r.op,
 			Query:     q,
 			StartTime: time.Now(),
 			TxID:      r.txID,
+			ReadOnly:  r.readOnly,
 		}
-		c.mu.Lock()
-		c.pending = &ev
-		c.mu.Unlock()
+		c.pending.Set(&ev)
 
 	case comStmtPrepare:
 		q := string(payload[1:])
 		c.lastCommand = comStmtPrepare
 		c.lastQuery = q
-		c.state = stateFirstResp
+		c.setState(stateFirstResp)
 
 	case comStmtExecute:
 		c.lastCommand = comStmtExecute
-		c.state = stateFirstResp
+		c.setState(stateFirstResp)
 
 		if len(payload) >= 5 {
 			stmtID := binary.LittleEndian.Uint32(payload[1:5])
 			c.lastStmtID = stmtID
-			stmt := c.preparedStmts[stmtID]
+			stmt, known := c.preparedStmts[stmtID]
 			c.lastQuery = stmt.query
 
-			args := parseStmtExecuteArgs(payload, stmt.numParams)
+			args, argTypes, types := parseStmtExecuteArgs(payload, stmt.numParams, stmt.paramTypes, stmt.longData)
+			if known {
+				if types != nil {
+					stmt.paramTypes = types
+				}
+				// The server discards long data once the statement runs.
+				stmt.longData = nil
+				c.preparedStmts[stmtID] = stmt
+			}
 
+			c.mu.Lock()
 			r := c.detectTx(stmt.query, proxy.OpExecute)
+			c.mu.Unlock()
 			ev := proxy.Event{
-				ID:        c.generateID(),
+				ID:        proxy.NewEventID(),
 				Op:        r.op,
 				Query:     stmt.query,
 				Args:      args,
+				ArgTypes:  argTypes,
 				StartTime: time.Now(),
 				TxID:      r.txID,
+				ReadOnly:  r.readOnly,
+			}
+			c.pending.Set(&ev)
+		}
+
+	case comStmtSendLongData:
+		// Sends no response. Chunks for the same parameter are appended.
+		if len(payload) >= 7 {
+			stmtID := binary.LittleEndian.Uint32(payload[1:5])
+			param := int(binary.LittleEndian.Uint16(payload[5:7]))
+			if stmt, ok := c.preparedStmts[stmtID]; ok && param < stmt.numParams {
+				if stmt.longData == nil {
+					stmt.longData = make(map[int]longValue)
+				}
+				stmt.longData[param] = stmt.longData[param].add(payload[7:])
+				c.preparedStmts[stmtID] = stmt
+			}
+		}
+
+	case comStmtReset:
+		c.lastCommand = comStmtReset
+		c.setState(stateFirstResp)
+		if len(payload) >= 5 {
+			stmtID := binary.LittleEndian.Uint32(payload[1:5])
+			if stmt, ok := c.preparedStmts[stmtID]; ok {
+				stmt.longData = nil
+				c.preparedStmts[stmtID] = stmt
 			}
-			c.mu.Lock()
-			c.pending = &ev
-			c.mu.Unlock()
 		}
 
 	case comStmtClose:
@@ -434,9 +638,44 @@ func (c *conn) captureClientPacket(pkt []byte) {
 			stmtID := binary.LittleEndian.Uint32(payload[1:5])
 			delete(c.preparedStmts, stmtID)
 		}
+
+	case comPing:
+		// Answered with an OK, which must not complete a statement.
+		c.lastCommand = comPing
+		c.setState(stateFirstResp)
+
+	case comInitDB:
+		// Answered with an OK, which may report the new schema.
+		c.lastCommand = comInitDB
+		c.setState(stateFirstResp)
+
+	case comQuit:
+		// The server closes the connection without a response.
+		c.lastCommand = comQuit
+		c.setState(stateIdle)
+
+	case comChangeUser:
+		// The server drops prepared statements and rolls back any open
+		// transaction when the user changes, then runs a fresh auth exchange.
+		c.lastCommand = comChangeUser
+		c.resetSession()
+		c.setState(stateChangeUser)
 	}
 }
 
+// resetSession clears per-connection state that the server discards on COM_CHANGE_USER.
+func (c *conn) resetSession() {
+	clear(c.preparedStmts)
+	c.lastQuery = ""
+	c.lastStmtID = 0
+	c.mu.Lock()
+	c.activeTxID = ""
+	c.access = proxy.AccessTracker{}
+	c.autocommitOff = false
+	c.session = nil
+	c.mu.Unlock()
+}
+
 // ---------------- upstream capture (state machine) ----------------
 
 func (c *conn) captureUpstreamPacket(pkt []byte) {
@@ -449,22 +688,30 @@ func (c *conn) captureUpstreamPacket(pkt []byte) {
 
 	case stateColumnDefs:
 		if isEOFPacket(pkt) {
-			c.state = stateRowData
+			c.setState(stateRowData)
 		}
 
 	case stateRowData:
 		if isEOFPacket(pkt) {
 			c.finalizeResultSet(pkt)
-			c.state = stateIdle
+			c.setState(stateIdle)
 		} else if payloadByte(pkt) == iERR {
 			c.finalizeError(pkt)
-			c.state = stateIdle
+			c.setState(stateIdle)
 		}
 
 	case stateSkipPrepare:
 		c.skipPackets--
 		if c.skipPackets <= 0 {
-			c.state = stateIdle
+			c.setState(stateIdle)
+		}
+
+	case stateChangeUser:
+		// Auth switch and AuthMoreData packets are relayed untouched; the
+		// client's replies bypass capture until the exchange ends.
+		switch payloadByte(pkt) {
+		case iOK, iERR:
+			c.setState(stateIdle)
 		}
 	}
 }
@@ -476,11 +723,11 @@ func (c *conn) handleFirstResponse(pkt []byte) {
 	case first == iOK && c.lastCommand != comStmtPrepare:
 		// OK packet for a non-prepare command.
 		c.finalizeOK(pkt)
-		c.state = stateIdle
+		c.setState(stateIdle)
 
 	case first == iERR:
 		c.finalizeError(pkt)
-		c.state = stateIdle
+		c.setState(stateIdle)
 
 	case first == iOK && c.lastCommand == comStmtPrepare:
 		// COM_STMT_PREPARE_OK response.
@@ -488,7 +735,14 @@ func (c *conn) handleFirstResponse(pkt []byte) {
 
 	default:
 		// Column count packet: transition to reading column definitions.
-		c.state = stateColumnDefs
+		if n, size := readLenEncInt(pkt[4:], 0); size > 0 && c.resultColumns {
+			c.mu.Lock()
+			if ev := c.pending.Event(); ev != nil {
+				ev.ResultColumns = int(n) //nolint:gosec // column count is at most 4096
+			}
+			c.mu.Unlock()
+		}
+		c.setState(stateColumnDefs)
 	}
 }
 
@@ -496,7 +750,7 @@ func (c *conn) handleStmtPrepareOK(pkt []byte) {
 	payload := pkt[4:]
 	// COM_STMT_PREPARE_OK: status(1) + stmt_id(4) + num_columns(2) + num_params(2) + reserved(1) + warning_count(2)
 	if len(payload) < 12 {
-		c.state = stateIdle
+		c.setState(stateIdle)
 		return
 	}
 
@@ -516,21 +770,31 @@ func (c *conn) handleStmtPrepareOK(pkt []byte) {
 	}
 	c.skipPackets = skip
 	if skip > 0 {
-		c.state = stateSkipPrepare
+		c.setState(stateSkipPrepare)
 	} else {
-		c.state = stateIdle
+		c.setState(stateIdle)
 	}
 }
 
 func (c *conn) finalizeOK(pkt []byte) {
 	c.mu.Lock()
-	ev := c.pending
-	c.pending = nil
+	ev := c.pending.Take()
+	status, warnings, ok := okStatus(pkt)
+	if ok && c.sessionTrack && status&serverSessionStateChanged != 0 {
+		if schema, found := okSchema(pkt); found {
+			c.session = c.session.Set("database", schema)
+		}
+	}
+	proxy.TrackSession(&c.session, ev, true)
+	if ok {
+		c.applyServerStatus(ev, status)
+	}
 	c.mu.Unlock()
 	if ev == nil {
 		return
 	}
 	ev.Duration = time.Since(ev.StartTime)
+	ev.Warnings = int(warnings)
 
 	// Parse affected_rows from OK packet.
 	payload := pkt[4:]
@@ -544,40 +808,147 @@ func (c *conn) finalizeOK(pkt []byte) {
 
 func (c *conn) finalizeError(pkt []byte) {
 	c.mu.Lock()
-	ev := c.pending
-	c.pending = nil
+	ev := c.pending.Take()
+	proxy.TrackSession(&c.session, ev, false)
 	c.mu.Unlock()
 	if ev == nil {
 		return
 	}
 	ev.Duration = time.Since(ev.StartTime)
 
-	// Parse error message: ERR_Packet = 0xFF + errno(2) + '#' + sqlstate(5) + message
-	payload := pkt[4:]
-	if len(payload) > 9 && payload[3] == '#' {
-		ev.Error = string(payload[9:])
-	} else if len(payload) > 3 {
-		ev.Error = string(payload[3:])
-	}
+	ev.Error = parseErrPacket(pkt[4:]).message
 
 	c.emitEvent(*ev)
 }
 
-func (c *conn) finalizeResultSet(_ []byte) {
+// errPacket is a parsed ERR_Packet.
+type errPacket struct {
+	code    uint16
+	state   string // empty if the server sent no SQL state
+	message string
+}
+
+// parseErrPacket parses an ERR_Packet payload:
+// 0xFF + errno(2) + ['#' + sqlstate(5)] + message.
+func parseErrPacket(payload []byte) errPacket {
+	var e errPacket
+	if len(payload) < 3 {
+		return e
+	}
+	e.code = binary.LittleEndian.Uint16(payload[1:3])
+	if len(payload) >= 9 && payload[3] == '#' {
+		e.state = string(payload[4:9])
+		e.message = string(payload[9:])
+	} else {
+		e.message = string(payload[3:])
+	}
+	return e
+}
+
+// String formats the error the way the mysql client prints it.
+func (e errPacket) String() string {
+	if e.state == "" {
+		return fmt.Sprintf("ERROR %d: %s", e.code, e.message)
+	}
+	return fmt.Sprintf("ERROR %d (%s): %s", e.code, e.state, e.message)
+}
+
+func (c *conn) finalizeResultSet(pkt []byte) {
 	c.mu.Lock()
-	ev := c.pending
-	c.pending = nil
+	ev := c.pending.Take()
+	proxy.TrackSession(&c.session, ev, true)
+	status, warnings, ok := eofStatus(pkt)
+	if ok {
+		c.applyServerStatus(ev, status)
+	}
 	c.mu.Unlock()
 	if ev == nil {
 		return
 	}
 	ev.Duration = time.Since(ev.StartTime)
+	ev.Warnings = int(warnings)
 
-	// Parse affected_rows from EOF packet (which has status flags but no row count).
+	// The EOF packet has status flags and warnings but no row count.
 	// For SELECT, rows affected is typically 0.
 	c.emitEvent(*ev)
 }
 
+// okStatus returns the server status flags and warning count of an OK packet:
+// 0x00 + affected_rows(lenenc) + last_insert_id(lenenc) + status_flags(2) + warnings(2).
+// Old servers may omit the warning count.
+func okStatus(pkt []byte) (status, warnings uint16, ok bool) {
+	payload := pkt[4:]
+	off := 1
+	for range 2 {
+		_, n := readLenEncInt(payload, off)
+		if n == 0 {
+			return 0, 0, false
+		}
+		off += n
+	}
+	if off+2 > len(payload) {
+		return 0, 0, false
+	}
+	status = binary.LittleEndian.Uint16(payload[off : off+2])
+	if off+4 <= len(payload) {
+		warnings = binary.LittleEndian.Uint16(payload[off+2 : off+4])
+	}
+	return status, warnings, true
+}
+
+// okSchema returns the default schema among the session state changes that
+// end an OK packet when the client negotiated clientSessionTrack and the
+// status flags include serverSessionStateChanged:
+// ... + warnings(2) + info(lenenc str) + state_changes(lenenc str).
+// The changes are entries of type(1) + data(lenenc str); the data of a
+// sessionTrackSchema entry is the schema name as a lenenc str.
+func okSchema(pkt []byte) (string, bool) {
+	payload := pkt[4:]
+	off := 1
+	for range 2 {
+		_, n := readLenEncInt(payload, off)
+		if n == 0 {
+			return "", false
+		}
+		off += n
+	}
+	off += 4 // status_flags, warnings
+	_, n := readLenEncBytes(payload, off)
+	if n == 0 {
+		return "", false
+	}
+	changes, n := readLenEncBytes(payload, off+n)
+	if n == 0 {
+		return "", false
+	}
+
+	var schema string
+	var found bool
+	for len(changes) > 0 {
+		data, n := readLenEncBytes(changes, 1)
+		if n == 0 {
+			break
+		}
+		if changes[0] == sessionTrackSchema {
+			if name, m := readLenEncBytes(data, 0); m > 0 {
+				schema, found = string(name), true
+			}
+		}
+		changes = changes[1+n:]
+	}
+	return schema, found
+}
+
+// eofStatus returns the server status flags and warning count of an EOF
+// packet: 0xFE + warnings(2) + status_flags(2).
+func eofStatus(pkt []byte) (status, warnings uint16, ok bool) {
+	payload := pkt[4:]
+	if len(payload) < 5 {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint16(payload[3:5]), binary.LittleEndian.Uint16(payload[1:3]), true
+}
+
 // isEOFPacket returns true if the packet is an EOF packet (0xFE with payload < 9 bytes).
 func isEOFPacket(pkt []byte) bool {
 	return payloadByte(pkt) == iEOF && payloadLen(pkt) < 9
@@ -599,17 +970,25 @@ func isEOFPacket(pkt []byte) bool {
 //	new_params_bound_flag  (1 byte)
 //	if bound == 1:
 //	  type descriptors     (2 bytes each: type + unsigned flag)
-//	  values               (variable, per type)
-func parseStmtExecuteArgs(payload []byte, numParams int) []string {
+//	values                 (variable, per type)
+//
+// When bound is 0, the client reuses the types of the previous execution,
+// passed as prevTypes. Parameters whose value was sent beforehand with
+// COM_STMT_SEND_LONG_DATA, passed as longData, have no value in the packet.
+// It returns the args, their ArgTypes, and the type descriptors in effect, to
+// be passed as prevTypes next time; args are "?" if no types are known.
+func parseStmtExecuteArgs(
+	payload []byte, numParams int, prevTypes []byte, longData map[int]longValue,
+) ([]string, []proxy.ArgType, []byte) {
 	if numParams == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
 	// offset 1..4 = stmt_id, 5 = flags, 6..9 = iteration_count
 	off := 10 // past command(1) + stmt_id(4) + flags(1) + iteration_count(4)
 	nullBitmapLen := (numParams + 7) / 8
 	if off+nullBitmapLen+1 > len(payload) {
-		return nil
+		return nil, nil, nil
 	}
 
 	nullBitmap := payload[off : off+nullBitmapLen]
@@ -619,40 +998,73 @@ func parseStmtExecuteArgs(payload []byte, numParams int) []string {
 	off++
 
 	args := make([]string, numParams)
+	argTypes := make([]proxy.ArgType, numParams)
 
-	// Read type descriptors if new params are bound.
-	types := make([]byte, numParams)
+	// Read type descriptors if new params are bound; otherwise reuse the last ones.
+	var types []byte
 	if boundFlag == 1 {
 		if off+numParams*2 > len(payload) {
-			return nil
-		}
-		for i := range numParams {
-			types[i] = payload[off+i*2]
-			// payload[off+i*2+1] is the unsigned flag; ignored for string representation.
+			return nil, nil, nil
 		}
+		types = slices.Clone(payload[off : off+numParams*2])
 		off += numParams * 2
+	} else if len(prevTypes) == numParams*2 {
+		types = prevTypes
 	}
 
 	// Read values.
 	for i := range numParams {
 		// Check NULL bitmap: bit (i) in byte (i/8), bit position (i%8).
+		// Unlike the bitmap of a binary result row, the one of
+		// COM_STMT_EXECUTE has no offset.
 		if nullBitmap[i/8]&(1<<(i%8)) != 0 {
 			args[i] = "NULL"
+			argTypes[i] = proxy.ArgNull
 			continue
 		}
-		var val string
-		var n int
-		val, n = readBinaryValue(payload, off, types[i])
+		if types != nil {
+			argTypes[i] = argType(types[i*2], types[i*2+1])
+		}
+		if v, ok := longData[i]; ok {
+			args[i] = v.arg()
+			continue
+		}
+		if types == nil {
+			// Values cannot be delimited without their types.
+			args[i] = "?"
+			continue
+		}
+		val, n := readBinaryValue(payload, off, types[i*2], types[i*2+1]&paramUnsigned != 0)
 		args[i] = val
 		off += n
 	}
 
-	return args
+	return args, argTypes, types
+}
+
+// argType returns the ArgType of a parameter bound as MySQL type typ with
+// the given flags.
+func argType(typ, flags byte) proxy.ArgType {
+	switch typ {
+	case mysqlTypeTiny, mysqlTypeShort, mysqlTypeLong, mysqlTypeInt24, mysqlTypeLongLong, mysqlTypeYear:
+		if flags&paramUnsigned != 0 {
+			return proxy.ArgUint
+		}
+		return proxy.ArgInt
+	case mysqlTypeBit:
+		return proxy.ArgUint
+	case mysqlTypeFloat, mysqlTypeDouble:
+		return proxy.ArgFloat
+	case mysqlTypeNull:
+		return proxy.ArgNull
+	}
+	return proxy.ArgText
 }
 
 // readBinaryValue reads a single binary-encoded parameter value at offset,
 // returning the string representation and the number of bytes consumed.
-func readBinaryValue(data []byte, off int, typ byte) (string, int) {
+// Integers are read as unsigned if the parameter's unsigned flag is set.
+func readBinaryValue(data []byte, off int, typ byte, unsigned bool) (string, int) {
 	if off >= len(data) {
 		return "?", 0
 	}
@@ -662,28 +1074,40 @@ func readBinaryValue(data []byte, off int, typ byte) (string, int) {
 		if off+1 > len(data) {
 			return "?", 0
 		}
+		if unsigned {
+			return strconv.Itoa(int(data[off])), 1
+		}
 		return strconv.Itoa(int(int8(data[off]))), 1 //nolint:gosec // intentional byte-to-int8 cast for signed interpretation
 
 	case mysqlTypeShort, mysqlTypeYear:
 		if off+2 > len(data) {
 			return "?", 0
 		}
-		v := int16(binary.LittleEndian.Uint16(data[off : off+2])) //nolint:gosec // interpreting as signed int16
-		return strconv.Itoa(int(v)), 2
+		u := binary.LittleEndian.Uint16(data[off : off+2])
+		if unsigned {
+			return strconv.Itoa(int(u)), 2
+		}
+		return strconv.Itoa(int(int16(u))), 2 //nolint:gosec // interpreting as signed int16
 
 	case mysqlTypeLong, mysqlTypeInt24:
 		if off+4 > len(data) {
 			return "?", 0
 		}
-		v := int32(binary.LittleEndian.Uint32(data[off : off+4])) //nolint:gosec // interpreting as signed int32
-		return strconv.FormatInt(int64(v), 10), 4
+		u := binary.LittleEndian.Uint32(data[off : off+4])
+		if unsigned {
+			return strconv.FormatUint(uint64(u), 10), 4
+		}
+		return strconv.FormatInt(int64(int32(u)), 10), 4 //nolint:gosec // interpreting as signed int32
 
 	case mysqlTypeLongLong:
 		if off+8 > len(data) {
 			return "?", 0
 		}
-		v := int64(binary.LittleEndian.Uint64(data[off : off+8])) //nolint:gosec // interpreting as signed int64
-		return strconv.FormatInt(v, 10), 8
+		u := binary.LittleEndian.Uint64(data[off : off+8])
+		if unsigned {
+			return strconv.FormatUint(u, 10), 8
+		}
+		return strconv.FormatInt(int64(u), 10), 8 //nolint:gosec // interpreting as signed int64
 
 	case mysqlTypeFloat:
 		if off+4 > len(data) {
@@ -701,54 +1125,118 @@ func readBinaryValue(data []byte, off int, typ byte) (string, int) {
 
 	case mysqlTypeNull:
 		return "NULL", 0
+
+	case mysqlTypeBit:
+		// The bits as a big-endian byte string, at most 8 bytes for BIT(64).
+		b, n := readLenEncBytes(data, off)
+		if n == 0 {
+			return "?", 0
+		}
+		if len(b) > 8 {
+			return "?", n
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return strconv.FormatUint(v, 10), n
+
+	case mysqlTypeJSON, mysqlTypeDecimal, mysqlTypeNewDecimal:
+		// JSON as its text, DECIMAL as its digits: readable as is.
 	}
 
-	// String types (VARCHAR, BLOB, VAR_STRING, STRING, NEWDECIMAL, etc.):
+	// String types (VARCHAR, BLOB, VAR_STRING, STRING, JSON, DECIMAL, etc.):
 	// length-encoded string.
-	length, n := readLenEncInt(data, off)
+	b, n := readLenEncBytes(data, off)
 	if n == 0 {
 		return "?", 0
 	}
+	return string(b), n
+}
+
+// readLenEncBytes reads a length-encoded string at offset, returning its
+// bytes and the number of bytes consumed, or 0 if data is too short.
+func readLenEncBytes(data []byte, off int) ([]byte, int) {
+	length, n := readLenEncInt(data, off)
+	if n == 0 {
+		return nil, 0
+	}
 	off += n
 	end := off + int(length) //nolint:gosec // practically won't overflow
 	if end > len(data) {
-		return "?", 0
+		return nil, 0
 	}
-	return string(data[off:end]), n + int(length) //nolint:gosec // practically won't overflow
+	return data[off:end], n + int(length) //nolint:gosec // practically won't overflow
 }
 
 // ---------------- transaction detection ----------------
 
 type txDetectResult struct {
-	txID string
-	op   proxy.Op
+	txID     string
+	op       proxy.Op
+	readOnly bool
 }
 
-func (c *conn) detectTx(query string, defaultOp proxy.Op) txDetectResult {
-	upper := strings.ToUpper(strings.TrimSpace(query))
+func (c *conn) detectTx(sql string, defaultOp proxy.Op) txDetectResult {
+	upper := strings.ToUpper(strings.TrimSpace(sql))
 	switch {
 	case strings.HasPrefix(upper, "BEGIN"), strings.HasPrefix(upper, "START TRANSACTION"):
 		c.activeTxID = uuid.New().String()
-		return txDetectResult{txID: c.activeTxID, op: proxy.OpBegin}
+		return txDetectResult{txID: c.activeTxID, op: proxy.OpBegin, readOnly: c.access.Begin(sql)}
 	case strings.HasPrefix(upper, "COMMIT"):
 		prev := c.activeTxID
 		c.activeTxID = ""
-		return txDetectResult{txID: prev, op: proxy.OpCommit}
+		return txDetectResult{txID: prev, op: proxy.OpCommit, readOnly: c.access.End()}
 	case strings.HasPrefix(upper, "ROLLBACK"):
 		prev := c.activeTxID
 		c.activeTxID = ""
-		return txDetectResult{txID: prev, op: proxy.OpRollback}
+		return txDetectResult{txID: prev, op: proxy.OpRollback, readOnly: c.access.End()}
+	}
+	if on, ok := query.ParseAutocommit(sql); ok {
+		c.autocommitOff = !on
+		if on && c.activeTxID != "" {
+			// Enabling autocommit commits the open transaction.
+			prev := c.activeTxID
+			c.activeTxID = ""
+			return txDetectResult{txID: prev, op: defaultOp, readOnly: c.access.End()}
+		}
+	} else if c.autocommitOff && c.activeTxID == "" {
+		// With autocommit off, the first statement after a COMMIT or
+		// ROLLBACK implicitly starts a transaction.
+		c.activeTxID = uuid.New().String()
+		c.access.Begin("")
 	}
-	return txDetectResult{txID: c.activeTxID, op: defaultOp}
+	ro := c.access.Observe(sql, c.activeTxID != "")
+	return txDetectResult{txID: c.activeTxID, op: defaultOp, readOnly: ro}
 }
 
-func (c *conn) emitEvent(ev proxy.Event) {
-	select {
-	case c.events <- ev:
-	default:
+// applyServerStatus reconciles the tracked transaction with the status flags
+// the server reported after ev's statement. The flags are authoritative: they
+// catch transactions opened implicitly (autocommit disabled by the server
+// configuration or a statement the proxy didn't recognize) and ended
+// implicitly (DDL, LOCK TABLES). ev may be nil. c.mu must be held.
+func (c *conn) applyServerStatus(ev *proxy.Event, status uint16) {
+	c.autocommitOff = status&serverStatusAutocommit == 0
+	inTrans := status&serverStatusInTrans != 0
+	switch {
+	case inTrans && c.activeTxID == "":
+		c.activeTxID = uuid.New().String()
+		c.access.Begin("")
+		// The statement opened the transaction, unless it ended the previous
+		// one and the server chained a new one (COMMIT AND CHAIN).
+		if ev != nil && ev.TxID == "" {
+			ev.TxID = c.activeTxID
+		}
+	case !inTrans && c.activeTxID != "":
+		c.activeTxID = ""
+		c.access.End()
 	}
 }
 
+func (c *conn) emitEvent(ev proxy.Event) {
+	proxy.Emit(c.events, ev, c.overflow, c.dropped)
+}
+
 func isClosedErr(err error) bool {
 	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 		return true
@@ -0,0 +1,974 @@
+package mysql_test
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+	mproxy "github.com/mickamy/sql-tap/proxy/mysql"
+)
+
+var okPayload = []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+
+// Server status flags carried by OK and EOF packets.
+const (
+	statusInTrans    = 0x0001
+	statusAutocommit = 0x0002
+)
+
+// okWithStatus returns an OK packet payload reporting the given status flags.
+func okWithStatus(status uint16) []byte {
+	return []byte{0x00, 0x00, 0x00, byte(status), byte(status >> 8), 0x00, 0x00}
+}
+
+func writePkt(t *testing.T, c net.Conn, seq byte, payload []byte) {
+	t.Helper()
+
+	n := len(payload)
+	pkt := append([]byte{byte(n), byte(n >> 8), byte(n >> 16), seq}, payload...)
+	if _, err := c.Write(pkt); err != nil {
+		t.Fatalf("write packet: %v", err)
+	}
+}
+
+func readPkt(t *testing.T, c net.Conn) []byte {
+	t.Helper()
+
+	var hdr [4]byte
+	if _, err := io.ReadFull(c, hdr[:]); err != nil {
+		t.Fatalf("read packet header: %v", err)
+	}
+	payload := make([]byte, int(hdr[0])|int(hdr[1])<<8|int(hdr[2])<<16)
+	if _, err := io.ReadFull(c, payload); err != nil {
+		t.Fatalf("read packet payload: %v", err)
+	}
+	return payload
+}
+
+// roundTrip sends a client packet through the proxy and answers it with resp from the server.
+func roundTrip(t *testing.T, client, server net.Conn, req, resp []byte) {
+	t.Helper()
+
+	writePkt(t, client, 0, req)
+	if got := readPkt(t, server); string(got) != string(req) {
+		t.Fatalf("server got %q, want %q", got, req)
+	}
+	writePkt(t, server, 1, resp)
+	if got := readPkt(t, client); string(got) != string(resp) {
+		t.Fatalf("client got %q, want %q", got, resp)
+	}
+}
+
+// startRelay runs a proxy conn between in-memory client and server pipes and
+// completes the initial handshake.
+func startRelay(
+	t *testing.T, inFlightDelay time.Duration, opts ...mproxy.ConnOption,
+) (client, server net.Conn, events <-chan proxy.Event) {
+	t.Helper()
+	return startRelayCaps(t, inFlightDelay, 0, opts...)
+}
+
+// startRelayCaps is startRelay with a client that asks for the capabilities caps.
+func startRelayCaps(
+	t *testing.T, inFlightDelay time.Duration, caps uint32, opts ...mproxy.ConnOption,
+) (client, server net.Conn, events <-chan proxy.Event) {
+	t.Helper()
+
+	client, proxyClient := net.Pipe()
+	proxyUpstream, server := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	_ = client.SetDeadline(deadline)
+	_ = server.SetDeadline(deadline)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	ch := make(chan proxy.Event, 16)
+	go func() { _ = mproxy.Relay(t.Context(), proxyClient, proxyUpstream, ch, inFlightDelay, opts...) }()
+
+	writePkt(t, server, 0, []byte{0x0a, '8', 0x00})
+	readPkt(t, client)
+	writePkt(t, client, 1, binary.LittleEndian.AppendUint32(nil, caps))
+	readPkt(t, server)
+	writePkt(t, server, 2, okPayload)
+	readPkt(t, client)
+
+	return client, server, ch
+}
+
+func comQuery(q string) []byte {
+	return append([]byte{0x03}, q...)
+}
+
+func TestChangeUser(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	roundTrip(t, client, server, comQuery("BEGIN"), okPayload)
+	begin := waitEvent(t, events)
+	if begin.Op != proxy.OpBegin || begin.TxID == "" {
+		t.Fatalf("begin event = %+v, want Begin with tx ID", begin)
+	}
+
+	// A pooler switches users: the server asks for an auth method switch and
+	// the client's scramble happens to start with the COM_QUERY byte.
+	changeUser := append([]byte{0x11}, "app\x00"...)
+	authSwitch := append([]byte{0xfe}, "mysql_native_password\x00"...)
+	roundTrip(t, client, server, changeUser, authSwitch)
+	roundTrip(t, client, server, comQuery("scramble"), okPayload)
+
+	roundTrip(t, client, server, comQuery("SELECT 1"), okPayload)
+	ev := waitEvent(t, events)
+	if ev.Query != "SELECT 1" {
+		t.Fatalf("query = %q, want %q", ev.Query, "SELECT 1")
+	}
+	if ev.TxID != "" {
+		t.Errorf("tx ID = %q, want empty after change user", ev.TxID)
+	}
+}
+
+func TestAutocommitOff(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	send := func(q string, status uint16) proxy.Event {
+		t.Helper()
+		roundTrip(t, client, server, comQuery(q), okWithStatus(status))
+		return waitEvent(t, events)
+	}
+
+	if ev := send("SET autocommit=0", 0); ev.TxID != "" {
+		t.Errorf("SET autocommit=0: tx ID = %q, want empty", ev.TxID)
+	}
+
+	first := send("INSERT INTO t VALUES (1)", statusInTrans)
+	if first.TxID == "" {
+		t.Fatal("first statement with autocommit off: tx ID is empty, want implicit transaction")
+	}
+	if ev := send("UPDATE t SET v = 2", statusInTrans); ev.TxID != first.TxID {
+		t.Errorf("second statement: tx ID = %q, want %q", ev.TxID, first.TxID)
+	}
+	if ev := send("COMMIT", 0); ev.Op != proxy.OpCommit || ev.TxID != first.TxID {
+		t.Errorf("commit = %+v, want Commit in %q", ev, first.TxID)
+	}
+
+	next := send("SELECT 1", statusInTrans)
+	if next.TxID == "" || next.TxID == first.TxID {
+		t.Errorf("statement after commit: tx ID = %q, want a new implicit transaction", next.TxID)
+	}
+
+	// Turning autocommit back on commits the open transaction.
+	if ev := send("SET autocommit=1", statusAutocommit); ev.TxID != next.TxID {
+		t.Errorf("SET autocommit=1: tx ID = %q, want %q", ev.TxID, next.TxID)
+	}
+	if ev := send("SELECT 2", statusAutocommit); ev.TxID != "" {
+		t.Errorf("statement with autocommit on: tx ID = %q, want empty", ev.TxID)
+	}
+
+	// ORMs often switch autocommit off among other session settings.
+	if ev := send("SET NAMES utf8mb4, autocommit = 0", 0); ev.TxID != "" {
+		t.Errorf("SET list: tx ID = %q, want empty", ev.TxID)
+	}
+	if ev := send("SELECT 3", statusInTrans); ev.TxID == "" || ev.TxID == next.TxID {
+		t.Errorf("statement after SET list: tx ID = %q, want a new implicit transaction", ev.TxID)
+	}
+}
+
+func TestServerStatusTransaction(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	send := func(q string, status uint16) proxy.Event {
+		t.Helper()
+		roundTrip(t, client, server, comQuery(q), okWithStatus(status))
+		return waitEvent(t, events)
+	}
+
+	// autocommit is off by server configuration, so no statement text tells
+	// the proxy that the first UPDATE opens a transaction.
+	first := send("UPDATE t SET v = 1", statusInTrans)
+	if first.TxID == "" {
+		t.Fatal("statement reported in transaction: tx ID is empty")
+	}
+	if ev := send("UPDATE t SET v = 2", statusInTrans); ev.TxID != first.TxID {
+		t.Errorf("second statement: tx ID = %q, want %q", ev.TxID, first.TxID)
+	}
+
+	// DDL commits implicitly; the server reports the transaction as ended.
+	if ev := send("CREATE TABLE u (id INT)", 0); ev.TxID != first.TxID {
+		t.Errorf("DDL: tx ID = %q, want %q", ev.TxID, first.TxID)
+	}
+
+	// autocommit off was learned from the status flags: the next statement
+	// opens a new transaction before its response arrives.
+	writePkt(t, client, 0, comQuery("SELECT v FROM t"))
+	readPkt(t, server)
+	eof := []byte{0xfe, 0x00, 0x00, statusInTrans, 0x00}
+	for i, p := range [][]byte{{0x01}, []byte("def-v"), eof, {0x01, '2'}, eof} {
+		writePkt(t, server, byte(i+1), p)
+		readPkt(t, client)
+	}
+	second := waitEvent(t, events)
+	if second.TxID == "" || second.TxID == first.TxID {
+		t.Errorf("statement after implicit commit: tx ID = %q, want a new transaction", second.TxID)
+	}
+
+	if ev := send("ROLLBACK", 0); ev.Op != proxy.OpRollback || ev.TxID != second.TxID {
+		t.Errorf("rollback = %+v, want Rollback in %q", ev, second.TxID)
+	}
+	if ev := send("SET autocommit=1", statusAutocommit); ev.TxID != "" {
+		t.Errorf("SET autocommit=1 outside a transaction: tx ID = %q, want empty", ev.TxID)
+	}
+	if ev := send("SELECT 1", statusAutocommit); ev.TxID != "" {
+		t.Errorf("statement with autocommit on: tx ID = %q, want empty", ev.TxID)
+	}
+}
+
+func TestReadOnlyTransaction(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	send := func(q string, status uint16) proxy.Event {
+		t.Helper()
+		roundTrip(t, client, server, comQuery(q), okWithStatus(status))
+		return waitEvent(t, events)
+	}
+
+	// database/sql's BeginTx with ReadOnly goes through the text protocol.
+	for _, q := range []string{"START TRANSACTION READ ONLY", "SELECT * FROM t", "COMMIT"} {
+		status := uint16(statusAutocommit | statusInTrans)
+		if q == "COMMIT" {
+			status = statusAutocommit
+		}
+		if ev := send(q, status); !ev.ReadOnly {
+			t.Errorf("%s: read-only = false, want true", q)
+		}
+	}
+	if ev := send("SELECT 1", statusAutocommit); ev.ReadOnly {
+		t.Error("statement after COMMIT: read-only = true, want false")
+	}
+
+	// A session default applies to the statements that follow.
+	send("SET SESSION TRANSACTION READ ONLY", statusAutocommit)
+	if ev := send("SELECT 2", statusAutocommit); !ev.ReadOnly {
+		t.Error("statement after SET SESSION TRANSACTION READ ONLY: read-only = false, want true")
+	}
+}
+
+func TestInFlightEvent(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, 10*time.Millisecond)
+
+	req := comQuery("SELECT SLEEP(1)")
+	writePkt(t, client, 0, req)
+	readPkt(t, server)
+
+	inFlight := waitEvent(t, events)
+	if !inFlight.InFlight {
+		t.Fatalf("first event = %+v, want in-flight", inFlight)
+	}
+	if inFlight.Query != "SELECT SLEEP(1)" || inFlight.Duration != 0 {
+		t.Errorf("in-flight event = %+v, want query without duration", inFlight)
+	}
+
+	writePkt(t, server, 1, okPayload)
+	readPkt(t, client)
+
+	done := waitEvent(t, events)
+	if done.InFlight {
+		t.Fatalf("second event = %+v, want completed", done)
+	}
+	if done.ID != inFlight.ID || !done.StartTime.Equal(inFlight.StartTime) {
+		t.Errorf("completed event (%s, %s) does not match in-flight (%s, %s)",
+			done.ID, done.StartTime, inFlight.ID, inFlight.StartTime)
+	}
+	if done.Duration <= 0 {
+		t.Errorf("duration = %s, want > 0", done.Duration)
+	}
+}
+
+func TestPingAndQuit(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	// The OK answering COM_PING completes no statement.
+	roundTrip(t, client, server, []byte{0x0e}, okPayload)
+	roundTrip(t, client, server, comQuery("SELECT 1"), okPayload)
+	if ev := waitEvent(t, events); ev.Query != "SELECT 1" || ev.Error != "" {
+		t.Fatalf("event = %+v, want SELECT 1", ev)
+	}
+
+	// COM_QUIT gets no response; the server just closes the connection.
+	writePkt(t, client, 0, []byte{0x01})
+	readPkt(t, server)
+	_ = server.Close()
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event after COM_QUIT: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestCloseMidQuery(t *testing.T) {
+	t.Parallel()
+
+	for _, side := range []string{"client", "upstream"} {
+		t.Run(side, func(t *testing.T) {
+			t.Parallel()
+
+			client, server, events := startRelay(t, proxy.InFlightDelay)
+
+			writePkt(t, client, 0, comQuery("SELECT SLEEP(10)"))
+			readPkt(t, server)
+			if side == "client" {
+				_ = client.Close()
+			} else {
+				_ = server.Close()
+			}
+
+			ev := waitEvent(t, events)
+			if ev.Query != "SELECT SLEEP(10)" || ev.InFlight {
+				t.Fatalf("event = %+v, want the completed query", ev)
+			}
+			if ev.Error != proxy.ErrConnClosed.Error() {
+				t.Errorf("error = %q, want %q", ev.Error, proxy.ErrConnClosed)
+			}
+			if ev.Duration <= 0 {
+				t.Errorf("duration = %s, want > 0", ev.Duration)
+			}
+		})
+	}
+}
+
+func TestResultColumns(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts []mproxy.ConnOption
+		want int
+	}{
+		{name: "off by default", want: 0},
+		{name: "captured", opts: []mproxy.ConnOption{mproxy.WithResultColumns}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server, events := startRelay(t, proxy.InFlightDelay, tt.opts...)
+
+			writePkt(t, client, 0, comQuery("SELECT id, name, email FROM users"))
+			readPkt(t, server)
+
+			eof := []byte{0xfe, 0x00, 0x00, 0x02, 0x00}
+			resp := [][]byte{
+				{0x03}, // column count
+				[]byte("def-id"), []byte("def-name"), []byte("def-email"),
+				eof,
+				{0x01, '1', 0x01, 'a', 0x01, 'b'}, // row
+				eof,
+			}
+			for i, p := range resp {
+				writePkt(t, server, byte(i+1), p)
+				readPkt(t, client)
+			}
+
+			ev := waitEvent(t, events)
+			if ev.ResultColumns != tt.want {
+				t.Errorf("ResultColumns = %d, want %d", ev.ResultColumns, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionTracking(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	send := func(q string, resp []byte) proxy.Event {
+		t.Helper()
+		roundTrip(t, client, server, comQuery(q), resp)
+		return waitEvent(t, events)
+	}
+
+	ev := send("SET NAMES utf8mb4, @@session.time_zone = '+00:00'", okPayload)
+	want := map[string]string{"names": "utf8mb4", "time_zone": "+00:00"}
+	if !reflect.DeepEqual(ev.Session, want) {
+		t.Errorf("SET event: session = %v, want %v", ev.Session, want)
+	}
+
+	errPayload := append([]byte{0xff, 0x49, 0x04, '#'}, "42000Unknown variable"...)
+	if ev := send("SET bogus = 1", errPayload); ev.Session["bogus"] != "" {
+		t.Errorf("failed SET applied: session = %v", ev.Session)
+	}
+	if ev := send("SELECT 1", okPayload); !reflect.DeepEqual(ev.Session, want) {
+		t.Errorf("later query: session = %v, want %v", ev.Session, want)
+	}
+
+	// COM_CHANGE_USER resets the session on the server.
+	roundTrip(t, client, server, append([]byte{0x11}, "app\x00"...), okPayload)
+	if ev := send("SELECT 2", okPayload); ev.Session != nil {
+		t.Errorf("after change user: session = %v, want nil", ev.Session)
+	}
+}
+
+func TestSessionStateChanges(t *testing.T) {
+	t.Parallel()
+
+	const clientSessionTrack = 1 << 23
+	client, server, events := startRelayCaps(t, proxy.InFlightDelay, clientSessionTrack)
+
+	lenenc := func(b []byte) []byte { return append([]byte{byte(len(b))}, b...) }
+	// okWithChanges is an OK packet reporting affected rows, a warning and
+	// session state changes: the variable autocommit and, if not empty, a
+	// new schema.
+	okWithChanges := func(rows byte, schema string) []byte {
+		changes := append([]byte{0x00}, lenenc(append(lenenc([]byte("autocommit")), lenenc([]byte("ON"))...))...)
+		if schema != "" {
+			changes = append(changes, 0x01)
+			changes = append(changes, lenenc(lenenc([]byte(schema)))...)
+		}
+		p := []byte{0x00, rows, 0x00, 0x02, 0x40, 0x01, 0x00} // status: autocommit, session state changed
+		p = append(p, lenenc(nil)...)                         // info
+		return append(p, lenenc(changes)...)
+	}
+
+	roundTrip(t, client, server, comQuery("USE shop"), okWithChanges(0, "shop"))
+	if ev := waitEvent(t, events); ev.Session["database"] != "shop" {
+		t.Errorf("USE: session = %v, want database=shop", ev.Session)
+	}
+
+	// The trailer does not throw off the fields before it.
+	roundTrip(t, client, server, comQuery("UPDATE t SET v = 1"), okWithChanges(3, ""))
+	ev := waitEvent(t, events)
+	if ev.RowsAffected != 3 || ev.Warnings != 1 || ev.Session["database"] != "shop" {
+		t.Errorf("update: rows = %d, warnings = %d, session = %v, want 3, 1 and database=shop",
+			ev.RowsAffected, ev.Warnings, ev.Session)
+	}
+
+	// COM_INIT_DB is no statement, but its schema change carries over.
+	roundTrip(t, client, server, append([]byte{0x02}, "inventory"...), okWithChanges(0, "inventory"))
+	roundTrip(t, client, server, comQuery("SELECT 1"), okPayload)
+	if ev := waitEvent(t, events); ev.Session["database"] != "inventory" {
+		t.Errorf("after COM_INIT_DB: session = %v, want database=inventory", ev.Session)
+	}
+}
+
+func TestHandshakeClientCapabilities(t *testing.T) {
+	t.Parallel()
+
+	client, proxyClient := net.Pipe()
+	proxyUpstream, server := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	_ = client.SetDeadline(deadline)
+	_ = server.SetDeadline(deadline)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	infos := make(chan proxy.ServerInfo, 1)
+	go func() {
+		_ = mproxy.RelayInfo(t.Context(), proxyClient, proxyUpstream, make(chan proxy.Event, 1),
+			func(info proxy.ServerInfo) { infos <- info })
+	}()
+
+	const clientCompress, clientSSL = 1 << 5, 1 << 11
+	writePkt(t, server, 0, []byte{0x0a, '8', 0x00})
+	readPkt(t, client)
+	writePkt(t, client, 1, binary.LittleEndian.AppendUint32(nil, clientCompress|clientSSL))
+	if caps := binary.LittleEndian.Uint32(readPkt(t, server)); caps&(clientCompress|clientSSL) != 0 {
+		t.Errorf("upstream got caps %#x, want TLS and compression stripped", caps)
+	}
+	writePkt(t, server, 2, okPayload)
+	readPkt(t, client)
+
+	// The info reports what the client asked for.
+	if info := <-infos; !info.TLS || !info.Compression {
+		t.Errorf("info = %+v, want TLS and compression", info)
+	}
+}
+
+// startHandshake runs a proxy conn between in-memory client and server pipes
+// without completing the handshake, and reports the relay's result on done.
+func startHandshake(t *testing.T) (client, server net.Conn, done <-chan error) {
+	t.Helper()
+
+	client, proxyClient := net.Pipe()
+	proxyUpstream, server := net.Pipe()
+	deadline := time.Now().Add(5 * time.Second)
+	_ = client.SetDeadline(deadline)
+	_ = server.SetDeadline(deadline)
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- mproxy.Relay(t.Context(), proxyClient, proxyUpstream, make(chan proxy.Event, 1), 0)
+	}()
+	return client, server, ch
+}
+
+func TestStartupAuthError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		errPkt  []byte
+		wantErr string
+	}{
+		{
+			name: "wrong password",
+			errPkt: append([]byte{0xff, 0x15, 0x04, '#'},
+				"28000Access denied for user 'root'@'10.0.0.1' (using password: YES)"...),
+			wantErr: "mysql: auth error from upstream: " +
+				"ERROR 1045 (28000): Access denied for user 'root'@'10.0.0.1' (using password: YES)",
+		},
+		{
+			name:    "no sql state",
+			errPkt:  append([]byte{0xff, 0x15, 0x04}, "Access denied"...),
+			wantErr: "mysql: auth error from upstream: ERROR 1045: Access denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server, done := startHandshake(t)
+
+			writePkt(t, server, 0, []byte{0x0a, '8', 0x00})
+			readPkt(t, client)
+			writePkt(t, client, 1, []byte{0x00, 0x00, 0x00, 0x00})
+			readPkt(t, server)
+			writePkt(t, server, 2, tt.errPkt)
+			if got := readPkt(t, client); string(got) != string(tt.errPkt) {
+				t.Errorf("client got %q, want the ERR packet relayed", got)
+			}
+
+			if err := <-done; err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want suffix %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGreetingError(t *testing.T) {
+	t.Parallel()
+
+	client, server, done := startHandshake(t)
+
+	errPkt := append([]byte{0xff, 0x6a, 0x04}, "Host '10.0.0.1' is not allowed to connect to this MySQL server"...)
+	writePkt(t, server, 0, errPkt)
+	if got := readPkt(t, client); string(got) != string(errPkt) {
+		t.Errorf("client got %q, want the ERR packet relayed", got)
+	}
+
+	want := "mysql: upstream refused connection: ERROR 1130: Host '10.0.0.1' is not allowed to connect to this MySQL server"
+	if err := <-done; err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("err = %v, want suffix %q", err, want)
+	}
+}
+
+func TestGreetingVersion(t *testing.T) {
+	t.Parallel()
+
+	// greeting builds a HandshakeV10 payload up to the capability flags.
+	greeting := func(version string) []byte {
+		p := append([]byte{0x0a}, version...)
+		p = append(p, 0x00)
+		p = append(p, 0x2a, 0x00, 0x00, 0x00)                            // connection ID
+		p = append(p, "abcdefgh"...)                                     // auth data part 1
+		return append(p, 0x00, 0xff, 0xf7, 0xff, 0x02, 0x00, 0xff, 0xdf) // filler, caps, charset, status, caps
+	}
+
+	tests := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"mysql", greeting("8.0.36"), "8.0.36"},
+		{"mariadb", greeting("5.5.5-10.11.6-MariaDB-1:10.11.6+maria~ubu2204"), "5.5.5-10.11.6-MariaDB-1:10.11.6+maria~ubu2204"},
+		{"tidb", greeting("8.0.11-TiDB-v7.5.0"), "8.0.11-TiDB-v7.5.0"},
+		{"unterminated", []byte{0x0a, '8', '.', '0'}, ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := mproxy.GreetingVersion(tt.payload); got != tt.want {
+				t.Errorf("GreetingVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachingSha2Auth(t *testing.T) {
+	t.Parallel()
+
+	pubKey := append([]byte{0x01}, "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA\n-----END PUBLIC KEY-----\n"...)
+	encrypted := make([]byte, 256)
+	for i := range encrypted {
+		encrypted[i] = byte(i)
+	}
+
+	// exchange lists the auth packets after the handshake response, in order;
+	// fromServer tells which side sends each.
+	type step struct {
+		fromServer bool
+		payload    []byte
+	}
+	tests := []struct {
+		name     string
+		exchange []step
+	}{
+		{
+			name: "fast auth",
+			exchange: []step{
+				{fromServer: true, payload: []byte{0x01, 0x03}},
+			},
+		},
+		{
+			name: "full auth requesting the public key",
+			exchange: []step{
+				{fromServer: true, payload: []byte{0x01, 0x04}},
+				{fromServer: false, payload: []byte{0x02}},
+				{fromServer: true, payload: pubKey},
+				{fromServer: false, payload: encrypted},
+			},
+		},
+		{
+			name: "full auth with a known public key",
+			exchange: []step{
+				{fromServer: true, payload: []byte{0x01, 0x04}},
+				{fromServer: false, payload: encrypted},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server, done := startHandshake(t)
+
+			writePkt(t, server, 0, []byte{0x0a, '8', 0x00})
+			readPkt(t, client)
+			writePkt(t, client, 1, []byte{0x00, 0x00, 0x00, 0x00})
+			readPkt(t, server)
+
+			seq := byte(2)
+			for _, st := range tt.exchange {
+				from, to := client, server
+				if st.fromServer {
+					from, to = server, client
+				}
+				writePkt(t, from, seq, st.payload)
+				if got := readPkt(t, to); string(got) != string(st.payload) {
+					t.Fatalf("step %d: got %q, want %q relayed unchanged", seq, got, st.payload)
+				}
+				seq++
+			}
+			writePkt(t, server, seq, okPayload)
+			readPkt(t, client)
+
+			// The session continues past the handshake.
+			roundTrip(t, client, server, comQuery("SELECT 1"), okPayload)
+			_ = client.Close()
+			if err := <-done; err != nil && strings.Contains(err.Error(), "auth") {
+				t.Errorf("relay error = %v, want the handshake to succeed", err)
+			}
+		})
+	}
+}
+
+// prepareStmt prepares query as stmtID with numParams parameters and no
+// result columns through the proxy.
+func prepareStmt(t *testing.T, client, server net.Conn, stmtID uint32, numParams uint16, query string) {
+	t.Helper()
+
+	writePkt(t, client, 0, append([]byte{0x16}, query...))
+	readPkt(t, server)
+	prepareOK := []byte{
+		0x00,
+		byte(stmtID), byte(stmtID >> 8), byte(stmtID >> 16), byte(stmtID >> 24),
+		0x00, 0x00, // columns
+		byte(numParams), byte(numParams >> 8),
+		0x00, 0x00, 0x00,
+	}
+	packets := [][]byte{prepareOK}
+	for range numParams {
+		packets = append(packets, []byte("param def"))
+	}
+	packets = append(packets, []byte{0xfe, 0x00, 0x00, 0x02, 0x00})
+	for i, pkt := range packets {
+		writePkt(t, server, byte(i+1), pkt)
+		readPkt(t, client)
+	}
+}
+
+func TestStmtExecuteReusesParamTypes(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 7, 2, "SELECT ?, ?")
+
+	const typeLongLong, typeVarString = 0x08, 0xfd
+	execute := func(types []byte, a int64, b string) []byte {
+		p := []byte{0x17, 7, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x00} // stmt 7, no flags, 1 iteration, NULL bitmap
+		if types != nil {
+			p = append(p, 0x01)
+			p = append(p, types...)
+		} else {
+			p = append(p, 0x00)
+		}
+		p = binary.LittleEndian.AppendUint64(p, uint64(a)) //nolint:gosec // test value
+		p = append(p, byte(len(b)))
+		return append(p, b...)
+	}
+
+	roundTrip(t, client, server, execute([]byte{typeLongLong, 0x00, typeVarString, 0x00}, 1, "first"), okPayload)
+	wantTypes := []proxy.ArgType{proxy.ArgInt, proxy.ArgText}
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"1", "first"}) ||
+		!reflect.DeepEqual(ev.ArgTypes, wantTypes) {
+		t.Errorf("first execute: args = %q %q, want [1 first] %q", ev.Args, ev.ArgTypes, wantTypes)
+	}
+
+	// Same statement without rebinding: the types of the first execution apply.
+	roundTrip(t, client, server, execute(nil, 2, "second"), okPayload)
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"2", "second"}) ||
+		!reflect.DeepEqual(ev.ArgTypes, wantTypes) {
+		t.Errorf("second execute: args = %q %q, want [2 second] %q", ev.Args, ev.ArgTypes, wantTypes)
+	}
+}
+
+func TestStmtExecuteArgTypes(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 5, 4, "SELECT ?, ?, ?, ?")
+
+	const typeLong, typeDouble, typeNewDecimal, typeNull = 0x03, 0x05, 0xf6, 0x06
+	p := []byte{0x17, 5, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x08, 0x01} // stmt 5, 1 iteration, 4th param NULL, types bound
+	p = append(p, typeLong, 0x80, typeDouble, 0x00, typeNewDecimal, 0x00, typeNull, 0x00)
+	p = binary.LittleEndian.AppendUint32(p, 7)
+	p = binary.LittleEndian.AppendUint64(p, math.Float64bits(0.5))
+	p = append(p, 4)
+	p = append(p, "1.25"...)
+	roundTrip(t, client, server, p, okPayload)
+
+	ev := waitEvent(t, events)
+	if want := []string{"7", "0.5", "1.25", "NULL"}; !reflect.DeepEqual(ev.Args, want) {
+		t.Errorf("args = %q, want %q", ev.Args, want)
+	}
+	// DECIMAL is bound as text to keep its precision.
+	if want := []proxy.ArgType{proxy.ArgUint, proxy.ArgFloat, proxy.ArgText, proxy.ArgNull}; !reflect.DeepEqual(ev.ArgTypes, want) {
+		t.Errorf("arg types = %q, want %q", ev.ArgTypes, want)
+	}
+}
+
+func TestStmtExecuteUnsignedArgs(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 7, 5, "SELECT ?, ?, ?, ?, ?")
+
+	const typeTiny, typeShort, typeLong, typeLongLong = 0x01, 0x02, 0x03, 0x08
+	p := []byte{0x17, 7, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x00, 0x01} // stmt 7, 1 iteration, no NULLs, types bound
+	p = append(p, typeLongLong, 0x80, typeLong, 0x80, typeShort, 0x80, typeTiny, 0x80, typeLongLong, 0x00)
+	p = binary.LittleEndian.AppendUint64(p, math.MaxUint64-1)
+	p = binary.LittleEndian.AppendUint32(p, math.MaxUint32)
+	p = binary.LittleEndian.AppendUint16(p, 0xfffe)
+	p = append(p, 0xff)
+	p = binary.LittleEndian.AppendUint64(p, math.MaxUint64) // signed: -1
+	roundTrip(t, client, server, p, okPayload)
+
+	ev := waitEvent(t, events)
+	if want := []string{"18446744073709551614", "4294967295", "65534", "255", "-1"}; !reflect.DeepEqual(ev.Args, want) {
+		t.Errorf("args = %q, want %q", ev.Args, want)
+	}
+}
+
+func TestStmtExecuteNullBitmapSecondByte(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 8, 10, "SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?")
+
+	const typeLong = 0x03
+	p := []byte{0x17, 8, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x00, 0x01, 0x01} // stmt 8, 1 iteration, 9th param NULL, types bound
+	for range 10 {
+		p = append(p, typeLong, 0x00)
+	}
+	want := make([]string, 10)
+	for i := range 10 {
+		if i == 8 {
+			want[i] = "NULL"
+			continue
+		}
+		p = binary.LittleEndian.AppendUint32(p, uint32(i+1)) //nolint:gosec // small
+		want[i] = strconv.Itoa(i + 1)
+	}
+	roundTrip(t, client, server, p, okPayload)
+
+	ev := waitEvent(t, events)
+	if !reflect.DeepEqual(ev.Args, want) {
+		t.Errorf("args = %q, want %q", ev.Args, want)
+	}
+	for i, typ := range ev.ArgTypes {
+		if (typ == proxy.ArgNull) != (i == 8) {
+			t.Errorf("arg %d type = %q", i, typ)
+		}
+	}
+}
+
+func TestStmtExecuteUnknownParamTypes(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 3, 2, "SELECT ?, ?")
+
+	// The types were bound before the proxy saw the connection: the values
+	// cannot be decoded, but NULLs are still known.
+	execute := []byte{0x17, 3, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x02, 0x00, 0x2a}
+	roundTrip(t, client, server, execute, okPayload)
+	wantTypes := []proxy.ArgType{proxy.ArgText, proxy.ArgNull}
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"?", "NULL"}) ||
+		!reflect.DeepEqual(ev.ArgTypes, wantTypes) {
+		t.Errorf("args = %q %q, want [? NULL] %q", ev.Args, ev.ArgTypes, wantTypes)
+	}
+}
+
+func TestStmtSendLongData(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 5, 2, "INSERT INTO files (id, body) VALUES (?, ?)")
+
+	const typeLongLong, typeBlob = 0x08, 0xfc
+	sendLongData := func(param uint16, data string) {
+		p := []byte{0x18, 5, 0, 0, 0, byte(param), byte(param >> 8)}
+		writePkt(t, client, 0, append(p, data...))
+		if got := readPkt(t, server); string(got[7:]) != data {
+			t.Fatalf("upstream got long data %q, want %q", got[7:], data)
+		}
+	}
+	// Execute binds both params; body is inline only when given.
+	execute := func(id int64, body string) []byte {
+		p := []byte{0x17, 5, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x00, 0x01, typeLongLong, 0x00, typeBlob, 0x00}
+		p = binary.LittleEndian.AppendUint64(p, uint64(id)) //nolint:gosec // test value
+		if body != "" {
+			p = append(p, byte(len(body)))
+			p = append(p, body...)
+		}
+		return p
+	}
+
+	// The body is sent in two chunks, which the server concatenates.
+	sendLongData(1, "hello, ")
+	sendLongData(1, "world")
+	roundTrip(t, client, server, execute(1, ""), okPayload)
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"1", "hello, world"}) {
+		t.Errorf("execute with long data: args = %q, want [1 \"hello, world\"]", ev.Args)
+	}
+
+	// Executing discards the long data: the next execution has it inline.
+	roundTrip(t, client, server, execute(2, "inline"), okPayload)
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"2", "inline"}) {
+		t.Errorf("execute after long data: args = %q, want [2 inline]", ev.Args)
+	}
+
+	// COM_STMT_RESET discards it too, and its OK produces no event.
+	sendLongData(1, "discarded")
+	roundTrip(t, client, server, []byte{0x1a, 5, 0, 0, 0}, okPayload)
+	roundTrip(t, client, server, execute(3, "after reset"), okPayload)
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"3", "after reset"}) {
+		t.Errorf("execute after reset: args = %q, want [3 \"after reset\"]", ev.Args)
+	}
+
+	// Large uploads are summarized rather than copied into the event.
+	chunk := strings.Repeat("x", 3000)
+	sendLongData(1, chunk)
+	sendLongData(1, chunk)
+	roundTrip(t, client, server, execute(4, ""), okPayload)
+	if ev := waitEvent(t, events); !reflect.DeepEqual(ev.Args, []string{"4", "<blob 6000 bytes>"}) {
+		t.Errorf("execute with large long data: args = %q, want [4 \"<blob 6000 bytes>\"]", ev.Args)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+
+	// OK: affected_rows=1, last_insert_id=0, status=autocommit, warnings=2.
+	roundTrip(t, client, server, comQuery("INSERT INTO t VALUES (1000)"),
+		[]byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x02, 0x00})
+	if ev := waitEvent(t, events); ev.Warnings != 2 || ev.RowsAffected != 1 {
+		t.Errorf("insert: warnings = %d, rows = %d, want 2 and 1", ev.Warnings, ev.RowsAffected)
+	}
+
+	// Result set ending in EOF: warnings=1, status=autocommit.
+	writePkt(t, client, 0, comQuery("SELECT CAST('x' AS SIGNED)"))
+	readPkt(t, server)
+	for i, pkt := range [][]byte{
+		{0x01},                         // column count
+		[]byte("column def"),           // column definition
+		{0xfe, 0x00, 0x00, 0x02, 0x00}, // EOF after columns
+		{0x01, '0'},                    // row
+		{0xfe, 0x01, 0x00, 0x02, 0x00}, // EOF after rows
+	} {
+		writePkt(t, server, byte(i+1), pkt)
+		readPkt(t, client)
+	}
+	if ev := waitEvent(t, events); ev.Warnings != 1 {
+		t.Errorf("select: warnings = %d, want 1", ev.Warnings)
+	}
+
+	roundTrip(t, client, server, comQuery("SELECT 1"), okPayload)
+	if ev := waitEvent(t, events); ev.Warnings != 0 {
+		t.Errorf("clean statement: warnings = %d, want 0", ev.Warnings)
+	}
+}
+
+func TestStmtExecuteBitAndJSON(t *testing.T) {
+	t.Parallel()
+
+	client, server, events := startRelay(t, proxy.InFlightDelay)
+	prepareStmt(t, client, server, 6, 4, "INSERT INTO flags (mask, small, doc, id) VALUES (?, ?, ?, ?)")
+
+	const typeBit, typeJSON, typeLong = 0x10, 0xf5, 0x03
+	const doc = `{"tags": ["a", "b"], "n": 1}`
+	p := []byte{0x17, 6, 0, 0, 0, 0x00, 1, 0, 0, 0, 0x00, 0x01} // stmt 6, 1 iteration, no NULLs, types bound
+	p = append(p, typeBit, 0x00, typeBit, 0x00, typeJSON, 0x00, typeLong, 0x00)
+	p = append(p, 2, 0x01, 0x05) // b'100000101'
+	p = append(p, 1, 0x00)
+	p = append(p, byte(len(doc)))
+	p = append(p, doc...)
+	p = binary.LittleEndian.AppendUint32(p, 9) // decoded after the variable-length values
+	roundTrip(t, client, server, p, okPayload)
+
+	ev := waitEvent(t, events)
+	if want := []string{"261", "0", doc, "9"}; !reflect.DeepEqual(ev.Args, want) {
+		t.Errorf("args = %q, want %q", ev.Args, want)
+	}
+	if want := []proxy.ArgType{proxy.ArgUint, proxy.ArgUint, proxy.ArgText, proxy.ArgInt}; !reflect.DeepEqual(ev.ArgTypes, want) {
+		t.Errorf("arg types = %q, want %q", ev.ArgTypes, want)
+	}
+}
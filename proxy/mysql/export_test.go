@@ -0,0 +1,44 @@
+package mysql
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// Exported wrappers for internal symbols used in package-external tests.
+
+// GreetingVersion exposes greetingVersion for testing.
+var GreetingVersion = greetingVersion
+
+// ConnOption configures the conn run by Relay.
+type ConnOption func(*conn)
+
+// WithResultColumns turns on capturing result column counts.
+var WithResultColumns ConnOption = func(c *conn) { c.resultColumns = true }
+
+// Relay runs the full handshake and command relay between clientConn and
+// upstreamConn, sending captured events to events. Statements running longer
+// than inFlightDelay produce a provisional in-flight event.
+func Relay(
+	ctx context.Context, clientConn, upstreamConn net.Conn, events chan proxy.Event, inFlightDelay time.Duration,
+	opts ...ConnOption,
+) error {
+	c := newConn(clientConn, upstreamConn, events)
+	c.pending.Delay = inFlightDelay
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c.relay(ctx)
+}
+
+// RelayInfo is Relay reporting the server info of the handshake to info.
+func RelayInfo(
+	ctx context.Context, clientConn, upstreamConn net.Conn, events chan proxy.Event, info func(proxy.ServerInfo),
+) error {
+	c := newConn(clientConn, upstreamConn, events)
+	c.onHandshake = info
+	return c.relay(ctx)
+}
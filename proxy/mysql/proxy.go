@@ -2,10 +2,14 @@ package mysql
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"net"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/mickamy/sql-tap/proxy"
 )
@@ -15,80 +19,232 @@ var _ proxy.Proxy = (*Proxy)(nil)
 // Proxy is a TCP proxy that sits between a MySQL client and server,
 // capturing query events from the wire protocol.
 type Proxy struct {
-	listenAddr   string
-	upstreamAddr string
-	events       chan proxy.Event
-	listener     net.Listener
-	wg           sync.WaitGroup
+	listenAddr string
+	upstreams  *proxy.Upstreams
+	events     chan proxy.Event
+	overflow   proxy.Overflow
+	columns    bool           // capture result column counts; see SetResultColumns
+	dropped    atomic.Uint64  // events dropped because events was full
+	wg         sync.WaitGroup // one per connection
+	closed     sync.Once      // closes events
+	proxy.ServerInfoStore
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{} // open connections
+	closing  bool               // Shutdown or Close was called; no new connections
 }
 
 // New creates a new MySQL proxy.
 func New(listenAddr, upstreamAddr string) *Proxy {
+	return NewWithBuffer(listenAddr, upstreamAddr, proxy.DefaultBufferSize, proxy.DropNewest)
+}
+
+// NewWithBuffer creates a MySQL proxy whose events channel holds
+// bufSize events and handles a full channel as overflow says. With
+// proxy.Block, a slow consumer of Events stalls the relayed connections.
+func NewWithBuffer(listenAddr, upstreamAddr string, bufSize int, overflow proxy.Overflow) *Proxy {
+	return NewWithUpstreams(listenAddr, proxy.NewUpstreams(upstreamAddr), bufSize, overflow)
+}
+
+// NewWithUpstreams is like NewWithBuffer, but relays each client connection
+// to the upstream picked for it by upstreams. proxy.ByDatabase routing is not
+// supported: the server greets the client before the client names a database,
+// so every connection goes to the upstreams for unlisted databases.
+func NewWithUpstreams(listenAddr string, upstreams *proxy.Upstreams, bufSize int, overflow proxy.Overflow) *Proxy {
 	return &Proxy{
-		listenAddr:   listenAddr,
-		upstreamAddr: upstreamAddr,
-		events:       make(chan proxy.Event, 256),
+		listenAddr: listenAddr,
+		upstreams:  upstreams,
+		events:     make(chan proxy.Event, bufSize),
+		overflow:   overflow,
+		conns:      make(map[*conn]struct{}),
 	}
 }
 
-// Events returns the channel of captured events.
+// Events returns the channel of captured events. It is closed once Shutdown
+// or Close has ended all connections.
 func (p *Proxy) Events() <-chan proxy.Event {
 	return p.events
 }
 
-// ListenAndServe starts accepting client connections and relaying them to MySQL.
+// Dropped returns the number of events dropped, or evicted under
+// proxy.DropOldest, because the events channel was full.
+func (p *Proxy) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// SetResultColumns turns on recording the column count of each result set
+// in Event.ResultColumns. It is off by default and must be set before
+// serving.
+func (p *Proxy) SetResultColumns(on bool) {
+	p.columns = on
+}
+
+// ListenAndServe starts accepting client connections and relaying them to
+// MySQL. It returns nil once ctx is done or Shutdown or Close is called.
+// Connections accepted by then keep running until Shutdown or Close ends them.
 func (p *Proxy) ListenAndServe(ctx context.Context) error {
 	var lc net.ListenConfig
 	lis, err := lc.Listen(ctx, "tcp", p.listenAddr)
 	if err != nil {
 		return fmt.Errorf("mysql: listen: %w", err)
 	}
+	return p.Serve(ctx, lis)
+}
+
+// Serve is like ListenAndServe, but accepts client connections on lis, e.g.
+// one on a port the system picked, instead of listening itself. lis is
+// closed when Serve returns.
+func (p *Proxy) Serve(ctx context.Context, lis net.Listener) error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		_ = lis.Close()
+		return nil
+	}
 	p.listener = lis
+	p.mu.Unlock()
 
 	go func() {
 		<-ctx.Done()
 		_ = lis.Close()
 	}()
 
+	// Connections outlive ctx, which only stops accepting.
+	connCtx := context.WithoutCancel(ctx)
 	for {
 		clientConn, err := lis.Accept()
 		if err != nil {
-			if ctx.Err() != nil {
-				return fmt.Errorf("mysql: accept: %w", ctx.Err())
+			if ctx.Err() != nil || p.stopped() {
+				return nil
 			}
+			_ = lis.Close()
 			return fmt.Errorf("mysql: accept: %w", err)
 		}
+		p.serve(connCtx, clientConn)
+	}
+}
 
-		p.wg.Go(func() {
-			p.handleConn(ctx, clientConn)
-		})
+// serve handles clientConn unless the proxy is shutting down.
+func (p *Proxy) serve(ctx context.Context, clientConn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		_ = clientConn.Close()
+		return
 	}
+	p.wg.Go(func() {
+		p.handleConn(ctx, clientConn)
+	})
 }
 
-// Close stops the proxy and waits for all connections to finish.
-func (p *Proxy) Close() error {
+// stopped reports whether Shutdown or Close was called.
+func (p *Proxy) stopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closing
+}
+
+// stopAccepting closes the listener and returns the open connections.
+func (p *Proxy) stopAccepting() ([]*conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closing = true
+	var err error
 	if p.listener != nil {
-		if err := p.listener.Close(); err != nil {
-			return fmt.Errorf("mysql: close listener: %w", err)
+		if cerr := p.listener.Close(); cerr != nil && !errors.Is(cerr, net.ErrClosed) {
+			err = fmt.Errorf("mysql: close listener: %w", cerr)
+		}
+	}
+	return slices.Collect(maps.Keys(p.conns)), err
+}
+
+// track registers c as open, or reports false if the proxy is shutting down.
+func (p *Proxy) track(c *conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		return false
+	}
+	p.conns[c] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(c *conn) {
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+}
+
+// Shutdown stops accepting connections and closes each open one as soon as
+// no statement awaits a response and no transaction is open. If ctx is done
+// first, it closes the remaining connections, cutting off their statements,
+// and returns ctx's error. Either way, Events is closed on return.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	conns, err := p.stopAccepting()
+	for _, c := range conns {
+		c.drain()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		for _, c := range conns {
+			_ = c.clientConn.Close()
 		}
+		<-done
+		err = fmt.Errorf("mysql: shutdown: %w", ctx.Err())
+	}
+	p.closed.Do(func() { close(p.events) })
+	return err
+}
+
+// Close stops accepting connections, closes the open ones and waits for
+// their goroutines to finish. Events is closed on return.
+func (p *Proxy) Close() error {
+	conns, err := p.stopAccepting()
+	for _, c := range conns {
+		_ = c.clientConn.Close()
 	}
 	p.wg.Wait()
-	return nil
+	p.closed.Do(func() { close(p.events) })
+	return err
 }
 
 func (p *Proxy) handleConn(ctx context.Context, clientConn net.Conn) {
 	defer func() { _ = clientConn.Close() }()
 
+	// The server speaks first, before the client names a database, so the
+	// upstream is picked without one.
+	addr, ok := p.upstreams.Pick("")
+	if !ok {
+		slog.Error("mysql: no upstream for connections without a listed database",
+			"client", clientConn.RemoteAddr().String())
+		return
+	}
 	var d net.Dialer
-	upstreamConn, err := d.DialContext(ctx, "tcp", p.upstreamAddr)
+	upstreamConn, err := d.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		log.Printf("mysql: dial upstream %s: %v", p.upstreamAddr, err)
+		slog.Error("mysql: dial upstream", "upstream", addr, "err", err)
 		return
 	}
 	defer func() { _ = upstreamConn.Close() }()
 
 	c := newConn(clientConn, upstreamConn, p.events)
+	c.overflow = p.overflow
+	c.dropped = &p.dropped
+	c.resultColumns = p.columns
+	c.onHandshake = p.SetServerInfo
+	if !p.track(c) {
+		return
+	}
+	defer p.untrack(c)
 	if err := c.relay(ctx); err != nil {
-		log.Printf("mysql: relay %s: %v", clientConn.RemoteAddr(), err)
+		slog.Warn("mysql: relay", "client", clientConn.RemoteAddr().String(), "err", err)
 	}
 }
@@ -1,14 +1,18 @@
 package mysql_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	mysqldrv "github.com/go-sql-driver/mysql"
 	"github.com/testcontainers/testcontainers-go/modules/mysql"
 
 	"github.com/mickamy/sql-tap/proxy"
@@ -53,6 +57,13 @@ func startMySQL(t *testing.T) string {
 
 func startProxy(t *testing.T, upstream string) (*mproxy.Proxy, string) {
 	t.Helper()
+	return startProxyUpstreams(t, proxy.NewUpstreams(upstream))
+}
+
+// startProxyUpstreams starts a proxy relaying to upstreams on a free local
+// port and returns it with its address.
+func startProxyUpstreams(t *testing.T, upstreams *proxy.Upstreams) (*mproxy.Proxy, string) {
+	t.Helper()
 
 	// Find an available port.
 	var lc net.ListenConfig
@@ -63,7 +74,7 @@ func startProxy(t *testing.T, upstream string) (*mproxy.Proxy, string) {
 	addr := lis.Addr().String()
 	_ = lis.Close()
 
-	p := mproxy.New(addr, upstream)
+	p := mproxy.NewWithUpstreams(addr, upstreams, proxy.DefaultBufferSize, proxy.DropNewest)
 	ctx, cancel := context.WithCancel(t.Context())
 
 	go func() {
@@ -135,6 +146,32 @@ func TestSimpleQuery(t *testing.T) {
 	}
 }
 
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+	upstream := startMySQL(t)
+	p, addr := startProxy(t, upstream)
+	if _, ok := p.ServerInfo(); ok {
+		t.Fatal("ServerInfo reported before any connection")
+	}
+	db := openDB(t, addr)
+
+	var version string
+	if err := db.QueryRowContext(t.Context(), "SELECT VERSION()").Scan(&version); err != nil {
+		t.Fatalf("query version: %v", err)
+	}
+
+	info, ok := p.ServerInfo()
+	if !ok {
+		t.Fatal("ServerInfo not reported after a connection")
+	}
+	if info.Version != version {
+		t.Errorf("version = %q, want %q", info.Version, version)
+	}
+	if info.TLS || info.Compression {
+		t.Errorf("info = %+v, want neither TLS nor compression", info)
+	}
+}
+
 func TestSelectRows(t *testing.T) {
 	t.Parallel()
 	upstream := startMySQL(t)
@@ -282,6 +319,101 @@ func TestPreparedStatementStringArgs(t *testing.T) {
 	}
 }
 
+func TestPreparedStatementReexecuted(t *testing.T) {
+	t.Parallel()
+	upstream := startMySQL(t)
+	p, addr := startProxy(t, upstream)
+	db := openDB(t, addr)
+	db.SetMaxOpenConns(1) // keep the statement on one server connection
+
+	ctx := t.Context()
+	stmt, err := db.PrepareContext(ctx, "SELECT ? * 2")
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, arg := range []int64{21, 1 << 40} {
+		var result int64
+		if err := stmt.QueryRowContext(ctx, arg).Scan(&result); err != nil {
+			t.Fatalf("query row %d: %v", arg, err)
+		}
+		ev := waitEvent(t, p.Events())
+		if ev.Op != proxy.OpExecute || ev.Query != "SELECT ? * 2" {
+			t.Fatalf("event = %v %q, want the prepared statement", ev.Op, ev.Query)
+		}
+		if want := []string{strconv.FormatInt(arg, 10)}; !slices.Equal(ev.Args, want) {
+			t.Errorf("execution with %d: args = %q, want %q", arg, ev.Args, want)
+		}
+	}
+}
+
+func TestPreparedStatementLongData(t *testing.T) {
+	t.Parallel()
+	upstream := startMySQL(t)
+	p, addr := startProxy(t, upstream)
+
+	// A small maxAllowedPacket makes the driver send large args with
+	// COM_STMT_SEND_LONG_DATA instead of inline.
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?timeout=5s&maxAllowedPacket=1024", testUser, testPassword, addr, testDB)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	ctx := t.Context()
+	stmt, err := db.PrepareContext(ctx, "SELECT LENGTH(?)")
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	var n int
+	if err := stmt.QueryRowContext(ctx, blob).Scan(&n); err != nil {
+		t.Fatalf("query row: %v", err)
+	}
+	if n != len(blob) {
+		t.Errorf("LENGTH = %d, want %d", n, len(blob))
+	}
+
+	ev := waitEvent(t, p.Events())
+	if ev.Op != proxy.OpExecute || ev.Query != "SELECT LENGTH(?)" {
+		t.Fatalf("event = %v %q, want the prepared statement", ev.Op, ev.Query)
+	}
+	if len(ev.Args) != 1 || ev.Args[0] != string(blob) {
+		t.Errorf("args = %d values, want the %d-byte blob", len(ev.Args), len(blob))
+	}
+}
+
+func TestWarningCount(t *testing.T) {
+	t.Parallel()
+	upstream := startMySQL(t)
+	p, addr := startProxy(t, upstream)
+	db := openDB(t, addr)
+	db.SetMaxOpenConns(1) // sql_mode is per connection
+
+	ctx := t.Context()
+	for _, q := range []string{
+		"SET SESSION sql_mode = ''",
+		"CREATE TABLE warn_test (v TINYINT)",
+	} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		waitEvent(t, p.Events())
+	}
+
+	// Out of range in non-strict mode: stored as 127 with warning 1264.
+	if _, err := db.ExecContext(ctx, "INSERT INTO warn_test VALUES (1000)"); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if ev := waitEvent(t, p.Events()); ev.Warnings != 1 {
+		t.Errorf("insert: warnings = %d, want 1", ev.Warnings)
+	}
+}
+
 func TestTransactionDetection(t *testing.T) {
 	t.Parallel()
 	upstream := startMySQL(t)
@@ -342,3 +474,122 @@ func TestErrorCapture(t *testing.T) {
 		t.Error("expected non-empty error")
 	}
 }
+
+func TestCachingSha2FullAuth(t *testing.T) {
+	t.Parallel()
+	upstream := startMySQL(t)
+	_, addr := startProxy(t, upstream)
+
+	const (
+		user     = "sha2_user"
+		password = `p@ss:w/rd#;?"'\`
+	)
+	ctx := t.Context()
+
+	// Create the user directly upstream; FLUSH PRIVILEGES empties the
+	// caching_sha2_password cache, so the login below needs full auth.
+	admin, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s?timeout=5s", testUser, testPassword, upstream, testDB))
+	if err != nil {
+		t.Fatalf("open admin db: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	for _, q := range []string{
+		"CREATE USER '" + user + "'@'%' IDENTIFIED WITH caching_sha2_password BY " + quoteString(password),
+		"GRANT ALL ON " + testDB + ".* TO '" + user + "'@'%'",
+		"FLUSH PRIVILEGES",
+	} {
+		if _, err := admin.ExecContext(ctx, q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	cfg := mysqldrv.NewConfig()
+	cfg.User = user
+	cfg.Passwd = password
+	cfg.Net = "tcp"
+	cfg.Addr = addr
+	cfg.DBName = testDB
+	cfg.Timeout = 5 * time.Second
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatalf("login through the proxy: %v", err)
+	}
+}
+
+// quoteString quotes s as a MySQL string literal.
+func quoteString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + r.Replace(s) + "'"
+}
+
+// startFakeUpstream listens on a free port and reports name on hits for every
+// connection it accepts. It never greets, so relayed clients just wait.
+func startFakeUpstream(t *testing.T, name string, hits chan<- string) string {
+	t.Helper()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			hits <- name
+			go func() {
+				<-t.Context().Done()
+				_ = conn.Close()
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestRoundRobinUpstreams(t *testing.T) {
+	t.Parallel()
+
+	hits := make(chan string, 8)
+	a := startFakeUpstream(t, "a", hits)
+	b := startFakeUpstream(t, "b", hits)
+	_, addr := startProxyUpstreams(t, proxy.NewUpstreams(a, b))
+
+	wait := func() string {
+		t.Helper()
+		select {
+		case h := <-hits:
+			return h
+		case <-time.After(3 * time.Second):
+			t.Fatal("timed out waiting for an upstream connection")
+			return ""
+		}
+	}
+	// The server speaks first, so even startProxyUpstreams' readiness probe
+	// was relayed, to the first upstream.
+	if got := wait(); got != "a" {
+		t.Fatalf("probe went to %s, want a", got)
+	}
+
+	var got []string
+	for range 4 {
+		var d net.Dialer
+		conn, err := d.DialContext(t.Context(), "tcp", addr)
+		if err != nil {
+			t.Fatalf("dial proxy: %v", err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		got = append(got, wait())
+	}
+	if want := []string{"b", "a", "b", "a"}; !slices.Equal(got, want) {
+		t.Errorf("upstreams = %v, want %v", got, want)
+	}
+}
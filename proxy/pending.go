@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// Pending is the statement a connection awaits the response to. It is
+// guarded by the connection's lock: Set takes it, the other methods must be
+// called with it held. A statement still pending after Delay is emitted as a
+// provisional in-flight event.
+type Pending struct {
+	Delay time.Duration // InFlightDelay unless changed before Set
+
+	mu    sync.Locker
+	emit  func(Event)
+	ev    *Event
+	timer *time.Timer
+}
+
+// NewPending returns a Pending guarded by mu that emits in-flight events with
+// emit.
+func NewPending(mu sync.Locker, emit func(Event)) *Pending {
+	return &Pending{Delay: InFlightDelay, mu: mu, emit: emit}
+}
+
+// Set records ev as awaiting a response, replacing the pending statement if
+// any, and schedules its in-flight event.
+func (p *Pending) Set(ev *Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+	p.ev = ev
+	p.timer = time.AfterFunc(p.Delay, func() { p.emitInFlight(ev) })
+}
+
+// Event returns the pending statement, or nil if there is none.
+func (p *Pending) Event() *Event {
+	return p.ev
+}
+
+// Take returns the pending statement, or nil if there is none, and clears
+// it: its response arrived.
+func (p *Pending) Take() *Event {
+	ev := p.ev
+	p.ev = nil
+	p.stop()
+	return ev
+}
+
+// Abort emits the pending statement, if any, as failed with ErrConnClosed
+// and clears it, so that a statement cut off by the client or the server is
+// not lost. Unlike the other methods, it takes the lock itself.
+func (p *Pending) Abort() {
+	p.mu.Lock()
+	ev := p.Take()
+	p.mu.Unlock()
+	if ev == nil {
+		return
+	}
+	ev.Duration = time.Since(ev.StartTime)
+	ev.Error = ErrConnClosed.Error()
+	p.emit(*ev)
+}
+
+// stop cancels the in-flight event of the pending statement.
+func (p *Pending) stop() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+}
+
+// emitInFlight emits a provisional copy of ev if it is still pending. The
+// lock is held while sending so that the completed event cannot overtake it.
+func (p *Pending) emitInFlight(ev *Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ev != ev {
+		return
+	}
+	inFlight := *ev
+	inFlight.InFlight = true
+	p.emit(inFlight)
+}
@@ -0,0 +1,82 @@
+package proxy_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestPending(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	emitted := make(chan proxy.Event, 2)
+	p := proxy.NewPending(&mu, func(ev proxy.Event) { emitted <- ev })
+	p.Delay = 10 * time.Millisecond
+
+	// A statement answered in time emits no in-flight event.
+	fast := &proxy.Event{Query: "SELECT 1"}
+	p.Set(fast)
+	mu.Lock()
+	if got := p.Take(); got != fast {
+		t.Errorf("Take = %v, want the pending statement", got)
+	}
+	if got := p.Event(); got != nil {
+		t.Errorf("Event after Take = %v, want nil", got)
+	}
+	mu.Unlock()
+
+	// A slow one does, once.
+	slow := &proxy.Event{Query: "SELECT pg_sleep(1)"}
+	p.Set(slow)
+	select {
+	case ev := <-emitted:
+		if !ev.InFlight || ev.Query != slow.Query {
+			t.Errorf("emitted %+v, want the slow statement in flight", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no in-flight event for the slow statement")
+	}
+	mu.Lock()
+	p.Take()
+	mu.Unlock()
+
+	time.Sleep(30 * time.Millisecond)
+	if len(emitted) != 0 {
+		t.Errorf("%d more events emitted, want none", len(emitted))
+	}
+}
+
+func TestPendingAbort(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	emitted := make(chan proxy.Event, 1)
+	p := proxy.NewPending(&mu, func(ev proxy.Event) { emitted <- ev })
+	p.Delay = time.Minute
+
+	p.Abort()
+	select {
+	case ev := <-emitted:
+		t.Fatalf("Abort without a pending statement emitted %+v", ev)
+	default:
+	}
+
+	p.Set(&proxy.Event{Query: "SELECT pg_sleep(10)", StartTime: time.Now()})
+	p.Abort()
+	select {
+	case ev := <-emitted:
+		if ev.Error != proxy.ErrConnClosed.Error() || ev.InFlight {
+			t.Errorf("aborted event = %+v, want error %q", ev, proxy.ErrConnClosed)
+		}
+	default:
+		t.Fatal("Abort emitted no event")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := p.Event(); got != nil {
+		t.Errorf("Event after Abort = %v, want nil", got)
+	}
+}
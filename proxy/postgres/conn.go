@@ -1,21 +1,25 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	pgproto "github.com/jackc/pgproto3/v2"
 
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 // encoder is satisfied by both FrontendMessage and BackendMessage.
@@ -23,8 +27,15 @@ type encoder interface {
 	Encode(dst []byte) ([]byte, error)
 }
 
-// Timestamp type OIDs in the PostgreSQL type catalog.
+// Type OIDs in the PostgreSQL type catalog.
 const (
+	oidBool        uint32 = 16
+	oidInt8        uint32 = 20
+	oidInt2        uint32 = 21
+	oidInt4        uint32 = 23
+	oidOID         uint32 = 26
+	oidFloat4      uint32 = 700
+	oidFloat8      uint32 = 701
 	oidTimestamp   uint32 = 1114
 	oidTimestampTZ uint32 = 1184
 )
@@ -39,47 +50,90 @@ type conn struct {
 
 	clientConn   net.Conn
 	upstreamConn net.Conn
-	events       chan<- proxy.Event
+	events       chan proxy.Event
+	overflow     proxy.Overflow
+	dropped      *atomic.Uint64 // the proxy's count of events dropped by emitEvent
+	// resultColumns enables recording the column count of result sets.
+	resultColumns bool
 
-	// Extended query state.
-	// preparedStmts is only accessed by the client→upstream goroutine.
+	// Extended query state, keyed by statement or portal name ("" for the
+	// unnamed one). preparedStmts and portals are only accessed by the
+	// client→upstream goroutine.
 	preparedStmts    map[string]string   // stmt name -> query
 	preparedStmtOIDs map[string][]uint32 // stmt name -> parameter OIDs
-	lastParse        string              // query from most recent Parse
-	lastParamOIDs    []uint32            // parameter OIDs from most recent Parse
-	lastBindArgs     []string            // args from most recent Bind
-	lastBindStmt     string              // stmt name from most recent Bind
+	portals          map[string]portal   // portal name -> bound statement
 	// pendingDescribes is a FIFO queue of statement names from Describe('S')
 	// messages. ParameterDescription responses arrive in the same order, so
 	// we pop from the front to match each response to its request.
 	pendingDescribes []string
+	// describedStmt is the statement whose ParameterDescription was matched
+	// last; the RowDescription (or NoData) that follows belongs to it.
+	describedStmt  string
+	describingStmt bool
+	// stmtColumns holds the result column count of described statements,
+	// used for Executes whose RowDescription arrived before the Execute.
+	stmtColumns map[string]int
 
 	// stmtMu protects OID-related fields that are written by
 	// handleParameterDescription (upstream→client goroutine) and read by
 	// handleBind / written by handleParse (client→upstream goroutine).
 	stmtMu sync.Mutex
 
-	// Transaction tracking.
+	// startupParams are the parameters of the client's StartupMessage
+	// (user, database, options, replication, ...).
+	startupParams map[string]string
+	// serverInfo is filled from the ParameterStatus messages sent during
+	// startup. SSL and GSS encryption are always declined, so TLS is false.
+	serverInfo proxy.ServerInfo
+	// onHandshake, if set, receives serverInfo once startup completes.
+	onHandshake func(proxy.ServerInfo)
+	// dialDatabase and dialCancel connect upstreamConn when the conn is
+	// created without one: to the upstream for the StartupMessage's database,
+	// or to the one running the session a CancelRequest names by its key.
+	dialDatabase func(database string) (net.Conn, error)
+	dialCancel   func(key string) (net.Conn, error)
+	// onBackendKey, if set, receives the session's cancel key from the
+	// BackendKeyData sent during startup.
+	onBackendKey func(key string)
+
+	// Transaction tracking. activeTxID, access, txFailed and syncs are
+	// guarded by mu: they are set from the client's statements and corrected
+	// from the transaction status of the server's ReadyForQuery.
 	activeTxID string
-	nextID     uint64
+	access     proxy.AccessTracker
+	txFailed   bool // the server reported the transaction as failed ('E')
+	syncs      int  // Query and Sync messages not yet answered by ReadyForQuery
+
+	// draining is set by drain: the conn closes as soon as it is idle.
+	draining atomic.Bool
 
-	mu      sync.Mutex   // protects pending
-	pending *proxy.Event // event waiting for upstream response
+	mu      sync.Mutex     // protects pending, copying, session and transaction tracking
+	pending *proxy.Pending // event waiting for upstream response
+	copying bool           // pending is a COPY whose data is being streamed
+	session query.Session  // session variables changed by SET statements
 }
 
-func newConn(clientConn, upstreamConn net.Conn, events chan<- proxy.Event) *conn {
-	return &conn{
+func newConn(clientConn, upstreamConn net.Conn, events chan proxy.Event) *conn {
+	c := &conn{
 		clientConn:       clientConn,
 		upstreamConn:     upstreamConn,
 		events:           events,
+		dropped:          new(atomic.Uint64),
 		preparedStmts:    make(map[string]string),
 		preparedStmtOIDs: make(map[string][]uint32),
+		portals:          make(map[string]portal),
+		stmtColumns:      make(map[string]int),
 	}
+	c.pending = proxy.NewPending(&c.mu, c.emitEvent)
+	return c
 }
 
-func (c *conn) generateID() string {
-	c.nextID++
-	return strconv.FormatUint(c.nextID, 10)
+// portal is a statement bound to parameters by Bind, run by Execute.
+type portal struct {
+	stmt     string // prepared statement name
+	query    string // statement text at Bind time; a later Parse may replace the statement
+	args     []string
+	argTypes []proxy.ArgType
 }
 
 // encodeAndWrite encodes a protocol message and writes it to dst.
@@ -97,9 +151,18 @@ func encodeAndWrite(dst net.Conn, msg encoder) error {
 // relay handles the startup phase and then enters bidirectional message relay.
 func (c *conn) relay(ctx context.Context) error {
 	if err := c.relayStartup(); err != nil {
+		if errors.Is(err, errCancelRequest) {
+			return nil
+		}
 		return fmt.Errorf("postgres: startup: %w", err)
 	}
 
+	if mode, ok := c.replicationMode(); ok {
+		slog.Info("postgres: replication connection, relaying without capture",
+			"client", c.clientConn.RemoteAddr().String(), "replication", mode)
+		return c.passthrough()
+	}
+
 	errCh := make(chan error, 2)
 
 	go func() { errCh <- c.relayClientToUpstream(ctx) }()
@@ -113,17 +176,70 @@ func (c *conn) relay(ctx context.Context) error {
 	// Wait for the second goroutine.
 	<-errCh
 
+	c.mu.Lock()
+	c.copying = false
+	c.mu.Unlock()
+	c.pending.Abort()
 	return err
 }
 
+// replicationMode reports whether the client asked for a walsender connection
+// via the replication startup parameter ("database" for logical replication,
+// a true boolean for physical). Such connections speak the streaming
+// replication sub-protocol (CopyBoth), which the message parser would desync on.
+func (c *conn) replicationMode() (string, bool) {
+	mode, ok := c.startupParams["replication"]
+	if !ok {
+		return "", false
+	}
+	switch strings.ToLower(mode) {
+	case "", "false", "off", "no", "0":
+		return mode, false
+	}
+	return mode, true
+}
+
+// passthrough copies bytes in both directions without parsing or capturing
+// anything, until either side closes.
+func (c *conn) passthrough() error {
+	errCh := make(chan error, 2)
+	cp := func(dst, src net.Conn) {
+		_, err := io.Copy(dst, src)
+		errCh <- err
+	}
+	go cp(c.upstreamConn, c.clientConn)
+	go cp(c.clientConn, c.upstreamConn)
+
+	err := <-errCh
+	_ = c.clientConn.Close()
+	_ = c.upstreamConn.Close()
+	<-errCh
+
+	if err != nil && !isClosedErr(err) {
+		return fmt.Errorf("postgres: passthrough: %w", err)
+	}
+	return nil
+}
+
 const (
+	cancelRequestCode = 80877102
 	sslRequestCode    = 80877103
 	gssEncRequestCode = 80877104
 
+	// protocolMajor is the only frontend/backend protocol major version the
+	// proxy understands (PostgreSQL 7.4 and later). Minor versions are
+	// negotiated by the server with NegotiateProtocolVersion, which is
+	// relayed like any other startup message.
+	protocolMajor = 3
+
 	authTypeOk        = 0
 	authTypeSASLFinal = 12
 )
 
+// errCancelRequest reports that the connection carried a CancelRequest, which
+// has been forwarded upstream. No session follows on such a connection.
+var errCancelRequest = errors.New("postgres: cancel request")
+
 // relayStartup handles the startup/auth phase using raw byte relay to avoid
 // re-encoding issues with SCRAM and other auth mechanisms. Protocol parsers
 // (Backend/Frontend) are created only after auth completes.
@@ -152,6 +268,29 @@ func (c *conn) relayStartup() error {
 			}
 		}
 
+		// A CancelRequest arrives on its own connection; pass it on and stop.
+		if len(raw) == 16 && binary.BigEndian.Uint32(raw[4:8]) == cancelRequestCode {
+			if err := c.connectUpstream(func() (net.Conn, error) { return c.dialCancel(string(raw[8:])) }); err != nil {
+				return err
+			}
+			if _, err := c.upstreamConn.Write(raw); err != nil {
+				return fmt.Errorf("postgres: send cancel request: %w", err)
+			}
+			return errCancelRequest
+		}
+
+		if err := c.checkStartup(raw); err != nil {
+			return err
+		}
+		if err := c.connectUpstream(func() (net.Conn, error) { return c.dialDatabase(c.database()) }); err != nil {
+			_ = encodeAndWrite(c.clientConn, &pgproto.ErrorResponse{
+				Severity: "FATAL",
+				Code:     "08001", // sqlclient_unable_to_establish_sqlconnection
+				Message:  "sql-tap: " + err.Error(),
+			})
+			return err
+		}
+
 		if _, err := c.upstreamConn.Write(raw); err != nil {
 			return fmt.Errorf("postgres: send startup: %w", err)
 		}
@@ -173,9 +312,21 @@ func (c *conn) relayStartup() error {
 		case 'Z': // ReadyForQuery — auth complete.
 			c.client = pgproto.NewBackend(pgproto.NewChunkReader(c.clientConn), c.clientConn)
 			c.upstream = pgproto.NewFrontend(pgproto.NewChunkReader(c.upstreamConn), c.upstreamConn)
+			if c.onHandshake != nil {
+				c.onHandshake(c.serverInfo)
+			}
 			return nil
+		case 'K': // BackendKeyData: process ID and secret key
+			if c.onBackendKey != nil && len(msg) > 5 {
+				c.onBackendKey(string(msg[5:]))
+			}
+		case 'S': // ParameterStatus
+			var ps pgproto.ParameterStatus
+			if err := ps.Decode(msg[5:]); err == nil && ps.Name == "server_version" {
+				c.serverInfo.Version = ps.Value
+			}
 		case 'E': // ErrorResponse
-			return errors.New("postgres: auth error from upstream")
+			return fmt.Errorf("postgres: auth error from upstream: %s", describeErrorResponse(msg[5:]))
 		case 'R': // Authentication message
 			if len(msg) >= 9 {
 				authType := binary.BigEndian.Uint32(msg[5:9])
@@ -194,6 +345,122 @@ func (c *conn) relayStartup() error {
 	}
 }
 
+// idle reports whether no statement awaits a response and no transaction is
+// open, so that closing the connection loses nothing.
+func (c *conn) idle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending.Event() == nil && c.syncs == 0 && c.activeTxID == ""
+}
+
+// drain makes the conn close once it is idle: right away if it is, or else
+// after relaying the ReadyForQuery that makes it so.
+func (c *conn) drain() {
+	c.draining.Store(true)
+	if c.idle() {
+		_ = c.clientConn.Close()
+	}
+}
+
+// connectUpstream sets upstreamConn to the connection made by dial, unless the
+// conn was created with one.
+func (c *conn) connectUpstream(dial func() (net.Conn, error)) error {
+	if c.upstreamConn != nil {
+		return nil
+	}
+	upstreamConn, err := dial()
+	if err != nil {
+		return err
+	}
+	c.upstreamConn = upstreamConn
+	return nil
+}
+
+// database returns the database named in the StartupMessage, which
+// PostgreSQL defaults to the user name.
+func (c *conn) database() string {
+	if db := c.startupParams["database"]; db != "" {
+		return db
+	}
+	return c.startupParams["user"]
+}
+
+// describeErrorResponse formats the body of an ErrorResponse the way libpq
+// reports it, e.g. `FATAL: password authentication failed for user "app"
+// (SQLSTATE 28P01)`.
+func describeErrorResponse(body []byte) string {
+	var e pgproto.ErrorResponse
+	if err := e.Decode(body); err != nil {
+		return fmt.Sprintf("malformed error response: %v", err)
+	}
+	return fmt.Sprintf("%s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+// checkStartup validates a StartupMessage and records its parameters. A client
+// speaking another protocol major version (e.g. the v2 protocol of pre-7.4
+// drivers) is told so in a format it can read, instead of being relayed into a
+// session the proxy would misparse.
+func (c *conn) checkStartup(raw []byte) error {
+	if len(raw) < 8 {
+		return errors.New("postgres: startup message too short")
+	}
+	version := binary.BigEndian.Uint32(raw[4:8])
+	major, minor := version>>16, version&0xffff
+	if major != protocolMajor {
+		msg := fmt.Sprintf("unsupported frontend protocol %d.%d: sql-tap supports protocol 3.x", major, minor)
+		_ = rejectStartup(c.clientConn, major, msg)
+		return fmt.Errorf("postgres: client uses protocol %d.%d, only 3.x is supported; "+
+			"upgrade the client driver or connect to PostgreSQL directly", major, minor)
+	}
+
+	params, err := parseStartupParams(raw[8:])
+	if err != nil {
+		return err
+	}
+	c.startupParams = params
+	return nil
+}
+
+// parseStartupParams decodes the NUL-terminated name/value pairs of a
+// StartupMessage body, which ends with an extra NUL.
+func parseStartupParams(body []byte) (map[string]string, error) {
+	params := make(map[string]string)
+	for len(body) > 0 && body[0] != 0 {
+		fields := make([]string, 2)
+		for i := range fields {
+			end := bytes.IndexByte(body, 0)
+			if end < 0 {
+				return nil, errors.New("postgres: malformed startup parameters")
+			}
+			fields[i] = string(body[:end])
+			body = body[end+1:]
+		}
+		params[fields[0]] = fields[1]
+	}
+	return params, nil
+}
+
+// rejectStartup sends a fatal error to a client whose protocol version is not
+// supported. v3 clients get an ErrorResponse; older ones the v2 format, a bare
+// 'E' followed by a NUL-terminated message.
+func rejectStartup(w io.Writer, major uint32, msg string) error {
+	var buf []byte
+	if major >= protocolMajor {
+		var err error
+		buf, err = (&pgproto.ErrorResponse{Severity: "FATAL", Code: "0A000", Message: msg}).Encode(nil)
+		if err != nil {
+			return fmt.Errorf("postgres: encode error: %w", err)
+		}
+	} else {
+		buf = append([]byte{'E'}, msg...)
+		buf = append(buf, 0)
+	}
+	if _, err := w.Write(buf); err != nil {
+		return fmt.Errorf("postgres: send error: %w", err)
+	}
+	return nil
+}
+
 // readStartupRaw reads a startup-format message (no type byte): 4-byte length + payload.
 func readStartupRaw(r io.Reader) ([]byte, error) {
 	var hdr [4]byte
@@ -276,6 +543,9 @@ func (c *conn) relayUpstreamToClient(ctx context.Context) error {
 			}
 			return fmt.Errorf("postgres: send to client: %w", err)
 		}
+		if c.draining.Load() && c.idle() {
+			return nil
+		}
 	}
 }
 
@@ -290,7 +560,13 @@ func (c *conn) captureClientMsg(msg pgproto.FrontendMessage) {
 	case *pgproto.Bind:
 		c.handleBind(m)
 	case *pgproto.Execute:
-		c.handleExecute()
+		c.handleExecute(m)
+	case *pgproto.Close:
+		c.handleClose(m)
+	case *pgproto.CopyData:
+		c.handleCopyData(len(m.Data))
+	case *pgproto.Sync, *pgproto.FunctionCall:
+		c.expectReady()
 	}
 }
 
@@ -298,42 +574,126 @@ func (c *conn) captureUpstreamMsg(msg pgproto.BackendMessage) {
 	switch m := msg.(type) {
 	case *pgproto.ParameterDescription:
 		c.handleParameterDescription(m)
+	case *pgproto.RowDescription:
+		c.handleRowDescription(len(m.Fields))
+	case *pgproto.NoData:
+		c.handleRowDescription(0)
+	case *pgproto.CopyInResponse, *pgproto.CopyOutResponse:
+		c.handleCopyResponse()
+	case *pgproto.CopyData:
+		c.handleCopyData(len(m.Data))
+	case *pgproto.CopyDone:
+		c.handleCopyDone()
 	case *pgproto.CommandComplete:
 		c.handleCommandComplete(m)
+	case *pgproto.EmptyQueryResponse:
+		c.handleEmptyQuery()
 	case *pgproto.ErrorResponse:
 		c.handleErrorResponse(m)
 	case *pgproto.ReadyForQuery:
 		c.drainPendingDescribes()
+		c.handleReadyForQuery(m.TxStatus)
 	}
 }
 
 func (c *conn) handleSimpleQuery(m *pgproto.Query) {
 	q := m.String
+	c.expectReady()
+	c.forgetDeallocated(q)
 	r := c.detectTx(q, proxy.OpQuery)
 
 	ev := proxy.Event{
-		ID:        c.generateID(),
+		ID:        proxy.NewEventID(),
 		Op:        r.op,
 		Query:     q,
 		StartTime: time.Now(),
 		TxID:      r.txID,
+		ReadOnly:  r.readOnly,
+		TxFailed:  r.failed,
 	}
-	c.mu.Lock()
-	c.pending = &ev
-	c.mu.Unlock()
+	c.pending.Set(&ev)
 }
 
 func (c *conn) handleParse(m *pgproto.Parse) {
-	c.lastParse = m.Query
 	c.stmtMu.Lock()
-	c.lastParamOIDs = m.ParameterOIDs
-	if m.Name != "" {
-		c.preparedStmtOIDs[m.Name] = m.ParameterOIDs
+	c.preparedStmtOIDs[m.Name] = m.ParameterOIDs
+	delete(c.stmtColumns, m.Name)
+	c.stmtMu.Unlock()
+	c.preparedStmts[m.Name] = m.Query
+}
+
+// handleClose forgets a closed statement or portal.
+func (c *conn) handleClose(m *pgproto.Close) {
+	switch m.ObjectType {
+	case 'S':
+		c.forgetStmt(m.Name)
+	case 'P':
+		delete(c.portals, m.Name)
+	}
+}
+
+func (c *conn) forgetStmt(name string) {
+	delete(c.preparedStmts, name)
+	c.stmtMu.Lock()
+	delete(c.preparedStmtOIDs, name)
+	delete(c.stmtColumns, name)
+	c.stmtMu.Unlock()
+}
+
+// forgetDeallocated forgets the prepared statements q deallocates, with
+// DEALLOCATE name, DEALLOCATE ALL or DISCARD ALL. A pooler such as PgBouncer
+// runs these between the clients it hands a server connection to, and the
+// next client may prepare a different statement under a name just freed: a
+// Bind to the old statement must not pick up the old query. If the statement
+// fails, the statements are forgotten anyway; a Bind to one of them is then
+// captured without its query rather than with a wrong one.
+func (c *conn) forgetDeallocated(q string) {
+	name, all, ok := parseDeallocate(q)
+	if !ok {
+		return
+	}
+	if !all {
+		c.forgetStmt(name)
+		return
 	}
+	clear(c.preparedStmts)
+	c.stmtMu.Lock()
+	clear(c.preparedStmtOIDs)
+	clear(c.stmtColumns)
 	c.stmtMu.Unlock()
-	if m.Name != "" {
-		c.preparedStmts[m.Name] = m.Query
+}
+
+// parseDeallocate returns the statement name q deallocates, or all if it
+// deallocates every statement. ok is false if q is not a DEALLOCATE or
+// DISCARD ALL. An unquoted name is folded to lowercase, as the server does.
+func parseDeallocate(q string) (name string, all, ok bool) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(q), ";"))
+	if len(fields) < 2 {
+		return "", false, false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "DISCARD":
+		all = len(fields) == 2 && strings.EqualFold(fields[1], "ALL")
+		return "", all, all
+	case "DEALLOCATE":
+	default:
+		return "", false, false
+	}
+	rest := fields[1:]
+	if strings.EqualFold(rest[0], "PREPARE") {
+		rest = rest[1:]
+	}
+	if len(rest) != 1 {
+		return "", false, false
+	}
+	name = rest[0]
+	if strings.EqualFold(name, "ALL") {
+		return "", true, true
+	}
+	if unquoted, ok := strings.CutPrefix(name, `"`); ok {
+		return strings.ReplaceAll(strings.TrimSuffix(unquoted, `"`), `""`, `"`), false, true
 	}
+	return strings.ToLower(name), false, true
 }
 
 func (c *conn) handleDescribe(m *pgproto.Describe) {
@@ -359,14 +719,33 @@ func (c *conn) handleParameterDescription(m *pgproto.ParameterDescription) {
 	}
 	name := c.pendingDescribes[0]
 	c.pendingDescribes = c.pendingDescribes[1:]
+	c.describedStmt = name
+	c.describingStmt = true
+	c.preparedStmtOIDs[name] = m.ParameterOIDs
+}
 
-	if name == "" {
-		// Unnamed statement: update the fallback OIDs used by unnamed binds.
-		c.lastParamOIDs = m.ParameterOIDs
-	} else {
-		// Named statement: only update its entry without touching lastParamOIDs.
-		c.preparedStmtOIDs[name] = m.ParameterOIDs
+// handleRowDescription records the result column count. A RowDescription
+// answering a Describe(Statement) is remembered for that statement; one
+// answering a simple query or Describe(Portal) is attached to the pending event.
+// It does nothing unless result columns are captured.
+func (c *conn) handleRowDescription(columns int) {
+	if !c.resultColumns {
+		return
+	}
+	c.stmtMu.Lock()
+	if c.describingStmt {
+		c.describingStmt = false
+		c.stmtColumns[c.describedStmt] = columns
+		c.stmtMu.Unlock()
+		return
+	}
+	c.stmtMu.Unlock()
+
+	c.mu.Lock()
+	if ev := c.pending.Event(); ev != nil {
+		ev.ResultColumns = columns
 	}
+	c.mu.Unlock()
 }
 
 // drainPendingDescribes clears any unmatched Describe entries from the queue.
@@ -375,31 +754,51 @@ func (c *conn) handleParameterDescription(m *pgproto.ParameterDescription) {
 func (c *conn) drainPendingDescribes() {
 	c.stmtMu.Lock()
 	c.pendingDescribes = nil
+	c.describingStmt = false
 	c.stmtMu.Unlock()
 }
 
 func (c *conn) handleBind(m *pgproto.Bind) {
-	c.lastBindStmt = m.PreparedStatement
 	c.stmtMu.Lock()
-	paramOIDs := c.lastParamOIDs
-	if m.PreparedStatement != "" {
-		if oids, ok := c.preparedStmtOIDs[m.PreparedStatement]; ok {
-			paramOIDs = oids
-		}
-	}
+	paramOIDs := c.preparedStmtOIDs[m.PreparedStatement]
 	c.stmtMu.Unlock()
-	c.lastBindArgs = make([]string, len(m.Parameters))
+	args := make([]string, len(m.Parameters))
+	argTypes := make([]proxy.ArgType, len(m.Parameters))
 	for i, p := range m.Parameters {
 		oid := uint32(0)
 		if i < len(paramOIDs) {
 			oid = paramOIDs[i]
 		}
+		argTypes[i] = argType(p, oid)
 		if isBinaryFormat(m.ParameterFormatCodes, i) {
-			c.lastBindArgs[i] = decodeBinaryParam(p, oid)
+			args[i] = decodeBinaryParam(p, oid)
 		} else {
-			c.lastBindArgs[i] = string(p)
+			args[i] = string(p)
 		}
 	}
+	c.portals[m.DestinationPortal] = portal{
+		stmt:     m.PreparedStatement,
+		query:    c.preparedStmts[m.PreparedStatement],
+		args:     args,
+		argTypes: argTypes,
+	}
+}
+
+// argType returns the ArgType of parameter value p of type oid, which is 0
+// if the type is unknown.
+func argType(p []byte, oid uint32) proxy.ArgType {
+	if p == nil {
+		return proxy.ArgNull
+	}
+	switch oid {
+	case oidInt2, oidInt4, oidInt8, oidOID:
+		return proxy.ArgInt
+	case oidFloat4, oidFloat8:
+		return proxy.ArgFloat
+	case oidBool:
+		return proxy.ArgBool
+	}
+	return proxy.ArgText
 }
 
 // isBinaryFormat returns true if the i-th parameter uses binary format.
@@ -456,46 +855,95 @@ func decodePGTimestampMicros(microsecs int64) string {
 	return time.Unix(sec+pgEpochUnix, usec*1_000).UTC().Format(time.RFC3339Nano)
 }
 
-func (c *conn) handleExecute() {
-	q := c.lastParse
-	if c.lastBindStmt != "" {
-		if stored, ok := c.preparedStmts[c.lastBindStmt]; ok {
-			q = stored
-		}
-	}
+// handleExecute starts the event for the portal being executed, which
+// carries the statement and args of the Bind that created it.
+func (c *conn) handleExecute(m *pgproto.Execute) {
+	p := c.portals[m.Portal]
+	c.forgetDeallocated(p.query)
+	r := c.detectTx(p.query, proxy.OpExecute)
 
-	r := c.detectTx(q, proxy.OpExecute)
+	c.stmtMu.Lock()
+	columns := c.stmtColumns[p.stmt]
+	c.stmtMu.Unlock()
 
 	ev := proxy.Event{
-		ID:        c.generateID(),
-		Op:        r.op,
-		Query:     q,
-		Args:      c.lastBindArgs,
-		StartTime: time.Now(),
-		TxID:      r.txID,
+		ID:            proxy.NewEventID(),
+		Op:            r.op,
+		Query:         p.query,
+		Args:          p.args,
+		ArgTypes:      p.argTypes,
+		StartTime:     time.Now(),
+		TxID:          r.txID,
+		ReadOnly:      r.readOnly,
+		StmtName:      p.stmt,
+		ResultColumns: columns,
+		TxFailed:      r.failed,
+	}
+	c.pending.Set(&ev)
+}
+
+// handleCopyResponse marks the pending statement as a COPY: the upstream
+// switched to copy-in (FROM STDIN) or copy-out (TO STDOUT) mode, and
+// CopyData messages follow until CopyDone, then CommandComplete ("COPY n")
+// or ErrorResponse finishes the statement.
+func (c *conn) handleCopyResponse() {
+	c.mu.Lock()
+	c.copying = c.pending.Event() != nil
+	c.mu.Unlock()
+}
+
+// handleCopyData adds a CopyData message, sent by the client during copy-in
+// or by the upstream during copy-out, to the size of the pending COPY.
+func (c *conn) handleCopyData(n int) {
+	c.mu.Lock()
+	if c.copying {
+		c.pending.Event().CopyBytes += int64(n)
 	}
+	c.mu.Unlock()
+}
+
+// handleCopyDone ends a copy-out stream. A copy-in stream ends with the
+// client's CopyDone or CopyFail, which the upstream answers with
+// CommandComplete or ErrorResponse, so it needs no handling of its own.
+func (c *conn) handleCopyDone() {
 	c.mu.Lock()
-	c.pending = &ev
+	c.copying = false
 	c.mu.Unlock()
 }
 
 func (c *conn) handleCommandComplete(m *pgproto.CommandComplete) {
 	c.mu.Lock()
-	ev := c.pending
-	c.pending = nil
+	ev := c.pending.Take()
+	c.copying = false
+	proxy.TrackSession(&c.session, ev, true)
 	c.mu.Unlock()
 	if ev == nil {
 		return
 	}
 	ev.Duration = time.Since(ev.StartTime)
 	ev.RowsAffected = parseRowsAffected(string(m.CommandTag))
+	if ev.Op == proxy.OpCommit && string(m.CommandTag) == "ROLLBACK" {
+		// COMMIT of a failed transaction rolls it back.
+		ev.Op = proxy.OpRollback
+	}
 	c.emitEvent(*ev)
 }
 
+// handleEmptyQuery drops the pending statement, which was empty: the server
+// answers it with EmptyQueryResponse instead of CommandComplete. PgBouncer
+// sends one to check a server connection is alive.
+func (c *conn) handleEmptyQuery() {
+	c.mu.Lock()
+	c.pending.Take()
+	c.copying = false
+	c.mu.Unlock()
+}
+
 func (c *conn) handleErrorResponse(m *pgproto.ErrorResponse) {
 	c.mu.Lock()
-	ev := c.pending
-	c.pending = nil
+	ev := c.pending.Take()
+	c.copying = false
+	proxy.TrackSession(&c.session, ev, false)
 	c.mu.Unlock()
 	if ev == nil {
 		return
@@ -506,37 +954,81 @@ func (c *conn) handleErrorResponse(m *pgproto.ErrorResponse) {
 }
 
 type txDetectResult struct {
-	txID string
-	op   proxy.Op // overridden Op for BEGIN/COMMIT/ROLLBACK; zero means keep original
+	txID     string
+	op       proxy.Op // overridden Op for BEGIN/COMMIT/ROLLBACK; zero means keep original
+	readOnly bool     // statement runs in a read-only transaction or session
+	failed   bool     // statement runs in, or ends, a failed transaction
 }
 
 // detectTx updates transaction state and returns the txID and Op to use for the current event.
 func (c *conn) detectTx(query string, defaultOp proxy.Op) txDetectResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failed := c.txFailed && c.activeTxID != ""
 	upper := strings.ToUpper(strings.TrimSpace(query))
 	switch {
-	case strings.HasPrefix(upper, "BEGIN"):
+	case strings.HasPrefix(upper, "BEGIN"), strings.HasPrefix(upper, "START TRANSACTION"):
 		c.activeTxID = uuid.New().String()
-		return txDetectResult{txID: c.activeTxID, op: proxy.OpBegin}
+		c.txFailed = false
+		return txDetectResult{txID: c.activeTxID, op: proxy.OpBegin, readOnly: c.access.Begin(query)}
 	case strings.HasPrefix(upper, "COMMIT"):
 		prev := c.activeTxID
 		c.activeTxID = ""
-		return txDetectResult{txID: prev, op: proxy.OpCommit}
+		c.txFailed = false
+		return txDetectResult{txID: prev, op: proxy.OpCommit, readOnly: c.access.End(), failed: failed}
 	case strings.HasPrefix(upper, "ROLLBACK"):
 		prev := c.activeTxID
 		c.activeTxID = ""
-		return txDetectResult{txID: prev, op: proxy.OpRollback}
+		c.txFailed = false
+		return txDetectResult{txID: prev, op: proxy.OpRollback, readOnly: c.access.End(), failed: failed}
 	}
-	return txDetectResult{txID: c.activeTxID, op: defaultOp}
+	ro := c.access.Observe(query, c.activeTxID != "")
+	return txDetectResult{txID: c.activeTxID, op: defaultOp, readOnly: ro, failed: failed}
 }
 
-func (c *conn) emitEvent(ev proxy.Event) {
-	select {
-	case c.events <- ev:
-	default:
-		// channel full; drop
+// expectReady counts a client message the server answers with ReadyForQuery:
+// a simple Query, a Sync ending an extended-query batch, or a FunctionCall.
+func (c *conn) expectReady() {
+	c.mu.Lock()
+	c.syncs++
+	c.mu.Unlock()
+}
+
+// handleReadyForQuery reconciles the tracked transaction with the status the
+// server reports: 'I' idle, 'T' in a transaction or 'E' in a failed one. The
+// status is authoritative, so it catches transactions opened or ended by
+// statements the proxy didn't recognize, such as a multi-statement query
+// ending in COMMIT. While the client has pipelined further messages, the
+// status describes a point the client has already moved past and is ignored.
+func (c *conn) handleReadyForQuery(status byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.syncs = max(c.syncs-1, 0)
+	if c.syncs > 0 {
+		return
+	}
+	switch status {
+	case 'I':
+		if c.activeTxID != "" {
+			c.activeTxID = ""
+			c.access.End()
+		}
+		c.txFailed = false
+	case 'T', 'E':
+		if c.activeTxID == "" {
+			c.activeTxID = uuid.New().String()
+			c.access.Begin("")
+		}
+		c.txFailed = status == 'E'
 	}
 }
 
+func (c *conn) emitEvent(ev proxy.Event) {
+	proxy.Emit(c.events, ev, c.overflow, c.dropped)
+}
+
 // parseRowsAffected extracts the row count from a CommandComplete tag.
 // e.g. "INSERT 0 5" -> 5, "SELECT 3" -> 3, "UPDATE 10" -> 10.
 func parseRowsAffected(tag string) int64 {
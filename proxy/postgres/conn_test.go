@@ -1,10 +1,21 @@
 package postgres_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	pgproto "github.com/jackc/pgproto3/v2"
+
+	"github.com/mickamy/sql-tap/proxy"
 	pgproxy "github.com/mickamy/sql-tap/proxy/postgres"
 )
 
@@ -121,6 +132,322 @@ func TestParameterDescriptionFlow(t *testing.T) {
 	})
 }
 
+func TestBindArgTypes(t *testing.T) {
+	t.Parallel()
+
+	tc := pgproxy.NewTestConn()
+	tc.HandleParse("", "SELECT * FROM t WHERE id = $1 AND score > $2 AND active = $3 AND name = $4 AND note = $5",
+		[]uint32{0, 0, 0, 0, 0})
+	tc.HandleDescribe("")
+	tc.HandleParameterDescription([]uint32{pgproxy.OIDInt4, pgproxy.OIDFloat8, pgproxy.OIDBool, 25, 25})
+
+	id := binary.BigEndian.AppendUint32(nil, 42)
+	tc.HandleBind("", [][]byte{id, []byte("1.5"), []byte("t"), []byte("bob"), nil}, []int16{1, 0, 0, 0, 0})
+	tc.HandleExecute()
+
+	ev := tc.PendingEvent()
+	if ev == nil {
+		t.Fatal("no pending event after Execute")
+	}
+	want := []proxy.ArgType{proxy.ArgInt, proxy.ArgFloat, proxy.ArgBool, proxy.ArgText, proxy.ArgNull}
+	if !reflect.DeepEqual(ev.ArgTypes, want) {
+		t.Errorf("ArgTypes = %q, want %q", ev.ArgTypes, want)
+	}
+	if ev.Args[0] != "42" {
+		t.Errorf("Args[0] = %q, want 42", ev.Args[0])
+	}
+
+	// Without the parameter types, only NULLs are known.
+	tc.HandleParse("", "SELECT $1, $2", []uint32{0, 0})
+	tc.HandleBind("", [][]byte{[]byte("1"), nil}, nil)
+	if got, want := tc.LastBindArgTypes(), []proxy.ArgType{proxy.ArgText, proxy.ArgNull}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ArgTypes without OIDs = %q, want %q", got, want)
+	}
+}
+
+func TestExecuteStmtName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		stmt     string
+		wantStmt string
+	}{
+		{name: "named statement", stmt: "stmtcache_42", wantStmt: "stmtcache_42"},
+		{name: "unnamed statement", stmt: "", wantStmt: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc := pgproxy.NewTestConn()
+			tc.HandleParse(tt.stmt, "SELECT id FROM users WHERE id = $1", []uint32{0})
+			tc.HandleBind(tt.stmt, [][]byte{[]byte("1")}, nil)
+			tc.HandleExecute()
+
+			ev := tc.PendingEvent()
+			if ev == nil {
+				t.Fatal("no pending event after Execute")
+			}
+			if ev.StmtName != tt.wantStmt {
+				t.Errorf("StmtName = %q, want %q", ev.StmtName, tt.wantStmt)
+			}
+			if ev.Query != "SELECT id FROM users WHERE id = $1" {
+				t.Errorf("Query = %q", ev.Query)
+			}
+		})
+	}
+}
+
+func TestInterleavedStatements(t *testing.T) {
+	t.Parallel()
+
+	execute := func(t *testing.T, tc *pgproxy.TestConn, portal string) proxy.Event {
+		t.Helper()
+		tc.HandleExecutePortal(portal)
+		tc.HandleCommandComplete("SELECT 1")
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatalf("execute %q: no event emitted", portal)
+		}
+		return ev
+	}
+
+	t.Run("execute earlier statement after preparing another", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleParse("a", "SELECT * FROM users WHERE id = $1", []uint32{23})
+		tc.HandleParse("b", "SELECT * FROM posts WHERE user_id = $1", []uint32{23})
+		tc.HandleBind("b", [][]byte{[]byte("2")}, nil)
+		tc.HandleBind("a", [][]byte{[]byte("1")}, nil)
+
+		ev := execute(t, tc, "")
+		if ev.StmtName != "a" || ev.Query != "SELECT * FROM users WHERE id = $1" {
+			t.Errorf("event = %q %q, want statement a", ev.StmtName, ev.Query)
+		}
+		if !reflect.DeepEqual(ev.Args, []string{"1"}) {
+			t.Errorf("args = %q, want [1]", ev.Args)
+		}
+	})
+
+	t.Run("named portals keep their own binds", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleParse("a", "SELECT * FROM users WHERE id = $1", []uint32{23})
+		tc.HandleParse("b", "SELECT * FROM posts WHERE user_id = $1", []uint32{23})
+		tc.HandleBindPortal("pa", "a", [][]byte{[]byte("1")}, nil)
+		tc.HandleBindPortal("pb", "b", [][]byte{[]byte("2")}, nil)
+
+		for _, want := range []struct {
+			portal, stmt, arg string
+		}{
+			{"pa", "a", "1"},
+			{"pb", "b", "2"},
+			{"pa", "a", "1"}, // a portal can be executed again, e.g. to fetch more rows
+		} {
+			ev := execute(t, tc, want.portal)
+			if ev.StmtName != want.stmt || !reflect.DeepEqual(ev.Args, []string{want.arg}) {
+				t.Errorf("portal %s: stmt = %q, args = %q, want %q [%s]",
+					want.portal, ev.StmtName, ev.Args, want.stmt, want.arg)
+			}
+		}
+	})
+
+	t.Run("portal keeps the query it was bound to", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleParse("", "SELECT 1", nil)
+		tc.HandleBindPortal("p", "", nil, nil)
+		tc.HandleParse("", "SELECT 2", nil)
+
+		if ev := execute(t, tc, "p"); ev.Query != "SELECT 1" {
+			t.Errorf("query = %q, want %q", ev.Query, "SELECT 1")
+		}
+	})
+
+	t.Run("close evicts statements and portals", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleParse("a", "SELECT * FROM users WHERE id = $1", []uint32{23})
+		tc.HandleBindPortal("pa", "a", [][]byte{[]byte("1")}, nil)
+		tc.HandleClose('P', "pa")
+		if ev := execute(t, tc, "pa"); ev.Query != "" || ev.Args != nil {
+			t.Errorf("closed portal: event = %q %q, want nothing attributed", ev.Query, ev.Args)
+		}
+
+		tc.HandleClose('S', "a")
+		tc.HandleBindPortal("pa", "a", [][]byte{[]byte("1")}, nil)
+		if ev := execute(t, tc, "pa"); ev.Query != "" {
+			t.Errorf("closed statement: query = %q, want empty", ev.Query)
+		}
+	})
+}
+
+func TestResultColumns(t *testing.T) {
+	t.Parallel()
+
+	t.Run("off by default", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleSimpleQuery("SELECT * FROM users")
+		tc.HandleRowDescription(12)
+
+		ev := tc.PendingEvent()
+		if ev == nil || ev.ResultColumns != 0 {
+			t.Fatalf("pending = %+v, want ResultColumns 0", ev)
+		}
+	})
+
+	t.Run("simple query", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.SetResultColumns(true)
+		tc.HandleSimpleQuery("SELECT * FROM users")
+		tc.HandleRowDescription(12)
+
+		ev := tc.PendingEvent()
+		if ev == nil || ev.ResultColumns != 12 {
+			t.Fatalf("pending = %+v, want ResultColumns 12", ev)
+		}
+	})
+
+	t.Run("statement described before execute", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.SetResultColumns(true)
+		tc.HandleParse("s1", "SELECT id, name FROM users WHERE id = $1", []uint32{0})
+		tc.HandleDescribe("s1")
+		tc.HandleParameterDescription([]uint32{23})
+		tc.HandleRowDescription(2)
+		tc.HandleReadyForQuery()
+
+		tc.HandleBind("s1", [][]byte{[]byte("1")}, nil)
+		tc.HandleExecute()
+
+		ev := tc.PendingEvent()
+		if ev == nil || ev.ResultColumns != 2 {
+			t.Fatalf("pending = %+v, want ResultColumns 2", ev)
+		}
+	})
+
+	t.Run("reparsed unnamed statement drops stale count", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.SetResultColumns(true)
+		tc.HandleParse("", "SELECT id, name FROM users", nil)
+		tc.HandleDescribe("")
+		tc.HandleParameterDescription(nil)
+		tc.HandleRowDescription(2)
+		tc.HandleReadyForQuery()
+
+		tc.HandleParse("", "UPDATE users SET name = $1", []uint32{0})
+		tc.HandleBind("", [][]byte{[]byte("x")}, nil)
+		tc.HandleExecute()
+
+		ev := tc.PendingEvent()
+		if ev == nil || ev.ResultColumns != 0 {
+			t.Fatalf("pending = %+v, want ResultColumns 0", ev)
+		}
+	})
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	t.Run("copy in", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleSimpleQuery("COPY users (id, name) FROM STDIN")
+		tc.CaptureUpstreamMsg(&pgproto.CopyInResponse{ColumnFormatCodes: []uint16{0, 0}})
+		tc.CaptureClientMsg(&pgproto.CopyData{Data: []byte("1\talice\n")})
+		tc.CaptureClientMsg(&pgproto.CopyData{Data: []byte("2\tbob\n")})
+		tc.CaptureClientMsg(&pgproto.CopyDone{})
+		tc.CaptureUpstreamMsg(&pgproto.CommandComplete{CommandTag: []byte("COPY 2")})
+
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatal("no event emitted")
+		}
+		if ev.CopyBytes != 14 || ev.RowsAffected != 2 {
+			t.Errorf("CopyBytes = %d, RowsAffected = %d, want 14 and 2", ev.CopyBytes, ev.RowsAffected)
+		}
+	})
+
+	t.Run("copy out", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleSimpleQuery("COPY users TO STDOUT")
+		tc.CaptureUpstreamMsg(&pgproto.CopyOutResponse{})
+		tc.CaptureUpstreamMsg(&pgproto.CopyData{Data: []byte("1\talice\n")})
+		tc.CaptureUpstreamMsg(&pgproto.CopyDone{})
+		tc.CaptureUpstreamMsg(&pgproto.CommandComplete{CommandTag: []byte("COPY 1")})
+
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatal("no event emitted")
+		}
+		if ev.CopyBytes != 8 || ev.RowsAffected != 1 {
+			t.Errorf("CopyBytes = %d, RowsAffected = %d, want 8 and 1", ev.CopyBytes, ev.RowsAffected)
+		}
+	})
+
+	t.Run("failed copy keeps bytes sent", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleSimpleQuery("COPY users (id) FROM STDIN")
+		tc.CaptureUpstreamMsg(&pgproto.CopyInResponse{})
+		tc.CaptureClientMsg(&pgproto.CopyData{Data: []byte("x\n")})
+		tc.CaptureClientMsg(&pgproto.CopyFail{Message: "aborted"})
+		tc.CaptureUpstreamMsg(&pgproto.ErrorResponse{Message: "COPY from stdin failed: aborted"})
+
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatal("no event emitted")
+		}
+		if ev.CopyBytes != 2 || ev.Error == "" {
+			t.Errorf("CopyBytes = %d, Error = %q, want 2 and an error", ev.CopyBytes, ev.Error)
+		}
+	})
+
+	t.Run("data outside copy is ignored", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.HandleSimpleQuery("COPY users TO STDOUT")
+		tc.CaptureUpstreamMsg(&pgproto.CopyOutResponse{})
+		tc.CaptureUpstreamMsg(&pgproto.CopyData{Data: []byte("1\n")})
+		tc.CaptureUpstreamMsg(&pgproto.CopyDone{})
+		tc.CaptureUpstreamMsg(&pgproto.CopyData{Data: []byte("stray")})
+		tc.CaptureUpstreamMsg(&pgproto.CommandComplete{CommandTag: []byte("COPY 1")})
+
+		tc.HandleSimpleQuery("SELECT 1")
+		tc.CaptureClientMsg(&pgproto.CopyData{Data: []byte("stray")})
+		tc.CaptureUpstreamMsg(&pgproto.CommandComplete{CommandTag: []byte("SELECT 1")})
+
+		for _, want := range []int64{2, 0} {
+			ev, ok := tc.NextEvent()
+			if !ok {
+				t.Fatal("no event emitted")
+			}
+			if ev.CopyBytes != want {
+				t.Errorf("%s: CopyBytes = %d, want %d", ev.Query, ev.CopyBytes, want)
+			}
+		}
+	})
+}
+
 func TestDecodeBinaryParam(t *testing.T) {
 	t.Parallel()
 
@@ -220,3 +547,729 @@ func TestDecodePGTimestampMicros(t *testing.T) {
 		})
 	}
 }
+
+// startupMessage builds a StartupMessage (or any startup-format packet) with
+// the given protocol version or request code and name/value pairs.
+func startupMessage(version uint32, params ...string) []byte {
+	body := binary.BigEndian.AppendUint32(nil, version)
+	for _, p := range params {
+		body = append(body, p...)
+		body = append(body, 0)
+	}
+	if len(params) > 0 {
+		body = append(body, 0)
+	}
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(body)+4)), body...) //nolint:gosec // small test message
+}
+
+// readStartupPacket reads a length-prefixed startup packet.
+func readStartupPacket(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		t.Errorf("read startup header: %v", err)
+		return nil
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+	copy(buf, hdr[:])
+	if _, err := io.ReadFull(r, buf[4:]); err != nil {
+		t.Errorf("read startup payload: %v", err)
+		return nil
+	}
+	return buf
+}
+
+type startupResult struct {
+	params map[string]string
+	err    error
+}
+
+// runStartup runs the proxy's startup phase over pipes and returns the client
+// end, the upstream end and the eventual result.
+func runStartup(t *testing.T) (net.Conn, net.Conn, <-chan startupResult) {
+	t.Helper()
+	client, proxyClient := net.Pipe()
+	proxyUpstream, upstream := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = upstream.Close()
+	})
+
+	done := make(chan startupResult, 1)
+	go func() {
+		params, err := pgproxy.RelayStartup(proxyClient, proxyUpstream)
+		done <- startupResult{params: params, err: err}
+	}()
+	for _, c := range []net.Conn{client, upstream} {
+		_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	return client, upstream, done
+}
+
+func TestStartupParams(t *testing.T) {
+	t.Parallel()
+
+	client, upstream, done := runStartup(t)
+
+	startup := startupMessage(3<<16,
+		"user", "app",
+		"database", "shop",
+		"options", "-c search_path=tenant_1 -c statement_timeout=5s",
+		"application_name", "worker",
+		"replication", "database",
+	)
+	received := make(chan []byte, 1)
+	go func() {
+		received <- readStartupPacket(t, upstream)
+		// AuthenticationOk, then ReadyForQuery (idle).
+		_, _ = upstream.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 0})
+		_, _ = upstream.Write([]byte{'Z', 0, 0, 0, 5, 'I'})
+	}()
+
+	if _, err := client.Write(startup); err != nil {
+		t.Fatalf("write startup: %v", err)
+	}
+	reply := make([]byte, 9+6)
+	if _, err := io.ReadFull(client, reply); err != nil {
+		t.Fatalf("read auth reply: %v", err)
+	}
+	if reply[0] != 'R' || reply[9] != 'Z' {
+		t.Errorf("client got %q, want AuthenticationOk then ReadyForQuery", reply)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("startup error: %v", res.err)
+	}
+	if got := <-received; !bytes.Equal(got, startup) {
+		t.Errorf("upstream got startup %q, want it relayed unchanged %q", got, startup)
+	}
+	want := map[string]string{
+		"user":             "app",
+		"database":         "shop",
+		"options":          "-c search_path=tenant_1 -c statement_timeout=5s",
+		"application_name": "worker",
+		"replication":      "database",
+	}
+	if !reflect.DeepEqual(res.params, want) {
+		t.Errorf("params = %v, want %v", res.params, want)
+	}
+}
+
+func TestStartupServerVersion(t *testing.T) {
+	t.Parallel()
+
+	client, proxyClient := net.Pipe()
+	proxyUpstream, upstream := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = upstream.Close()
+	})
+	for _, c := range []net.Conn{client, upstream} {
+		_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	type result struct {
+		info proxy.ServerInfo
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		info, err := pgproxy.StartupServerInfo(proxyClient, proxyUpstream)
+		done <- result{info, err}
+	}()
+
+	// AuthenticationOk, the ParameterStatus burst, then ReadyForQuery.
+	replies := [][]byte{
+		pgMessage('R', []byte{0, 0, 0, 0}),
+		pgMessage('S', []byte("client_encoding\x00UTF8\x00")),
+		pgMessage('S', []byte("server_version\x0016.2 (Debian 16.2-1.pgdg120+2)\x00")),
+		pgMessage('S', []byte("TimeZone\x00UTC\x00")),
+		pgMessage('Z', []byte{'I'}),
+	}
+	go func() {
+		readStartupPacket(t, upstream)
+		for _, msg := range replies {
+			_, _ = upstream.Write(msg)
+		}
+	}()
+	if _, err := client.Write(startupMessage(3<<16, "user", "app")); err != nil {
+		t.Fatalf("write startup: %v", err)
+	}
+	for range replies {
+		readPGMessage(t, client)
+	}
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("startup error: %v", res.err)
+	}
+	want := proxy.ServerInfo{Version: "16.2 (Debian 16.2-1.pgdg120+2)"}
+	if res.info != want {
+		t.Errorf("server info = %+v, want %+v", res.info, want)
+	}
+}
+
+func TestStartupUnsupportedProtocol(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		version uint32
+	}{
+		{"v2", 2 << 16},
+		{"v4", 4 << 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, _, done := runStartup(t)
+			if _, err := client.Write(startupMessage(tt.version, "user", "app")); err != nil {
+				t.Fatalf("write startup: %v", err)
+			}
+
+			reply := make([]byte, 1)
+			if _, err := io.ReadFull(client, reply); err != nil {
+				t.Fatalf("read reply: %v", err)
+			}
+			if reply[0] != 'E' {
+				t.Errorf("reply type = %q, want an error", reply[0])
+			}
+			_ = client.Close()
+
+			res := <-done
+			if res.err == nil || !strings.Contains(res.err.Error(), "only 3.x is supported") {
+				t.Errorf("err = %v, want unsupported protocol error", res.err)
+			}
+		})
+	}
+}
+
+func TestStartupCancelRequest(t *testing.T) {
+	t.Parallel()
+
+	client, upstream, done := runStartup(t)
+
+	// CancelRequest: code, backend PID, secret key.
+	cancel := startupMessage(80877102)
+	cancel = binary.BigEndian.AppendUint32(cancel, 4242)
+	cancel = binary.BigEndian.AppendUint32(cancel, 0xdeadbeef)
+	binary.BigEndian.PutUint32(cancel, uint32(len(cancel))) //nolint:gosec // 16 bytes
+
+	received := make(chan []byte, 1)
+	go func() { received <- readStartupPacket(t, upstream) }()
+
+	if _, err := client.Write(cancel); err != nil {
+		t.Fatalf("write cancel: %v", err)
+	}
+	if got := <-received; !bytes.Equal(got, cancel) {
+		t.Errorf("upstream got %x, want %x", got, cancel)
+	}
+	if res := <-done; !errors.Is(res.err, pgproxy.ErrCancelRequest) {
+		t.Errorf("err = %v, want ErrCancelRequest", res.err)
+	}
+}
+
+func TestStartupAuthError(t *testing.T) {
+	t.Parallel()
+
+	client, upstream, done := runStartup(t)
+
+	// ErrorResponse fields as sent for a wrong password.
+	var errBody []byte
+	for _, f := range []struct {
+		code  byte
+		value string
+	}{
+		{'S', "FATAL"},
+		{'V', "FATAL"},
+		{'C', "28P01"},
+		{'M', `password authentication failed for user "app"`},
+	} {
+		errBody = append(errBody, f.code)
+		errBody = append(append(errBody, f.value...), 0)
+	}
+	errBody = append(errBody, 0)
+
+	go func() {
+		readStartupPacket(t, upstream)
+		// AuthenticationCleartextPassword, then reject the password.
+		_, _ = upstream.Write([]byte{'R', 0, 0, 0, 8, 0, 0, 0, 3})
+		readPGMessage(t, upstream)
+		_, _ = upstream.Write(pgMessage('E', errBody))
+	}()
+
+	if _, err := client.Write(startupMessage(3<<16, "user", "app")); err != nil {
+		t.Fatalf("write startup: %v", err)
+	}
+	readPGMessage(t, client)
+	if _, err := client.Write(pgMessage('p', []byte("wrong\x00"))); err != nil {
+		t.Fatalf("write password: %v", err)
+	}
+	if reply := readPGMessage(t, client); len(reply) == 0 || reply[0] != 'E' {
+		t.Errorf("client got %q, want the ErrorResponse relayed", reply)
+	}
+
+	res := <-done
+	want := `postgres: auth error from upstream: FATAL: password authentication failed for user "app" (SQLSTATE 28P01)`
+	if res.err == nil || res.err.Error() != want {
+		t.Errorf("err = %v, want %q", res.err, want)
+	}
+}
+
+// pgMessage builds a regular protocol message.
+func pgMessage(typ byte, body []byte) []byte {
+	msg := []byte{typ}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(len(body)+4)) //nolint:gosec // small test message
+	return append(msg, body...)
+}
+
+// readPGMessage reads a regular protocol message.
+func readPGMessage(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		t.Errorf("read message header: %v", err)
+		return nil
+	}
+	msg := make([]byte, 1+binary.BigEndian.Uint32(hdr[1:]))
+	copy(msg, hdr)
+	if _, err := io.ReadFull(r, msg[5:]); err != nil {
+		t.Errorf("read message body: %v", err)
+		return nil
+	}
+	return msg
+}
+
+func TestReplicationPassthrough(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode        string
+		wantCapture bool
+	}{
+		{"database", false},
+		{"true", false},
+		{"off", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Parallel()
+
+			client, proxyClient := net.Pipe()
+			proxyUpstream, upstream := net.Pipe()
+			defer func() {
+				_ = client.Close()
+				_ = upstream.Close()
+			}()
+			for _, c := range []net.Conn{client, upstream} {
+				_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+			}
+
+			events := make(chan proxy.Event, 16)
+			done := make(chan error, 1)
+			go func() {
+				done <- pgproxy.Relay(context.Background(), proxyClient, proxyUpstream, events)
+			}()
+
+			go func() {
+				readStartupPacket(t, upstream)
+				_, _ = upstream.Write(pgMessage('R', []byte{0, 0, 0, 0}))
+				_, _ = upstream.Write(pgMessage('Z', []byte{'I'}))
+			}()
+			if _, err := client.Write(startupMessage(3<<16, "user", "repl", "replication", tt.mode)); err != nil {
+				t.Fatalf("write startup: %v", err)
+			}
+			readPGMessage(t, client)
+			readPGMessage(t, client)
+
+			query := pgMessage('Q', []byte("IDENTIFY_SYSTEM\x00"))
+			received := make(chan []byte, 1)
+			go func() {
+				received <- readPGMessage(t, upstream)
+				// CopyBothResponse would follow START_REPLICATION; here it
+				// just checks raw bytes flow back unchanged.
+				_, _ = upstream.Write(pgMessage('C', []byte("IDENTIFY_SYSTEM\x00")))
+				_, _ = upstream.Write(pgMessage('Z', []byte{'I'}))
+			}()
+			if _, err := client.Write(query); err != nil {
+				t.Fatalf("write query: %v", err)
+			}
+			if got := <-received; !bytes.Equal(got, query) {
+				t.Errorf("upstream got %q, want %q", got, query)
+			}
+			readPGMessage(t, client)
+			readPGMessage(t, client)
+
+			_ = client.Close()
+			if err := <-done; err != nil {
+				t.Errorf("relay error: %v", err)
+			}
+			close(events)
+			var captured bool
+			for ev := range events {
+				if ev.Query == "IDENTIFY_SYSTEM" {
+					captured = true
+				}
+			}
+			if captured != tt.wantCapture {
+				t.Errorf("captured = %v, want %v", captured, tt.wantCapture)
+			}
+		})
+	}
+}
+
+func TestUpstreamClosesMidQuery(t *testing.T) {
+	t.Parallel()
+
+	client, proxyClient := net.Pipe()
+	proxyUpstream, upstream := net.Pipe()
+	defer func() {
+		_ = client.Close()
+		_ = upstream.Close()
+	}()
+	for _, c := range []net.Conn{client, upstream} {
+		_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	events := make(chan proxy.Event, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- pgproxy.Relay(context.Background(), proxyClient, proxyUpstream, events)
+	}()
+
+	go func() {
+		readStartupPacket(t, upstream)
+		_, _ = upstream.Write(pgMessage('R', []byte{0, 0, 0, 0}))
+		_, _ = upstream.Write(pgMessage('Z', []byte{'I'}))
+	}()
+	if _, err := client.Write(startupMessage(3<<16, "user", "app")); err != nil {
+		t.Fatalf("write startup: %v", err)
+	}
+	readPGMessage(t, client)
+	readPGMessage(t, client)
+
+	// The server dies while running the query.
+	go func() {
+		readPGMessage(t, upstream)
+		_ = upstream.Close()
+	}()
+	if _, err := client.Write(pgMessage('Q', []byte("SELECT pg_sleep(10)\x00"))); err != nil {
+		t.Fatalf("write query: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("relay error: %v", err)
+	}
+
+	select {
+	case ev := <-events:
+		if ev.Query != "SELECT pg_sleep(10)" || ev.InFlight {
+			t.Fatalf("event = %+v, want the completed query", ev)
+		}
+		if ev.Error != proxy.ErrConnClosed.Error() {
+			t.Errorf("error = %q, want %q", ev.Error, proxy.ErrConnClosed)
+		}
+		if ev.Duration <= 0 {
+			t.Errorf("duration = %s, want > 0", ev.Duration)
+		}
+	default:
+		t.Fatal("no event emitted for the cut-off query")
+	}
+}
+
+func TestSessionTracking(t *testing.T) {
+	t.Parallel()
+
+	tc := pgproxy.NewTestConn()
+	run := func(q string, errMsg string) proxy.Event {
+		t.Helper()
+		tc.HandleSimpleQuery(q)
+		if errMsg != "" {
+			tc.HandleErrorResponse(errMsg)
+		} else {
+			tc.HandleCommandComplete("SET")
+		}
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatalf("%s: no event emitted", q)
+		}
+		return ev
+	}
+
+	if ev := run("SELECT 1", ""); ev.Session != nil {
+		t.Errorf("before SET: session = %v, want nil", ev.Session)
+	}
+	ev := run("SET search_path TO app, public", "")
+	if got := ev.Session["search_path"]; got != "app, public" {
+		t.Errorf("SET event: search_path = %q, want %q", got, "app, public")
+	}
+	if ev := run("SET statement_timeout = 'bogus'", "invalid value"); ev.Session["statement_timeout"] != "" {
+		t.Errorf("failed SET applied: session = %v", ev.Session)
+	}
+	run("SET statement_timeout = 5000", "")
+	ev = run("SELECT * FROM users", "")
+	want := map[string]string{"search_path": "app, public", "statement_timeout": "5000"}
+	if !reflect.DeepEqual(ev.Session, want) {
+		t.Errorf("later query: session = %v, want %v", ev.Session, want)
+	}
+	if ev := run("RESET ALL", ""); ev.Session != nil {
+		t.Errorf("after RESET ALL: session = %v, want nil", ev.Session)
+	}
+}
+
+func TestTxStatus(t *testing.T) {
+	t.Parallel()
+
+	// run sends q as a simple query and answers it with the given response
+	// and a ReadyForQuery carrying status.
+	run := func(t *testing.T, tc *pgproxy.TestConn, q string, resp pgproto.BackendMessage, status byte) proxy.Event {
+		t.Helper()
+		tc.CaptureClientMsg(&pgproto.Query{String: q})
+		tc.CaptureUpstreamMsg(resp)
+		tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: status})
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatalf("%s: no event emitted", q)
+		}
+		return ev
+	}
+	ok := func(tag string) pgproto.BackendMessage { return &pgproto.CommandComplete{CommandTag: []byte(tag)} }
+	fail := func(msg string) pgproto.BackendMessage { return &pgproto.ErrorResponse{Message: msg} }
+
+	t.Run("error inside a transaction", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		begin := run(t, tc, "BEGIN", ok("BEGIN"), 'T')
+		if begin.TxID == "" {
+			t.Fatal("BEGIN: tx ID is empty")
+		}
+		ev := run(t, tc, "INSERT INTO t VALUES (1)", fail("duplicate key value"), 'E')
+		if ev.TxID != begin.TxID || ev.TxFailed {
+			t.Errorf("failing statement: tx ID = %q, failed = %v, want %q, false", ev.TxID, ev.TxFailed, begin.TxID)
+		}
+		ev = run(t, tc, "SELECT 1", fail("current transaction is aborted"), 'E')
+		if ev.TxID != begin.TxID || !ev.TxFailed {
+			t.Errorf("statement after failure: tx ID = %q, failed = %v, want %q, true", ev.TxID, ev.TxFailed, begin.TxID)
+		}
+		ev = run(t, tc, "COMMIT", ok("ROLLBACK"), 'I')
+		if ev.Op != proxy.OpRollback || ev.TxID != begin.TxID || !ev.TxFailed {
+			t.Errorf("COMMIT of failed tx = %v in %q, failed = %v, want Rollback in %q, true",
+				ev.Op, ev.TxID, ev.TxFailed, begin.TxID)
+		}
+		if ev := run(t, tc, "SELECT 1", ok("SELECT 1"), 'I'); ev.TxID != "" || ev.TxFailed {
+			t.Errorf("after rollback: tx ID = %q, failed = %v, want empty, false", ev.TxID, ev.TxFailed)
+		}
+	})
+
+	t.Run("explicit rollback of failed transaction", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		begin := run(t, tc, "BEGIN", ok("BEGIN"), 'T')
+		run(t, tc, "UPDATE t SET v = 1/0", fail("division by zero"), 'E')
+		ev := run(t, tc, "ROLLBACK", ok("ROLLBACK"), 'I')
+		if ev.Op != proxy.OpRollback || ev.TxID != begin.TxID || !ev.TxFailed {
+			t.Errorf("ROLLBACK = %v in %q, failed = %v, want Rollback in %q, true", ev.Op, ev.TxID, ev.TxFailed, begin.TxID)
+		}
+	})
+
+	t.Run("multi-statement query ends the transaction", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.CaptureClientMsg(&pgproto.Query{String: "BEGIN; UPDATE t SET v = 1; COMMIT"})
+		for _, tag := range []string{"BEGIN", "UPDATE 1", "COMMIT"} {
+			tc.CaptureUpstreamMsg(ok(tag))
+		}
+		tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: 'I'})
+		if _, ok := tc.NextEvent(); !ok {
+			t.Fatal("no event emitted")
+		}
+		if ev := run(t, tc, "SELECT 1", ok("SELECT 1"), 'I'); ev.TxID != "" {
+			t.Errorf("statement after the query: tx ID = %q, want empty", ev.TxID)
+		}
+	})
+
+	t.Run("transaction opened by an unrecognized statement", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		if ev := run(t, tc, "SET x = 1; BEGIN", ok("SET"), 'T'); ev.TxID != "" {
+			t.Errorf("opening statement: tx ID = %q, want empty", ev.TxID)
+		}
+		first := run(t, tc, "SELECT 1", ok("SELECT 1"), 'T')
+		if first.TxID == "" {
+			t.Fatal("statement in the opened transaction: tx ID is empty")
+		}
+		if ev := run(t, tc, "COMMIT", ok("COMMIT"), 'I'); ev.Op != proxy.OpCommit || ev.TxID != first.TxID {
+			t.Errorf("COMMIT = %v in %q, want Commit in %q", ev.Op, ev.TxID, first.TxID)
+		}
+	})
+
+	t.Run("pipelined messages ignore stale status", func(t *testing.T) {
+		t.Parallel()
+
+		tc := pgproxy.NewTestConn()
+		tc.CaptureClientMsg(&pgproto.Query{String: "SELECT 1"})
+		tc.CaptureClientMsg(&pgproto.Query{String: "BEGIN"})
+		tc.CaptureUpstreamMsg(ok("SELECT 1"))
+		tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: 'I'})
+		tc.CaptureUpstreamMsg(ok("BEGIN"))
+		tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: 'T'})
+		var txID string
+		for ev, ok := tc.NextEvent(); ok; ev, ok = tc.NextEvent() {
+			if ev.Op == proxy.OpBegin {
+				txID = ev.TxID
+			}
+		}
+		if txID == "" {
+			t.Fatal("no BEGIN event in a transaction")
+		}
+		// The idle status answered the SELECT, sent before the BEGIN.
+		if ev := run(t, tc, "INSERT INTO t VALUES (1)", ok("INSERT 0 1"), 'T'); ev.TxID != txID {
+			t.Errorf("statement after pipelined BEGIN: tx ID = %q, want %q", ev.TxID, txID)
+		}
+	})
+}
+
+func TestEventIDsUniqueAcrossConns(t *testing.T) {
+	t.Parallel()
+
+	// Two connections each run the same statements; their events must not
+	// share IDs, which clients key pins and notes on.
+	conns := []*pgproxy.TestConn{pgproxy.NewTestConn(), pgproxy.NewTestConn()}
+	seen := make(map[string]int)
+	for i := range 3 {
+		for n, tc := range conns {
+			tc.HandleSimpleQuery("SELECT " + strconv.Itoa(i))
+			tc.HandleCommandComplete("SELECT 1")
+			ev, ok := tc.NextEvent()
+			if !ok {
+				t.Fatalf("conn %d: no event emitted", n)
+			}
+			if other, dup := seen[ev.ID]; dup {
+				t.Fatalf("conn %d: event ID %q already used by conn %d", n, ev.ID, other)
+			}
+			seen[ev.ID] = n
+		}
+	}
+}
+
+// TestPooledStatements replays what a server connection sees behind a
+// transaction-pooling PgBouncer: clients taking turns, statement names
+// reused after a transaction boundary, DEALLOCATE ALL between clients, no
+// BEGIN around single statements, and empty health-check queries.
+func TestPooledStatements(t *testing.T) {
+	t.Parallel()
+
+	tc := pgproxy.NewTestConn()
+	tc.SetResultColumns(true)
+	// execute runs statement stmt with args in an extended-query batch and
+	// returns its event.
+	execute := func(t *testing.T, stmt string, args [][]byte, tag string, status byte) proxy.Event {
+		t.Helper()
+		tc.CaptureClientMsg(&pgproto.Bind{PreparedStatement: stmt, Parameters: args})
+		tc.CaptureClientMsg(&pgproto.Execute{})
+		tc.CaptureClientMsg(&pgproto.Sync{})
+		tc.CaptureUpstreamMsg(&pgproto.BindComplete{})
+		tc.CaptureUpstreamMsg(&pgproto.CommandComplete{CommandTag: []byte(tag)})
+		tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: status})
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatalf("Execute of %q: no event emitted", stmt)
+		}
+		return ev
+	}
+	simple := func(t *testing.T, q, tag string, status byte) proxy.Event {
+		t.Helper()
+		tc.CaptureClientMsg(&pgproto.Query{String: q})
+		tc.CaptureUpstreamMsg(&pgproto.CommandComplete{CommandTag: []byte(tag)})
+		tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: status})
+		ev, ok := tc.NextEvent()
+		if !ok {
+			t.Fatalf("%s: no event emitted", q)
+		}
+		return ev
+	}
+
+	// Client A prepares S_1 inside a transaction; the server resolves its
+	// parameter to int4 and it returns 3 columns.
+	begin := simple(t, "BEGIN", "BEGIN", 'T')
+	tc.CaptureClientMsg(&pgproto.Parse{Name: "S_1", Query: "SELECT * FROM users WHERE id = $1"})
+	tc.CaptureClientMsg(&pgproto.Describe{ObjectType: 'S', Name: "S_1"})
+	tc.CaptureClientMsg(&pgproto.Sync{})
+	tc.CaptureUpstreamMsg(&pgproto.ParseComplete{})
+	tc.CaptureUpstreamMsg(&pgproto.ParameterDescription{ParameterOIDs: []uint32{pgproxy.OIDInt4}})
+	tc.CaptureUpstreamMsg(&pgproto.RowDescription{Fields: make([]pgproto.FieldDescription, 3)})
+	tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: 'T'})
+	ev := execute(t, "S_1", [][]byte{[]byte("1")}, "SELECT 1", 'T')
+	if ev.Query != "SELECT * FROM users WHERE id = $1" || ev.TxID != begin.TxID || ev.ResultColumns != 3 ||
+		!reflect.DeepEqual(ev.ArgTypes, []proxy.ArgType{proxy.ArgInt}) {
+		t.Fatalf("client A: query = %q, tx = %q, columns = %d, arg types = %v", ev.Query, ev.TxID, ev.ResultColumns, ev.ArgTypes)
+	}
+	simple(t, "COMMIT", "COMMIT", 'I')
+
+	// Client B gets the connection next and prepares another statement under
+	// the same name, without a transaction.
+	tc.CaptureClientMsg(&pgproto.Parse{Name: "S_1", Query: "UPDATE accounts SET note = $1"})
+	ev = execute(t, "S_1", [][]byte{[]byte("x")}, "UPDATE 4", 'I')
+	if ev.Query != "UPDATE accounts SET note = $1" || ev.TxID != "" || ev.ResultColumns != 0 ||
+		!reflect.DeepEqual(ev.ArgTypes, []proxy.ArgType{proxy.ArgText}) || ev.RowsAffected != 4 {
+		t.Errorf("client B: query = %q, tx = %q, columns = %d, arg types = %v, rows = %d, "+
+			"want the new statement outside any transaction", ev.Query, ev.TxID, ev.ResultColumns, ev.ArgTypes, ev.RowsAffected)
+	}
+
+	// The pooler's health check is an empty query, which leaves nothing
+	// pending.
+	tc.CaptureClientMsg(&pgproto.Query{String: ""})
+	tc.CaptureUpstreamMsg(&pgproto.EmptyQueryResponse{})
+	tc.CaptureUpstreamMsg(&pgproto.ReadyForQuery{TxStatus: 'I'})
+	if p := tc.PendingEvent(); p != nil {
+		t.Errorf("pending event %q after an empty query, want none", p.Query)
+	}
+	if ev, ok := tc.NextEvent(); ok {
+		t.Errorf("empty query emitted %+v, want nothing", ev)
+	}
+
+	// Between clients the pooler deallocates every statement; a Bind to a
+	// name that no longer exists must not be captured with the old query.
+	simple(t, "DEALLOCATE ALL", "DEALLOCATE ALL", 'I')
+	tc.CaptureClientMsg(&pgproto.Bind{PreparedStatement: "S_1", Parameters: [][]byte{[]byte("y")}})
+	tc.CaptureClientMsg(&pgproto.Execute{})
+	if p := tc.PendingEvent(); p == nil || p.Query != "" {
+		t.Errorf("Execute of a deallocated statement: pending = %+v, want one without a query", p)
+	}
+}
+
+func TestParseDeallocate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		q        string
+		wantName string
+		wantAll  bool
+		wantOK   bool
+	}{
+		{q: "DEALLOCATE S_1", wantName: "s_1", wantOK: true},
+		{q: `deallocate prepare "S_1";`, wantName: "S_1", wantOK: true},
+		{q: `DEALLOCATE "a""b"`, wantName: `a"b`, wantOK: true},
+		{q: "DEALLOCATE ALL", wantAll: true, wantOK: true},
+		{q: "DEALLOCATE PREPARE ALL", wantAll: true, wantOK: true},
+		{q: "discard all", wantAll: true, wantOK: true},
+		{q: "DISCARD PLANS"},
+		{q: "DEALLOCATE"},
+		{q: "SELECT 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			t.Parallel()
+			name, all, ok := pgproxy.ParseDeallocate(tt.q)
+			if name != tt.wantName || all != tt.wantAll || ok != tt.wantOK {
+				t.Errorf("ParseDeallocate(%q) = %q, %v, %v, want %q, %v, %v",
+					tt.q, name, all, ok, tt.wantName, tt.wantAll, tt.wantOK)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package postgres
 
 import (
+	"context"
+	"net"
+
 	pgproto "github.com/jackc/pgproto3/v2"
 
 	"github.com/mickamy/sql-tap/proxy"
@@ -13,22 +16,36 @@ var DecodePGTimestampMicros = decodePGTimestampMicros
 // DecodeBinaryParam exposes decodeBinaryParam for testing.
 var DecodeBinaryParam = decodeBinaryParam
 
+// ParseDeallocate exposes parseDeallocate for testing.
+var ParseDeallocate = parseDeallocate
+
 // OID constants for testing.
 const (
+	OIDBool        = oidBool
+	OIDInt4        = oidInt4
+	OIDFloat8      = oidFloat8
 	OIDTimestamp   = oidTimestamp
 	OIDTimestampTZ = oidTimestampTZ
 )
 
 // TestConn wraps conn for protocol-level unit tests.
-type TestConn struct{ c *conn }
+type TestConn struct {
+	c      *conn
+	events chan proxy.Event
+}
 
 // NewTestConn creates a minimal conn for testing the extended query flow.
 func NewTestConn() *TestConn {
-	return &TestConn{c: &conn{
+	events := make(chan proxy.Event, 16)
+	c := &conn{
 		preparedStmts:    make(map[string]string),
 		preparedStmtOIDs: make(map[string][]uint32),
-		events:           make(chan<- proxy.Event, 16),
-	}}
+		portals:          make(map[string]portal),
+		stmtColumns:      make(map[string]int),
+		events:           events,
+	}
+	c.pending = proxy.NewPending(&c.mu, c.emitEvent)
+	return &TestConn{c: c, events: events}
 }
 
 func (tc *TestConn) HandleParse(name, query string, oids []uint32) {
@@ -43,18 +60,117 @@ func (tc *TestConn) HandleParameterDescription(oids []uint32) {
 	tc.c.handleParameterDescription(&pgproto.ParameterDescription{ParameterOIDs: oids})
 }
 
+// HandleBind binds stmtName to the unnamed portal.
 func (tc *TestConn) HandleBind(stmtName string, params [][]byte, formatCodes []int16) {
+	tc.HandleBindPortal("", stmtName, params, formatCodes)
+}
+
+func (tc *TestConn) HandleBindPortal(portalName, stmtName string, params [][]byte, formatCodes []int16) {
 	tc.c.handleBind(&pgproto.Bind{
+		DestinationPortal:    portalName,
 		PreparedStatement:    stmtName,
 		Parameters:           params,
 		ParameterFormatCodes: formatCodes,
 	})
 }
 
+// HandleExecute executes the unnamed portal.
+func (tc *TestConn) HandleExecute() {
+	tc.HandleExecutePortal("")
+}
+
+func (tc *TestConn) HandleExecutePortal(portalName string) {
+	tc.c.handleExecute(&pgproto.Execute{Portal: portalName})
+}
+
+// HandleClose closes a statement ('S') or portal ('P').
+func (tc *TestConn) HandleClose(objectType byte, name string) {
+	tc.c.handleClose(&pgproto.Close{ObjectType: objectType, Name: name})
+}
+
+// PendingEvent returns the event awaiting an upstream response, or nil.
+func (tc *TestConn) PendingEvent() *proxy.Event {
+	tc.c.mu.Lock()
+	defer tc.c.mu.Unlock()
+	return tc.c.pending.Event()
+}
+
+func (tc *TestConn) SetResultColumns(on bool) {
+	tc.c.resultColumns = on
+}
+
+func (tc *TestConn) HandleRowDescription(columns int) {
+	tc.c.handleRowDescription(columns)
+}
+
+func (tc *TestConn) HandleSimpleQuery(query string) {
+	tc.c.handleSimpleQuery(&pgproto.Query{String: query})
+}
+
+func (tc *TestConn) HandleCommandComplete(tag string) {
+	tc.c.handleCommandComplete(&pgproto.CommandComplete{CommandTag: []byte(tag)})
+}
+
+func (tc *TestConn) HandleErrorResponse(msg string) {
+	tc.c.handleErrorResponse(&pgproto.ErrorResponse{Message: msg})
+}
+
+// NextEvent returns the next emitted event, or false if none is queued.
+func (tc *TestConn) NextEvent() (proxy.Event, bool) {
+	select {
+	case ev := <-tc.events:
+		return ev, true
+	default:
+		return proxy.Event{}, false
+	}
+}
+
+// CaptureClientMsg feeds a message sent by the client.
+func (tc *TestConn) CaptureClientMsg(msg pgproto.FrontendMessage) {
+	tc.c.captureClientMsg(msg)
+}
+
+// CaptureUpstreamMsg feeds a message sent by the upstream.
+func (tc *TestConn) CaptureUpstreamMsg(msg pgproto.BackendMessage) {
+	tc.c.captureUpstreamMsg(msg)
+}
+
 func (tc *TestConn) HandleReadyForQuery() {
 	tc.c.drainPendingDescribes()
 }
 
+// LastBindArgs returns the args bound to the unnamed portal.
 func (tc *TestConn) LastBindArgs() []string {
-	return tc.c.lastBindArgs
+	return tc.c.portals[""].args
+}
+
+// LastBindArgTypes returns the types of the args bound to the unnamed portal.
+func (tc *TestConn) LastBindArgTypes() []proxy.ArgType {
+	return tc.c.portals[""].argTypes
+}
+
+// ErrCancelRequest exposes errCancelRequest for testing.
+var ErrCancelRequest = errCancelRequest
+
+// RelayStartup runs the startup phase between clientConn and upstreamConn and
+// returns the client's startup parameters.
+func RelayStartup(clientConn, upstreamConn net.Conn) (map[string]string, error) {
+	c := newConn(clientConn, upstreamConn, make(chan proxy.Event, 16))
+	err := c.relayStartup()
+	return c.startupParams, err
+}
+
+// StartupServerInfo runs the startup phase between clientConn and
+// upstreamConn and returns the server info reported at its end.
+func StartupServerInfo(clientConn, upstreamConn net.Conn) (proxy.ServerInfo, error) {
+	var info proxy.ServerInfo
+	c := newConn(clientConn, upstreamConn, make(chan proxy.Event, 16))
+	c.onHandshake = func(i proxy.ServerInfo) { info = i }
+	err := c.relayStartup()
+	return info, err
+}
+
+// Relay runs the full relay between clientConn and upstreamConn.
+func Relay(ctx context.Context, clientConn, upstreamConn net.Conn, events chan proxy.Event) error {
+	return newConn(clientConn, upstreamConn, events).relay(ctx)
 }
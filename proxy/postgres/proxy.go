@@ -2,10 +2,14 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"net"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/mickamy/sql-tap/proxy"
 )
@@ -15,80 +19,277 @@ var _ proxy.Proxy = (*Proxy)(nil)
 // Proxy is a TCP proxy that sits between a PostgreSQL client and server,
 // capturing query events from the wire protocol.
 type Proxy struct {
-	listenAddr   string
-	upstreamAddr string
-	events       chan proxy.Event
-	listener     net.Listener
-	wg           sync.WaitGroup
+	listenAddr string
+	upstreams  *proxy.Upstreams
+	events     chan proxy.Event
+	overflow   proxy.Overflow
+	columns    bool           // capture result column counts; see SetResultColumns
+	dropped    atomic.Uint64  // events dropped because events was full
+	wg         sync.WaitGroup // one per connection
+	closed     sync.Once      // closes events
+	proxy.ServerInfoStore
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{} // open connections
+	closing  bool               // Shutdown or Close was called; no new connections
+	// cancelKeys maps the cancel key of each open session, as sent in its
+	// BackendKeyData, to the upstream running it, so that a CancelRequest
+	// reaches the right server.
+	cancelKeys map[string]string
 }
 
 // New creates a new PostgreSQL proxy.
 func New(listenAddr, upstreamAddr string) *Proxy {
+	return NewWithBuffer(listenAddr, upstreamAddr, proxy.DefaultBufferSize, proxy.DropNewest)
+}
+
+// NewWithBuffer creates a PostgreSQL proxy whose events channel holds
+// bufSize events and handles a full channel as overflow says. With
+// proxy.Block, a slow consumer of Events stalls the relayed connections.
+func NewWithBuffer(listenAddr, upstreamAddr string, bufSize int, overflow proxy.Overflow) *Proxy {
+	return NewWithUpstreams(listenAddr, proxy.NewUpstreams(upstreamAddr), bufSize, overflow)
+}
+
+// NewWithUpstreams is like NewWithBuffer, but relays each client connection
+// to the upstream picked for it by upstreams. With proxy.ByDatabase, the
+// database is the one named in the client's StartupMessage, defaulting to the
+// user name as in PostgreSQL.
+func NewWithUpstreams(listenAddr string, upstreams *proxy.Upstreams, bufSize int, overflow proxy.Overflow) *Proxy {
 	return &Proxy{
-		listenAddr:   listenAddr,
-		upstreamAddr: upstreamAddr,
-		events:       make(chan proxy.Event, 256),
+		listenAddr: listenAddr,
+		upstreams:  upstreams,
+		events:     make(chan proxy.Event, bufSize),
+		overflow:   overflow,
+		conns:      make(map[*conn]struct{}),
+		cancelKeys: make(map[string]string),
 	}
 }
 
-// Events returns the channel of captured events.
+// Events returns the channel of captured events. It is closed once Shutdown
+// or Close has ended all connections.
 func (p *Proxy) Events() <-chan proxy.Event {
 	return p.events
 }
 
-// ListenAndServe starts accepting client connections and relaying them to PostgreSQL.
+// Dropped returns the number of events dropped, or evicted under
+// proxy.DropOldest, because the events channel was full.
+func (p *Proxy) Dropped() uint64 {
+	return p.dropped.Load()
+}
+
+// SetResultColumns turns on recording the column count of each result set
+// in Event.ResultColumns. It is off by default and must be set before
+// serving.
+func (p *Proxy) SetResultColumns(on bool) {
+	p.columns = on
+}
+
+// ListenAndServe starts accepting client connections and relaying them to
+// PostgreSQL. It returns nil once ctx is done or Shutdown or Close is called.
+// Connections accepted by then keep running until Shutdown or Close ends them.
 func (p *Proxy) ListenAndServe(ctx context.Context) error {
 	var lc net.ListenConfig
 	lis, err := lc.Listen(ctx, "tcp", p.listenAddr)
 	if err != nil {
 		return fmt.Errorf("postgres: listen: %w", err)
 	}
+	return p.Serve(ctx, lis)
+}
+
+// Serve is like ListenAndServe, but accepts client connections on lis, e.g.
+// one on a port the system picked, instead of listening itself. lis is
+// closed when Serve returns.
+func (p *Proxy) Serve(ctx context.Context, lis net.Listener) error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		_ = lis.Close()
+		return nil
+	}
 	p.listener = lis
+	p.mu.Unlock()
 
 	go func() {
 		<-ctx.Done()
 		_ = lis.Close()
 	}()
 
+	// Connections outlive ctx, which only stops accepting.
+	connCtx := context.WithoutCancel(ctx)
 	for {
 		clientConn, err := lis.Accept()
 		if err != nil {
-			if ctx.Err() != nil {
-				return fmt.Errorf("postgres: accept: %w", ctx.Err())
+			if ctx.Err() != nil || p.stopped() {
+				return nil
 			}
+			_ = lis.Close()
 			return fmt.Errorf("postgres: accept: %w", err)
 		}
+		p.serve(connCtx, clientConn)
+	}
+}
 
-		p.wg.Go(func() {
-			p.handleConn(ctx, clientConn)
-		})
+// serve handles clientConn unless the proxy is shutting down.
+func (p *Proxy) serve(ctx context.Context, clientConn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		_ = clientConn.Close()
+		return
 	}
+	p.wg.Go(func() {
+		p.handleConn(ctx, clientConn)
+	})
 }
 
-// Close stops the proxy and waits for all connections to finish.
-func (p *Proxy) Close() error {
+// stopped reports whether Shutdown or Close was called.
+func (p *Proxy) stopped() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closing
+}
+
+// stopAccepting closes the listener and returns the open connections.
+func (p *Proxy) stopAccepting() ([]*conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closing = true
+	var err error
 	if p.listener != nil {
-		if err := p.listener.Close(); err != nil {
-			return fmt.Errorf("postgres: close listener: %w", err)
+		if cerr := p.listener.Close(); cerr != nil && !errors.Is(cerr, net.ErrClosed) {
+			err = fmt.Errorf("postgres: close listener: %w", cerr)
+		}
+	}
+	return slices.Collect(maps.Keys(p.conns)), err
+}
+
+// track registers c as open, or reports false if the proxy is shutting down.
+func (p *Proxy) track(c *conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closing {
+		return false
+	}
+	p.conns[c] = struct{}{}
+	return true
+}
+
+func (p *Proxy) untrack(c *conn) {
+	p.mu.Lock()
+	delete(p.conns, c)
+	p.mu.Unlock()
+}
+
+// Shutdown stops accepting connections and closes each open one as soon as
+// no statement awaits a response and no transaction is open. If ctx is done
+// first, it closes the remaining connections, cutting off their statements,
+// and returns ctx's error. Either way, Events is closed on return.
+func (p *Proxy) Shutdown(ctx context.Context) error {
+	conns, err := p.stopAccepting()
+	for _, c := range conns {
+		c.drain()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		for _, c := range conns {
+			_ = c.clientConn.Close()
 		}
+		<-done
+		err = fmt.Errorf("postgres: shutdown: %w", ctx.Err())
+	}
+	p.closed.Do(func() { close(p.events) })
+	return err
+}
+
+// Close stops accepting connections, closes the open ones and waits for
+// their goroutines to finish. Events is closed on return.
+func (p *Proxy) Close() error {
+	conns, err := p.stopAccepting()
+	for _, c := range conns {
+		_ = c.clientConn.Close()
 	}
 	p.wg.Wait()
-	return nil
+	p.closed.Do(func() { close(p.events) })
+	return err
 }
 
 func (p *Proxy) handleConn(ctx context.Context, clientConn net.Conn) {
 	defer func() { _ = clientConn.Close() }()
 
-	var d net.Dialer
-	upstreamConn, err := d.DialContext(ctx, "tcp", p.upstreamAddr)
-	if err != nil {
-		log.Printf("postgres: dial upstream %s: %v", p.upstreamAddr, err)
+	// The upstream is dialed once the startup packet names the database, or
+	// the session to cancel.
+	var addr, cancelKey string
+	dial := func(a string) (net.Conn, error) {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", a)
+		if err != nil {
+			return nil, fmt.Errorf("postgres: dial upstream %s: %w", a, err)
+		}
+		addr = a
+		return conn, nil
+	}
+
+	c := newConn(clientConn, nil, p.events)
+	c.overflow = p.overflow
+	c.dropped = &p.dropped
+	c.resultColumns = p.columns
+	c.onHandshake = p.SetServerInfo
+	c.dialDatabase = func(database string) (net.Conn, error) {
+		a, ok := p.upstreams.Pick(database)
+		if !ok {
+			return nil, fmt.Errorf("postgres: no upstream for database %q", database)
+		}
+		return dial(a)
+	}
+	c.dialCancel = func(key string) (net.Conn, error) {
+		a, ok := p.cancelTarget(key)
+		if !ok {
+			return nil, errors.New("postgres: cancel request for an unknown session")
+		}
+		return dial(a)
+	}
+	c.onBackendKey = func(key string) {
+		cancelKey = key
+		p.mu.Lock()
+		p.cancelKeys[key] = addr
+		p.mu.Unlock()
+	}
+	if !p.track(c) {
 		return
 	}
-	defer func() { _ = upstreamConn.Close() }()
+	defer func() {
+		p.untrack(c)
+		if c.upstreamConn != nil {
+			_ = c.upstreamConn.Close()
+		}
+		if cancelKey != "" {
+			p.mu.Lock()
+			delete(p.cancelKeys, cancelKey)
+			p.mu.Unlock()
+		}
+	}()
 
-	c := newConn(clientConn, upstreamConn, p.events)
 	if err := c.relay(ctx); err != nil {
-		log.Printf("postgres: relay %s: %v", clientConn.RemoteAddr(), err)
+		slog.Warn("postgres: relay", "client", clientConn.RemoteAddr().String(), "err", err)
+	}
+}
+
+// cancelTarget returns the upstream running the session whose cancel key is
+// key. A single upstream is the target of any key.
+func (p *Proxy) cancelTarget(key string) (string, bool) {
+	p.mu.Lock()
+	addr, ok := p.cancelKeys[key]
+	p.mu.Unlock()
+	if ok {
+		return addr, true
 	}
+	return p.upstreams.Single()
 }
@@ -1,13 +1,20 @@
 package postgres_test
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -60,6 +67,13 @@ func startPostgres(t *testing.T) string {
 
 func startProxy(t *testing.T, upstream string) (*pproxy.Proxy, string) {
 	t.Helper()
+	return startProxyUpstreams(t, proxy.NewUpstreams(upstream))
+}
+
+// startProxyUpstreams starts a proxy relaying to upstreams on a free local
+// port and returns it with its address.
+func startProxyUpstreams(t *testing.T, upstreams *proxy.Upstreams) (*pproxy.Proxy, string) {
+	t.Helper()
 
 	var lc net.ListenConfig
 	lis, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
@@ -69,7 +83,7 @@ func startProxy(t *testing.T, upstream string) (*pproxy.Proxy, string) {
 	addr := lis.Addr().String()
 	_ = lis.Close()
 
-	p := pproxy.New(addr, upstream)
+	p := pproxy.NewWithUpstreams(addr, upstreams, proxy.DefaultBufferSize, proxy.DropNewest)
 	ctx, cancel := context.WithCancel(t.Context())
 
 	go func() {
@@ -140,6 +154,32 @@ func TestSimpleQuery(t *testing.T) {
 	}
 }
 
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+	upstream := startPostgres(t)
+	p, addr := startProxy(t, upstream)
+	if _, ok := p.ServerInfo(); ok {
+		t.Fatal("ServerInfo reported before any connection")
+	}
+	db := openDB(t, addr)
+
+	var version string
+	if err := db.QueryRowContext(t.Context(), "SHOW server_version").Scan(&version); err != nil {
+		t.Fatalf("query version: %v", err)
+	}
+
+	info, ok := p.ServerInfo()
+	if !ok {
+		t.Fatal("ServerInfo not reported after a connection")
+	}
+	if info.Version != version {
+		t.Errorf("version = %q, want %q", info.Version, version)
+	}
+	if info.TLS || info.Compression {
+		t.Errorf("info = %+v, want neither TLS nor compression", info)
+	}
+}
+
 func TestSelectRows(t *testing.T) {
 	t.Parallel()
 	upstream := startPostgres(t)
@@ -346,3 +386,412 @@ func TestErrorCapture(t *testing.T) {
 		t.Error("expected non-empty error")
 	}
 }
+
+func TestCopyFrom(t *testing.T) {
+	t.Parallel()
+	upstream := startPostgres(t)
+	p, addr := startProxy(t, upstream)
+
+	ctx := t.Context()
+	dsn := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", testUser, testPassword, addr, testDB)
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close(context.Background()) })
+
+	if _, err := conn.Exec(ctx, "CREATE TABLE _sql_tap_test_copy (id INT PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	rows := [][]any{{1, "alice"}, {2, "bob"}, {3, "carol"}}
+	n, err := conn.CopyFrom(ctx, pgx.Identifier{"_sql_tap_test_copy"}, []string{"id", "name"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		t.Fatalf("copy from: %v", err)
+	}
+	if n != 3 {
+		t.Fatalf("copied %d rows, want 3", n)
+	}
+
+	for {
+		ev := waitEvent(t, p.Events())
+		if !strings.HasPrefix(strings.ToLower(ev.Query), "copy") {
+			continue
+		}
+		if ev.InFlight {
+			continue
+		}
+		if ev.Error != "" {
+			t.Fatalf("unexpected error: %q", ev.Error)
+		}
+		if ev.RowsAffected != 3 {
+			t.Errorf("RowsAffected = %d, want 3", ev.RowsAffected)
+		}
+		if ev.CopyBytes == 0 {
+			t.Error("CopyBytes = 0, want the size of the copied data")
+		}
+		if ev.Duration <= 0 {
+			t.Errorf("Duration = %v, want > 0", ev.Duration)
+		}
+		return
+	}
+}
+
+// upstreamHit is a startup packet received by a fake upstream.
+type upstreamHit struct {
+	upstream string
+	packet   []byte
+}
+
+// startFakeUpstream listens on a free port as a PostgreSQL server named name.
+// It reports every startup packet on hits and answers each StartupMessage
+// with AuthenticationOk, a BackendKeyData holding pid and ReadyForQuery.
+func startFakeUpstream(t *testing.T, name string, pid uint32, hits chan<- upstreamHit) string {
+	t.Helper()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				var hdr [4]byte
+				if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+					return
+				}
+				packet := make([]byte, binary.BigEndian.Uint32(hdr[:]))
+				copy(packet, hdr[:])
+				if _, err := io.ReadFull(conn, packet[4:]); err != nil {
+					return
+				}
+				hits <- upstreamHit{upstream: name, packet: packet}
+				if len(packet) == 16 { // CancelRequest
+					return
+				}
+				key := binary.BigEndian.AppendUint32(nil, pid)
+				key = binary.BigEndian.AppendUint32(key, pid*7)
+				_, _ = conn.Write(pgMessage('R', []byte{0, 0, 0, 0}))
+				_, _ = conn.Write(pgMessage('K', key))
+				_, _ = conn.Write(pgMessage('Z', []byte{'I'}))
+				_, _ = io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+// connectClient sends a StartupMessage with params to the proxy at addr and
+// returns the connection and the messages received up to ReadyForQuery or an
+// ErrorResponse.
+func connectClient(t *testing.T, addr string, params ...string) (net.Conn, [][]byte) {
+	t.Helper()
+
+	var d net.Dialer
+	conn, err := d.DialContext(t.Context(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write(startupMessage(3<<16, params...)); err != nil {
+		t.Fatalf("write startup: %v", err)
+	}
+	var msgs [][]byte
+	for {
+		msg := readPGMessage(t, conn)
+		if msg == nil {
+			t.FailNow()
+		}
+		msgs = append(msgs, msg)
+		if msg[0] == 'Z' || msg[0] == 'E' {
+			return conn, msgs
+		}
+	}
+}
+
+func waitHit(t *testing.T, hits <-chan upstreamHit) upstreamHit {
+	t.Helper()
+	select {
+	case h := <-hits:
+		return h
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for an upstream connection")
+		return upstreamHit{}
+	}
+}
+
+func TestRoundRobinUpstreams(t *testing.T) {
+	t.Parallel()
+
+	hits := make(chan upstreamHit, 8)
+	a := startFakeUpstream(t, "a", 1, hits)
+	b := startFakeUpstream(t, "b", 2, hits)
+	_, addr := startProxyUpstreams(t, proxy.NewUpstreams(a, b))
+
+	var got []string
+	for range 4 {
+		connectClient(t, addr, "user", "app", "database", "shop")
+		got = append(got, waitHit(t, hits).upstream)
+	}
+	if want := []string{"a", "b", "a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("upstreams = %v, want %v", got, want)
+	}
+}
+
+func TestByDatabaseUpstreams(t *testing.T) {
+	t.Parallel()
+
+	hits := make(chan upstreamHit, 8)
+	a := startFakeUpstream(t, "a", 1, hits)
+	b := startFakeUpstream(t, "b", 2, hits)
+	upstreams, err := proxy.ParseUpstreams("shop="+a+","+b, proxy.ByDatabase)
+	if err != nil {
+		t.Fatalf("ParseUpstreams: %v", err)
+	}
+	_, addr := startProxyUpstreams(t, upstreams)
+
+	tests := []struct {
+		params []string
+		want   string
+	}{
+		{[]string{"user", "app", "database", "shop"}, "a"},
+		{[]string{"user", "app", "database", "analytics"}, "b"},
+		{[]string{"user", "shop"}, "a"}, // the database defaults to the user name
+		{[]string{"user", "app", "database", "shop"}, "a"},
+	}
+	for _, tt := range tests {
+		connectClient(t, addr, tt.params...)
+		h := waitHit(t, hits)
+		if h.upstream != tt.want {
+			t.Errorf("startup %v went to %s, want %s", tt.params, h.upstream, tt.want)
+		}
+		if !bytes.Equal(h.packet, startupMessage(3<<16, tt.params...)) {
+			t.Errorf("upstream got startup %q, want it relayed unchanged", h.packet)
+		}
+	}
+}
+
+func TestByDatabaseUnlisted(t *testing.T) {
+	t.Parallel()
+
+	hits := make(chan upstreamHit, 8)
+	a := startFakeUpstream(t, "a", 1, hits)
+	upstreams, err := proxy.ParseUpstreams("shop="+a, proxy.ByDatabase)
+	if err != nil {
+		t.Fatalf("ParseUpstreams: %v", err)
+	}
+	_, addr := startProxyUpstreams(t, upstreams)
+
+	_, msgs := connectClient(t, addr, "user", "app", "database", "analytics")
+	last := msgs[len(msgs)-1]
+	if last[0] != 'E' || !bytes.Contains(last, []byte(`no upstream for database "analytics"`)) {
+		t.Errorf("client got %q, want an error naming the database", last)
+	}
+	select {
+	case h := <-hits:
+		t.Errorf("upstream %s was dialed for an unlisted database", h.upstream)
+	default:
+	}
+}
+
+func TestCancelRequestRouting(t *testing.T) {
+	t.Parallel()
+
+	hits := make(chan upstreamHit, 8)
+	a := startFakeUpstream(t, "a", 1, hits)
+	b := startFakeUpstream(t, "b", 2, hits)
+	_, addr := startProxyUpstreams(t, proxy.NewUpstreams(a, b))
+
+	// Two sessions, one per upstream; keep the cancel key of the second.
+	var key []byte
+	for _, want := range []string{"a", "b"} {
+		_, msgs := connectClient(t, addr, "user", "app")
+		if h := waitHit(t, hits); h.upstream != want {
+			t.Fatalf("session went to %s, want %s", h.upstream, want)
+		}
+		for _, msg := range msgs {
+			if msg[0] == 'K' {
+				key = msg[5:]
+			}
+		}
+	}
+	if len(key) != 8 {
+		t.Fatalf("no BackendKeyData relayed to the client")
+	}
+
+	// Round-robin would send the next connection to a; the cancel key says b.
+	var d net.Dialer
+	conn, err := d.DialContext(t.Context(), "tcp", addr)
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	cancel := append(startupMessage(80877102), key...)
+	binary.BigEndian.PutUint32(cancel, uint32(len(cancel))) //nolint:gosec // 16 bytes
+	if _, err := conn.Write(cancel); err != nil {
+		t.Fatalf("write cancel: %v", err)
+	}
+	if h := waitHit(t, hits); h.upstream != "b" || !bytes.Equal(h.packet, cancel) {
+		t.Errorf("cancel request went to %s as %x, want b as %x", h.upstream, h.packet, cancel)
+	}
+}
+
+// startSlowUpstream starts a fake server that, after the startup exchange,
+// reports each simple query on queries and answers it once release is closed.
+func startSlowUpstream(t *testing.T, queries chan<- string, release <-chan struct{}) string {
+	t.Helper()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				if readStartupPacket(t, conn) == nil {
+					return
+				}
+				_, _ = conn.Write(pgMessage('R', []byte{0, 0, 0, 0}))
+				_, _ = conn.Write(pgMessage('Z', []byte{'I'}))
+				for {
+					hdr := make([]byte, 5)
+					if _, err := io.ReadFull(conn, hdr); err != nil {
+						return
+					}
+					body := make([]byte, binary.BigEndian.Uint32(hdr[1:])-4)
+					if _, err := io.ReadFull(conn, body); err != nil {
+						return
+					}
+					if hdr[0] != 'Q' {
+						return
+					}
+					queries <- string(bytes.TrimRight(body, "\x00"))
+					<-release
+					_, _ = conn.Write(pgMessage('C', []byte("SELECT 1\x00")))
+					_, _ = conn.Write(pgMessage('Z', []byte{'I'}))
+				}
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestShutdownDrainsInFlightQuery(t *testing.T) {
+	t.Parallel()
+
+	queries := make(chan string, 1)
+	release := make(chan struct{})
+	upstream := startSlowUpstream(t, queries, release)
+	p, addr := startProxy(t, upstream)
+
+	conn, _ := connectClient(t, addr, "user", "app")
+	if _, err := conn.Write(pgMessage('Q', []byte("SELECT pg_sleep(1)\x00"))); err != nil {
+		t.Fatalf("write query: %v", err)
+	}
+	select {
+	case <-queries:
+	case <-time.After(3 * time.Second):
+		t.Fatal("query did not reach the upstream")
+	}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- p.Shutdown(ctx)
+	}()
+
+	// New clients are refused while the in-flight query keeps running.
+	var d net.Dialer
+	refused := false
+	for range 50 {
+		c, err := d.DialContext(t.Context(), "tcp", addr)
+		if err != nil {
+			refused = true
+			break
+		}
+		_ = c.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !refused {
+		t.Error("proxy still accepts connections during shutdown")
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned %v before the in-flight query finished", err)
+	default:
+	}
+
+	close(release)
+	for _, want := range []byte{'C', 'Z'} {
+		if msg := readPGMessage(t, conn); msg == nil || msg[0] != want {
+			t.Fatalf("client got %q, want message %c", msg, want)
+		}
+	}
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("read after the query = %v, want EOF once drained", err)
+	}
+
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("Shutdown: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Shutdown did not return after the query finished")
+	}
+
+	var got []proxy.Event
+	for ev := range p.Events() {
+		got = append(got, ev)
+	}
+	if len(got) == 0 || got[len(got)-1].Query != "SELECT pg_sleep(1)" || got[len(got)-1].InFlight {
+		t.Errorf("events = %+v, want the completed query before Events is closed", got)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	queries := make(chan string, 1)
+	release := make(chan struct{})
+	defer close(release)
+	upstream := startSlowUpstream(t, queries, release)
+	p, addr := startProxy(t, upstream)
+
+	conn, _ := connectClient(t, addr, "user", "app")
+	if _, err := conn.Write(pgMessage('Q', []byte("SELECT pg_sleep(60)\x00"))); err != nil {
+		t.Fatalf("write query: %v", err)
+	}
+	select {
+	case <-queries:
+	case <-time.After(3 * time.Second):
+		t.Fatal("query did not reach the upstream")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want a deadline error", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Error("connection still open after the drain timed out")
+	}
+}
@@ -2,8 +2,17 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mickamy/sql-tap/query"
 )
 
 // Op represents the type of database operation captured.
@@ -42,12 +51,23 @@ func (o Op) String() string {
 	return fmt.Sprintf("UnknownOp(%d)", o)
 }
 
+// ParseOp returns the Op whose String form is s.
+func ParseOp(s string) (Op, bool) {
+	for o := OpQuery; o <= OpRollback; o++ {
+		if o.String() == s {
+			return o, true
+		}
+	}
+	return 0, false
+}
+
 // Event represents a captured database query event.
 type Event struct {
 	ID              string
 	Op              Op
 	Query           string
 	Args            []string
+	ArgTypes        []ArgType // types of Args as bound by the client, nil if unknown
 	StartTime       time.Time
 	Duration        time.Duration
 	RowsAffected    int64
@@ -56,14 +76,193 @@ type Event struct {
 	NPlus1          bool
 	SlowQuery       bool
 	NormalizedQuery string
+	ReadOnly        bool
+	StmtName        string            // prepared statement name, empty for unnamed statements
+	InFlight        bool              // provisional event for a statement still awaiting its response
+	BatchSize       int               // number of VALUES tuples in a multi-row INSERT, 0 otherwise
+	ResultColumns   int               // number of columns in the result set, 0 if none
+	Session         map[string]string // session variables set on the connection, nil if none
+	Plan            string            // EXPLAIN output attached by auto-explain, empty if none
+	FullScan        bool              // Plan reads a whole large table
+	Warnings        int               // warnings raised by the statement (MySQL), 0 if none
+	CopyBytes       int64             // bytes of COPY data sent or received (PostgreSQL), 0 if none
+	Kind            query.Kind        // read/write/ddl class of Query, derived from its verb
+	TxFailed        bool              // runs in, or ends, a transaction the server reported as failed
+	Update          bool              // republishes the event with this ID with more detail, e.g. its Plan
+	Verb            string            // lowercased keyword that starts Query, e.g. "select" (see query.Verb)
+}
+
+// eventIDPrefix distinguishes this process's event IDs from those of an
+// earlier sql-tapd, which reconnecting clients may still hold (e.g. pinned).
+var eventIDPrefix = uuid.NewString()[:8]
+
+// lastEventID is the counter behind NewEventID.
+var lastEventID atomic.Uint64
+
+// NewEventID returns an event ID unique across all connections of the
+// process, e.g. "1b4e28ba-42". Provisional in-flight events and their
+// completed events share one ID.
+func NewEventID() string {
+	return eventIDPrefix + "-" + strconv.FormatUint(lastEventID.Add(1), 10)
+}
+
+// Overflow is what happens to an event sent to a full buffer.
+type Overflow int
+
+const (
+	DropNewest Overflow = iota // drop the event being sent
+	DropOldest                 // evict the oldest buffered event to make room
+	Block                      // wait for room, slowing down the sender
+)
+
+func (o Overflow) String() string {
+	switch o {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	}
+	return fmt.Sprintf("Overflow(%d)", int(o))
+}
+
+// ParseOverflow returns the Overflow whose String form is s.
+func ParseOverflow(s string) (Overflow, error) {
+	for o := DropNewest; o <= Block; o++ {
+		if o.String() == s {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("proxy: unknown overflow policy %q (want drop-newest, drop-oldest or block)", s)
+}
+
+// DefaultBufferSize is the capacity of a proxy's events channel unless
+// configured otherwise.
+const DefaultBufferSize = 256
+
+// Emit sends ev on events, handling a full channel as overflow says. Dropped
+// events are counted in dropped.
+func Emit(events chan Event, ev Event, overflow Overflow, dropped *atomic.Uint64) {
+	if n := Send(events, ev, overflow, nil); n > 0 {
+		dropped.Add(n)
+	}
+}
+
+// Send sends v on ch, handling a full channel as overflow says, and returns
+// the number of values dropped. Under Block it gives up once done is closed;
+// a nil done waits for as long as it takes. DropOldest needs a buffered
+// channel and falls back to DropNewest otherwise.
+func Send[T any](ch chan T, v T, overflow Overflow, done <-chan struct{}) uint64 {
+	switch {
+	case overflow == Block:
+		select {
+		case ch <- v:
+		case <-done:
+		}
+		return 0
+	case overflow == DropOldest && cap(ch) > 0:
+		var dropped uint64
+		for {
+			select {
+			case ch <- v:
+				return dropped
+			default:
+			}
+			select {
+			case <-ch:
+				dropped++
+			default:
+			}
+		}
+	}
+	select {
+	case ch <- v:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// InFlightDelay is how long a statement must run before the proxy emits a
+// provisional in-flight event for it. The completed event that follows carries
+// the same ID and StartTime, so consumers can replace the provisional one.
+// Statements that finish sooner produce only the completed event.
+const InFlightDelay = 500 * time.Millisecond
+
+// ErrConnClosed is why a statement was cut off: the client or upstream
+// connection closed before the response arrived. Its message is the Error of
+// the statement's event.
+var ErrConnClosed = errors.New("connection closed before response")
+
+// ServerInfo describes the upstream server as seen in a connection's
+// handshake.
+type ServerInfo struct {
+	Version     string // e.g. "16.2" or "8.0.36"; TiDB reports "8.0.11-TiDB-v7.5.0"
+	TLS         bool   // the client's connection is encrypted
+	Compression bool   // the client's connection uses protocol compression
+}
+
+// TrackSession applies ev's statement to a connection's session when it
+// succeeded and attaches the resulting session to ev. ev may be nil.
+func TrackSession(session *query.Session, ev *Event, ok bool) {
+	if ev == nil {
+		return
+	}
+	if ok {
+		*session = session.Apply(ev.Query)
+	}
+	ev.Session = *session
+}
+
+// ServerInfoStore keeps the server info of the latest connection to complete
+// its handshake. Proxies embed it. It is safe for concurrent use.
+type ServerInfoStore struct {
+	mu   sync.Mutex
+	info ServerInfo
+	ok   bool
+}
+
+// ServerInfo returns the server info of the latest connection to complete
+// its handshake, or false if none has yet.
+func (s *ServerInfoStore) ServerInfo() (ServerInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info, s.ok
+}
+
+// SetServerInfo records the server info of a connection that completed its
+// handshake.
+func (s *ServerInfoStore) SetServerInfo(info ServerInfo) {
+	s.mu.Lock()
+	s.info = info
+	s.ok = true
+	s.mu.Unlock()
 }
 
 // Proxy is the common interface for DB protocol proxies.
 type Proxy interface {
-	// ListenAndServe accepts client connections and relays them to the upstream DB.
+	// ListenAndServe accepts client connections and relays them to the
+	// upstream DB until ctx is done. Accepted connections keep running.
 	ListenAndServe(ctx context.Context) error
-	// Events returns the channel of captured events.
+	// Serve is ListenAndServe on an existing listener, which it closes.
+	Serve(ctx context.Context, lis net.Listener) error
+	// Events returns the channel of captured events, closed once Shutdown or
+	// Close returns.
 	Events() <-chan Event
-	// Close stops the proxy.
+	// ServerInfo returns the server info of the latest connection to
+	// complete its handshake, or false if none has yet.
+	ServerInfo() (ServerInfo, bool)
+	// Dropped returns the number of events dropped, or evicted under
+	// DropOldest, because the events channel was full.
+	Dropped() uint64
+	// SetResultColumns turns on recording Event.ResultColumns, which is off
+	// by default. It must be called before serving.
+	SetResultColumns(on bool)
+	// Shutdown stops accepting connections and closes each open one once it
+	// has no statement in flight and no open transaction, or all of them when
+	// ctx is done.
+	Shutdown(ctx context.Context) error
+	// Close stops the proxy, closing open connections right away.
 	Close() error
 }
@@ -0,0 +1,144 @@
+package proxy_test
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestNewEventID(t *testing.T) {
+	t.Parallel()
+
+	const workers, perWorker = 8, 1000
+	ids := make(chan string, workers*perWorker)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for range perWorker {
+				ids <- proxy.NewEventID()
+			}
+		})
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool, workers*perWorker)
+	var prefix string
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ID %q", id)
+		}
+		seen[id] = true
+		p, _, ok := strings.Cut(id, "-")
+		if !ok {
+			t.Fatalf("ID %q has no process prefix", id)
+		}
+		if prefix != "" && p != prefix {
+			t.Fatalf("ID %q: prefix differs from %q", id, prefix)
+		}
+		prefix = p
+	}
+}
+
+func TestEmit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		overflow    proxy.Overflow
+		wantIDs     []string
+		wantDropped uint64
+	}{
+		{overflow: proxy.DropNewest, wantIDs: []string{"0", "1"}, wantDropped: 3},
+		{overflow: proxy.DropOldest, wantIDs: []string{"3", "4"}, wantDropped: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overflow.String(), func(t *testing.T) {
+			t.Parallel()
+
+			events := make(chan proxy.Event, 2)
+			var dropped atomic.Uint64
+			for i := range 5 {
+				proxy.Emit(events, proxy.Event{ID: strconv.Itoa(i)}, tt.overflow, &dropped)
+			}
+			close(events)
+
+			var ids []string
+			for ev := range events {
+				ids = append(ids, ev.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("queued %v, want %v", ids, tt.wantIDs)
+			}
+			if got := dropped.Load(); got != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+
+	t.Run("block", func(t *testing.T) {
+		t.Parallel()
+
+		events := make(chan proxy.Event, 1)
+		var dropped atomic.Uint64
+		proxy.Emit(events, proxy.Event{ID: "0"}, proxy.Block, &dropped)
+
+		sent := make(chan struct{})
+		go func() {
+			proxy.Emit(events, proxy.Event{ID: "1"}, proxy.Block, &dropped)
+			close(sent)
+		}()
+		select {
+		case <-sent:
+			t.Fatal("Emit returned while the channel was full")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if ev := <-events; ev.ID != "0" {
+			t.Errorf("first event = %q, want 0", ev.ID)
+		}
+		<-sent
+		if ev := <-events; ev.ID != "1" {
+			t.Errorf("second event = %q, want 1", ev.ID)
+		}
+	})
+}
+
+func TestParseOverflow(t *testing.T) {
+	t.Parallel()
+
+	for _, o := range []proxy.Overflow{proxy.DropNewest, proxy.DropOldest, proxy.Block} {
+		got, err := proxy.ParseOverflow(o.String())
+		if err != nil || got != o {
+			t.Errorf("ParseOverflow(%q) = %v, %v, want %v", o.String(), got, err, o)
+		}
+	}
+	if _, err := proxy.ParseOverflow("drop"); err == nil {
+		t.Error("ParseOverflow(drop) succeeded, want an error")
+	}
+}
+
+func TestTrackSession(t *testing.T) {
+	t.Parallel()
+
+	var session query.Session
+	ok := &proxy.Event{Query: "SET search_path = app"}
+	proxy.TrackSession(&session, ok, true)
+	if session["search_path"] != "app" || ok.Session["search_path"] != "app" {
+		t.Errorf("after success: session = %v, event = %v, want search_path app", session, ok.Session)
+	}
+
+	failed := &proxy.Event{Query: "SET search_path = other"}
+	proxy.TrackSession(&session, failed, false)
+	if session["search_path"] != "app" || failed.Session["search_path"] != "app" {
+		t.Errorf("after failure: session = %v, event = %v, want search_path unchanged", session, failed.Session)
+	}
+
+	proxy.TrackSession(&session, nil, true)
+}
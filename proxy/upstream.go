@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// Routing is how a proxy with several upstreams picks one for a new client
+// connection.
+type Routing int
+
+const (
+	RoundRobin Routing = iota // cycle through the upstreams
+	ByDatabase                // pick the upstream listed for the client's database
+)
+
+func (r Routing) String() string {
+	switch r {
+	case RoundRobin:
+		return "round-robin"
+	case ByDatabase:
+		return "by-db"
+	}
+	return fmt.Sprintf("Routing(%d)", int(r))
+}
+
+// ParseRouting returns the Routing whose String form is s.
+func ParseRouting(s string) (Routing, error) {
+	for r := RoundRobin; r <= ByDatabase; r++ {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("proxy: unknown routing %q (want round-robin or by-db)", s)
+}
+
+// Upstreams picks the upstream address each new client connection is relayed
+// to. It is safe for concurrent use.
+type Upstreams struct {
+	routing   Routing
+	fallbacks []string          // round-robin targets; with ByDatabase, for unlisted databases
+	byDB      map[string]string // database -> address, with ByDatabase
+	next      atomic.Uint64
+}
+
+// NewUpstreams returns Upstreams cycling through addrs round-robin.
+func NewUpstreams(addrs ...string) *Upstreams {
+	return &Upstreams{routing: RoundRobin, fallbacks: addrs}
+}
+
+// ParseUpstreams parses a comma-separated list of upstream addresses routed
+// as routing says. With ByDatabase, entries take the form database=address;
+// entries without a database serve the databases not listed, round-robin.
+func ParseUpstreams(s string, routing Routing) (*Upstreams, error) {
+	u := &Upstreams{routing: routing}
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		db, addr, ok := strings.Cut(entry, "=")
+		if !ok {
+			u.fallbacks = append(u.fallbacks, entry)
+			continue
+		}
+		db, addr = strings.TrimSpace(db), strings.TrimSpace(addr)
+		switch {
+		case routing != ByDatabase:
+			return nil, fmt.Errorf("proxy: upstream %q names a database, which needs by-db routing", entry)
+		case db == "" || addr == "":
+			return nil, fmt.Errorf("proxy: malformed upstream %q (want database=host:port)", entry)
+		}
+		if u.byDB == nil {
+			u.byDB = make(map[string]string)
+		}
+		if _, dup := u.byDB[db]; dup {
+			return nil, fmt.Errorf("proxy: database %q is listed twice", db)
+		}
+		u.byDB[db] = addr
+	}
+	if len(u.fallbacks) == 0 && len(u.byDB) == 0 {
+		return nil, fmt.Errorf("proxy: no upstream address in %q", s)
+	}
+	return u, nil
+}
+
+// Routing returns how u picks upstreams.
+func (u *Upstreams) Routing() Routing {
+	return u.routing
+}
+
+// Pick returns the upstream for a new connection to database, which is only
+// consulted with ByDatabase routing. It reports false when database is not
+// listed and there is no upstream for unlisted databases.
+func (u *Upstreams) Pick(database string) (string, bool) {
+	if addr, ok := u.byDB[database]; ok && u.routing == ByDatabase {
+		return addr, true
+	}
+	if len(u.fallbacks) == 0 {
+		return "", false
+	}
+	n := u.next.Add(1) - 1
+	return u.fallbacks[n%uint64(len(u.fallbacks))], true
+}
+
+// Single returns the address of u's only upstream, or false if it has several.
+func (u *Upstreams) Single() (string, bool) {
+	switch {
+	case len(u.fallbacks) == 1 && len(u.byDB) == 0:
+		return u.fallbacks[0], true
+	case len(u.fallbacks) == 0 && len(u.byDB) == 1:
+		for _, addr := range u.byDB {
+			return addr, true
+		}
+	}
+	return "", false
+}
+
+// String lists the upstreams the way ParseUpstreams accepts them, with the
+// per-database entries first, sorted by database.
+func (u *Upstreams) String() string {
+	entries := make([]string, 0, len(u.byDB)+len(u.fallbacks))
+	for _, db := range slices.Sorted(maps.Keys(u.byDB)) {
+		entries = append(entries, db+"="+u.byDB[db])
+	}
+	entries = append(entries, u.fallbacks...)
+	return strings.Join(entries, ",")
+}
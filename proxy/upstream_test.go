@@ -0,0 +1,121 @@
+package proxy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestParseRouting(t *testing.T) {
+	t.Parallel()
+
+	for _, r := range []proxy.Routing{proxy.RoundRobin, proxy.ByDatabase} {
+		got, err := proxy.ParseRouting(r.String())
+		if err != nil || got != r {
+			t.Errorf("ParseRouting(%q) = %v, %v, want %v", r.String(), got, err, r)
+		}
+	}
+	if _, err := proxy.ParseRouting("random"); err == nil {
+		t.Error("ParseRouting(random) succeeded, want error")
+	}
+}
+
+func TestUpstreamsRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	u, err := proxy.ParseUpstreams("db1:5432, db2:5432,db3:5432", proxy.RoundRobin)
+	if err != nil {
+		t.Fatalf("ParseUpstreams: %v", err)
+	}
+	counts := make(map[string]int)
+	var order []string
+	for range 9 {
+		// The database is ignored without by-db routing.
+		addr, ok := u.Pick("shop")
+		if !ok {
+			t.Fatal("Pick reported no upstream")
+		}
+		counts[addr]++
+		order = append(order, addr)
+	}
+	for _, addr := range []string{"db1:5432", "db2:5432", "db3:5432"} {
+		if counts[addr] != 3 {
+			t.Errorf("%s picked %d times, want 3 (order %v)", addr, counts[addr], order)
+		}
+	}
+	if order[0] != "db1:5432" || order[1] != "db2:5432" {
+		t.Errorf("order = %v, want the listed order", order)
+	}
+	if _, ok := u.Single(); ok {
+		t.Error("Single reported one upstream for three")
+	}
+	if got, want := u.String(), "db1:5432,db2:5432,db3:5432"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestUpstreamsByDatabase(t *testing.T) {
+	t.Parallel()
+
+	u, err := proxy.ParseUpstreams("shop=db1:5432,analytics=db2:5432,db3:5432,db4:5432", proxy.ByDatabase)
+	if err != nil {
+		t.Fatalf("ParseUpstreams: %v", err)
+	}
+	tests := []struct {
+		database string
+		want     string
+	}{
+		{"shop", "db1:5432"},
+		{"analytics", "db2:5432"},
+		{"shop", "db1:5432"},
+		{"other", "db3:5432"},
+		{"", "db4:5432"},
+		{"other", "db3:5432"},
+	}
+	for _, tt := range tests {
+		if got, ok := u.Pick(tt.database); !ok || got != tt.want {
+			t.Errorf("Pick(%q) = %q, %v, want %q", tt.database, got, ok, tt.want)
+		}
+	}
+	if got, want := u.String(), "analytics=db2:5432,shop=db1:5432,db3:5432,db4:5432"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	listedOnly, err := proxy.ParseUpstreams("shop=db1:5432", proxy.ByDatabase)
+	if err != nil {
+		t.Fatalf("ParseUpstreams: %v", err)
+	}
+	if got, ok := listedOnly.Pick("other"); ok {
+		t.Errorf("Pick(other) = %q, want no upstream", got)
+	}
+	if got, ok := listedOnly.Single(); !ok || got != "db1:5432" {
+		t.Errorf("Single() = %q, %v, want db1:5432", got, ok)
+	}
+}
+
+func TestParseUpstreamsErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		in      string
+		routing proxy.Routing
+		want    string
+	}{
+		{"empty", " , ", proxy.RoundRobin, "no upstream"},
+		{"database without by-db", "shop=db1:5432", proxy.RoundRobin, "needs by-db"},
+		{"missing address", "shop=", proxy.ByDatabase, "malformed"},
+		{"missing database", "=db1:5432", proxy.ByDatabase, "malformed"},
+		{"duplicate database", "shop=db1:5432,shop=db2:5432", proxy.ByDatabase, "listed twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := proxy.ParseUpstreams(tt.in, tt.routing)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseUpstreams(%q) error = %v, want it to contain %q", tt.in, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package query
+
+import "strings"
+
+// AccessScope identifies what a transaction access-mode statement applies to.
+type AccessScope int
+
+const (
+	AccessScopeTx      AccessScope = iota // the current (or next) transaction
+	AccessScopeSession                    // all subsequent transactions in the session
+)
+
+// Access is a transaction access-mode change requested by a statement.
+type Access struct {
+	Scope    AccessScope
+	ReadOnly bool
+}
+
+// ParseAccess reports whether sql changes the transaction access mode
+// (READ ONLY / READ WRITE) and, if so, the requested mode and its scope.
+//
+// Recognized forms:
+//
+//	BEGIN [TRANSACTION] READ ONLY | READ WRITE
+//	START TRANSACTION READ ONLY | READ WRITE
+//	SET TRANSACTION READ ONLY | READ WRITE
+//	SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY | READ WRITE
+//	SET SESSION TRANSACTION READ ONLY | READ WRITE
+//	SET [SESSION] [default_]transaction_read_only = ON | OFF | 1 | 0 | TRUE | FALSE
+//
+// GLOBAL-scoped statements do not affect the current session and are ignored.
+func ParseAccess(sql string) (Access, bool) {
+	upper := strings.Join(strings.Fields(strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(sql), ";"))), " ")
+
+	switch {
+	case strings.HasPrefix(upper, "BEGIN"), strings.HasPrefix(upper, "START TRANSACTION"):
+		return accessMode(upper, AccessScopeTx)
+	case strings.HasPrefix(upper, "SET TRANSACTION "):
+		return accessMode(upper, AccessScopeTx)
+	case strings.HasPrefix(upper, "SET SESSION CHARACTERISTICS AS TRANSACTION "),
+		strings.HasPrefix(upper, "SET SESSION TRANSACTION "):
+		return accessMode(upper, AccessScopeSession)
+	case strings.HasPrefix(upper, "SET "):
+		return accessVariable(upper[len("SET "):])
+	}
+	return Access{}, false
+}
+
+// accessMode extracts a READ ONLY / READ WRITE clause from upper.
+func accessMode(upper string, scope AccessScope) (Access, bool) {
+	switch {
+	case strings.Contains(upper, "READ ONLY"):
+		return Access{Scope: scope, ReadOnly: true}, true
+	case strings.Contains(upper, "READ WRITE"):
+		return Access{Scope: scope, ReadOnly: false}, true
+	}
+	return Access{}, false
+}
+
+// accessVariable parses "[SESSION ][@@[SESSION.]][DEFAULT_]TRANSACTION_READ_ONLY = value".
+func accessVariable(rest string) (Access, bool) {
+	rest = strings.TrimPrefix(rest, "SESSION ")
+	rest = strings.TrimPrefix(rest, "LOCAL ")
+	rest = strings.TrimPrefix(rest, "@@SESSION.")
+	rest = strings.TrimPrefix(rest, "@@")
+
+	name, value, ok := strings.Cut(rest, "=")
+	if !ok {
+		name, value, ok = strings.Cut(rest, " TO ")
+		if !ok {
+			return Access{}, false
+		}
+	}
+	name = strings.TrimSpace(name)
+	if name != "TRANSACTION_READ_ONLY" && name != "DEFAULT_TRANSACTION_READ_ONLY" &&
+		name != "TX_READ_ONLY" {
+		return Access{}, false
+	}
+
+	switch strings.Trim(strings.TrimSpace(value), "'") {
+	case "ON", "1", "TRUE":
+		return Access{Scope: AccessScopeSession, ReadOnly: true}, true
+	case "OFF", "0", "FALSE":
+		return Access{Scope: AccessScopeSession, ReadOnly: false}, true
+	}
+	return Access{}, false
+}
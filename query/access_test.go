@@ -0,0 +1,80 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestParseAccess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		in     string
+		want   query.Access
+		wantOK bool
+	}{
+		{"plain begin", "BEGIN", query.Access{}, false},
+		{"begin read only", "BEGIN READ ONLY", query.Access{Scope: query.AccessScopeTx, ReadOnly: true}, true},
+		{"begin transaction read write", "begin transaction read write", query.Access{Scope: query.AccessScopeTx}, true},
+		{
+			"start transaction read only",
+			"START TRANSACTION READ ONLY",
+			query.Access{Scope: query.AccessScopeTx, ReadOnly: true}, true,
+		},
+		{
+			"start transaction with snapshot",
+			"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+			query.Access{Scope: query.AccessScopeTx, ReadOnly: true}, true,
+		},
+		{
+			"set transaction",
+			"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE READ ONLY",
+			query.Access{Scope: query.AccessScopeTx, ReadOnly: true}, true,
+		},
+		{
+			"set session characteristics",
+			"SET SESSION CHARACTERISTICS AS TRANSACTION READ ONLY",
+			query.Access{Scope: query.AccessScopeSession, ReadOnly: true}, true,
+		},
+		{
+			"mysql set session transaction",
+			"SET SESSION TRANSACTION READ WRITE",
+			query.Access{Scope: query.AccessScopeSession}, true,
+		},
+		{
+			"transaction_read_only on",
+			"SET transaction_read_only = ON",
+			query.Access{Scope: query.AccessScopeSession, ReadOnly: true}, true,
+		},
+		{
+			"session variable 1",
+			"SET SESSION transaction_read_only=1;",
+			query.Access{Scope: query.AccessScopeSession, ReadOnly: true}, true,
+		},
+		{
+			"system variable syntax",
+			"SET @@session.transaction_read_only = 0",
+			query.Access{Scope: query.AccessScopeSession}, true,
+		},
+		{
+			"postgres default_transaction_read_only",
+			"SET default_transaction_read_only TO 'on'",
+			query.Access{Scope: query.AccessScopeSession, ReadOnly: true}, true,
+		},
+		{"global ignored", "SET GLOBAL transaction_read_only = ON", query.Access{}, false},
+		{"unrelated set", "SET search_path TO public", query.Access{}, false},
+		{"select", "SELECT 1", query.Access{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := query.ParseAccess(tt.in)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ParseAccess(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package query
+
+import "strings"
+
+// ParseAutocommit reports whether sql changes the session autocommit mode
+// and, if so, whether autocommit is being turned on.
+//
+// Recognized forms, alone or among other assignments of a SET list such as
+// SET NAMES utf8mb4, autocommit = 0:
+//
+//	SET [SESSION | LOCAL] autocommit = 0 | 1 | ON | OFF | TRUE | FALSE
+//	SET @@[session.]autocommit = ...
+//
+// GLOBAL- and PERSIST-scoped assignments do not affect the current session
+// and are ignored. As in MySQL 8, a scope applies only to the assignment it
+// prefixes; the others in the list are session-scoped.
+func ParseAutocommit(sql string) (on bool, ok bool) {
+	upper := strings.Join(strings.Fields(strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(sql), ";"))), " ")
+	rest, found := strings.CutPrefix(upper, "SET ")
+	if !found {
+		return false, false
+	}
+
+	for _, assign := range splitAssignments(rest) {
+		assign = strings.TrimSpace(assign)
+		global := false
+		for _, p := range []string{"GLOBAL ", "PERSIST ", "PERSIST_ONLY ", "@@GLOBAL.", "@@PERSIST.", "@@PERSIST_ONLY."} {
+			if s, cut := strings.CutPrefix(assign, p); cut {
+				assign, global = s, true
+			}
+		}
+		for _, p := range []string{"SESSION ", "LOCAL ", "@@SESSION.", "@@LOCAL."} {
+			if s, cut := strings.CutPrefix(assign, p); cut {
+				assign, global = s, false
+			}
+		}
+		assign = strings.TrimPrefix(assign, "@@")
+
+		name, value, found := strings.Cut(assign, "=")
+		name = strings.TrimSuffix(strings.TrimSpace(name), ":") // SET autocommit := 0
+		if !found || global || strings.TrimSpace(name) != "AUTOCOMMIT" {
+			continue
+		}
+		switch strings.Trim(strings.TrimSpace(value), "'") {
+		case "ON", "1", "TRUE":
+			on, ok = true, true
+		case "OFF", "0", "FALSE":
+			on, ok = false, true
+		}
+	}
+	return on, ok
+}
+
+// splitAssignments splits the assignment list of a SET statement at commas
+// outside quotes and parentheses.
+func splitAssignments(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'', '"', '`':
+			i = skipQuoted(s, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
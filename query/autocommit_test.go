@@ -0,0 +1,51 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestParseAutocommit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		in     string
+		wantOn bool
+		wantOK bool
+	}{
+		{"off", "SET autocommit=0", false, true},
+		{"on", "SET autocommit = 1", true, true},
+		{"lowercase keyword", "set AutoCommit = off;", false, true},
+		{"session", "SET SESSION autocommit = ON", true, true},
+		{"system variable", "SET @@autocommit=0", false, true},
+		{"session system variable", "SET @@session.autocommit = FALSE", false, true},
+		{"quoted", "SET autocommit = 'OFF'", false, true},
+		{"global ignored", "SET GLOBAL autocommit = 0", false, false},
+		{"other variable", "SET sql_mode = ''", false, false},
+		{"invalid value", "SET autocommit = 2", false, false},
+		{"not a set", "SELECT @@autocommit", false, false},
+		{"assignment list", "SET NAMES utf8mb4, autocommit = 0", false, true},
+		{"assignment list first", "SET autocommit=0, sql_mode='STRICT_TRANS_TABLES,NO_ZERO_DATE'", false, true},
+		{"quoted comma", "SET sql_mode = 'A,autocommit=0'", false, false},
+		{"last assignment wins", "SET autocommit = 0, @@session.autocommit = 1", true, true},
+		{"global scope ends at its assignment", "SET GLOBAL max_connections = 100, autocommit = 0", false, true},
+		{"global system variable in list", "SET @@GLOBAL.x=1, autocommit=0", false, true},
+		{"global after session", "SET autocommit = 0, GLOBAL autocommit = 1", false, true},
+		{"session after global", "SET GLOBAL max_connections = 100, SESSION autocommit = 0", false, true},
+		{"persist ignored", "SET @@persist.autocommit = 0", false, false},
+		{"colon equals", "SET autocommit := 0", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			on, ok := query.ParseAutocommit(tt.in)
+			if on != tt.wantOn || ok != tt.wantOK {
+				t.Errorf("ParseAutocommit(%q) = (%v, %v), want (%v, %v)", tt.in, on, ok, tt.wantOn, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package query
+
+import "strings"
+
+// BatchSize returns the number of row tuples in the VALUES list of an INSERT
+// or REPLACE statement, e.g. 3 for
+//
+//	INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y'), (3, 'z')
+//
+// Commas and parentheses inside string literals and quoted identifiers are
+// ignored. It returns 0 for other statements, including INSERT ... SELECT.
+func BatchSize(sql string) int {
+	s := strings.TrimSpace(sql)
+	end := 0
+	for end < len(s) && isWordByte(s[end]) {
+		end++
+	}
+	first := s[:end]
+	if !strings.EqualFold(first, "INSERT") && !strings.EqualFold(first, "REPLACE") {
+		return 0
+	}
+
+	i := valuesClause(s)
+	if i < 0 {
+		return 0
+	}
+
+	n := 0
+	for {
+		i = skipSpaces(s, i)
+		// MySQL table value constructor: VALUES ROW(...), ROW(...)
+		if len(s)-i >= 3 && strings.EqualFold(s[i:i+3], "ROW") {
+			i = skipSpaces(s, i+3)
+		}
+		if i >= len(s) || s[i] != '(' {
+			return n
+		}
+		end := skipParens(s, i)
+		if end < 0 {
+			return n // unterminated tuple
+		}
+		n++
+		i = skipSpaces(s, end)
+		if i >= len(s) || s[i] != ',' {
+			return n
+		}
+		i++
+	}
+}
+
+// valuesClause returns the offset just past the top-level VALUES (or VALUE)
+// keyword in s, or -1 if there is none.
+func valuesClause(s string) int {
+	depth := 0
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			i = skipQuoted(s, i)
+		case ch == '(':
+			depth++
+			i++
+		case ch == ')':
+			depth--
+			i++
+		case isWordByte(ch):
+			start := i
+			for i < len(s) && isWordByte(s[i]) {
+				i++
+			}
+			word := s[start:i]
+			if depth == 0 && (strings.EqualFold(word, "VALUES") || strings.EqualFold(word, "VALUE")) {
+				return i
+			}
+			if depth == 0 && strings.EqualFold(word, "SELECT") {
+				return -1
+			}
+		default:
+			i++
+		}
+	}
+	return -1
+}
+
+// skipParens returns the offset just past the parenthesis that closes the
+// one at s[pos], or -1 if it is never closed.
+func skipParens(s string, pos int) int {
+	depth := 0
+	for i := pos; i < len(s); {
+		switch s[i] {
+		case '\'', '"', '`':
+			i = skipQuoted(s, i)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// skipQuoted returns the offset just past the quoted literal or identifier
+// starting at s[pos]. A doubled quote or a backslash escapes the next byte.
+func skipQuoted(s string, pos int) int {
+	q := s[pos]
+	for i := pos + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if q == '\'' {
+				i++
+			}
+		case q:
+			if i+1 < len(s) && s[i+1] == q {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,47 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestBatchSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"single row", "INSERT INTO t (a) VALUES (1)", 1},
+		{"multi row", "INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y'), (3, 'z')", 3},
+		{"placeholders", "INSERT INTO t (a, b) VALUES ($1, $2),($3, $4)", 2},
+		{"lowercase and newlines", "insert\ninto t\nvalues\n  (?, ?),\n  (?, ?)", 2},
+		{"value keyword", "INSERT INTO t VALUE (1), (2)", 2},
+		{"replace", "REPLACE INTO t VALUES (1), (2)", 2},
+		{"row constructor", "INSERT INTO t VALUES ROW(1, 2), ROW(3, 4)", 2},
+		{"string with tuple separator", "INSERT INTO t VALUES ('a),(b'), ('c')", 2},
+		{"escaped quotes", `INSERT INTO t VALUES ('it''s'), ('a\'),(b')`, 2},
+		{"quoted identifier named values", "INSERT INTO `values` (`values`) VALUES (1), (2)", 2},
+		{"nested parens", "INSERT INTO t VALUES (lower('A'), (1 + 2)), (lower('B'), 3)", 2},
+		{"on duplicate key", "INSERT INTO t (a) VALUES (1), (2) ON DUPLICATE KEY UPDATE a = VALUES(a)", 2},
+		{"on conflict", "INSERT INTO t (a) VALUES (1) ON CONFLICT (a) DO NOTHING", 1},
+		{"returning", "INSERT INTO t (a) VALUES (1), (2) RETURNING id", 2},
+		{"insert select", "INSERT INTO t (a) SELECT a FROM u", 0},
+		{"unterminated", "INSERT INTO t VALUES (1), (2", 1},
+		{"select", "SELECT * FROM t WHERE a IN (1, 2)", 0},
+		{"update", "UPDATE t SET a = 1", 0},
+		{"empty", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := query.BatchSize(tt.in); got != tt.want {
+				t.Errorf("BatchSize(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
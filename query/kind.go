@@ -0,0 +1,207 @@
+package query
+
+// Kind is the broad class of a statement, derived from its leading verb.
+type Kind int32
+
+const (
+	KindOther Kind = iota // transaction control, SET, CALL and other utility statements
+	KindRead              // SELECT, SHOW, VALUES, plain EXPLAIN
+	KindWrite             // INSERT, UPDATE, DELETE, MERGE, COPY FROM, LOAD DATA
+	KindDDL               // CREATE, ALTER, DROP, TRUNCATE, GRANT, REVOKE
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindOther:
+		return "other"
+	case KindRead:
+		return "read"
+	case KindWrite:
+		return "write"
+	case KindDDL:
+		return "ddl"
+	}
+	return "other"
+}
+
+// ParseKind returns the Kind whose String form is s.
+func ParseKind(s string) (Kind, bool) {
+	for k := KindOther; k <= KindDDL; k++ {
+		if k.String() == s {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// kindVerbs classifies statements by their first keyword. WITH, EXPLAIN and
+// COPY depend on what follows and are handled separately.
+var kindVerbs = map[string]Kind{
+	"select":   KindRead,
+	"show":     KindRead,
+	"table":    KindRead,
+	"values":   KindRead,
+	"insert":   KindWrite,
+	"update":   KindWrite,
+	"delete":   KindWrite,
+	"merge":    KindWrite,
+	"replace":  KindWrite,
+	"upsert":   KindWrite,
+	"load":     KindWrite,
+	"create":   KindDDL,
+	"alter":    KindDDL,
+	"drop":     KindDDL,
+	"truncate": KindDDL,
+	"rename":   KindDDL,
+	"comment":  KindDDL,
+	"grant":    KindDDL,
+	"revoke":   KindDDL,
+}
+
+// Classify returns the Kind of sql. Leading comments and parentheses are
+// skipped. A WITH statement takes the kind of its main statement, or write
+// if one of its CTEs modifies data. EXPLAIN is a read unless it ANALYZEs,
+// and so runs, the explained statement.
+func Classify(sql string) Kind {
+	return classifyTokens(tableTokens(sql))
+}
+
+// Verb returns the lowercased keyword that starts the statement in sql, e.g.
+// "select". Leading comments and parentheses are skipped, and a WITH query
+// yields the verb of its main statement. It returns "" if sql has no keyword.
+func Verb(sql string) string {
+	tokens := tableTokens(sql)
+	i := 0
+	for i < len(tokens) && tokens[i].text == "(" {
+		i++
+	}
+	if i >= len(tokens) {
+		return ""
+	}
+	if tokens[i].text != "with" {
+		return tokens[i].text
+	}
+	if main, _ := withMain(tokens[i+1:]); main != nil {
+		return main[0].text
+	}
+	return "with"
+}
+
+func classifyTokens(tokens []tableToken) Kind {
+	i := 0
+	for i < len(tokens) && tokens[i].text == "(" {
+		i++
+	}
+	if i >= len(tokens) {
+		return KindOther
+	}
+	switch verb := tokens[i].text; verb {
+	case "with":
+		return withKind(tokens[i+1:])
+	case "explain", "describe", "desc":
+		return explainKind(tokens[i+1:])
+	case "copy":
+		return copyKind(tokens[i+1:])
+	default:
+		return kindVerbs[verb]
+	}
+}
+
+// withKind classifies the statement following WITH: its main statement at
+// the top level, or write if a CTE body, one level down, modifies data.
+func withKind(tokens []tableToken) Kind {
+	main, modifies := withMain(tokens)
+	switch {
+	case modifies:
+		return KindWrite
+	case main == nil:
+		return KindOther
+	}
+	return classifyTokens(main)
+}
+
+// withMain finds the main statement in the tokens following WITH: the first
+// top-level verb, after the CTE definitions. It returns the tokens from that
+// verb on, or nil if there is none, and whether a CTE body modifies data.
+func withMain(tokens []tableToken) ([]tableToken, bool) {
+	depth := 0
+	modifies := false
+	for i, tok := range tokens {
+		switch tok.text {
+		case "(":
+			depth++
+			continue
+		case ")":
+			depth--
+			continue
+		}
+		if depth == 1 && i > 0 && tokens[i-1].text == "(" && kindVerbs[tok.text] == KindWrite {
+			modifies = true
+		}
+		if depth != 0 {
+			continue
+		}
+		if _, ok := kindVerbs[tok.text]; !ok {
+			continue // CTE names, AS, RECURSIVE, MATERIALIZED, commas
+		}
+		return tokens[i:], modifies
+	}
+	return nil, modifies
+}
+
+// explainKind classifies the statement following EXPLAIN. Without ANALYZE
+// the statement is only planned, so the EXPLAIN is a read.
+func explainKind(tokens []tableToken) Kind {
+	analyze := false
+	i := 0
+	if i < len(tokens) && tokens[i].text == "(" {
+		// PostgreSQL option list: (ANALYZE, BUFFERS) or (ANALYZE false).
+		for i++; i < len(tokens) && tokens[i].text != ")"; i++ {
+			if tokens[i].text == "analyze" {
+				analyze = i+1 >= len(tokens) || !isFalseOption(tokens[i+1].text)
+			}
+		}
+		i++
+	}
+	for ; i < len(tokens); i++ {
+		text := tokens[i].text
+		if text == "analyze" {
+			analyze = true
+			continue
+		}
+		if _, ok := kindVerbs[text]; ok || text == "with" {
+			break
+		}
+	}
+	if !analyze || i >= len(tokens) {
+		return KindRead
+	}
+	return classifyTokens(tokens[i:])
+}
+
+func isFalseOption(s string) bool {
+	return s == "false" || s == "off" || s == "0"
+}
+
+// copyKind classifies a COPY statement: COPY ... TO reads, COPY ... FROM
+// writes.
+func copyKind(tokens []tableToken) Kind {
+	depth := 0
+	for _, tok := range tokens {
+		switch tok.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case "to":
+			if depth == 0 {
+				return KindRead
+			}
+		case "from":
+			if depth == 0 {
+				return KindWrite
+			}
+		}
+	}
+	return KindOther
+}
@@ -0,0 +1,118 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want query.Kind
+	}{
+		{"select", "SELECT * FROM users", query.KindRead},
+		{"lowercase", "select 1", query.KindRead},
+		{"show", "SHOW TABLES", query.KindRead},
+		{"values", "VALUES (1), (2)", query.KindRead},
+		{"parenthesized union", "(SELECT 1) UNION (SELECT 2)", query.KindRead},
+		{"select for update", "SELECT * FROM users WHERE id = $1 FOR UPDATE", query.KindRead},
+		{"insert", "INSERT INTO users (name) VALUES ($1)", query.KindWrite},
+		{"update", "UPDATE users SET name = $1", query.KindWrite},
+		{"delete", "DELETE FROM users", query.KindWrite},
+		{"merge", "MERGE INTO t USING s ON t.id = s.id WHEN MATCHED THEN DELETE", query.KindWrite},
+		{"replace", "REPLACE INTO users VALUES (1, 'a')", query.KindWrite},
+		{"load data", "LOAD DATA INFILE 'x.csv' INTO TABLE t", query.KindWrite},
+		{"copy from", "COPY users (id, name) FROM STDIN", query.KindWrite},
+		{"copy to", "COPY users TO STDOUT", query.KindRead},
+		{"copy query to", "COPY (SELECT * FROM users) TO STDOUT", query.KindRead},
+		{"create", "CREATE TABLE t (id int)", query.KindDDL},
+		{"alter", "ALTER TABLE t ADD COLUMN a int", query.KindDDL},
+		{"drop", "DROP INDEX idx", query.KindDDL},
+		{"truncate", "TRUNCATE users", query.KindDDL},
+		{"grant", "GRANT SELECT ON t TO app", query.KindDDL},
+		{"begin", "BEGIN", query.KindOther},
+		{"set", "SET search_path = app", query.KindOther},
+		{"call", "CALL refresh()", query.KindOther},
+		{"empty", "", query.KindOther},
+		{"only comment", "-- nothing", query.KindOther},
+
+		{"line comment before verb", "-- fetch users\nSELECT * FROM users", query.KindRead},
+		{"block comment before verb", "/* app:api */ DELETE FROM sessions", query.KindWrite},
+		{"several comments", "/* a */ -- b\n  /* c */ INSERT INTO t VALUES (1)", query.KindWrite},
+		{"string mentioning a verb", "SELECT 'DELETE FROM users'", query.KindRead},
+
+		{"with select", "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent", query.KindRead},
+		{"with recursive", "WITH RECURSIVE t(n) AS (VALUES (1) UNION ALL SELECT n+1 FROM t) SELECT n FROM t", query.KindRead},
+		{"with several ctes", "WITH a AS (SELECT 1), b AS MATERIALIZED (SELECT 2) SELECT * FROM a, b", query.KindRead},
+		{"with insert", "WITH src AS (SELECT * FROM staging) INSERT INTO t SELECT * FROM src", query.KindWrite},
+		{"with modifying cte", "WITH gone AS (DELETE FROM t WHERE old RETURNING *) SELECT count(*) FROM gone", query.KindWrite},
+		{"comment before with", "/* report */ WITH a AS (SELECT 1) SELECT * FROM a", query.KindRead},
+
+		{"explain", "EXPLAIN SELECT * FROM users", query.KindRead},
+		{"explain delete", "EXPLAIN DELETE FROM users", query.KindRead},
+		{"explain analyze select", "EXPLAIN ANALYZE SELECT * FROM users", query.KindRead},
+		{"explain analyze delete", "EXPLAIN ANALYZE DELETE FROM users", query.KindWrite},
+		{"explain options analyze", "EXPLAIN (ANALYZE, BUFFERS) UPDATE users SET a = 1", query.KindWrite},
+		{"explain options analyze false", "EXPLAIN (ANALYZE false, COSTS) UPDATE users SET a = 1", query.KindRead},
+		{"explain analyze verbose", "EXPLAIN ANALYZE VERBOSE INSERT INTO t VALUES (1)", query.KindWrite},
+		{"explain format", "EXPLAIN FORMAT=JSON DELETE FROM t", query.KindRead},
+		{"explain analyze with", "EXPLAIN ANALYZE WITH a AS (SELECT 1) DELETE FROM t", query.KindWrite},
+		{"describe table", "DESCRIBE users", query.KindRead},
+		{"comment before explain", "-- plan\nEXPLAIN ANALYZE DELETE FROM t", query.KindWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := query.Classify(tt.in); got != tt.want {
+				t.Errorf("Classify(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerb(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "SELECT 1", "select"},
+		{"leading whitespace", "\n\t  Insert INTO t VALUES (1)", "insert"},
+		{"block comment", "/*+ IndexScan(users) */ SELECT * FROM users", "select"},
+		{"line comment", "-- refresh\nUPDATE t SET a = 1", "update"},
+		{"parenthesized", "((SELECT 1)) UNION SELECT 2", "select"},
+		{"with select", "WITH a AS (SELECT 1) SELECT * FROM a", "select"},
+		{"with delete", "WITH RECURSIVE a(n) AS (SELECT 1) DELETE FROM t USING a", "delete"},
+		{"bare with", "WITH", "with"},
+		{"other", "BEGIN", "begin"},
+		{"empty", "  -- nothing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := query.Verb(tt.in); got != tt.want {
+				t.Errorf("Verb(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	t.Parallel()
+
+	for _, k := range []query.Kind{query.KindOther, query.KindRead, query.KindWrite, query.KindDDL} {
+		got, ok := query.ParseKind(k.String())
+		if !ok || got != k {
+			t.Errorf("ParseKind(%q) = %v, %v, want %v, true", k.String(), got, ok, k)
+		}
+	}
+	if _, ok := query.ParseKind("select"); ok {
+		t.Error(`ParseKind("select") succeeded`)
+	}
+}
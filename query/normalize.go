@@ -5,8 +5,10 @@ import "strings"
 // Normalize replaces literal values in a SQL query with placeholders,
 // so that structurally identical queries can be grouped together.
 //
-// String literals ('...') are replaced with '?', standalone numeric
-// literals are replaced with ?, and $N parameters are kept as-is.
+// String literals ('...', and PostgreSQL's E'...', U&'...' and $$...$$
+// forms) are replaced with '?', standalone numeric literals (including
+// signed, exponent, hex and binary forms) are replaced with ?, and $N
+// parameters are kept as-is.
 // Consecutive whitespace is collapsed to a single space.
 func Normalize(sql string) string {
 	if sql == "" {
@@ -22,18 +24,32 @@ func Normalize(sql string) string {
 		ch := sql[i]
 
 		if ch == '\'' {
-			i = normalizeString(&b, sql, i)
+			i = normalizeString(&b, sql, i, false)
 			prevSpace = false
 			continue
 		}
 
+		if n := stringPrefixLen(sql, i); n > 0 {
+			i = normalizeString(&b, sql, i+n, n == 1)
+			prevSpace = false
+			continue
+		}
+
+		if ch == '$' && (i == 0 || !isWordByte(sql[i-1])) {
+			if next, ok := normalizeDollarQuoted(&b, sql, i); ok {
+				i = next
+				prevSpace = false
+				continue
+			}
+		}
+
 		if ch == '$' && i+1 < len(sql) && isDigit(sql[i+1]) {
 			i = keepParam(&b, sql, i)
 			prevSpace = false
 			continue
 		}
 
-		if isDigit(ch) && (i == 0 || isNumBoundary(sql[i-1])) {
+		if startsNumber(sql, i) && (i == 0 || isNumBoundary(sql[i-1])) && (!isSign(ch) || unarySign(b.String())) {
 			if next, ok := normalizeNumber(&b, sql, i); ok {
 				i = next
 				prevSpace = false
@@ -58,10 +74,15 @@ func Normalize(sql string) string {
 	return strings.TrimRight(b.String(), " ")
 }
 
-// normalizeString replaces a string literal starting at pos with '?'.
-func normalizeString(b *strings.Builder, sql string, pos int) int {
+// normalizeString replaces a string literal starting at pos with '?'. With
+// backslash set, as in an E'...' string, a backslash escapes the next byte.
+func normalizeString(b *strings.Builder, sql string, pos int, backslash bool) int {
 	j := pos + 1
 	for j < len(sql) {
+		if backslash && sql[j] == '\\' {
+			j += 2
+			continue
+		}
 		if sql[j] == '\'' && j+1 < len(sql) && sql[j+1] == '\'' {
 			j += 2
 			continue
@@ -76,6 +97,44 @@ func normalizeString(b *strings.Builder, sql string, pos int) int {
 	return j
 }
 
+// stringPrefixLen returns the length of the E or U& prefix of a PostgreSQL
+// escape or Unicode string literal at pos, or 0 if there is none.
+func stringPrefixLen(sql string, pos int) int {
+	if pos > 0 && isWordByte(sql[pos-1]) {
+		return 0
+	}
+	rest := sql[pos:]
+	switch {
+	case len(rest) >= 2 && (rest[0] == 'E' || rest[0] == 'e') && rest[1] == '\'':
+		return 1
+	case len(rest) >= 3 && (rest[0] == 'U' || rest[0] == 'u') && rest[1] == '&' && rest[2] == '\'':
+		return 2
+	}
+	return 0
+}
+
+// normalizeDollarQuoted replaces a PostgreSQL dollar-quoted string ($$...$$
+// or $tag$...$tag$) starting at pos with '?'. Returns (newPos, true) if
+// replaced, or (0, false) if there is no dollar quote at pos.
+func normalizeDollarQuoted(b *strings.Builder, sql string, pos int) (int, bool) {
+	j := pos + 1
+	for j < len(sql) && isWordByte(sql[j]) {
+		j++
+	}
+	if j >= len(sql) || sql[j] != '$' {
+		return 0, false
+	}
+	tag := sql[pos : j+1]
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		end = len(sql)
+	} else {
+		end += j + 1 + len(tag)
+	}
+	b.WriteString("'?'")
+	return end, true
+}
+
 // keepParam writes $N parameter as-is and returns the new position.
 func keepParam(b *strings.Builder, sql string, pos int) int {
 	b.WriteByte('$')
@@ -87,13 +146,18 @@ func keepParam(b *strings.Builder, sql string, pos int) int {
 	return j
 }
 
-// normalizeNumber replaces a numeric literal at pos with '?'.
-// Returns (newPos, true) if replaced, or (0, false) if not a standalone number.
+// normalizeNumber replaces a numeric literal at pos, with an optional sign,
+// with '?'. Returns (newPos, true) if replaced, or (0, false) if not a
+// standalone number.
 func normalizeNumber(b *strings.Builder, sql string, pos int) (int, bool) {
-	j := pos + 1
-	for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+	j := pos
+	if isSign(sql[j]) {
 		j++
 	}
+	j, ok := scanNumber(sql, j)
+	if !ok {
+		return 0, false
+	}
 	if j >= len(sql) || isNumBoundary(sql[j]) {
 		b.WriteByte('?')
 		return j, true
@@ -101,8 +165,105 @@ func normalizeNumber(b *strings.Builder, sql string, pos int) (int, bool) {
 	return 0, false
 }
 
+// scanNumber returns the end of the unsigned numeric literal at pos: 0x1F,
+// 0b101 and 0o17 in their base, otherwise digits with an optional fraction
+// and exponent, as in 42, 3.14, .5 and 1.5e-10.
+func scanNumber(sql string, pos int) (int, bool) {
+	if sql[pos] == '0' && pos+2 < len(sql) {
+		var digit func(byte) bool
+		switch sql[pos+1] {
+		case 'x', 'X':
+			digit = isHexDigit
+		case 'b', 'B':
+			digit = func(c byte) bool { return c == '0' || c == '1' }
+		case 'o', 'O':
+			digit = func(c byte) bool { return c >= '0' && c <= '7' }
+		}
+		if digit != nil && digit(sql[pos+2]) {
+			j := pos + 3
+			for j < len(sql) && digit(sql[j]) {
+				j++
+			}
+			return j, true
+		}
+	}
+
+	j := pos
+	digits := 0
+	for j < len(sql) && isDigit(sql[j]) {
+		j++
+		digits++
+	}
+	if j < len(sql) && sql[j] == '.' {
+		j++
+		for j < len(sql) && isDigit(sql[j]) {
+			j++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, false
+	}
+	if j < len(sql) && (sql[j] == 'e' || sql[j] == 'E') {
+		k := j + 1
+		if k < len(sql) && isSign(sql[k]) {
+			k++
+		}
+		if k < len(sql) && isDigit(sql[k]) {
+			j = k
+			for j < len(sql) && isDigit(sql[j]) {
+				j++
+			}
+		}
+	}
+	return j, true
+}
+
+// startsNumber reports whether a numeric literal, possibly signed, may start
+// at pos.
+func startsNumber(sql string, pos int) bool {
+	if isSign(sql[pos]) {
+		pos++
+	}
+	if pos < len(sql) && sql[pos] == '.' {
+		pos++
+	}
+	return pos < len(sql) && isDigit(sql[pos])
+}
+
+// unarySignWords are keywords after which + or - is a sign, not an operator.
+var unarySignWords = map[string]bool{
+	"select": true, "where": true, "and": true, "or": true, "not": true,
+	"when": true, "then": true, "else": true, "limit": true, "offset": true,
+	"between": true, "in": true, "is": true, "like": true, "return": true,
+}
+
+// unarySign reports whether a + or - following the normalized text out is a
+// sign: at the start, or after an operator, an opening paren, a comma or a
+// keyword such as SELECT.
+func unarySign(out string) bool {
+	out = strings.TrimRight(out, " ")
+	if out == "" {
+		return true
+	}
+	if strings.IndexByte(",(=<>+-*/%", out[len(out)-1]) >= 0 {
+		return true
+	}
+	start := len(out)
+	for start > 0 && isWordByte(out[start-1]) {
+		start--
+	}
+	return unarySignWords[strings.ToLower(out[start:])]
+}
+
+func isSign(c byte) bool { return c == '+' || c == '-' }
+
 func isDigit(c byte) bool { return c >= '0' && c <= '9' }
 
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
 func isSpace(c byte) bool {
 	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
 }
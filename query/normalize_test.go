@@ -25,7 +25,28 @@ func TestNormalize(t *testing.T) {
 		{"whitespace collapse", "SELECT  id\n\tFROM  users", "SELECT id FROM users"},
 		{"leading trailing space", "  SELECT 1  ", "SELECT ?"},
 		{"no replace in identifier", "SELECT t1.id FROM t1", "SELECT t1.id FROM t1"},
-		{"negative number", "WHERE x = -5", "WHERE x = -?"},
+		{"negative number", "WHERE x = -5", "WHERE x = ?"},
+		{"positive sign", "WHERE x = +5", "WHERE x = ?"},
+		{"negative in list", "WHERE id IN (-1, 2, -3)", "WHERE id IN (?, ?, ?)"},
+		{"negative after keyword", "SELECT -1", "SELECT ?"},
+		{"subtraction kept", "SELECT a - 5, b-5 FROM t", "SELECT a - ?, b-? FROM t"},
+		{"subtraction of literals", "SELECT 10-5", "SELECT ?-?"},
+		{"scientific", "WHERE x > 1.5e10 AND y < 2E-3", "WHERE x > ? AND y < ?"},
+		{"negative scientific", "WHERE x = -6.02e+23", "WHERE x = ?"},
+		{"leading dot", "WHERE x = .5", "WHERE x = ?"},
+		{"hex", "WHERE flags = 0xFF", "WHERE flags = ?"},
+		{"binary", "WHERE flags = 0b1010", "WHERE flags = ?"},
+		{"hex not in identifier", "SELECT 0xFFg FROM t", "SELECT 0xFFg FROM t"},
+		{"escape string", `WHERE note = E'line\n'`, "WHERE note = '?'"},
+		{"escape string escaped quote", `WHERE name = E'it\'s' AND id = 1`, "WHERE name = '?' AND id = ?"},
+		{"escape string escaped backslash", `WHERE path = e'C:\\' AND id = 1`, "WHERE path = '?' AND id = ?"},
+		{"unicode string", `WHERE name = U&'\0441\043B\043E\043D'`, "WHERE name = '?'"},
+		{"unicode string doubled quote", `WHERE name = u&'d''\0061t'`, "WHERE name = '?'"},
+		{"prefix letter in identifier", "SELECT name'x' FROM t", "SELECT name'?' FROM t"},
+		{"bytea escape", `WHERE data = '\x0a' AND id = 1`, "WHERE data = '?' AND id = ?"},
+		{"dollar quoted", "SELECT $$it's 42$$", "SELECT '?'"},
+		{"tagged dollar quoted", "DO $body$ BEGIN RAISE 'x $$ y'; END $body$", "DO '?'"},
+		{"dollar in identifier", "SELECT a$b$c FROM t", "SELECT a$b$c FROM t"},
 		{"multiple string literals", "INSERT INTO t (a, b) VALUES ('x', 'y')", "INSERT INTO t (a, b) VALUES ('?', '?')"},
 	}
 	for _, tt := range tests {
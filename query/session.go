@@ -0,0 +1,188 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Session is the set of session variables a connection has changed with SET,
+// keyed by lowercase variable name. A Session is never modified in place:
+// Apply returns a new map when a statement changes it, so events captured
+// earlier can keep referencing the state that was in effect for them.
+type Session map[string]string
+
+// IsSet reports whether sql is a SET or RESET statement.
+func IsSet(sql string) bool {
+	kw := leadingKeyword(sql)
+	return kw == "SET" || kw == "RESET"
+}
+
+// reAssignment matches the start of one assignment in a SET statement:
+// a (possibly @@scope. prefixed) name followed by =, := or TO.
+var reAssignment = regexp.MustCompile(`(?i)^\s*(@@(?:session\.|local\.|global\.)?)?([a-z_][\w.]*)\s*(?:=|:=|\s+to\s)`)
+
+// Apply returns the session that results from executing sql. Recognized forms:
+//
+//	SET [SESSION] name { = | TO } value [, name = value ...]
+//	SET @@[session. | local.]name = value
+//	SET TIME ZONE value, SET NAMES charset, SET SCHEMA 'name', SET ROLE name
+//	RESET name, RESET ALL, DISCARD ALL
+//
+// A value of DEFAULT removes the variable. Global, transaction-local
+// (SET LOCAL), user-variable (@name) and password assignments do not change
+// the session and are ignored, as are statements that are not SETs at all.
+func (s Session) Apply(sql string) Session {
+	stmt := strings.TrimSuffix(strings.TrimSpace(sql), ";")
+	fields := strings.Fields(stmt)
+	if len(fields) < 2 {
+		return s
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "RESET":
+		if strings.EqualFold(fields[1], "ALL") {
+			return nil
+		}
+		return s.with(map[string]string{strings.ToLower(fields[1]): ""})
+	case "DISCARD":
+		if strings.EqualFold(fields[1], "ALL") {
+			return nil
+		}
+		return s
+	case "SET":
+	default:
+		return s
+	}
+
+	rest := strings.TrimSpace(stmt[len(fields[0]):])
+	switch strings.ToUpper(fields[1]) {
+	case "LOCAL", "GLOBAL", "PERSIST", "PERSIST_ONLY", "TRANSACTION", "CONSTRAINTS", "PASSWORD":
+		return s
+	case "SESSION":
+		if len(fields) > 2 && strings.EqualFold(fields[2], "CHARACTERISTICS") ||
+			len(fields) > 2 && strings.EqualFold(fields[2], "AUTHORIZATION") {
+			return s
+		}
+		rest = strings.TrimSpace(rest[len(fields[1]):])
+	}
+
+	changes := make(map[string]string)
+	var name string
+	for _, part := range splitTopLevel(rest, ',') {
+		m := reAssignment.FindStringSubmatchIndex(part)
+		if m == nil {
+			if n, v, ok := specialSet(strings.TrimSpace(part)); ok {
+				name = n
+				changes[name] = v
+				continue
+			}
+			// A continuation of a list value, e.g. SET search_path TO a, b.
+			if name != "" {
+				changes[name] += ", " + strings.TrimSpace(part)
+			}
+			continue
+		}
+		name = strings.ToLower(part[m[4]:m[5]])
+		if m[2] >= 0 && strings.EqualFold(part[m[2]:m[3]], "@@global.") {
+			name = ""
+			continue
+		}
+		changes[name] = strings.TrimSpace(part[m[1]:])
+	}
+	for n, v := range changes {
+		changes[n] = settingValue(v)
+	}
+	if len(changes) == 0 {
+		return s
+	}
+	return s.with(changes)
+}
+
+// Set returns the session with variable name set to value, or removed if value
+// is empty. It records changes learned from the server rather than from a
+// statement.
+func (s Session) Set(name, value string) Session {
+	return s.with(map[string]string{name: value})
+}
+
+// specialSet handles the SET forms that don't use name = value syntax.
+func specialSet(part string) (name, value string, ok bool) {
+	upper := strings.ToUpper(part)
+	switch {
+	case strings.HasPrefix(upper, "TIME ZONE "):
+		return "timezone", strings.TrimSpace(part[len("TIME ZONE "):]), true
+	case strings.HasPrefix(upper, "NAMES "):
+		return "names", strings.TrimSpace(part[len("NAMES "):]), true
+	case strings.HasPrefix(upper, "SCHEMA "):
+		return "search_path", strings.TrimSpace(part[len("SCHEMA "):]), true
+	case strings.HasPrefix(upper, "ROLE "):
+		return "role", strings.TrimSpace(part[len("ROLE "):]), true
+	}
+	return "", "", false
+}
+
+// settingValue normalizes an assigned value: surrounding whitespace and the
+// quotes of a single quoted literal are removed, and DEFAULT becomes "".
+func settingValue(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.EqualFold(v, "DEFAULT") {
+		return ""
+	}
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] &&
+		!strings.ContainsRune(v[1:len(v)-1], rune(v[0])) {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// with returns a copy of s with changes applied; an empty value removes the
+// variable. A nil Session is returned when nothing is left.
+func (s Session) with(changes map[string]string) Session {
+	out := make(Session, len(s)+len(changes))
+	for k, v := range s {
+		out[k] = v
+	}
+	for k, v := range changes {
+		if v == "" {
+			delete(out, k)
+		} else {
+			out[k] = v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// splitTopLevel splits s at sep characters that are outside quotes and
+// parentheses.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(s, i) - 1
+		case '(':
+			depth++
+		case ')':
+			depth = max(depth-1, 0)
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// leadingKeyword returns the first word of sql in upper case.
+func leadingKeyword(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimRight(fields[0], ";"))
+}
@@ -0,0 +1,88 @@
+package query_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestSessionApply(t *testing.T) {
+	t.Parallel()
+
+	base := query.Session{"search_path": "app"}
+	tests := []struct {
+		name string
+		prev query.Session
+		in   string
+		want query.Session
+	}{
+		{"equals", nil, "SET statement_timeout = 5000", query.Session{"statement_timeout": "5000"}},
+		{"to", nil, "set Search_Path TO app, public;", query.Session{"search_path": "app, public"}},
+		{"session keyword", nil, "SET SESSION sql_mode = 'STRICT_ALL_TABLES'", query.Session{"sql_mode": "STRICT_ALL_TABLES"}},
+		{"system variable", nil, "SET @@session.time_zone = '+00:00'", query.Session{"time_zone": "+00:00"}},
+		{"bare system variable", nil, "SET @@wait_timeout=60", query.Session{"wait_timeout": "60"}},
+		{"multiple", nil, "SET a = 1, @@local.b = 'x'", query.Session{"a": "1", "b": "x"}},
+		{"after quoted value", nil, "SET a = 'x',b = 2", query.Session{"a": "x", "b": "2"}},
+		{"quoted comma", nil, "SET application_name = 'a,b'", query.Session{"application_name": "a,b"}},
+		{"time zone", nil, "SET TIME ZONE 'UTC'", query.Session{"timezone": "UTC"}},
+		{"names", nil, "SET NAMES utf8mb4", query.Session{"names": "utf8mb4"}},
+		{"names with others", nil, "SET NAMES utf8mb4, time_zone = 'UTC'", query.Session{"names": "utf8mb4", "time_zone": "UTC"}},
+		{"schema", nil, "SET SCHEMA 'app'", query.Session{"search_path": "app"}},
+		{"role", nil, "SET ROLE reader", query.Session{"role": "reader"}},
+		{"overrides", base, "SET search_path = public", query.Session{"search_path": "public"}},
+		{"keeps others", base, "SET lock_timeout = '1s'", query.Session{"search_path": "app", "lock_timeout": "1s"}},
+		{"default removes", base, "SET search_path TO DEFAULT", nil},
+		{"reset", base, "RESET search_path", nil},
+		{"reset all", base, "RESET ALL", nil},
+		{"discard all", base, "DISCARD ALL", nil},
+		{"local ignored", base, "SET LOCAL statement_timeout = 0", base},
+		{"global ignored", base, "SET GLOBAL max_connections = 10", base},
+		{"global system variable ignored", base, "SET @@global.x = 1", base},
+		{"transaction ignored", base, "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE", base},
+		{"user variable ignored", base, "SET @id = 5", base},
+		{"password ignored", base, "SET PASSWORD = 'secret'", base},
+		{"not a set", base, "SELECT 1", base},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := tt.prev.Apply(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionApplyDoesNotModify(t *testing.T) {
+	t.Parallel()
+
+	prev := query.Session{"search_path": "app"}
+	_ = prev.Apply("SET search_path = public")
+	if prev["search_path"] != "app" {
+		t.Errorf("previous session modified: %v", prev)
+	}
+}
+
+func TestIsSet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"SET a = 1", true},
+		{"  reset ALL", true},
+		{"SELECT 1", false},
+		{"SETTINGS", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := query.IsSet(tt.in); got != tt.want {
+			t.Errorf("IsSet(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package query
+
+import "strings"
+
+// tableToken is a lexical token of a statement as seen by Tables.
+type tableToken struct {
+	text  string // lowercased word or unquoted identifier; punctuation as is
+	ident bool   // word or quoted identifier
+}
+
+// Tables returns the tables a statement refers to: the identifiers following
+// FROM, INTO, UPDATE and JOIN, including comma-separated FROM lists and
+// tables inside subqueries. Names are lowercased and unquoted, keep their
+// schema qualifier (public.users), and are listed once in order of first
+// appearance.
+//
+// This is a lightweight scan, not a parser: FROM inside function calls such
+// as EXTRACT(YEAR FROM ts) or after IS DISTINCT, and the UPDATE of FOR UPDATE,
+// DO UPDATE and ON DUPLICATE KEY UPDATE are skipped, but CTE names are
+// reported like tables.
+func Tables(sql string) []string {
+	tokens := tableTokens(sql)
+
+	var tables []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+
+	// parens tracks, for each open parenthesis, whether it opens a subquery
+	// (whose FROMs count) rather than an expression or argument list.
+	var parens []bool
+	inExpr := func() bool { return len(parens) > 0 && !parens[len(parens)-1] }
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.text == "(":
+			next := ""
+			if i+1 < len(tokens) {
+				next = tokens[i+1].text
+			}
+			parens = append(parens, next == "select" || next == "with")
+			continue
+		case tok.text == ")":
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+			continue
+		case !tok.ident || inExpr():
+			continue
+		}
+
+		switch tok.text {
+		case "from":
+			if i > 0 && tokens[i-1].text == "distinct" {
+				continue // IS [NOT] DISTINCT FROM expr
+			}
+			for {
+				j, name := tableName(tokens, i+1)
+				if name == "" {
+					break
+				}
+				add(name)
+				j = skipAlias(tokens, j)
+				if j >= len(tokens) || tokens[j].text != "," {
+					i = j - 1
+					break
+				}
+				i = j
+			}
+		case "into", "join":
+			if _, name := tableName(tokens, i+1); name != "" {
+				add(name)
+			}
+		case "update":
+			if i > 0 {
+				switch tokens[i-1].text {
+				case "for", "do", "key":
+					continue
+				}
+			}
+			if _, name := tableName(tokens, i+1); name != "" {
+				add(name)
+			}
+		}
+	}
+	return tables
+}
+
+// tableModifiers may precede a table name without being one.
+var tableModifiers = map[string]bool{
+	"only": true, "lateral": true, "ignore": true, "low_priority": true, "table": true,
+}
+
+// notTables are keywords that follow FROM, INTO, UPDATE or JOIN in a
+// position where no table is named.
+var notTables = map[string]bool{
+	"select": true, "with": true, "set": true, "values": true, "unnest": true,
+	"generate_series": true, "dual": true,
+}
+
+// tableName reads a table name starting at tokens[i] and returns the index
+// after it. It returns "" when no table name is found there.
+func tableName(tokens []tableToken, i int) (int, string) {
+	for i < len(tokens) && tokens[i].ident && tableModifiers[tokens[i].text] {
+		i++
+	}
+	if i >= len(tokens) || !tokens[i].ident || notTables[tokens[i].text] {
+		return i, ""
+	}
+	name := tokens[i].text
+	i++
+	// A schema-qualified name with a quoted part arrives as several tokens.
+	for i+1 < len(tokens) && tokens[i].text == "." && tokens[i+1].ident {
+		name += "." + tokens[i+1].text
+		i += 2
+	}
+	return i, name
+}
+
+// aliasStops are the keywords that can follow a table in a FROM list and
+// are therefore not its alias.
+var aliasStops = map[string]bool{
+	"where": true, "join": true, "inner": true, "left": true, "right": true, "full": true,
+	"cross": true, "natural": true, "on": true, "using": true, "group": true, "order": true,
+	"limit": true, "having": true, "window": true, "union": true, "except": true,
+	"intersect": true, "returning": true, "for": true, "offset": true, "fetch": true,
+	"straight_join": true, "partition": true, "use": true, "force": true, "ignore": true,
+	"set": true, "tablesample": true,
+}
+
+// skipAlias skips an optional "[AS] alias" at tokens[i].
+func skipAlias(tokens []tableToken, i int) int {
+	if i < len(tokens) && tokens[i].text == "as" {
+		i++
+	}
+	if i < len(tokens) && tokens[i].ident && !aliasStops[tokens[i].text] {
+		i++
+	}
+	return i
+}
+
+// tableTokens splits sql into words, quoted identifiers and punctuation.
+// String literals and comments are dropped.
+func tableTokens(sql string) []tableToken {
+	var tokens []tableToken
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '\'':
+			i = skipQuoted(sql, i)
+		case c == '"' || c == '`':
+			end := skipQuoted(sql, i)
+			inner := sql[i+1 : max(end-1, i+1)]
+			inner = strings.ReplaceAll(inner, string(c)+string(c), string(c))
+			tokens = append(tokens, tableToken{text: strings.ToLower(inner), ident: true})
+			i = end
+		case isWordByte(c) || c == '$' || c >= 0x80:
+			start := i
+			for i < len(sql) && (isWordByte(sql[i]) || sql[i] == '$' || sql[i] == '.' || sql[i] >= 0x80) {
+				if sql[i] == '.' && (i+1 >= len(sql) || sql[i+1] == '"' || sql[i+1] == '`') {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, tableToken{text: strings.ToLower(sql[start:i]), ident: true})
+		default:
+			tokens = append(tokens, tableToken{text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,54 @@
+package query_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/mickamy/sql-tap/query"
+)
+
+func TestTables(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"select", "SELECT * FROM users WHERE id = $1", []string{"users"}},
+		{"case and alias", "select u.id from Users AS u", []string{"users"}},
+		{"join", "SELECT * FROM orders o JOIN users u ON u.id = o.user_id LEFT JOIN items i USING (order_id)", []string{"orders", "users", "items"}},
+		{"comma list", "SELECT * FROM a x, b, c AS z WHERE x.id = b.id", []string{"a", "b", "c"}},
+		{"insert", "INSERT INTO orders (user_id, total) VALUES (?, ?)", []string{"orders"}},
+		{"insert select", "INSERT INTO archive SELECT * FROM orders", []string{"archive", "orders"}},
+		{"update", "UPDATE users SET name = ? WHERE id = ?", []string{"users"}},
+		{"mysql update modifiers", "UPDATE LOW_PRIORITY IGNORE users SET a = 1", []string{"users"}},
+		{"delete", "DELETE FROM sessions WHERE expires_at < now()", []string{"sessions"}},
+		{"schema", "SELECT * FROM public.users", []string{"public.users"}},
+		{"quoted", `SELECT * FROM "Order Items" JOIN ` + "`shop`.`carts`", []string{"order items", "shop.carts"}},
+		{"quoted schema", `SELECT * FROM "app"."Users"`, []string{"app.users"}},
+		{"only", "SELECT * FROM ONLY parent", []string{"parent"}},
+		{"subquery", "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", []string{"users", "orders"}},
+		{"derived table", "SELECT * FROM (SELECT * FROM users) AS t JOIN orders ON true", []string{"users", "orders"}},
+		{"function from", "SELECT EXTRACT(YEAR FROM created_at) FROM events", []string{"events"}},
+		{"distinct from", "SELECT * FROM t WHERE a IS DISTINCT FROM b", []string{"t"}},
+		{"for update", "SELECT * FROM jobs WHERE id = 1 FOR UPDATE SKIP LOCKED", []string{"jobs"}},
+		{"upsert", "INSERT INTO t (id) VALUES (1) ON CONFLICT (id) DO UPDATE SET id = 2", []string{"t"}},
+		{"duplicate key", "INSERT INTO t (id) VALUES (1) ON DUPLICATE KEY UPDATE n = n + 1", []string{"t"}},
+		{"string literal", "SELECT 'FROM fake' FROM real_table", []string{"real_table"}},
+		{"comment", "SELECT 1 /* FROM fake */ FROM real_table -- JOIN other", []string{"real_table"}},
+		{"deduplicated", "SELECT * FROM users u1 JOIN users u2 ON u1.id = u2.manager_id", []string{"users"}},
+		{"no table", "SELECT 1", nil},
+		{"set", "SET search_path TO app", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := query.Tables(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("Tables(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"google.golang.org/grpc"
@@ -23,16 +25,40 @@ import (
 // Server exposes a gRPC TapService for TUI clients to connect to.
 type Server struct {
 	grpcServer *grpc.Server
+	svc        *tapService
 }
 
 // New creates a new Server backed by the given Broker.
-// explainClient may be nil if EXPLAIN is not configured.
-func New(b *broker.Broker, explainClient *explain.Client) *Server {
-	gs := grpc.NewServer()
+// explainClient may be nil if EXPLAIN is not configured. opts are passed to
+// the underlying gRPC server, e.g. auth.ServerOptions.
+func New(b *broker.Broker, explainClient *explain.Client, opts ...grpc.ServerOption) *Server {
+	gs := grpc.NewServer(opts...)
 	svc := &tapService{broker: b, explainClient: explainClient}
 	tapv1.RegisterTapServiceServer(gs, svc)
 
-	return &Server{grpcServer: gs}
+	return &Server{grpcServer: gs, svc: svc}
+}
+
+// SetServerInfo makes the ServerInfo RPC report driver and the upstream
+// server info returned by info, e.g. a proxy's ServerInfo method. info may be
+// nil when nothing is proxied, as when replaying. It must be called before
+// Serve.
+func (s *Server) SetServerInfo(driver string, info func() (proxy.ServerInfo, bool)) {
+	s.svc.driver = driver
+	s.svc.serverInfo = info
+}
+
+// SetNPlus1Window makes the ServerInfo RPC report window as the N+1
+// detection window. It must be called before Serve.
+func (s *Server) SetNPlus1Window(window time.Duration) {
+	s.svc.nplus1Window = window
+}
+
+// SetProxyDropped makes Watch count the events dropped by the proxy, as
+// reported by dropped, e.g. a proxy's Dropped method. It must be called
+// before Serve.
+func (s *Server) SetProxyDropped(dropped func() uint64) {
+	s.svc.proxyDropped = dropped
 }
 
 // Serve starts the gRPC server on the given listener.
@@ -58,10 +84,14 @@ type tapService struct {
 
 	broker        *broker.Broker
 	explainClient *explain.Client
+	driver        string
+	serverInfo    func() (proxy.ServerInfo, bool) // nil if not proxying
+	proxyDropped  func() uint64                   // nil if not proxying
+	nplus1Window  time.Duration                   // 0 if N+1 detection is off
 }
 
 func (s *tapService) Watch(_ *tapv1.WatchRequest, stream grpc.ServerStreamingServer[tapv1.WatchResponse]) error {
-	ch, unsub := s.broker.Subscribe()
+	ch, dropped, unsub := s.broker.SubscribeCounted()
 	defer unsub()
 
 	ctx := stream.Context()
@@ -74,7 +104,8 @@ func (s *tapService) Watch(_ *tapv1.WatchRequest, stream grpc.ServerStreamingSer
 				return nil
 			}
 			if err := stream.Send(&tapv1.WatchResponse{
-				Event: eventToProto(ev),
+				Event:   eventToProto(ev),
+				Dropped: s.dropped(dropped),
 			}); err != nil {
 				return fmt.Errorf("server: watch send: %w", err)
 			}
@@ -82,6 +113,17 @@ func (s *tapService) Watch(_ *tapv1.WatchRequest, stream grpc.ServerStreamingSer
 	}
 }
 
+// dropped returns the events a Watch stream has missed: those the proxy
+// dropped and those the stream's subscription, counting with subDropped,
+// dropped.
+func (s *tapService) dropped(subDropped func() uint64) uint64 {
+	n := subDropped()
+	if s.proxyDropped != nil {
+		n += s.proxyDropped()
+	}
+	return n
+}
+
 func (s *tapService) Explain(ctx context.Context, req *tapv1.ExplainRequest) (*tapv1.ExplainResponse, error) {
 	if s.explainClient == nil {
 		return nil, status.Error(codes.FailedPrecondition, "EXPLAIN is not configured (set DATABASE_URL)")
@@ -92,7 +134,7 @@ func (s *tapService) Explain(ctx context.Context, req *tapv1.ExplainRequest) (*t
 		mode = explain.Analyze
 	}
 
-	result, err := s.explainClient.Run(ctx, mode, req.GetQuery(), req.GetArgs())
+	result, err := s.explainClient.Run(ctx, mode, req.GetQuery(), req.GetArgs(), proxy.ParseArgTypes(req.GetArgTypes()))
 	if err != nil {
 		if errors.Is(ctx.Err(), context.Canceled) {
 			return nil, status.Error(codes.Canceled, err.Error())
@@ -103,6 +145,21 @@ func (s *tapService) Explain(ctx context.Context, req *tapv1.ExplainRequest) (*t
 	return &tapv1.ExplainResponse{Plan: result.Plan}, nil
 }
 
+func (s *tapService) ServerInfo(_ context.Context, _ *tapv1.ServerInfoRequest) (*tapv1.ServerInfoResponse, error) {
+	resp := &tapv1.ServerInfoResponse{Driver: s.driver}
+	if s.nplus1Window > 0 {
+		resp.Nplus1Window = durationpb.New(s.nplus1Window)
+	}
+	if s.serverInfo != nil {
+		if info, ok := s.serverInfo(); ok {
+			resp.Version = sanitizeUTF8(info.Version)
+			resp.Tls = info.TLS
+			resp.Compression = info.Compression
+		}
+	}
+	return resp, nil
+}
+
 func eventToProto(ev proxy.Event) *tapv1.QueryEvent {
 	args := make([]string, len(ev.Args))
 	for i, a := range ev.Args {
@@ -113,6 +170,7 @@ func eventToProto(ev proxy.Event) *tapv1.QueryEvent {
 		Op:              int32(ev.Op),
 		Query:           sanitizeUTF8(ev.Query),
 		Args:            args,
+		ArgTypes:        proxy.ArgTypeNames(ev.ArgTypes),
 		StartTime:       timestamppb.New(ev.StartTime),
 		Duration:        durationpb.New(ev.Duration),
 		RowsAffected:    ev.RowsAffected,
@@ -121,6 +179,20 @@ func eventToProto(ev proxy.Event) *tapv1.QueryEvent {
 		NPlus_1:         ev.NPlus1,
 		SlowQuery:       ev.SlowQuery,
 		NormalizedQuery: sanitizeUTF8(ev.NormalizedQuery),
+		ReadOnly:        ev.ReadOnly,
+		StmtName:        sanitizeUTF8(ev.StmtName),
+		InFlight:        ev.InFlight,
+		BatchSize:       int32(min(ev.BatchSize, math.MaxInt32)),     //nolint:gosec // clamped to int32
+		ResultColumns:   int32(min(ev.ResultColumns, math.MaxInt32)), //nolint:gosec // clamped to int32
+		Session:         ev.Session,
+		Plan:            sanitizeUTF8(ev.Plan),
+		FullScan:        ev.FullScan,
+		Warnings:        int32(min(ev.Warnings, math.MaxInt32)), //nolint:gosec // clamped to int32
+		CopyBytes:       ev.CopyBytes,
+		Kind:            int32(ev.Kind),
+		TxFailed:        ev.TxFailed,
+		Update:          ev.Update,
+		Verb:            ev.Verb,
 	}
 }
 
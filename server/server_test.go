@@ -1,16 +1,29 @@
 package server_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 
+	"github.com/mickamy/sql-tap/auth"
 	"github.com/mickamy/sql-tap/broker"
+	"github.com/mickamy/sql-tap/dial"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
 	"github.com/mickamy/sql-tap/server"
@@ -18,6 +31,13 @@ import (
 
 func startServer(t *testing.T, b *broker.Broker) tapv1.TapServiceClient {
 	t.Helper()
+	return startServerWithToken(t, b, "", "")
+}
+
+// startServerWithToken starts a server requiring serverToken and returns a
+// client sending clientToken.
+func startServerWithToken(t *testing.T, b *broker.Broker, serverToken, clientToken string) tapv1.TapServiceClient {
+	t.Helper()
 
 	var lc net.ListenConfig
 	lis, err := lc.Listen(t.Context(), "tcp", "localhost:0")
@@ -25,11 +45,13 @@ func startServer(t *testing.T, b *broker.Broker) tapv1.TapServiceClient {
 		t.Fatal(err)
 	}
 
-	srv := server.New(b, nil)
+	srv := server.New(b, nil, auth.ServerOptions(serverToken)...)
 	go func() { _ = srv.Serve(lis) }()
 	t.Cleanup(srv.Stop)
 
-	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())},
+		auth.DialOptions(clientToken)...)
+	conn, err := grpc.NewClient(lis.Addr().String(), opts...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -76,6 +98,49 @@ func TestWatch(t *testing.T) {
 	}
 }
 
+func TestWatch_Dropped(t *testing.T) {
+	t.Parallel()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := broker.New(2)
+	srv := server.New(b, nil)
+	srv.SetProxyDropped(func() uint64 { return 5 })
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// A subscriber that never reads drops events; the stream does not.
+	_, unsub := b.Subscribe()
+	defer unsub()
+	stream, err := tapv1.NewTapServiceClient(conn).Watch(t.Context(), &tapv1.WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	for i := range 4 {
+		b.Publish(proxy.Event{ID: "1", Op: proxy.OpQuery, Query: "SELECT 1"})
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.GetDropped(); got != 5 {
+			t.Fatalf("event %d: Dropped = %d, want the proxy's 5 only", i, got)
+		}
+	}
+	if got := b.Dropped(); got != 2 {
+		t.Errorf("broker Dropped() = %d, want 2 for the idle subscriber", got)
+	}
+}
+
 func TestWatch_MultipleEvents(t *testing.T) {
 	t.Parallel()
 
@@ -131,3 +196,252 @@ func TestExplain_NotConfigured(t *testing.T) {
 		t.Fatalf("expected FailedPrecondition, got %v", st.Code())
 	}
 }
+
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connected atomic.Bool
+	srv := server.New(broker.New(8), nil)
+	srv.SetServerInfo("tidb", func() (proxy.ServerInfo, bool) {
+		return proxy.ServerInfo{Version: "8.0.11-TiDB-v7.5.0"}, connected.Load()
+	})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := tapv1.NewTapServiceClient(conn)
+
+	// Before any client connects through the proxy, only the driver is known.
+	resp, err := client.ServerInfo(t.Context(), &tapv1.ServerInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetDriver() != "tidb" || resp.GetVersion() != "" {
+		t.Errorf("before connecting: got %v, want driver tidb without version", resp)
+	}
+
+	connected.Store(true)
+	resp, err = client.ServerInfo(t.Context(), &tapv1.ServerInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetDriver() != "tidb" || resp.GetVersion() != "8.0.11-TiDB-v7.5.0" {
+		t.Errorf("after connecting: got %v, want driver tidb, version 8.0.11-TiDB-v7.5.0", resp)
+	}
+	if resp.GetNplus1Window() != nil {
+		t.Errorf("N+1 window = %v, want none while detection is off", resp.GetNplus1Window())
+	}
+}
+
+func TestServerInfo_NPlus1Window(t *testing.T) {
+	t.Parallel()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := server.New(broker.New(8), nil)
+	srv.SetNPlus1Window(3 * time.Second)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	resp, err := tapv1.NewTapServiceClient(conn).ServerInfo(t.Context(), &tapv1.ServerInfoRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.GetNplus1Window().AsDuration(); got != 3*time.Second {
+		t.Errorf("N+1 window = %s, want 3s", got)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		serverToken string
+		clientToken string
+		want        codes.Code
+	}{
+		{name: "no token required", serverToken: "", clientToken: "", want: codes.OK},
+		{name: "matching token", serverToken: "secret", clientToken: "secret", want: codes.OK},
+		{name: "missing token", serverToken: "secret", clientToken: "", want: codes.Unauthenticated},
+		{name: "wrong token", serverToken: "secret", clientToken: "guess", want: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := broker.New(8)
+			client := startServerWithToken(t, b, tt.serverToken, tt.clientToken)
+
+			// Unary: without an explain client, an authenticated call fails
+			// with FailedPrecondition instead.
+			_, err := client.Explain(t.Context(), &tapv1.ExplainRequest{Query: "SELECT 1"})
+			wantUnary := tt.want
+			if wantUnary == codes.OK {
+				wantUnary = codes.FailedPrecondition
+			}
+			if got := status.Code(err); got != wantUnary {
+				t.Errorf("Explain code = %v, want %v", got, wantUnary)
+			}
+
+			// Streaming: the interceptor rejects the call before the first
+			// message.
+			stream, err := client.Watch(t.Context(), &tapv1.WatchRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != codes.OK {
+				if _, err := stream.Recv(); status.Code(err) != tt.want {
+					t.Errorf("Watch code = %v, want %v", status.Code(err), tt.want)
+				}
+				return
+			}
+			for b.SubscriberCount() == 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			b.Publish(proxy.Event{ID: "1", Op: proxy.OpQuery, Query: "SELECT 1"})
+			resp, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.GetEvent().GetId() != "1" {
+				t.Errorf("Watch id = %q, want 1", resp.GetEvent().GetId())
+			}
+		})
+	}
+}
+
+func TestWatch_TLS(t *testing.T) {
+	t.Parallel()
+
+	certFile, keyFile := writeSelfSignedCert(t)
+	creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := broker.New(8)
+	srv := server.New(b, nil, grpc.Creds(creds))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	watch := func(t *testing.T, cfg dial.Config) (tapv1.TapService_WatchClient, error) {
+		t.Helper()
+		opts, err := dial.Options(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := grpc.NewClient(lis.Addr().String(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return tapv1.NewTapServiceClient(conn).Watch(t.Context(), &tapv1.WatchRequest{})
+	}
+	// handshakeCode returns the code a Watch with cfg fails with, whether
+	// the call or its first Recv reports the failed handshake.
+	handshakeCode := func(t *testing.T, cfg dial.Config) codes.Code {
+		t.Helper()
+		stream, err := watch(t, cfg)
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		return status.Code(err)
+	}
+
+	t.Run("trusted CA", func(t *testing.T) {
+		stream, err := watch(t, dial.Config{CA: certFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for b.SubscriberCount() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		b.Publish(proxy.Event{ID: "1", Op: proxy.OpQuery, Query: "SELECT 1"})
+		resp, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.GetEvent().GetId() != "1" {
+			t.Errorf("id = %q, want 1", resp.GetEvent().GetId())
+		}
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		if got := handshakeCode(t, dial.Config{TLS: true}); got != codes.Unavailable {
+			t.Errorf("code = %v, want Unavailable", got)
+		}
+	})
+
+	t.Run("plaintext client", func(t *testing.T) {
+		if got := handshakeCode(t, dial.Config{}); got != codes.Unavailable {
+			t.Errorf("code = %v, want Unavailable", got)
+		}
+	})
+}
+
+// writeSelfSignedCert writes a self-signed certificate for localhost and its
+// key to PEM files and returns their paths.
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "server.crt")
+	keyFile = filepath.Join(dir, "server.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
@@ -0,0 +1,201 @@
+// Package tail streams query events from sql-tapd as a compact,
+// one-line-per-event log suitable for a terminal pane or a pipe.
+package tail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mickamy/sql-tap/dial"
+	"github.com/mickamy/sql-tap/eventfmt"
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+// Options configures the tail output.
+type Options struct {
+	// Width is the terminal width used to truncate queries. Zero disables truncation.
+	Width int
+	// NoColor disables ANSI colors regardless of the output's capabilities.
+	NoColor bool
+	// DialOptions configure the connection to sql-tapd. Empty means
+	// dial.Default.
+	DialOptions []grpc.DialOption
+}
+
+// Column widths.
+const (
+	colTime     = 12 // 15:04:05.000
+	colVerb     = 8
+	colDuration = 9
+	minQuery    = 20
+)
+
+// Printer formats events as aligned single lines.
+type Printer struct {
+	w      io.Writer
+	width  int
+	plain  bool
+	render *lipgloss.Renderer
+}
+
+// NewPrinter returns a Printer writing to w. Colors are used only when w is a
+// terminal that supports them and opts.NoColor is false.
+func NewPrinter(w io.Writer, opts Options) *Printer {
+	return &Printer{
+		w:      w,
+		width:  opts.Width,
+		plain:  opts.NoColor,
+		render: lipgloss.NewRenderer(w),
+	}
+}
+
+// Print writes the formatted line for ev.
+func (p *Printer) Print(ev *tapv1.QueryEvent) error {
+	if _, err := fmt.Fprintln(p.w, p.Format(ev)); err != nil {
+		return fmt.Errorf("tail: write: %w", err)
+	}
+	return nil
+}
+
+// Format returns the single-line representation of ev:
+//
+//	15:04:05.123 SELECT      1.2ms  SELECT id FROM users WHERE id = $1  N+1
+//
+// When a width is set, the query (and error message, if any) is truncated so
+// that the line fits.
+func (p *Printer) Format(ev *tapv1.QueryEvent) string {
+	verb := eventfmt.Verb(ev)
+	d := ev.GetDuration().AsDuration()
+	dur := "-"
+	if ev.GetDuration() != nil {
+		dur = eventfmt.Duration(d)
+	}
+
+	var badges []string
+	badgeWidth := 0
+	for _, b := range eventfmt.Badges(ev) {
+		badges = append(badges, p.style(p.render.NewStyle().Foreground(b.Color).Bold(true), b.Label))
+		badgeWidth += len(b.Label) + 1
+	}
+	if badgeWidth > 0 {
+		badgeWidth++ // two-space separator instead of one
+	}
+
+	q := ev.GetQuery()
+	if q == "" {
+		q = "-"
+	}
+	errMsg := ev.GetError()
+	if p.width > 0 {
+		room := max(p.width-colTime-colVerb-colDuration-4-badgeWidth, minQuery)
+		if errMsg != "" {
+			errRoom := min(len(errMsg), room/3)
+			errMsg = eventfmt.Truncate(errMsg, errRoom)
+			room = max(room-len([]rune(errMsg))-2, minQuery)
+		}
+		q = eventfmt.Truncate(q, room)
+	} else {
+		q = eventfmt.Truncate(q, len(q))
+		errMsg = eventfmt.Truncate(errMsg, len(errMsg))
+	}
+
+	var b strings.Builder
+	b.WriteString(p.style(p.render.NewStyle().Faint(true), padRight(formatTime(ev), colTime)))
+	b.WriteString(" ")
+	b.WriteString(p.style(p.render.NewStyle().Foreground(eventfmt.VerbColor(verb)).Bold(true), padRight(verb, colVerb)))
+	b.WriteString(" ")
+	b.WriteString(p.style(p.render.NewStyle().Foreground(eventfmt.HeatColor(d)), padLeft(dur, colDuration)))
+	b.WriteString("  ")
+	b.WriteString(q)
+	if len(badges) > 0 {
+		b.WriteString("  ")
+		b.WriteString(strings.Join(badges, " "))
+	}
+	if errMsg != "" {
+		b.WriteString("  ")
+		b.WriteString(p.style(p.render.NewStyle().Foreground(eventfmt.BadgeError.Color), errMsg))
+	}
+	return b.String()
+}
+
+// style renders s with st, or returns s unchanged when colors are disabled.
+func (p *Printer) style(st lipgloss.Style, s string) string {
+	if p.plain {
+		return s
+	}
+	return st.Render(s)
+}
+
+func formatTime(ev *tapv1.QueryEvent) string {
+	t := ev.GetStartTime()
+	if t == nil {
+		return "-"
+	}
+	return t.AsTime().Local().Format("15:04:05.000") //nolint:gosmopolitan // log displays local time
+}
+
+func padRight(s string, width int) string {
+	if len([]rune(s)) >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-len([]rune(s)))
+}
+
+func padLeft(s string, width int) string {
+	if len([]rune(s)) >= width {
+		return s
+	}
+	return strings.Repeat(" ", width-len([]rune(s))) + s
+}
+
+// Run connects to the gRPC server at addr and prints every event to w until
+// ctx is cancelled or the server closes the stream.
+func Run(ctx context.Context, addr string, w io.Writer, opts Options) error {
+	conn, err := dial.Client(addr, opts.DialOptions...)
+	if err != nil {
+		return fmt.Errorf("tail: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	client := tapv1.NewTapServiceClient(conn)
+	stream, err := client.Watch(ctx, &tapv1.WatchRequest{})
+	if err != nil {
+		return fmt.Errorf("watch %s: %w", addr, err)
+	}
+
+	p := NewPrinter(w, opts)
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			if isStreamDone(ctx, err) {
+				return nil
+			}
+			return fmt.Errorf("recv: %w", err)
+		}
+		if resp.GetEvent().GetInFlight() || resp.GetEvent().GetUpdate() {
+			continue // the completed event follows, or was printed already
+		}
+		if err := p.Print(resp.GetEvent()); err != nil {
+			return err
+		}
+	}
+}
+
+func isStreamDone(ctx context.Context, err error) bool {
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	if ctx.Err() != nil {
+		return true
+	}
+	code := status.Code(err)
+	return code == codes.Canceled || code == codes.DeadlineExceeded
+}
@@ -0,0 +1,119 @@
+package tail_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/tail"
+)
+
+func TestPrinter_Format(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 2, 20, 15, 4, 5, 123000000, time.Local)
+
+	tests := []struct {
+		name   string
+		ev     *tapv1.QueryEvent
+		width  int
+		want   string
+		maxLen int
+	}{
+		{
+			name: "select",
+			ev: &tapv1.QueryEvent{
+				Op:        int32(proxy.OpQuery),
+				Query:     "SELECT id\n  FROM users WHERE id = $1",
+				StartTime: timestamppb.New(start),
+				Duration:  durationpb.New(1200 * time.Microsecond),
+			},
+			want: "15:04:05.123 SELECT       1.2ms  SELECT id FROM users WHERE id = $1",
+		},
+		{
+			name: "badges",
+			ev: &tapv1.QueryEvent{
+				Op:        int32(proxy.OpExecute),
+				Query:     "SELECT * FROM posts WHERE user_id = $1",
+				StartTime: timestamppb.New(start),
+				Duration:  durationpb.New(250 * time.Millisecond),
+				NPlus_1:   true,
+				SlowQuery: true,
+			},
+			want: "15:04:05.123 SELECT     250.0ms  SELECT * FROM posts WHERE user_id = $1  N+1 SLOW",
+		},
+		{
+			name: "error",
+			ev: &tapv1.QueryEvent{
+				Op:        int32(proxy.OpQuery),
+				Query:     "SELEC 1",
+				StartTime: timestamppb.New(start),
+				Duration:  durationpb.New(300 * time.Microsecond),
+				Error:     "syntax error at or near \"SELEC\"",
+			},
+			want: "15:04:05.123 Query        300µs  SELEC 1  E  syntax error at or near \"SELEC\"",
+		},
+		{
+			name: "begin without duration",
+			ev: &tapv1.QueryEvent{
+				Op:        int32(proxy.OpBegin),
+				Query:     "BEGIN",
+				StartTime: timestamppb.New(start),
+			},
+			want: "15:04:05.123 Begin            -  BEGIN",
+		},
+		{
+			name: "truncated to width",
+			ev: &tapv1.QueryEvent{
+				Op:        int32(proxy.OpQuery),
+				Query:     "SELECT " + strings.Repeat("column_name, ", 20) + "id FROM users",
+				StartTime: timestamppb.New(start),
+				Duration:  durationpb.New(time.Millisecond),
+			},
+			width:  80,
+			maxLen: 80,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := tail.NewPrinter(&bytes.Buffer{}, tail.Options{Width: tt.width, NoColor: true})
+			got := p.Format(tt.ev)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("Format() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if tt.maxLen > 0 {
+				if n := len([]rune(got)); n > tt.maxLen {
+					t.Errorf("Format() length = %d, want <= %d: %q", n, tt.maxLen, got)
+				}
+				if !strings.HasSuffix(got, "…") {
+					t.Errorf("Format() = %q, want truncated query", got)
+				}
+			}
+		})
+	}
+}
+
+func TestPrinter_NoColor(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	p := tail.NewPrinter(&buf, tail.Options{NoColor: true})
+	if err := p.Print(&tapv1.QueryEvent{Op: int32(proxy.OpQuery), Query: "SELECT 1", SlowQuery: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("output contains ANSI escapes: %q", buf.String())
+	}
+	if !strings.HasSuffix(buf.String(), "\n") {
+		t.Errorf("output not newline-terminated: %q", buf.String())
+	}
+}
@@ -0,0 +1,53 @@
+package tap_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/mickamy/sql-tap/detect"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/tap"
+)
+
+// Example taps the queries a test runs against PostgreSQL. It needs a server
+// on 127.0.0.1:5432 with an app database and user, so it has no Output
+// section: go test compiles it but does not run it.
+func Example() {
+	ctx := context.Background()
+
+	tp, err := tap.New("postgres", "127.0.0.1:0", "127.0.0.1:5432")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tp.DetectNPlus1(detect.New(5, time.Second, 10*time.Second))
+	tp.OnNPlus1Alert(func(a detect.Alert) { log.Printf("N+1: %s ran %d times", a.Query, a.Count) })
+	tp.DetectSlow(100 * time.Millisecond)
+	if err := tp.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = tp.Close() }()
+
+	db, err := sql.Open("pgx", "postgres://app:secret@"+tp.Addr()+"/app?sslmode=disable")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT name FROM users WHERE id = $1", 1).Scan(&name); err != nil {
+		log.Fatal(err)
+	}
+
+	// The driver prepares and binds the statement before executing it.
+	for ev := range tp.Events() {
+		if ev.Op == proxy.OpExecute && !ev.InFlight {
+			fmt.Println(ev.NormalizedQuery, ev.Args, ev.Duration, ev.SlowQuery)
+			break
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package tap embeds the sql-tap proxy in a Go program, e.g. a test harness,
+// without the daemon, the TUI or gRPC. A Tap relays a database driver's
+// connections to the database and delivers the statements it captures on a
+// channel, normalized and flagged by the detectors registered on it:
+//
+//	t, err := tap.New("postgres", "127.0.0.1:0", "127.0.0.1:5432")
+//	...
+//	t.DetectSlow(100 * time.Millisecond)
+//	if err := t.Start(ctx); err != nil { ... }
+//	defer t.Close()
+//	db, err := sql.Open("pgx", "postgres://app@"+t.Addr()+"/app")
+//	...
+//	for ev := range t.Events() { ... }
+package tap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mickamy/sql-tap/detect"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/proxy/mysql"
+	"github.com/mickamy/sql-tap/proxy/postgres"
+	"github.com/mickamy/sql-tap/query"
+)
+
+// Tap is a proxy between a database client and server whose captured events
+// are enriched as sql-tapd enriches them: with their normalized query, batch
+// size and kind, and the N+1 and slow query flags of the detectors set on it.
+type Tap struct {
+	listen  string
+	proxy   proxy.Proxy
+	events  chan proxy.Event
+	dropped atomic.Uint64 // events dropped because events was full
+
+	// Set before Start.
+	nplus1    *detect.Detector
+	onAlert   func(detect.Alert)
+	slow      time.Duration
+	detectors []func(*proxy.Event)
+
+	mu       sync.Mutex
+	addr     string
+	served   chan struct{} // closed when the proxy stops serving; nil until Start
+	serveErr error
+}
+
+// New creates a Tap listening on listen for clients of driver (postgres,
+// mysql or tidb) and relaying them to upstream, a host:port address or a
+// comma-separated list of them picked round-robin per connection. listen may
+// use port 0 to let the system pick one; see Addr.
+func New(driver, listen, upstream string) (*Tap, error) {
+	upstreams, err := proxy.ParseUpstreams(upstream, proxy.RoundRobin)
+	if err != nil {
+		return nil, fmt.Errorf("tap: upstream: %w", err)
+	}
+	var p proxy.Proxy
+	switch driver {
+	case "postgres":
+		p = postgres.NewWithUpstreams(listen, upstreams, proxy.DefaultBufferSize, proxy.DropNewest)
+	case "mysql", "tidb":
+		p = mysql.NewWithUpstreams(listen, upstreams, proxy.DefaultBufferSize, proxy.DropNewest)
+	default:
+		return nil, fmt.Errorf("tap: unsupported driver: %s", driver)
+	}
+	t := &Tap{
+		listen: listen,
+		proxy:  p,
+		events: make(chan proxy.Event, proxy.DefaultBufferSize),
+	}
+	go t.run()
+	return t, nil
+}
+
+// DetectNPlus1 flags SELECTs that det reports as part of an N+1 pattern. It
+// must be called before Start.
+func (t *Tap) DetectNPlus1(det *detect.Detector) {
+	t.nplus1 = det
+}
+
+// OnNPlus1Alert calls f when the detector set with DetectNPlus1 reports an
+// N+1 pattern, at most once per template and cooldown, from the goroutine
+// delivering events. It must be called before Start.
+func (t *Tap) OnNPlus1Alert(f func(detect.Alert)) {
+	t.onAlert = f
+}
+
+// DetectSlow flags statements that run for threshold or longer. It must be
+// called before Start.
+func (t *Tap) DetectSlow(threshold time.Duration) {
+	t.slow = threshold
+}
+
+// Detect registers f to inspect and annotate each completed event after the
+// built-in detectors, in the order of registration. Provisional in-flight
+// events are not passed to f. It must be called before Start.
+func (t *Tap) Detect(f func(ev *proxy.Event)) {
+	t.detectors = append(t.detectors, f)
+}
+
+// Start listens for clients and serves them in the background until ctx is
+// done, Shutdown or Close is called. It returns once Addr accepts
+// connections.
+func (t *Tap) Start(ctx context.Context) error {
+	var lc net.ListenConfig
+	lis, err := lc.Listen(ctx, "tcp", t.listen)
+	if err != nil {
+		return fmt.Errorf("tap: listen: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.served != nil {
+		_ = lis.Close()
+		return errors.New("tap: already started")
+	}
+	t.addr = lis.Addr().String()
+	served := make(chan struct{})
+	t.served = served
+	go func() {
+		err := t.proxy.Serve(ctx, lis)
+		t.mu.Lock()
+		t.serveErr = err
+		t.mu.Unlock()
+		close(served)
+	}()
+	return nil
+}
+
+// Addr returns the address clients connect to, with the port the system
+// picked for port 0, or "" before Start.
+func (t *Tap) Addr() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addr
+}
+
+// Events returns the channel of captured events. It is closed once Shutdown
+// or Close has ended all connections, whether or not it is read. The newest
+// events are dropped while the channel and the proxy's buffer are full.
+func (t *Tap) Events() <-chan proxy.Event {
+	return t.events
+}
+
+// Dropped returns the number of events dropped because the channel of
+// Events and the proxy's buffer were full.
+func (t *Tap) Dropped() uint64 {
+	return t.dropped.Load() + t.proxy.Dropped()
+}
+
+// ServerInfo returns the server info of the latest connection to complete
+// its handshake, or false if none has yet.
+func (t *Tap) ServerInfo() (proxy.ServerInfo, bool) {
+	return t.proxy.ServerInfo()
+}
+
+// Shutdown stops accepting connections and closes each open one once it has
+// no statement in flight and no open transaction, or all of them when ctx is
+// done. It returns the error that stopped serving, if any.
+func (t *Tap) Shutdown(ctx context.Context) error {
+	return errors.Join(t.proxy.Shutdown(ctx), t.wait())
+}
+
+// Close stops the Tap, closing open connections right away. It returns the
+// error that stopped serving, if any.
+func (t *Tap) Close() error {
+	return errors.Join(t.proxy.Close(), t.wait())
+}
+
+// wait blocks until the proxy stops serving and returns why it stopped.
+func (t *Tap) wait() error {
+	t.mu.Lock()
+	served := t.served
+	t.mu.Unlock()
+	if served == nil {
+		return nil
+	}
+	<-served
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.serveErr
+}
+
+// run enriches the proxy's events until its channel is closed. It never
+// blocks on a full events channel, so that it always gets to close it.
+func (t *Tap) run() {
+	defer close(t.events)
+	for ev := range t.proxy.Events() {
+		t.handle(&ev)
+		proxy.Emit(t.events, ev, proxy.DropNewest, &t.dropped)
+	}
+}
+
+func (t *Tap) handle(ev *proxy.Event) {
+	if ev.Query != "" {
+		ev.NormalizedQuery = query.Normalize(ev.Query)
+		ev.BatchSize = query.BatchSize(ev.Query)
+		ev.Kind = query.Classify(ev.Query)
+		ev.Verb = query.Verb(ev.Query)
+	}
+	if ev.InFlight {
+		return
+	}
+	if t.nplus1 != nil && detect.IsSelectQuery(ev.Op, ev.Query) {
+		r := t.nplus1.Record(ev.Query, ev.StartTime)
+		ev.NPlus1 = r.Matched
+		if r.Alert != nil && t.onAlert != nil {
+			t.onAlert(*r.Alert)
+		}
+	}
+	if t.slow > 0 && ev.Duration >= t.slow {
+		ev.SlowQuery = true
+	}
+	for _, f := range t.detectors {
+		f(ev)
+	}
+}
@@ -0,0 +1,216 @@
+package tap_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/detect"
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
+	"github.com/mickamy/sql-tap/tap"
+)
+
+var okPayload = []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+
+func writePacket(w io.Writer, seq byte, payload []byte) error {
+	hdr := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), seq}
+	_, err := w.Write(append(hdr, payload...))
+	return err
+}
+
+func readPacket(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, int(hdr[0])|int(hdr[1])<<8|int(hdr[2])<<16)
+	_, err := io.ReadFull(r, payload)
+	return payload, err
+}
+
+// startMySQL starts a minimal MySQL server that accepts any login and answers
+// every query with OK, after a delay for queries containing SLEEP. It returns
+// the server's address.
+func startMySQL(t *testing.T) string {
+	t.Helper()
+
+	var lc net.ListenConfig
+	lis, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = lis.Close() })
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_ = writePacket(conn, 0, []byte{0x0a, '8', 0x00})
+		_, _ = readPacket(conn)
+		_ = writePacket(conn, 2, okPayload)
+		for {
+			p, err := readPacket(conn)
+			if err != nil || len(p) == 0 || p[0] != 0x03 {
+				return
+			}
+			if bytes.Contains(p, []byte("SLEEP")) {
+				time.Sleep(30 * time.Millisecond)
+			}
+			_ = writePacket(conn, 1, okPayload)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func TestTap(t *testing.T) {
+	t.Parallel()
+
+	tp, err := tap.New("mysql", "127.0.0.1:0", startMySQL(t))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	tp.DetectNPlus1(detect.New(2, time.Minute, time.Minute))
+	var alerts []detect.Alert
+	tp.OnNPlus1Alert(func(a detect.Alert) { alerts = append(alerts, a) })
+	tp.DetectSlow(20 * time.Millisecond)
+	// A custom detector: reads without a WHERE clause scan whole tables.
+	tp.Detect(func(ev *proxy.Event) {
+		ev.FullScan = ev.Kind == query.KindRead && !strings.Contains(ev.NormalizedQuery, "WHERE")
+	})
+	if err := tp.Start(t.Context()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if strings.HasSuffix(tp.Addr(), ":0") {
+		t.Fatalf("Addr = %q, want the port the system picked", tp.Addr())
+	}
+
+	var d net.Dialer
+	client, err := d.DialContext(t.Context(), "tcp", tp.Addr())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	roundTrip := func(seq byte, req []byte) {
+		t.Helper()
+		if err := writePacket(client, seq, req); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := readPacket(client); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+	if _, err := readPacket(client); err != nil {
+		t.Fatalf("read greeting: %v", err)
+	}
+	roundTrip(1, []byte{0x00, 0x00, 0x00, 0x00})
+
+	send := func(q string) proxy.Event {
+		t.Helper()
+		roundTrip(0, append([]byte{0x03}, q...))
+		select {
+		case ev := <-tp.Events():
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no event", q)
+			return proxy.Event{}
+		}
+	}
+
+	ev := send("SELECT * FROM users WHERE id = 1")
+	if ev.NormalizedQuery != "SELECT * FROM users WHERE id = ?" || ev.NPlus1 || ev.SlowQuery || ev.FullScan {
+		t.Errorf("first select = %+v, want normalized and unflagged", ev)
+	}
+	if ev := send("SELECT * FROM users WHERE id = 1"); !ev.NPlus1 {
+		t.Errorf("repeated select: NPlus1 = false, want true")
+	}
+	if len(alerts) != 1 || alerts[0].Count != 2 {
+		t.Errorf("alerts = %+v, want one for 2 executions", alerts)
+	}
+	if ev := send("SELECT SLEEP(1) FROM users"); !ev.SlowQuery || !ev.FullScan || ev.NPlus1 {
+		t.Errorf("slow scan: slow = %v, full scan = %v, N+1 = %v, want true, true, false",
+			ev.SlowQuery, ev.FullScan, ev.NPlus1)
+	}
+
+	if err := tp.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	for range tp.Events() {
+		// Drained once the proxy has closed.
+	}
+}
+
+func TestTap_Unread(t *testing.T) {
+	t.Parallel()
+
+	tp, err := tap.New("mysql", "127.0.0.1:0", startMySQL(t))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := tp.Start(t.Context()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	var d net.Dialer
+	client, err := d.DialContext(t.Context(), "tcp", tp.Addr())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	_ = client.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := readPacket(client); err != nil {
+		t.Fatalf("read greeting: %v", err)
+	}
+	if err := writePacket(client, 1, []byte{0x00, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatalf("write login: %v", err)
+	}
+	if _, err := readPacket(client); err != nil {
+		t.Fatalf("read login reply: %v", err)
+	}
+
+	// More events than Events and the proxy buffer hold, none of them read.
+	for range 3 * proxy.DefaultBufferSize {
+		if err := writePacket(client, 0, []byte("\x03SELECT 1")); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := readPacket(client); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+	if err := tp.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	// Without a reader, everything beyond the channel's buffer is dropped
+	// rather than held up.
+	want := uint64(2 * proxy.DefaultBufferSize)
+	for deadline := time.Now().Add(5 * time.Second); tp.Dropped() != want; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Dropped = %d, want %d", tp.Dropped(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	n := 0
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-tp.Events():
+			if !ok {
+				if n+int(tp.Dropped()) != 3*proxy.DefaultBufferSize {
+					t.Errorf("received %d and dropped %d events, want %d in all", n, tp.Dropped(), 3*proxy.DefaultBufferSize)
+				}
+				return
+			}
+			n++
+		case <-timeout:
+			t.Fatal("Events not closed after Close")
+		}
+	}
+}
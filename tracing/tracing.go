@@ -0,0 +1,218 @@
+// Package tracing exports captured queries as OpenTelemetry spans.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
+)
+
+// Options configures an Exporter.
+type Options struct {
+	// System is the db.system attribute, e.g. "postgresql" or "mysql".
+	System string
+	// BoundArgs sets db.statement to the query with its arguments inlined.
+	// By default it is the normalized query, which carries no literal values.
+	BoundArgs bool
+}
+
+// txIdleTimeout is how long a transaction may go without a query before its
+// span is ended, e.g. because its connection closed without COMMIT or
+// ROLLBACK.
+const txIdleTimeout = 10 * time.Minute
+
+// Exporter creates a span per captured query. Queries of a transaction are
+// children of a span covering the whole transaction, from BEGIN to COMMIT or
+// ROLLBACK. A transaction cut off by its connection closing, or idle for
+// txIdleTimeout, ends at its latest query and is marked abandoned.
+type Exporter struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	opts     Options
+
+	mu      sync.Mutex
+	txs     map[string]*txSpan // open transaction spans by TxID
+	expired time.Time          // when idle transactions were last ended
+}
+
+// txSpan is the span of a transaction that has not ended yet.
+type txSpan struct {
+	span trace.Span
+	last time.Time // end of the transaction's latest query
+}
+
+// Dial creates an Exporter that sends spans over OTLP/gRPC to endpoint. A
+// host:port endpoint is reached in plaintext; use an https:// URL for TLS.
+func Dial(ctx context.Context, endpoint string, opts Options) (*Exporter, error) {
+	var clientOpts []otlptracegrpc.Option
+	if strings.Contains(endpoint, "://") {
+		clientOpts = append(clientOpts, otlptracegrpc.WithEndpointURL(endpoint))
+	} else {
+		clientOpts = append(clientOpts, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	}
+	exp, err := otlptracegrpc.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: create OTLP exporter: %w", err)
+	}
+	return New(exp, opts), nil
+}
+
+// New creates an Exporter that batches spans to exp.
+func New(exp sdktrace.SpanExporter, opts Options) *Exporter {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "sql-tapd"))),
+	)
+	return &Exporter{
+		provider: provider,
+		tracer:   provider.Tracer("github.com/mickamy/sql-tap"),
+		opts:     opts,
+		txs:      make(map[string]*txSpan),
+	}
+}
+
+// Record creates the span of a completed event. In-flight events are ignored.
+func (e *Exporter) Record(ev proxy.Event) {
+	if ev.InFlight {
+		return
+	}
+	start := ev.StartTime
+	end := start.Add(ev.Duration)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx := context.Background()
+	var tx *txSpan
+	if ev.TxID != "" {
+		tx = e.txs[ev.TxID]
+		if tx == nil {
+			// The transaction began before sql-tapd saw it, or implicitly.
+			_, span := e.tracer.Start(ctx, "transaction",
+				trace.WithTimestamp(start),
+				trace.WithAttributes(
+					attribute.String("db.system", e.opts.System),
+					attribute.String("sql_tap.tx_id", ev.TxID),
+				))
+			tx = &txSpan{span: span}
+			e.txs[ev.TxID] = tx
+		}
+		ctx = trace.ContextWithSpan(ctx, tx.span)
+		tx.last = end
+	}
+
+	_, span := e.tracer.Start(ctx, spanName(ev),
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(e.attributes(ev)...))
+	if ev.Error != "" {
+		span.SetStatus(codes.Error, ev.Error)
+	}
+	span.End(trace.WithTimestamp(end))
+
+	switch {
+	case tx != nil && (ev.Op == proxy.OpCommit || ev.Op == proxy.OpRollback):
+		if ev.Op == proxy.OpRollback {
+			tx.span.SetAttributes(attribute.Bool("sql_tap.rolled_back", true))
+		}
+		tx.span.End(trace.WithTimestamp(end))
+		delete(e.txs, ev.TxID)
+	case tx != nil && ev.Error == proxy.ErrConnClosed.Error():
+		e.abandon(ev.TxID, tx)
+	}
+	e.expire(end)
+}
+
+// expire ends the spans of transactions idle for txIdleTimeout at now, the
+// end of the latest event, at most once per txIdleTimeout. e.mu must be held.
+func (e *Exporter) expire(now time.Time) {
+	if now.Sub(e.expired) < txIdleTimeout {
+		return
+	}
+	e.expired = now
+	for id, tx := range e.txs {
+		if now.Sub(tx.last) >= txIdleTimeout {
+			e.abandon(id, tx)
+		}
+	}
+}
+
+// abandon ends the span of a transaction that will not be committed or
+// rolled back, at its latest query. e.mu must be held.
+func (e *Exporter) abandon(id string, tx *txSpan) {
+	tx.span.SetAttributes(attribute.Bool("sql_tap.abandoned", true))
+	tx.span.End(trace.WithTimestamp(tx.last))
+	delete(e.txs, id)
+}
+
+// spanName names a span by the normalized query, which groups executions of
+// the same statement, falling back to the operation.
+func spanName(ev proxy.Event) string {
+	if ev.NormalizedQuery != "" {
+		return ev.NormalizedQuery
+	}
+	if ev.Query != "" {
+		return query.Normalize(ev.Query)
+	}
+	return ev.Op.String()
+}
+
+func (e *Exporter) attributes(ev proxy.Event) []attribute.KeyValue {
+	stmt := ev.NormalizedQuery
+	if stmt == "" {
+		stmt = query.Normalize(ev.Query)
+	}
+	if e.opts.BoundArgs {
+		stmt = query.Bind(ev.Query, ev.Args)
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", e.opts.System),
+		attribute.String("db.statement", stmt),
+		attribute.String("db.operation", ev.Op.String()),
+		attribute.Float64("sql_tap.duration_ms", float64(ev.Duration.Microseconds())/1000),
+		attribute.Int64("sql_tap.rows_affected", ev.RowsAffected),
+	}
+	if ev.TxID != "" {
+		attrs = append(attrs, attribute.String("sql_tap.tx_id", ev.TxID))
+	}
+	if ev.Error != "" {
+		attrs = append(attrs, attribute.String("sql_tap.error", ev.Error))
+	}
+	return attrs
+}
+
+// Shutdown ends the spans of transactions still open, at their latest
+// query, and flushes all spans to the exporter.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	for id, tx := range e.txs {
+		tx.span.End(trace.WithTimestamp(tx.last))
+		delete(e.txs, id)
+	}
+	e.mu.Unlock()
+
+	if err := e.provider.Shutdown(ctx); err != nil {
+		return fmt.Errorf("tracing: shutdown: %w", err)
+	}
+	return nil
+}
+
+// System returns the db.system attribute value for a sql-tapd driver.
+func System(driver string) string {
+	if driver == "postgres" {
+		return "postgresql"
+	}
+	return driver
+}
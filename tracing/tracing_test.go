@@ -0,0 +1,196 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/tracing"
+)
+
+// memExporter keeps its spans on Shutdown, unlike tracetest.InMemoryExporter,
+// so they can be inspected after Exporter.Shutdown flushed them.
+type memExporter struct {
+	*tracetest.InMemoryExporter
+}
+
+func (memExporter) Shutdown(context.Context) error { return nil }
+
+func attr(s tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestExporter(t *testing.T) {
+	t.Parallel()
+
+	mem := tracetest.NewInMemoryExporter()
+	e := tracing.New(memExporter{mem}, tracing.Options{System: "postgresql"})
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []proxy.Event{
+		{ID: "1", Op: proxy.OpBegin, Query: "BEGIN", StartTime: start, Duration: time.Millisecond, TxID: "tx-1"},
+		{
+			ID: "2", Op: proxy.OpExecute, Query: "UPDATE users SET name = $1 WHERE id = $2", Args: []string{"alice", "1"},
+			NormalizedQuery: "UPDATE users SET name = $1 WHERE id = $2",
+			StartTime:       start.Add(2 * time.Millisecond), Duration: 3 * time.Millisecond, RowsAffected: 1, TxID: "tx-1",
+		},
+		{ID: "3", Op: proxy.OpCommit, Query: "COMMIT", StartTime: start.Add(6 * time.Millisecond), Duration: time.Millisecond, TxID: "tx-1"},
+		{ID: "4", Op: proxy.OpQuery, Query: "SELECT 1", InFlight: true, StartTime: start},
+		{
+			ID: "5", Op: proxy.OpQuery, Query: "SELECT * FROM missing", NormalizedQuery: "SELECT * FROM missing",
+			StartTime: start.Add(10 * time.Millisecond), Duration: time.Millisecond, Error: "relation does not exist",
+		},
+	}
+	for _, ev := range events {
+		e.Record(ev)
+	}
+	if err := e.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, s := range mem.GetSpans() {
+		byName[s.Name] = s
+	}
+	if len(byName) != 5 {
+		t.Fatalf("got %d spans, want 5 (tx, BEGIN, UPDATE, COMMIT, failed SELECT)", len(byName))
+	}
+
+	tx := byName["transaction"]
+	if !tx.StartTime.Equal(start) || !tx.EndTime.Equal(start.Add(7*time.Millisecond)) {
+		t.Errorf("transaction span = %s..%s, want BEGIN start to COMMIT end", tx.StartTime, tx.EndTime)
+	}
+	update := byName["UPDATE users SET name = $1 WHERE id = $2"]
+	if update.Parent.SpanID() != tx.SpanContext.SpanID() {
+		t.Error("UPDATE span is not a child of the transaction span")
+	}
+	if !update.StartTime.Equal(start.Add(2*time.Millisecond)) || update.EndTime.Sub(update.StartTime) != 3*time.Millisecond {
+		t.Errorf("UPDATE span = %s..%s, want the event's start and duration", update.StartTime, update.EndTime)
+	}
+	for key, want := range map[string]string{
+		"db.system":     "postgresql",
+		"db.statement":  "UPDATE users SET name = $1 WHERE id = $2",
+		"sql_tap.tx_id": "tx-1",
+	} {
+		if got := attr(update, key).AsString(); got != want {
+			t.Errorf("UPDATE %s = %q, want %q", key, got, want)
+		}
+	}
+	if got := attr(update, "sql_tap.rows_affected").AsInt64(); got != 1 {
+		t.Errorf("UPDATE rows = %d, want 1", got)
+	}
+
+	failed := byName["SELECT * FROM missing"]
+	if failed.Parent.IsValid() {
+		t.Error("query outside a transaction has a parent span")
+	}
+	if failed.Status.Code != codes.Error || failed.Status.Description != "relation does not exist" {
+		t.Errorf("failed span status = %+v, want the error", failed.Status)
+	}
+}
+
+func TestExporterBoundArgs(t *testing.T) {
+	t.Parallel()
+
+	mem := tracetest.NewInMemoryExporter()
+	e := tracing.New(memExporter{mem}, tracing.Options{System: "mysql", BoundArgs: true})
+	e.Record(proxy.Event{
+		Op: proxy.OpExecute, Query: "SELECT * FROM users WHERE id = ?", Args: []string{"42"},
+		NormalizedQuery: "SELECT * FROM users WHERE id = ?", StartTime: time.Now(), Duration: time.Millisecond,
+	})
+	if err := e.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := mem.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	if got := attr(spans[0], "db.statement").AsString(); got != "SELECT * FROM users WHERE id = 42" {
+		t.Errorf("db.statement = %q, want the bound query", got)
+	}
+}
+
+func TestExporterOpenTransaction(t *testing.T) {
+	t.Parallel()
+
+	mem := tracetest.NewInMemoryExporter()
+	e := tracing.New(memExporter{mem}, tracing.Options{System: "mysql"})
+	start := time.Now()
+	e.Record(proxy.Event{Op: proxy.OpExec, Query: "INSERT INTO t VALUES (1)", StartTime: start, Duration: time.Millisecond, TxID: "tx"})
+	if err := e.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A transaction first seen mid-way and never ended is still exported,
+	// ending at its last query.
+	for _, s := range mem.GetSpans() {
+		if s.Name == "transaction" {
+			if !s.EndTime.Equal(start.Add(time.Millisecond)) {
+				t.Errorf("transaction ends at %s, want %s", s.EndTime, start.Add(time.Millisecond))
+			}
+			return
+		}
+	}
+	t.Error("no transaction span exported")
+}
+
+func TestExporterAbandonedTransactions(t *testing.T) {
+	t.Parallel()
+
+	mem := tracetest.NewInMemoryExporter()
+	e := tracing.New(memExporter{mem}, tracing.Options{System: "postgresql"})
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, ev := range []proxy.Event{
+		{Op: proxy.OpBegin, Query: "BEGIN", StartTime: start, Duration: time.Millisecond, TxID: "idle"},
+		{Op: proxy.OpBegin, Query: "BEGIN", StartTime: start, Duration: time.Millisecond, TxID: "closed"},
+		{
+			Op: proxy.OpQuery, Query: "SELECT pg_sleep(60)", StartTime: start.Add(time.Second), Duration: time.Second,
+			TxID: "closed", Error: proxy.ErrConnClosed.Error(),
+		},
+		// Ends the transaction left idle, and stays open itself.
+		{Op: proxy.OpBegin, Query: "BEGIN", StartTime: start.Add(time.Hour), Duration: time.Millisecond, TxID: "open"},
+	} {
+		e.Record(ev)
+	}
+	if err := e.Shutdown(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		end       time.Time
+		abandoned bool
+	}{
+		"idle":   {start.Add(time.Millisecond), true},
+		"closed": {start.Add(2 * time.Second), true},
+		"open":   {start.Add(time.Hour + time.Millisecond), false},
+	}
+	seen := 0
+	for _, s := range mem.GetSpans() {
+		if s.Name != "transaction" {
+			continue
+		}
+		seen++
+		id := attr(s, "sql_tap.tx_id").AsString()
+		want := tests[id]
+		if !s.EndTime.Equal(want.end) {
+			t.Errorf("transaction %s ends at %s, want %s", id, s.EndTime, want.end)
+		}
+		if got := attr(s, "sql_tap.abandoned").AsBool(); got != want.abandoned {
+			t.Errorf("transaction %s: sql_tap.abandoned = %v, want %v", id, got, want.abandoned)
+		}
+	}
+	if seen != len(tests) {
+		t.Errorf("got %d transaction spans, want %d", seen, len(tests))
+	}
+}
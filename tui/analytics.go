@@ -1,10 +1,8 @@
 package tui
 
 import (
-	"cmp"
 	"context"
 	"fmt"
-	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -12,8 +10,12 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/mickamy/sql-tap/analytics"
 	"github.com/mickamy/sql-tap/clipboard"
+	"github.com/mickamy/sql-tap/eventfmt"
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 type analyticsSortMode int
@@ -23,6 +25,7 @@ const (
 	analyticsSortCount
 	analyticsSortAvgDuration
 	analyticsSortP95Duration
+	analyticsSortErrors
 )
 
 func (s analyticsSortMode) String() string {
@@ -35,6 +38,8 @@ func (s analyticsSortMode) String() string {
 		return "avg"
 	case analyticsSortP95Duration:
 		return "p95"
+	case analyticsSortErrors:
+		return "errors"
 	}
 	return "total"
 }
@@ -48,61 +53,212 @@ func (s analyticsSortMode) next() analyticsSortMode {
 	case analyticsSortAvgDuration:
 		return analyticsSortP95Duration
 	case analyticsSortP95Duration:
+		return analyticsSortErrors
+	case analyticsSortErrors:
 		return analyticsSortTotalDuration
 	}
 	return analyticsSortTotalDuration
 }
 
+// analyticsGroup selects what analytics rows aggregate over.
+type analyticsGroup int
+
+const (
+	analyticsGroupTemplate analyticsGroup = iota // one row per normalized query
+	analyticsGroupTable                          // one row per table referenced
+	analyticsGroupTx                             // one row per transaction shape
+)
+
+func (g analyticsGroup) String() string {
+	switch g {
+	case analyticsGroupTemplate:
+		return "template"
+	case analyticsGroupTable:
+		return "table"
+	case analyticsGroupTx:
+		return "transaction"
+	}
+	return "template"
+}
+
+func (g analyticsGroup) next() analyticsGroup {
+	switch g {
+	case analyticsGroupTemplate:
+		return analyticsGroupTable
+	case analyticsGroupTable:
+		return analyticsGroupTx
+	case analyticsGroupTx:
+		return analyticsGroupTemplate
+	}
+	return analyticsGroupTemplate
+}
+
 type analyticsRow struct {
-	query         string
+	query         string // normalized query, table name or transaction shape, per grouping
+	templates     int    // distinct templates aggregated, when grouped by table
+	queries       int    // queries per transaction, when grouped by transaction
 	count         int
+	errors        int
 	totalDuration time.Duration
 	avgDuration   time.Duration
 	p95Duration   time.Duration
 	maxDuration   time.Duration
 }
 
-func (m Model) buildAnalyticsRows() []analyticsRow {
-	type agg struct {
-		count     int
-		totalDur  time.Duration
-		durations []time.Duration
+// errorRate returns the fraction of executions that failed, in [0, 1].
+func (r analyticsRow) errorRate() float64 {
+	if r.count == 0 {
+		return 0
 	}
-	groups := make(map[string]*agg)
+	return float64(r.errors) / float64(r.count)
+}
 
-	for _, ev := range m.events {
-		switch proxy.Op(ev.GetOp()) {
-		case proxy.OpBegin, proxy.OpCommit, proxy.OpRollback, proxy.OpBind, proxy.OpPrepare:
+// isAnalyticsEvent reports whether ev contributes to per-template analytics.
+// Transaction lifecycle and protocol-only events, in-flight events, and
+// events without a normalized query, are excluded.
+func isAnalyticsEvent(ev *tapv1.QueryEvent) bool {
+	if ev.GetInFlight() {
+		return false
+	}
+	switch proxy.Op(ev.GetOp()) {
+	case proxy.OpBegin, proxy.OpCommit, proxy.OpRollback, proxy.OpBind, proxy.OpPrepare:
+		return false
+	case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
+	}
+	return ev.GetNormalizedQuery() != ""
+}
+
+// analyticsKeys returns the keys of the analytics rows ev counts towards: its
+// normalized query, or when grouping by table every table it refers to.
+func analyticsKeys(ev *tapv1.QueryEvent, group analyticsGroup) []string {
+	nq := ev.GetNormalizedQuery()
+	switch group {
+	case analyticsGroupTable:
+		return query.Tables(nq)
+	case analyticsGroupTemplate, analyticsGroupTx:
+	}
+	return []string{nq}
+}
+
+// countTemplates returns the number of distinct normalized queries in events.
+func countTemplates(events []*tapv1.QueryEvent) int {
+	seen := make(map[string]struct{})
+	for _, ev := range events {
+		if isAnalyticsEvent(ev) {
+			seen[ev.GetNormalizedQuery()] = struct{}{}
+		}
+	}
+	return len(seen)
+}
+
+// aggregateAnalytics aggregates the analytics events among events per
+// template or per table, or the transactions per shape. Grouped by
+// transaction, it also returns the number of queries per transaction of each
+// shape.
+func aggregateAnalytics(events []*tapv1.QueryEvent, group analyticsGroup) ([]analytics.Row, map[string]int) {
+	if group == analyticsGroupTx {
+		return aggregateTxShapes(events)
+	}
+	agg := analytics.New()
+	for _, ev := range events {
+		if !isAnalyticsEvent(ev) {
 			continue
-		case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
 		}
+		agg.Record(ev.GetNormalizedQuery(), analyticsKeys(ev, group),
+			ev.GetDuration().AsDuration(), ev.GetError() != "")
+	}
+	return agg.Snapshot(false).Rows, nil
+}
 
-		nq := ev.GetNormalizedQuery()
-		if nq == "" {
+// txShape returns the shape of the transaction made of the events at
+// indices: the normalized queries it ran, in order, each run of one query
+// written once with its length, e.g. "SELECT … ×3; UPDATE …". Transactions
+// with the same shape differ only in their args.
+func txShape(events []*tapv1.QueryEvent, indices []int) string {
+	var parts []string
+	prev, run := "", 0
+	flush := func() {
+		switch {
+		case run == 1:
+			parts = append(parts, prev)
+		case run > 1:
+			parts = append(parts, fmt.Sprintf("%s ×%d", prev, run))
+		}
+	}
+	for _, idx := range indices {
+		ev := events[idx]
+		if !isAnalyticsEvent(ev) {
 			continue
 		}
+		nq := eventfmt.Collapse(ev.GetNormalizedQuery())
+		if nq == prev {
+			run++
+			continue
+		}
+		flush()
+		prev, run = nq, 1
+	}
+	flush()
+	return strings.Join(parts, "; ")
+}
 
-		dur := ev.GetDuration().AsDuration()
-		g, ok := groups[nq]
-		if !ok {
-			g = &agg{}
-			groups[nq] = g
+// aggregateTxShapes aggregates the finished transactions among events per
+// shape, each counting its wall time, and failed if the server reported it
+// failed or one of its queries did. It also returns the number of queries per
+// transaction of each shape. Transactions still open are left out, as their
+// shape and time are not final.
+func aggregateTxShapes(events []*tapv1.QueryEvent) ([]analytics.Row, map[string]int) {
+	var order []string
+	txs := make(map[string][]int)
+	ended := make(map[string]bool)
+	for i, ev := range events {
+		txID := ev.GetTxId()
+		if txID == "" {
+			continue
+		}
+		if _, ok := txs[txID]; !ok {
+			order = append(order, txID)
+		}
+		txs[txID] = append(txs[txID], i)
+		switch proxy.Op(ev.GetOp()) {
+		case proxy.OpCommit, proxy.OpRollback:
+			ended[txID] = true
+		default:
 		}
-		g.count++
-		g.totalDur += dur
-		g.durations = append(g.durations, dur)
 	}
 
-	rows := make([]analyticsRow, 0, len(groups))
-	for q, g := range groups {
-		slices.SortFunc(g.durations, cmp.Compare)
+	agg := analytics.New()
+	queries := make(map[string]int)
+	for _, txID := range order {
+		indices := txs[txID]
+		shape := txShape(events, indices)
+		if !ended[txID] || shape == "" {
+			continue
+		}
+		failed := txFailed(events, indices)
+		for _, idx := range indices {
+			failed = failed || events[idx].GetError() != ""
+		}
+		agg.Record(shape, []string{shape}, txWallDuration(events, indices), failed)
+		queries[shape] = txQueryCount(events, indices)
+	}
+	return agg.Snapshot(false).Rows, queries
+}
+
+func (m Model) buildAnalyticsRows() []analyticsRow {
+	agg, queries := aggregateAnalytics(m.events, m.analyticsGroup)
+	rows := make([]analyticsRow, 0, len(agg))
+	for _, r := range agg {
 		rows = append(rows, analyticsRow{
-			query:         q,
-			count:         g.count,
-			totalDuration: g.totalDur,
-			avgDuration:   g.totalDur / time.Duration(g.count),
-			p95Duration:   percentile(g.durations, 0.95),
-			maxDuration:   g.durations[len(g.durations)-1],
+			query:         r.Query,
+			templates:     r.Templates,
+			queries:       queries[r.Query],
+			count:         r.Count,
+			errors:        r.Errors,
+			totalDuration: r.Total,
+			avgDuration:   r.Avg,
+			p95Duration:   r.P95,
+			maxDuration:   r.Max,
 		})
 	}
 	return rows
@@ -127,12 +283,107 @@ func sortAnalyticsRows(rows []analyticsRow, mode analyticsSortMode) {
 			return rows[i].avgDuration > rows[j].avgDuration
 		case analyticsSortP95Duration:
 			return rows[i].p95Duration > rows[j].p95Duration
+		case analyticsSortErrors:
+			if rows[i].errors != rows[j].errors {
+				return rows[i].errors > rows[j].errors
+			}
+			return rows[i].errorRate() > rows[j].errorRate()
 		}
 		return rows[i].totalDuration > rows[j].totalDuration
 	})
 }
 
+// filterAnalyticsRows returns the rows whose query contains substr, ignoring
+// case. An empty substr keeps every row.
+func filterAnalyticsRows(rows []analyticsRow, substr string) []analyticsRow {
+	if substr == "" {
+		return rows
+	}
+	substr = strings.ToLower(substr)
+	var out []analyticsRow
+	for _, r := range rows {
+		if strings.Contains(strings.ToLower(r.query), substr) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// refreshAnalyticsRows rebuilds the analytics rows from the captured events,
+// applying the analytics search and the current sort.
+func (m Model) refreshAnalyticsRows() Model {
+	m.analyticsRows = filterAnalyticsRows(m.buildAnalyticsRows(), m.analyticsSearch)
+	sortAnalyticsRows(m.analyticsRows, m.analyticsSortMode)
+	m.analyticsCursor = min(m.analyticsCursor, max(len(m.analyticsRows)-1, 0))
+	return m
+}
+
+func (m Model) updateAnalyticsSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.analyticsSearchMode = false
+		m.pendingBracket = false
+		return m, nil
+	case "esc":
+		m.analyticsSearchMode = false
+		m.analyticsSearch = ""
+		m.pendingBracket = false
+		return m.refreshAnalyticsRows(), nil
+	case "backspace":
+		if m.analyticsSearchCursor > 0 {
+			runes := []rune(m.analyticsSearch)
+			m.analyticsSearch = string(runes[:m.analyticsSearchCursor-1]) + string(runes[m.analyticsSearchCursor:])
+			m.analyticsSearchCursor--
+			m = m.refreshAnalyticsRows()
+		}
+		return m, nil
+	case "ctrl+c":
+		if m.conn != nil {
+			_ = m.conn.Close()
+		}
+		return m, tea.Quit
+	case "left":
+		if m.analyticsSearchCursor > 0 {
+			m.analyticsSearchCursor--
+		}
+		return m, nil
+	case "right":
+		if m.analyticsSearchCursor < len([]rune(m.analyticsSearch)) {
+			m.analyticsSearchCursor++
+		}
+		return m, nil
+	}
+
+	if len(msg.Runes) == 0 {
+		return m, nil
+	}
+
+	var r []rune
+	m, r = m.filterInputRunes(msg.Runes)
+	if len(r) == 0 {
+		return m, nil
+	}
+
+	runes := []rune(m.analyticsSearch)
+	m.analyticsSearch = string(runes[:m.analyticsSearchCursor]) + string(r) + string(runes[m.analyticsSearchCursor:])
+	m.analyticsSearchCursor += len(r)
+	return m.refreshAnalyticsRows(), nil
+}
+
 func (m Model) updateAnalytics(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.analyticsSearchMode {
+		return m.updateAnalyticsSearch(msg)
+	}
+	if m.analyticsWriteMode {
+		m.analyticsWriteMode = false
+		switch msg.String() {
+		case "c":
+			return m, m.runAnalyticsExport(exportCSV)
+		case "m":
+			return m, m.runAnalyticsExport(exportMarkdown)
+		}
+		return m, nil
+	}
 	switch msg.String() {
 	case "ctrl+c":
 		if m.conn != nil {
@@ -142,7 +393,7 @@ func (m Model) updateAnalytics(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "q":
 		m.view = viewList
 		m = m.rebuild()
-		if m.follow {
+		if m.following() {
 			m.cursor = max(len(m.displayRows)-1, 0)
 		}
 		return m, nil
@@ -177,11 +428,30 @@ func (m Model) updateAnalytics(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		half := m.analyticsVisibleRows() / 2
 		m.analyticsCursor = max(m.analyticsCursor-half, 0)
 		return m, nil
+	case "/":
+		m.analyticsSearchMode = true
+		m.analyticsSearchCursor = len([]rune(m.analyticsSearch))
+		return m, nil
+	case "esc":
+		if m.analyticsSearch != "" {
+			m.analyticsSearch = ""
+			m.analyticsSearchCursor = 0
+			m = m.refreshAnalyticsRows()
+		}
+		return m, nil
 	case "s":
 		m.analyticsSortMode = m.analyticsSortMode.next()
 		sortAnalyticsRows(m.analyticsRows, m.analyticsSortMode)
 		m.analyticsCursor = 0
 		return m, nil
+	case "g":
+		m.analyticsGroup = m.analyticsGroup.next()
+		m.analyticsCursor = 0
+		m.analyticsHScroll = 0
+		return m.refreshAnalyticsRows(), nil
+	case "w":
+		m.analyticsWriteMode = true
+		return m, nil
 	case "c":
 		if m.analyticsCursor >= 0 && m.analyticsCursor < len(m.analyticsRows) {
 			_ = clipboard.Copy(context.Background(), m.analyticsRows[m.analyticsCursor].query)
@@ -195,19 +465,38 @@ func (m Model) updateAnalytics(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 const (
 	analyticsColMarker = 2  // "▶ " or "  "
 	analyticsColCount  = 7  // "  Count" right-aligned
+	analyticsColErrors = 6  // "Errors" right-aligned
+	analyticsColErrPct = 6  // "  Err%" right-aligned, e.g. " 12.5%"
 	analyticsColAvg    = 10 // "       Avg" right-aligned
 	analyticsColP95    = 10 // "       P95" right-aligned
 	analyticsColMax    = 10 // "       Max" right-aligned
 	analyticsColTotal  = 10 // "     Total" right-aligned
+
+	analyticsColTemplates = 9 // "Templates" right-aligned, table grouping only
+	analyticsColQueries   = 7 // "Queries" right-aligned, transaction grouping only
 )
 
 func (m Model) analyticsVisibleRows() int {
 	return max(m.height-4, 3) // -2 for top/bottom border, -1 for header, -1 for padding
 }
 
+// analyticsFixedWidth returns the width of the columns left of the query or
+// table name, including the separator spaces between them.
+func (m Model) analyticsFixedWidth() int {
+	w := analyticsColMarker + analyticsColCount + analyticsColErrors + analyticsColErrPct +
+		analyticsColAvg + analyticsColP95 + analyticsColMax + analyticsColTotal + 8
+	switch m.analyticsGroup {
+	case analyticsGroupTable:
+		w += analyticsColTemplates + 1
+	case analyticsGroupTx:
+		w += analyticsColQueries + 1
+	case analyticsGroupTemplate:
+	}
+	return w
+}
+
 func (m Model) analyticsMaxLineWidth() int {
-	fixedCols := analyticsColMarker + analyticsColCount + analyticsColAvg +
-		analyticsColP95 + analyticsColMax + analyticsColTotal + 6
+	fixedCols := m.analyticsFixedWidth()
 	maxW := 0
 	for _, r := range m.analyticsRows {
 		w := fixedCols + len([]rune(r.query))
@@ -223,20 +512,39 @@ func (m Model) renderAnalytics() string {
 	visibleRows := m.analyticsVisibleRows()
 
 	title := fmt.Sprintf(" Analytics (%d templates) [sort: %s] ", len(m.analyticsRows), m.analyticsSortMode)
+	label := "Query"
+	switch m.analyticsGroup {
+	case analyticsGroupTable:
+		title = fmt.Sprintf(" Analytics (%d tables) [sort: %s] ", len(m.analyticsRows), m.analyticsSortMode)
+		label = "Table"
+	case analyticsGroupTx:
+		title = fmt.Sprintf(" Analytics (%d transaction shapes) [sort: %s] ", len(m.analyticsRows), m.analyticsSortMode)
+		label = "Transaction"
+	case analyticsGroupTemplate:
+	}
+	if m.analyticsSearch != "" {
+		title += fmt.Sprintf("[search: %s] ", m.analyticsSearch)
+	}
 
-	// 6 = separator spaces between columns
-	fixedWidth := analyticsColMarker + analyticsColCount + analyticsColAvg +
-		analyticsColP95 + analyticsColMax + analyticsColTotal + 6
-	colQuery := max(innerWidth-fixedWidth, 10)
+	colQuery := max(innerWidth-m.analyticsFixedWidth(), 10)
 
-	header := fmt.Sprintf("  %*s %*s %*s %*s %*s  %s",
+	header := fmt.Sprintf("  %*s %*s %*s %*s %*s %*s %*s",
 		analyticsColCount, "Count",
+		analyticsColErrors, "Errors",
+		analyticsColErrPct, "Err%",
 		analyticsColAvg, "Avg",
 		analyticsColP95, "P95",
 		analyticsColMax, "Max",
 		analyticsColTotal, "Total",
-		"Query",
 	)
+	switch m.analyticsGroup {
+	case analyticsGroupTable:
+		header += fmt.Sprintf(" %*s", analyticsColTemplates, "Templates")
+	case analyticsGroupTx:
+		header += fmt.Sprintf(" %*s", analyticsColQueries, "Queries")
+	case analyticsGroupTemplate:
+	}
+	header += "  " + label
 
 	dataRows := max(visibleRows-1, 1) // -1 for header
 
@@ -258,7 +566,7 @@ func (m Model) renderAnalytics() string {
 			marker = "▶ "
 		}
 
-		q := strings.TrimSpace(reSpaces.ReplaceAllString(r.query, " "))
+		q := eventfmt.Collapse(r.query)
 		// Apply horizontal scroll then truncate.
 		runes := []rune(q)
 		if m.analyticsHScroll < len(runes) {
@@ -271,16 +579,24 @@ func (m Model) renderAnalytics() string {
 			q = string([]rune(q)[:colQuery-1]) + "…"
 		}
 
-		row := fmt.Sprintf("%s%*d %*s %*s %*s %*s  %s",
+		row := fmt.Sprintf("%s%*d %*d %*s %*s %*s %*s %*s",
 			marker,
 			analyticsColCount, r.count,
+			analyticsColErrors, r.errors,
+			analyticsColErrPct, fmt.Sprintf("%.1f%%", r.errorRate()*100),
 			analyticsColAvg, formatDurationValue(r.avgDuration),
 			analyticsColP95, formatDurationValue(r.p95Duration),
 			analyticsColMax, formatDurationValue(r.maxDuration),
 			analyticsColTotal, formatDurationValue(r.totalDuration),
-			q,
 		)
-		rows = append(rows, row)
+		switch m.analyticsGroup {
+		case analyticsGroupTable:
+			row += fmt.Sprintf(" %*d", analyticsColTemplates, r.templates)
+		case analyticsGroupTx:
+			row += fmt.Sprintf(" %*d", analyticsColQueries, r.queries)
+		case analyticsGroupTemplate:
+		}
+		rows = append(rows, row+"  "+q)
 	}
 
 	content := strings.Join(rows, "\n")
@@ -304,8 +620,14 @@ func (m Model) renderAnalytics() string {
 
 	if n := len(boxLines); n > 0 {
 		borderFg := lipgloss.NewStyle().Foreground(borderColor)
-		help := " q: back  j/k: scroll  h/l: pan  s: sort  c: copy "
-		dashes := max(innerWidth-len([]rune(help)), 0)
+		help := borderHelp(viewAnalytics)
+		if m.analyticsSearchMode {
+			help = " / " + renderInputWithCursor(m.analyticsSearch, m.analyticsSearchCursor) + " "
+		}
+		if m.analyticsWriteMode {
+			help = " write: [c]sv [m]arkdown "
+		}
+		dashes := max(innerWidth-lipgloss.Width(help), 0)
 		boxLines[n-1] = borderFg.Render("╰") +
 			lipgloss.NewStyle().Faint(true).Render(help) +
 			borderFg.Render(strings.Repeat("─", dashes)+"╯")
@@ -0,0 +1,387 @@
+package tui //nolint:testpackage // testing internal analytics helpers
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestCountTemplates(t *testing.T) {
+	t.Parallel()
+
+	ev := func(op proxy.Op, nq string) *tapv1.QueryEvent {
+		e := makeEvent(op, nq, time.Millisecond, "")
+		e.NormalizedQuery = nq
+		return e
+	}
+
+	tests := []struct {
+		name   string
+		events []*tapv1.QueryEvent
+		want   int
+	}{
+		{name: "empty", events: nil, want: 0},
+		{
+			name: "repeated template",
+			events: []*tapv1.QueryEvent{
+				ev(proxy.OpExecute, "SELECT * FROM users WHERE id = ?"),
+				ev(proxy.OpExecute, "SELECT * FROM users WHERE id = ?"),
+				ev(proxy.OpExecute, "SELECT * FROM users WHERE id = ?"),
+			},
+			want: 1,
+		},
+		{
+			name: "lifecycle and unnormalized events are ignored",
+			events: []*tapv1.QueryEvent{
+				ev(proxy.OpBegin, "BEGIN"),
+				ev(proxy.OpQuery, "SELECT 1"),
+				ev(proxy.OpExec, "UPDATE t SET a = ?"),
+				ev(proxy.OpPrepare, "SELECT 2"),
+				ev(proxy.OpQuery, ""),
+				ev(proxy.OpCommit, "COMMIT"),
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := countTemplates(tt.events); got != tt.want {
+				t.Errorf("countTemplates() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterAnalyticsRows(t *testing.T) {
+	t.Parallel()
+
+	rows := []analyticsRow{
+		{query: "SELECT * FROM users WHERE id = ?"},
+		{query: "SELECT * FROM orders WHERE user_id = ?"},
+		{query: "UPDATE users SET name = ? WHERE id = ?"},
+	}
+
+	tests := []struct {
+		name   string
+		substr string
+		want   []string
+	}{
+		{"empty keeps all", "", []string{rows[0].query, rows[1].query, rows[2].query}},
+		{"table name", "users", []string{rows[0].query, rows[2].query}},
+		{"case insensitive", "update", []string{rows[2].query}},
+		{"no match", "payments", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, r := range filterAnalyticsRows(rows, tt.substr) {
+				got = append(got, r.query)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("filterAnalyticsRows(%q) = %q, want %q", tt.substr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyticsSearch(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for _, q := range []string{
+		"SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM orders WHERE id = ?",
+		"DELETE FROM users WHERE id = ?",
+	} {
+		ev := makeEvent(proxy.OpExecute, q, time.Millisecond, "")
+		ev.NormalizedQuery = q
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	m = update(t, m, keyMsg("a"))
+	m = update(t, m, keyMsg("s")) // sort by count
+	m.analyticsHScroll = 3
+	m = update(t, m, keyMsg("/"))
+	for _, k := range []string{"u", "s", "e", "r", "s"} {
+		m = update(t, m, keyMsg(k))
+	}
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+
+	if m.analyticsSearchMode {
+		t.Fatal("still in search mode after enter")
+	}
+	if len(m.analyticsRows) != 2 || m.analyticsRows[0].count != 2 {
+		t.Fatalf("rows = %+v, want the two users templates sorted by count", m.analyticsRows)
+	}
+	if m.analyticsSortMode != analyticsSortCount || m.analyticsHScroll != 3 {
+		t.Errorf("sort = %s, hscroll = %d, want count, 3", m.analyticsSortMode, m.analyticsHScroll)
+	}
+	if !strings.Contains(m.renderAnalytics(), "[search: users]") {
+		t.Error("title does not show the active search")
+	}
+
+	// j still navigates once the search is confirmed.
+	m = update(t, m, keyMsg("j"))
+	if m.analyticsCursor != 1 {
+		t.Errorf("cursor = %d after j, want 1", m.analyticsCursor)
+	}
+
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEsc})
+	if m.analyticsSearch != "" || len(m.analyticsRows) != 3 {
+		t.Errorf("search = %q, rows = %d after esc, want cleared, 3", m.analyticsSearch, len(m.analyticsRows))
+	}
+}
+
+func TestAnalyticsErrors(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for _, e := range []struct{ q, err string }{
+		{"SELECT * FROM users WHERE id = ?", ""},
+		{"SELECT * FROM users WHERE id = ?", ""},
+		{"SELECT * FROM users WHERE id = ?", ""},
+		{"UPDATE carts SET total = ?", "deadlock detected"},
+		{"UPDATE carts SET total = ?", ""},
+	} {
+		ev := makeEvent(proxy.OpExecute, e.q, time.Millisecond, e.err)
+		ev.NormalizedQuery = e.q
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	m = update(t, m, keyMsg("a"))
+	for m.analyticsSortMode != analyticsSortErrors {
+		m = update(t, m, keyMsg("s"))
+	}
+
+	top := m.analyticsRows[0]
+	if top.query != "UPDATE carts SET total = ?" || top.errors != 1 || top.errorRate() != 0.5 {
+		t.Fatalf("top row = %+v, want the failing UPDATE with 1 error (50%%)", top)
+	}
+	if m.analyticsRows[1].errors != 0 {
+		t.Errorf("second row errors = %d, want 0", m.analyticsRows[1].errors)
+	}
+
+	out := m.renderAnalytics()
+	for _, want := range []string{"[sort: errors]", "Errors", "Err%", "50.0%"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("analytics view missing %q", want)
+		}
+	}
+}
+
+func TestAnalyticsGroupByTable(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 140, 40
+	for _, q := range []string{
+		"SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM orders o JOIN users u ON u.id = o.user_id",
+		"INSERT INTO orders (user_id) VALUES (?)",
+		"SELECT ?",
+	} {
+		ev := makeEvent(proxy.OpExecute, q, time.Millisecond, "")
+		ev.NormalizedQuery = q
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	m = update(t, m, keyMsg("a"))
+	m = update(t, m, keyMsg("s")) // sort by count
+	m = update(t, m, keyMsg("g"))
+
+	if m.analyticsGroup != analyticsGroupTable {
+		t.Fatalf("group = %s after g, want table", m.analyticsGroup)
+	}
+	want := []struct {
+		table     string
+		count     int
+		templates int
+	}{
+		{"users", 3, 2},
+		{"orders", 2, 2},
+	}
+	if len(m.analyticsRows) != len(want) {
+		t.Fatalf("rows = %+v, want %d tables", m.analyticsRows, len(want))
+	}
+	for i, w := range want {
+		r := m.analyticsRows[i]
+		if r.query != w.table || r.count != w.count || r.templates != w.templates {
+			t.Errorf("row %d = %s count=%d templates=%d, want %s count=%d templates=%d",
+				i, r.query, r.count, r.templates, w.table, w.count, w.templates)
+		}
+	}
+
+	out := m.renderAnalytics()
+	for _, s := range []string{"(2 tables)", "Templates", "Table"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("table view missing %q", s)
+		}
+	}
+
+	m = update(t, m, keyMsg("g"))
+	m = update(t, m, keyMsg("g"))
+	if m.analyticsGroup != analyticsGroupTemplate || len(m.analyticsRows) != 4 {
+		t.Errorf("group = %s, rows = %d after third g, want template, 4", m.analyticsGroup, len(m.analyticsRows))
+	}
+}
+
+// txEvents returns the events of a transaction txID starting at start: BEGIN,
+// then each of queries 1ms after the one before, then end 2ms after the last.
+func txEvents(txID string, start time.Time, end proxy.Op, queries ...string) []*tapv1.QueryEvent {
+	events := []*tapv1.QueryEvent{{Op: int32(proxy.OpBegin), TxId: txID, StartTime: timestamppb.New(start)}}
+	at := start
+	for _, q := range queries {
+		at = at.Add(time.Millisecond)
+		events = append(events, &tapv1.QueryEvent{
+			Op: int32(proxy.OpExecute), Query: q, NormalizedQuery: q, TxId: txID,
+			StartTime: timestamppb.New(at), Duration: durationpb.New(time.Millisecond),
+		})
+	}
+	at = at.Add(2 * time.Millisecond)
+	events = append(events, &tapv1.QueryEvent{Op: int32(end), TxId: txID, StartTime: timestamppb.New(at)})
+	return events
+}
+
+func TestTxShape(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		queries []string
+		want    string
+	}{
+		{name: "empty", queries: nil, want: ""},
+		{name: "single", queries: []string{"SELECT ?"}, want: "SELECT ?"},
+		{
+			name:    "order matters",
+			queries: []string{"SELECT * FROM users WHERE id = ?", "UPDATE users SET name = ?"},
+			want:    "SELECT * FROM users WHERE id = ?; UPDATE users SET name = ?",
+		},
+		{
+			name: "runs are counted",
+			queries: []string{
+				"SELECT * FROM users WHERE id = ?",
+				"SELECT * FROM orders WHERE user_id = ?",
+				"SELECT * FROM orders WHERE user_id = ?",
+				"SELECT * FROM orders WHERE user_id = ?",
+				"SELECT * FROM users WHERE id = ?",
+			},
+			want: "SELECT * FROM users WHERE id = ?; SELECT * FROM orders WHERE user_id = ? ×3; SELECT * FROM users WHERE id = ?",
+		},
+		{
+			name:    "whitespace is folded",
+			queries: []string{"SELECT *\n  FROM users"},
+			want:    "SELECT * FROM users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			events := txEvents("tx", start, proxy.OpCommit, tt.queries...)
+			indices := make([]int, len(events))
+			for i := range indices {
+				indices[i] = i
+			}
+			if got := txShape(events, indices); got != tt.want {
+				t.Errorf("txShape = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyticsGroupByTx(t *testing.T) {
+	t.Parallel()
+
+	const (
+		sel = "SELECT * FROM users WHERE id = ?"
+		upd = "UPDATE users SET name = ? WHERE id = ?"
+	)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events []*tapv1.QueryEvent
+	events = append(events, txEvents("a", start, proxy.OpCommit, sel, upd)...)
+	events = append(events, txEvents("b", start.Add(time.Second), proxy.OpRollback, sel, upd)...)
+	events = append(events, txEvents("c", start.Add(2*time.Second), proxy.OpCommit, upd, sel)...)
+	events = append(events, txEvents("d", start.Add(3*time.Second), proxy.OpCommit, sel, sel, sel)...)
+	// Outside any transaction, and a transaction still open: left out.
+	events = append(events, makeEvent(proxy.OpQuery, sel, time.Millisecond, ""))
+	open := txEvents("e", start.Add(4*time.Second), proxy.OpCommit, sel, upd)
+	events = append(events, open[:len(open)-1]...)
+	events[len(events)-1].Error = "boom" // would fail e, were it counted
+	events[2].Error = "deadlock"         // fails a
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 160, 40
+	for _, ev := range events {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+	m = update(t, m, keyMsg("a"))
+	m = update(t, m, keyMsg("s")) // sort by count
+	m = update(t, m, keyMsg("g"))
+	m = update(t, m, keyMsg("g"))
+	if m.analyticsGroup != analyticsGroupTx {
+		t.Fatalf("group = %s after two g, want transaction", m.analyticsGroup)
+	}
+
+	want := []analyticsRow{
+		// A transaction of 2 queries takes 4ms from BEGIN to its end.
+		{query: sel + "; " + upd, queries: 2, count: 2, errors: 1, totalDuration: 8 * time.Millisecond},
+		{query: upd + "; " + sel, queries: 2, count: 1, totalDuration: 4 * time.Millisecond},
+		{query: sel + " ×3", queries: 3, count: 1, totalDuration: 5 * time.Millisecond},
+	}
+	if len(m.analyticsRows) != len(want) {
+		t.Fatalf("rows = %+v, want %d shapes", m.analyticsRows, len(want))
+	}
+	byShape := make(map[string]analyticsRow)
+	for _, r := range m.analyticsRows {
+		byShape[r.query] = r
+	}
+	for _, w := range want {
+		r, ok := byShape[w.query]
+		if !ok {
+			t.Errorf("no row for shape %q", w.query)
+			continue
+		}
+		if r.queries != w.queries || r.count != w.count || r.errors != w.errors || r.totalDuration != w.totalDuration {
+			t.Errorf("row %q: queries=%d count=%d errors=%d total=%s, want queries=%d count=%d errors=%d total=%s",
+				w.query, r.queries, r.count, r.errors, r.totalDuration, w.queries, w.count, w.errors, w.totalDuration)
+		}
+	}
+	if m.analyticsRows[0].query != want[0].query {
+		t.Errorf("first row = %q, want the most frequent shape", m.analyticsRows[0].query)
+	}
+
+	out := m.renderAnalytics()
+	for _, s := range []string{"(3 transaction shapes)", "Queries", "Transaction"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("transaction view missing %q", s)
+		}
+	}
+
+	csv, err := renderAnalyticsCSV(analyticsExportRows(m.events, m.analyticsRows, m.analyticsGroup), m.analyticsGroup)
+	if err != nil {
+		t.Fatalf("renderAnalyticsCSV: %v", err)
+	}
+	if first := strings.SplitN(csv, "\n", 3); len(first) < 2 ||
+		first[0] != "transaction,queries,count,errors,error_rate,avg_ms,p95_ms,max_ms,total_ms" ||
+		first[1] != sel+"; "+upd+",2,2,1,0.5000,4.000,4.000,4.000,8.000" {
+		t.Errorf("csv = %q, want a transaction header and the most frequent shape first", csv)
+	}
+}
@@ -0,0 +1,142 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+// defaultNPlus1Window is sql-tapd's default N+1 detection window, used until
+// the daemon reports its own.
+const defaultNPlus1Window = time.Second
+
+// maxSiblingRows caps the sibling row numbers listed for an N+1 event.
+const maxSiblingRows = 10
+
+// flagContextLines explains why the event at idx was flagged: for N+1, how
+// often its template ran in the preceding window and at which list rows; for
+// slow queries, how its duration compares to the template's other runs; for
+// full scans, a hint to look at the plan.
+func (m Model) flagContextLines(idx int) []string {
+	ev := m.events[idx]
+	nq := ev.GetNormalizedQuery()
+	if nq == "" || ev.GetInFlight() {
+		return nil
+	}
+
+	var lines []string
+	if ev.GetNPlus_1() {
+		lines = append(lines, m.nplus1ContextLines(idx)...)
+	}
+	if ev.GetSlowQuery() {
+		lines = append(lines, m.slowContextLines(ev))
+	}
+	if ev.GetFullScan() {
+		lines = append(lines, "Scan:     the plan reads a whole large table; check for a missing index")
+	}
+	return lines
+}
+
+// nplus1Window returns the window the inspector counts repeats of an N+1
+// template in: the daemon's detection window, as reported by ServerInfo.
+func (m Model) nplus1Window() time.Duration {
+	if w := m.serverInfo.GetNplus1Window().AsDuration(); w > 0 {
+		return w
+	}
+	return defaultNPlus1Window
+}
+
+func (m Model) nplus1ContextLines(idx int) []string {
+	ev := m.events[idx]
+	window := m.nplus1Window()
+	end := ev.GetStartTime().AsTime()
+	start := end.Add(-window)
+
+	var burst []int
+	for i, other := range m.events {
+		if other.GetNormalizedQuery() != ev.GetNormalizedQuery() {
+			continue
+		}
+		t := other.GetStartTime().AsTime()
+		if !t.Before(start) && !t.After(end) {
+			burst = append(burst, i)
+		}
+	}
+
+	lines := []string{fmt.Sprintf("N+1:      %d runs of this template within %s up to this one",
+		len(burst), window)}
+
+	// Siblings are referenced by list row number, as used by NG.
+	rowOf := make(map[int]int, len(m.displayRows))
+	for row, dr := range m.displayRows {
+		for _, i := range rowEventIndices(dr) {
+			rowOf[i] = row
+		}
+	}
+	var refs []string
+	hidden := 0
+	for _, i := range burst {
+		if i == idx {
+			continue
+		}
+		row, ok := rowOf[i]
+		if !ok || len(refs) == maxSiblingRows {
+			hidden++
+			continue
+		}
+		ref := fmt.Sprintf("#%d", row+1)
+		if len(refs) == 0 || refs[len(refs)-1] != ref {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) > 0 || hidden > 0 {
+		s := "  rows: " + strings.Join(refs, " ")
+		if hidden > 0 {
+			s += fmt.Sprintf(" (+%d not listed)", hidden)
+		}
+		lines = append(lines, strings.TrimRight(s, " "))
+	}
+	return lines
+}
+
+// templateDurations returns the durations of the finished runs of the
+// normalized query nq, sorted.
+func (m Model) templateDurations(nq string) []time.Duration {
+	var durations []time.Duration
+	for _, ev := range m.events {
+		if ev.GetNormalizedQuery() != nq || ev.GetInFlight() || ev.GetDuration() == nil {
+			continue
+		}
+		durations = append(durations, ev.GetDuration().AsDuration())
+	}
+	slices.Sort(durations)
+	return durations
+}
+
+func (m Model) slowContextLines(ev *tapv1.QueryEvent) string {
+	durations := m.templateDurations(ev.GetNormalizedQuery())
+	if len(durations) < 2 {
+		return "Slow:     first run of this template"
+	}
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+
+	dur := ev.GetDuration().AsDuration()
+	avg := total / time.Duration(len(durations))
+	p95 := percentile(durations, 0.95)
+	cmp := "within"
+	if dur > p95 {
+		cmp = "above"
+	}
+	ratio := ""
+	if avg > 0 {
+		ratio = fmt.Sprintf("%.1f× avg, ", float64(dur)/float64(avg))
+	}
+	return fmt.Sprintf("Slow:     %s%s template p95 (avg %s, p95 %s over %d runs)",
+		ratio, cmp, formatDurationValue(avg), formatDurationValue(p95), len(durations))
+}
@@ -2,6 +2,8 @@ package tui
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -12,8 +14,76 @@ import (
 	"github.com/mickamy/sql-tap/explain"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/highlight"
+	"github.com/mickamy/sql-tap/query"
 )
 
+// explainTarget is a statement to EXPLAIN, with the args it ran with.
+type explainTarget struct {
+	query    string
+	args     []string
+	argTypes []string
+	prevPlan string // plan of the statement before it was edited, if any
+}
+
+// destructiveVerbs are the statements an EXPLAIN ANALYZE, which executes
+// them, runs only once confirmed.
+var destructiveVerbs = []string{"update", "delete", "drop", "truncate"}
+
+// confirmVerb returns the verb of query, uppercased, if running EXPLAIN in
+// mode needs confirmation first.
+func confirmVerb(mode explain.Mode, q string) (string, bool) {
+	if mode != explain.Analyze {
+		return "", false
+	}
+	verb := query.Verb(q)
+	if !slices.Contains(destructiveVerbs, verb) {
+		return "", false
+	}
+	return strings.ToUpper(verb), true
+}
+
+// analyzePrompt is the confirmation asked before EXPLAIN ANALYZE of q.
+func analyzePrompt(q string) string {
+	verb, _ := confirmVerb(explain.Analyze, q)
+	return "EXPLAIN ANALYZE executes this " + verb + ". Run it? [y/N]"
+}
+
+// openExplain shows the explain view and runs EXPLAIN in mode for t. A
+// destructive statement is only analyzed once the user confirms.
+func (m Model) openExplain(mode explain.Mode, t explainTarget) (tea.Model, tea.Cmd) {
+	if _, ok := confirmVerb(mode, t.query); ok {
+		m.confirmAnalyze = &t
+		return m, nil
+	}
+	return m.runExplainView(mode, t)
+}
+
+func (m Model) runExplainView(mode explain.Mode, t explainTarget) (tea.Model, tea.Cmd) {
+	m.view = viewExplain
+	m.explainPlan = ""
+	m.explainErr = nil
+	m.explainScroll = 0
+	m.explainHScroll = 0
+	m.explainMode = mode
+	m.explainQuery = t.query
+	m.explainArgs = t.args
+	m.explainArgTypes = t.argTypes
+	m.prevPlan = t.prevPlan
+	m.explainDiff = false
+	return m, runExplain(m.client, mode, t.query, t.args, t.argTypes)
+}
+
+// updateConfirmAnalyze answers the EXPLAIN ANALYZE confirmation: y runs it,
+// any other key cancels.
+func (m Model) updateConfirmAnalyze(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	t := *m.confirmAnalyze
+	m.confirmAnalyze = nil
+	if msg.String() != "y" {
+		return m.showAlert("EXPLAIN ANALYZE canceled")
+	}
+	return m.runExplainView(explain.Analyze, t)
+}
+
 func (m Model) updateExplain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "ctrl+c":
@@ -24,7 +94,7 @@ func (m Model) updateExplain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "q":
 		m.view = viewList
 		m = m.rebuild()
-		if m.follow {
+		if m.following() {
 			m.cursor = max(len(m.displayRows)-1, 0)
 		}
 		return m, nil
@@ -68,6 +138,14 @@ func (m Model) updateExplain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			mode = explain.Analyze
 		}
 		return m, openEditor(m.explainQuery, m.explainArgs, mode)
+	case "d":
+		if m.prevPlan == "" || m.explainPlan == "" {
+			return m.showAlert("no previous plan to diff")
+		}
+		m.explainDiff = !m.explainDiff
+		m.explainScroll = 0
+		m.explainHScroll = 0
+		return m, nil
 	}
 	return m, nil
 }
@@ -79,6 +157,14 @@ func (m Model) explainLines() []string {
 	if m.explainPlan == "" {
 		return []string{"Running " + m.explainMode.String() + "..."}
 	}
+	if m.explainDiff {
+		diff := diffPlans(m.prevPlan, m.explainPlan)
+		lines := make([]string, len(diff))
+		for i, l := range diff {
+			lines[i] = l.String()
+		}
+		return lines
+	}
 	return strings.Split(m.explainPlan, "\n")
 }
 
@@ -112,7 +198,12 @@ func (m Model) renderExplain() string {
 
 	// Highlight full lines first, then ANSI-aware slice for horizontal scroll.
 	for i, line := range visible {
-		visible[i] = ansi.Cut(highlight.Plan(line), m.explainHScroll, m.explainHScroll+innerWidth)
+		if m.explainDiff {
+			line = renderDiffLine(line)
+		} else {
+			line = highlight.Plan(line)
+		}
+		visible[i] = ansi.Cut(line, m.explainHScroll, m.explainHScroll+innerWidth)
 	}
 	content := strings.Join(visible, "\n")
 
@@ -128,6 +219,9 @@ func (m Model) renderExplain() string {
 		borderFg := lipgloss.NewStyle().Foreground(borderColor)
 		titleStyle := lipgloss.NewStyle().Bold(true)
 		title := " " + m.explainMode.String() + " "
+		if m.explainDiff {
+			title = " " + m.explainMode.String() + " (diff vs. before edit) "
+		}
 		dashes := max(innerWidth-len([]rune(title)), 0)
 		boxLines[0] = borderFg.Render("╭") +
 			titleStyle.Render(title) +
@@ -136,7 +230,7 @@ func (m Model) renderExplain() string {
 
 	if n := len(boxLines); n > 0 {
 		borderFg := lipgloss.NewStyle().Foreground(borderColor)
-		help := " q: back  j/k/h/l: scroll  c: copy  e/E: edit+explain "
+		help := borderHelp(viewExplain)
 		dashes := max(innerWidth-len([]rune(help)), 0)
 		boxLines[n-1] = borderFg.Render("╰") +
 			lipgloss.NewStyle().Faint(true).Render(help) +
@@ -146,12 +240,16 @@ func (m Model) renderExplain() string {
 	return strings.Join(boxLines, "\n")
 }
 
-func runExplain(client tapv1.TapServiceClient, mode explain.Mode, query string, args []string) tea.Cmd {
+func runExplain(client tapv1.TapServiceClient, mode explain.Mode, query string, args, argTypes []string) tea.Cmd {
 	return func() tea.Msg {
+		if client == nil {
+			return explainResultMsg{err: errors.New("not connected to sql-tapd")}
+		}
 		resp, err := client.Explain(context.Background(), &tapv1.ExplainRequest{
-			Query:   query,
-			Args:    args,
-			Analyze: mode == explain.Analyze,
+			Query:    query,
+			Args:     args,
+			ArgTypes: argTypes,
+			Analyze:  mode == explain.Analyze,
 		})
 		if err != nil {
 			return explainResultMsg{err: err}
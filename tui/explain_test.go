@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/explain"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestConfirmVerb(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		mode  explain.Mode
+		query string
+		want  string
+		ok    bool
+	}{
+		{name: "delete", mode: explain.Analyze, query: "DELETE FROM users WHERE id = $1", want: "DELETE", ok: true},
+		{name: "update", mode: explain.Analyze, query: "update users set name = 'x'", want: "UPDATE", ok: true},
+		{name: "drop", mode: explain.Analyze, query: "DROP TABLE users", want: "DROP", ok: true},
+		{name: "truncate", mode: explain.Analyze, query: "TRUNCATE users", want: "TRUNCATE", ok: true},
+		{name: "leading comment", mode: explain.Analyze, query: "/* app */ DELETE FROM users", want: "DELETE", ok: true},
+		{name: "with delete", mode: explain.Analyze, query: "WITH old AS (SELECT id FROM users) DELETE FROM users", want: "DELETE", ok: true},
+		{name: "select", mode: explain.Analyze, query: "SELECT * FROM users", ok: false},
+		{name: "insert", mode: explain.Analyze, query: "INSERT INTO users (id) VALUES (1)", ok: false},
+		{name: "plan only", mode: explain.Explain, query: "DELETE FROM users", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := confirmVerb(tt.mode, tt.query)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("confirmVerb(%v, %q) = %q, %v, want %q, %v", tt.mode, tt.query, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAnalyzeConfirmation(t *testing.T) {
+	t.Parallel()
+
+	newModel := func(t *testing.T, q string) Model {
+		t.Helper()
+		m := New("localhost:9091", Options{})
+		m.width, m.height = 120, 40
+		return update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, q, time.Millisecond, "")})
+	}
+
+	t.Run("destructive statement asks first", func(t *testing.T) {
+		t.Parallel()
+
+		m := newModel(t, "DELETE FROM users WHERE id = 1")
+		m = update(t, m, keyMsg("X"))
+		if m.view != viewList || m.confirmAnalyze == nil {
+			t.Fatalf("view = %d, confirmAnalyze = %v after X, want a confirmation on the list", m.view, m.confirmAnalyze)
+		}
+		if want := "EXPLAIN ANALYZE executes this DELETE. Run it? [y/N]"; !strings.Contains(m.View(), want) {
+			t.Errorf("view does not show %q", want)
+		}
+
+		// Keys other than y cancel, without acting on the key.
+		m = update(t, m, keyMsg("q"))
+		if m.confirmAnalyze != nil || m.view != viewList {
+			t.Errorf("after q: confirmAnalyze = %v, view = %d, want canceled on the list", m.confirmAnalyze, m.view)
+		}
+
+		m = update(t, m, keyMsg("X"))
+		m = update(t, m, keyMsg("y"))
+		if m.confirmAnalyze != nil || m.view != viewExplain || m.explainMode != explain.Analyze ||
+			m.explainQuery != "DELETE FROM users WHERE id = 1" {
+			t.Errorf("after y: view = %d, mode = %v, query = %q, want EXPLAIN ANALYZE of the DELETE",
+				m.view, m.explainMode, m.explainQuery)
+		}
+	})
+
+	t.Run("plan-only EXPLAIN runs directly", func(t *testing.T) {
+		t.Parallel()
+
+		m := newModel(t, "DELETE FROM users WHERE id = 1")
+		m = update(t, m, keyMsg("x"))
+		if m.confirmAnalyze != nil || m.view != viewExplain {
+			t.Errorf("after x: confirmAnalyze = %v, view = %d, want the explain view", m.confirmAnalyze, m.view)
+		}
+	})
+
+	t.Run("read runs directly", func(t *testing.T) {
+		t.Parallel()
+
+		m := newModel(t, "SELECT * FROM users")
+		m = update(t, m, keyMsg("X"))
+		if m.confirmAnalyze != nil || m.view != viewExplain || m.explainMode != explain.Analyze {
+			t.Errorf("after X: confirmAnalyze = %v, view = %d, want EXPLAIN ANALYZE", m.confirmAnalyze, m.view)
+		}
+	})
+
+	t.Run("edited query asks first", func(t *testing.T) {
+		t.Parallel()
+
+		m := newModel(t, "SELECT * FROM users")
+		m = update(t, m, editorResultMsg{query: "UPDATE users SET name = 'x'", mode: explain.Analyze})
+		if m.confirmAnalyze == nil || m.confirmAnalyze.query != "UPDATE users SET name = 'x'" {
+			t.Fatalf("confirmAnalyze = %v after editing, want the UPDATE awaiting confirmation", m.confirmAnalyze)
+		}
+		m = update(t, m, keyMsg("y"))
+		if m.view != viewExplain || m.explainQuery != "UPDATE users SET name = 'x'" {
+			t.Errorf("after y: view = %d, query = %q, want EXPLAIN ANALYZE of the edit", m.view, m.explainQuery)
+		}
+	})
+}
@@ -1,17 +1,17 @@
 package tui
 
 import (
-	"cmp"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mickamy/sql-tap/dump"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
-	"github.com/mickamy/sql-tap/proxy"
 )
 
 type exportFormat int
@@ -19,22 +19,34 @@ type exportFormat int
 const (
 	exportJSON exportFormat = iota
 	exportMarkdown
+	exportCSV
+	exportDump
 )
 
 func (f exportFormat) ext() string {
-	if f == exportMarkdown {
+	switch f {
+	case exportMarkdown:
 		return "md"
+	case exportCSV:
+		return "csv"
+	case exportDump:
+		return dump.Ext
+	case exportJSON:
 	}
 	return "json"
 }
 
 type exportAnalyticsRow struct {
-	Query   string  `json:"query"`
-	Count   int     `json:"count"`
-	TotalMs float64 `json:"total_ms"`
-	AvgMs   float64 `json:"avg_ms"`
-	P95Ms   float64 `json:"p95_ms"`
-	MaxMs   float64 `json:"max_ms"`
+	Query     string  `json:"query"` // normalized query, table name or transaction shape, per grouping
+	Templates int     `json:"templates,omitempty"`
+	Queries   int     `json:"queries,omitempty"` // queries per transaction, when grouped by transaction
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"` // fraction of failed executions, in [0, 1]
+	TotalMs   float64 `json:"total_ms"`
+	AvgMs     float64 `json:"avg_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	MaxMs     float64 `json:"max_ms"`
 }
 
 type exportQuery struct {
@@ -46,6 +58,7 @@ type exportQuery struct {
 	RowsAffected int64    `json:"rows_affected"`
 	Error        string   `json:"error"`
 	TxID         string   `json:"tx_id"`
+	Note         string   `json:"note,omitempty"`
 }
 
 type exportData struct {
@@ -61,75 +74,56 @@ type exportData struct {
 	Analytics []exportAnalyticsRow `json:"analytics"`
 }
 
-// filteredEvents returns the subset of events matching filter and search.
+// filteredEvents returns the completed events matching filter and search.
+// In-flight events are left out since they have no result yet.
 func filteredEvents(
 	events []*tapv1.QueryEvent, filterQuery, searchQuery string,
 ) []*tapv1.QueryEvent {
 	matched := matchingEventsFiltered(events, filterQuery, searchQuery)
 	result := make([]*tapv1.QueryEvent, 0, len(matched))
 	for i, ev := range events {
-		if matched[i] {
+		if matched[i] && !ev.GetInFlight() {
 			result = append(result, ev)
 		}
 	}
 	return result
 }
 
-// buildExportAnalytics aggregates query metrics from the given events.
-func buildExportAnalytics(events []*tapv1.QueryEvent) []exportAnalyticsRow {
-	type agg struct {
-		count     int
-		totalDur  time.Duration
-		durations []time.Duration
-	}
-	groups := make(map[string]*agg)
-	var order []string
-
-	for _, ev := range events {
-		switch proxy.Op(ev.GetOp()) {
-		case proxy.OpBegin, proxy.OpCommit, proxy.OpRollback,
-			proxy.OpBind, proxy.OpPrepare:
-			continue
-		case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
-		}
-		nq := ev.GetNormalizedQuery()
-		if nq == "" {
-			continue
+// buildExportAnalytics aggregates query metrics from the given events, per
+// template, table or transaction shape, sorted by total duration.
+func buildExportAnalytics(events []*tapv1.QueryEvent, group analyticsGroup) []exportAnalyticsRow {
+	agg, queries := aggregateAnalytics(events, group)
+	rows := make([]exportAnalyticsRow, 0, len(agg))
+	for _, r := range agg {
+		row := exportAnalyticsRow{
+			Query:     r.Query,
+			Count:     r.Count,
+			Errors:    r.Errors,
+			ErrorRate: r.ErrorRate(),
+			TotalMs:   durationMs(r.Total),
+			AvgMs:     durationMs(r.Avg),
+			P95Ms:     durationMs(r.P95),
+			MaxMs:     durationMs(r.Max),
 		}
-		dur := ev.GetDuration().AsDuration()
-		g, ok := groups[nq]
-		if !ok {
-			g = &agg{}
-			groups[nq] = g
-			order = append(order, nq)
+		switch group {
+		case analyticsGroupTable:
+			row.Templates = r.Templates
+		case analyticsGroupTx:
+			row.Queries = queries[r.Query]
+		case analyticsGroupTemplate:
 		}
-		g.count++
-		g.totalDur += dur
-		g.durations = append(g.durations, dur)
-	}
-
-	rows := make([]exportAnalyticsRow, 0, len(groups))
-	for _, q := range order {
-		g := groups[q]
-		slices.SortFunc(g.durations, cmp.Compare)
-		totalMs := float64(g.totalDur.Microseconds()) / 1000
-		avgMs := totalMs / float64(g.count)
-		p95Ms := float64(percentile(g.durations, 0.95).Microseconds()) / 1000
-		maxMs := float64(g.durations[len(g.durations)-1].Microseconds()) / 1000
-		rows = append(rows, exportAnalyticsRow{
-			Query:   q,
-			Count:   g.count,
-			TotalMs: totalMs,
-			AvgMs:   avgMs,
-			P95Ms:   p95Ms,
-			MaxMs:   maxMs,
-		})
+		rows = append(rows, row)
 	}
 	return rows
 }
 
+// durationMs converts d to fractional milliseconds at microsecond precision.
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
 func buildExportData(
-	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string,
+	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string, notes map[string]string,
 ) exportData {
 	exported := filteredEvents(allEvents, filterQuery, searchQuery)
 
@@ -169,17 +163,18 @@ func buildExportData(
 			RowsAffected: ev.GetRowsAffected(),
 			Error:        ev.GetError(),
 			TxID:         ev.GetTxId(),
+			Note:         notes[ev.GetId()],
 		})
 	}
 
-	d.Analytics = buildExportAnalytics(exported)
+	d.Analytics = buildExportAnalytics(exported, analyticsGroupTemplate)
 	return d
 }
 
 func renderJSON(
-	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string,
+	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string, notes map[string]string,
 ) (string, error) {
-	d := buildExportData(allEvents, filterQuery, searchQuery)
+	d := buildExportData(allEvents, filterQuery, searchQuery, notes)
 	b, err := json.MarshalIndent(d, "", "  ")
 	if err != nil {
 		return "", fmt.Errorf("marshal export: %w", err)
@@ -188,9 +183,9 @@ func renderJSON(
 }
 
 func renderMarkdown(
-	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string,
+	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string, notes map[string]string,
 ) string {
-	d := buildExportData(allEvents, filterQuery, searchQuery)
+	d := buildExportData(allEvents, filterQuery, searchQuery, notes)
 
 	var sb strings.Builder
 	sb.WriteString("# sql-tap export\n\n")
@@ -227,25 +222,101 @@ func renderMarkdown(
 		)
 	}
 
+	var noted bool
+	for i, q := range d.Queries {
+		if q.Note == "" {
+			continue
+		}
+		if !noted {
+			sb.WriteString("\n## Notes\n\n")
+			noted = true
+		}
+		fmt.Fprintf(&sb, "- #%d: %s\n", i+1, q.Note)
+	}
+
 	if len(d.Analytics) > 0 {
 		sb.WriteString("\n## Analytics\n\n")
-		sb.WriteString("| Query | Count | Avg | P95 | Max | Total |\n")
-		sb.WriteString("|-------|-------|-----|-----|-----|-------|\n")
-		for _, a := range d.Analytics {
-			fmt.Fprintf(&sb, "| %s | %d | %s | %s | %s | %s |\n",
-				escapeMarkdownPipe(a.Query),
-				a.Count,
-				formatDurationMs(a.AvgMs),
-				formatDurationMs(a.P95Ms),
-				formatDurationMs(a.MaxMs),
-				formatDurationMs(a.TotalMs),
-			)
-		}
+		writeMarkdownAnalytics(&sb, d.Analytics, analyticsGroupTemplate)
 	}
 
 	return sb.String()
 }
 
+// writeMarkdownAnalytics writes rows as a markdown table. Rows grouped by
+// table get a Templates column, rows grouped by transaction a Queries column.
+func writeMarkdownAnalytics(sb *strings.Builder, rows []exportAnalyticsRow, group analyticsGroup) {
+	switch group {
+	case analyticsGroupTable:
+		sb.WriteString("| Table | Templates | Count | Errors | Avg | P95 | Max | Total |\n")
+		sb.WriteString("|-------|-----------|-------|--------|-----|-----|-----|-------|\n")
+	case analyticsGroupTx:
+		sb.WriteString("| Transaction | Queries | Count | Errors | Avg | P95 | Max | Total |\n")
+		sb.WriteString("|-------------|---------|-------|--------|-----|-----|-----|-------|\n")
+	case analyticsGroupTemplate:
+		sb.WriteString("| Query | Count | Errors | Avg | P95 | Max | Total |\n")
+		sb.WriteString("|-------|-------|--------|-----|-----|-----|-------|\n")
+	}
+	for _, a := range rows {
+		fmt.Fprintf(sb, "| %s |", escapeMarkdownPipe(a.Query))
+		switch group {
+		case analyticsGroupTable:
+			fmt.Fprintf(sb, " %d |", a.Templates)
+		case analyticsGroupTx:
+			fmt.Fprintf(sb, " %d |", a.Queries)
+		case analyticsGroupTemplate:
+		}
+		fmt.Fprintf(sb, " %d | %d (%.1f%%) | %s | %s | %s | %s |\n",
+			a.Count,
+			a.Errors, a.ErrorRate*100,
+			formatDurationMs(a.AvgMs),
+			formatDurationMs(a.P95Ms),
+			formatDurationMs(a.MaxMs),
+			formatDurationMs(a.TotalMs),
+		)
+	}
+}
+
+// csvHeader is the header row of the CSV export.
+var csvHeader = []string{
+	"time", "op", "duration_ms", "rows_affected", "tx_id", "error", "query", "args", "note",
+}
+
+func renderCSV(
+	allEvents []*tapv1.QueryEvent, filterQuery, searchQuery string, notes map[string]string,
+) (string, error) {
+	d := buildExportData(allEvents, filterQuery, searchQuery, notes)
+
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	if err := w.Write(csvHeader); err != nil {
+		return "", fmt.Errorf("write csv: %w", err)
+	}
+	for _, q := range d.Queries {
+		args, err := json.Marshal(q.Args)
+		if err != nil {
+			return "", fmt.Errorf("marshal args: %w", err)
+		}
+		if err := w.Write([]string{
+			q.Time,
+			q.Op,
+			strconv.FormatFloat(q.DurationMs, 'f', 3, 64),
+			strconv.FormatInt(q.RowsAffected, 10),
+			q.TxID,
+			q.Error,
+			q.Query,
+			string(args),
+			q.Note,
+		}); err != nil {
+			return "", fmt.Errorf("write csv: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", fmt.Errorf("write csv: %w", err)
+	}
+	return sb.String(), nil
+}
+
 func formatDurationMs(ms float64) string {
 	switch {
 	case ms < 1:
@@ -272,35 +343,191 @@ func escapeMarkdownPipe(s string) string {
 	return strings.ReplaceAll(s, "|", "\\|")
 }
 
-// writeExport writes filtered events to a file and returns the path.
-// dir specifies the output directory; if empty, the current directory is used.
+// defaultExportName is the base filename used when no name is configured.
+const defaultExportName = "sql-tap"
+
+// renderDump serializes every completed event, ignoring filters and notes, so
+// the file can be loaded back with sql-tap -load.
+func renderDump(allEvents []*tapv1.QueryEvent) (string, error) {
+	events := make([]dump.Event, 0, len(allEvents))
+	for _, ev := range allEvents {
+		if ev.GetInFlight() {
+			continue
+		}
+		events = append(events, dump.FromProto(ev))
+	}
+	var b strings.Builder
+	if err := dump.Write(&b, events); err != nil {
+		return "", fmt.Errorf("render dump: %w", err)
+	}
+	return b.String(), nil
+}
+
+// writeExport writes filtered events to a file and returns its absolute path.
+// The file is named "<name>-<timestamp>.<ext>" inside dir. An empty dir means
+// the current directory and an empty name means defaultExportName. dir is
+// created if it does not exist.
 func writeExport(
 	allEvents []*tapv1.QueryEvent,
 	filterQuery, searchQuery string,
+	notes map[string]string,
 	format exportFormat,
-	dir string,
+	dir, name string,
 ) (string, error) {
 	var content string
 	var err error
 
 	switch format {
 	case exportJSON:
-		content, err = renderJSON(allEvents, filterQuery, searchQuery)
+		content, err = renderJSON(allEvents, filterQuery, searchQuery, notes)
+		if err != nil {
+			return "", err
+		}
+	case exportMarkdown:
+		content = renderMarkdown(allEvents, filterQuery, searchQuery, notes)
+	case exportCSV:
+		content, err = renderCSV(allEvents, filterQuery, searchQuery, notes)
+		if err != nil {
+			return "", err
+		}
+	case exportDump:
+		content, err = renderDump(allEvents)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if name == "" {
+		name = defaultExportName
+	}
+	return writeExportFile(content, dir, name, format.ext())
+}
+
+// analyticsExportRows aggregates the completed events like the analytics view
+// and returns the rows of view, in its order. view carries the current
+// grouping, analytics search and sort; rows not in view are dropped.
+func analyticsExportRows(
+	allEvents []*tapv1.QueryEvent, view []analyticsRow, group analyticsGroup,
+) []exportAnalyticsRow {
+	built := buildExportAnalytics(filteredEvents(allEvents, "", ""), group)
+	byKey := make(map[string]exportAnalyticsRow, len(built))
+	for _, r := range built {
+		byKey[r.Query] = r
+	}
+	rows := make([]exportAnalyticsRow, 0, len(view))
+	for _, v := range view {
+		if r, ok := byKey[v.query]; ok {
+			rows = append(rows, r)
+		}
+	}
+	return rows
+}
+
+// analyticsCSVHeader returns the header row of the analytics CSV export.
+func analyticsCSVHeader(group analyticsGroup) []string {
+	switch group {
+	case analyticsGroupTable:
+		return []string{
+			"table", "templates", "count", "errors", "error_rate", "avg_ms", "p95_ms", "max_ms", "total_ms",
+		}
+	case analyticsGroupTx:
+		return []string{
+			"transaction", "queries", "count", "errors", "error_rate", "avg_ms", "p95_ms", "max_ms", "total_ms",
+		}
+	case analyticsGroupTemplate:
+	}
+	return []string{"query", "count", "errors", "error_rate", "avg_ms", "p95_ms", "max_ms", "total_ms"}
+}
+
+func renderAnalyticsCSV(rows []exportAnalyticsRow, group analyticsGroup) (string, error) {
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	if err := w.Write(analyticsCSVHeader(group)); err != nil {
+		return "", fmt.Errorf("write csv: %w", err)
+	}
+	ms := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	for _, a := range rows {
+		record := []string{a.Query}
+		switch group {
+		case analyticsGroupTable:
+			record = append(record, strconv.Itoa(a.Templates))
+		case analyticsGroupTx:
+			record = append(record, strconv.Itoa(a.Queries))
+		case analyticsGroupTemplate:
+		}
+		record = append(record,
+			strconv.Itoa(a.Count),
+			strconv.Itoa(a.Errors),
+			strconv.FormatFloat(a.ErrorRate, 'f', 4, 64),
+			ms(a.AvgMs), ms(a.P95Ms), ms(a.MaxMs), ms(a.TotalMs),
+		)
+		if err := w.Write(record); err != nil {
+			return "", fmt.Errorf("write csv: %w", err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", fmt.Errorf("write csv: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func renderAnalyticsMarkdown(rows []exportAnalyticsRow, group analyticsGroup, sortMode analyticsSortMode) string {
+	var sb strings.Builder
+	sb.WriteString("# sql-tap analytics\n\n")
+	fmt.Fprintf(&sb, "- %d %ss, grouped by %s, sorted by %s\n\n", len(rows), group, group, sortMode)
+	writeMarkdownAnalytics(&sb, rows, group)
+	return sb.String()
+}
+
+// writeAnalyticsExport writes analytics rows as CSV or markdown and returns
+// the file's absolute path. Files are named "<name>-analytics-<timestamp>.<ext>"
+// and placed like those of writeExport.
+func writeAnalyticsExport(
+	rows []exportAnalyticsRow,
+	group analyticsGroup,
+	sortMode analyticsSortMode,
+	format exportFormat,
+	dir, name string,
+) (string, error) {
+	var content string
+	switch format {
+	case exportCSV:
+		var err error
+		content, err = renderAnalyticsCSV(rows, group)
 		if err != nil {
 			return "", err
 		}
 	case exportMarkdown:
-		content = renderMarkdown(allEvents, filterQuery, searchQuery)
+		content = renderAnalyticsMarkdown(rows, group, sortMode)
+	case exportJSON, exportDump:
+		return "", fmt.Errorf("analytics export: unsupported format %s", format.ext())
 	}
 
-	filename := fmt.Sprintf("sql-tap-%s.%s",
-		time.Now().Format("20060102-150405"), format.ext())
+	if name == "" {
+		name = defaultExportName
+	}
+	return writeExportFile(content, dir, name+"-analytics", format.ext())
+}
+
+// writeExportFile writes content to "<name>-<timestamp>.<ext>" inside dir,
+// creating dir if needed, and returns the file's absolute path.
+func writeExportFile(content, dir, name, ext string) (string, error) {
+	filename := fmt.Sprintf("%s-%s.%s",
+		name, time.Now().Format("20060102-150405"), ext)
 	if dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return "", fmt.Errorf("create export dir: %w", err)
+		}
 		filename = filepath.Join(dir, filename)
 	}
 
-	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", fmt.Errorf("resolve export path: %w", err)
+	}
+	if err := os.WriteFile(abs, []byte(content), 0o600); err != nil {
 		return "", fmt.Errorf("write export: %w", err)
 	}
-	return filename, nil
+	return abs, nil
 }
@@ -3,6 +3,8 @@ package tui
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -10,18 +12,21 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/mickamy/sql-tap/dump"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 func makeExportEvent(
-	op proxy.Op, query, normalizedQuery string, args []string,
+	op proxy.Op, q, normalizedQuery string, args []string,
 	dur time.Duration, startTime time.Time,
 ) *tapv1.QueryEvent {
 	ev := &tapv1.QueryEvent{
 		Op:              int32(op),
-		Query:           query,
+		Query:           q,
 		NormalizedQuery: normalizedQuery,
+		Verb:            query.Verb(q),
 		Args:            args,
 		StartTime:       timestamppb.New(startTime),
 	}
@@ -56,7 +61,7 @@ func TestRenderMarkdown(t *testing.T) {
 	t.Parallel()
 
 	events := testEvents()
-	md := renderMarkdown(events, "", "")
+	md := renderMarkdown(events, "", "", nil)
 
 	checks := []string{
 		"# sql-tap export",
@@ -68,7 +73,7 @@ func TestRenderMarkdown(t *testing.T) {
 		"['alice@example.com']",
 		"INSERT INTO orders",
 		"## Analytics",
-		"| Query | Count | Avg | P95 | Max | Total |",
+		"| Query | Count | Errors | Avg | P95 | Max | Total |",
 	}
 
 	for _, want := range checks {
@@ -83,7 +88,7 @@ func TestRenderMarkdownFiltered(t *testing.T) {
 	t.Parallel()
 
 	events := testEvents()
-	md := renderMarkdown(events, "op:select", "")
+	md := renderMarkdown(events, "op:select", "", nil)
 
 	if !strings.Contains(md, "- Captured: 3 queries") {
 		t.Error("should show total captured count")
@@ -103,7 +108,7 @@ func TestRenderJSON(t *testing.T) {
 	t.Parallel()
 
 	events := testEvents()
-	out, err := renderJSON(events, "op:select", "users")
+	out, err := renderJSON(events, "op:select", "users", nil)
 	if err != nil {
 		t.Fatalf("renderJSON error: %v", err)
 	}
@@ -137,6 +142,102 @@ func TestRenderJSON(t *testing.T) {
 	}
 }
 
+func TestExportAnalyticsErrors(t *testing.T) {
+	t.Parallel()
+
+	events := testEvents()
+	events[1].Error = "deadlock detected"
+
+	rows := buildExportAnalytics(events, analyticsGroupTemplate)
+	if len(rows) != 2 {
+		t.Fatalf("analytics rows = %d, want 2", len(rows))
+	}
+	if rows[0].Errors != 1 || rows[0].ErrorRate != 0.5 {
+		t.Errorf("errors = %d, rate = %v, want 1, 0.5", rows[0].Errors, rows[0].ErrorRate)
+	}
+	if rows[1].Errors != 0 || rows[1].ErrorRate != 0 {
+		t.Errorf("errors = %d, rate = %v, want 0, 0", rows[1].Errors, rows[1].ErrorRate)
+	}
+
+	md := renderMarkdown(events, "", "", nil)
+	if !strings.Contains(md, "| SELECT id FROM users WHERE email = $1 | 2 | 1 (50.0%) |") {
+		t.Errorf("markdown analytics missing error count:\n%s", md)
+	}
+}
+
+func TestExportNotes(t *testing.T) {
+	t.Parallel()
+
+	events := testEvents()
+	for i, ev := range events {
+		ev.Id = string(rune('1' + i))
+	}
+	notes := map[string]string{"2": "slow one from the cart page"}
+
+	out, err := renderJSON(events, "", "", notes)
+	if err != nil {
+		t.Fatalf("renderJSON error: %v", err)
+	}
+	var d exportData
+	if err := json.Unmarshal([]byte(out), &d); err != nil {
+		t.Fatalf("JSON decode error: %v", err)
+	}
+	if d.Queries[0].Note != "" {
+		t.Errorf("queries[0].note = %q, want empty", d.Queries[0].Note)
+	}
+	if d.Queries[1].Note != "slow one from the cart page" {
+		t.Errorf("queries[1].note = %q, want the note", d.Queries[1].Note)
+	}
+	if strings.Count(out, `"note"`) != 1 {
+		t.Errorf("note key should be omitted for events without a note:\n%s", out)
+	}
+
+	md := renderMarkdown(events, "", "", notes)
+	if !strings.Contains(md, "## Notes\n\n- #2: slow one from the cart page\n") {
+		t.Errorf("markdown missing notes section:\n%s", md)
+	}
+	if md := renderMarkdown(events, "", "", nil); strings.Contains(md, "## Notes") {
+		t.Error("markdown should omit notes section without notes")
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 2, 20, 15, 0, 0, 0, time.Local)
+	events := []*tapv1.QueryEvent{
+		makeExportEvent(proxy.OpQuery,
+			"SELECT id, name FROM users WHERE note = 'a \"quoted\" value'",
+			"SELECT id, name FROM users WHERE note = ?",
+			[]string{"x,y"},
+			1500*time.Microsecond, base),
+		makeExportEvent(proxy.OpExec,
+			"INSERT INTO t VALUES (1)\n",
+			"INSERT INTO t VALUES (?)",
+			nil,
+			2*time.Millisecond, base.Add(time.Second)),
+	}
+	events[1].Error = "duplicate key"
+
+	out, err := renderCSV(events, "", "", nil)
+	if err != nil {
+		t.Fatalf("renderCSV error: %v", err)
+	}
+
+	lines := strings.SplitN(out, "\n", 2)
+	if lines[0] != "time,op,duration_ms,rows_affected,tx_id,error,query,args,note" {
+		t.Errorf("header = %q", lines[0])
+	}
+
+	wantRow := `15:00:00.000,Query,1.500,0,,,"SELECT id, name FROM users WHERE note = 'a ""quoted"" value'","[""x,y""]",`
+	if !strings.Contains(out, wantRow+"\n") {
+		t.Errorf("missing quoted row %q in:\n%s", wantRow, out)
+	}
+	if !strings.Contains(out, "Exec,2.000,0,,duplicate key,\"INSERT INTO t VALUES (1)\n\",[],") {
+		t.Errorf("multi-line query should be quoted:\n%s", out)
+	}
+}
+
 func TestRenderJSONEmptyArgs(t *testing.T) {
 	t.Parallel()
 
@@ -146,7 +247,7 @@ func TestRenderJSONEmptyArgs(t *testing.T) {
 			10*time.Millisecond, base),
 	}
 
-	out, err := renderJSON(events, "", "")
+	out, err := renderJSON(events, "", "", nil)
 	if err != nil {
 		t.Fatalf("renderJSON error: %v", err)
 	}
@@ -172,8 +273,8 @@ func TestWriteExport(t *testing.T) {
 
 	t.Run("markdown", func(t *testing.T) {
 		t.Parallel()
-		path, err := writeExport(events, "", "",
-			exportMarkdown, dir)
+		path, err := writeExport(events, "", "", nil,
+			exportMarkdown, dir, "")
 		if err != nil {
 			t.Fatalf("writeExport error: %v", err)
 		}
@@ -192,8 +293,8 @@ func TestWriteExport(t *testing.T) {
 
 	t.Run("json", func(t *testing.T) {
 		t.Parallel()
-		path, err := writeExport(events, "", "",
-			exportJSON, dir)
+		path, err := writeExport(events, "", "", nil,
+			exportJSON, dir, "")
 		if err != nil {
 			t.Fatalf("writeExport error: %v", err)
 		}
@@ -213,13 +314,96 @@ func TestWriteExport(t *testing.T) {
 			t.Errorf("captured = %d, want 3", d.Captured)
 		}
 	})
+
+	t.Run("dump round trip", func(t *testing.T) {
+		t.Parallel()
+		running := makeExportEvent(proxy.OpQuery, "SELECT pg_sleep(10)", "", nil, 0, time.Now())
+		running.InFlight = true
+		all := append(testEvents(), running)
+
+		// Filters don't apply to dumps: every completed event is written.
+		path, err := writeExport(all, "op:insert", "orders", nil,
+			exportDump, dir, "")
+		if err != nil {
+			t.Fatalf("writeExport error: %v", err)
+		}
+		if !strings.HasSuffix(path, ".tapdump") {
+			t.Errorf("path %q should end with .tapdump", path)
+		}
+
+		f, err := os.Open(path) //nolint:gosec // test file
+		if err != nil {
+			t.Fatalf("open dump: %v", err)
+		}
+		defer func() { _ = f.Close() }()
+		records, err := dump.Read(f)
+		if err != nil {
+			t.Fatalf("read dump: %v", err)
+		}
+		if len(records) != len(events) {
+			t.Fatalf("dump has %d events, want %d", len(records), len(events))
+		}
+		loaded := make([]*tapv1.QueryEvent, len(records))
+		for i, r := range records {
+			ev, err := r.Proto()
+			if err != nil {
+				t.Fatalf("event %d: %v", i, err)
+			}
+			if got, want := dump.FromProto(ev), dump.FromProto(events[i]); !reflect.DeepEqual(got, want) {
+				t.Errorf("event %d:\n got %+v\nwant %+v", i, got, want)
+			}
+			loaded[i] = ev
+		}
+
+		m := New("", Options{Events: loaded})
+		if cmd := m.Init(); cmd != nil {
+			t.Error("offline model should not connect")
+		}
+		if len(m.displayRows) != len(events) {
+			t.Errorf("offline model shows %d rows, want %d", len(m.displayRows), len(events))
+		}
+	})
+
+	t.Run("custom name in missing dir", func(t *testing.T) {
+		t.Parallel()
+		sub := filepath.Join(dir, "reports", "cart")
+		path, err := writeExport(events, "", "", nil,
+			exportCSV, sub, "checkout")
+		if err != nil {
+			t.Fatalf("writeExport error: %v", err)
+		}
+		if !filepath.IsAbs(path) {
+			t.Errorf("path %q should be absolute", path)
+		}
+		if filepath.Dir(path) != sub {
+			t.Errorf("path %q should be inside %q", path, sub)
+		}
+		base := filepath.Base(path)
+		if !strings.HasPrefix(base, "checkout-") || !strings.HasSuffix(base, ".csv") {
+			t.Errorf("filename %q should be checkout-<timestamp>.csv", base)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("stat export: %v", err)
+		}
+	})
+
+	t.Run("dir is a file", func(t *testing.T) {
+		t.Parallel()
+		file := filepath.Join(t.TempDir(), "not-a-dir")
+		if err := os.WriteFile(file, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writeExport(events, "", "", nil, exportJSON, file, ""); err == nil {
+			t.Error("writeExport should fail when dir is a regular file")
+		}
+	})
 }
 
 func TestBuildExportAnalytics(t *testing.T) {
 	t.Parallel()
 
 	events := testEvents()
-	rows := buildExportAnalytics(events)
+	rows := buildExportAnalytics(events, analyticsGroupTemplate)
 
 	if len(rows) != 2 {
 		t.Fatalf("analytics rows = %d, want 2", len(rows))
@@ -249,3 +433,101 @@ func TestEscapeMarkdownPipe(t *testing.T) {
 		t.Errorf("escapeMarkdownPipe = %q, want %q", got, want)
 	}
 }
+
+func TestWriteAnalyticsExport(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 140, 40
+	for _, q := range []string{
+		"SELECT * FROM users WHERE id = ?",
+		"INSERT INTO orders (user_id) VALUES (?)",
+		"SELECT * FROM orders WHERE user_id = ?",
+		"SELECT * FROM orders WHERE user_id = ?",
+	} {
+		ev := makeEvent(proxy.OpExecute, q, time.Millisecond, "")
+		ev.NormalizedQuery = q
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	m = update(t, m, keyMsg("a"))
+	m = update(t, m, keyMsg("s")) // sort by count
+	m.analyticsSearch = "orders"
+	m = m.refreshAnalyticsRows()
+
+	m = update(t, m, keyMsg("w"))
+	if !m.analyticsWriteMode || !m.inputActive() {
+		t.Fatal("w should enter analytics write mode")
+	}
+	m = update(t, m, keyMsg("x"))
+	if m.analyticsWriteMode {
+		t.Fatal("an unknown key should leave analytics write mode")
+	}
+
+	rows := analyticsExportRows(m.events, m.analyticsRows, m.analyticsGroup)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v, want the 2 templates matching the search", rows)
+	}
+	if rows[0].Query != "SELECT * FROM orders WHERE user_id = ?" || rows[0].Count != 2 {
+		t.Errorf("rows[0] = %+v, want the SELECT counted twice first", rows[0])
+	}
+
+	dir := t.TempDir()
+
+	t.Run("csv", func(t *testing.T) {
+		t.Parallel()
+		path, err := writeAnalyticsExport(rows, m.analyticsGroup, m.analyticsSortMode, exportCSV, dir, "run")
+		if err != nil {
+			t.Fatalf("writeAnalyticsExport error: %v", err)
+		}
+		if base := filepath.Base(path); !strings.HasPrefix(base, "run-analytics-") || !strings.HasSuffix(base, ".csv") {
+			t.Errorf("path %q should be run-analytics-<timestamp>.csv", path)
+		}
+		data, err := os.ReadFile(path) //nolint:gosec // test file
+		if err != nil {
+			t.Fatalf("read file error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		want := []string{
+			"query,count,errors,error_rate,avg_ms,p95_ms,max_ms,total_ms",
+			"SELECT * FROM orders WHERE user_id = ?,2,0,0.0000,1.000,1.000,1.000,2.000",
+			"INSERT INTO orders (user_id) VALUES (?),1,0,0.0000,1.000,1.000,1.000,1.000",
+		}
+		if !reflect.DeepEqual(lines, want) {
+			t.Errorf("csv =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+		}
+	})
+
+	t.Run("markdown by table", func(t *testing.T) {
+		t.Parallel()
+		tableRows := buildExportAnalytics(m.events, analyticsGroupTable)
+		path, err := writeAnalyticsExport(tableRows, analyticsGroupTable, m.analyticsSortMode, exportMarkdown, dir, "")
+		if err != nil {
+			t.Fatalf("writeAnalyticsExport error: %v", err)
+		}
+		if !strings.HasSuffix(path, ".md") {
+			t.Errorf("path %q should end with .md", path)
+		}
+		data, err := os.ReadFile(path) //nolint:gosec // test file
+		if err != nil {
+			t.Fatalf("read file error: %v", err)
+		}
+		for _, want := range []string{
+			"# sql-tap analytics",
+			"| Table | Templates | Count | Errors | Avg | P95 | Max | Total |",
+			"| orders | 2 | 3 | 0 (0.0%) |",
+			"| users | 1 | 1 | 0 (0.0%) |",
+		} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("markdown should contain %q, got:\n%s", want, data)
+			}
+		}
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		t.Parallel()
+		if _, err := writeAnalyticsExport(rows, m.analyticsGroup, m.analyticsSortMode, exportJSON, dir, ""); err == nil {
+			t.Error("JSON analytics export should fail")
+		}
+	})
+}
@@ -2,11 +2,13 @@ package tui
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 type filterKind int
@@ -18,6 +20,11 @@ const (
 	filterOp                         // op:select, op:begin, etc.
 	filterNPlus1                     // "n+1" or "nplus1" keyword
 	filterSlow                       // "slow" keyword
+	filterScan                       // "scan" keyword
+	filterReadOnly                   // "readonly" or "ro" keyword
+	filterBatch                      // batch>100, batch<5
+	filterStmtKind                   // kind:read, kind:write, kind:ddl, kind:other
+	filterTx                         // tx:<id prefix>
 )
 
 type durationOp int
@@ -27,8 +34,16 @@ const (
 	durLT                   // <
 )
 
+type countOp int
+
+const (
+	countGT countOp = iota // >
+	countLT                // <
+)
+
 type filterCondition struct {
-	kind filterKind
+	kind   filterKind
+	negate bool // "-" or "!" prefix: match events that do NOT satisfy the condition
 
 	// filterText
 	text string
@@ -39,10 +54,22 @@ type filterCondition struct {
 
 	// filterOp — matched against proxy.Op name or SQL keyword prefix
 	opPattern string
+
+	// filterBatch — compared with batchOp against the INSERT batch size
+	batchOp    countOp
+	batchValue int
+
+	// filterStmtKind
+	stmtKind query.Kind
+
+	// filterTx — matched against the start of the transaction ID
+	txPrefix string
 }
 
 var reDuration = regexp.MustCompile(`^d([><])(\d+(?:\.\d+)?)(us|µs|ms|s|m)$`)
 
+var reBatch = regexp.MustCompile(`^batch([><])(\d+)$`)
+
 // sqlOpKeywords maps SQL keyword prefixes to proxy.Op values for op:select style filters.
 var sqlOpKeywords = map[string][]proxy.Op{
 	"select": {proxy.OpQuery, proxy.OpExec, proxy.OpExecute},
@@ -63,41 +90,97 @@ var protocolOps = map[string]proxy.Op{
 	"rollback": proxy.OpRollback,
 }
 
-func parseFilter(input string) []filterCondition {
-	tokens := strings.Fields(input)
-	conds := make([]filterCondition, 0, len(tokens))
+// filterExpr is a parsed filter expression: groups of AND-ed conditions that are OR-ed together.
+type filterExpr [][]filterCondition
 
-	for _, tok := range tokens {
-		if c, ok := parseDuration(tok); ok {
-			conds = append(conds, c)
-			continue
+// parseFilterExpr parses input into condition groups separated by the OR keyword.
+// Tokens within a group are combined with AND. Empty groups are dropped.
+func parseFilterExpr(input string) filterExpr {
+	var expr filterExpr
+	var group []string
+	flush := func() {
+		if len(group) > 0 {
+			expr = append(expr, parseTokens(group))
+			group = nil
 		}
-		lower := strings.ToLower(tok)
-		if lower == "error" {
-			conds = append(conds, filterCondition{kind: filterError})
-			continue
-		}
-		if lower == "n+1" || lower == "nplus1" {
-			conds = append(conds, filterCondition{kind: filterNPlus1})
+	}
+	for _, tok := range strings.Fields(input) {
+		if strings.EqualFold(tok, "or") {
+			flush()
 			continue
 		}
-		if lower == "slow" {
-			conds = append(conds, filterCondition{kind: filterSlow})
-			continue
+		group = append(group, tok)
+	}
+	flush()
+	return expr
+}
+
+// matches reports whether ev satisfies any of the condition groups.
+// An empty expression matches every event.
+func (e filterExpr) matches(ev *tapv1.QueryEvent) bool {
+	if len(e) == 0 {
+		return true
+	}
+	for _, conds := range e {
+		if matchAllConditions(ev, conds) {
+			return true
 		}
-		if c, ok := parseOp(lower); ok {
-			conds = append(conds, c)
-			continue
+	}
+	return false
+}
+
+func parseTokens(tokens []string) []filterCondition {
+	conds := make([]filterCondition, 0, len(tokens))
+
+	for _, tok := range tokens {
+		negate := false
+		if len(tok) > 1 && (tok[0] == '-' || tok[0] == '!') {
+			negate = true
+			tok = tok[1:]
 		}
-		// Fallback: plain text match.
-		conds = append(conds, filterCondition{
-			kind: filterText,
-			text: lower,
-		})
+		c := parseToken(tok)
+		c.negate = negate
+		conds = append(conds, c)
 	}
 	return conds
 }
 
+func parseToken(tok string) filterCondition {
+	if c, ok := parseDuration(tok); ok {
+		return c
+	}
+	lower := strings.ToLower(tok)
+	if c, ok := parseBatch(lower); ok {
+		return c
+	}
+	switch lower {
+	case "error":
+		return filterCondition{kind: filterError}
+	case "n+1", "nplus1":
+		return filterCondition{kind: filterNPlus1}
+	case "slow":
+		return filterCondition{kind: filterSlow}
+	case "scan":
+		return filterCondition{kind: filterScan}
+	case "readonly", "ro":
+		return filterCondition{kind: filterReadOnly}
+	}
+	if c, ok := parseOp(lower); ok {
+		return c
+	}
+	if c, ok := parseStmtKind(lower); ok {
+		return c
+	}
+	if prefix, ok := strings.CutPrefix(lower, "tx:"); ok && prefix != "" {
+		return filterCondition{kind: filterTx, txPrefix: prefix}
+	}
+	// Fallback: plain text match.
+	return filterCondition{
+		kind: filterText,
+		text: lower,
+	}
+}
+
 func parseDuration(tok string) (filterCondition, bool) {
 	m := reDuration.FindStringSubmatch(tok)
 	if m == nil {
@@ -121,6 +204,26 @@ func parseDuration(tok string) (filterCondition, bool) {
 	}, true
 }
 
+func parseBatch(lower string) (filterCondition, bool) {
+	m := reBatch.FindStringSubmatch(lower)
+	if m == nil {
+		return filterCondition{}, false
+	}
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return filterCondition{}, false
+	}
+	op := countGT
+	if m[1] == "<" {
+		op = countLT
+	}
+	return filterCondition{
+		kind:       filterBatch,
+		batchOp:    op,
+		batchValue: n,
+	}, true
+}
+
 func unitSuffix(unit string) string {
 	switch unit {
 	case "us", "µs":
@@ -149,7 +252,26 @@ func parseOp(lower string) (filterCondition, bool) {
 	}, true
 }
 
+func parseStmtKind(lower string) (filterCondition, bool) {
+	name, ok := strings.CutPrefix(lower, "kind:")
+	if !ok {
+		return filterCondition{}, false
+	}
+	k, ok := query.ParseKind(name)
+	if !ok {
+		return filterCondition{}, false
+	}
+	return filterCondition{
+		kind:     filterStmtKind,
+		stmtKind: k,
+	}, true
+}
+
 func (c filterCondition) matchesEvent(ev *tapv1.QueryEvent) bool {
+	return c.matchesKind(ev) != c.negate
+}
+
+func (c filterCondition) matchesKind(ev *tapv1.QueryEvent) bool {
 	switch c.kind {
 	case filterText:
 		return strings.Contains(strings.ToLower(ev.GetQuery()), c.text)
@@ -171,21 +293,73 @@ func (c filterCondition) matchesEvent(ev *tapv1.QueryEvent) bool {
 		return ev.GetNPlus_1()
 	case filterSlow:
 		return ev.GetSlowQuery()
+	case filterScan:
+		return ev.GetFullScan()
+	case filterReadOnly:
+		return ev.GetReadOnly()
+	case filterBatch:
+		// Only multi-row INSERTs have a batch size; other statements never match.
+		n := int(ev.GetBatchSize())
+		if n == 0 {
+			return false
+		}
+		switch c.batchOp {
+		case countGT:
+			return n > c.batchValue
+		case countLT:
+			return n < c.batchValue
+		}
 	case filterOp:
 		return matchOp(ev, c.opPattern)
+	case filterStmtKind:
+		return eventKind(ev) == c.stmtKind
+	case filterTx:
+		return ev.GetTxId() != "" && strings.HasPrefix(strings.ToLower(ev.GetTxId()), c.txPrefix)
 	}
 	return false
 }
 
+// eventKind returns the statement kind of ev, classifying the query itself
+// for events from a daemon that does not report one.
+func eventKind(ev *tapv1.QueryEvent) query.Kind {
+	if k := query.Kind(ev.GetKind()); k != query.KindOther {
+		return k
+	}
+	return query.Classify(ev.GetQuery())
+}
+
+// eventVerb returns the verb of ev's statement, extracting it from the query
+// itself for events from a daemon that does not report one.
+func eventVerb(ev *tapv1.QueryEvent) string {
+	if v := ev.GetVerb(); v != "" {
+		return v
+	}
+	return query.Verb(ev.GetQuery())
+}
+
 func matchOp(ev *tapv1.QueryEvent, pattern string) bool {
 	// Check protocol-level op match (begin, commit, rollback, query, exec, etc.)
 	if op, ok := protocolOps[pattern]; ok {
 		return proxy.Op(ev.GetOp()) == op
 	}
-	// Check SQL keyword prefix match (select, insert, update, delete).
+	// Check detector flags (op:nplus1, op:slow, op:scan) as an alternative to the bare keywords.
+	switch pattern {
+	case "n+1", "nplus1":
+		return ev.GetNPlus_1()
+	case "slow":
+		return ev.GetSlowQuery()
+	case "scan":
+		return ev.GetFullScan()
+	}
+	// SET and RESET statements that change session variables.
+	if pattern == "set" {
+		return query.IsSet(ev.GetQuery())
+	}
+	// Check the statement's verb (select, insert, update, delete), looking
+	// past leading comments and parentheses and through WITH to the main
+	// statement.
 	if _, ok := sqlOpKeywords[pattern]; ok {
-		q := strings.TrimSpace(strings.ToLower(ev.GetQuery()))
-		return strings.HasPrefix(q, pattern)
+		return eventVerb(ev) == pattern
 	}
 	return false
 }
@@ -200,32 +374,59 @@ func matchAllConditions(ev *tapv1.QueryEvent, conds []filterCondition) bool {
 }
 
 func describeFilter(input string) string {
-	conds := parseFilter(input)
-	if len(conds) == 0 {
+	expr := parseFilterExpr(input)
+	if len(expr) == 0 {
 		return input
 	}
-	var parts []string
-	for _, c := range conds {
-		switch c.kind {
-		case filterText:
-			parts = append(parts, "text:"+c.text)
-		case filterDuration:
-			op := ">"
-			if c.durOp == durLT {
-				op = "<"
-			}
-			parts = append(parts, "d"+op+c.durValue.String())
-		case filterError:
-			parts = append(parts, "error")
-		case filterNPlus1:
-			parts = append(parts, "n+1")
-		case filterSlow:
-			parts = append(parts, "slow")
-		case filterOp:
-			parts = append(parts, "op:"+c.opPattern)
+	groups := make([]string, 0, len(expr))
+	for _, conds := range expr {
+		parts := make([]string, 0, len(conds))
+		for _, c := range conds {
+			parts = append(parts, c.describe())
 		}
+		groups = append(groups, strings.Join(parts, " "))
+	}
+	return strings.Join(groups, " OR ")
+}
+
+func (c filterCondition) describe() string {
+	var s string
+	switch c.kind {
+	case filterText:
+		s = "text:" + c.text
+	case filterDuration:
+		op := ">"
+		if c.durOp == durLT {
+			op = "<"
+		}
+		s = "d" + op + c.durValue.String()
+	case filterError:
+		s = "error"
+	case filterNPlus1:
+		s = "n+1"
+	case filterSlow:
+		s = "slow"
+	case filterScan:
+		s = "scan"
+	case filterReadOnly:
+		s = "readonly"
+	case filterBatch:
+		op := ">"
+		if c.batchOp == countLT {
+			op = "<"
+		}
+		s = "batch" + op + strconv.Itoa(c.batchValue)
+	case filterOp:
+		s = "op:" + c.opPattern
+	case filterStmtKind:
+		s = "kind:" + c.stmtKind.String()
+	case filterTx:
+		s = "tx:" + c.txPrefix
+	}
+	if c.negate {
+		s = "-" + s
 	}
-	return strings.Join(parts, " ")
+	return s
 }
 
 // wrapFooterItems arranges items into lines that fit within the given width.
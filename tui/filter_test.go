@@ -1,6 +1,7 @@
 package tui //nolint:testpackage // testing internal filter parsing logic
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -8,9 +9,10 @@ import (
 
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
-func TestParseFilter(t *testing.T) {
+func TestParseTokens(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
@@ -79,6 +81,20 @@ func TestParseFilter(t *testing.T) {
 				{kind: filterOp, opPattern: "begin"},
 			},
 		},
+		{
+			name:  "op:nplus1",
+			input: "op:nplus1",
+			want: []filterCondition{
+				{kind: filterOp, opPattern: "nplus1"},
+			},
+		},
+		{
+			name:  "op:slow",
+			input: "OP:SLOW",
+			want: []filterCondition{
+				{kind: filterOp, opPattern: "slow"},
+			},
+		},
 		{
 			name:  "n+1 keyword",
 			input: "n+1",
@@ -100,6 +116,55 @@ func TestParseFilter(t *testing.T) {
 				{kind: filterSlow},
 			},
 		},
+		{
+			name:  "scan keyword",
+			input: "scan",
+			want: []filterCondition{
+				{kind: filterScan},
+			},
+		},
+		{
+			name:  "op:scan",
+			input: "op:scan",
+			want: []filterCondition{
+				{kind: filterOp, opPattern: "scan"},
+			},
+		},
+		{
+			name:  "readonly keyword",
+			input: "readonly",
+			want: []filterCondition{
+				{kind: filterReadOnly},
+			},
+		},
+		{
+			name:  "ro alias",
+			input: "RO",
+			want: []filterCondition{
+				{kind: filterReadOnly},
+			},
+		},
+		{
+			name:  "batch greater than",
+			input: "batch>100",
+			want: []filterCondition{
+				{kind: filterBatch, batchOp: countGT, batchValue: 100},
+			},
+		},
+		{
+			name:  "batch less than",
+			input: "Batch<2",
+			want: []filterCondition{
+				{kind: filterBatch, batchOp: countLT, batchValue: 2},
+			},
+		},
+		{
+			name:  "batch without number is text",
+			input: "batch>",
+			want: []filterCondition{
+				{kind: filterText, text: "batch>"},
+			},
+		},
 		{
 			name:  "combined filter",
 			input: "op:select d>100ms",
@@ -116,14 +181,78 @@ func TestParseFilter(t *testing.T) {
 				{kind: filterText, text: "id"},
 			},
 		},
+		{
+			name:  "negated text with dash",
+			input: "op:select -users",
+			want: []filterCondition{
+				{kind: filterOp, opPattern: "select"},
+				{kind: filterText, text: "users", negate: true},
+			},
+		},
+		{
+			name:  "negated keyword with bang",
+			input: "!error",
+			want: []filterCondition{
+				{kind: filterError, negate: true},
+			},
+		},
+		{
+			name:  "negated duration",
+			input: "-d>1s",
+			want: []filterCondition{
+				{kind: filterDuration, durOp: durGT, durValue: time.Second, negate: true},
+			},
+		},
+		{
+			name:  "negated op",
+			input: "!op:begin",
+			want: []filterCondition{
+				{kind: filterOp, opPattern: "begin", negate: true},
+			},
+		},
+		{
+			name:  "kind",
+			input: "kind:Write",
+			want: []filterCondition{
+				{kind: filterStmtKind, stmtKind: query.KindWrite},
+			},
+		},
+		{
+			name:  "unknown kind is text",
+			input: "kind:select",
+			want: []filterCondition{
+				{kind: filterText, text: "kind:select"},
+			},
+		},
+		{
+			name:  "tx prefix",
+			input: "tx:3F2A",
+			want: []filterCondition{
+				{kind: filterTx, txPrefix: "3f2a"},
+			},
+		},
+		{
+			name:  "empty tx prefix is text",
+			input: "tx:",
+			want: []filterCondition{
+				{kind: filterText, text: "tx:"},
+			},
+		},
+		{
+			name:  "lone dash is text",
+			input: "-",
+			want: []filterCondition{
+				{kind: filterText, text: "-"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got := parseFilter(tt.input)
+			got := parseTokens(strings.Fields(tt.input))
 			if len(got) != len(tt.want) {
-				t.Fatalf("parseFilter(%q) returned %d conditions, want %d", tt.input, len(got), len(tt.want))
+				t.Fatalf("parseTokens(%q) returned %d conditions, want %d", tt.input, len(got), len(tt.want))
 			}
 			for i, g := range got {
 				w := tt.want[i]
@@ -139,9 +268,136 @@ func TestParseFilter(t *testing.T) {
 				if g.durValue != w.durValue {
 					t.Errorf("cond[%d].durValue = %v, want %v", i, g.durValue, w.durValue)
 				}
+				if g.batchOp != w.batchOp {
+					t.Errorf("cond[%d].batchOp = %d, want %d", i, g.batchOp, w.batchOp)
+				}
+				if g.batchValue != w.batchValue {
+					t.Errorf("cond[%d].batchValue = %d, want %d", i, g.batchValue, w.batchValue)
+				}
 				if g.opPattern != w.opPattern {
 					t.Errorf("cond[%d].opPattern = %q, want %q", i, g.opPattern, w.opPattern)
 				}
+				if g.stmtKind != w.stmtKind {
+					t.Errorf("cond[%d].stmtKind = %v, want %v", i, g.stmtKind, w.stmtKind)
+				}
+				if g.txPrefix != w.txPrefix {
+					t.Errorf("cond[%d].txPrefix = %q, want %q", i, g.txPrefix, w.txPrefix)
+				}
+				if g.negate != w.negate {
+					t.Errorf("cond[%d].negate = %v, want %v", i, g.negate, w.negate)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilterExpr(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		want  filterExpr
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "single group",
+			input: "op:select d>100ms",
+			want: filterExpr{{
+				{kind: filterOp, opPattern: "select"},
+				{kind: filterDuration, durOp: durGT, durValue: 100 * time.Millisecond},
+			}},
+		},
+		{
+			name:  "or splits groups",
+			input: "error OR d>1s",
+			want: filterExpr{
+				{{kind: filterError}},
+				{{kind: filterDuration, durOp: durGT, durValue: time.Second}},
+			},
+		},
+		{
+			name:  "lowercase or",
+			input: "slow or n+1",
+			want: filterExpr{
+				{{kind: filterSlow}},
+				{{kind: filterNPlus1}},
+			},
+		},
+		{
+			name:  "and binds tighter than or",
+			input: "op:select -users OR op:insert",
+			want: filterExpr{
+				{
+					{kind: filterOp, opPattern: "select"},
+					{kind: filterText, text: "users", negate: true},
+				},
+				{{kind: filterOp, opPattern: "insert"}},
+			},
+		},
+		{
+			name:  "dangling or is ignored",
+			input: "OR error OR OR",
+			want:  filterExpr{{{kind: filterError}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := parseFilterExpr(tt.input)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseFilterExpr(%q) returned %d groups, want %d", tt.input, len(got), len(tt.want))
+			}
+			for gi, group := range got {
+				if len(group) != len(tt.want[gi]) {
+					t.Fatalf("group[%d] has %d conditions, want %d", gi, len(group), len(tt.want[gi]))
+				}
+				for i, g := range group {
+					if g != tt.want[gi][i] {
+						t.Errorf("group[%d] cond[%d] = %+v, want %+v", gi, i, g, tt.want[gi][i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFilterExprMatches(t *testing.T) {
+	t.Parallel()
+
+	selectUsers := makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, "")
+	selectOrders := makeEvent(proxy.OpQuery, "SELECT id FROM orders", 5*time.Millisecond, "")
+	slowInsert := makeEvent(proxy.OpExec, "INSERT INTO orders (id) VALUES (1)", 2*time.Second, "")
+	failed := makeEvent(proxy.OpQuery, "SELECT * FROM missing", time.Millisecond, "relation does not exist")
+
+	tests := []struct {
+		name  string
+		input string
+		ev    *tapv1.QueryEvent
+		want  bool
+	}{
+		{"empty matches all", "", selectUsers, true},
+		{"negated text excludes", "op:select -users", selectUsers, false},
+		{"negated text keeps others", "op:select -users", selectOrders, true},
+		{"bang negation", "!op:select", slowInsert, true},
+		{"negated error", "-error", failed, false},
+		{"or first branch", "error OR d>1s", failed, true},
+		{"or second branch", "error OR d>1s", slowInsert, true},
+		{"or no branch", "error OR d>1s", selectUsers, false},
+		{"or with negation", "-op:select OR users", selectUsers, true},
+		{"or with negation no match", "-op:select OR users", selectOrders, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := parseFilterExpr(tt.input).matches(tt.ev); got != tt.want {
+				t.Errorf("parseFilterExpr(%q).matches() = %v, want %v", tt.input, got, tt.want)
 			}
 		})
 	}
@@ -242,12 +498,76 @@ func TestMatchesEvent(t *testing.T) {
 			ev:   makeEvent(proxy.OpCommit, "", 0, ""),
 			want: false,
 		},
+		{
+			name: "op:set match",
+			cond: filterCondition{kind: filterOp, opPattern: "set"},
+			ev:   makeEvent(proxy.OpQuery, "SET search_path TO app", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:set match reset",
+			cond: filterCondition{kind: filterOp, opPattern: "set"},
+			ev:   makeEvent(proxy.OpExec, "RESET ALL", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:set no match",
+			cond: filterCondition{kind: filterOp, opPattern: "set"},
+			ev:   makeEvent(proxy.OpQuery, "SELECT settings FROM t", time.Millisecond, ""),
+			want: false,
+		},
 		{
 			name: "op:insert match",
 			cond: filterCondition{kind: filterOp, opPattern: "insert"},
 			ev:   makeEvent(proxy.OpQuery, "INSERT INTO users (name) VALUES ('alice')", 5*time.Millisecond, ""),
 			want: true,
 		},
+		{
+			name: "op:select match CTE",
+			cond: filterCondition{kind: filterOp, opPattern: "select"},
+			ev:   makeEvent(proxy.OpQuery, "WITH active AS (SELECT id FROM users) SELECT * FROM active", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:insert match CTE",
+			cond: filterCondition{kind: filterOp, opPattern: "insert"},
+			ev:   makeEvent(proxy.OpQuery, "WITH src AS (SELECT * FROM staging) INSERT INTO t SELECT * FROM src", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:select no match CTE insert",
+			cond: filterCondition{kind: filterOp, opPattern: "select"},
+			ev:   makeEvent(proxy.OpQuery, "WITH src AS (SELECT * FROM staging) INSERT INTO t SELECT * FROM src", time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "op:select match hinted",
+			cond: filterCondition{kind: filterOp, opPattern: "select"},
+			ev:   makeEvent(proxy.OpQuery, "/*+ IndexScan(users) */ SELECT * FROM users", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:update match line comment",
+			cond: filterCondition{kind: filterOp, opPattern: "update"},
+			ev:   makeEvent(proxy.OpExec, "-- controller=users\n  UPDATE users SET name = 'a'", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:select match parenthesized",
+			cond: filterCondition{kind: filterOp, opPattern: "select"},
+			ev:   makeEvent(proxy.OpQuery, "(SELECT id FROM a) UNION (SELECT id FROM b)", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "op:delete match reported verb",
+			cond: filterCondition{kind: filterOp, opPattern: "delete"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpExecute, "EXECUTE purge_sessions", time.Millisecond, "")
+				ev.Verb = "delete"
+				return ev
+			}(),
+			want: true,
+		},
 		{
 			name: "n+1 match",
 			cond: filterCondition{kind: filterNPlus1},
@@ -280,6 +600,193 @@ func TestMatchesEvent(t *testing.T) {
 			ev:   makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, ""),
 			want: false,
 		},
+		{
+			name: "op:nplus1 match",
+			cond: filterCondition{kind: filterOp, opPattern: "nplus1"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpExecute, "SELECT id FROM users WHERE id = $1", 5*time.Millisecond, "")
+				ev.NPlus_1 = true
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "op:nplus1 no match",
+			cond: filterCondition{kind: filterOp, opPattern: "nplus1"},
+			ev:   makeEvent(proxy.OpExecute, "SELECT id FROM users WHERE id = $1", 5*time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "op:slow match",
+			cond: filterCondition{kind: filterOp, opPattern: "slow"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT id FROM users", 500*time.Millisecond, "")
+				ev.SlowQuery = true
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "op:slow no match",
+			cond: filterCondition{kind: filterOp, opPattern: "slow"},
+			ev:   makeEvent(proxy.OpQuery, "SELECT id FROM users", 500*time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "scan match",
+			cond: filterCondition{kind: filterScan},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT id FROM users", 500*time.Millisecond, "")
+				ev.SlowQuery = true
+				ev.FullScan = true
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "op:scan match",
+			cond: filterCondition{kind: filterOp, opPattern: "scan"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT id FROM users", 500*time.Millisecond, "")
+				ev.FullScan = true
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "op:scan no match",
+			cond: filterCondition{kind: filterOp, opPattern: "scan"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT id FROM users", 500*time.Millisecond, "")
+				ev.SlowQuery = true
+				return ev
+			}(),
+			want: false,
+		},
+		{
+			name: "readonly match",
+			cond: filterCondition{kind: filterReadOnly},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, "")
+				ev.ReadOnly = true
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "readonly no match",
+			cond: filterCondition{kind: filterReadOnly},
+			ev:   makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "batch greater than match",
+			cond: filterCondition{kind: filterBatch, batchOp: countGT, batchValue: 100},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpExec, "INSERT INTO t VALUES (?), (?)", 5*time.Millisecond, "")
+				ev.BatchSize = 500
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "batch greater than no match",
+			cond: filterCondition{kind: filterBatch, batchOp: countGT, batchValue: 100},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpExec, "INSERT INTO t VALUES (?), (?)", 5*time.Millisecond, "")
+				ev.BatchSize = 2
+				return ev
+			}(),
+			want: false,
+		},
+		{
+			name: "batch less than match",
+			cond: filterCondition{kind: filterBatch, batchOp: countLT, batchValue: 2},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpExec, "INSERT INTO t VALUES (?)", 5*time.Millisecond, "")
+				ev.BatchSize = 1
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "batch less than skips non-insert",
+			cond: filterCondition{kind: filterBatch, batchOp: countLT, batchValue: 2},
+			ev:   makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "negated text match",
+			cond: filterCondition{kind: filterText, text: "orders", negate: true},
+			ev:   makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "negated text no match",
+			cond: filterCondition{kind: filterText, text: "users", negate: true},
+			ev:   makeEvent(proxy.OpQuery, "SELECT id FROM users", 5*time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "kind:write match",
+			cond: filterCondition{kind: filterStmtKind, stmtKind: query.KindWrite},
+			ev:   makeEvent(proxy.OpQuery, "/* job */ WITH d AS (DELETE FROM t RETURNING id) SELECT id FROM d", time.Millisecond, ""),
+			want: true,
+		},
+		{
+			name: "kind:write no match",
+			cond: filterCondition{kind: filterStmtKind, stmtKind: query.KindWrite},
+			ev:   makeEvent(proxy.OpQuery, "EXPLAIN DELETE FROM t", time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "kind:ddl uses reported kind",
+			cond: filterCondition{kind: filterStmtKind, stmtKind: query.KindDDL},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "", time.Millisecond, "")
+				ev.Kind = int32(query.KindDDL)
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "kind:other match",
+			cond: filterCondition{kind: filterStmtKind, stmtKind: query.KindOther},
+			ev:   makeEvent(proxy.OpBegin, "BEGIN", 0, ""),
+			want: true,
+		},
+		{
+			name: "tx prefix match",
+			cond: filterCondition{kind: filterTx, txPrefix: "3f2a"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")
+				ev.TxId = "3f2a9c1e-0b7d-4c55-9e0a-5d1f7a2b8c41"
+				return ev
+			}(),
+			want: true,
+		},
+		{
+			name: "tx prefix no match",
+			cond: filterCondition{kind: filterTx, txPrefix: "3f2b"},
+			ev: func() *tapv1.QueryEvent {
+				ev := makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")
+				ev.TxId = "3f2a9c1e-0b7d-4c55-9e0a-5d1f7a2b8c41"
+				return ev
+			}(),
+			want: false,
+		},
+		{
+			name: "tx prefix outside transaction",
+			cond: filterCondition{kind: filterTx, txPrefix: "3f2a"},
+			ev:   makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, ""),
+			want: false,
+		},
+		{
+			name: "negated duration without duration",
+			cond: filterCondition{kind: filterDuration, durOp: durGT, durValue: time.Second, negate: true},
+			ev:   makeEvent(proxy.OpBegin, "BEGIN", 0, ""),
+			want: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -419,11 +926,41 @@ func TestDescribeFilter(t *testing.T) {
 			input: "slow",
 			want:  "slow",
 		},
+		{
+			name:  "readonly alias",
+			input: "ro",
+			want:  "readonly",
+		},
+		{
+			name:  "batch",
+			input: "batch>100",
+			want:  "batch>100",
+		},
+		{
+			name:  "kind",
+			input: "-kind:read",
+			want:  "-kind:read",
+		},
+		{
+			name:  "tx prefix",
+			input: "tx:3f2a error",
+			want:  "tx:3f2a error",
+		},
 		{
 			name:  "text fallback",
 			input: "users",
 			want:  "text:users",
 		},
+		{
+			name:  "negation",
+			input: "op:select !users",
+			want:  "op:select -text:users",
+		},
+		{
+			name:  "or groups",
+			input: "error or d>1s",
+			want:  "error OR d>1s",
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,8 +1,6 @@
 package tui
 
 import (
-	"fmt"
-	"regexp"
 	"strings"
 	"time"
 
@@ -11,7 +9,10 @@ import (
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/mickamy/sql-tap/eventfmt"
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
+	"github.com/mickamy/sql-tap/query"
 )
 
 func formatTimeFull(t *timestamppb.Timestamp) string {
@@ -25,6 +26,19 @@ func opString(op int32) string {
 	return proxy.Op(op).String()
 }
 
+// eventOpLabel returns the op shown for ev. SET and RESET statements are
+// labeled "Set" so session changes stand out from ordinary queries.
+func eventOpLabel(ev *tapv1.QueryEvent) string {
+	switch proxy.Op(ev.GetOp()) {
+	case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
+		if query.IsSet(ev.GetQuery()) {
+			return "Set"
+		}
+	case proxy.OpPrepare, proxy.OpBind, proxy.OpBegin, proxy.OpCommit, proxy.OpRollback:
+	}
+	return opString(ev.GetOp())
+}
+
 func padRight(s string, width int) string {
 	w := lipgloss.Width(s)
 	if w >= width {
@@ -41,17 +55,8 @@ func padLeft(s string, width int) string {
 	return strings.Repeat(" ", width-w) + s
 }
 
-var reSpaces = regexp.MustCompile(`\s+`)
-
 func truncate(s string, maxLen int) string {
-	s = strings.TrimSpace(reSpaces.ReplaceAllString(s, " "))
-	if len(s) <= maxLen {
-		return s
-	}
-	if maxLen <= 1 {
-		return s[:maxLen]
-	}
-	return s[:maxLen-1] + "…"
+	return eventfmt.Truncate(s, maxLen)
 }
 
 func formatDuration(d *durationpb.Duration) string {
@@ -62,15 +67,7 @@ func formatDuration(d *durationpb.Duration) string {
 }
 
 func formatDurationValue(dur time.Duration) string {
-	switch {
-	case dur < time.Millisecond:
-		us := float64(dur.Microseconds())
-		return fmt.Sprintf("%.0fµs", us)
-	case dur < time.Second:
-		ms := float64(dur.Microseconds()) / 1000
-		return fmt.Sprintf("%.1fms", ms)
-	}
-	return fmt.Sprintf("%.2fs", dur.Seconds())
+	return eventfmt.Duration(dur)
 }
 
 func formatTime(t *timestamppb.Timestamp) string {
@@ -0,0 +1,163 @@
+package tui
+
+import (
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+// heatGlyphs are the strip glyphs by increasing density of flagged events.
+var heatGlyphs = []string{"░", "▒", "▓", "█"}
+
+// heatBucket aggregates the events captured during one slice of the capture.
+type heatBucket struct {
+	errors  int  // events with an error
+	flagged int  // events with an error, slow or N+1 flag
+	inView  bool // the bucket holds an event of the visible list rows
+}
+
+// isHeatFlagged reports whether ev counts towards the heat of its bucket.
+func isHeatFlagged(ev *tapv1.QueryEvent) bool {
+	if ev.GetInFlight() {
+		return false
+	}
+	return ev.GetError() != "" || ev.GetSlowQuery() || ev.GetNPlus_1()
+}
+
+// heatBucketOf returns a function mapping an event index to one of n buckets
+// that split the time range of the whole capture evenly. When every event
+// has the same start time, events are split by position instead.
+func (m Model) heatBucketOf(n int) func(idx int) int {
+	var first, last time.Time
+	for i, ev := range m.events {
+		t := ev.GetStartTime().AsTime()
+		if i == 0 || t.Before(first) {
+			first = t
+		}
+		if i == 0 || t.After(last) {
+			last = t
+		}
+	}
+	span := last.Sub(first)
+	if span <= 0 {
+		total := max(len(m.events), 1)
+		return func(idx int) int { return min(idx*n/total, n-1) }
+	}
+	return func(idx int) int {
+		off := m.events[idx].GetStartTime().AsTime().Sub(first)
+		return min(int(float64(off)/float64(span)*float64(n)), n-1)
+	}
+}
+
+// rowEventIndices returns the event indices covered by display row dr.
+func rowEventIndices(dr displayRow) []int {
+	if dr.kind == rowTxSummary || dr.kind == rowRepeat {
+		return dr.events
+	}
+	return []int{dr.eventIdx}
+}
+
+// heatBuckets aggregates the capture into n buckets and marks those holding
+// an event of display rows [start, end).
+func (m Model) heatBuckets(n, start, end int) []heatBucket {
+	buckets := make([]heatBucket, n)
+	bucketOf := m.heatBucketOf(n)
+	for i, ev := range m.events {
+		if !isHeatFlagged(ev) {
+			continue
+		}
+		b := &buckets[bucketOf(i)]
+		b.flagged++
+		if ev.GetError() != "" {
+			b.errors++
+		}
+	}
+	for _, dr := range m.displayRows[start:end] {
+		for _, idx := range rowEventIndices(dr) {
+			buckets[bucketOf(idx)].inView = true
+		}
+	}
+	return buckets
+}
+
+// showHeatStrip reports whether the heat strip is drawn beside a list of
+// dataRows rows: only when the list does not fit and the terminal leaves
+// room right of the list box.
+func (m Model) showHeatStrip(dataRows int) bool {
+	return len(m.displayRows) > dataRows && m.width-4 >= 20
+}
+
+// renderHeatStrip returns one strip cell per bucket. Buckets with flagged
+// events are shaded by density relative to the hottest bucket, red when any
+// of their events failed and yellow otherwise; the buckets of the visible
+// rows are highlighted.
+func renderHeatStrip(buckets []heatBucket) []string {
+	hottest := 0
+	for _, b := range buckets {
+		hottest = max(hottest, b.flagged)
+	}
+
+	cells := make([]string, len(buckets))
+	for i, b := range buckets {
+		style := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+		glyph := "│"
+		if b.inView {
+			style = style.Foreground(lipgloss.Color("7")).Background(lipgloss.Color("238"))
+			glyph = "┃"
+		}
+		if b.flagged > 0 {
+			level := (b.flagged*len(heatGlyphs) - 1) / hottest
+			glyph = heatGlyphs[level]
+			style = style.Foreground(lipgloss.Color("3"))
+			if b.errors > 0 {
+				style = style.Foreground(lipgloss.Color("1"))
+			}
+		}
+		cells[i] = style.Render(glyph)
+	}
+	return cells
+}
+
+// heatStripRows returns the number of strip buckets of the current layout.
+func (m Model) heatStripRows() int {
+	return max(m.listHeight()-1, 1)
+}
+
+// jumpHeat moves the cursor to the first flagged event of the nearest heat
+// strip bucket after (step > 0) or before (step < 0) the cursor's bucket.
+func (m Model) jumpHeat(step int) Model {
+	if m.cursor < 0 || m.cursor >= len(m.displayRows) {
+		return m
+	}
+	n := m.heatStripRows()
+	bucketOf := m.heatBucketOf(n)
+	buckets := m.heatBuckets(n, 0, 0)
+
+	idx := rowEventIndices(m.displayRows[m.cursor])
+	if len(idx) == 0 {
+		return m
+	}
+	target := -1
+	for b := bucketOf(idx[0]) + step; b >= 0 && b < n; b += step {
+		if buckets[b].flagged > 0 {
+			target = b
+			break
+		}
+	}
+	if target < 0 {
+		return m
+	}
+
+	for row, dr := range m.displayRows {
+		for _, i := range rowEventIndices(dr) {
+			if bucketOf(i) == target && isHeatFlagged(m.events[i]) {
+				m.cursor = row
+				m.follow = row == len(m.displayRows)-1
+				return m
+			}
+		}
+	}
+	return m
+}
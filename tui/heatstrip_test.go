@@ -0,0 +1,108 @@
+package tui //nolint:testpackage // testing internal model state
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/x/ansi"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// heatModel returns a model holding 100 queries one second apart, of which
+// #20 is slow and #95-#99 failed.
+func heatModel(t *testing.T) Model {
+	t.Helper()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 100, 30
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 100 {
+		errMsg := ""
+		if i >= 95 {
+			errMsg = "boom"
+		}
+		ev := makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, errMsg)
+		ev.StartTime = timestamppb.New(base.Add(time.Duration(i) * time.Second))
+		ev.SlowQuery = i == 20
+		m = update(t, m, eventMsg{Event: ev})
+	}
+	return m
+}
+
+func TestHeatBuckets(t *testing.T) {
+	t.Parallel()
+
+	m := heatModel(t)
+	buckets := m.heatBuckets(10, 0, 5)
+	for i, b := range buckets {
+		var want heatBucket
+		switch i {
+		case 0:
+			want = heatBucket{inView: true}
+		case 2:
+			want = heatBucket{flagged: 1}
+		case 9:
+			want = heatBucket{errors: 5, flagged: 5}
+		}
+		if b != want {
+			t.Errorf("bucket %d = %+v, want %+v", i, b, want)
+		}
+	}
+
+	cells := renderHeatStrip(buckets)
+	if got := ansi.Strip(cells[9]); got != "█" {
+		t.Errorf("hottest cell = %q, want █", got)
+	}
+	if got := ansi.Strip(cells[2]); got != "░" {
+		t.Errorf("slow cell = %q, want ░", got)
+	}
+	if got := ansi.Strip(cells[0]); got != "┃" {
+		t.Errorf("in-view cell = %q, want ┃", got)
+	}
+}
+
+func TestHeatStripRender(t *testing.T) {
+	t.Parallel()
+
+	m := heatModel(t)
+	lines := strings.Split(ansi.Strip(m.renderList(20)), "\n")
+	if !strings.HasSuffix(lines[len(lines)-2], " █") {
+		t.Errorf("last data row = %q, want the error hot spot at the end of the strip", lines[len(lines)-2])
+	}
+
+	m.events = m.events[:5]
+	m = m.rebuild()
+	for _, l := range strings.Split(ansi.Strip(m.renderList(20)), "\n") {
+		if strings.ContainsAny(l, "┃│█") && !strings.HasPrefix(l, "│") {
+			t.Errorf("heat strip drawn for a list that fits: %q", l)
+		}
+	}
+}
+
+func TestHeatJump(t *testing.T) {
+	t.Parallel()
+
+	m := heatModel(t)
+	m = update(t, m, keyMsg("g"))
+	m = update(t, m, keyMsg("g"))
+
+	m = update(t, m, keyMsg("}"))
+	if m.cursor != 20 {
+		t.Fatalf("cursor = %d after }, want the slow query at 20", m.cursor)
+	}
+	m = update(t, m, keyMsg("}"))
+	if m.cursor != 95 {
+		t.Fatalf("cursor = %d after second }, want the first error at 95", m.cursor)
+	}
+	m = update(t, m, keyMsg("}"))
+	if m.cursor != 95 {
+		t.Errorf("cursor = %d after } past the last hot spot, want unchanged", m.cursor)
+	}
+	m = update(t, m, keyMsg("{"))
+	if m.cursor != 20 {
+		t.Errorf("cursor = %d after {, want 20", m.cursor)
+	}
+}
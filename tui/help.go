@@ -0,0 +1,241 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+// keyBinding describes a key (or key group) in one view. footer is the short
+// label shown in that view's footer; bindings without one are listed only in
+// the help overlay.
+type keyBinding struct {
+	keys   string
+	desc   string
+	footer string
+}
+
+// helpSection groups the bindings of one view.
+type helpSection struct {
+	title    string
+	view     viewMode
+	bindings []keyBinding
+}
+
+// helpSections is the single source of truth for keybindings. Both the
+// footers and the help overlay are generated from it.
+var helpSections = []helpSection{
+	{
+		title: "List",
+		view:  viewList,
+		bindings: []keyBinding{
+			{"q", "Quit", "quit"},
+			{"j/k", "Move down / up", "navigate"},
+			{"ctrl+d/u", "Half-page down / up", ""},
+			{"gg/G", "Jump to top / bottom (follow)", "top/bottom"},
+			{"F", "Toggle follow (pinned while on)", "follow"},
+			{"NG", "Jump to row N", ""},
+			{"{/}", "Jump to previous / next heat strip hot spot", ""},
+			{"space", "Expand / collapse transaction", "toggle tx"},
+			{"enter", "Inspect query / transaction", "inspect"},
+			{"a", "Analytics view", "analytics"},
+			{"t", "Timeline view", "timeline"},
+			{"tab", "Next view (shift+tab: previous)", "next view"},
+			{"c/C", "Copy query / with bound args", "copy"},
+			{"y/Y", "Copy all filtered queries / with args", ""},
+			{"x/X", "EXPLAIN / EXPLAIN ANALYZE", "explain"},
+			{"e/E", "Edit query, then EXPLAIN / ANALYZE", "edit+explain"},
+			{"/", "Incremental text search", "search"},
+			{"f", "Structured filter", "filter"},
+			{"esc", "Clear search / filter", ""},
+			{"T", "Toggle transaction context for filters", "tx context"},
+			{"z", "Collapse repeated queries (N+1) into a count", "repeats"},
+			{"s", "Cycle sort (chronological / duration / rows / op)", "sort"},
+			{"R", "Toggle rows-affected column for writes", ""},
+			{">/<", "Widen query column (hide Duration / Time) / restore", ""},
+			{"A", "Add / edit a note", "note"},
+			{"m/M", "Pin query / show pinned only", "pin/pinned only"},
+			{"w", "Export queries (JSON / MD / CSV / tapdump)", "write"},
+			{"p", "Pause / resume the live stream", "pause"},
+			{"ctrl+l", "Clear captured queries", "clear"},
+			{"?", "Show this help", "help"},
+		},
+	},
+	{
+		title: "Inspector",
+		view:  viewInspect,
+		bindings: []keyBinding{
+			{"q", "Back to list", "back"},
+			{"j/k", "Scroll down / up", "scroll"},
+			{"c", "Copy query", "copy query"},
+			{"C", "Copy query with bound args", "copy with args"},
+			{"r", "Copy as psql / mysql command with bound args", ""},
+			{"x/X", "EXPLAIN / EXPLAIN ANALYZE", "explain/analyze"},
+			{"e/E", "Edit, then EXPLAIN / ANALYZE", "edit+explain"},
+			{"n/N", "Next / previous event of the same template", "same template"},
+		},
+	},
+	{
+		title: "Analytics",
+		view:  viewAnalytics,
+		bindings: []keyBinding{
+			{"q", "Back to list", "back"},
+			{"j/k", "Move down / up", "scroll"},
+			{"ctrl+d/u", "Half-page down / up", ""},
+			{"h/l", "Scroll left / right", "pan"},
+			{"s", "Cycle sort", "sort"},
+			{"g", "Group by template / table / transaction", "group"},
+			{"/", "Search templates or tables", "search"},
+			{"esc", "Clear search", ""},
+			{"c", "Copy query", "copy"},
+			{"w", "Export the table as shown (CSV / MD)", "write"},
+			{"tab", "Next view (shift+tab: previous)", "next view"},
+		},
+	},
+	{
+		title: "Timeline",
+		view:  viewTimeline,
+		bindings: []keyBinding{
+			{"q", "Back to list", "back"},
+			{"j/k", "Scroll down / up", "scroll"},
+			{"ctrl+d/u", "Half-page down / up", "page"},
+			{"tab", "Next view (shift+tab: previous)", "next view"},
+		},
+	},
+	{
+		title: "Explain",
+		view:  viewExplain,
+		bindings: []keyBinding{
+			{"q", "Back to list", "back"},
+			{"j/k/h/l", "Scroll", "scroll"},
+			{"c", "Copy explain plan", "copy"},
+			{"e/E", "Edit and re-explain / re-analyze", "edit+explain"},
+			{"d", "Diff against the plan before the edit", "diff"},
+		},
+	},
+}
+
+// footerItems returns the "key: label" footer entries for v.
+func footerItems(v viewMode) []string {
+	var items []string
+	for _, s := range helpSections {
+		if s.view != v {
+			continue
+		}
+		for _, b := range s.bindings {
+			if b.footer != "" {
+				items = append(items, b.keys+": "+b.footer)
+			}
+		}
+	}
+	return items
+}
+
+// borderHelp returns the footer for v formatted for a box's bottom border.
+func borderHelp(v viewMode) string {
+	return " " + strings.Join(footerItems(v), "  ") + " "
+}
+
+// serverInfoMsg carries the daemon's answer to ServerInfo.
+type serverInfoMsg struct{ info *tapv1.ServerInfoResponse }
+
+// enterHelp opens the help overlay and refreshes the server info shown in it,
+// which changes once a client connects through sql-tapd.
+func (m Model) enterHelp() (Model, tea.Cmd) {
+	m.prevView = m.view
+	m.view = viewHelp
+	return m, fetchServerInfo(m.client)
+}
+
+// serverInfoTimeout bounds the wait for sql-tapd's answer to ServerInfo.
+const serverInfoTimeout = 5 * time.Second
+
+// fetchServerInfo asks sql-tapd for the upstream server info. Errors, e.g.
+// from a daemon predating the RPC, leave the previous info in place.
+func fetchServerInfo(client tapv1.TapServiceClient) tea.Cmd {
+	if client == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), serverInfoTimeout)
+		defer cancel()
+		resp, err := client.ServerInfo(ctx, &tapv1.ServerInfoRequest{})
+		if err != nil {
+			return nil
+		}
+		return serverInfoMsg{info: resp}
+	}
+}
+
+// serverInfoLine describes the upstream server, e.g.
+// "Server: postgres 16.2 · TLS: off · compression: off".
+func serverInfoLine(info *tapv1.ServerInfoResponse) string {
+	onOff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	}
+	version := info.GetVersion()
+	if version == "" {
+		version = "(version known once a client connects)"
+	}
+	return "Server: " + info.GetDriver() + " " + version +
+		" · TLS: " + onOff(info.GetTls()) +
+		" · compression: " + onOff(info.GetCompression())
+}
+
+// updateHelp closes the overlay on any key and returns to the previous view.
+func (m Model) updateHelp(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.String() == "ctrl+c" {
+		if m.conn != nil {
+			_ = m.conn.Close()
+		}
+		return m, tea.Quit
+	}
+	m.view = m.prevView
+	return m, nil
+}
+
+func (m Model) renderHelp() string {
+	keyStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true)
+	titleStyle := lipgloss.NewStyle().Bold(true).Underline(true)
+
+	sections := make([]string, 0, len(helpSections))
+	for _, s := range helpSections {
+		width := 0
+		for _, b := range s.bindings {
+			width = max(width, len([]rune(b.keys)))
+		}
+		lines := []string{titleStyle.Render(s.title)}
+		for _, b := range s.bindings {
+			pad := strings.Repeat(" ", width-len([]rune(b.keys)))
+			lines = append(lines, keyStyle.Render(b.keys)+pad+"  "+b.desc)
+		}
+		sections = append(sections, strings.Join(lines, "\n"))
+	}
+
+	// The list section is the longest; put the other views beside it when
+	// the terminal is wide enough.
+	body := strings.Join(sections, "\n\n")
+	side := strings.Join(sections[1:], "\n\n")
+	if lipgloss.Width(sections[0])+lipgloss.Width(side)+12 <= m.width {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, sections[0], "    ", side)
+	}
+	if m.serverInfo != nil {
+		body += "\n\n" + serverInfoLine(m.serverInfo)
+	}
+	body += "\n\n" + lipgloss.NewStyle().Faint(true).Render("press any key to close")
+
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(lipgloss.Color("6")).
+		Padding(0, 2).
+		Render(body)
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+const (
+	// minHistogramRuns is the number of runs of a template from which the
+	// inspector shows their duration histogram.
+	minHistogramRuns = 5
+	// histogramBuckets is the number of buckets of the histogram.
+	histogramBuckets = 8
+	// maxHistogramBar is the width of the longest histogram bar.
+	maxHistogramBar = 30
+)
+
+// durationHistogram counts durations in buckets whose bounds grow
+// geometrically from the shortest to the longest duration, so that a long
+// tail does not squash the common case into one bucket.
+type durationHistogram struct {
+	lo     time.Duration // lower bound of the first bucket
+	ratio  float64       // upper bound / lower bound of each bucket
+	counts []int
+}
+
+// newDurationHistogram buckets sorted into at most n buckets. All durations
+// fall into one bucket when they are equal.
+func newDurationHistogram(sorted []time.Duration, n int) durationHistogram {
+	if len(sorted) == 0 {
+		return durationHistogram{}
+	}
+	// Sub-microsecond durations share the first bucket, which keeps the
+	// ratio finite for zero durations.
+	lo := max(sorted[0], time.Microsecond)
+	hi := max(sorted[len(sorted)-1], lo)
+	h := durationHistogram{lo: lo, ratio: 1, counts: make([]int, 1)}
+	if hi > lo && n > 1 {
+		h.ratio = math.Pow(float64(hi)/float64(lo), 1/float64(n))
+		h.counts = make([]int, n)
+	}
+	for _, d := range sorted {
+		h.counts[h.bucket(d)]++
+	}
+	return h
+}
+
+// bucket returns the index of the bucket d falls into, clamped to the
+// histogram.
+func (h durationHistogram) bucket(d time.Duration) int {
+	if len(h.counts) <= 1 || d <= h.lo {
+		return 0
+	}
+	i := int(math.Log(float64(d)/float64(h.lo)) / math.Log(h.ratio))
+	return min(i, len(h.counts)-1)
+}
+
+// lower returns the lower bound of bucket i.
+func (h durationHistogram) lower(i int) time.Duration {
+	return time.Duration(float64(h.lo) * math.Pow(h.ratio, float64(i)))
+}
+
+// histogramLines profiles the template of ev for the inspector: the min,
+// median, p95 and max of its runs' durations and their histogram, with the
+// bucket of ev marked. Templates with fewer than minHistogramRuns runs get
+// none.
+func (m Model) histogramLines(ev *tapv1.QueryEvent) []string {
+	if ev.GetNormalizedQuery() == "" || ev.GetInFlight() || ev.GetDuration() == nil {
+		return nil
+	}
+	durations := m.templateDurations(ev.GetNormalizedQuery())
+	if len(durations) < minHistogramRuns {
+		return nil
+	}
+
+	lines := []string{
+		fmt.Sprintf("Profile:  %d runs of this template", len(durations)),
+		fmt.Sprintf("  min %s  p50 %s  p95 %s  max %s",
+			formatDurationValue(durations[0]),
+			formatDurationValue(percentile(durations, 0.5)),
+			formatDurationValue(percentile(durations, 0.95)),
+			formatDurationValue(durations[len(durations)-1])),
+	}
+
+	h := newDurationHistogram(durations, histogramBuckets)
+	peak := 0
+	for _, c := range h.counts {
+		peak = max(peak, c)
+	}
+	this := h.bucket(ev.GetDuration().AsDuration())
+	for i, c := range h.counts {
+		bar := strings.Repeat("█", (c*maxHistogramBar+peak-1)/peak)
+		line := fmt.Sprintf("  ≥%8s %-*s %d", formatDurationValue(h.lower(i)), maxHistogramBar, bar, c)
+		if i == this {
+			line += "  ◀ this run"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
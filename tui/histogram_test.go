@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func ms(n float64) time.Duration {
+	return time.Duration(n * float64(time.Millisecond))
+}
+
+func TestDurationHistogram(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		durs   []time.Duration
+		n      int
+		counts []int
+		lower  []time.Duration
+	}{
+		{
+			name:   "empty",
+			durs:   nil,
+			n:      4,
+			counts: nil,
+		},
+		{
+			name:   "all equal",
+			durs:   []time.Duration{ms(2), ms(2), ms(2)},
+			n:      4,
+			counts: []int{3},
+			lower:  []time.Duration{ms(2)},
+		},
+		{
+			// Bounds 1ms, 10ms, 100ms, 1s: each decade is a bucket.
+			name:   "geometric",
+			durs:   []time.Duration{ms(1), ms(2), ms(9), ms(10), ms(50), ms(150), ms(999), ms(10000)},
+			n:      4,
+			counts: []int{3, 2, 2, 1},
+			lower:  []time.Duration{ms(1), ms(10), ms(100), ms(1000)},
+		},
+		{
+			name:   "zero durations share the first bucket",
+			durs:   []time.Duration{0, 0, time.Microsecond, 4 * time.Microsecond},
+			n:      2,
+			counts: []int{3, 1},
+			lower:  []time.Duration{time.Microsecond, 2 * time.Microsecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newDurationHistogram(tt.durs, tt.n)
+			if !slices.Equal(h.counts, tt.counts) {
+				t.Errorf("counts = %v, want %v", h.counts, tt.counts)
+			}
+			for i, want := range tt.lower {
+				// Bounds come from floating-point powers.
+				if got := h.lower(i); (got - want).Abs() > time.Microsecond/1000 {
+					t.Errorf("lower(%d) = %s, want %s", i, got, want)
+				}
+			}
+			if len(tt.durs) > 0 {
+				if got := h.bucket(tt.durs[len(tt.durs)-1]); got != len(tt.counts)-1 {
+					t.Errorf("bucket(max) = %d, want the last bucket %d", got, len(tt.counts)-1)
+				}
+			}
+		})
+	}
+}
+
+func TestInspectorHistogram(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 60
+	const nq = "SELECT * FROM users WHERE id = ?"
+	for _, d := range []float64{1, 1, 1, 1, 2, 3, 80} {
+		m = update(t, m, eventMsg{Event: &tapv1.QueryEvent{
+			Op: int32(proxy.OpQuery), Query: "SELECT * FROM users WHERE id = 1", NormalizedQuery: nq,
+			Duration: durationpb.New(ms(d)),
+		}})
+	}
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+
+	m.cursor = len(m.displayRows) - 2 // the 80ms run
+	out := strings.Join(m.inspectLines(), "\n")
+	for _, want := range []string{
+		"Profile:  7 runs of this template",
+		"min 1.0ms  p50 1.0ms  p95 3.0ms  max 80.0ms",
+		"  ◀ this run",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("inspector lines do not contain %q:\n%s", want, out)
+		}
+	}
+	if lines := strings.Split(out, "\n"); !strings.HasSuffix(lines[len(lines)-1], "1  ◀ this run") {
+		t.Errorf("last line = %q, want the last bucket, holding this run only, marked", lines[len(lines)-1])
+	}
+
+	// Templates with few runs get no profile.
+	m.cursor = len(m.displayRows) - 1
+	if out := strings.Join(m.inspectLines(), "\n"); strings.Contains(out, "Profile:") {
+		t.Errorf("inspector lines of a single run contain a profile:\n%s", out)
+	}
+}
@@ -0,0 +1,83 @@
+package tui
+
+import (
+	"strconv"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/protobuf/proto"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+// spinnerFrames animate the duration column of statements still running.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = 100 * time.Millisecond
+
+// spinnerTickMsg advances the spinner while in-flight events are shown.
+type spinnerTickMsg struct{}
+
+func spinnerTick() tea.Cmd {
+	return tea.Tick(spinnerInterval, func(time.Time) tea.Msg { return spinnerTickMsg{} })
+}
+
+// inFlightKey identifies a statement across its provisional and completed events.
+// Dumps from older sql-tapd versions carry IDs that are only unique per
+// connection, so the start time disambiguates them.
+func inFlightKey(ev *tapv1.QueryEvent) string {
+	return ev.GetId() + "@" + strconv.FormatInt(ev.GetStartTime().AsTime().UnixNano(), 10)
+}
+
+// addEvent records ev. A provisional in-flight event is appended and
+// remembered; the completed event replaces it in place, as does an update of
+// an event, which is dropped if that event is no longer held. It reports
+// whether a new event was appended.
+func (m Model) addEvent(ev *tapv1.QueryEvent) (Model, bool) {
+	key := inFlightKey(ev)
+	if ev.GetUpdate() {
+		for i := len(m.events) - 1; i >= 0; i-- {
+			if inFlightKey(m.events[i]) == key {
+				ev = proto.CloneOf(ev)
+				ev.Update = false
+				m.events[i] = ev
+				break
+			}
+		}
+		return m, false
+	}
+	if idx, ok := m.inFlight[key]; ok {
+		m.events[idx] = ev
+		if !ev.GetInFlight() {
+			delete(m.inFlight, key)
+		}
+		return m.recordRate(ev), false
+	}
+	if ev.GetInFlight() {
+		m.inFlight[key] = len(m.events)
+	}
+	m.events = append(m.events, ev)
+	return m.recordRate(ev), true
+}
+
+// eventDuration formats the duration of ev, or a spinner with the elapsed
+// time if it is still running.
+func (m Model) eventDuration(ev *tapv1.QueryEvent) string {
+	if !ev.GetInFlight() {
+		return formatDuration(ev.GetDuration())
+	}
+	frame := spinnerFrames[m.spinnerFrame%len(spinnerFrames)]
+	return frame + " " + formatDurationValue(time.Since(ev.GetStartTime().AsTime()))
+}
+
+// abandonInFlight stops tracking in-flight events whose completion can no
+// longer arrive, e.g. after the stream dropped. They are kept without a duration.
+func (m Model) abandonInFlight() Model {
+	for key, idx := range m.inFlight {
+		ev := proto.CloneOf(m.events[idx])
+		ev.InFlight = false
+		m.events[idx] = ev
+		delete(m.inFlight, key)
+	}
+	return m
+}
@@ -2,13 +2,17 @@ package tui
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 
 	"github.com/mickamy/sql-tap/explain"
 	"github.com/mickamy/sql-tap/highlight"
+	"github.com/mickamy/sql-tap/query"
 )
 
 func (m Model) updateInspect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
@@ -21,7 +25,7 @@ func (m Model) updateInspect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "q":
 		m.view = viewList
 		m = m.rebuild()
-		if m.follow {
+		if m.following() {
 			m.cursor = max(len(m.displayRows)-1, 0)
 		}
 		return m, nil
@@ -31,6 +35,8 @@ func (m Model) updateInspect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.startExplain(explain.Analyze)
 	case "c", "C":
 		return m.copyQuery(msg.String() == "C")
+	case "r":
+		return m.copyCommand()
 	case "e":
 		return m.startEditExplain(explain.Explain)
 	case "E":
@@ -46,10 +52,72 @@ func (m Model) updateInspect(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.inspectScroll--
 		}
 		return m, nil
+	case "n":
+		return m.jumpTemplate(1)
+	case "N":
+		return m.jumpTemplate(-1)
 	}
 	return m, nil
 }
 
+// jumpTemplate inspects the next (step > 0) or previous (step < 0) event, in
+// capture order, with the normalized query of the inspected event, expanding
+// the transaction or repeat group that hides it. Events the filter hides are
+// skipped.
+func (m Model) jumpTemplate(step int) (tea.Model, tea.Cmd) {
+	ev := m.cursorEvent()
+	if ev == nil || ev.GetNormalizedQuery() == "" {
+		return m, nil
+	}
+	nq := ev.GetNormalizedQuery()
+	for i := m.displayRows[m.cursor].eventIdx + step; i >= 0 && i < len(m.events); i += step {
+		if m.events[i].GetNormalizedQuery() != nq {
+			continue
+		}
+		if next, ok := m.revealEvent(i); ok {
+			next.inspectScroll = 0
+			return next, nil
+		}
+	}
+	if step > 0 {
+		return m.showAlert("no later event of this template")
+	}
+	return m.showAlert("no earlier event of this template")
+}
+
+// revealEvent moves the cursor to the row of the event at idx, expanding the
+// transaction and repeat group it is collapsed into. It reports false, leaving
+// m as is, if the event is not listed. The expansions are made on a copy of
+// m.collapsed, so a failed search leaves the caller's groups untouched.
+func (m Model) revealEvent(idx int) (Model, bool) {
+	m.collapsed = maps.Clone(m.collapsed)
+	for {
+		expanded := false
+		for row, dr := range m.displayRows {
+			if dr.kind == rowEvent && dr.eventIdx == idx {
+				m.cursor = row
+				m.follow = row == len(m.displayRows)-1
+				return m, true
+			}
+			if !slices.Contains(dr.events, idx) {
+				continue
+			}
+			switch {
+			case dr.kind == rowTxSummary && m.collapsed[dr.txID]:
+				m.collapsed[dr.txID] = false
+				expanded = true
+			case dr.kind == rowRepeat && m.repeatCollapsed(dr.group):
+				m.collapsed[dr.group] = false
+				expanded = true
+			}
+		}
+		if !expanded {
+			return m, false
+		}
+		m = m.rebuild()
+	}
+}
+
 func (m Model) inspectLines() []string {
 	if m.cursor < 0 || m.cursor >= len(m.displayRows) {
 		return nil
@@ -60,7 +128,9 @@ func (m Model) inspectLines() []string {
 	case rowTxSummary:
 		return m.inspectorTxLines(dr, innerWidth)
 	case rowEvent:
-		return m.inspectorEventLines(dr)
+		return m.inspectorEventLines(dr, innerWidth)
+	case rowRepeat:
+		return m.inspectorRepeatLines(dr, innerWidth)
 	}
 	return nil
 }
@@ -110,7 +180,7 @@ func (m Model) renderInspector() string {
 	// Replace bottom border with help
 	if n := len(boxLines); n > 0 {
 		borderFg := lipgloss.NewStyle().Foreground(borderColor)
-		help := " q: back  j/k: scroll  c: copy query  C: copy with args  x/X: explain/analyze  e/E: edit+explain "
+		help := borderHelp(viewInspect)
 		dashes := max(innerWidth-len([]rune(help)), 0)
 		boxLines[n-1] = borderFg.Render("╰") +
 			lipgloss.NewStyle().Faint(true).Render(help) +
@@ -121,8 +191,8 @@ func (m Model) renderInspector() string {
 }
 
 func (m Model) inspectorTxLines(dr displayRow, innerWidth int) []string {
-	nq := m.txQueryCount(dr.events)
-	dur := m.txWallDuration(dr.events)
+	nq := txQueryCount(m.events, dr.events)
+	dur := txWallDuration(m.events, dr.events)
 
 	lines := make([]string, 0, 7+len(dr.events))
 	lines = append(lines, "Type:     Transaction")
@@ -132,6 +202,10 @@ func (m Model) inspectorTxLines(dr displayRow, innerWidth int) []string {
 		label = "1 query"
 	}
 	lines = append(lines, "Queries:  "+label)
+	if txFailed(m.events, dr.events) {
+		lines = append(lines, "Status:   failed, its changes are rolled back")
+	}
+	lines = append(lines, m.txDupLines(dr.txID)...)
 	lines = append(lines, "Duration: "+formatDurationValue(dur))
 	lines = append(lines, "Time:     "+formatTimeFull(m.events[dr.events[0]].GetStartTime()))
 	lines = append(lines, "Tx:       "+dr.txID)
@@ -140,51 +214,129 @@ func (m Model) inspectorTxLines(dr displayRow, innerWidth int) []string {
 	lines = append(lines, "Events:")
 	for _, idx := range dr.events {
 		ev := m.events[idx]
-		op := opString(ev.GetOp())
+		op := eventOpLabel(ev)
 		q := truncate(ev.GetQuery(), max(innerWidth-24, 20))
 		if q == "" {
 			q = "-"
 		}
 		q = highlight.SQL(q)
-		dur := formatDuration(ev.GetDuration())
+		dur := m.eventDuration(ev)
 		lines = append(lines, fmt.Sprintf("  %-8s %s %s", op, q, dur))
 	}
 
 	return lines
 }
 
-func (m Model) inspectorEventLines(dr displayRow) []string {
+func (m Model) inspectorEventLines(dr displayRow, innerWidth int) []string {
 	ev := m.events[dr.eventIdx]
 
 	var lines []string
-	lines = append(lines, "Op:       "+opString(ev.GetOp()))
+	lines = append(lines, "Op:       "+eventOpLabel(ev))
 
 	if q := ev.GetQuery(); q != "" {
 		lines = append(lines, "Query:")
 		for l := range strings.SplitSeq(q, "\n") {
-			lines = append(lines, "  "+highlight.SQL(strings.TrimSpace(l)))
+			lines = append(lines, "  "+m.searchHighlightSQL(strings.TrimSpace(l)))
 		}
 	}
 
+	if ev.GetQuery() != "" {
+		lines = append(lines, "Kind:     "+eventKind(ev).String())
+	}
+
 	if len(ev.GetArgs()) > 0 {
 		lines = append(lines,
 			fmt.Sprintf("Args:     [%s]", strings.Join(ev.GetArgs(), ", ")))
+		lines = append(lines, "Bound:")
+		lines = append(lines, boundLines(ev.GetQuery(), ev.GetArgs(), innerWidth)...)
 	}
 
-	lines = append(lines, "Duration: "+formatDuration(ev.GetDuration()))
+	lines = append(lines, "Duration: "+m.eventDuration(ev))
 	lines = append(lines, "Time:     "+formatTimeFull(ev.GetStartTime()))
 
 	if ev.GetRowsAffected() > 0 {
 		lines = append(lines, fmt.Sprintf("Rows:     %d", ev.GetRowsAffected()))
 	}
 
+	if ev.GetResultColumns() > 0 {
+		lines = append(lines, fmt.Sprintf("Columns:  %d", ev.GetResultColumns()))
+	}
+
+	if ev.GetCopyBytes() > 0 {
+		lines = append(lines, fmt.Sprintf("Copied:   %d bytes", ev.GetCopyBytes()))
+	}
+
 	if ev.GetError() != "" {
 		lines = append(lines, "Error:    "+ev.GetError())
 	}
 
+	if n := ev.GetWarnings(); n > 0 {
+		label := "warnings"
+		if n == 1 {
+			label = "warning"
+		}
+		lines = append(lines, fmt.Sprintf("Warnings: %d %s", n, label))
+	}
+
 	if ev.GetTxId() != "" {
 		lines = append(lines, "Tx:       "+ev.GetTxId())
 	}
 
+	if session := ev.GetSession(); len(session) > 0 {
+		lines = append(lines, "Session:")
+		for _, name := range slices.Sorted(maps.Keys(session)) {
+			lines = append(lines, fmt.Sprintf("  %s = %s", name, session[name]))
+		}
+	}
+
+	if note := m.notes[ev.GetId()]; note != "" {
+		lines = append(lines, "Note:     "+note)
+	}
+
+	if ev.GetStmtName() != "" {
+		lines = append(lines, "Stmt:     "+ev.GetStmtName())
+	}
+
+	if n := ev.GetBatchSize(); n > 0 {
+		label := "rows"
+		if n == 1 {
+			label = "row"
+		}
+		lines = append(lines, fmt.Sprintf("Batch:    %d %s", n, label))
+	}
+
+	if ev.GetReadOnly() {
+		lines = append(lines, "Access:   read-only")
+	}
+
+	lines = append(lines, m.flagContextLines(dr.eventIdx)...)
+	lines = append(lines, m.histogramLines(ev)...)
+
+	if plan := ev.GetPlan(); plan != "" {
+		// Attached by sql-tapd's auto-explain; long plan lines are cut
+		// rather than wrapped to keep the tree readable.
+		lines = append(lines, "Plan:")
+		limit := max(innerWidth-2, 10)
+		for l := range strings.SplitSeq(plan, "\n") {
+			lines = append(lines, "  "+ansi.Truncate(highlight.Plan(l), limit, "…"))
+		}
+	}
+
+	return lines
+}
+
+// boundLines renders query with args substituted, one highlighted line per
+// output line. Long lines are wrapped to fit width so that each entry is a
+// single screen row and inspector scrolling stays accurate.
+func boundLines(q string, args []string, width int) []string {
+	const indent = "  "
+	limit := max(width-len(indent), 10)
+	var lines []string
+	for l := range strings.SplitSeq(query.Bind(q, args), "\n") {
+		wrapped := ansi.Wrap(strings.TrimSpace(l), limit, " ,")
+		for w := range strings.SplitSeq(wrapped, "\n") {
+			lines = append(lines, indent+highlight.SQL(w))
+		}
+	}
 	return lines
 }
@@ -0,0 +1,289 @@
+package tui //nolint:testpackage // testing internal model state
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestInspectorBoundSQL(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 60, 40
+
+	withArgs := makeEvent(proxy.OpExecute, "SELECT * FROM users\nWHERE id = $1 AND name = $2", time.Millisecond, "")
+	withArgs.Args = []string{"42", strings.Repeat("x", 80)}
+	m = update(t, m, eventMsg{Event: withArgs})
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+
+	lines := m.inspectorEventLines(m.displayRows[0], 40)
+	plain := make([]string, len(lines))
+	for i, l := range lines {
+		plain[i] = ansi.Strip(l)
+	}
+	idx := slices.Index(plain, "Bound:")
+	if idx < 0 {
+		t.Fatalf("no Bound section in %q", plain)
+	}
+	if plain[idx+1] != "  SELECT * FROM users" {
+		t.Errorf("first bound line = %q", plain[idx+1])
+	}
+	if !strings.Contains(plain[idx+2], "WHERE id = 42") {
+		t.Errorf("second bound line = %q, want substituted id", plain[idx+2])
+	}
+	for _, l := range plain[idx+1:] {
+		if ansi.StringWidth(l) > 40 {
+			t.Errorf("bound line %q is wider than the inspector", l)
+		}
+	}
+
+	lines = m.inspectorEventLines(m.displayRows[1], 40)
+	for _, l := range lines {
+		if ansi.Strip(l) == "Bound:" {
+			t.Error("Bound section shown for an event without args")
+		}
+	}
+}
+
+func TestInspectorSession(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 60, 40
+
+	set := makeEvent(proxy.OpQuery, "SET statement_timeout = 5000", time.Millisecond, "")
+	set.Session = map[string]string{"statement_timeout": "5000"}
+	later := makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")
+	later.Session = map[string]string{"statement_timeout": "5000", "search_path": "app"}
+	m = update(t, m, eventMsg{Event: set})
+	m = update(t, m, eventMsg{Event: later})
+
+	if got := eventOpLabel(m.events[0]); got != "Set" {
+		t.Errorf("op label of SET = %q, want Set", got)
+	}
+	if got := eventOpLabel(m.events[1]); got != "Query" {
+		t.Errorf("op label of SELECT = %q, want Query", got)
+	}
+
+	var plain []string
+	for _, l := range m.inspectorEventLines(m.displayRows[1], 40) {
+		plain = append(plain, ansi.Strip(l))
+	}
+	idx := slices.Index(plain, "Session:")
+	if idx < 0 {
+		t.Fatalf("no Session section in %q", plain)
+	}
+	want := []string{"  search_path = app", "  statement_timeout = 5000"}
+	if got := plain[idx+1 : idx+3]; !slices.Equal(got, want) {
+		t.Errorf("session lines = %q, want %q", got, want)
+	}
+}
+
+func TestInspectorWarnings(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 60, 40
+
+	clean := makeEvent(proxy.OpExec, "INSERT INTO t VALUES (1)", time.Millisecond, "")
+	truncated := makeEvent(proxy.OpExec, "INSERT INTO t VALUES (1000)", time.Millisecond, "")
+	truncated.Warnings = 1
+	m = update(t, m, eventMsg{Event: clean})
+	m = update(t, m, eventMsg{Event: truncated})
+
+	has := func(row int) bool {
+		for _, l := range m.inspectorEventLines(m.displayRows[row], 40) {
+			if strings.HasPrefix(ansi.Strip(l), "Warnings:") {
+				return true
+			}
+		}
+		return false
+	}
+	if has(0) {
+		t.Error("Warnings shown for an event without warnings")
+	}
+	if !has(1) {
+		t.Error("Warnings not shown for an event with a warning")
+	}
+}
+
+func TestInspectorFlagContext(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 100, 40
+
+	base := time.Date(2026, 2, 20, 15, 4, 5, 0, time.UTC)
+	add := func(q string, at time.Duration, dur time.Duration) *tapv1.QueryEvent {
+		ev := makeEvent(proxy.OpExecute, q, dur, "")
+		ev.NormalizedQuery = q
+		ev.StartTime = timestamppb.New(base.Add(at))
+		m = update(t, m, eventMsg{Event: ev})
+		return ev
+	}
+
+	const nq = "SELECT * FROM posts WHERE user_id = ?"
+	add(nq, 0, time.Millisecond) // outside the window of the flagged run
+	for i := range 5 {
+		add(nq, 5*time.Second+time.Duration(i)*100*time.Millisecond, time.Millisecond)
+	}
+	m.events[len(m.events)-1].NPlus_1 = true
+
+	const slow = "SELECT * FROM orders"
+	for i := range 3 {
+		add(slow, 6*time.Second+time.Duration(i)*time.Second, 10*time.Millisecond)
+	}
+	add(slow, 10*time.Second, 50*time.Millisecond).SlowQuery = true
+
+	plain := func(row int) []string {
+		var out []string
+		for _, l := range m.inspectorEventLines(m.displayRows[row], 100) {
+			out = append(out, ansi.Strip(l))
+		}
+		return out
+	}
+
+	lines := plain(5)
+	idx := slices.IndexFunc(lines, func(l string) bool { return strings.HasPrefix(l, "N+1:") })
+	if idx < 0 {
+		t.Fatalf("no N+1 context in %q", lines)
+	}
+	if want := "N+1:      5 runs of this template within 1s up to this one"; lines[idx] != want {
+		t.Errorf("N+1 line = %q, want %q", lines[idx], want)
+	}
+	if want := "  rows: #2 #3 #4 #5"; lines[idx+1] != want {
+		t.Errorf("siblings = %q, want %q", lines[idx+1], want)
+	}
+
+	lines = plain(9)
+	idx = slices.IndexFunc(lines, func(l string) bool { return strings.HasPrefix(l, "Slow:") })
+	if idx < 0 {
+		t.Fatalf("no slow context in %q", lines)
+	}
+	if !strings.Contains(lines[idx], "2.5× avg, above template p95") || !strings.Contains(lines[idx], "over 4 runs") {
+		t.Errorf("slow line = %q", lines[idx])
+	}
+
+	for _, l := range plain(1) {
+		if strings.HasPrefix(l, "N+1:") || strings.HasPrefix(l, "Slow:") {
+			t.Errorf("unflagged event shows context line %q", l)
+		}
+	}
+
+	// The window sql-tapd reports replaces the default one.
+	m.serverInfo = &tapv1.ServerInfoResponse{Nplus1Window: durationpb.New(10 * time.Second)}
+	lines = plain(5)
+	idx = slices.IndexFunc(lines, func(l string) bool { return strings.HasPrefix(l, "N+1:") })
+	if want := "N+1:      6 runs of this template within 10s up to this one"; idx < 0 || lines[idx] != want {
+		t.Errorf("N+1 lines = %q, want %q", lines, want)
+	}
+}
+
+func TestInspectorJumpTemplate(t *testing.T) {
+	t.Parallel()
+
+	const (
+		byID   = "SELECT * FROM users WHERE id = ?"
+		byName = "SELECT * FROM orders WHERE user_id = ?"
+	)
+	events := []*tapv1.QueryEvent{
+		{Op: int32(proxy.OpQuery), Query: "SELECT * FROM users WHERE id = 1", NormalizedQuery: byID, Args: []string{"1"}},
+		{Op: int32(proxy.OpQuery), Query: "SELECT * FROM orders WHERE user_id = 1", NormalizedQuery: byName, Args: []string{"1"}},
+		{Op: int32(proxy.OpQuery), Query: "SELECT * FROM users WHERE id = 2", NormalizedQuery: byID, Args: []string{"2"}, TxId: "tx1"},
+		{Op: int32(proxy.OpQuery), Query: "SELECT * FROM orders WHERE user_id = 2", NormalizedQuery: byName, Args: []string{"2"}, TxId: "tx1"},
+		{Op: int32(proxy.OpQuery), Query: "SELECT * FROM users WHERE id = 3", NormalizedQuery: byID, Args: []string{"3"}},
+		{Op: int32(proxy.OpQuery), Query: "SELECT * FROM users WHERE id = 4", NormalizedQuery: byID, Args: []string{"4"}},
+	}
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for _, ev := range events {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+	// Hide the second and third runs of byID in a collapsed transaction and
+	// a collapsed repeat group.
+	m = update(t, m, keyMsg("z"))
+	m.collapsed["tx1"] = true
+	m = m.rebuild()
+
+	m.cursor = 0
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.view != viewInspect {
+		t.Fatalf("view = %d after Enter, want the inspector", m.view)
+	}
+	arg := func() string {
+		t.Helper()
+		ev := m.cursorEvent()
+		if ev == nil {
+			t.Fatalf("cursor on row %d, want an event", m.cursor)
+		}
+		return ev.GetArgs()[0]
+	}
+
+	for _, step := range []struct {
+		key  string
+		want string
+	}{
+		{key: "n", want: "2"}, // into the collapsed transaction
+		{key: "n", want: "3"}, // into the collapsed repeat group
+		{key: "n", want: "4"},
+		{key: "n", want: "4"}, // last run, stays
+		{key: "N", want: "3"},
+		{key: "N", want: "2"},
+		{key: "N", want: "1"},
+		{key: "N", want: "1"}, // first run, stays
+	} {
+		m.inspectScroll = 3
+		m = update(t, m, keyMsg(step.key))
+		if got := arg(); got != step.want {
+			t.Fatalf("after %s: arg = %s, want %s", step.key, got, step.want)
+		}
+		if m.view != viewInspect {
+			t.Fatalf("after %s: view = %d, want the inspector", step.key, m.view)
+		}
+	}
+
+	// Templates interleave: n from the orders query skips the users queries.
+	m.cursor = slices.IndexFunc(m.displayRows, func(dr displayRow) bool {
+		return dr.kind == rowEvent && dr.eventIdx == 1
+	})
+	m = update(t, m, keyMsg("n"))
+	if ev := m.cursorEvent(); ev.GetNormalizedQuery() != byName || arg() != "2" || m.inspectScroll != 0 {
+		t.Errorf("after n on orders: query = %q, arg = %s, scroll = %d, want the second orders query from the top",
+			ev.GetNormalizedQuery(), arg(), m.inspectScroll)
+	}
+}
+
+func TestRevealEventLeavesCallerCollapsed(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	m = update(t, m, eventMsg{Event: &tapv1.QueryEvent{Op: int32(proxy.OpQuery), Query: "SELECT 1", TxId: "tx1"}})
+	m.collapsed["tx1"] = true
+	m = m.rebuild()
+
+	next, ok := m.revealEvent(0)
+	if !ok || next.cursorEvent().GetQuery() != "SELECT 1" {
+		t.Fatalf("revealEvent(0) = %v, cursor on %q, want the event", ok, next.cursorEvent().GetQuery())
+	}
+	if !m.collapsed["tx1"] || next.collapsed["tx1"] {
+		t.Errorf("collapsed: caller %v, result %v, want the caller untouched and the result expanded",
+			m.collapsed["tx1"], next.collapsed["tx1"])
+	}
+	if _, ok := m.revealEvent(1); ok {
+		t.Error("revealEvent(1) = true for a missing event")
+	}
+	if !m.collapsed["tx1"] {
+		t.Error("failed revealEvent expanded the caller's transaction")
+	}
+}
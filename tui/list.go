@@ -2,29 +2,28 @@ package tui
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/mickamy/sql-tap/eventfmt"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/highlight"
 	"github.com/mickamy/sql-tap/proxy"
 )
 
 func eventStatus(ev *tapv1.QueryEvent) string {
-	if ev.GetError() != "" {
-		return lipgloss.NewStyle().
-			Foreground(lipgloss.Color("1")).Render("E")
-	}
-	if ev.GetNPlus_1() {
-		return lipgloss.NewStyle().
-			Foreground(lipgloss.Color("3")).Render("N+1")
-	}
-	if ev.GetSlowQuery() {
-		return lipgloss.NewStyle().
-			Foreground(lipgloss.Color("5")).Render("SLOW")
+	badges := eventfmt.Badges(ev)
+	if len(badges) == 0 {
+		return ""
 	}
-	return ""
+	return badgeStatus(badges[0])
+}
+
+// badgeStatus renders b for the status column.
+func badgeStatus(b eventfmt.Badge) string {
+	return lipgloss.NewStyle().Foreground(b.Color).Render(b.Label)
 }
 
 // Column widths.
@@ -34,33 +33,93 @@ const (
 	colDuration = 10
 	colTime     = 12
 	colStatus   = 4
+	colRows     = 7
 )
 
+// writeVerbs are the statements whose rows-affected count is shown in the
+// list when the rows column is enabled.
+var writeVerbs = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true,
+	"REPLACE": true, "MERGE": true, "COPY": true,
+}
+
+// rowsCell returns the rows-affected cell for ev: the count for successful
+// writes, empty otherwise.
+func rowsCell(ev *tapv1.QueryEvent) string {
+	if ev.GetError() != "" || ev.GetInFlight() || !writeVerbs[eventfmt.Verb(ev)] {
+		return ""
+	}
+	return formatRows(ev.GetRowsAffected())
+}
+
+// formatRows renders n in at most colRows characters.
+func formatRows(n int64) string {
+	switch {
+	case n >= 1_000_000_000:
+		return fmt.Sprintf("%.1fG", float64(n)/1e9)
+	case n >= 10_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	}
+	return strconv.FormatInt(n, 10)
+}
+
 // txColors is a palette for coloring transaction rows.
 var txColors = []lipgloss.Color{"6", "3", "5", "2", "4", "1"}
 
 func (m Model) renderList(maxRows int) string {
 	innerWidth := max(m.width-4, 20)
 	colQuery := max(innerWidth-colMarker-colOp-colDuration-colTime-colStatus-4, 10)
+	if m.wideQuery {
+		colQuery += colDuration + colTime + 2
+	}
+	if m.showRows {
+		colQuery = max(colQuery-colRows-1, 10)
+	}
+
+	templates := fmt.Sprintf("%d templates", m.templateCount)
+	if m.templateCount == 1 {
+		templates = "1 template"
+	}
 
 	var title string
-	if m.searchQuery != "" || m.filterQuery != "" {
+	if m.searchQuery != "" || m.filterQuery != "" || m.pinnedOnly {
 		matched := 0
 		for _, dr := range m.displayRows {
-			if dr.kind == rowEvent {
-				matched++
+			switch dr.kind {
+			case rowEvent:
+				if dr.group == "" {
+					matched++
+				}
+			case rowRepeat:
+				matched += len(dr.events)
+			case rowTxSummary:
 			}
 		}
-		title = fmt.Sprintf(" sql-tap (%d/%d queries) ", matched, len(m.events))
+		title = fmt.Sprintf(" sql-tap (%d/%d queries, %s) ", matched, len(m.events)-m.buffered, templates)
 	} else {
-		title = fmt.Sprintf(" sql-tap (%d queries) ", len(m.events))
+		title = fmt.Sprintf(" sql-tap (%d queries, %s) ", len(m.events)-m.buffered, templates)
 	}
 	if m.paused {
 		title += "[PAUSED] "
 	}
+	switch {
+	case m.followPinned:
+		title += "[following: pinned] "
+	case m.follow:
+		title += "[following] "
+	}
 	if m.sortMode == sortDuration {
 		title += "[slow] "
 	}
+	if m.wideQuery {
+		title += "[wide] "
+	}
+	if m.collapseRepeats {
+		title += "[repeats] "
+	}
+	if w := m.rateWidget(); w != "" && len([]rune(title+w)) <= innerWidth {
+		title += w
+	}
 
 	border := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
@@ -68,22 +127,14 @@ func (m Model) renderList(maxRows int) string {
 
 	dataRows := max(maxRows-1, 1) // -1 for header row
 
-	start := 0
-	if len(m.displayRows) > dataRows {
-		start = max(m.cursor-dataRows/2, 0)
-		if start+dataRows > len(m.displayRows) {
-			start = len(m.displayRows) - dataRows
-		}
-	}
-	end := min(start+dataRows, len(m.displayRows))
+	start, end := m.listWindow(dataRows)
 
-	header := fmt.Sprintf("    %-*s %-*s %*s %*s %-*s",
-		colOp, "Op",
-		colQuery, "Query",
-		colDuration, "Duration",
-		colTime, "Time",
-		colStatus, "",
-	)
+	header := fmt.Sprintf("    %-*s %-*s", colOp, "Op", colQuery, "Query") +
+		m.timingCells("Duration", "Time", lipgloss.NewStyle())
+	if m.showRows {
+		header += fmt.Sprintf(" %*s", colRows, "Rows")
+	}
+	header += fmt.Sprintf(" %-*s", colStatus, "")
 
 	var rows []string
 	rows = append(rows, lipgloss.NewStyle().Bold(true).Render(header))
@@ -96,6 +147,8 @@ func (m Model) renderList(maxRows int) string {
 			rows = append(rows, m.renderTxSummaryRow(dr, isCursor, colQuery))
 		case rowEvent:
 			rows = append(rows, m.renderEventRow(dr, i, isCursor, colQuery))
+		case rowRepeat:
+			rows = append(rows, m.renderRepeatRow(dr, isCursor, colQuery))
 		}
 	}
 
@@ -105,6 +158,14 @@ func (m Model) renderList(maxRows int) string {
 
 	box := border.Render(content)
 	lines := strings.Split(box, "\n")
+	if m.showHeatStrip(dataRows) {
+		// Data rows start below the top border and the header row.
+		for i, cell := range renderHeatStrip(m.heatBuckets(dataRows, start, end)) {
+			if 2+i < len(lines)-1 {
+				lines[2+i] += " " + cell
+			}
+		}
+	}
 	if len(lines) > 0 {
 		borderFg := lipgloss.NewStyle().Foreground(borderColor)
 		titleStyle := lipgloss.NewStyle().Bold(true)
@@ -112,10 +173,21 @@ func (m Model) renderList(maxRows int) string {
 		lines[0] = borderFg.Render("╭") +
 			titleStyle.Render(title) +
 			borderFg.Render(strings.Repeat("─", dashes)+"╮")
-		box = strings.Join(lines, "\n")
 	}
 
-	return box
+	return strings.Join(lines, "\n")
+}
+
+// listWindow returns the range of display rows shown in a list of dataRows
+// rows, which keeps the cursor centered where possible.
+func (m Model) listWindow(dataRows int) (start, end int) {
+	if len(m.displayRows) > dataRows {
+		start = max(m.cursor-dataRows/2, 0)
+		if start+dataRows > len(m.displayRows) {
+			start = len(m.displayRows) - dataRows
+		}
+	}
+	return start, min(start+dataRows, len(m.displayRows))
 }
 
 func (m Model) renderTxSummaryRow(dr displayRow, isCursor bool, colQuery int) string {
@@ -129,15 +201,31 @@ func (m Model) renderTxSummaryRow(dr displayRow, isCursor bool, colQuery int) st
 		chevron = "▸ "
 	}
 
-	nq := m.txQueryCount(dr.events)
+	nq := txQueryCount(m.events, dr.events)
 	label := fmt.Sprintf("%d queries", nq)
 	if nq == 1 {
 		label = "1 query"
 	}
 
-	dur := formatDurationValue(m.txWallDuration(dr.events))
+	if n := m.dupTxs[dr.txID]; n > 0 {
+		label = truncate(label+fmt.Sprintf(" (%d repeated)", n), colQuery)
+	}
+
+	dur := formatDurationValue(txWallDuration(m.events, dr.events))
 	t := formatTime(m.events[dr.events[0]].GetStartTime())
 
+	var status string
+	badge, ok := eventfmt.BadgeTxFailed, txFailed(m.events, dr.events)
+	if !ok {
+		badge, ok = eventfmt.BadgeDup, m.dupTxs[dr.txID] > 0
+	}
+	if ok {
+		status = " " + badgeStatus(badge)
+		if m.showRows {
+			status = fmt.Sprintf(" %*s ", colRows, "") + badgeStatus(badge)
+		}
+	}
+
 	styled := lipgloss.NewStyle().Foreground(m.txColorMap[dr.txID])
 
 	if isCursor {
@@ -146,19 +234,26 @@ func (m Model) renderTxSummaryRow(dr displayRow, isCursor bool, colQuery int) st
 		return bold.Render(marker) +
 			styled.Render(chevron) +
 			padRight(styled.Render("Tx"), colOp) + " " +
-			padRight(bold.Render(label), colQuery) + " " +
-			padLeft(bold.Render(dur), colDuration) + " " +
-			padLeft(bold.Render(t), colTime)
+			padRight(bold.Render(label), colQuery) +
+			m.timingCells(dur, t, bold) +
+			status
 	}
 
-	return fmt.Sprintf("%s%s%s %-*s %*s %*s",
+	return fmt.Sprintf("%s%s%s %-*s",
 		marker,
 		styled.Render(chevron),
 		padRight(styled.Render("Tx"), colOp),
 		colQuery, label,
-		colDuration, dur,
-		colTime, t,
-	)
+	) + m.timingCells(dur, t, lipgloss.NewStyle()) + status
+}
+
+// timingCells returns the Duration and Time cells of a list row, each after a
+// space, or nothing in wide query mode, which gives their width to the query.
+func (m Model) timingCells(dur, t string, style lipgloss.Style) string {
+	if m.wideQuery {
+		return ""
+	}
+	return " " + padLeft(style.Render(dur), colDuration) + " " + padLeft(style.Render(t), colTime)
 }
 
 func (m Model) renderEventRow(dr displayRow, drIdx int, isCursor bool, colQuery int) string {
@@ -168,8 +263,8 @@ func (m Model) renderEventRow(dr displayRow, drIdx int, isCursor bool, colQuery
 		marker = "▶ "
 	}
 
-	op := opString(ev.GetOp())
-	dur := formatDuration(ev.GetDuration())
+	op := eventOpLabel(ev)
+	dur := m.eventDuration(ev)
 	t := formatTime(ev.GetStartTime())
 
 	indent := "  " // non-tx: align with chevron space
@@ -178,13 +273,31 @@ func (m Model) renderEventRow(dr displayRow, drIdx int, isCursor bool, colQuery
 		indent = "    " // tx child: extra indent
 		cq = max(colQuery-2, 1)
 	}
+	if dr.group != "" {
+		indent += "  " // expanded from a repeat group
+		cq = max(cq-2, 1)
+	}
+	if m.isPinned(ev) {
+		indent = indent[:len(indent)-2] + pinMarker + " "
+	}
 
-	q := truncate(ev.GetQuery(), cq)
+	q, spans := truncateMatch(ev.GetQuery(), cq, m.searchRe)
 	if q == "" {
 		q = "-"
 	}
+	// queryCell renders the query column with the search matches marked.
+	queryCell := func(base lipgloss.Style) string {
+		plain := func(s string) string { return base.Render(s) }
+		return padRight(highlightSpans(q, spans, plain, base.Reverse(true)), cq)
+	}
 
 	status := eventStatus(ev)
+	if status == "" && m.dupEvents[dr.eventIdx] {
+		status = badgeStatus(eventfmt.BadgeDup)
+	}
+	if m.showRows {
+		status = fmt.Sprintf("%*s ", colRows, rowsCell(ev)) + status
+	}
 
 	if m.isTxChild(drIdx) {
 		styled := lipgloss.NewStyle().Foreground(m.txColorMap[ev.GetTxId()])
@@ -194,29 +307,28 @@ func (m Model) renderEventRow(dr displayRow, drIdx int, isCursor bool, colQuery
 			return bold.Render(marker) +
 				bold.Render(indent) +
 				padRight(styled.Render(op), colOp) + " " +
-				padRight(bold.Render(q), cq) + " " +
-				padLeft(bold.Render(dur), colDuration) + " " +
-				padLeft(bold.Render(t), colTime) + " " +
+				queryCell(bold) +
+				m.timingCells(dur, t, bold) + " " +
 				status
 		}
-		return fmt.Sprintf("%s%s%s %-*s %*s %*s",
+		return fmt.Sprintf("%s%s%s %s",
 			marker,
 			indent,
 			padRight(styled.Render(op), colOp),
-			cq, q,
-			colDuration, dur,
-			colTime, t,
-		) + " " + status
+			queryCell(lipgloss.NewStyle()),
+		) + m.timingCells(dur, t, lipgloss.NewStyle()) + " " + status
 	}
 
-	row := fmt.Sprintf("%s%s%-*s %-*s %*s %*s",
+	base := lipgloss.NewStyle()
+	if isCursor {
+		base = base.Bold(true)
+	}
+	row := fmt.Sprintf("%s%s%-*s %s",
 		marker,
 		indent,
 		colOp, op,
-		cq, q,
-		colDuration, dur,
-		colTime, t,
-	) + " " + status
+		queryCell(base),
+	) + m.timingCells(dur, t, lipgloss.NewStyle()) + " " + status
 	if isCursor {
 		row = lipgloss.NewStyle().Bold(true).Render(row)
 	}
@@ -237,14 +349,16 @@ func (m Model) renderPreview() string {
 		return m.renderTxPreview(dr, innerWidth)
 	case rowEvent:
 		return m.renderEventPreview(dr, innerWidth)
+	case rowRepeat:
+		return m.renderRepeatPreview(dr, innerWidth)
 	}
 
 	return ""
 }
 
 func (m Model) renderTxPreview(dr displayRow, innerWidth int) string {
-	nq := m.txQueryCount(dr.events)
-	dur := m.txWallDuration(dr.events)
+	nq := txQueryCount(m.events, dr.events)
+	dur := txWallDuration(m.events, dr.events)
 
 	var lines []string
 	lines = append(lines, "Type:     Transaction")
@@ -254,6 +368,7 @@ func (m Model) renderTxPreview(dr displayRow, innerWidth int) string {
 		label = "1 query"
 	}
 	lines = append(lines, "Queries:  "+label)
+	lines = append(lines, m.txDupLines(dr.txID)...)
 	lines = append(lines, "Duration: "+formatDurationValue(dur))
 	lines = append(lines, "Tx:       "+dr.txID)
 
@@ -279,6 +394,70 @@ func (m Model) renderTxPreview(dr displayRow, innerWidth int) string {
 	return border.Render(content)
 }
 
+// Limits of the args shown in the event preview.
+const (
+	previewMaxArgLen   = 32 // longer values are truncated with an ellipsis
+	previewMaxArgLines = 3  // further args are summarized as "+N more"
+)
+
+// previewArgLines formats args for the event preview. Up to three short args
+// stay on one line as "Args:     [a, b, c]"; otherwise the values, truncated
+// to previewMaxArgLen, are wrapped to width under an "Args (N): " label.
+func previewArgLines(args []string, width int) []string {
+	short := make([]string, len(args))
+	fits := len(args) <= 3
+	for i, a := range args {
+		short[i] = truncate(a, previewMaxArgLen)
+		if short[i] != a {
+			fits = false
+		}
+	}
+	if line := fmt.Sprintf("Args:     [%s]", strings.Join(short, ", ")); fits && len([]rune(line)) <= width {
+		return []string{line}
+	}
+
+	label := fmt.Sprintf("Args (%d): ", len(args))
+	indent := strings.Repeat(" ", len(label))
+	avail := max(width-len(label), previewMaxArgLen+2)
+
+	// Leave room on the last line for the count of args left out.
+	const moreLen = len(" … +999 more")
+	var lines []string
+	cur := ""
+	for i, a := range short {
+		item := a
+		if i < len(short)-1 {
+			item += ","
+		}
+		last := len(lines) == previewMaxArgLines-1
+		room := avail
+		if last && i < len(short)-1 {
+			room -= moreLen
+		}
+		if cur != "" && len([]rune(cur))+1+len([]rune(item)) > room {
+			if last {
+				cur += fmt.Sprintf(" … +%d more", len(short)-i)
+				break
+			}
+			lines = append(lines, cur)
+			cur = ""
+		}
+		if cur != "" {
+			cur += " "
+		}
+		cur += item
+	}
+	lines = append(lines, cur)
+	for i := range lines {
+		if i == 0 {
+			lines[i] = label + lines[i]
+		} else {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return lines
+}
+
 func (m Model) renderEventPreview(dr displayRow, innerWidth int) string {
 	ev := m.events[dr.eventIdx]
 
@@ -287,14 +466,15 @@ func (m Model) renderEventPreview(dr displayRow, innerWidth int) string {
 
 	if q := ev.GetQuery(); q != "" {
 		maxQueryLen := max(innerWidth-10, 20) // 10 = len("Query:    ")
-		lines = append(lines, "Query:    "+highlight.SQL(truncate(q, maxQueryLen)))
+		q, spans := truncateMatch(q, maxQueryLen, m.searchRe)
+		lines = append(lines, "Query:    "+highlightSpans(q, spans, highlight.SQL, searchMatchStyle))
 	}
 
 	if len(ev.GetArgs()) > 0 {
-		lines = append(lines, fmt.Sprintf("Args:     [%s]", strings.Join(ev.GetArgs(), ", ")))
+		lines = append(lines, previewArgLines(ev.GetArgs(), innerWidth)...)
 	}
 
-	lines = append(lines, "Duration: "+formatDuration(ev.GetDuration()))
+	lines = append(lines, "Duration: "+m.eventDuration(ev))
 
 	if ev.GetError() != "" {
 		lines = append(lines, "Error:    "+ev.GetError())
@@ -3,6 +3,9 @@ package tui
 import (
 	"context"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -10,9 +13,9 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/mickamy/sql-tap/clipboard"
+	"github.com/mickamy/sql-tap/dial"
 	"github.com/mickamy/sql-tap/explain"
 	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
 	"github.com/mickamy/sql-tap/proxy"
@@ -27,80 +30,183 @@ const (
 	viewExplain
 	viewAnalytics
 	viewTimeline
+	viewHelp
 )
 
 type sortMode int
 
 const (
 	sortChronological sortMode = iota
-	sortDuration
+	sortDuration               // slowest first
+	sortRows                   // most rows affected first
+	sortOp                     // grouped by op, chronological within a group
 )
 
+func (s sortMode) String() string {
+	switch s {
+	case sortChronological:
+		return "chronological"
+	case sortDuration:
+		return "duration"
+	case sortRows:
+		return "rows"
+	case sortOp:
+		return "op"
+	}
+	return "chronological"
+}
+
+func (s sortMode) next() sortMode {
+	switch s {
+	case sortChronological:
+		return sortDuration
+	case sortDuration:
+		return sortRows
+	case sortRows:
+		return sortOp
+	case sortOp:
+		return sortChronological
+	}
+	return sortChronological
+}
+
 type rowKind int
 
 const (
 	rowEvent rowKind = iota
 	rowTxSummary
+	rowRepeat // a run of the same template, as in an N+1 storm
 )
 
 type displayRow struct {
 	kind     rowKind
 	eventIdx int    // rowEvent: index into Model.events
 	txID     string // rowTxSummary: transaction ID
-	events   []int  // rowTxSummary: indices of all events in this tx (order preserved)
+	events   []int  // rowTxSummary, rowRepeat: indices of all events in the row (order preserved)
+	group    string // rowRepeat: key in Model.collapsed; rowEvent: the repeat group it is expanded from
+}
+
+// Options configures optional TUI behavior.
+type Options struct {
+	// ExportDir is the directory export files are written to.
+	// Empty means the current directory.
+	ExportDir string
+	// ExportName is the base filename for exports, before the timestamp
+	// and extension. Empty means "sql-tap".
+	ExportName string
+	// Events are shown at startup, e.g. loaded from a .tapdump file.
+	Events []*tapv1.QueryEvent
+	// ShowRows shows the rows-affected column for writes in the list.
+	// It can also be toggled with R.
+	ShowRows bool
+	// DialOptions configure the connection to sql-tapd. Empty means
+	// dial.Default.
+	DialOptions []grpc.DialOption
 }
 
 // Model is the Bubble Tea model for the sql-tap TUI.
 type Model struct {
-	target string
-	client tapv1.TapServiceClient
-	conn   *grpc.ClientConn
-	stream tapv1.TapService_WatchClient
+	target  string
+	opts    Options
+	offline bool // showing preloaded events without a sql-tapd connection
+	client  tapv1.TapServiceClient
+	conn    *grpc.ClientConn
+	stream  tapv1.TapService_WatchClient
+
+	reconnecting     bool // stream dropped; retrying with backoff
+	reconnectAttempt int
+	dropped          uint64 // events sql-tapd dropped, as of the last received event
+
+	serverInfo *tapv1.ServerInfoResponse // fetched on connect and when opening help; nil until then
 
 	events      []*tapv1.QueryEvent
-	cursor      int // index into displayRows
-	follow      bool
+	inFlight    map[string]int // in-flight event key -> index into events
+	cursor      int            // index into displayRows
+	follow      bool           // keep the cursor on the newest row; cleared by moving up
 	paused      bool
+	buffered    int // events received while paused, not yet shown
 	width       int
 	height      int
 	err         error
 	view        viewMode
+	prevView    viewMode // view to return to when the help overlay closes
 	collapsed   map[string]bool
 	displayRows []displayRow
 	txColorMap  map[string]lipgloss.Color
 
+	templateCount int            // distinct normalized queries, updated on rebuild
+	dupTxs        map[string]int // tx ID -> redundant SELECT runs, updated on rebuild
+	dupEvents     map[int]bool   // event index -> repeated within its tx, updated on rebuild
+
 	searchMode   bool
 	searchQuery  string
+	searchRe     *regexp.Regexp // searchQuery compiled by searchRegexp; set through withSearch
 	searchCursor int
 	filterMode   bool
 	filterQuery  string
 	filterCursor int
 	sortMode     sortMode
+	txContext    bool // include whole transactions when any of their events match
+
+	notes       map[string]string // event ID -> user note
+	noteMode    bool
+	noteInput   string
+	noteCursor  int
+	noteEventID string
+
+	pins       map[string]bool // event ID -> pinned
+	pinnedOnly bool
+	showRows   bool // rows-affected column for writes
+	wideQuery  bool // Duration and Time columns hidden to widen the query
+
+	followPinned bool // F: follow regardless of cursor movement
+
+	collapseRepeats bool // z: runs of the same template shown as one row
+
+	rates rateRing // query rate and latency for the header sparkline
 
 	writeMode      bool
 	wroteMessage   string
 	alertSeq       int
+	spinning       bool // spinner tick scheduled for in-flight events
+	spinnerFrame   int
 	pendingBracket bool
-
-	inspectScroll  int
-	explainPlan    string
-	explainErr     error
-	explainScroll  int
-	explainHScroll int
-	explainMode    explain.Mode
-	explainQuery   string
-	explainArgs    []string
+	pendingG       bool // "g" pressed, waiting for the second "g"
+	keyCount       int  // numeric prefix typed before a motion (e.g. 12G)
+
+	inspectScroll   int
+	explainPlan     string
+	explainErr      error
+	explainScroll   int
+	explainHScroll  int
+	explainMode     explain.Mode
+	explainQuery    string
+	explainArgs     []string
+	explainArgTypes []string
+	prevPlan        string // plan before the last edit, diffed against with d
+	explainDiff     bool
+	confirmAnalyze  *explainTarget // EXPLAIN ANALYZE awaiting confirmation, nil if none
 
 	analyticsRows     []analyticsRow
 	analyticsCursor   int
 	analyticsHScroll  int
 	analyticsSortMode analyticsSortMode
+	analyticsGroup    analyticsGroup
+
+	analyticsSearch       string // substring filter on analytics templates
+	analyticsSearchMode   bool
+	analyticsSearchCursor int
+
+	analyticsWriteMode bool // w: choosing the analytics export format
 
 	timelineScroll int
 }
 
 // eventMsg carries a received QueryEvent from the gRPC stream.
-type eventMsg struct{ Event *tapv1.QueryEvent }
+type eventMsg struct {
+	Event   *tapv1.QueryEvent
+	Dropped uint64 // events sql-tapd has dropped so far
+}
 
 // errMsg carries an error from the gRPC connection or stream.
 type errMsg struct{ Err error }
@@ -127,23 +233,39 @@ type connectedMsg struct {
 }
 
 // New creates a new Model targeting the given tapd server address.
-func New(target string) Model {
-	return Model{
+// An empty target starts the TUI offline, showing only opts.Events.
+func New(target string, opts Options) Model {
+	m := Model{
 		target:    target,
+		opts:      opts,
+		offline:   target == "",
+		events:    slices.Clone(opts.Events),
+		inFlight:  make(map[string]int),
 		collapsed: make(map[string]bool),
+		notes:     make(map[string]string),
+		pins:      make(map[string]bool),
+		showRows:  opts.ShowRows,
+	}
+	for _, ev := range m.events {
+		m = m.recordRate(ev)
 	}
+	return m.rebuild()
 }
 
-// Init starts the gRPC connection.
+// Init starts the gRPC connection and the sparkline tick unless the model is
+// offline.
 func (m Model) Init() tea.Cmd {
-	return connect(m.target)
+	if m.offline {
+		return nil
+	}
+	return tea.Batch(connect(m.target, m.opts.DialOptions), rateTick())
 }
 
-func connect(target string) tea.Cmd {
+func connect(target string, opts []grpc.DialOption) tea.Cmd {
 	return func() tea.Msg {
-		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		conn, err := dial.Client(target, opts...)
 		if err != nil {
-			return errMsg{Err: fmt.Errorf("dial %s: %w", target, err)}
+			return errMsg{Err: err}
 		}
 		client := tapv1.NewTapServiceClient(conn)
 		stream, err := client.Watch(context.Background(), &tapv1.WatchRequest{})
@@ -159,9 +281,9 @@ func recvEvent(stream tapv1.TapService_WatchClient) tea.Cmd {
 	return func() tea.Msg {
 		resp, err := stream.Recv()
 		if err != nil {
-			return errMsg{Err: err}
+			return disconnectedMsg{Err: err}
 		}
-		return eventMsg{Event: resp.GetEvent()}
+		return eventMsg{Event: resp.GetEvent(), Dropped: resp.GetDropped()}
 	}
 }
 
@@ -172,16 +294,42 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.client = msg.client
 		m.conn = msg.conn
 		m.stream = msg.stream
-		return m, recvEvent(msg.stream)
+		m.err = nil
+		if m.reconnecting {
+			m.reconnecting = false
+			m.reconnectAttempt = 0
+			m, alertCmd := m.showAlert("reconnected")
+			return m, tea.Batch(alertCmd, recvEvent(msg.stream), fetchServerInfo(msg.client))
+		}
+		return m, tea.Batch(recvEvent(msg.stream), fetchServerInfo(msg.client))
+
+	case disconnectedMsg:
+		return m.startReconnect()
+
+	case reconnectFailedMsg:
+		m.reconnectAttempt++
+		return m, reconnect(m.target, m.opts.DialOptions, reconnectDelay(m.reconnectAttempt))
 
 	case eventMsg:
-		if m.paused {
-			return m, recvEvent(m.stream)
+		var appended bool
+		m, appended = m.addEvent(msg.Event)
+		m.dropped = msg.Dropped
+		next := recvEvent(m.stream)
+		if msg.Event.GetInFlight() && !m.spinning {
+			m.spinning = true
+			next = tea.Batch(next, spinnerTick())
 		}
 
-		m.events = append(m.events, msg.Event)
+		// Keep receiving while paused, but defer rebuilding the list
+		// until the user resumes so the visible rows stay put.
+		if m.paused {
+			if appended {
+				m.buffered++
+			}
+			return m, next
+		}
 
-		if msg.Event.GetNPlus_1() || msg.Event.GetSlowQuery() {
+		if !msg.Event.GetUpdate() && (msg.Event.GetNPlus_1() || msg.Event.GetSlowQuery()) {
 			q := msg.Event.GetQuery()
 			if len(q) > 60 {
 				q = q[:57] + "..."
@@ -192,28 +340,44 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			m, alertCmd := m.showAlert(label + q)
 			if m.view != viewList {
-				return m, tea.Batch(alertCmd, recvEvent(m.stream))
+				return m, tea.Batch(alertCmd, next)
 			}
 			m = m.rebuild()
-			if m.follow {
+			if m.following() {
 				m.cursor = max(len(m.displayRows)-1, 0)
 			}
-			return m, tea.Batch(alertCmd, recvEvent(m.stream))
+			return m, tea.Batch(alertCmd, next)
 		}
 
 		if m.view != viewList {
-			return m, recvEvent(m.stream)
+			return m, next
 		}
 		m = m.rebuild()
-		if m.follow {
+		if m.following() {
 			m.cursor = max(len(m.displayRows)-1, 0)
 		}
-		return m, recvEvent(m.stream)
+		return m, next
+
+	case rateTickMsg:
+		m.rates.advance(msg.at)
+		return m, rateTick()
+
+	case spinnerTickMsg:
+		if len(m.inFlight) == 0 {
+			m.spinning = false
+			return m, nil
+		}
+		m.spinnerFrame++
+		return m, spinnerTick()
 
 	case errMsg:
 		m.err = msg.Err
 		return m, nil
 
+	case serverInfoMsg:
+		m.serverInfo = msg.info
+		return m, nil
+
 	case explainResultMsg:
 		m.explainPlan = msg.plan
 		m.explainErr = msg.err
@@ -232,18 +396,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if msg.query == "" {
 			return m, nil // canceled
 		}
-		m.view = viewExplain
-		m.explainPlan = ""
-		m.explainErr = nil
-		m.explainScroll = 0
-		m.explainHScroll = 0
-		m.explainMode = msg.mode
-		m.explainQuery = msg.query
-		m.explainArgs = msg.args
-		return m, runExplain(m.client, msg.mode, msg.query, msg.args)
+		// The edited query keeps the args, and the types they were bound as.
+		t := explainTarget{query: msg.query, args: msg.args, argTypes: m.explainArgTypes}
+		if m.view == viewExplain && m.explainErr == nil {
+			t.prevPlan = m.explainPlan
+		}
+		return m.openExplain(msg.mode, t)
 
 	case exportResultMsg:
-		alertMsg := "wrote: ./" + msg.path
+		alertMsg := "wrote: " + msg.path
 		if msg.err != nil {
 			alertMsg = "write error: " + msg.err.Error()
 		}
@@ -258,18 +419,22 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tea.KeyMsg:
 		m.wroteMessage = ""
-		switch m.view {
-		case viewInspect:
-			return m.updateInspect(msg)
-		case viewExplain:
-			return m.updateExplain(msg)
-		case viewAnalytics:
-			return m.updateAnalytics(msg)
-		case viewTimeline:
-			return m.updateTimeline(msg)
-		case viewList:
-			return m.updateList(msg)
+		if m.confirmAnalyze != nil {
+			return m.updateConfirmAnalyze(msg)
+		}
+		if m.view == viewHelp {
+			return m.updateHelp(msg)
+		}
+		if msg.String() == "?" && !m.inputActive() {
+			return m.enterHelp()
+		}
+		if next, ok := m.handleViewCycle(msg); ok {
+			return next, nil
 		}
+		return m.updateView(msg)
+
+	case tea.MouseMsg:
+		return m.updateMouse(msg)
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -279,6 +444,25 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// updateView passes a key to the current view.
+func (m Model) updateView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.view {
+	case viewInspect:
+		return m.updateInspect(msg)
+	case viewExplain:
+		return m.updateExplain(msg)
+	case viewAnalytics:
+		return m.updateAnalytics(msg)
+	case viewTimeline:
+		return m.updateTimeline(msg)
+	case viewHelp:
+		return m.updateHelp(msg)
+	case viewList:
+		return m.updateList(msg)
+	}
+	return m, nil
+}
+
 // View renders the TUI.
 func (m Model) View() string {
 	if m.width == 0 {
@@ -289,8 +473,22 @@ func (m Model) View() string {
 		return friendlyError(m.err, m.width)
 	}
 
+	if m.view == viewHelp {
+		return m.renderHelp()
+	}
+
 	if len(m.events) == 0 {
-		return "Waiting for queries..."
+		waiting := "Waiting for queries..."
+		if m.offline {
+			waiting = "No queries loaded."
+		}
+		if m.reconnecting {
+			waiting = "Reconnecting to sql-tapd..."
+		}
+		if m.wroteMessage != "" {
+			return overlayAlert(waiting, m.wroteMessage, m.width)
+		}
+		return waiting
 	}
 
 	var view string
@@ -303,44 +501,16 @@ func (m Model) View() string {
 		view = m.renderAnalytics()
 	case viewTimeline:
 		view = m.renderTimeline()
+	case viewHelp:
+		view = m.renderHelp()
 	case viewList:
-		var footer string
-		switch {
-		case m.searchMode:
-			footer = "  / " + renderInputWithCursor(m.searchQuery, m.searchCursor)
-		case m.filterMode:
-			footer = "  filter: " + renderInputWithCursor(m.filterQuery, m.filterCursor)
-		case m.writeMode:
-			footer = "  write: [j]son [m]arkdown"
-		default:
-			items := []string{
-				"q: quit", "j/k: navigate", "space: toggle tx",
-				"enter: inspect", "a: analytics", "t: timeline",
-				"c/C: copy", "x/X: explain",
-				"e/E: edit+explain", "/: search", "f: filter", "s: sort",
-				"w: write", "p: pause", "ctrl+l: clear",
-			}
-			footer = wrapFooterItems(items, m.width)
-			if m.paused {
-				footer += "  " + lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true).Render("[PAUSED]")
-			}
-			if m.filterQuery != "" {
-				footer += "\n  " + fmt.Sprintf("[filter: %s]", describeFilter(m.filterQuery))
-			}
-			if m.searchQuery != "" || m.filterQuery != "" {
-				footer += "  esc: clear"
-			}
-			if m.sortMode == sortDuration {
-				footer += "  [sorted: duration]"
-			}
-		}
-
-		footerLines := strings.Count(footer, "\n") + 1
-		listHeight := m.listHeight(footerLines)
+		footer := m.listFooter()
+		preview := m.renderPreview()
+		listHeight := m.listHeightFor(lipgloss.Height(footer), lipgloss.Height(preview))
 
 		view = strings.Join([]string{
 			m.renderList(listHeight),
-			m.renderPreview(),
+			preview,
 			footer,
 		}, "\n")
 	}
@@ -348,29 +518,131 @@ func (m Model) View() string {
 	if m.wroteMessage != "" {
 		view = overlayAlert(view, m.wroteMessage, m.width)
 	}
+	if m.confirmAnalyze != nil {
+		view = overlayAlert(view, analyzePrompt(m.confirmAnalyze.query), m.width)
+	}
 
 	return view
 }
 
-func (m Model) listHeight(footerLines int) int {
-	// 12 = header border (1) + preview box (~8-9 lines) + footer (1) + padding.
-	// Adjust by extra footer lines beyond the default 1.
-	extra := max(footerLines-1, 0)
-	return max(m.height-12-extra, 3)
+// listFooter renders the list view's footer: the prompt being typed, or the
+// key hints followed by status indicators.
+func (m Model) listFooter() string {
+	var footer string
+	switch {
+	case m.searchMode:
+		footer = "  / " + renderInputWithCursor(m.searchQuery, m.searchCursor)
+		if isRegexSearch(m.searchQuery) {
+			footer += "  [regex]"
+		}
+	case m.filterMode:
+		footer = "  filter: " + renderInputWithCursor(m.filterQuery, m.filterCursor)
+	case m.writeMode:
+		footer = "  write: [j]son [m]arkdown [c]sv [d]ump"
+	case m.noteMode:
+		footer = "  note: " + renderInputWithCursor(m.noteInput, m.noteCursor)
+	default:
+		footer = wrapFooterItems(footerItems(viewList), m.width)
+		if m.paused {
+			footer += "  " + lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true).
+				Render(fmt.Sprintf("[PAUSED (%d buffered)]", m.buffered))
+		}
+		if m.reconnecting {
+			footer += "  " + lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true).
+				Render("[reconnecting…]")
+		}
+		if m.offline {
+			footer += "  [offline]"
+		}
+		if m.dropped > 0 {
+			footer += "  " + lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true).
+				Render(fmt.Sprintf("⚠ %d dropped", m.dropped))
+		}
+		if m.filterQuery != "" {
+			footer += "\n  " + fmt.Sprintf("[filter: %s]", describeFilter(m.filterQuery))
+		}
+		if isRegexSearch(m.searchQuery) {
+			footer += "  " + fmt.Sprintf("[regex: %s]", strings.TrimPrefix(m.searchQuery, regexSearchPrefix))
+		}
+		if m.searchQuery != "" || m.filterQuery != "" {
+			footer += "  esc: clear"
+		}
+		if m.sortMode != sortChronological {
+			footer += "  [sorted: " + m.sortMode.String() + "]"
+		}
+		if m.txContext {
+			footer += "  [tx context]"
+		}
+		if m.pinnedOnly {
+			footer += "  [pinned only]"
+		}
+	}
+	return footer
+}
+
+// listHeight returns the number of rows, header included, the list gets
+// above the preview of the current row and the footer.
+func (m Model) listHeight() int {
+	return m.listHeightFor(lipgloss.Height(m.listFooter()), lipgloss.Height(m.renderPreview()))
+}
+
+// listHeightFor is listHeight for a preview of previewLines lines.
+func (m Model) listHeightFor(footerLines, previewLines int) int {
+	const border = 2 // top and bottom of the list box
+	return max(m.height-border-previewLines-footerLines, 3)
 }
 
 // rebuild wraps rebuildDisplayRows for convenience.
 func (m Model) rebuild() Model {
 	m.displayRows, m.txColorMap = m.rebuildDisplayRows()
+	if m.collapseRepeats && m.sortMode == sortChronological {
+		m.displayRows = m.groupRepeats(m.displayRows)
+	}
+	m.templateCount = countTemplates(m.events)
+	m.dupTxs, m.dupEvents = txDuplicates(m.events)
 	return m
 }
 
+// eventLess reports whether a sorts before b in the list under mode. It
+// returns false for chronological order, which is the order events arrive in.
+func eventLess(a, b *tapv1.QueryEvent, mode sortMode) bool {
+	switch mode {
+	case sortDuration:
+		return a.GetDuration().AsDuration() > b.GetDuration().AsDuration()
+	case sortRows:
+		return a.GetRowsAffected() > b.GetRowsAffected()
+	case sortOp:
+		return eventOpLabel(a) < eventOpLabel(b)
+	case sortChronological:
+	}
+	return false
+}
+
 func (m Model) rebuildDisplayRows() ([]displayRow, map[string]lipgloss.Color) {
 	matchedEvents := matchingEventsFiltered(m.events, m.filterQuery, m.searchQuery)
+	if m.pinnedOnly {
+		for i, ev := range m.events {
+			if !m.isPinned(ev) {
+				delete(matchedEvents, i)
+			}
+		}
+	}
 
-	active := m.filterQuery != "" || m.searchQuery != ""
-	// When filtering or sorting by duration, show flat list (no tx grouping).
-	if active || m.sortMode == sortDuration {
+	active := m.filterQuery != "" || m.searchQuery != "" || m.pinnedOnly
+	// In tx context mode, keep the tx grouping and include every transaction
+	// that contains a match, so failures are shown alongside their siblings.
+	var txMatched map[string]bool
+	if active && m.txContext && m.sortMode == sortChronological {
+		txMatched = make(map[string]bool)
+		for i, ev := range m.events {
+			if matchedEvents[i] && ev.GetTxId() != "" {
+				txMatched[ev.GetTxId()] = true
+			}
+		}
+		active = false
+	}
+	// When filtering or sorting, show flat list (no tx grouping).
+	if active || m.sortMode != sortChronological {
 		var rows []displayRow
 		colorMap := make(map[string]lipgloss.Color)
 		txCount := 0
@@ -389,11 +661,10 @@ func (m Model) rebuildDisplayRows() ([]displayRow, map[string]lipgloss.Color) {
 				eventIdx: i,
 			})
 		}
-		if m.sortMode == sortDuration {
-			sort.Slice(rows, func(a, b int) bool {
-				da := m.events[rows[a].eventIdx].GetDuration().AsDuration()
-				db := m.events[rows[b].eventIdx].GetDuration().AsDuration()
-				return da > db // slowest first
+		if m.sortMode != sortChronological {
+			// Stable, so ties stay in chronological order.
+			sort.SliceStable(rows, func(a, b int) bool {
+				return eventLess(m.events[rows[a].eventIdx], m.events[rows[b].eventIdx], m.sortMode)
 			})
 		}
 		return rows, colorMap
@@ -409,7 +680,10 @@ func (m Model) rebuildDisplayRows() ([]displayRow, map[string]lipgloss.Color) {
 		txID := ev.GetTxId()
 
 		switch {
-		case txID != "" && proxy.Op(ev.GetOp()) == proxy.OpBegin && !seenTx[txID]:
+		case txMatched != nil && !txMatched[txID] && !matchedEvents[i]:
+			// Tx context mode: neither the event nor its transaction matched.
+		case txID != "" && !seenTx[txID]:
+			// First event of a tx: a BEGIN, or the implicit start under autocommit=0.
 			seenTx[txID] = true
 			colorMap[txID] = txColors[txCount%len(txColors)]
 			txCount++
@@ -449,20 +723,18 @@ func (m Model) rebuildDisplayRows() ([]displayRow, map[string]lipgloss.Color) {
 
 // matchingEventsFiltered returns a set of event indices that pass both the structured
 // filter (filterQuery) and the text search (searchQuery). Either may be empty.
+// A searchQuery starting with "/" is matched as a regular expression.
 func matchingEventsFiltered(events []*tapv1.QueryEvent, filterQuery, searchQuery string) map[int]bool {
 	matched := make(map[int]bool, len(events))
 
-	var filterConds []filterCondition
-	if filterQuery != "" {
-		filterConds = parseFilter(filterQuery)
-	}
-	searchLower := strings.ToLower(searchQuery)
+	filter := parseFilterExpr(filterQuery)
+	search := searchRegexp(searchQuery)
 
 	for i, ev := range events {
-		if len(filterConds) > 0 && !matchAllConditions(ev, filterConds) {
+		if !filter.matches(ev) {
 			continue
 		}
-		if searchLower != "" && !strings.Contains(strings.ToLower(ev.GetQuery()), searchLower) {
+		if search != nil && !search.MatchString(ev.GetQuery()) {
 			continue
 		}
 		matched[i] = true
@@ -472,10 +744,10 @@ func matchingEventsFiltered(events []*tapv1.QueryEvent, filterQuery, searchQuery
 
 // txQueryCount returns the number of non-lifecycle events in a tx.
 // Lifecycle ops (Begin, Commit, Rollback, Bind, Prepare) are skipped.
-func (m Model) txQueryCount(indices []int) int {
+func txQueryCount(events []*tapv1.QueryEvent, indices []int) int {
 	n := 0
 	for _, idx := range indices {
-		switch proxy.Op(m.events[idx].GetOp()) {
+		switch proxy.Op(events[idx].GetOp()) {
 		case proxy.OpBegin, proxy.OpCommit, proxy.OpRollback, proxy.OpBind, proxy.OpPrepare:
 		case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
 			n++
@@ -484,14 +756,25 @@ func (m Model) txQueryCount(indices []int) int {
 	return n
 }
 
+// txFailed reports whether any of the transaction's events ran in, or
+// ended, a transaction the server reported as failed.
+func txFailed(events []*tapv1.QueryEvent, indices []int) bool {
+	for _, idx := range indices {
+		if events[idx].GetTxFailed() {
+			return true
+		}
+	}
+	return false
+}
+
 // txWallDuration returns the wall-clock duration from the first event's StartTime
 // to the last event's StartTime + Duration.
-func (m Model) txWallDuration(indices []int) time.Duration {
+func txWallDuration(events []*tapv1.QueryEvent, indices []int) time.Duration {
 	if len(indices) == 0 {
 		return 0
 	}
-	first := m.events[indices[0]]
-	last := m.events[indices[len(indices)-1]]
+	first := events[indices[0]]
+	last := events[indices[len(indices)-1]]
 
 	start := first.GetStartTime().AsTime()
 	end := last.GetStartTime().AsTime().Add(last.GetDuration().AsDuration())
@@ -509,6 +792,8 @@ func (m Model) cursorTxID() string {
 		return dr.txID
 	case rowEvent:
 		return m.events[dr.eventIdx].GetTxId()
+	case rowRepeat:
+		return m.events[dr.events[0]].GetTxId()
 	}
 	return ""
 }
@@ -549,8 +834,38 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	if m.writeMode {
 		return m.updateWrite(msg)
 	}
+	if m.noteMode {
+		return m.updateNote(msg)
+	}
 
-	switch msg.String() {
+	key := msg.String()
+	if d, ok := countDigit(key, m.keyCount); ok {
+		m.keyCount = min(m.keyCount*10+d, maxKeyCount)
+		return m, nil
+	}
+	count := m.keyCount
+	m.keyCount = 0
+	if key == "g" {
+		if !m.pendingG {
+			m.pendingG = true
+			m.keyCount = count
+			return m, nil
+		}
+		m.pendingG = false
+		m = m.jumpToRow(max(count-1, 0))
+		m.follow = false
+		return m, nil
+	}
+	m.pendingG = false
+
+	switch key {
+	case "G":
+		if count > 0 {
+			return m.jumpToRow(count - 1), nil
+		}
+		m = m.jumpToRow(len(m.displayRows) - 1)
+		m.follow = true
+		return m, nil
 	case "q", "ctrl+c":
 		if m.conn != nil {
 			_ = m.conn.Close()
@@ -568,9 +883,11 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.startEditExplain(explainModeFromKey(msg.String()))
 	case "c", "C":
 		return m.copyQuery(msg.String() == "C")
+	case "y", "Y":
+		return m.copyAllQueries(msg.String() == "Y")
 	case "/":
 		m.searchMode = true
-		m.searchQuery = ""
+		m = m.withSearch("")
 		m.searchCursor = 0
 		return m, nil
 	case "f":
@@ -584,14 +901,37 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "s":
 		return m.toggleSort(), nil
 	case "p":
-		m.paused = !m.paused
+		return m.togglePause(), nil
+	case "A":
+		return m.startNote(), nil
+	case "m":
+		return m.togglePin()
+	case "M":
+		return m.togglePinnedOnly(), nil
+	case "R":
+		m.showRows = !m.showRows
 		return m, nil
-	case "ctrl+l":
-		m.events = nil
-		m.displayRows = nil
-		m.cursor = 0
-		m.collapsed = make(map[string]bool)
+	case ">":
+		m.wideQuery = true
+		return m, nil
+	case "<":
+		m.wideQuery = false
+		return m, nil
+	case "z":
+		return m.toggleCollapseRepeats(), nil
+	case "F":
+		return m.toggleFollow(), nil
+	case "}":
+		return m.jumpHeat(1), nil
+	case "{":
+		return m.jumpHeat(-1), nil
+	case "T":
+		m.txContext = !m.txContext
+		m = m.rebuild()
+		m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
 		return m, nil
+	case "ctrl+l":
+		return m.clearEvents().showAlert("cleared")
 	case "a":
 		return m.enterAnalytics(), nil
 	case "t":
@@ -624,7 +964,7 @@ func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case "esc":
 		m.searchMode = false
-		m.searchQuery = ""
+		m = m.withSearch("")
 		m.pendingBracket = false
 		m = m.rebuild()
 		m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
@@ -632,7 +972,7 @@ func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "backspace":
 		if m.searchCursor > 0 {
 			runes := []rune(m.searchQuery)
-			m.searchQuery = string(runes[:m.searchCursor-1]) + string(runes[m.searchCursor:])
+			m = m.withSearch(string(runes[:m.searchCursor-1]) + string(runes[m.searchCursor:]))
 			m.searchCursor--
 			m = m.rebuild()
 			m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
@@ -668,7 +1008,7 @@ func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 
 	runes := []rune(m.searchQuery)
-	m.searchQuery = string(runes[:m.searchCursor]) + string(r) + string(runes[m.searchCursor:])
+	m = m.withSearch(string(runes[:m.searchCursor]) + string(r) + string(runes[m.searchCursor:]))
 	m.searchCursor += len(r)
 	m = m.rebuild()
 	m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
@@ -743,6 +1083,10 @@ func (m Model) updateWrite(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, m.runExport(exportJSON)
 	case "m":
 		return m, m.runExport(exportMarkdown)
+	case "c":
+		return m, m.runExport(exportCSV)
+	case "d":
+		return m, m.runExport(exportDump)
 	}
 	return m, nil
 }
@@ -752,15 +1096,34 @@ func (m Model) runExport(format exportFormat) tea.Cmd {
 	copy(events, m.events)
 	filterQuery := m.filterQuery
 	searchQuery := m.searchQuery
+	notes := maps.Clone(m.notes)
+	exportDir, exportName := m.opts.ExportDir, m.opts.ExportName
 	return func() tea.Msg {
 		path, err := writeExport(
-			events, filterQuery, searchQuery, format, "",
+			events, filterQuery, searchQuery, notes, format, exportDir, exportName,
 		)
 		return exportResultMsg{path: path, err: err}
 	}
 }
 
+// runAnalyticsExport writes the analytics rows as shown, in their current
+// grouping, search and sort order.
+func (m Model) runAnalyticsExport(format exportFormat) tea.Cmd {
+	rows := analyticsExportRows(m.events, m.analyticsRows, m.analyticsGroup)
+	group, sortMode := m.analyticsGroup, m.analyticsSortMode
+	exportDir, exportName := m.opts.ExportDir, m.opts.ExportName
+	return func() tea.Msg {
+		path, err := writeAnalyticsExport(rows, group, sortMode, format, exportDir, exportName)
+		return exportResultMsg{path: path, err: err}
+	}
+}
+
 func (m Model) toggleTx() Model {
+	if m.cursor >= 0 && m.cursor < len(m.displayRows) {
+		if key := m.displayRows[m.cursor].group; key != "" {
+			return m.toggleRepeat(key)
+		}
+	}
 	txID := m.cursorTxID()
 	if txID == "" {
 		return m
@@ -776,8 +1139,54 @@ func (m Model) toggleTx() Model {
 	return m
 }
 
+// maxKeyCount caps the numeric prefix so that long digit runs cannot overflow.
+const maxKeyCount = 1_000_000
+
+// countDigit reports whether key extends a numeric prefix and returns its value.
+// A leading "0" is not a count, matching vim.
+func countDigit(key string, count int) (int, bool) {
+	if len(key) != 1 || key[0] < '0' || key[0] > '9' {
+		return 0, false
+	}
+	if key[0] == '0' && count == 0 {
+		return 0, false
+	}
+	return int(key[0] - '0'), true
+}
+
+// following reports whether new events move the cursor to the newest row.
+func (m Model) following() bool {
+	return m.follow || m.followPinned
+}
+
+// toggleFollow switches follow mode on or off explicitly. Turning it on jumps
+// to the newest row and pins it so that moving the cursor does not turn it
+// off again; turning it off also clears the implicit follow.
+func (m Model) toggleFollow() Model {
+	if m.following() {
+		m.follow = false
+		m.followPinned = false
+		return m
+	}
+	m.followPinned = true
+	m.follow = true
+	m.cursor = max(len(m.displayRows)-1, 0)
+	return m
+}
+
+// jumpToRow moves the cursor to the given display row, clamped to the list.
+// Follow mode is on only when the cursor lands on the last row.
+func (m Model) jumpToRow(row int) Model {
+	if len(m.displayRows) == 0 {
+		return m
+	}
+	m.cursor = min(max(row, 0), len(m.displayRows)-1)
+	m.follow = m.cursor == len(m.displayRows)-1
+	return m
+}
+
 func (m Model) pageScroll(key string) Model {
-	half := max(m.listHeight(1)/2, 1)
+	half := max(m.listHeight()/2, 1)
 	switch key {
 	case "ctrl+d", "pgdown":
 		m.cursor = min(m.cursor+half, max(len(m.displayRows)-1, 0))
@@ -793,12 +1202,12 @@ func (m Model) pageScroll(key string) Model {
 
 func (m Model) navigateCursor(key string) Model {
 	switch key {
-	case "up":
+	case "k", "up":
 		if m.cursor > 0 {
 			m.cursor--
 			m.follow = false
 		}
-	case "down":
+	case "j", "down":
 		if len(m.displayRows) > 0 && m.cursor < len(m.displayRows)-1 {
 			m.cursor++
 		}
@@ -857,6 +1266,54 @@ func (m Model) copyQuery(withArgs bool) (Model, tea.Cmd) {
 	return m.showAlert("copied!")
 }
 
+// copyCommand copies a shell command that re-runs the query under the cursor,
+// with its args bound, using the command-line client of the upstream driver.
+func (m Model) copyCommand() (Model, tea.Cmd) {
+	ev := m.cursorEvent()
+	if ev == nil || ev.GetQuery() == "" {
+		return m, nil
+	}
+	cmd, ok := shellCommand(m.serverInfo.GetDriver(), query.Bind(ev.GetQuery(), ev.GetArgs()))
+	if !ok {
+		return m.showAlert("driver unknown")
+	}
+	_ = clipboard.Copy(context.Background(), cmd)
+	return m.showAlert("copied command!")
+}
+
+// copyAllQueries copies every query passing the active filter and search,
+// one per line.
+func (m Model) copyAllQueries(withArgs bool) (Model, tea.Cmd) {
+	queries := m.visibleQueries(withArgs)
+	if len(queries) == 0 {
+		return m, nil
+	}
+	_ = clipboard.Copy(context.Background(), strings.Join(queries, "\n"))
+	if len(queries) == 1 {
+		return m.showAlert("copied 1 query")
+	}
+	return m.showAlert(fmt.Sprintf("copied %d queries", len(queries)))
+}
+
+// visibleQueries returns the queries of shown events that pass the active
+// filter, search and pinned-only mode, in capture order. Events buffered while
+// paused are excluded.
+func (m Model) visibleQueries(withArgs bool) []string {
+	events := m.events[:len(m.events)-m.buffered]
+	var queries []string
+	for _, ev := range filteredEvents(events, m.filterQuery, m.searchQuery) {
+		q := ev.GetQuery()
+		if q == "" || (m.pinnedOnly && !m.isPinned(ev)) {
+			continue
+		}
+		if withArgs {
+			q = query.Bind(q, ev.GetArgs())
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
 func (m Model) showAlert(msg string) (Model, tea.Cmd) {
 	m.alertSeq++
 	m.wroteMessage = msg
@@ -866,13 +1323,52 @@ func (m Model) showAlert(msg string) (Model, tea.Cmd) {
 	})
 }
 
+// clearEvents discards all captured events on the client side. The stream
+// keeps running, so new events continue to arrive.
+func (m Model) clearEvents() Model {
+	m.events = nil
+	m.inFlight = make(map[string]int)
+	m.displayRows = nil
+	m.txColorMap = nil
+	m.templateCount = 0
+	m.rates = rateRing{}
+	m.cursor = 0
+	m.follow = true
+	m.buffered = 0
+	m.collapsed = make(map[string]bool)
+	m.notes = make(map[string]string)
+	m.pins = make(map[string]bool)
+	m.pinnedOnly = false
+	m.analyticsRows = nil
+	m.analyticsCursor = 0
+	m.analyticsHScroll = 0
+	m.analyticsSearch = ""
+	m.analyticsSearchCursor = 0
+	m.timelineScroll = 0
+	return m
+}
+
+// togglePause pauses or resumes the live list. Resuming shows the events
+// buffered while paused and jumps to the latest one.
+func (m Model) togglePause() Model {
+	m.paused = !m.paused
+	if m.paused {
+		return m
+	}
+	m.buffered = 0
+	m = m.rebuild()
+	if m.sortMode == sortChronological {
+		m.follow = true
+		m.cursor = max(len(m.displayRows)-1, 0)
+	}
+	return m
+}
+
 func (m Model) toggleSort() Model {
-	switch m.sortMode {
-	case sortChronological:
-		m.sortMode = sortDuration
+	m.sortMode = m.sortMode.next()
+	if m.sortMode != sortChronological {
 		m.follow = false
-	case sortDuration:
-		m.sortMode = sortChronological
+		m.followPinned = false
 	}
 	m = m.rebuild()
 	m.cursor = 0
@@ -880,10 +1376,9 @@ func (m Model) toggleSort() Model {
 }
 
 func (m Model) enterAnalytics() Model {
-	m.analyticsRows = m.buildAnalyticsRows()
-	sortAnalyticsRows(m.analyticsRows, m.analyticsSortMode)
 	m.analyticsCursor = 0
 	m.analyticsHScroll = 0
+	m = m.refreshAnalyticsRows()
 	m.view = viewAnalytics
 	return m
 }
@@ -891,7 +1386,7 @@ func (m Model) enterAnalytics() Model {
 func (m Model) clearFilter() Model {
 	changed := false
 	if m.searchQuery != "" {
-		m.searchQuery = ""
+		m = m.withSearch("")
 		changed = true
 	}
 	if m.filterQuery != "" {
@@ -937,13 +1432,5 @@ func (m Model) startExplain(mode explain.Mode) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	m.view = viewExplain
-	m.explainPlan = ""
-	m.explainErr = nil
-	m.explainScroll = 0
-	m.explainHScroll = 0
-	m.explainMode = mode
-	m.explainQuery = ev.GetQuery()
-	m.explainArgs = ev.GetArgs()
-	return m, runExplain(m.client, mode, ev.GetQuery(), ev.GetArgs())
+	return m.openExplain(mode, explainTarget{query: ev.GetQuery(), args: ev.GetArgs(), argTypes: ev.GetArgTypes()})
 }
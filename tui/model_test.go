@@ -0,0 +1,1088 @@
+package tui //nolint:testpackage // testing internal model state
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func keyMsg(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func update(t *testing.T, m Model, msg tea.Msg) Model {
+	t.Helper()
+	next, _ := m.Update(msg)
+	mm, ok := next.(Model)
+	if !ok {
+		t.Fatalf("Update returned %T, want Model", next)
+	}
+	return mm
+}
+
+func TestPauseBuffersEvents(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	m.follow = true
+
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	if len(m.displayRows) != 1 {
+		t.Fatalf("displayRows = %d, want 1", len(m.displayRows))
+	}
+
+	m = update(t, m, keyMsg("p"))
+	if !m.paused {
+		t.Fatal("paused = false after p")
+	}
+
+	for range 3 {
+		m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 2", time.Millisecond, "")})
+	}
+	if len(m.events) != 4 {
+		t.Errorf("events = %d, want 4 (events must not be dropped while paused)", len(m.events))
+	}
+	if len(m.displayRows) != 1 {
+		t.Errorf("displayRows = %d while paused, want 1", len(m.displayRows))
+	}
+	if m.buffered != 3 {
+		t.Errorf("buffered = %d, want 3", m.buffered)
+	}
+
+	m = update(t, m, keyMsg("p"))
+	if m.paused {
+		t.Fatal("paused = true after second p")
+	}
+	if m.buffered != 0 {
+		t.Errorf("buffered = %d after resume, want 0", m.buffered)
+	}
+	if len(m.displayRows) != 4 {
+		t.Errorf("displayRows = %d after resume, want 4", len(m.displayRows))
+	}
+	if m.cursor != 3 {
+		t.Errorf("cursor = %d after resume, want 3 (latest)", m.cursor)
+	}
+}
+
+func TestNoteSurvivesFiltering(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	ev1 := makeEvent(proxy.OpQuery, "SELECT * FROM carts", time.Millisecond, "")
+	ev1.Id = "1"
+	ev2 := makeEvent(proxy.OpQuery, "SELECT * FROM users", time.Millisecond, "")
+	ev2.Id = "2"
+	m = update(t, m, eventMsg{Event: ev1})
+	m = update(t, m, eventMsg{Event: ev2})
+	m.cursor = 0
+
+	m = update(t, m, keyMsg("A"))
+	if !m.noteMode {
+		t.Fatal("noteMode = false after A")
+	}
+	m = update(t, m, keyMsg("cart page"))
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if m.noteMode {
+		t.Fatal("noteMode = true after enter")
+	}
+	if got := m.notes["1"]; got != "cart page" {
+		t.Fatalf("notes[1] = %q, want %q", got, "cart page")
+	}
+
+	m.filterQuery = "users"
+	m = m.rebuild()
+	m.filterQuery = ""
+	m = m.rebuild()
+	if got := m.notes["1"]; got != "cart page" {
+		t.Errorf("notes[1] = %q after filtering, want %q", got, "cart page")
+	}
+
+	// Editing with an empty note removes it.
+	m.cursor = 0
+	m = update(t, m, keyMsg("A"))
+	if m.noteInput != "cart page" {
+		t.Errorf("noteInput = %q, want existing note", m.noteInput)
+	}
+	for range len("cart page") {
+		m = update(t, m, tea.KeyMsg{Type: tea.KeyBackspace})
+	}
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	if _, ok := m.notes["1"]; ok {
+		t.Error("empty note should remove the entry")
+	}
+}
+
+func TestClearEvents(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	ev := makeEvent(proxy.OpBegin, "BEGIN", time.Millisecond, "")
+	ev.Id, ev.TxId = "1", "tx-1"
+	m = update(t, m, eventMsg{Event: ev})
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	m.notes["1"] = "note"
+	m = update(t, m, keyMsg("a"))
+	m = update(t, m, keyMsg("q"))
+
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyCtrlL})
+	if len(m.events) != 0 || len(m.displayRows) != 0 || m.cursor != 0 {
+		t.Errorf("events = %d, displayRows = %d, cursor = %d; want all zero",
+			len(m.events), len(m.displayRows), m.cursor)
+	}
+	if len(m.txColorMap) != 0 || len(m.notes) != 0 || len(m.analyticsRows) != 0 {
+		t.Error("tx colors, notes, and analytics rows should be reset")
+	}
+	if m.wroteMessage != "cleared" {
+		t.Errorf("alert = %q, want %q", m.wroteMessage, "cleared")
+	}
+
+	next := makeEvent(proxy.OpQuery, "SELECT 2", time.Millisecond, "")
+	next.NormalizedQuery = "SELECT ?"
+	m = update(t, m, eventMsg{Event: next})
+	if len(m.displayRows) != 1 {
+		t.Errorf("displayRows = %d after new event, want 1", len(m.displayRows))
+	}
+	m = m.enterAnalytics()
+	if len(m.analyticsRows) != 1 || m.analyticsRows[0].count != 1 {
+		t.Errorf("analyticsRows = %+v, want a single row with count 1", m.analyticsRows)
+	}
+}
+
+func TestTxContextFilter(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	txEvent := func(op proxy.Op, q, errMsg string) *tapv1.QueryEvent {
+		ev := makeEvent(op, q, time.Millisecond, errMsg)
+		ev.TxId = "tx-1"
+		return ev
+	}
+	for _, ev := range []*tapv1.QueryEvent{
+		txEvent(proxy.OpBegin, "BEGIN", ""),
+		txEvent(proxy.OpQuery, "UPDATE carts SET total = 1", ""),
+		txEvent(proxy.OpQuery, "INSERT INTO orders VALUES (1)", "duplicate key"),
+		txEvent(proxy.OpRollback, "ROLLBACK", ""),
+		makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, ""),
+		makeEvent(proxy.OpQuery, "SELECT 2", time.Millisecond, "timeout"),
+	} {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	m.filterQuery = "error"
+	m = m.rebuild()
+	if len(m.displayRows) != 2 {
+		t.Fatalf("strict mode: displayRows = %d, want 2", len(m.displayRows))
+	}
+
+	m = update(t, m, keyMsg("T"))
+	if !m.txContext {
+		t.Fatal("txContext = false after T")
+	}
+	// Tx summary + 4 tx events + the failed non-tx SELECT.
+	if len(m.displayRows) != 6 {
+		t.Fatalf("context mode: displayRows = %d, want 6", len(m.displayRows))
+	}
+	if m.displayRows[0].kind != rowTxSummary || m.displayRows[0].txID != "tx-1" {
+		t.Errorf("displayRows[0] = %+v, want tx summary for tx-1", m.displayRows[0])
+	}
+	if last := m.displayRows[5]; last.kind != rowEvent || last.eventIdx != 5 {
+		t.Errorf("displayRows[5] = %+v, want failed SELECT", last)
+	}
+
+	m.filterQuery = "SELECT 1"
+	m = m.rebuild()
+	if len(m.displayRows) != 1 || m.displayRows[0].eventIdx != 4 {
+		t.Errorf("context mode without tx match: displayRows = %+v, want only SELECT 1", m.displayRows)
+	}
+}
+
+func TestTxDuplicates(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	txEvent := func(txID string, op proxy.Op, q string, args ...string) *tapv1.QueryEvent {
+		ev := makeEvent(op, q, time.Millisecond, "")
+		ev.TxId = txID
+		ev.Args = args
+		return ev
+	}
+	for _, ev := range []*tapv1.QueryEvent{
+		txEvent("tx-1", proxy.OpBegin, "BEGIN"),
+		txEvent("tx-1", proxy.OpExecute, "SELECT * FROM users WHERE id = $1", "1"),
+		txEvent("tx-1", proxy.OpExecute, "SELECT * FROM users WHERE id = $1", "2"),
+		txEvent("tx-1", proxy.OpExecute, "SELECT * FROM users WHERE id = $1", "1"),
+		txEvent("tx-1", proxy.OpExec, "UPDATE users SET seen = true"),
+		txEvent("tx-1", proxy.OpExec, "UPDATE users SET seen = true"),
+		txEvent("tx-1", proxy.OpCommit, "COMMIT"),
+		// Still open: repeats are not flagged until it ends.
+		txEvent("tx-2", proxy.OpBegin, "BEGIN"),
+		txEvent("tx-2", proxy.OpQuery, "SELECT 1"),
+		txEvent("tx-2", proxy.OpQuery, "SELECT 1"),
+	} {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	if got := m.dupTxs["tx-1"]; got != 1 {
+		t.Errorf("dupTxs[tx-1] = %d, want 1", got)
+	}
+	if got := m.dupTxs["tx-2"]; got != 0 {
+		t.Errorf("dupTxs[tx-2] = %d, want 0 while open", got)
+	}
+	var repeated []int
+	for i := range m.events {
+		if m.dupEvents[i] {
+			repeated = append(repeated, i)
+		}
+	}
+	if want := []int{1, 3}; !slices.Equal(repeated, want) {
+		t.Errorf("repeated events = %v, want %v", repeated, want)
+	}
+
+	if row := m.renderTxSummaryRow(m.displayRows[0], false, 40); !strings.Contains(row, "DUP") ||
+		!strings.Contains(row, "1 repeated") {
+		t.Errorf("tx-1 summary row %q does not mark the duplicate", row)
+	}
+	if row := m.renderEventRow(m.displayRows[2], 2, false, 40); !strings.Contains(row, "DUP") {
+		t.Errorf("repeated SELECT row %q has no DUP marker", row)
+	}
+	if row := m.renderEventRow(m.displayRows[3], 3, false, 40); strings.Contains(row, "DUP") {
+		t.Errorf("SELECT with other args %q is marked DUP", row)
+	}
+
+	m = update(t, m, eventMsg{Event: txEvent("tx-2", proxy.OpRollback, "ROLLBACK")})
+	if got := m.dupTxs["tx-2"]; got != 1 {
+		t.Errorf("dupTxs[tx-2] = %d after rollback, want 1", got)
+	}
+}
+
+func TestTxFailed(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	txEvent := func(txID string, op proxy.Op, q, errMsg string, failed bool) *tapv1.QueryEvent {
+		ev := makeEvent(op, q, time.Millisecond, errMsg)
+		ev.TxId = txID
+		ev.TxFailed = failed
+		return ev
+	}
+	for _, ev := range []*tapv1.QueryEvent{
+		txEvent("tx-1", proxy.OpBegin, "BEGIN", "", false),
+		txEvent("tx-1", proxy.OpQuery, "INSERT INTO t VALUES (1)", "duplicate key value", false),
+		txEvent("tx-1", proxy.OpQuery, "SELECT 1", "current transaction is aborted", true),
+		txEvent("tx-1", proxy.OpRollback, "COMMIT", "", true),
+		txEvent("tx-2", proxy.OpBegin, "BEGIN", "", false),
+		txEvent("tx-2", proxy.OpCommit, "COMMIT", "", false),
+	} {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	var rows []displayRow
+	for _, dr := range m.displayRows {
+		if dr.kind == rowTxSummary {
+			rows = append(rows, dr)
+		}
+	}
+	if len(rows) != 2 {
+		t.Fatalf("tx summary rows = %d, want 2", len(rows))
+	}
+	if row := m.renderTxSummaryRow(rows[0], false, 40); !strings.Contains(row, "FAIL") {
+		t.Errorf("failed tx summary row %q has no FAIL marker", row)
+	}
+	if !slices.Contains(m.inspectorTxLines(rows[0], 80), "Status:   failed, its changes are rolled back") {
+		t.Error("inspector does not report the failed transaction")
+	}
+	if row := m.renderTxSummaryRow(rows[1], false, 40); strings.Contains(row, "FAIL") {
+		t.Errorf("committed tx summary row %q is marked FAIL", row)
+	}
+}
+
+func TestVisibleQueries(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	bound := makeEvent(proxy.OpExecute, "SELECT * FROM users WHERE id = $1", time.Millisecond, "")
+	bound.Args = []string{"42"}
+	for _, ev := range []*tapv1.QueryEvent{
+		makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, ""),
+		bound,
+		makeEvent(proxy.OpExec, "UPDATE users SET name = 'x'", time.Millisecond, ""),
+		makeEvent(proxy.OpBind, "", 0, ""),
+	} {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	tests := []struct {
+		name     string
+		filter   string
+		search   string
+		withArgs bool
+		want     []string
+	}{
+		{
+			name: "all non-empty queries",
+			want: []string{"SELECT 1", "SELECT * FROM users WHERE id = $1", "UPDATE users SET name = 'x'"},
+		},
+		{
+			name:     "bound args",
+			search:   "users WHERE",
+			withArgs: true,
+			want:     []string{"SELECT * FROM users WHERE id = 42"},
+		},
+		{
+			name:   "filter",
+			filter: "op:update",
+			want:   []string{"UPDATE users SET name = 'x'"},
+		},
+		{
+			name:   "no match",
+			search: "DELETE",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			mm := m
+			mm.filterQuery = tt.filter
+			mm = mm.withSearch(tt.search)
+			got := mm.visibleQueries(tt.withArgs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	m = update(t, m, keyMsg("p"))
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 2", time.Millisecond, "")})
+	if got := m.visibleQueries(false); len(got) != 3 {
+		t.Errorf("paused: got %q, want buffered event excluded", got)
+	}
+}
+
+func TestJumpNavigation(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	m.follow = true
+	for range 20 {
+		m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	}
+	if m.cursor != 19 {
+		t.Fatalf("cursor = %d, want 19", m.cursor)
+	}
+
+	press := func(keys ...string) {
+		t.Helper()
+		for _, k := range keys {
+			m = update(t, m, keyMsg(k))
+		}
+	}
+
+	press("g", "g")
+	if m.cursor != 0 || m.follow {
+		t.Errorf("gg: cursor = %d, follow = %v, want 0, false", m.cursor, m.follow)
+	}
+
+	press("G")
+	if m.cursor != 19 || !m.follow {
+		t.Errorf("G: cursor = %d, follow = %v, want 19, true", m.cursor, m.follow)
+	}
+
+	press("1", "2", "G")
+	if m.cursor != 11 || m.follow {
+		t.Errorf("12G: cursor = %d, follow = %v, want 11, false", m.cursor, m.follow)
+	}
+
+	press("5", "g", "g")
+	if m.cursor != 4 {
+		t.Errorf("5gg: cursor = %d, want 4", m.cursor)
+	}
+
+	press("9", "9", "G")
+	if m.cursor != 19 || !m.follow {
+		t.Errorf("99G: cursor = %d, follow = %v, want 19, true", m.cursor, m.follow)
+	}
+
+	press("k")
+	if m.cursor != 18 || m.follow {
+		t.Errorf("k: cursor = %d, follow = %v, want 18, false", m.cursor, m.follow)
+	}
+
+	// A count or pending g is dropped by any other key.
+	press("3", "j", "G")
+	if m.cursor != 19 {
+		t.Errorf("count reset: cursor = %d, want 19", m.cursor)
+	}
+	press("g", "j", "g")
+	if !m.pendingG {
+		t.Error("pendingG = false after g j g, want true")
+	}
+}
+
+func TestInFlightEvents(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	start := time.Now().Add(-2 * time.Second)
+	inFlight := makeEvent(proxy.OpQuery, "SELECT pg_sleep(10)", 0, "")
+	inFlight.Id = "1"
+	inFlight.StartTime = timestamppb.New(start)
+	inFlight.NormalizedQuery = "SELECT pg_sleep(?)"
+	inFlight.InFlight = true
+
+	m = update(t, m, eventMsg{Event: inFlight})
+	if !m.spinning {
+		t.Error("spinner not started for in-flight event")
+	}
+	if len(m.displayRows) != 1 {
+		t.Fatalf("displayRows = %d, want 1", len(m.displayRows))
+	}
+	if got := m.eventDuration(m.events[0]); !strings.HasPrefix(got, spinnerFrames[0]) {
+		t.Errorf("eventDuration = %q, want spinner", got)
+	}
+	if m.templateCount != 0 {
+		t.Errorf("templateCount = %d, want in-flight event excluded", m.templateCount)
+	}
+
+	// An unrelated event from another connection with the same ID is appended.
+	other := makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")
+	other.Id = "1"
+	other.StartTime = timestamppb.Now()
+	m = update(t, m, eventMsg{Event: other})
+
+	done := makeEvent(proxy.OpQuery, "SELECT pg_sleep(10)", 10*time.Second, "")
+	done.Id = "1"
+	done.StartTime = timestamppb.New(start)
+	done.NormalizedQuery = "SELECT pg_sleep(?)"
+	m = update(t, m, eventMsg{Event: done})
+
+	if len(m.events) != 2 {
+		t.Fatalf("events = %d, want 2 (completed event replaces in-flight)", len(m.events))
+	}
+	if m.events[0] != done {
+		t.Error("events[0] is not the completed event")
+	}
+	if len(m.inFlight) != 0 {
+		t.Errorf("inFlight = %v, want empty", m.inFlight)
+	}
+	if got := m.eventDuration(m.events[0]); got != formatDuration(done.GetDuration()) {
+		t.Errorf("eventDuration = %q, want %q", got, formatDuration(done.GetDuration()))
+	}
+
+	m = update(t, m, spinnerTickMsg{})
+	if m.spinning {
+		t.Error("spinning = true after tick with nothing in flight")
+	}
+}
+
+func TestEventUpdate(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	slow := makeEvent(proxy.OpQuery, "SELECT * FROM users", 2*time.Second, "")
+	slow.Id = "1"
+	slow.SlowQuery = true
+	m = update(t, m, eventMsg{Event: slow})
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+
+	planned := proto.CloneOf(slow)
+	planned.Plan = "Seq Scan on users"
+	planned.Update = true
+	m = update(t, m, eventMsg{Event: planned})
+	if len(m.events) != 2 {
+		t.Fatalf("events = %d, want 2 (update replaces the event)", len(m.events))
+	}
+	if got := m.events[0]; got.GetPlan() != planned.GetPlan() || got.GetUpdate() {
+		t.Errorf("events[0]: Plan = %q, Update = %v, want the plan without the update flag", got.GetPlan(), got.GetUpdate())
+	}
+
+	// An update of an event no longer held is dropped.
+	gone := proto.CloneOf(planned)
+	gone.Id = "2"
+	m = update(t, m, eventMsg{Event: gone})
+	if len(m.events) != 2 {
+		t.Errorf("events = %d after an update of an unknown event, want 2", len(m.events))
+	}
+}
+
+func TestPins(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for i, q := range []string{"SELECT 1", "SELECT 2", "SELECT 3"} {
+		ev := makeEvent(proxy.OpQuery, q, time.Millisecond, "")
+		ev.Id = strconv.Itoa(i + 1)
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	m.cursor = 1
+	m = update(t, m, keyMsg("m"))
+	if !m.pins["2"] {
+		t.Fatal("event 2 not pinned after m")
+	}
+	if row := m.renderEventRow(m.displayRows[1], 1, false, 40); !strings.Contains(row, pinMarker) {
+		t.Errorf("pinned row %q has no pin marker", row)
+	}
+
+	m = update(t, m, keyMsg("M"))
+	if !m.pinnedOnly {
+		t.Fatal("pinnedOnly = false after M")
+	}
+	if len(m.displayRows) != 1 || m.displayRows[0].eventIdx != 1 {
+		t.Fatalf("displayRows = %+v, want only the pinned event", m.displayRows)
+	}
+	if got := m.visibleQueries(false); len(got) != 1 || got[0] != "SELECT 2" {
+		t.Errorf("visibleQueries = %q, want [SELECT 2]", got)
+	}
+
+	// Pins survive rebuilds triggered by new events.
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 4", time.Millisecond, "")})
+	if len(m.displayRows) != 1 {
+		t.Errorf("displayRows = %d after new event, want 1", len(m.displayRows))
+	}
+
+	m.cursor = 0
+	m = update(t, m, keyMsg("m"))
+	if len(m.pins) != 0 || len(m.displayRows) != 0 {
+		t.Errorf("pins = %v, displayRows = %d after unpin, want none", m.pins, len(m.displayRows))
+	}
+
+	m = update(t, m, keyMsg("M"))
+	if m.pinnedOnly || len(m.displayRows) != 4 {
+		t.Errorf("pinnedOnly = %v, displayRows = %d after second M, want false, 4", m.pinnedOnly, len(m.displayRows))
+	}
+}
+
+func TestListFillsHeight(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for i := range 60 {
+		ev := makeEvent(proxy.OpQuery, "SELECT * FROM users WHERE id = $1", time.Millisecond, "")
+		ev.Id = strconv.Itoa(i)
+		if i%2 == 0 {
+			ev.Args = []string{strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 40)}
+			ev.Error = "boom"
+		}
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	// Previews of different heights leave the list the rest of the screen.
+	for _, cursor := range []int{58, 59} {
+		m.cursor = cursor
+		if got := lipgloss.Height(m.View()); got != m.height {
+			t.Errorf("cursor %d: view is %d lines, want %d", cursor, got, m.height)
+		}
+	}
+}
+
+func TestViewCycle(t *testing.T) {
+	t.Parallel()
+
+	tab := tea.KeyMsg{Type: tea.KeyTab}
+	shiftTab := tea.KeyMsg{Type: tea.KeyShiftTab}
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for _, q := range []string{"SELECT 1", "UPDATE t SET a = 1"} {
+		ev := makeEvent(proxy.OpQuery, q, time.Millisecond, "")
+		ev.NormalizedQuery = q
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	tests := []struct {
+		msg  tea.KeyMsg
+		want viewMode
+	}{
+		{tab, viewAnalytics},
+		{tab, viewTimeline},
+		{tab, viewList},
+		{shiftTab, viewTimeline},
+		{shiftTab, viewAnalytics},
+		{shiftTab, viewList},
+	}
+	for i, tt := range tests {
+		m = update(t, m, tt.msg)
+		if m.view != tt.want {
+			t.Fatalf("step %d: view = %d, want %d", i, m.view, tt.want)
+		}
+	}
+
+	// Analytics keeps its cursor when cycled away and back.
+	m = update(t, m, tab)
+	m = update(t, m, keyMsg("j"))
+	cursor := m.analyticsCursor
+	if cursor == 0 {
+		t.Fatal("analyticsCursor = 0 after j, want > 0")
+	}
+	m = update(t, m, shiftTab)
+	m = update(t, m, tab)
+	if m.analyticsCursor != cursor {
+		t.Errorf("analyticsCursor = %d after cycling back, want %d", m.analyticsCursor, cursor)
+	}
+
+	// Inspect counts as the list view.
+	m = update(t, m, shiftTab)
+	m.view = viewInspect
+	m = update(t, m, tab)
+	if m.view != viewAnalytics {
+		t.Errorf("tab from inspect: view = %d, want %d", m.view, viewAnalytics)
+	}
+
+	// Tab does not cycle while a prompt owns the keyboard.
+	m = update(t, m, shiftTab)
+	m = update(t, m, keyMsg("/"))
+	m = update(t, m, tab)
+	if m.view != viewList || !m.searchMode {
+		t.Errorf("tab in search: view = %d, searchMode = %v, want list, true", m.view, m.searchMode)
+	}
+}
+
+func TestHelpOverlay(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 160, 60
+
+	// Help is reachable before any query arrives.
+	m = update(t, m, keyMsg("?"))
+	if m.view != viewHelp {
+		t.Fatalf("view = %d after ?, want help", m.view)
+	}
+	out := m.View()
+	for _, s := range helpSections {
+		if !strings.Contains(out, s.title) {
+			t.Errorf("help view missing section %q", s.title)
+		}
+	}
+	m = update(t, m, serverInfoMsg{info: &tapv1.ServerInfoResponse{Driver: "postgres", Version: "16.2"}})
+	if want := "Server: postgres 16.2 · TLS: off · compression: off"; !strings.Contains(m.View(), want) {
+		t.Errorf("help view missing %q", want)
+	}
+	m = update(t, m, keyMsg("x"))
+	if m.view != viewList {
+		t.Fatalf("view = %d after closing help, want list", m.view)
+	}
+
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	m = update(t, m, keyMsg("a"))
+	m = update(t, m, keyMsg("?"))
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyTab})
+	if m.view != viewAnalytics {
+		t.Errorf("view = %d after closing help from analytics, want analytics", m.view)
+	}
+
+	// ? is a literal character while searching.
+	m = update(t, m, keyMsg("q"))
+	m = update(t, m, keyMsg("/"))
+	m = update(t, m, keyMsg("?"))
+	if m.view != viewList || m.searchQuery != "?" {
+		t.Errorf("? in search: view = %d, searchQuery = %q, want list, \"?\"", m.view, m.searchQuery)
+	}
+}
+
+func TestFooterItemsFromHelp(t *testing.T) {
+	t.Parallel()
+
+	got := footerItems(viewList)
+	for _, want := range []string{"q: quit", "a: analytics", "?: help"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("footerItems(list) = %q, missing %q", got, want)
+		}
+	}
+	if got := borderHelp(viewTimeline); !strings.HasPrefix(got, " q: back  j/k: scroll") {
+		t.Errorf("borderHelp(timeline) = %q", got)
+	}
+}
+
+func TestRowsColumn(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{ShowRows: true})
+	m.width, m.height = 140, 40
+
+	del := makeEvent(proxy.OpExec, "DELETE FROM users", time.Millisecond, "")
+	del.RowsAffected = 10000
+	sel := makeEvent(proxy.OpQuery, "SELECT * FROM users", time.Millisecond, "")
+	sel.RowsAffected = 42
+	failed := makeEvent(proxy.OpExec, "UPDATE users SET a = 1", time.Millisecond, "boom")
+	for _, ev := range []*tapv1.QueryEvent{del, sel, failed} {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	out := m.renderList(20)
+	if !strings.Contains(out, "Rows") {
+		t.Error("list header has no Rows column")
+	}
+	if row := m.renderEventRow(m.displayRows[0], 0, false, 40); !strings.Contains(row, "10000") {
+		t.Errorf("DELETE row %q does not show rows affected", row)
+	}
+	if row := m.renderEventRow(m.displayRows[1], 1, false, 40); strings.Contains(row, "42") {
+		t.Errorf("SELECT row %q shows rows affected", row)
+	}
+
+	m = update(t, m, keyMsg("R"))
+	if m.showRows || strings.Contains(m.renderList(20), "Rows") {
+		t.Error("Rows column still shown after R")
+	}
+}
+
+func TestWideQuery(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 80, 40
+
+	q := "SELECT id, name, email, created_at FROM users WHERE organization_id = $1 ORDER BY created_at DESC"
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, q, time.Millisecond, "")})
+	if out := m.renderList(20); !strings.Contains(out, "Duration") || strings.Contains(out, "FROM users") {
+		t.Fatalf("default list should show Duration and truncate the query:\n%s", out)
+	}
+
+	m = update(t, m, keyMsg(">"))
+	out := m.renderList(20)
+	if strings.Contains(out, "Duration") || strings.Contains(out, "Time") {
+		t.Errorf("wide list still shows timing columns:\n%s", out)
+	}
+	if !strings.Contains(out, "FROM users") {
+		t.Errorf("wide list does not show more of the query:\n%s", out)
+	}
+	for i, line := range strings.Split(out, "\n") {
+		if w := lipgloss.Width(line); w != m.width-2 {
+			t.Errorf("line %d is %d wide, want %d: %q", i, w, m.width-2, line)
+		}
+	}
+
+	m = update(t, m, keyMsg("<"))
+	if !strings.Contains(m.renderList(20), "Duration") {
+		t.Error("Duration column not restored after <")
+	}
+}
+
+func TestEventLess(t *testing.T) {
+	t.Parallel()
+
+	fast := makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")
+	slow := makeEvent(proxy.OpQuery, "SELECT 2", time.Second, "")
+	few := makeEvent(proxy.OpExec, "DELETE FROM a", time.Millisecond, "")
+	few.RowsAffected = 1
+	many := makeEvent(proxy.OpExec, "DELETE FROM b", time.Millisecond, "")
+	many.RowsAffected = 500
+	begin := makeEvent(proxy.OpBegin, "", time.Millisecond, "")
+
+	tests := []struct {
+		name string
+		a, b *tapv1.QueryEvent
+		mode sortMode
+		want bool
+	}{
+		{name: "chronological keeps order", a: slow, b: fast, mode: sortChronological, want: false},
+		{name: "duration slowest first", a: slow, b: fast, mode: sortDuration, want: true},
+		{name: "duration faster after", a: fast, b: slow, mode: sortDuration, want: false},
+		{name: "duration tie", a: fast, b: few, mode: sortDuration, want: false},
+		{name: "rows most first", a: many, b: few, mode: sortRows, want: true},
+		{name: "rows fewer after", a: few, b: many, mode: sortRows, want: false},
+		{name: "rows tie", a: fast, b: slow, mode: sortRows, want: false},
+		{name: "op by label", a: begin, b: fast, mode: sortOp, want: true},
+		{name: "op by label reversed", a: fast, b: begin, mode: sortOp, want: false},
+		{name: "op same label", a: few, b: many, mode: sortOp, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := eventLess(tt.a, tt.b, tt.mode); got != tt.want {
+				t.Errorf("eventLess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortCycle(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+
+	evs := []*tapv1.QueryEvent{
+		makeEvent(proxy.OpQuery, "SELECT a", 2*time.Millisecond, ""),
+		makeEvent(proxy.OpExec, "UPDATE b", time.Millisecond, ""),
+		makeEvent(proxy.OpQuery, "SELECT c", 3*time.Millisecond, ""),
+		makeEvent(proxy.OpExec, "UPDATE d", 5*time.Millisecond, ""),
+	}
+	evs[1].RowsAffected = 7
+	evs[3].RowsAffected = 3
+	for _, ev := range evs {
+		m = update(t, m, eventMsg{Event: ev})
+	}
+
+	order := func(m Model) []string {
+		var qs []string
+		for _, r := range m.displayRows {
+			qs = append(qs, m.events[r.eventIdx].GetQuery())
+		}
+		return qs
+	}
+
+	tests := []struct {
+		mode   sortMode
+		want   []string
+		footer string
+	}{
+		{mode: sortDuration, want: []string{"UPDATE d", "SELECT c", "SELECT a", "UPDATE b"}, footer: "[sorted: duration]"},
+		{mode: sortRows, want: []string{"UPDATE b", "UPDATE d", "SELECT a", "SELECT c"}, footer: "[sorted: rows]"},
+		{mode: sortOp, want: []string{"UPDATE b", "UPDATE d", "SELECT a", "SELECT c"}, footer: "[sorted: op]"},
+		{mode: sortChronological, want: []string{"SELECT a", "UPDATE b", "SELECT c", "UPDATE d"}},
+	}
+	for _, tt := range tests {
+		m = update(t, m, keyMsg("s"))
+		if m.sortMode != tt.mode {
+			t.Fatalf("sortMode = %v, want %v", m.sortMode, tt.mode)
+		}
+		if got := order(m); !slices.Equal(got, tt.want) {
+			t.Errorf("%v order = %v, want %v", tt.mode, got, tt.want)
+		}
+		footer := m.listFooter()
+		if tt.footer != "" && !strings.Contains(footer, tt.footer) {
+			t.Errorf("%v footer %q does not contain %q", tt.mode, footer, tt.footer)
+		}
+		if tt.footer == "" && strings.Contains(footer, "[sorted:") {
+			t.Errorf("chronological footer %q shows a sort", footer)
+		}
+	}
+}
+
+func TestMouse(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	for i := range 10 {
+		m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT "+strconv.Itoa(i), time.Millisecond, "")})
+	}
+	press := func(button tea.MouseButton, y int) tea.MouseMsg {
+		return tea.MouseMsg{X: 10, Y: y, Button: button, Action: tea.MouseActionPress}
+	}
+
+	// The first data row is below the top border and the header.
+	m = update(t, m, press(tea.MouseButtonLeft, 2+4))
+	if m.cursor != 4 || m.following() {
+		t.Fatalf("after clicking row 4: cursor = %d, following = %v, want 4, false", m.cursor, m.following())
+	}
+	m = update(t, m, press(tea.MouseButtonLeft, 1))
+	m = update(t, m, press(tea.MouseButtonLeft, 2+10))
+	if m.cursor != 4 {
+		t.Errorf("clicking the header or below the rows moved the cursor to %d", m.cursor)
+	}
+
+	m = update(t, m, press(tea.MouseButtonWheelUp, 0))
+	if m.cursor != 4-wheelRows {
+		t.Errorf("after wheel up: cursor = %d, want %d", m.cursor, 4-wheelRows)
+	}
+	for range 3 {
+		m = update(t, m, press(tea.MouseButtonWheelDown, 0))
+	}
+	if m.cursor != 9 || !m.following() {
+		t.Errorf("after wheeling to the bottom: cursor = %d, following = %v, want 9, true", m.cursor, m.following())
+	}
+
+	// The wheel scrolls other views.
+	m = update(t, m, tea.KeyMsg{Type: tea.KeyEnter})
+	m.height = 5 // too short for the whole inspector
+	m = update(t, m, press(tea.MouseButtonWheelDown, 0))
+	if m.view != viewInspect || m.inspectScroll == 0 {
+		t.Errorf("inspector: view = %d, scroll = %d, want inspector scrolled", m.view, m.inspectScroll)
+	}
+
+	// Prompts keep the keyboard focus.
+	m.height = 40
+	m = update(t, m, keyMsg("q"))
+	m = update(t, m, keyMsg("/"))
+	m = update(t, m, press(tea.MouseButtonLeft, 2))
+	if m.cursor != 9 {
+		t.Errorf("click while searching moved the cursor to %d", m.cursor)
+	}
+}
+
+func TestFormatRows(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"},
+		{10000, "10000"},
+		{9_999_999, "9999999"},
+		{12_345_678, "12.3M"},
+		{2_500_000_000, "2.5G"},
+	}
+	for _, tt := range tests {
+		if got := formatRows(tt.n); got != tt.want {
+			t.Errorf("formatRows(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPreviewArgLines(t *testing.T) {
+	t.Parallel()
+
+	many := make([]string, 30)
+	for i := range many {
+		many[i] = strconv.Itoa(1000 + i)
+	}
+	long := strings.Repeat("x", 100)
+
+	tests := []struct {
+		name  string
+		args  []string
+		width int
+		want  []string
+	}{
+		{
+			name:  "few short args stay on one line",
+			args:  []string{"1", "alice", "NULL"},
+			width: 80,
+			want:  []string{"Args:     [1, alice, NULL]"},
+		},
+		{
+			name:  "four args wrap",
+			args:  []string{"1", "2", "3", "4"},
+			width: 80,
+			want:  []string{"Args (4): 1, 2, 3, 4"},
+		},
+		{
+			name:  "long value is truncated",
+			args:  []string{"1", long},
+			width: 80,
+			want:  []string{"Args (2): 1, " + strings.Repeat("x", 31) + "…"},
+		},
+		{
+			name:  "many args wrap and the rest are counted",
+			args:  many,
+			width: 50,
+			want: []string{
+				"Args (30): 1000, 1001, 1002, 1003, 1004, 1005,",
+				"           1006, 1007, 1008, 1009, 1010, 1011,",
+				"           1012, 1013, 1014, 1015, … +14 more",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := previewArgLines(tt.args, tt.width); !slices.Equal(got, tt.want) {
+				t.Errorf("previewArgLines() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestFollowToggle(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	add := func() {
+		t.Helper()
+		m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	}
+	for range 10 {
+		add()
+	}
+	if strings.Contains(m.renderList(20), "[following") {
+		t.Error("title shows follow before it was enabled")
+	}
+	m = update(t, m, keyMsg("G"))
+	if !strings.Contains(m.renderList(20), "[following]") {
+		t.Error("title does not show implicit follow")
+	}
+
+	// F turns follow off even though the cursor is on the last row.
+	m = update(t, m, keyMsg("F"))
+	if m.following() {
+		t.Fatal("F did not turn follow off")
+	}
+	add()
+	if m.cursor != 9 {
+		t.Errorf("cursor = %d after new event with follow off, want 9", m.cursor)
+	}
+	if strings.Contains(m.renderList(20), "[following") {
+		t.Error("title shows follow while it is off")
+	}
+
+	// Turning it on jumps to the newest row and survives moving up.
+	m = update(t, m, keyMsg("k"))
+	m = update(t, m, keyMsg("F"))
+	if m.cursor != 10 || !m.followPinned {
+		t.Fatalf("F: cursor = %d, pinned = %v, want 10, true", m.cursor, m.followPinned)
+	}
+	m = update(t, m, keyMsg("k"))
+	m = update(t, m, keyMsg("k"))
+	add()
+	if m.cursor != 11 {
+		t.Errorf("cursor = %d after new event with pinned follow, want 11", m.cursor)
+	}
+	if !strings.Contains(m.renderList(20), "[following: pinned]") {
+		t.Error("title does not show pinned follow")
+	}
+
+	m = update(t, m, keyMsg("F"))
+	if m.following() {
+		t.Error("second F did not turn follow off")
+	}
+}
+
+func TestDroppedIndicator(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 160, 40
+
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	if out := ansi.Strip(m.View()); strings.Contains(out, "dropped") {
+		t.Errorf("footer shows drops before any were reported:\n%s", out)
+	}
+
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 2", time.Millisecond, ""), Dropped: 42})
+	if out := ansi.Strip(m.View()); !strings.Contains(out, "⚠ 42 dropped") {
+		t.Errorf("footer missing drop count:\n%s", out)
+	}
+}
@@ -0,0 +1,58 @@
+package tui
+
+import tea "github.com/charmbracelet/bubbletea"
+
+// wheelRows is how many rows one notch of the mouse wheel scrolls.
+const wheelRows = 3
+
+// listFirstRowY is the screen line of the list's first data row, below the
+// top border and the header row.
+const listFirstRowY = 2
+
+// updateMouse scrolls the current view with the wheel and selects the
+// clicked row in the list. Mouse input is ignored while a prompt is open.
+func (m Model) updateMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.inputActive() || m.view == viewHelp || msg.Action != tea.MouseActionPress {
+		return m, nil
+	}
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		return m.scrollWheel(tea.KeyMsg{Type: tea.KeyUp})
+	case tea.MouseButtonWheelDown:
+		return m.scrollWheel(tea.KeyMsg{Type: tea.KeyDown})
+	case tea.MouseButtonLeft:
+		if m.view != viewList {
+			return m, nil
+		}
+		if row, ok := m.listRowAt(msg.Y); ok {
+			m = m.jumpToRow(row)
+		}
+	}
+	return m, nil
+}
+
+// scrollWheel moves by wheelRows rows as if the arrow key were pressed.
+func (m Model) scrollWheel(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	for range wheelRows {
+		next, cmd := m.updateView(key)
+		mm, ok := next.(Model)
+		if !ok {
+			return next, cmd
+		}
+		m = mm
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// listRowAt maps the screen line y of the list view to a display row index.
+func (m Model) listRowAt(y int) (int, bool) {
+	dataRows := max(m.listHeight()-1, 1)
+	start, end := m.listWindow(dataRows)
+	row := start + y - listFirstRowY
+	if y < listFirstRowY || row >= end {
+		return 0, false
+	}
+	return row, true
+}
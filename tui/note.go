@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// startNote opens the note input for the event under the cursor,
+// prefilled with its existing note.
+func (m Model) startNote() Model {
+	ev := m.cursorEvent()
+	if ev == nil || ev.GetId() == "" {
+		return m
+	}
+	m.noteMode = true
+	m.noteEventID = ev.GetId()
+	m.noteInput = m.notes[ev.GetId()]
+	m.noteCursor = len([]rune(m.noteInput))
+	return m
+}
+
+func (m Model) updateNote(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.noteMode = false
+		m.pendingBracket = false
+		if note := strings.TrimSpace(m.noteInput); note != "" {
+			m.notes[m.noteEventID] = note
+		} else {
+			delete(m.notes, m.noteEventID)
+		}
+		return m, nil
+	case "esc":
+		m.noteMode = false
+		m.pendingBracket = false
+		return m, nil
+	case "backspace":
+		if m.noteCursor > 0 {
+			runes := []rune(m.noteInput)
+			m.noteInput = string(runes[:m.noteCursor-1]) + string(runes[m.noteCursor:])
+			m.noteCursor--
+		}
+		return m, nil
+	case "ctrl+c":
+		if m.conn != nil {
+			_ = m.conn.Close()
+		}
+		return m, tea.Quit
+	case "left":
+		if m.noteCursor > 0 {
+			m.noteCursor--
+		}
+		return m, nil
+	case "right":
+		if m.noteCursor < len([]rune(m.noteInput)) {
+			m.noteCursor++
+		}
+		return m, nil
+	}
+
+	if len(msg.Runes) == 0 {
+		return m, nil
+	}
+
+	var r []rune
+	m, r = m.filterInputRunes(msg.Runes)
+	if len(r) == 0 {
+		return m, nil
+	}
+
+	runes := []rune(m.noteInput)
+	m.noteInput = string(runes[:m.noteCursor]) + string(r) + string(runes[m.noteCursor:])
+	m.noteCursor += len(r)
+	return m, nil
+}
@@ -0,0 +1,43 @@
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+// pinMarker is shown in front of pinned rows.
+const pinMarker = "★"
+
+// isPinned reports whether ev is pinned.
+// Pins are keyed by event ID, which is only unique per connection, so events
+// from different connections that share an ID are pinned together.
+func (m Model) isPinned(ev *tapv1.QueryEvent) bool {
+	return m.pins[ev.GetId()]
+}
+
+// togglePin pins or unpins the event under the cursor.
+func (m Model) togglePin() (Model, tea.Cmd) {
+	ev := m.cursorEvent()
+	if ev == nil || ev.GetId() == "" {
+		return m, nil
+	}
+	if m.pins[ev.GetId()] {
+		delete(m.pins, ev.GetId())
+		if m.pinnedOnly {
+			m = m.rebuild()
+			m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
+		}
+		return m.showAlert("unpinned")
+	}
+	m.pins[ev.GetId()] = true
+	return m.showAlert("pinned")
+}
+
+// togglePinnedOnly switches between showing all rows and only pinned ones.
+func (m Model) togglePinnedOnly() Model {
+	m.pinnedOnly = !m.pinnedOnly
+	m = m.rebuild()
+	m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
+	return m
+}
@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/mickamy/sql-tap/highlight"
+)
+
+// diffOp marks a line of a plan diff as kept, removed or added.
+type diffOp byte
+
+const (
+	diffSame diffOp = ' '
+	diffDel  diffOp = '-'
+	diffAdd  diffOp = '+'
+)
+
+// planDiffLine is a line of a diff between two plans. An added line that
+// replaces a removed one notes how the plan node changed, if it did.
+type planDiffLine struct {
+	op   diffOp
+	text string
+	note string
+}
+
+func (l planDiffLine) String() string {
+	s := string(l.op) + " " + l.text
+	if l.note != "" {
+		s += "  « " + l.note
+	}
+	return s
+}
+
+// planCostRe matches the cost of a plan node: the total cost of a PostgreSQL
+// range (cost=0.00..35.50) or a MySQL estimate (cost=50.2).
+var planCostRe = regexp.MustCompile(`cost=(?:[\d.]+\.\.)?([\d.]+)`)
+
+// diffPlans returns a line diff turning the plan before into after. Within a
+// run of changed lines, removed and added lines are paired in order, and the
+// added line of a pair notes a changed node type or cost.
+func diffPlans(before, after string) []planDiffLine {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out, dels, adds []planDiffLine
+	flush := func() {
+		for k := range adds {
+			if k < len(dels) {
+				adds[k].note = nodeChange(dels[k].text, adds[k].text)
+			}
+		}
+		out = append(out, dels...)
+		out = append(out, adds...)
+		dels, adds = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			out = append(out, planDiffLine{op: diffSame, text: a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			adds = append(adds, planDiffLine{op: diffAdd, text: b[j]})
+			j++
+		default:
+			dels = append(dels, planDiffLine{op: diffDel, text: a[i]})
+			i++
+		}
+	}
+	flush()
+	return out
+}
+
+// nodeChange describes how the plan node on line before changed on line
+// after: its type and its cost. It returns "" for lines that are not nodes
+// or nodes that did not change in either.
+func nodeChange(before, after string) string {
+	var notes []string
+	if bn, an := planNode(before), planNode(after); bn != "" && an != "" && bn != an {
+		notes = append(notes, bn+" → "+an)
+	}
+	bc, an := planCostRe.FindStringSubmatch(before), planCostRe.FindStringSubmatch(after)
+	if bc != nil && an != nil && bc[1] != an[1] {
+		notes = append(notes, "cost "+bc[1]+" → "+an[1])
+	}
+	return strings.Join(notes, ", ")
+}
+
+// planNode returns the node type on a plan line, e.g. "Index Scan" for
+// "->  Index Scan using users_pkey on users  (cost=...)", or "" if the line
+// has no cost and so is no node.
+func planNode(line string) string {
+	if !planCostRe.MatchString(line) {
+		return ""
+	}
+	s := strings.TrimSpace(line)
+	s = strings.TrimSpace(strings.TrimPrefix(s, "->"))
+	for _, sep := range []string{"  (", " (", " using ", " on ", ":"} {
+		if i := strings.Index(s, sep); i > 0 {
+			s = s[:i]
+		}
+	}
+	return s
+}
+
+var (
+	diffDelStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	diffAddStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	diffNoteStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3")).Bold(true)
+)
+
+// renderDiffLine colors a line of explainLines in diff mode: removed lines
+// red, added lines green with their note in bold, and kept lines as a plan.
+func renderDiffLine(line string) string {
+	if !highlight.Enabled() || line == "" {
+		return line
+	}
+	switch diffOp(line[0]) {
+	case diffDel:
+		return diffDelStyle.Render(line)
+	case diffAdd:
+		text, note, ok := strings.Cut(line, "  « ")
+		if !ok {
+			return diffAddStyle.Render(line)
+		}
+		return diffAddStyle.Render(text) + diffNoteStyle.Render("  « "+note)
+	}
+	return highlight.Plan(line)
+}
@@ -0,0 +1,144 @@
+package tui
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/explain"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestDiffPlans(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   []string
+	}{
+		{
+			name:   "same plan",
+			before: "Seq Scan on users  (cost=0.00..35.50 rows=2550 width=4)",
+			after:  "Seq Scan on users  (cost=0.00..35.50 rows=2550 width=4)",
+			want:   []string{"  Seq Scan on users  (cost=0.00..35.50 rows=2550 width=4)"},
+		},
+		{
+			name: "postgres node and cost change",
+			before: "Seq Scan on users  (cost=0.00..35.50 rows=13 width=4)\n" +
+				"  Filter: (id = 42)",
+			after: "Index Scan using users_pkey on users  (cost=0.15..8.17 rows=1 width=4)\n" +
+				"  Index Cond: (id = 42)",
+			want: []string{
+				"- Seq Scan on users  (cost=0.00..35.50 rows=13 width=4)",
+				"-   Filter: (id = 42)",
+				"+ Index Scan using users_pkey on users  (cost=0.15..8.17 rows=1 width=4)  « Seq Scan → Index Scan, cost 35.50 → 8.17",
+				"+   Index Cond: (id = 42)",
+			},
+		},
+		{
+			name: "mysql cost change keeps unchanged lines",
+			before: "-> Filter: (orders.code = 42)  (cost=50.2 rows=50)\n" +
+				"    -> Table scan on orders  (cost=50.2 rows=500)",
+			after: "-> Filter: (orders.code = 42)  (cost=50.2 rows=50)\n" +
+				"    -> Table scan on orders  (cost=12.1 rows=120)",
+			want: []string{
+				"  -> Filter: (orders.code = 42)  (cost=50.2 rows=50)",
+				"-     -> Table scan on orders  (cost=50.2 rows=500)",
+				"+     -> Table scan on orders  (cost=12.1 rows=120)  « cost 50.2 → 12.1",
+			},
+		},
+		{
+			name:   "added node",
+			before: "Limit  (cost=0.00..1.00 rows=1 width=4)",
+			after:  "Limit  (cost=0.00..1.00 rows=1 width=4)\n  ->  Sort  (cost=2.00..2.50 rows=10 width=4)",
+			want: []string{
+				"  Limit  (cost=0.00..1.00 rows=1 width=4)",
+				"+   ->  Sort  (cost=2.00..2.50 rows=10 width=4)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			for _, l := range diffPlans(tt.before, tt.after) {
+				got = append(got, l.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("diffPlans =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanNode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "Hash Join  (cost=1.09..2.21 rows=4 width=8)", want: "Hash Join"},
+		{line: "  ->  Index Scan using users_pkey on users  (cost=0.15..8.17 rows=1 width=4)", want: "Index Scan"},
+		{line: "-> Index lookup on orders using idx_code (code='A1')  (cost=0.35 rows=1)", want: "Index lookup"},
+		{line: "    -> Filter: (orders.code = 42)  (cost=50.2 rows=50)", want: "Filter"},
+		{line: "  Filter: (id = 42)", want: ""},
+		{line: "Planning Time: 0.050 ms", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			t.Parallel()
+			if got := planNode(tt.line); got != tt.want {
+				t.Errorf("planNode(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainDiffKey(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT * FROM users WHERE name = 'a'", time.Millisecond, "")})
+	m = update(t, m, keyMsg("x"))
+	m = update(t, m, explainResultMsg{plan: "Seq Scan on users  (cost=0.00..35.50 rows=13 width=4)"})
+
+	// Nothing to diff before an edit.
+	m = update(t, m, keyMsg("d"))
+	if m.explainDiff {
+		t.Fatal("explainDiff is set without a previous plan")
+	}
+
+	m = update(t, m, editorResultMsg{query: "SELECT * FROM users WHERE id = 1", mode: explain.Explain})
+	if m.prevPlan != "Seq Scan on users  (cost=0.00..35.50 rows=13 width=4)" || m.explainPlan != "" {
+		t.Fatalf("prevPlan = %q, explainPlan = %q after editing, want the old plan kept", m.prevPlan, m.explainPlan)
+	}
+	m = update(t, m, explainResultMsg{plan: "Index Scan using users_pkey on users  (cost=0.15..8.17 rows=1 width=4)"})
+	m = update(t, m, keyMsg("d"))
+	if !m.explainDiff {
+		t.Fatal("explainDiff is not set after d")
+	}
+	want := []string{
+		"- Seq Scan on users  (cost=0.00..35.50 rows=13 width=4)",
+		"+ Index Scan using users_pkey on users  (cost=0.15..8.17 rows=1 width=4)  « Seq Scan → Index Scan, cost 35.50 → 8.17",
+	}
+	if got := m.explainLines(); !slices.Equal(got, want) {
+		t.Errorf("explainLines = %q, want %q", got, want)
+	}
+
+	m = update(t, m, keyMsg("d"))
+	if m.explainDiff {
+		t.Error("explainDiff is still set after a second d")
+	}
+
+	// EXPLAIN from the list starts over.
+	m = update(t, m, keyMsg("q"))
+	m = update(t, m, keyMsg("x"))
+	if m.prevPlan != "" {
+		t.Errorf("prevPlan = %q after EXPLAIN from the list, want none", m.prevPlan)
+	}
+}
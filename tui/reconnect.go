@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"google.golang.org/grpc"
+)
+
+// Reconnect backoff bounds.
+const (
+	reconnectMinDelay = 500 * time.Millisecond
+	reconnectMaxDelay = 10 * time.Second
+)
+
+// disconnectedMsg is sent when an established Watch stream fails,
+// e.g. because sql-tapd restarted.
+type disconnectedMsg struct{ Err error }
+
+// reconnectFailedMsg is sent when a reconnect attempt fails.
+type reconnectFailedMsg struct{ Err error }
+
+// reconnectDelay returns the backoff before the given (0-based) reconnect attempt.
+func reconnectDelay(attempt int) time.Duration {
+	d := reconnectMinDelay
+	for range attempt {
+		d *= 2
+		if d >= reconnectMaxDelay {
+			return reconnectMaxDelay
+		}
+	}
+	return d
+}
+
+// reconnect dials target again after delay. Failures are reported as
+// reconnectFailedMsg so that they are retried instead of shown as fatal.
+func reconnect(target string, opts []grpc.DialOption, delay time.Duration) tea.Cmd {
+	return tea.Tick(delay, func(time.Time) tea.Msg {
+		msg := connect(target, opts)()
+		if e, ok := msg.(errMsg); ok {
+			return reconnectFailedMsg{Err: e.Err}
+		}
+		return msg
+	})
+}
+
+// startReconnect drops the broken connection and schedules the first
+// reconnect attempt. Captured events are kept.
+func (m Model) startReconnect() (Model, tea.Cmd) {
+	if m.conn != nil {
+		_ = m.conn.Close()
+	}
+	m.reconnecting = true
+	m.reconnectAttempt = 0
+	m = m.abandonInFlight()
+	return m, reconnect(m.target, m.opts.DialOptions, reconnectDelay(0))
+}
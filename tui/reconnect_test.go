@@ -0,0 +1,78 @@
+package tui //nolint:testpackage // testing internal model state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 500 * time.Millisecond},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := reconnectDelay(tt.attempt); got != tt.want {
+			t.Errorf("reconnectDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestReconnectKeepsEvents(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+
+	inFlight := makeEvent(proxy.OpQuery, "SELECT pg_sleep(10)", 0, "")
+	inFlight.InFlight = true
+	m = update(t, m, eventMsg{Event: inFlight})
+
+	next, cmd := m.Update(disconnectedMsg{Err: errors.New("unavailable")})
+	m, ok := next.(Model)
+	if !ok {
+		t.Fatalf("Update returned %T, want Model", next)
+	}
+	if cmd == nil {
+		t.Fatal("no reconnect scheduled after disconnect")
+	}
+	if !m.reconnecting || m.err != nil {
+		t.Fatalf("reconnecting = %v, err = %v, want true, nil", m.reconnecting, m.err)
+	}
+	if len(m.events) != 2 {
+		t.Errorf("events = %d, want 2 (captured events are kept)", len(m.events))
+	}
+	if m.events[1].GetInFlight() || len(m.inFlight) != 0 {
+		t.Error("in-flight event still tracked after disconnect")
+	}
+	if !inFlight.GetInFlight() {
+		t.Error("abandonInFlight mutated the received event")
+	}
+
+	m = update(t, m, reconnectFailedMsg{Err: errors.New("connection refused")})
+	m = update(t, m, reconnectFailedMsg{Err: errors.New("connection refused")})
+	if m.reconnectAttempt != 2 || m.err != nil {
+		t.Errorf("reconnectAttempt = %d, err = %v, want 2, nil", m.reconnectAttempt, m.err)
+	}
+
+	m = update(t, m, connectedMsg{})
+	if m.reconnecting || m.reconnectAttempt != 0 {
+		t.Errorf("reconnecting = %v, attempt = %d after connect, want false, 0", m.reconnecting, m.reconnectAttempt)
+	}
+	if len(m.events) != 2 {
+		t.Errorf("events = %d after reconnect, want 2", len(m.events))
+	}
+}
@@ -0,0 +1,213 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/mickamy/sql-tap/highlight"
+)
+
+// minRepeatRun is the shortest run of consecutive rows sharing a template that
+// is collapsed into a repeat group.
+const minRepeatRun = 2
+
+// repeatKey returns the key in Model.collapsed of the repeat group whose first
+// event is at index first. The prefix keeps it apart from transaction IDs.
+func repeatKey(first int) string {
+	return "repeat:" + strconv.Itoa(first)
+}
+
+// repeatCollapsed reports whether the repeat group key is collapsed. Unlike
+// transactions, repeat groups start collapsed.
+func (m Model) repeatCollapsed(key string) bool {
+	collapsed, ok := m.collapsed[key]
+	return !ok || collapsed
+}
+
+// groupRepeats collapses each run of consecutive event rows that share a
+// normalized query and a transaction, as an N+1 storm produces, into a
+// rowRepeat summary row. The run's rows follow the summary when the group is
+// expanded.
+func (m Model) groupRepeats(rows []displayRow) []displayRow {
+	out := make([]displayRow, 0, len(rows))
+	for i := 0; i < len(rows); {
+		j := i + 1
+		for j < len(rows) && m.sameRepeat(rows[i], rows[j]) {
+			j++
+		}
+		if j-i < minRepeatRun {
+			out = append(out, rows[i:j]...)
+			i = j
+			continue
+		}
+
+		indices := make([]int, 0, j-i)
+		for _, r := range rows[i:j] {
+			indices = append(indices, r.eventIdx)
+		}
+		key := repeatKey(indices[0])
+		out = append(out, displayRow{
+			kind:   rowRepeat,
+			events: indices,
+			group:  key,
+		})
+		if !m.repeatCollapsed(key) {
+			for _, r := range rows[i:j] {
+				r.group = key
+				out = append(out, r)
+			}
+		}
+		i = j
+	}
+	return out
+}
+
+// sameRepeat reports whether event rows a and b belong to the same repeat run.
+// Lifecycle and in-flight events never repeat.
+func (m Model) sameRepeat(a, b displayRow) bool {
+	if a.kind != rowEvent || b.kind != rowEvent {
+		return false
+	}
+	ea, eb := m.events[a.eventIdx], m.events[b.eventIdx]
+	if !isAnalyticsEvent(ea) || !isAnalyticsEvent(eb) {
+		return false
+	}
+	return ea.GetNormalizedQuery() == eb.GetNormalizedQuery() && ea.GetTxId() == eb.GetTxId()
+}
+
+// toggleRepeat expands or collapses the repeat group key and keeps the cursor
+// on its summary row.
+func (m Model) toggleRepeat(key string) Model {
+	m.collapsed[key] = !m.repeatCollapsed(key)
+	m = m.rebuild()
+	for i, r := range m.displayRows {
+		if r.kind == rowRepeat && r.group == key {
+			m.cursor = i
+			break
+		}
+	}
+	return m
+}
+
+// toggleCollapseRepeats turns repeat grouping on or off.
+func (m Model) toggleCollapseRepeats() Model {
+	m.collapseRepeats = !m.collapseRepeats
+	m = m.rebuild()
+	m.cursor = min(m.cursor, max(len(m.displayRows)-1, 0))
+	if m.follow {
+		m.cursor = max(len(m.displayRows)-1, 0)
+	}
+	return m
+}
+
+// repeatTotal returns the summed duration of the events in indices.
+func (m Model) repeatTotal(indices []int) time.Duration {
+	var total time.Duration
+	for _, idx := range indices {
+		total += m.events[idx].GetDuration().AsDuration()
+	}
+	return total
+}
+
+func (m Model) renderRepeatRow(dr displayRow, isCursor bool, colQuery int) string {
+	marker := "  "
+	if isCursor {
+		marker = "▶ "
+	}
+
+	chevron := "▾ "
+	if m.repeatCollapsed(dr.group) {
+		chevron = "▸ "
+	}
+
+	first := m.events[dr.events[0]]
+	indent := ""
+	cq := colQuery
+	styled := lipgloss.NewStyle()
+	if txID := first.GetTxId(); txID != "" {
+		indent = "  " // tx child: extra indent
+		cq = max(colQuery-2, 1)
+		styled = styled.Foreground(m.txColorMap[txID])
+	}
+
+	count := fmt.Sprintf("×%d", len(dr.events))
+	q := truncate(first.GetNormalizedQuery(), cq)
+	dur := formatDurationValue(m.repeatTotal(dr.events))
+	t := formatTime(first.GetStartTime())
+
+	var status string
+	for _, idx := range dr.events {
+		if status = eventStatus(m.events[idx]); status != "" {
+			break
+		}
+	}
+	if m.showRows {
+		status = fmt.Sprintf("%*s ", colRows, "") + status
+	}
+
+	if isCursor {
+		styled = styled.Bold(true)
+		bold := lipgloss.NewStyle().Bold(true)
+		return bold.Render(marker+indent) +
+			styled.Render(chevron) +
+			padRight(styled.Render(count), colOp) + " " +
+			padRight(bold.Render(q), cq) +
+			m.timingCells(dur, t, bold) + " " +
+			status
+	}
+
+	return fmt.Sprintf("%s%s%s%s %-*s",
+		marker,
+		indent,
+		styled.Render(chevron),
+		padRight(styled.Render(count), colOp),
+		cq, q,
+	) + m.timingCells(dur, t, lipgloss.NewStyle()) + " " + status
+}
+
+// repeatSummaryLines describes a repeat group for the preview and inspector.
+func (m Model) repeatSummaryLines(dr displayRow, innerWidth int) []string {
+	first := m.events[dr.events[0]]
+	total := m.repeatTotal(dr.events)
+	avg := total / time.Duration(len(dr.events))
+
+	lines := []string{
+		"Type:     Repeated query",
+		fmt.Sprintf("Count:    %d", len(dr.events)),
+		fmt.Sprintf("Duration: %s total, %s avg", formatDurationValue(total), formatDurationValue(avg)),
+		"Time:     " + formatTimeFull(first.GetStartTime()),
+	}
+	if txID := first.GetTxId(); txID != "" {
+		lines = append(lines, "Tx:       "+txID)
+	}
+	q := truncate(first.GetNormalizedQuery(), max(innerWidth-10, 20))
+	return append(lines, "Query:    "+highlight.SQL(q))
+}
+
+func (m Model) renderRepeatPreview(dr displayRow, innerWidth int) string {
+	content := strings.Join(m.repeatSummaryLines(dr, innerWidth), "\n")
+
+	border := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		Width(innerWidth).
+		BorderForeground(lipgloss.Color("240"))
+
+	return border.Render(content)
+}
+
+func (m Model) inspectorRepeatLines(dr displayRow, innerWidth int) []string {
+	lines := m.repeatSummaryLines(dr, innerWidth)
+
+	lines = append(lines, "")
+	lines = append(lines, "Events:")
+	for _, idx := range dr.events {
+		ev := m.events[idx]
+		args := truncate("["+strings.Join(ev.GetArgs(), ", ")+"]", max(innerWidth-16, 20))
+		lines = append(lines, fmt.Sprintf("  %-12s %s", formatTime(ev.GetStartTime()), args)+" "+m.eventDuration(ev))
+	}
+	return lines
+}
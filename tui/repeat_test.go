@@ -0,0 +1,164 @@
+package tui //nolint:testpackage // testing internal model state
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// repeatEvent returns a query event of template nq run in transaction txID.
+func repeatEvent(nq, txID string) *tapv1.QueryEvent {
+	ev := makeEvent(proxy.OpQuery, nq, time.Millisecond, "")
+	ev.NormalizedQuery = nq
+	ev.TxId = txID
+	return ev
+}
+
+// rowShape describes display rows compactly: "e<idx>" for an event, "+<idx>"
+// for an event expanded from a repeat group, "r<n>" for a repeat group of n
+// events and "tx" for a transaction summary.
+func rowShape(rows []displayRow) []string {
+	shape := make([]string, 0, len(rows))
+	for _, r := range rows {
+		switch r.kind {
+		case rowEvent:
+			prefix := "e"
+			if r.group != "" {
+				prefix = "+"
+			}
+			shape = append(shape, prefix+strconv.Itoa(r.eventIdx))
+		case rowRepeat:
+			shape = append(shape, "r"+strconv.Itoa(len(r.events)))
+		case rowTxSummary:
+			shape = append(shape, "tx")
+		}
+	}
+	return shape
+}
+
+func TestGroupRepeats(t *testing.T) {
+	t.Parallel()
+
+	const (
+		byID    = "SELECT * FROM users WHERE id = ?"
+		byEmail = "SELECT * FROM users WHERE email = ?"
+	)
+	begin := makeEvent(proxy.OpBegin, "", time.Millisecond, "")
+	begin.TxId = "tx1"
+	inFlight := repeatEvent(byID, "")
+	inFlight.InFlight = true
+
+	tests := []struct {
+		name   string
+		events []*tapv1.QueryEvent
+		want   []string
+	}{
+		{
+			name:   "run collapses",
+			events: []*tapv1.QueryEvent{repeatEvent(byID, ""), repeatEvent(byID, ""), repeatEvent(byID, "")},
+			want:   []string{"r3"},
+		},
+		{
+			name:   "single event stays",
+			events: []*tapv1.QueryEvent{repeatEvent(byID, ""), repeatEvent(byEmail, ""), repeatEvent(byID, "")},
+			want:   []string{"e0", "e1", "e2"},
+		},
+		{
+			name: "runs split by another template",
+			events: []*tapv1.QueryEvent{
+				repeatEvent(byID, ""), repeatEvent(byID, ""), repeatEvent(byEmail, ""),
+				repeatEvent(byID, ""), repeatEvent(byID, ""),
+			},
+			want: []string{"r2", "e2", "r2"},
+		},
+		{
+			name: "different transactions do not merge",
+			events: []*tapv1.QueryEvent{
+				repeatEvent(byID, ""), repeatEvent(byID, "tx1"), repeatEvent(byID, "tx1"),
+			},
+			want: []string{"e0", "tx", "r2"},
+		},
+		{
+			name: "lifecycle events never repeat",
+			events: []*tapv1.QueryEvent{
+				begin, repeatEvent(byID, "tx1"),
+			},
+			want: []string{"tx", "e0", "e1"},
+		},
+		{
+			name:   "in-flight events never repeat",
+			events: []*tapv1.QueryEvent{repeatEvent(byID, ""), inFlight},
+			want:   []string{"e0", "e1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m := New("localhost:9091", Options{Events: tt.events})
+			m.collapseRepeats = true
+			m = m.rebuild()
+			if got := rowShape(m.displayRows); !slices.Equal(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepeatToggle(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 120, 40
+	nq := "SELECT * FROM users WHERE id = ?"
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, "SELECT 1", time.Millisecond, "")})
+	for range 37 {
+		m = update(t, m, eventMsg{Event: repeatEvent(nq, "")})
+	}
+	if len(m.displayRows) != 38 {
+		t.Fatalf("displayRows = %d before z, want 38", len(m.displayRows))
+	}
+
+	m = update(t, m, keyMsg("z"))
+	if got := rowShape(m.displayRows); !slices.Equal(got, []string{"e0", "r37"}) {
+		t.Fatalf("rows after z = %v, want [e0 r37]", got)
+	}
+	list := m.renderList(20)
+	if !strings.Contains(list, "×37") || !strings.Contains(list, "37.0ms") {
+		t.Errorf("list does not show the count and total duration:\n%s", list)
+	}
+	if !strings.Contains(list, "(38 queries") {
+		t.Errorf("title does not count the grouped queries:\n%s", list)
+	}
+
+	m.cursor = 1
+	m = update(t, m, keyMsg(" "))
+	if len(m.displayRows) != 39 || m.cursor != 1 {
+		t.Fatalf("after expand: displayRows = %d, cursor = %d, want 39, 1", len(m.displayRows), m.cursor)
+	}
+	if m.displayRows[2].group == "" {
+		t.Error("expanded row does not belong to the group")
+	}
+	for i, line := range strings.Split(m.renderList(50), "\n") {
+		if w := lipgloss.Width(line); w != m.width-2 {
+			t.Errorf("line %d is %d wide, want %d: %q", i, w, m.width-2, line)
+		}
+	}
+
+	m.cursor = 10
+	m = update(t, m, keyMsg(" "))
+	if got := rowShape(m.displayRows); !slices.Equal(got, []string{"e0", "r37"}) || m.cursor != 1 {
+		t.Errorf("after collapse from a child: rows = %v, cursor = %d", got, m.cursor)
+	}
+
+	m = update(t, m, keyMsg("z"))
+	if len(m.displayRows) != 38 {
+		t.Errorf("displayRows = %d after second z, want 38", len(m.displayRows))
+	}
+}
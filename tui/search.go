@@ -0,0 +1,141 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/mickamy/sql-tap/highlight"
+)
+
+// regexSearchPrefix marks a search query as a regular expression.
+// Since "/" opens the search prompt, typing "//pattern" searches by regex.
+const regexSearchPrefix = "/"
+
+// isRegexSearch reports whether searchQuery should be matched as a regular expression.
+func isRegexSearch(searchQuery string) bool {
+	return strings.HasPrefix(searchQuery, regexSearchPrefix)
+}
+
+// searchRegexp compiles searchQuery into the expression its matches are
+// found with, or returns nil for an empty search. Plain searches are
+// case-insensitive substring matches. Regex searches are compiled
+// case-insensitively; a pattern that does not compile (e.g. while still being
+// typed) falls back to a substring match of the pattern text.
+func searchRegexp(searchQuery string) *regexp.Regexp {
+	pattern := searchQuery
+	if isRegexSearch(searchQuery) {
+		pattern = strings.TrimPrefix(searchQuery, regexSearchPrefix)
+		if re, err := regexp.Compile("(?i)" + pattern); err == nil && pattern != "" {
+			return re
+		}
+	}
+	if pattern == "" {
+		return nil
+	}
+	return regexp.MustCompile("(?i)" + regexp.QuoteMeta(pattern))
+}
+
+// withSearch sets the search query and caches its compiled expression.
+func (m Model) withSearch(searchQuery string) Model {
+	m.searchQuery = searchQuery
+	m.searchRe = searchRegexp(searchQuery)
+	return m
+}
+
+// searchMatchStyle marks the spans of a query matched by the search.
+var searchMatchStyle = lipgloss.NewStyle().Reverse(true)
+
+// searchSpans returns the rune ranges of text matched by re, in order and
+// without overlaps. A nil re matches nothing.
+func searchSpans(re *regexp.Regexp, text string) [][]int {
+	if re == nil {
+		return nil
+	}
+	var spans [][]int
+	pos, n := 0, 0
+	for _, sp := range re.FindAllStringIndex(text, -1) {
+		if sp[1] == sp[0] {
+			continue
+		}
+		n += utf8.RuneCountInString(text[pos:sp[0]])
+		start := n
+		n += utf8.RuneCountInString(text[sp[0]:sp[1]])
+		pos = sp[1]
+		spans = append(spans, []int{start, n})
+	}
+	return spans
+}
+
+// truncateMatch truncates s to maxLen runes like truncate and returns the
+// rune spans of the result matched by re. If truncating would hide the first
+// match, the result is instead a window of s around it, with an ellipsis at
+// either end that was cut.
+func truncateMatch(s string, maxLen int, re *regexp.Regexp) (string, [][]int) {
+	s = truncate(s, len(s)) // collapse whitespace as truncate does
+	spans := searchSpans(re, s)
+	r := []rune(s)
+	if len(r) <= maxLen || len(spans) == 0 || spans[0][1] < maxLen || maxLen < 4 {
+		visible := len(r)
+		if len(r) > maxLen && maxLen > 1 {
+			visible = maxLen - 1 // the last rune is the ellipsis
+		}
+		return truncate(s, maxLen), clipSpans(spans, 0, visible, 0)
+	}
+
+	// Keep a little context before the match when it fits.
+	from := max(spans[0][0]-10, 0)
+	if spans[0][1]-from > maxLen-2 {
+		from = spans[0][0]
+	}
+	// Near the end, start earlier so the window is full.
+	from = min(from, len(r)-(maxLen-1))
+	rest := r[from:]
+	if len(rest) <= maxLen-1 {
+		return "…" + string(rest), clipSpans(spans, from, len(r), 1)
+	}
+	return "…" + string(rest[:maxLen-2]) + "…", clipSpans(spans, from, from+maxLen-2, 1)
+}
+
+// clipSpans returns the parts of spans within [from, to), moved to start at
+// offset instead of from.
+func clipSpans(spans [][]int, from, to, offset int) [][]int {
+	var out [][]int
+	for _, sp := range spans {
+		a, b := max(sp[0], from), min(sp[1], to)
+		if a < b {
+			out = append(out, []int{a - from + offset, b - from + offset})
+		}
+	}
+	return out
+}
+
+// highlightSpans renders text with the rune spans drawn in match and the text between
+// them through plain.
+func highlightSpans(text string, spans [][]int, plain func(string) string, match lipgloss.Style) string {
+	if len(spans) == 0 {
+		return plain(text)
+	}
+	r := []rune(text)
+	var b strings.Builder
+	last := 0
+	for _, sp := range spans {
+		if sp[0] > last {
+			b.WriteString(plain(string(r[last:sp[0]])))
+		}
+		b.WriteString(match.Render(string(r[sp[0]:sp[1]])))
+		last = sp[1]
+	}
+	if last < len(r) {
+		b.WriteString(plain(string(r[last:])))
+	}
+	return b.String()
+}
+
+// searchHighlightSQL syntax-highlights the query line l and marks the spans
+// matched by the search.
+func (m Model) searchHighlightSQL(l string) string {
+	return highlightSpans(l, searchSpans(m.searchRe, l), highlight.SQL, searchMatchStyle)
+}
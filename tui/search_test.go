@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestMatchingEventsFiltered(t *testing.T) {
+	t.Parallel()
+
+	events := []*tapv1.QueryEvent{
+		makeEvent(proxy.OpQuery, "SELECT id FROM orders WHERE user_id = 1", 5*time.Millisecond, ""),
+		makeEvent(proxy.OpQuery, "SELECT name FROM users", 200*time.Millisecond, ""),
+		makeEvent(proxy.OpExec, "INSERT INTO orders (user_id) VALUES (1)", 5*time.Millisecond, ""),
+		makeEvent(proxy.OpQuery, "select total from orders_archive", 5*time.Millisecond, ""),
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		search string
+		want   []int
+	}{
+		{name: "no filter or search", want: []int{0, 1, 2, 3}},
+		{name: "substring", search: "orders", want: []int{0, 2, 3}},
+		{name: "substring is literal", search: "SELECT.*FROM orders", want: nil},
+		{name: "regex", search: "/SELECT.*FROM orders", want: []int{0, 3}},
+		{name: "regex is case-insensitive", search: "/^insert into", want: []int{2}},
+		{name: "regex anchors", search: "/orders$", want: nil},
+		{name: "regex word boundary", search: `/\borders\b`, want: []int{0, 2}},
+		{name: "invalid regex falls back to substring", search: "/orders (", want: []int{2}},
+		{name: "incomplete regex falls back to substring", search: "/(user_id", want: []int{2}},
+		{name: "empty regex matches all", search: "/", want: []int{0, 1, 2, 3}},
+		{name: "regex with filter", filter: "op:select", search: "/from (users|orders_archive)", want: []int{1, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := matchingEventsFiltered(events, tt.filter, tt.search)
+			if len(got) != len(tt.want) {
+				t.Fatalf("matched %v, want %v", got, tt.want)
+			}
+			for _, i := range tt.want {
+				if !got[i] {
+					t.Errorf("event %d not matched, got %v", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchSpans(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		search string
+		text   string
+		want   [][]int
+	}{
+		{name: "no search", search: "", text: "SELECT 1", want: nil},
+		{name: "substring", search: "users", text: "SELECT * FROM users JOIN users_meta", want: [][]int{{14, 19}, {25, 30}}},
+		{name: "case-insensitive", search: "FROM", text: "select 1 from t", want: [][]int{{9, 13}}},
+		{name: "substring is literal", search: "a.b", text: "axb a.b", want: [][]int{{4, 7}}},
+		{name: "regex", search: `/id = \d+`, text: "WHERE id = 42 OR id = 7", want: [][]int{{6, 13}, {17, 23}}},
+		{name: "empty regex", search: "/", text: "SELECT 1", want: nil},
+		{name: "empty matches skipped", search: "/x*", text: "abc", want: nil},
+		{name: "invalid regex is a substring", search: "/(user", text: "f(user)", want: [][]int{{1, 6}}},
+		{name: "rune offsets", search: "users", text: "SELECT 'é' FROM users", want: [][]int{{16, 21}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := searchSpans(searchRegexp(tt.search), tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchSpans(%q, %q) = %v, want %v", tt.search, tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateMatch(t *testing.T) {
+	t.Parallel()
+
+	long := "SELECT id, name, email, created_at FROM users WHERE status = 'active'"
+	tests := []struct {
+		name      string
+		s         string
+		maxLen    int
+		search    string
+		want      string
+		wantSpans [][]int
+	}{
+		{
+			name: "fits", s: "SELECT  *\n FROM users", maxLen: 40, search: "users",
+			want: "SELECT * FROM users", wantSpans: [][]int{{14, 19}},
+		},
+		{
+			name: "match before the cut", s: long, maxLen: 20, search: "name",
+			want: "SELECT id, name, em…", wantSpans: [][]int{{11, 15}},
+		},
+		{
+			name: "match cut by the ellipsis is shown whole", s: long, maxLen: 20, search: "email",
+			want: "…id, name, email, c…", wantSpans: [][]int{{11, 16}},
+		},
+		{
+			name: "match past the cut", s: long, maxLen: 30, search: "status",
+			want: "…users WHERE status = 'active'", wantSpans: [][]int{{13, 19}},
+		},
+		{
+			name: "match past the cut, both ends elided", s: long, maxLen: 20, search: "FROM",
+			want: "…reated_at FROM use…", wantSpans: [][]int{{11, 15}},
+		},
+		{
+			name: "no search", s: long, maxLen: 20, search: "",
+			want: "SELECT id, name, em…", wantSpans: nil,
+		},
+		{
+			name: "multibyte text", s: "SELECT * FROM café WHERE note = 'ünïcödé' AND id = 1", maxLen: 20, search: "id",
+			want: "…ünïcödé' AND id = 1", wantSpans: [][]int{{14, 16}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, spans := truncateMatch(tt.s, tt.maxLen, searchRegexp(tt.search))
+			if got != tt.want || !reflect.DeepEqual(spans, tt.wantSpans) {
+				t.Errorf("truncateMatch() = %q %v, want %q %v", got, spans, tt.want, tt.wantSpans)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.maxLen {
+				t.Errorf("truncateMatch() is %d runes, want at most %d", n, tt.maxLen)
+			}
+			r := []rune(got)
+			for _, sp := range spans {
+				if m := string(r[sp[0]:sp[1]]); !strings.EqualFold(m, tt.search[:len(m)]) {
+					t.Errorf("span %v = %q, not part of %q", sp, m, tt.search)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchHighlightRow(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 80, 30
+	q := "SELECT id, name, email, created_at, updated_at, deleted_at FROM accounts WHERE owner_id = 42"
+	m = update(t, m, eventMsg{Event: makeEvent(proxy.OpQuery, q, time.Millisecond, "")})
+	m = m.withSearch("owner_id")
+	m = m.rebuild()
+
+	list := m.renderList(20)
+	if !strings.Contains(list, "owner_id") {
+		t.Errorf("list does not show the match past the cut:\n%s", list)
+	}
+	for i, line := range strings.Split(list, "\n") {
+		if w := lipgloss.Width(line); w != m.width-2 {
+			t.Errorf("line %d is %d wide, want %d: %q", i, w, m.width-2, line)
+		}
+	}
+}
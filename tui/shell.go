@@ -0,0 +1,26 @@
+package tui
+
+import (
+	"strings"
+)
+
+// shellQuote quotes s as a single POSIX shell word. Single quotes keep $,
+// backticks, backslashes and newlines literal; an embedded single quote is
+// closed, escaped and reopened.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellCommand returns a command line that runs sql with the command-line
+// client of driver. Connection details are left to the environment:
+// DATABASE_URL for psql, and MYSQL_HOST, MYSQL_TCP_PORT, MYSQL_PWD plus
+// MYSQL_DATABASE for mysql. It reports false for an unknown driver.
+func shellCommand(driver, sql string) (string, bool) {
+	switch driver {
+	case "postgres":
+		return `psql "$DATABASE_URL" -c ` + shellQuote(sql), true
+	case "mysql", "tidb":
+		return `mysql -D "$MYSQL_DATABASE" -e ` + shellQuote(sql), true
+	}
+	return "", false
+}
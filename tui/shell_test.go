@@ -0,0 +1,76 @@
+package tui
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "SELECT 1", want: `'SELECT 1'`},
+		{name: "empty", in: "", want: `''`},
+		{name: "single quote", in: "WHERE name = 'bob'", want: `'WHERE name = '\''bob'\'''`},
+		{name: "dollar and backtick", in: "SELECT $1, `id`", want: "'SELECT $1, `id`'"},
+		{name: "double quote and backslash", in: `SELECT "a\b"`, want: `'SELECT "a\b"'`},
+		{name: "newline", in: "SELECT 1\nFROM t", want: "'SELECT 1\nFROM t'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := shellQuote(tt.in); got != tt.want {
+				t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	for _, in := range []string{
+		"SELECT 'it''s', \"col\", `id`, $1, $$body$$, $(whoami), \\n; -- x",
+		"INSERT INTO t VALUES ('a\nb', '\\'')",
+	} {
+		out, err := exec.CommandContext(t.Context(), sh, "-c", "printf %s "+shellQuote(in)).Output()
+		if err != nil {
+			t.Fatalf("sh: %v", err)
+		}
+		if string(out) != in {
+			t.Errorf("round trip = %q, want %q", out, in)
+		}
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		driver string
+		want   string
+		ok     bool
+	}{
+		{driver: "postgres", want: `psql "$DATABASE_URL" -c 'SELECT '\''x'\'''`, ok: true},
+		{driver: "mysql", want: `mysql -D "$MYSQL_DATABASE" -e 'SELECT '\''x'\'''`, ok: true},
+		{driver: "tidb", want: `mysql -D "$MYSQL_DATABASE" -e 'SELECT '\''x'\'''`, ok: true},
+		{driver: "", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			t.Parallel()
+			got, ok := shellCommand(tt.driver, "SELECT 'x'")
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("shellCommand(%q) = %s, %v, want %s, %v", tt.driver, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
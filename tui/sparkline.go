@@ -0,0 +1,149 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+)
+
+const (
+	rateWindow  = 20  // seconds covered by the header sparkline
+	rateSamples = 100 // durations kept per second for the p95
+)
+
+// sparkBlocks are the sparkline levels, lowest first.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// rateRing counts queries in per-second buckets over the last rateWindow
+// seconds, ending at the newest query seen or the last tick, whichever is
+// later. Each bucket keeps up to rateSamples durations, so the p95 stays cheap
+// under load.
+type rateRing struct {
+	seen   bool  // whether any query was added
+	first  int64 // unix second of the oldest query seen
+	last   int64 // unix second of the newest bucket
+	counts [rateWindow]int
+	durs   [rateWindow][]time.Duration
+}
+
+// add records a query that started at t and took d. Queries older than the
+// window are ignored.
+func (r *rateRing) add(t time.Time, d time.Duration) {
+	sec := t.Unix()
+	if !r.seen {
+		r.seen, r.first, r.last = true, sec, sec
+	}
+	r.advance(t)
+	if sec <= r.last-rateWindow {
+		return
+	}
+	r.first = min(r.first, sec)
+	i := rateSlot(sec)
+	r.counts[i]++
+	if len(r.durs[i]) < rateSamples {
+		r.durs[i] = append(r.durs[i], d)
+	}
+}
+
+// advance moves the window forward to end at t, clearing the buckets it
+// passes, so the rate decays while no queries arrive. It never moves the
+// window back and does nothing before the first query.
+func (r *rateRing) advance(t time.Time) {
+	sec := t.Unix()
+	if !r.seen || sec <= r.last {
+		return
+	}
+	for s := r.last + 1; s <= min(sec, r.last+rateWindow); s++ {
+		i := rateSlot(s)
+		r.counts[i] = 0
+		r.durs[i] = r.durs[i][:0]
+	}
+	r.last = sec
+}
+
+// rateTickMsg advances the header sparkline once a second.
+type rateTickMsg struct {
+	at time.Time
+}
+
+func rateTick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return rateTickMsg{at: t} })
+}
+
+func rateSlot(sec int64) int {
+	return int(((sec % rateWindow) + rateWindow) % rateWindow)
+}
+
+// series returns the per-second query counts of the window, oldest first.
+func (r *rateRing) series() []int {
+	out := make([]int, rateWindow)
+	if !r.seen {
+		return out
+	}
+	for k := range rateWindow {
+		out[k] = r.counts[rateSlot(r.last-rateWindow+1+int64(k))]
+	}
+	return out
+}
+
+// perSecond returns the average query rate over the window, or over the
+// seconds since the first query if that is shorter.
+func (r *rateRing) perSecond() float64 {
+	if !r.seen {
+		return 0
+	}
+	total := 0
+	for _, c := range r.counts {
+		total += c
+	}
+	return float64(total) / float64(min(r.last-r.first+1, rateWindow))
+}
+
+// p95 returns the 95th percentile duration of the sampled queries.
+func (r *rateRing) p95() time.Duration {
+	var all []time.Duration
+	for _, d := range r.durs {
+		all = append(all, d...)
+	}
+	if len(all) == 0 {
+		return 0
+	}
+	slices.Sort(all)
+	return all[int(float64(len(all)-1)*0.95)]
+}
+
+// recordRate adds ev to the header sparkline if it is a completed query.
+func (m Model) recordRate(ev *tapv1.QueryEvent) Model {
+	if isAnalyticsEvent(ev) && ev.GetStartTime() != nil {
+		m.rates.add(ev.GetStartTime().AsTime(), ev.GetDuration().AsDuration())
+	}
+	return m
+}
+
+// sparkline renders counts as one block per value, scaled to the largest.
+func sparkline(counts []int) string {
+	peak := slices.Max(counts)
+	out := make([]rune, len(counts))
+	for i, c := range counts {
+		level := 0
+		if peak > 0 {
+			level = c * (len(sparkBlocks) - 1) / peak
+		}
+		out[i] = sparkBlocks[level]
+	}
+	return string(out)
+}
+
+// rateWidget returns the list title's load summary, e.g.
+// "▁▂▅█▃ 42.0 q/s p95 3.1ms ", or "" before any query has been seen.
+func (m Model) rateWidget() string {
+	if !m.rates.seen {
+		return ""
+	}
+	return fmt.Sprintf("%s %.1f q/s p95 %s ",
+		sparkline(m.rates.series()), m.rates.perSecond(), formatDurationValue(m.rates.p95()))
+}
@@ -0,0 +1,143 @@
+package tui //nolint:testpackage // testing internal model state
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+func TestRateRing(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec)*time.Second + 300*time.Millisecond) }
+	tail := func(r *rateRing, n int) []int {
+		s := r.series()
+		return s[len(s)-n:]
+	}
+
+	var r rateRing
+	if r.perSecond() != 0 || r.p95() != 0 || slices.Max(r.series()) != 0 {
+		t.Fatal("empty ring is not zero")
+	}
+
+	r.add(at(0), time.Millisecond)
+	r.add(at(0), time.Millisecond)
+	r.add(at(2), time.Millisecond)
+	if got, want := tail(&r, 3), []int{2, 0, 1}; !slices.Equal(got, want) {
+		t.Errorf("series tail = %v, want %v", got, want)
+	}
+	if got := r.perSecond(); got != 1 {
+		t.Errorf("perSecond = %v, want 1 (3 queries over 3 seconds)", got)
+	}
+
+	// A late query within the window lands in its own second.
+	r.add(at(1), time.Millisecond)
+	if got, want := tail(&r, 3), []int{2, 1, 1}; !slices.Equal(got, want) {
+		t.Errorf("series tail after late query = %v, want %v", got, want)
+	}
+
+	// Moving past the window clears the buckets it reuses.
+	r.add(at(rateWindow+1), time.Millisecond)
+	if got, want := tail(&r, 3), []int{0, 0, 1}; !slices.Equal(got, want) {
+		t.Errorf("series tail after wrap = %v, want %v", got, want)
+	}
+	if got := r.series()[0]; got != 1 {
+		t.Errorf("oldest bucket = %d, want 1 (second 2 is still in the window)", got)
+	}
+	if got, want := r.perSecond(), 2.0/rateWindow; got != want {
+		t.Errorf("perSecond after wrap = %v, want %v", got, want)
+	}
+
+	// Queries older than the window are dropped.
+	r.add(at(0), time.Millisecond)
+	if got := r.perSecond(); got != 2.0/rateWindow {
+		t.Errorf("perSecond after stale query = %v, want %v", got, 2.0/rateWindow)
+	}
+
+	// Without queries, advancing moves the window on until it is empty.
+	r.advance(at(rateWindow + 3))
+	if got, want := tail(&r, 3), []int{1, 0, 0}; !slices.Equal(got, want) {
+		t.Errorf("series tail after advance = %v, want %v", got, want)
+	}
+	r.advance(at(0))
+	if got, want := tail(&r, 3), []int{1, 0, 0}; !slices.Equal(got, want) {
+		t.Errorf("series tail after advancing back = %v, want %v", got, want)
+	}
+	r.advance(at(3 * rateWindow))
+	if got := r.perSecond(); got != 0 {
+		t.Errorf("perSecond after idle window = %v, want 0", got)
+	}
+
+	var empty rateRing
+	empty.advance(at(0))
+	if empty.seen {
+		t.Error("advance marks an empty ring as seen")
+	}
+}
+
+func TestRateRingP95(t *testing.T) {
+	t.Parallel()
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var r rateRing
+	for i := range 100 {
+		r.add(base, time.Duration(i+1)*time.Millisecond)
+	}
+	if got := r.p95(); got != 95*time.Millisecond {
+		t.Errorf("p95 = %v, want 95ms", got)
+	}
+
+	// Beyond rateSamples per second, queries are counted but not sampled.
+	r.add(base, time.Hour)
+	if got := r.p95(); got != 95*time.Millisecond {
+		t.Errorf("p95 = %v after an unsampled query, want 95ms", got)
+	}
+	if got := r.series()[rateWindow-1]; got != 101 {
+		t.Errorf("count = %d, want 101", got)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+
+	if got, want := sparkline([]int{0, 1, 2, 4, 8}), "▁▁▂▄█"; got != want {
+		t.Errorf("sparkline = %q, want %q", got, want)
+	}
+	if got, want := sparkline([]int{0, 0}), "▁▁"; got != want {
+		t.Errorf("sparkline of zeros = %q, want %q", got, want)
+	}
+}
+
+func TestRateWidget(t *testing.T) {
+	t.Parallel()
+
+	m := New("localhost:9091", Options{})
+	m.width, m.height = 140, 40
+	if strings.Contains(m.renderList(20), "q/s") {
+		t.Error("title shows a rate before any query")
+	}
+
+	ev := makeEvent(proxy.OpQuery, "SELECT 1", 2*time.Millisecond, "")
+	ev.NormalizedQuery = "SELECT ?"
+	ev.StartTime = timestamppb.New(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+	m = update(t, m, eventMsg{Event: ev})
+	if title := strings.SplitN(m.renderList(20), "\n", 2)[0]; !strings.Contains(title, "1.0 q/s p95 2.0ms") {
+		t.Errorf("title %q does not show the rate and p95", title)
+	}
+
+	m = update(t, m, rateTickMsg{at: ev.GetStartTime().AsTime().Add(rateWindow * time.Second)})
+	if title := strings.SplitN(m.renderList(20), "\n", 2)[0]; !strings.Contains(title, "0.0 q/s") {
+		t.Errorf("title %q still shows the rate after an idle window", title)
+	}
+
+	m = m.clearEvents()
+	if m.rates.seen {
+		t.Error("rates survive clearing events")
+	}
+}
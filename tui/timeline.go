@@ -19,7 +19,7 @@ func (m Model) timelineEvents() []int {
 	matched := matchingEventsFiltered(m.events, m.filterQuery, m.searchQuery)
 	var indices []int
 	for i, ev := range m.events {
-		if !matched[i] {
+		if !matched[i] || ev.GetInFlight() {
 			continue
 		}
 		switch proxy.Op(ev.GetOp()) {
@@ -63,7 +63,7 @@ func (m Model) updateTimeline(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "q":
 		m.view = viewList
 		m = m.rebuild()
-		if m.follow {
+		if m.following() {
 			m.cursor = max(len(m.displayRows)-1, 0)
 		}
 		return m, nil
@@ -192,7 +192,7 @@ func (m Model) renderTimeline() string {
 	// Help footer.
 	if n := len(boxLines); n > 0 {
 		borderFg := lipgloss.NewStyle().Foreground(borderColor)
-		help := " q: back  j/k: scroll  ctrl+d/u: page "
+		help := borderHelp(viewTimeline)
 		dashes := max(innerWidth-len([]rune(help)), 0)
 		boxLines[n-1] = borderFg.Render("╰") +
 			lipgloss.NewStyle().Faint(true).Render(help) +
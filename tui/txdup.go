@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/mickamy/sql-tap/detect"
+	"github.com/mickamy/sql-tap/eventfmt"
+	tapv1 "github.com/mickamy/sql-tap/gen/tap/v1"
+	"github.com/mickamy/sql-tap/proxy"
+)
+
+// txDuplicates finds SELECTs run more than once, with the same arguments,
+// within a transaction that has committed or rolled back. It returns the
+// number of redundant runs per transaction ID and the indices of the
+// repeated events, first runs included.
+func txDuplicates(events []*tapv1.QueryEvent) (map[string]int, map[int]bool) {
+	d := detect.NewTxDuplicates()
+	txs := make(map[string]int)
+	repeated := make(map[int]bool)
+	for i, ev := range events {
+		txID := ev.GetTxId()
+		if txID == "" || ev.GetInFlight() {
+			continue
+		}
+		switch proxy.Op(ev.GetOp()) {
+		case proxy.OpCommit, proxy.OpRollback:
+			for _, group := range d.End(txID) {
+				txs[txID] += len(group) - 1
+				for _, idx := range group {
+					repeated[idx] = true
+				}
+			}
+		case proxy.OpQuery, proxy.OpExec, proxy.OpExecute:
+			if ev.GetError() == "" && eventfmt.Verb(ev) == "SELECT" {
+				d.Add(txID, i, ev.GetQuery(), ev.GetArgs())
+			}
+		case proxy.OpBegin, proxy.OpPrepare, proxy.OpBind:
+		}
+	}
+	return txs, repeated
+}
+
+// txDupLines describes the repeated SELECTs of transaction txID for the
+// preview and inspector, or returns nil if there are none.
+func (m Model) txDupLines(txID string) []string {
+	n := m.dupTxs[txID]
+	if n == 0 {
+		return nil
+	}
+	runs := "runs"
+	if n == 1 {
+		runs = "run"
+	}
+	return []string{fmt.Sprintf("Repeated: %d redundant %s of identical SELECTs (marked DUP)", n, runs)}
+}
@@ -0,0 +1,66 @@
+package tui
+
+import (
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// cycleViews lists the top-level views tab / shift+tab step through, in
+// order. The inspector and explain views are drill-downs of the list and
+// count as the list when cycling.
+var cycleViews = []viewMode{viewList, viewAnalytics, viewTimeline}
+
+// inputActive reports whether a text prompt currently owns the keyboard.
+func (m Model) inputActive() bool {
+	return m.searchMode || m.filterMode || m.writeMode || m.noteMode || m.analyticsSearchMode ||
+		m.analyticsWriteMode || m.confirmAnalyze != nil
+}
+
+// handleViewCycle switches views on tab / shift+tab. It reports false when
+// the key is not a cycle key or a prompt is capturing input.
+func (m Model) handleViewCycle(msg tea.KeyMsg) (Model, bool) {
+	if m.inputActive() {
+		return m, false
+	}
+	switch msg.String() {
+	case "tab":
+		return m.cycleView(1), true
+	case "shift+tab":
+		return m.cycleView(-1), true
+	}
+	return m, false
+}
+
+// cycleView moves step views forward (or backward when negative) through
+// cycleViews.
+func (m Model) cycleView(step int) Model {
+	cur := m.view
+	if cur == viewInspect || cur == viewExplain {
+		cur = viewList
+	}
+	idx := max(slices.Index(cycleViews, cur), 0)
+	n := len(cycleViews)
+	return m.switchView(cycleViews[((idx+step)%n+n)%n])
+}
+
+// switchView shows v while keeping its cursor, scroll and sort state, so
+// cycling away and back lands where the user left off.
+func (m Model) switchView(v viewMode) Model {
+	switch v {
+	case viewList:
+		m.view = viewList
+		m = m.rebuild()
+		if m.following() {
+			m.cursor = max(len(m.displayRows)-1, 0)
+		}
+	case viewAnalytics:
+		m = m.refreshAnalyticsRows()
+		m.view = viewAnalytics
+	case viewTimeline:
+		m.view = viewTimeline
+	case viewInspect, viewExplain, viewHelp:
+		m.view = v
+	}
+	return m
+}
@@ -9,6 +9,15 @@ let selectedStatsQuery = null;
 let paused = false;
 const collapsedTx = new Set();
 
+// sql-tapd started with -auth-token requires the token on the API; open the
+// UI as /?access_token=<token> and it is passed on to every API request.
+const accessToken = new URLSearchParams(location.search).get('access_token');
+
+function apiURL(path) {
+  if (!accessToken) return path;
+  return path + (path.includes('?') ? '&' : '?') + 'access_token=' + encodeURIComponent(accessToken);
+}
+
 // SQL syntax highlighting
 const SQL_KW = new Set([
   'SELECT','FROM','WHERE','AND','OR','NOT','IN','IS','NULL','AS','ON',
@@ -179,38 +188,88 @@ function render() {
 
 // Filter parsing (matches TUI filter.go syntax)
 const RE_DURATION = /^d([><])(\d+(?:\.\d+)?)(us|µs|ms|s|m)$/;
+const RE_BATCH = /^batch([><])(\d+)$/;
 const OP_KEYWORDS = new Set(['select', 'insert', 'update', 'delete']);
+
+// isSetQuery reports whether a query is a SET or RESET statement.
+function isSetQuery(q) {
+  const kw = (q || '').trim().split(/\s+/)[0].replace(/;$/, '').toUpperCase();
+  return kw === 'SET' || kw === 'RESET';
+}
+
+// opLabel returns the op shown for an event; SET and RESET statements are
+// labeled "Set" so session changes stand out.
+function opLabel(ev) {
+  if (['Query', 'Exec', 'Execute'].includes(ev.op) && isSetQuery(ev.query)) return 'Set';
+  return ev.op;
+}
+
 const PROTOCOL_OPS = new Set(['query', 'exec', 'prepare', 'bind', 'execute', 'begin', 'commit', 'rollback']);
+const STMT_KINDS = new Set(['read', 'write', 'ddl', 'other']);
+
+// parseFilterExpr splits input on the OR keyword into groups of AND-ed conditions.
+function parseFilterExpr(input) {
+  const groups = [];
+  let group = [];
+  for (const tok of input.trim().split(/\s+/)) {
+    if (!tok) continue;
+    if (tok.toLowerCase() === 'or') {
+      if (group.length > 0) groups.push(parseTokens(group));
+      group = [];
+      continue;
+    }
+    group.push(tok);
+  }
+  if (group.length > 0) groups.push(parseTokens(group));
+  return groups;
+}
 
-function parseFilterTokens(input) {
-  if (!input.trim()) return [];
-  const tokens = input.trim().split(/\s+/);
+function parseTokens(tokens) {
   return tokens.map(tok => {
-    const dm = RE_DURATION.exec(tok);
-    if (dm) {
-      const op = dm[1];
-      const val = parseFloat(dm[2]);
-      const unit = dm[3];
-      let ms;
-      switch (unit) {
-        case 'us': case 'µs': ms = val / 1000; break;
-        case 'ms': ms = val; break;
-        case 's': ms = val * 1000; break;
-        case 'm': ms = val * 60000; break;
-        default: ms = val;
-      }
-      return {kind: 'duration', op, ms};
+    let negate = false;
+    if (tok.length > 1 && (tok[0] === '-' || tok[0] === '!')) {
+      negate = true;
+      tok = tok.slice(1);
     }
-    if (tok.toLowerCase() === 'error') return {kind: 'error'};
-    if (tok.toLowerCase() === 'n+1' || tok.toLowerCase() === 'nplus1') return {kind: 'nplus1'};
-    if (tok.toLowerCase() === 'slow') return {kind: 'slow'};
-    const lower = tok.toLowerCase();
-    if (lower.startsWith('op:') && lower.length > 3) return {kind: 'op', pattern: lower.slice(3)};
-    return {kind: 'text', text: lower};
+    return {...parseToken(tok), negate};
   });
 }
 
+function parseToken(tok) {
+  const dm = RE_DURATION.exec(tok);
+  if (dm) {
+    const op = dm[1];
+    const val = parseFloat(dm[2]);
+    const unit = dm[3];
+    let ms;
+    switch (unit) {
+      case 'us': case 'µs': ms = val / 1000; break;
+      case 'ms': ms = val; break;
+      case 's': ms = val * 1000; break;
+      case 'm': ms = val * 60000; break;
+      default: ms = val;
+    }
+    return {kind: 'duration', op, ms};
+  }
+  const lower = tok.toLowerCase();
+  if (lower === 'error') return {kind: 'error'};
+  if (lower === 'n+1' || lower === 'nplus1') return {kind: 'nplus1'};
+  if (lower === 'slow') return {kind: 'slow'};
+  if (lower === 'scan') return {kind: 'scan'};
+  if (lower === 'readonly' || lower === 'ro') return {kind: 'readonly'};
+  const bm = RE_BATCH.exec(lower);
+  if (bm) return {kind: 'batch', op: bm[1], n: parseInt(bm[2], 10)};
+  if (lower.startsWith('op:') && lower.length > 3) return {kind: 'op', pattern: lower.slice(3)};
+  if (lower.startsWith('kind:') && STMT_KINDS.has(lower.slice(5))) return {kind: 'stmtkind', name: lower.slice(5)};
+  if (lower.startsWith('tx:') && lower.length > 3) return {kind: 'tx', prefix: lower.slice(3)};
+  return {kind: 'text', text: lower};
+}
+
 function matchesFilter(ev, cond) {
+  return matchesKind(ev, cond) !== !!cond.negate;
+}
+
+function matchesKind(ev, cond) {
   switch (cond.kind) {
     case 'duration':
       return cond.op === '>' ? ev.duration_ms > cond.ms : ev.duration_ms < cond.ms;
@@ -220,10 +279,26 @@ function matchesFilter(ev, cond) {
       return !!ev.n_plus_1;
     case 'slow':
       return !!ev.slow_query;
+    case 'scan':
+      return !!ev.full_scan;
+    case 'readonly':
+      return !!ev.read_only;
+    case 'batch':
+      // Only multi-row INSERTs have a batch size; other statements never match.
+      if (!ev.batch_size) return false;
+      return cond.op === '>' ? ev.batch_size > cond.n : ev.batch_size < cond.n;
     case 'op':
       if (PROTOCOL_OPS.has(cond.pattern)) return ev.op.toLowerCase() === cond.pattern;
-      if (OP_KEYWORDS.has(cond.pattern)) return (ev.query || '').trim().toLowerCase().startsWith(cond.pattern);
+      if (cond.pattern === 'n+1' || cond.pattern === 'nplus1') return !!ev.n_plus_1;
+      if (cond.pattern === 'slow') return !!ev.slow_query;
+      if (cond.pattern === 'scan') return !!ev.full_scan;
+      if (cond.pattern === 'set') return isSetQuery(ev.query);
+      if (OP_KEYWORDS.has(cond.pattern)) return ev.verb === cond.pattern;
       return false;
+    case 'stmtkind':
+      return (ev.kind || 'other') === cond.name;
+    case 'tx':
+      return !!ev.tx_id && ev.tx_id.toLowerCase().startsWith(cond.prefix);
     case 'text':
       return (ev.query || '').toLowerCase().includes(cond.text) ||
              ev.op.toLowerCase().includes(cond.text) ||
@@ -233,10 +308,10 @@ function matchesFilter(ev, cond) {
 }
 
 function getFiltered() {
-  const conds = parseFilterTokens(filterText);
-  if (conds.length === 0) return events.map((ev, i) => ({ev, idx: i}));
+  const groups = parseFilterExpr(filterText);
+  if (groups.length === 0) return events.map((ev, i) => ({ev, idx: i}));
   return events.reduce((acc, ev, i) => {
-    if (conds.every(c => matchesFilter(ev, c))) acc.push({ev, idx: i});
+    if (groups.some(conds => conds.every(c => matchesFilter(ev, c)))) acc.push({ev, idx: i});
     return acc;
   }, []);
 }
@@ -261,8 +336,7 @@ function escapeHTML(s) {
 const TX_SKIP_OPS = new Set(['Begin', 'Commit', 'Rollback', 'Bind', 'Prepare']);
 
 function buildDisplayRows() {
-  const conds = parseFilterTokens(filterText);
-  const hasFilter = conds.length > 0;
+  const hasFilter = parseFilterExpr(filterText).length > 0;
 
   // With filter active → flat list (current behavior)
   if (hasFilter) {
@@ -292,7 +366,8 @@ function buildDisplayRows() {
     const ev = events[i];
     const txId = ev.tx_id;
 
-    if (txId && ev.op === 'Begin' && !seenTx.has(txId)) {
+    if (txId && !seenTx.has(txId)) {
+      // First event of a tx: a Begin, or the implicit start under autocommit=0.
       seenTx.add(txId);
       const entry = txIndex.get(txId);
       const indices = entry ? entry.indices : [i];
@@ -318,7 +393,8 @@ function txSummaryInfo(indices) {
   const startMs = new Date(first.start_time).getTime();
   const endMs = new Date(last.start_time).getTime() + last.duration_ms;
   const durationMs = endMs - startMs;
-  return {queryCount, durationMs, time: first.start_time};
+  const failed = indices.some(i => events[i].tx_failed);
+  return {queryCount, durationMs, time: first.start_time, failed};
 }
 
 let txColorMap = new Map();
@@ -349,7 +425,7 @@ function renderTable() {
       const chevron = collapsed ? '\u25b8' : '\u25be';
       const colorIdx = getTxColor(row.txId);
       const tr = document.createElement('tr');
-      tr.className = 'row tx-summary';
+      tr.className = 'row tx-summary' + (info.failed ? ' has-error' : '');
       tr.dataset.txColor = colorIdx;
       tr.onclick = () => toggleTx(row.txId);
       tr.innerHTML =
@@ -357,7 +433,7 @@ function renderTable() {
         `<td class="col-op">Tx</td>` +
         `<td class="col-query">${info.queryCount} queries</td>` +
         `<td class="col-dur">${escapeHTML(fmtDur(info.durationMs))}</td>` +
-        `<td class="col-err"></td>`;
+        `<td class="col-err">${info.failed ? 'FAIL' : ''}</td>`;
       fragment.appendChild(tr);
     } else {
       const idx = row.eventIdx;
@@ -374,10 +450,10 @@ function renderTable() {
       if (colorIdx !== undefined) tr.dataset.txColor = colorIdx;
       tr.dataset.idx = idx;
       tr.onclick = () => selectRow(idx);
-      const status = ev.error ? 'E' : ev.n_plus_1 ? 'N+1' : ev.slow_query ? 'SLOW' : '';
+      const status = ev.error ? 'E' : ev.n_plus_1 ? 'N+1' : ev.full_scan ? 'SCAN' : ev.slow_query ? 'SLOW' : '';
       tr.innerHTML =
         `<td class="col-time">${escapeHTML(fmtTime(ev.start_time))}</td>` +
-        `<td class="col-op">${escapeHTML(ev.op)}</td>` +
+        `<td class="col-op">${escapeHTML(opLabel(ev))}</td>` +
         `<td class="col-query">${highlightSQL(ev.query)}</td>` +
         `<td class="col-dur">${escapeHTML(fmtDur(ev.duration_ms))}</td>` +
         `<td class="col-err">${status}</td>`;
@@ -396,12 +472,16 @@ function renderTable() {
 function buildStats() {
   const groups = new Map();
   const skipOps = new Set(['Begin', 'Commit', 'Rollback', 'Bind', 'Prepare']);
-  const textConds = parseFilterTokens(filterText).filter(c => c.kind === 'text');
+  // Only text conditions apply to queries; a query is kept if it satisfies
+  // those of any OR group.
+  const textGroups = parseFilterExpr(filterText).map(conds => conds.filter(c => c.kind === 'text'));
+  const matchesText = nq => textGroups.length === 0 ||
+    textGroups.some(conds => conds.every(c => nq.toLowerCase().includes(c.text) !== c.negate));
   for (const ev of events) {
     if (skipOps.has(ev.op)) continue;
     const nq = ev.normalized_query;
     if (!nq) continue;
-    if (textConds.length > 0 && !textConds.every(c => nq.toLowerCase().includes(c.text))) continue;
+    if (!matchesText(nq)) continue;
     let group = groups.get(nq);
     if (!group) {
       group = {query: nq, durations: []};
@@ -506,7 +586,7 @@ function selectRow(idx) {
   }
   selectedIdx = idx;
   const ev = events[idx];
-  document.getElementById('d-op').textContent = ev.op;
+  document.getElementById('d-op').textContent = opLabel(ev);
   document.getElementById('d-time').textContent = fmtTime(ev.start_time);
   document.getElementById('d-dur').textContent = fmtDur(ev.duration_ms);
 
@@ -518,6 +598,63 @@ function selectRow(idx) {
     rowsRow.style.display = 'none';
   }
 
+  const colsRow = document.getElementById('d-cols-row');
+  if (ev.result_columns > 0) {
+    document.getElementById('d-cols').textContent = ev.result_columns;
+    colsRow.style.display = '';
+  } else {
+    colsRow.style.display = 'none';
+  }
+
+  const kindRow = document.getElementById('d-kind-row');
+  if (ev.query) {
+    document.getElementById('d-kind').textContent = ev.kind || 'other';
+    kindRow.style.display = '';
+  } else {
+    kindRow.style.display = 'none';
+  }
+
+  const copyRow = document.getElementById('d-copy-row');
+  if (ev.copy_bytes > 0) {
+    document.getElementById('d-copy').textContent = ev.copy_bytes + (ev.copy_bytes === 1 ? ' byte' : ' bytes');
+    copyRow.style.display = '';
+  } else {
+    copyRow.style.display = 'none';
+  }
+
+  const warnRow = document.getElementById('d-warn-row');
+  if (ev.warnings > 0) {
+    document.getElementById('d-warn').textContent = ev.warnings;
+    warnRow.style.display = '';
+  } else {
+    warnRow.style.display = 'none';
+  }
+
+  const batchRow = document.getElementById('d-batch-row');
+  if (ev.batch_size > 0) {
+    document.getElementById('d-batch').textContent = ev.batch_size + (ev.batch_size === 1 ? ' row' : ' rows');
+    batchRow.style.display = '';
+  } else {
+    batchRow.style.display = 'none';
+  }
+
+  const sessionRow = document.getElementById('d-session-row');
+  const session = ev.session ? Object.keys(ev.session).sort().map(k => k + ' = ' + ev.session[k]) : [];
+  if (session.length > 0) {
+    document.getElementById('d-session').textContent = session.join(', ');
+    sessionRow.style.display = '';
+  } else {
+    sessionRow.style.display = 'none';
+  }
+
+  const stmtRow = document.getElementById('d-stmt-row');
+  if (ev.stmt_name) {
+    document.getElementById('d-stmt').textContent = ev.stmt_name;
+    stmtRow.style.display = '';
+  } else {
+    stmtRow.style.display = 'none';
+  }
+
   const txRow = document.getElementById('d-tx-row');
   if (ev.tx_id) {
     document.getElementById('d-tx').textContent = ev.tx_id;
@@ -557,10 +694,10 @@ async function runExplain(analyze) {
   explainOutput.className = 'open';
 
   try {
-    const resp = await fetch('/api/explain', {
+    const resp = await fetch(apiURL('/api/explain'), {
       method: 'POST',
       headers: {'Content-Type': 'application/json'},
-      body: JSON.stringify({query: ev.query, args: ev.args, analyze}),
+      body: JSON.stringify({query: ev.query, args: ev.args, arg_types: ev.arg_types, analyze}),
     });
     const data = await resp.json();
     if (data.error) {
@@ -943,17 +1080,57 @@ function truncateQuery(s, maxLen) {
   return s.slice(0, maxLen - 3) + '...';
 }
 
+// addEvent records ev. An update replaces the event with the same id, e.g. to
+// add its plan, and is dropped if that event is not held. It returns whether
+// ev was appended.
+function addEvent(ev) {
+  if (!ev.update) {
+    events.push(ev);
+    return true;
+  }
+  delete ev.update;
+  for (let i = events.length - 1; i >= 0; i--) {
+    if (events[i].id === ev.id) {
+      events[i] = ev;
+      break;
+    }
+  }
+  return false;
+}
+
+// History: events captured before the page was opened. lastSeq is the seq
+// of the last event received, so the stream resumes right after it without
+// gaps or duplicates; null streams new events only.
+let lastSeq = null;
+
+async function loadHistory() {
+  try {
+    const res = await fetch(apiURL('/api/history?limit=1000'));
+    if (!res.ok) return;
+    const history = await res.json();
+    for (const ev of history) addEvent(ev);
+    lastSeq = history.length > 0 ? history[history.length - 1].seq : 0;
+    render();
+  } catch (_) {
+    // Start with the live stream only.
+  }
+}
+
 // SSE
 function connectSSE() {
-  const es = new EventSource('/api/events');
+  const es = new EventSource(apiURL(lastSeq === null ? '/api/events' : '/api/events?after=' + lastSeq));
   es.onopen = () => {
     statusEl.textContent = 'connected';
     statusEl.className = 'status connected';
   };
   es.onmessage = (e) => {
-    if (paused) return;
     const ev = JSON.parse(e.data);
-    events.push(ev);
+    if (ev.seq !== undefined) lastSeq = ev.seq;
+    if (paused) return;
+    if (!addEvent(ev)) {
+      render();
+      return;
+    }
     if (ev.n_plus_1) {
       showToast('N+1 detected: ' + (ev.query || '').substring(0, 80));
     } else if (ev.slow_query) {
@@ -969,6 +1146,6 @@ function connectSSE() {
   };
 }
 
-connectSSE();
+loadHistory().then(connectSSE);
 
 window.addEventListener('resize', () => render());
@@ -6,31 +6,55 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"math"
 	"net"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/coder/websocket"
+
+	"github.com/mickamy/sql-tap/analytics"
+	"github.com/mickamy/sql-tap/auth"
 	"github.com/mickamy/sql-tap/broker"
+	"github.com/mickamy/sql-tap/dump"
 	"github.com/mickamy/sql-tap/explain"
 	"github.com/mickamy/sql-tap/proxy"
 )
 
+// History page sizes of GET /api/history.
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// wsWriteTimeout bounds how long a websocket frame write may block on a
+// slow client before the connection is dropped.
+const wsWriteTimeout = 10 * time.Second
+
 //go:embed static
 var staticFS embed.FS
 
 // Server serves the sql-tap web UI and API endpoints.
 type Server struct {
-	httpServer *http.Server
-	broker     *broker.Broker
-	explain    *explain.Client
+	httpServer   *http.Server
+	broker       *broker.Broker
+	explain      *explain.Client
+	stats        *analytics.Aggregator
+	driver       string
+	serverInfo   func() (proxy.ServerInfo, bool) // nil if not proxying
+	proxyDropped func() uint64                   // nil if not proxying
 }
 
 // New creates a new web Server backed by the given Broker.
-// explainClient may be nil if EXPLAIN is not configured.
-func New(b *broker.Broker, explainClient *explain.Client) *Server {
+// explainClient may be nil if EXPLAIN is not configured, and stats may be nil
+// if no aggregator collects the events for /api/analytics.
+func New(b *broker.Broker, explainClient *explain.Client, stats *analytics.Aggregator) *Server {
 	s := &Server{
 		broker:  b,
 		explain: explainClient,
+		stats:   stats,
 	}
 
 	mux := http.NewServeMux()
@@ -38,7 +62,12 @@ func New(b *broker.Broker, explainClient *explain.Client) *Server {
 	sub, _ := fs.Sub(staticFS, "static")
 	mux.Handle("GET /", http.FileServer(http.FS(sub)))
 	mux.HandleFunc("GET /api/events", s.handleSSE)
+	mux.HandleFunc("GET /api/ws", s.handleWS)
+	mux.HandleFunc("GET /api/history", s.handleHistory)
+	mux.HandleFunc("GET /api/analytics", s.handleAnalytics)
+	mux.HandleFunc("GET /api/server-info", s.handleServerInfo)
 	mux.HandleFunc("POST /api/explain", s.handleExplain)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
 
 	s.httpServer = &http.Server{
 		Handler:           mux,
@@ -63,51 +92,46 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// RequireToken makes the API endpoints require token as a bearer token; the
+// static web UI stays public. An empty token requires nothing. It must be
+// called before Serve.
+func (s *Server) RequireToken(token string) {
+	s.httpServer.Handler = auth.Middleware(token, s.httpServer.Handler)
+}
+
+// SetServerInfo makes GET /api/server-info report driver and the upstream
+// server info returned by info, e.g. a proxy's ServerInfo method. info may be
+// nil when nothing is proxied, as when replaying. It must be called before
+// Serve.
+func (s *Server) SetServerInfo(driver string, info func() (proxy.ServerInfo, bool)) {
+	s.driver = driver
+	s.serverInfo = info
+}
+
+// SetProxyDropped makes /metrics report the events dropped by the proxy, as
+// reported by dropped, e.g. a proxy's Dropped method. It must be called
+// before Serve.
+func (s *Server) SetProxyDropped(dropped func() uint64) {
+	s.proxyDropped = dropped
+}
+
 // Handler returns the HTTP handler for testing.
 func (s *Server) Handler() http.Handler {
 	return s.httpServer.Handler
 }
 
-type eventJSON struct {
-	ID              string   `json:"id"`
-	Op              string   `json:"op"`
-	Query           string   `json:"query"`
-	Args            []string `json:"args"`
-	StartTime       string   `json:"start_time"`
-	DurationMs      float64  `json:"duration_ms"`
-	RowsAffected    int64    `json:"rows_affected"`
-	Error           string   `json:"error,omitempty"`
-	TxID            string   `json:"tx_id,omitempty"`
-	NPlus1          bool     `json:"n_plus_1,omitempty"`
-	SlowQuery       bool     `json:"slow_query,omitempty"`
-	NormalizedQuery string   `json:"normalized_query,omitempty"`
-}
-
-func eventToJSON(ev proxy.Event) eventJSON {
-	args := make([]string, len(ev.Args))
-	copy(args, ev.Args)
-	return eventJSON{
-		ID:              ev.ID,
-		Op:              ev.Op.String(),
-		Query:           ev.Query,
-		Args:            args,
-		StartTime:       ev.StartTime.Format(time.RFC3339Nano),
-		DurationMs:      float64(ev.Duration.Microseconds()) / 1000,
-		RowsAffected:    ev.RowsAffected,
-		Error:           ev.Error,
-		TxID:            ev.TxID,
-		NPlus1:          ev.NPlus1,
-		SlowQuery:       ev.SlowQuery,
-		NormalizedQuery: ev.NormalizedQuery,
-	}
-}
-
 func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "streaming not supported", http.StatusInternalServerError)
 		return
 	}
+	backlog, ch, unsub, err := s.subscribe(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer unsub()
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -115,32 +139,298 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	flusher.Flush() // send headers immediately
 
-	ch, unsub := s.broker.Subscribe()
-	defer unsub()
+	send := func(e broker.Entry) {
+		data, ok := encodeEvent(e)
+		if !ok {
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	for _, e := range backlog {
+		send(e)
+	}
 
 	ctx := r.Context()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case ev, ok := <-ch:
+		case e, ok := <-ch:
 			if !ok {
 				return
 			}
-			data, err := json.Marshal(eventToJSON(ev))
-			if err != nil {
-				continue
+			send(e)
+		}
+	}
+}
+
+// handleWS streams the same events as handleSSE over a websocket, one JSON
+// text message per event, for clients behind proxies that buffer SSE.
+func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	backlog, ch, unsub, err := s.subscribe(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer unsub()
+
+	// Like the SSE endpoint, accept connections from any origin.
+	c, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
+	if err != nil {
+		return // Accept has already written the HTTP error
+	}
+	defer func() { _ = c.CloseNow() }()
+
+	// Clients only listen; CloseRead answers control frames and cancels ctx
+	// once the client closes the connection or goes away.
+	ctx := c.CloseRead(r.Context())
+	send := func(e broker.Entry) error {
+		data, ok := encodeEvent(e)
+		if !ok {
+			return nil
+		}
+		wctx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+		defer cancel()
+		if err := c.Write(wctx, websocket.MessageText, data); err != nil {
+			return fmt.Errorf("web: write websocket: %w", err)
+		}
+		return nil
+	}
+	for _, e := range backlog {
+		if send(e) != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				_ = c.Close(websocket.StatusGoingAway, "server shutting down")
+				return
+			}
+			if send(e) != nil {
+				return
 			}
-			fmt.Fprintf(w, "data: %s\n\n", data)
-			flusher.Flush()
 		}
 	}
 }
 
+// subscribe subscribes a streaming request to the broker. With an "after"
+// query parameter, the stream resumes after that event seq and starts with
+// the kept events the client has not seen, e.g. those that arrived between
+// loading /api/history and connecting. Without it, only new events are sent.
+func (s *Server) subscribe(r *http.Request) ([]broker.Entry, <-chan broker.Entry, func(), error) {
+	after := uint64(math.MaxUint64)
+	if v := r.URL.Query().Get("after"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid after %q: want an event seq", v)
+		}
+		after = n
+	}
+	backlog, ch, unsub := s.broker.SubscribeAfter(after)
+	return backlog, ch, unsub, nil
+}
+
+// handleHistory returns up to limit kept events as a JSON array, oldest
+// first. before pages backward: only events older than it are returned. It is
+// the seq of an event or an RFC 3339 timestamp.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+	before, err := parseBefore(r.URL.Query().Get("before"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries := s.broker.History()
+	events := make([]eventJSON, 0, min(limit, len(entries)))
+	for i := len(entries) - 1; i >= 0 && len(events) < limit; i-- {
+		e := entries[i]
+		if e.Event.InFlight || !before(e) {
+			continue
+		}
+		events = append(events, eventJSON{Event: dump.FromProxy(e.Event), Seq: e.Seq})
+	}
+	slices.Reverse(events)
+
+	b, err := json.Marshal(events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = w.Write(b)
+	_, _ = w.Write([]byte("\n"))
+}
+
+// parseBefore parses the before cursor of /api/history into a filter.
+func parseBefore(v string) (func(broker.Entry) bool, error) {
+	if v == "" {
+		return func(broker.Entry) bool { return true }, nil
+	}
+	if seq, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return func(e broker.Entry) bool { return e.Seq < seq }, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return func(e broker.Entry) bool { return e.Event.StartTime.Before(t) }, nil
+	}
+	return nil, fmt.Errorf("invalid before %q: want an event seq or RFC 3339 timestamp", v)
+}
+
+// eventJSON is the form of an event on the web API: the dump format plus the
+// event's broker seq, the cursor for /api/history and the streams.
+type eventJSON struct {
+	dump.Event
+
+	Seq uint64 `json:"seq"`
+}
+
+// encodeEvent encodes e for the streaming endpoints. It reports false for
+// events that are not streamed: the web UI shows completed statements only.
+func encodeEvent(e broker.Entry) ([]byte, bool) {
+	if e.Event.InFlight {
+		return nil, false
+	}
+	data, err := json.Marshal(eventJSON{Event: dump.FromProxy(e.Event), Seq: e.Seq})
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+type analyticsResponse struct {
+	Start  string         `json:"start"`
+	End    string         `json:"end"`
+	Events int            `json:"events"`
+	Errors int            `json:"errors"`
+	Sort   string         `json:"sort"`
+	Rows   []analyticsRow `json:"rows"`
+}
+
+type analyticsRow struct {
+	Query     string  `json:"query"`
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"` // fraction of failed executions, in [0, 1]
+	TotalMs   float64 `json:"total_ms"`
+	AvgMs     float64 `json:"avg_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+// handleAnalytics returns the per-template statistics of every query the
+// daemon has seen, sorted by the sort query parameter (total by default).
+func (s *Server) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	if s.stats == nil {
+		http.Error(w, "analytics are not collected", http.StatusServiceUnavailable)
+		return
+	}
+	by := analytics.SortTotal
+	if v := r.URL.Query().Get("sort"); v != "" {
+		var err error
+		if by, err = analytics.ParseSort(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	snap := s.stats.Snapshot(false)
+	analytics.SortRows(snap.Rows, by)
+	resp := analyticsResponse{
+		Start:  snap.Start.Format(time.RFC3339Nano),
+		End:    snap.End.Format(time.RFC3339Nano),
+		Events: snap.Events,
+		Errors: snap.Errors,
+		Sort:   by.String(),
+		Rows:   make([]analyticsRow, 0, len(snap.Rows)),
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	for _, row := range snap.Rows {
+		resp.Rows = append(resp.Rows, analyticsRow{
+			Query:     row.Query,
+			Count:     row.Count,
+			Errors:    row.Errors,
+			ErrorRate: row.ErrorRate(),
+			TotalMs:   ms(row.Total),
+			AvgMs:     ms(row.Avg),
+			P95Ms:     ms(row.P95),
+			MaxMs:     ms(row.Max),
+		})
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = w.Write(b)
+	_, _ = w.Write([]byte("\n"))
+}
+
+type serverInfoResponse struct {
+	Driver      string `json:"driver"`
+	Version     string `json:"version"` // empty until a client has connected
+	TLS         bool   `json:"tls"`
+	Compression bool   `json:"compression"`
+}
+
+// handleServerInfo returns the driver and the upstream server info of the
+// latest proxied connection.
+func (s *Server) handleServerInfo(w http.ResponseWriter, _ *http.Request) {
+	resp := serverInfoResponse{Driver: s.driver}
+	if s.serverInfo != nil {
+		if info, ok := s.serverInfo(); ok {
+			resp.Version = info.Version
+			resp.TLS = info.TLS
+			resp.Compression = info.Compression
+		}
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = w.Write(b)
+	_, _ = w.Write([]byte("\n"))
+}
+
+// handleMetrics serves sql-tapd's counters in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, "# HELP sql_tap_events_dropped_total Captured events dropped because a buffer was full.\n")
+	fmt.Fprint(w, "# TYPE sql_tap_events_dropped_total counter\n")
+	var dropped uint64
+	if s.proxyDropped != nil {
+		dropped = s.proxyDropped()
+	}
+	fmt.Fprintf(w, "sql_tap_events_dropped_total{stage=\"proxy\"} %d\n", dropped)
+	fmt.Fprintf(w, "sql_tap_events_dropped_total{stage=\"broker\"} %d\n", s.broker.Dropped())
+}
+
 type explainRequest struct {
-	Query   string   `json:"query"`
-	Args    []string `json:"args"`
-	Analyze bool     `json:"analyze"`
+	Query    string   `json:"query"`
+	Args     []string `json:"args"`
+	ArgTypes []string `json:"arg_types"`
+	Analyze  bool     `json:"analyze"`
 }
 
 type explainResponse struct {
@@ -169,7 +459,7 @@ func (s *Server) handleExplain(w http.ResponseWriter, r *http.Request) {
 		mode = explain.Analyze
 	}
 
-	result, err := s.explain.Run(r.Context(), mode, req.Query, req.Args)
+	result, err := s.explain.Run(r.Context(), mode, req.Query, req.Args, proxy.ParseArgTypes(req.ArgTypes))
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, &explainResponse{
 			Error: err.Error(),
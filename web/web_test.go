@@ -6,10 +6,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/coder/websocket"
+
+	"github.com/mickamy/sql-tap/analytics"
 	"github.com/mickamy/sql-tap/broker"
 	"github.com/mickamy/sql-tap/proxy"
 	"github.com/mickamy/sql-tap/web"
@@ -18,7 +23,7 @@ import (
 func TestStaticFiles(t *testing.T) {
 	t.Parallel()
 
-	srv := web.New(broker.New(8), nil)
+	srv := web.New(broker.New(8), nil, nil)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -43,7 +48,7 @@ func TestSSE_ReceivesEvents(t *testing.T) {
 	t.Parallel()
 
 	b := broker.New(8)
-	srv := web.New(b, nil)
+	srv := web.New(b, nil, nil)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -110,7 +115,7 @@ func TestSSE_DisconnectUnsubscribes(t *testing.T) {
 	t.Parallel()
 
 	b := broker.New(8)
-	srv := web.New(b, nil)
+	srv := web.New(b, nil, nil)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -136,10 +141,72 @@ func TestSSE_DisconnectUnsubscribes(t *testing.T) {
 	}
 }
 
+func TestWS_ReceivesEventsAndUnsubscribes(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(8)
+	srv := web.New(b, nil, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	defer func() { _ = c.CloseNow() }()
+
+	// Wait for subscription to be registered.
+	time.Sleep(50 * time.Millisecond)
+
+	b.Publish(proxy.Event{ID: "in-flight", Op: proxy.OpQuery, Query: "SELECT 2", InFlight: true})
+	b.Publish(proxy.Event{
+		ID:        "test-1",
+		Op:        proxy.OpQuery,
+		Query:     "SELECT 1",
+		StartTime: time.Date(2026, 2, 20, 15, 4, 5, 0, time.UTC),
+		Duration:  5 * time.Millisecond,
+	})
+
+	typ, data, err := c.Read(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.MessageText {
+		t.Fatalf("got message type %v, want text", typ)
+	}
+	var ev struct {
+		ID    string `json:"id"`
+		Op    string `json:"op"`
+		Query string `json:"query"`
+	}
+	if err := json.Unmarshal(data, &ev); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if ev.ID != "test-1" || ev.Op != "Query" || ev.Query != "SELECT 1" {
+		t.Fatalf("got %+v, want the completed SELECT 1 query", ev)
+	}
+
+	if err := c.Close(websocket.StatusNormalClosure, ""); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// Wait for cleanup.
+	time.Sleep(100 * time.Millisecond)
+	if n := b.SubscriberCount(); n != 0 {
+		t.Fatalf("got %d subscribers after disconnect, want 0", n)
+	}
+}
+
 func TestExplain_NotConfigured(t *testing.T) {
 	t.Parallel()
 
-	srv := web.New(broker.New(8), nil)
+	srv := web.New(broker.New(8), nil, nil)
 	ts := httptest.NewServer(srv.Handler())
 	defer ts.Close()
 
@@ -167,3 +234,305 @@ func TestExplain_NotConfigured(t *testing.T) {
 		t.Fatalf("got error %q, want contains 'not configured'", result.Error)
 	}
 }
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+
+	b := broker.NewWithHistory(8, 10)
+	srv := web.New(b, nil, nil)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close) // outlives the parallel subtests
+
+	base := time.Date(2026, 2, 20, 15, 4, 5, 0, time.UTC)
+	for i, id := range []string{"1", "2", "3", "4", "5"} {
+		b.Publish(proxy.Event{
+			ID:        id,
+			Op:        proxy.OpQuery,
+			Query:     "SELECT " + id,
+			StartTime: base.Add(time.Duration(i) * time.Second),
+			InFlight:  id == "4",
+		})
+	}
+
+	type event struct {
+		ID  string `json:"id"`
+		Seq uint64 `json:"seq"`
+	}
+	get := func(t *testing.T, query string) ([]event, int) {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+"/api/history"+query, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, resp.StatusCode
+		}
+		var events []event
+		if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return events, resp.StatusCode
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		want   []string
+		status int
+	}{
+		{name: "all, without in-flight", query: "", want: []string{"1", "2", "3", "5"}, status: http.StatusOK},
+		{name: "limit keeps the newest", query: "?limit=2", want: []string{"3", "5"}, status: http.StatusOK},
+		{name: "before seq", query: "?limit=2&before=3", want: []string{"1", "2"}, status: http.StatusOK},
+		{
+			name:   "before timestamp",
+			query:  "?before=" + base.Add(2*time.Second).Format(time.RFC3339),
+			want:   []string{"1", "2"},
+			status: http.StatusOK,
+		},
+		{name: "bad limit", query: "?limit=0", status: http.StatusBadRequest},
+		{name: "bad before", query: "?before=yesterday", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			events, status := get(t, tt.query)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d", status, tt.status)
+			}
+			ids := make([]string, len(events))
+			for i, ev := range events {
+				ids[i] = ev.ID
+				if want, _ := strconv.ParseUint(ev.ID, 10, 64); ev.Seq != want {
+					t.Errorf("event %s: seq = %d, want %d", ev.ID, ev.Seq, want)
+				}
+			}
+			if tt.want != nil && !slices.Equal(ids, tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSE_ResumesAfterHistory(t *testing.T) {
+	t.Parallel()
+
+	b := broker.NewWithHistory(8, 10)
+	srv := web.New(b, nil, nil)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// The client loaded the history up to seq 1; seq 2 arrived before it
+	// connected to the stream.
+	b.Publish(proxy.Event{ID: "1", Op: proxy.OpQuery, Query: "SELECT 1"})
+	b.Publish(proxy.Event{ID: "2", Op: proxy.OpQuery, Query: "SELECT 2"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/api/events?after=1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	time.Sleep(50 * time.Millisecond)
+	b.Publish(proxy.Event{ID: "3", Op: proxy.OpQuery, Query: "SELECT 3"})
+
+	var seqs []uint64
+	scanner := bufio.NewScanner(resp.Body)
+	for len(seqs) < 2 && scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev struct {
+			Seq uint64 `json:"seq"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		seqs = append(seqs, ev.Seq)
+	}
+	if !slices.Equal(seqs, []uint64{2, 3}) {
+		t.Fatalf("got seqs %v, want [2 3]", seqs)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	t.Parallel()
+
+	stats := analytics.New()
+	for _, ev := range []proxy.Event{
+		{Op: proxy.OpBegin, Query: "BEGIN", NormalizedQuery: "BEGIN"},
+		{Op: proxy.OpQuery, NormalizedQuery: "SELECT * FROM users WHERE id = ?", Duration: 10 * time.Millisecond},
+		{Op: proxy.OpQuery, NormalizedQuery: "SELECT * FROM users WHERE id = ?", Duration: 30 * time.Millisecond},
+		{Op: proxy.OpQuery, NormalizedQuery: "SELECT * FROM users WHERE id = ?", Duration: 20 * time.Millisecond},
+		{Op: proxy.OpExec, NormalizedQuery: "UPDATE carts SET total = ?", Duration: 100 * time.Millisecond,
+			Error: "deadlock detected"},
+	} {
+		stats.Add(ev)
+	}
+	srv := web.New(broker.New(8), nil, stats)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close) // outlives the parallel subtests
+
+	type row struct {
+		Query     string  `json:"query"`
+		Count     int     `json:"count"`
+		Errors    int     `json:"errors"`
+		ErrorRate float64 `json:"error_rate"`
+		TotalMs   float64 `json:"total_ms"`
+		AvgMs     float64 `json:"avg_ms"`
+		P95Ms     float64 `json:"p95_ms"`
+		MaxMs     float64 `json:"max_ms"`
+	}
+	users := row{Query: "SELECT * FROM users WHERE id = ?", Count: 3, TotalMs: 60, AvgMs: 20, P95Ms: 20, MaxMs: 30}
+	carts := row{Query: "UPDATE carts SET total = ?", Count: 1, Errors: 1, ErrorRate: 1,
+		TotalMs: 100, AvgMs: 100, P95Ms: 100, MaxMs: 100}
+
+	tests := []struct {
+		query  string
+		status int
+		want   []row
+	}{
+		{query: "", status: http.StatusOK, want: []row{carts, users}},
+		{query: "?sort=count", status: http.StatusOK, want: []row{users, carts}},
+		{query: "?sort=errors", status: http.StatusOK, want: []row{carts, users}},
+		{query: "?sort=fastest", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			t.Parallel()
+			req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+"/api/analytics"+tt.query, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var body struct {
+				Events int   `json:"events"`
+				Errors int   `json:"errors"`
+				Rows   []row `json:"rows"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body.Events != 4 || body.Errors != 1 {
+				t.Errorf("events, errors = %d, %d, want 4, 1", body.Events, body.Errors)
+			}
+			if !slices.Equal(body.Rows, tt.want) {
+				t.Errorf("rows = %+v, want %+v", body.Rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalytics_NotCollected(t *testing.T) {
+	t.Parallel()
+
+	srv := web.New(broker.New(8), nil, nil)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/analytics", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503", rec.Code)
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	t.Parallel()
+
+	srv := web.New(broker.New(8), nil, nil)
+	srv.SetServerInfo("postgres", func() (proxy.ServerInfo, bool) {
+		return proxy.ServerInfo{Version: "16.2"}, true
+	})
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/server-info", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	want := `{"driver":"postgres","version":"16.2","tls":false,"compression":false}` + "\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body = %s, want %s", got, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	b := broker.New(1)
+	_, unsub := b.Subscribe()
+	defer unsub()
+	for i := range 4 {
+		b.Publish(proxy.Event{ID: strconv.Itoa(i)})
+	}
+
+	srv := web.New(b, nil, nil)
+	srv.SetProxyDropped(func() uint64 { return 7 })
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `sql_tap_events_dropped_total{stage="broker"} 3`+"\n") {
+		t.Errorf("metrics missing broker drops:\n%s", body)
+	}
+	if !strings.Contains(body, `sql_tap_events_dropped_total{stage="proxy"} 7`+"\n") {
+		t.Errorf("metrics missing proxy drops:\n%s", body)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	t.Parallel()
+
+	srv := web.New(broker.New(8), nil, nil)
+	srv.RequireToken("secret")
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{name: "static files stay public", path: "/", want: http.StatusOK},
+		{name: "missing token", path: "/api/history", want: http.StatusUnauthorized},
+		{name: "wrong header", path: "/api/history", header: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "not a bearer header", path: "/api/history", header: "secret", want: http.StatusUnauthorized},
+		{name: "header", path: "/api/history", header: "Bearer secret", want: http.StatusOK},
+		{name: "query parameter", path: "/api/history?access_token=secret", want: http.StatusOK},
+		{name: "wrong query parameter", path: "/api/history?access_token=guess", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, _ := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = resp.Body.Close() }()
+
+			if resp.StatusCode != tt.want {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("WWW-Authenticate = %q, want Bearer", resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}